@@ -51,6 +51,9 @@ import {
     Delete as DeleteIcon,
     Logout as LogoutIcon
 } from '@mui/icons-material';
+import MfaVerify, { MfaChallenge } from './mfa/MfaVerify';
+import MfaEnroll from './mfa/MfaEnroll';
+import MfaSettings from './mfa/MfaSettings';
 
 // Premium Google Cloud-inspired Theme
 const theme = createTheme({
@@ -157,6 +160,9 @@ const App: React.FC = () => {
     // Auth Form State
     const [loginEmail, setLoginEmail] = useState('');
     const [loginPassword, setLoginPassword] = useState('');
+    const [mfaChallenge, setMfaChallenge] = useState<MfaChallenge | null>(null);
+    const [mfaEnrollToken, setMfaEnrollToken] = useState('');
+    const [showSecurity, setShowSecurity] = useState(false);
     const [backendVersion, setBackendVersion] = useState<string>('');
 
     useEffect(() => {
@@ -231,17 +237,26 @@ const App: React.FC = () => {
             console.log(res);
 
             const data = await res.json();
-            if (data.success) {
-                setIsLoggedIn(true);
-                fetchTenants();
+            if (!data.success) {
+                alert('Login failed: ' + data.error);
+            } else if (data.data?.mfa_required) {
+                setMfaChallenge(data.data);
+            } else if (data.data?.mfa_enrollment_required) {
+                setMfaEnrollToken(data.data.mfa_token);
             } else {
-                alert('Login failed: ' + data.message);
+                checkSession();
             }
         } catch (err) {
             console.error('Login error:', err);
         }
     };
 
+    const restartLogin = () => {
+        setLoginPassword('');
+        setMfaChallenge(null);
+        setMfaEnrollToken('');
+    };
+
     const handleLogout = async () => {
         await fetch('/auth/backoffice/logout', { method: 'POST' });
         setIsLoggedIn(false);
@@ -325,7 +340,18 @@ const App: React.FC = () => {
                                 <Typography variant="h5" sx={{ fontWeight: 700 }}>Tridorian Console</Typography>
                                 <Typography variant="body2" color="text.secondary">Sign in with your administrator account</Typography>
                             </Box>
-                            <form onSubmit={handleLogin}>
+                            {mfaChallenge && (
+                                <MfaVerify base="/auth/backoffice" challenge={mfaChallenge} onVerified={() => { restartLogin(); checkSession(); }} onCancel={restartLogin} />
+                            )}
+                            {mfaEnrollToken && (
+                                <>
+                                    <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                                        Two-step verification is required. Set up a second factor to continue.
+                                    </Typography>
+                                    <MfaEnroll base="/auth/backoffice" token={mfaEnrollToken} onDone={() => { restartLogin(); checkSession(); }} onCancel={restartLogin} />
+                                </>
+                            )}
+                            {!mfaChallenge && !mfaEnrollToken && <form onSubmit={handleLogin}>
                                 <TextField
                                     fullWidth
                                     label="Email"
@@ -351,7 +377,7 @@ const App: React.FC = () => {
                                 >
                                     Sign In
                                 </Button>
-                            </form>
+                            </form>}
                         </CardContent>
                     </Card>
                 </Box>
@@ -458,6 +484,12 @@ const App: React.FC = () => {
                                 <Typography variant="caption" color="text.secondary">{user?.email}</Typography>
                             </Box>
                             <Divider />
+                            <MenuItem onClick={() => { setShowSecurity(true); handleMenuClose(); }} sx={{ py: 1.5 }}>
+                                <ListItemIcon>
+                                    <VpnKeyIcon fontSize="small" />
+                                </ListItemIcon>
+                                <Typography variant="body2" sx={{ fontWeight: 600 }}>Two-step Verification</Typography>
+                            </MenuItem>
                             <MenuItem onClick={handleLogout} sx={{ color: 'error.main', py: 1.5 }}>
                                 <ListItemIcon>
                                     <LogoutIcon fontSize="small" sx={{ color: 'error.main' }} />
@@ -695,6 +727,17 @@ const App: React.FC = () => {
                             </Button>
                         </DialogActions>
                     </Dialog>
+
+                    {/* Two-step verification of the signed-in user */}
+                    <Dialog open={showSecurity} onClose={() => setShowSecurity(false)} maxWidth="sm" fullWidth>
+                        <DialogTitle sx={{ fontWeight: 700 }}>Two-step Verification</DialogTitle>
+                        <DialogContent>
+                            {showSecurity && <MfaSettings base="/auth/backoffice" />}
+                        </DialogContent>
+                        <DialogActions>
+                            <Button onClick={() => setShowSecurity(false)}>Close</Button>
+                        </DialogActions>
+                    </Dialog>
                 </Box>
             </Box>
         </ThemeProvider>
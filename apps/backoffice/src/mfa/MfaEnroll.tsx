@@ -0,0 +1,129 @@
+import React, { useState } from 'react';
+import { Box, Typography, TextField, Button, Alert, Paper } from '@mui/material';
+import { Key as KeyIcon, PhonelinkLock as AppIcon } from '@mui/icons-material';
+import { createPasskey, passkeysSupported } from './webauthn';
+
+interface MfaEnrollProps {
+    base: string; // e.g. /auth/mgmt
+    token?: string; // Enrollment token from the login response; the session cookie is used otherwise
+    onDone: (loggedIn: boolean) => void;
+    onCancel?: () => void;
+}
+
+// MfaEnroll adds an authenticator app or a passkey and shows the recovery
+// codes issued with the first one.
+const MfaEnroll: React.FC<MfaEnrollProps> = ({ base, token, onDone, onCancel }) => {
+    const [step, setStep] = useState<'choose' | 'totp' | 'codes'>('choose');
+    const [totp, setTotp] = useState<{ secret: string; uri: string } | null>(null);
+    const [name, setName] = useState('');
+    const [code, setCode] = useState('');
+    const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+    const [loggedIn, setLoggedIn] = useState(false);
+    const [error, setError] = useState('');
+    const [busy, setBusy] = useState(false);
+
+    const post = async (path: string, body?: object) => {
+        const headers: Record<string, string> = { 'Content-Type': 'application/json' };
+        if (token) headers['Authorization'] = `Bearer ${token}`;
+        const res = await fetch(`${base}/mfa${path}`, { method: 'POST', headers, body: body ? JSON.stringify(body) : undefined });
+        const data = await res.json();
+        if (!data.success) throw new Error(data.error || 'Request failed');
+        return data.data;
+    };
+
+    const run = async (action: () => Promise<void>) => {
+        setBusy(true);
+        setError('');
+        try {
+            await action();
+        } catch (err: any) {
+            setError(err.message || 'Request failed');
+        } finally {
+            setBusy(false);
+        }
+    };
+
+    const enrolled = (result: any) => {
+        setLoggedIn(!!result.logged_in);
+        if (result.recovery_codes?.length) {
+            setRecoveryCodes(result.recovery_codes);
+            setStep('codes');
+        } else {
+            onDone(!!result.logged_in);
+        }
+    };
+
+    const startTotp = () => run(async () => {
+        setTotp(await post('/totp'));
+        setStep('totp');
+    });
+
+    const confirmTotp = (e: React.FormEvent) => {
+        e.preventDefault();
+        run(async () => enrolled(await post('/totp/confirm', { name, code })));
+    };
+
+    const addPasskey = () => run(async () => {
+        const options = await post('/webauthn');
+        const credential = await createPasskey(options);
+        enrolled(await post('/webauthn/finish', { name, credential }));
+    });
+
+    return (
+        <Box>
+            {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+
+            {step === 'choose' && (
+                <>
+                    <TextField fullWidth size="small" label="Name (optional)" placeholder="e.g. Work phone" value={name} onChange={e => setName(e.target.value)} sx={{ mb: 2 }} />
+                    <Button fullWidth variant="outlined" startIcon={<AppIcon />} onClick={startTotp} disabled={busy} sx={{ mb: 1.5, py: 1.2 }}>
+                        Authenticator app
+                    </Button>
+                    {passkeysSupported() && (
+                        <Button fullWidth variant="outlined" startIcon={<KeyIcon />} onClick={addPasskey} disabled={busy} sx={{ py: 1.2 }}>
+                            Passkey or security key
+                        </Button>
+                    )}
+                    {onCancel && <Button fullWidth onClick={onCancel} sx={{ mt: 1.5 }}>Cancel</Button>}
+                </>
+            )}
+
+            {step === 'totp' && totp && (
+                <form onSubmit={confirmTotp}>
+                    <Typography variant="body2" sx={{ mb: 1 }}>
+                        Add this key to your authenticator app, or open the link on a device that has one:
+                    </Typography>
+                    <Paper variant="outlined" sx={{ p: 1.5, mb: 1, fontFamily: 'monospace', wordBreak: 'break-all', bgcolor: '#f8f9fa' }}>
+                        {totp.secret.match(/.{1,4}/g)?.join(' ')}
+                    </Paper>
+                    <Typography variant="body2" sx={{ mb: 2 }}><a href={totp.uri}>Open in authenticator app</a></Typography>
+                    <TextField
+                        fullWidth
+                        autoFocus
+                        label="Code from the app"
+                        value={code}
+                        onChange={e => setCode(e.target.value)}
+                        inputProps={{ inputMode: 'numeric', autoComplete: 'one-time-code' }}
+                        required
+                    />
+                    <Button fullWidth variant="contained" type="submit" disabled={busy} sx={{ mt: 2, py: 1.2 }}>Confirm</Button>
+                    <Button fullWidth onClick={() => setStep('choose')} sx={{ mt: 1 }}>Back</Button>
+                </form>
+            )}
+
+            {step === 'codes' && (
+                <>
+                    <Alert severity="warning" sx={{ mb: 2 }}>
+                        Save these recovery codes somewhere safe. Each can be used once to sign in if you lose your authenticator. They will not be shown again.
+                    </Alert>
+                    <Paper variant="outlined" sx={{ p: 2, mb: 2, display: 'grid', gridTemplateColumns: '1fr 1fr', gap: 1, fontFamily: 'monospace', bgcolor: '#f8f9fa' }}>
+                        {recoveryCodes.map(c => <span key={c}>{c}</span>)}
+                    </Paper>
+                    <Button fullWidth variant="contained" onClick={() => onDone(loggedIn)} sx={{ py: 1.2 }}>I have saved my codes</Button>
+                </>
+            )}
+        </Box>
+    );
+};
+
+export default MfaEnroll;
@@ -0,0 +1,148 @@
+import React, { useState, useEffect } from 'react';
+import {
+    Box, Typography, Button, IconButton, List, ListItem, ListItemIcon, ListItemText,
+    Dialog, DialogTitle, DialogContent, DialogActions, Alert, Paper
+} from '@mui/material';
+import {
+    Add as AddIcon, Delete as DeleteIcon, Key as KeyIcon, PhonelinkLock as AppIcon
+} from '@mui/icons-material';
+import MfaEnroll from './MfaEnroll';
+
+interface MfaCredential {
+    id: string;
+    type: 'totp' | 'webauthn';
+    name: string;
+    created_at: string;
+    last_used_at?: string;
+}
+
+interface MfaSettingsProps {
+    base: string; // e.g. /auth/mgmt
+}
+
+// MfaSettings lets the signed-in user manage their own second factors.
+const MfaSettings: React.FC<MfaSettingsProps> = ({ base }) => {
+    const [credentials, setCredentials] = useState<MfaCredential[]>([]);
+    const [remaining, setRemaining] = useState(0);
+    const [required, setRequired] = useState(false);
+    const [showEnroll, setShowEnroll] = useState(false);
+    const [recoveryCodes, setRecoveryCodes] = useState<string[]>([]);
+    const [error, setError] = useState('');
+
+    useEffect(() => {
+        fetchCredentials();
+    }, []);
+
+    const fetchCredentials = async () => {
+        try {
+            const res = await fetch(`${base}/mfa`);
+            const data = await res.json();
+            if (data.success) {
+                setCredentials(data.data.credentials || []);
+                setRemaining(data.data.recovery_codes_remaining || 0);
+                setRequired(data.data.required);
+            }
+        } catch (err) {
+            console.error('Failed to fetch second factors', err);
+        }
+    };
+
+    const handleDelete = async (cred: MfaCredential) => {
+        if (!confirm(`Remove "${cred.name}"?`)) return;
+        setError('');
+        const res = await fetch(`${base}/mfa`, {
+            method: 'DELETE',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ id: cred.id })
+        });
+        const data = await res.json();
+        if (!data.success) setError(data.error || 'Failed to remove');
+        fetchCredentials();
+    };
+
+    const handleRegenerate = async () => {
+        if (!confirm('Replace your recovery codes? The current ones will stop working.')) return;
+        setError('');
+        const res = await fetch(`${base}/mfa/recovery-codes`, { method: 'POST' });
+        const data = await res.json();
+        if (data.success) {
+            setRecoveryCodes(data.data.recovery_codes);
+            fetchCredentials();
+        } else {
+            setError(data.error || 'Failed to generate codes');
+        }
+    };
+
+    const formatTime = (value?: string) => value ? new Date(value).toLocaleString() : 'Never';
+
+    return (
+        <Box>
+            {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+            {credentials.length === 0 ? (
+                <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                    {required
+                        ? 'Your organization requires a second factor. Add one to keep signing in.'
+                        : 'Protect your account with an authenticator app or a passkey in addition to your password.'}
+                </Typography>
+            ) : (
+                <List dense disablePadding sx={{ mb: 2 }}>
+                    {credentials.map(cred => (
+                        <ListItem
+                            key={cred.id}
+                            disableGutters
+                            secondaryAction={
+                                <IconButton edge="end" onClick={() => handleDelete(cred)} disabled={required && credentials.length === 1}>
+                                    <DeleteIcon fontSize="small" />
+                                </IconButton>
+                            }
+                        >
+                            <ListItemIcon sx={{ minWidth: 36 }}>
+                                {cred.type === 'webauthn' ? <KeyIcon fontSize="small" /> : <AppIcon fontSize="small" />}
+                            </ListItemIcon>
+                            <ListItemText primary={cred.name} secondary={`Last used: ${formatTime(cred.last_used_at)}`} />
+                        </ListItem>
+                    ))}
+                </List>
+            )}
+
+            <Box sx={{ display: 'flex', gap: 1, flexWrap: 'wrap', alignItems: 'center' }}>
+                <Button variant="outlined" size="small" startIcon={<AddIcon />} onClick={() => setShowEnroll(true)} sx={{ textTransform: 'none', fontWeight: 600 }}>
+                    Add method
+                </Button>
+                {credentials.length > 0 && (
+                    <Button size="small" onClick={handleRegenerate} sx={{ textTransform: 'none' }}>
+                        New recovery codes ({remaining} left)
+                    </Button>
+                )}
+            </Box>
+
+            <Dialog open={showEnroll} onClose={() => setShowEnroll(false)} maxWidth="xs" fullWidth>
+                <DialogTitle sx={{ fontWeight: 700 }}>Add a second factor</DialogTitle>
+                <DialogContent>
+                    {showEnroll && (
+                        <MfaEnroll
+                            base={base}
+                            onDone={() => { setShowEnroll(false); fetchCredentials(); }}
+                            onCancel={() => setShowEnroll(false)}
+                        />
+                    )}
+                </DialogContent>
+            </Dialog>
+
+            <Dialog open={recoveryCodes.length > 0} onClose={() => setRecoveryCodes([])} maxWidth="xs" fullWidth>
+                <DialogTitle sx={{ fontWeight: 700 }}>New recovery codes</DialogTitle>
+                <DialogContent>
+                    <Alert severity="warning" sx={{ mb: 2 }}>Save these codes somewhere safe. They will not be shown again.</Alert>
+                    <Paper variant="outlined" sx={{ p: 2, display: 'grid', gridTemplateColumns: '1fr 1fr', gap: 1, fontFamily: 'monospace', bgcolor: '#f8f9fa' }}>
+                        {recoveryCodes.map(c => <span key={c}>{c}</span>)}
+                    </Paper>
+                </DialogContent>
+                <DialogActions>
+                    <Button onClick={() => setRecoveryCodes([])}>Done</Button>
+                </DialogActions>
+            </Dialog>
+        </Box>
+    );
+};
+
+export default MfaSettings;
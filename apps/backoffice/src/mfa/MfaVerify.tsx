@@ -0,0 +1,108 @@
+import React, { useState } from 'react';
+import { Box, Typography, TextField, Button, Alert, Link } from '@mui/material';
+import { Key as KeyIcon } from '@mui/icons-material';
+import { getPasskey, passkeysSupported } from './webauthn';
+
+export interface MfaChallenge {
+    mfa_token: string;
+    methods: ('totp' | 'webauthn' | 'recovery')[];
+    webauthn?: any;
+}
+
+interface MfaVerifyProps {
+    base: string; // e.g. /auth/mgmt
+    challenge: MfaChallenge;
+    onVerified: () => void;
+    onCancel: () => void;
+}
+
+// MfaVerify is the second step of a sign-in.
+const MfaVerify: React.FC<MfaVerifyProps> = ({ base, challenge, onVerified, onCancel }) => {
+    const hasTotp = challenge.methods.includes('totp');
+    const hasPasskey = challenge.methods.includes('webauthn') && passkeysSupported();
+    const hasRecovery = challenge.methods.includes('recovery');
+
+    const [useRecovery, setUseRecovery] = useState(!hasTotp && !hasPasskey);
+    const [code, setCode] = useState('');
+    const [error, setError] = useState('');
+    const [busy, setBusy] = useState(false);
+
+    const verify = async (body: object) => {
+        setBusy(true);
+        setError('');
+        try {
+            const res = await fetch(`${base}/mfa/verify`, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ mfa_token: challenge.mfa_token, ...body })
+            });
+            const data = await res.json();
+            if (data.success) {
+                onVerified();
+            } else {
+                setError(data.error || 'Verification failed');
+                setCode('');
+            }
+        } catch (err) {
+            console.error(err);
+            setError('Verification failed');
+        } finally {
+            setBusy(false);
+        }
+    };
+
+    const handlePasskey = async () => {
+        try {
+            const credential = await getPasskey(challenge.webauthn);
+            await verify({ method: 'webauthn', credential });
+        } catch (err) {
+            console.error(err);
+            setError('The security key did not respond');
+        }
+    };
+
+    const handleSubmit = (e: React.FormEvent) => {
+        e.preventDefault();
+        verify({ method: useRecovery ? 'recovery' : 'totp', code });
+    };
+
+    return (
+        <Box>
+            <Typography variant="subtitle1" sx={{ fontWeight: 700, mb: 1 }}>Two-step verification</Typography>
+            {error && <Alert severity="error" sx={{ mb: 2 }}>{error}</Alert>}
+
+            {hasPasskey && !useRecovery && (
+                <Button fullWidth variant="outlined" startIcon={<KeyIcon />} onClick={handlePasskey} disabled={busy} sx={{ mb: 2, py: 1.2 }}>
+                    Use passkey or security key
+                </Button>
+            )}
+
+            {(hasTotp || useRecovery) && (
+                <form onSubmit={handleSubmit}>
+                    <TextField
+                        fullWidth
+                        autoFocus
+                        label={useRecovery ? 'Recovery code' : 'Code from your authenticator app'}
+                        margin="normal"
+                        value={code}
+                        onChange={e => setCode(e.target.value)}
+                        inputProps={useRecovery ? {} : { inputMode: 'numeric', autoComplete: 'one-time-code' }}
+                        required
+                    />
+                    <Button fullWidth variant="contained" type="submit" disabled={busy} sx={{ mt: 2, py: 1.5 }}>Verify</Button>
+                </form>
+            )}
+
+            <Box sx={{ display: 'flex', justifyContent: 'space-between', mt: 2 }}>
+                <Link component="button" type="button" variant="body2" onClick={onCancel}>Back</Link>
+                {hasRecovery && (hasTotp || hasPasskey) && (
+                    <Link component="button" type="button" variant="body2" onClick={() => { setUseRecovery(!useRecovery); setError(''); }}>
+                        {useRecovery ? 'Use your authenticator' : 'Use a recovery code'}
+                    </Link>
+                )}
+            </Box>
+        </Box>
+    );
+};
+
+export default MfaVerify;
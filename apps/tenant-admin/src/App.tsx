@@ -1,8 +1,9 @@
 import React, { useState, useEffect } from 'react';
 import { Box, CircularProgress, ThemeProvider, CssBaseline } from '@mui/material';
 import { theme } from './theme/theme';
-import { User, Tenant, AccessPolicy, SignInPolicy, Node, Admin } from './types';
+import { User, Tenant, AccessPolicy, SignInPolicy, Node, NodeEnrollment, Admin, AdminAccess, AccessGrant, SNATPool } from './types';
 import DashboardLayout from './layout/DashboardLayout';
+import { can } from './types/permissions';
 
 // Features
 import LoginView from './features/auth/LoginView';
@@ -15,8 +16,10 @@ import NodesView from './features/nodes/NodesView';
 import AdminsView from './features/admins/AdminsView';
 import SettingsView from './features/dashboard/SettingsView';
 import ApplicationsView from './features/applications/ApplicationsView';
+import IdentityProvidersView from './features/identity/IdentityProvidersView';
+import AuditLogView from './features/audit/AuditLogView';
 
-type ViewType = 'loading' | 'login' | 'change_password' | 'wizard' | 'dashboard' | 'users' | 'signin_policies' | 'access_policies' | 'applications' | 'nodes' | 'settings' | 'admins';
+type ViewType = 'loading' | 'login' | 'change_password' | 'wizard' | 'dashboard' | 'users' | 'signin_policies' | 'access_policies' | 'applications' | 'identity_providers' | 'nodes' | 'settings' | 'admins' | 'audit';
 
 const App: React.FC = () => {
     const [view, setView] = useState<ViewType>('loading');
@@ -42,7 +45,14 @@ const App: React.FC = () => {
                 setView('login');
                 return;
             }
-            setUser(userData.data);
+            // Permissions decide which parts of the console are shown
+            let grant: AccessGrant | undefined;
+            const grantRes = await fetch('/api/v1/profile/permissions');
+            if (grantRes.ok) {
+                const grantData = await grantRes.json();
+                grant = grantData.data;
+            }
+            setUser({ ...userData.data, grant });
 
             if (userData.data.change_password_required) {
                 setView('change_password');
@@ -129,6 +139,7 @@ const App: React.FC = () => {
     };
 
     // Global Handlers
+    // LoginView continues with two-step verification when the response asks for it
     const handleLogin = async (email: string, password: string) => {
         try {
             const res = await fetch('/auth/mgmt/login', {
@@ -136,13 +147,11 @@ const App: React.FC = () => {
                 headers: { 'Content-Type': 'application/json' },
                 body: JSON.stringify({ email, password })
             });
-            const data = await res.json();
-            if (data.success) {
-                window.location.reload();
-            } else {
-                alert('Login failed: ' + data.message);
-            }
-        } catch (err) { console.error(err); }
+            return await res.json();
+        } catch (err) {
+            console.error(err);
+            return null;
+        }
     };
 
     const handleChangePassword = async (old_password: string, new_password: string) => {
@@ -185,14 +194,14 @@ const App: React.FC = () => {
                     window.location.reload(); // Simplest way to re-run the whole auth logic clean.
                 }
             } else {
-                alert('Error: ' + data.message);
+                alert('Error: ' + data.error);
             }
         } catch (err) { console.error(err); }
     };
 
 
 
-    const handleCreateNode = async (name: string, skuId: string, clientCIDR: string): Promise<string | null> => {
+    const handleCreateNode = async (name: string, skuId: string, clientCIDR: string): Promise<NodeEnrollment | null> => {
         const res = await fetch('/api/v1/nodes', {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
@@ -201,12 +210,85 @@ const App: React.FC = () => {
         if (res.ok) {
             const data = await res.json();
             fetchNodes();
-            return data.data.id;
+            return data.data;
         }
         alert('Failed to create gateway');
         return null;
     };
 
+    const handleIssueEnrollmentToken = async (id: string): Promise<NodeEnrollment | null> => {
+        const res = await fetch('/api/v1/nodes/enrollment-token', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ id })
+        });
+        const data = await res.json();
+        if (res.ok) {
+            fetchNodes();
+            return data.data;
+        }
+        alert(data.error || 'Failed to issue an enrollment token');
+        return null;
+    };
+
+    const handleResetEnrollment = async (id: string): Promise<NodeEnrollment | null> => {
+        if (!confirm('Reset this gateway\'s enrollment? Its certificate is revoked and it disconnects until it enrolls again.')) return null;
+        const res = await fetch('/api/v1/nodes/reset-enrollment', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ id })
+        });
+        const data = await res.json();
+        if (res.ok) {
+            fetchNodes();
+            return data.data;
+        }
+        alert(data.error || 'Failed to reset the enrollment');
+        return null;
+    };
+
+    const handleHardwareChange = async (id: string, approve: boolean) => {
+        if (!approve && !confirm('Reject the new hardware? The gateway\'s certificate is revoked and it must enroll again.')) return;
+        const res = await fetch(`/api/v1/nodes/hardware-changes/${approve ? 'approve' : 'reject'}`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ id })
+        });
+        if (!res.ok) {
+            const data = await res.json();
+            alert(data.error || 'Failed to update the hardware change');
+        }
+        fetchNodes();
+    };
+
+    const handleSetNodeGroup = async (id: string, groupId: string): Promise<boolean> => {
+        const res = await fetch('/api/v1/nodes/group', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ id, gateway_group_id: groupId })
+        });
+        if (!res.ok) {
+            const data = await res.json();
+            alert(data.error || 'Failed to change the gateway group');
+        }
+        fetchNodes();
+        return res.ok;
+    };
+
+    const handleSetNodeEgress = async (id: string, mode: string, pools: SNATPool[]): Promise<Node | null> => {
+        const res = await fetch('/api/v1/nodes/egress', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ id, egress_mode: mode, snat_pools: pools })
+        });
+        const data = await res.json();
+        if (!res.ok) {
+            alert(data.error || 'Failed to change the egress mode');
+        }
+        fetchNodes();
+        return res.ok ? data.data : null;
+    };
+
     const handleDeleteNode = async (id: string) => {
         if (!confirm('Are you sure? This will disconnect the gateway.')) return;
         await fetch('/api/v1/nodes', {
@@ -233,7 +315,7 @@ const App: React.FC = () => {
             return data.data.password; // Return the generated password
         } else {
             const data = await res.json();
-            alert('Failed to create admin: ' + data.message);
+            alert('Failed to create admin: ' + data.error);
             return null;
         }
     };
@@ -248,20 +330,31 @@ const App: React.FC = () => {
         if (res.ok) fetchAdmins();
         else {
             const data = await res.json();
-            alert('Error: ' + data.message);
+            alert('Error: ' + data.error);
         }
     };
 
-    const handleUpdateAdmin = async (id: string, name: string, role: string) => {
+    const handleResetAdminMFA = async (id: string) => {
+        if (!confirm('Remove all second factors of this administrator? They will sign in with their password only, or set up a new factor if your organization requires one.')) return;
+        const res = await fetch('/api/v1/admins/mfa/reset', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ id })
+        });
+        const data = await res.json();
+        alert(data.success ? 'Two-step verification was reset.' : 'Error: ' + data.error);
+    };
+
+    const handleUpdateAdmin = async (id: string, name: string, access: AdminAccess, breakGlass: boolean) => {
         const res = await fetch('/api/v1/admins', {
             method: 'PATCH',
             headers: { 'Content-Type': 'application/json' },
-            body: JSON.stringify({ id, name, role })
+            body: JSON.stringify({ id, name, ...access, break_glass: breakGlass })
         });
         if (res.ok) fetchAdmins();
         else {
             const data = await res.json();
-            alert('Error: ' + data.message);
+            alert('Error: ' + data.error);
         }
     };
 
@@ -288,8 +381,10 @@ const App: React.FC = () => {
             case 'signin_policies': return <SignInPoliciesView policies={signInPolicies} onRefresh={fetchSignInPolicies} />;
             case 'access_policies': return <PoliciesView policies={accessPolicies} onRefresh={fetchPolicies} />;
             case 'applications': return <ApplicationsView />;
-            case 'nodes': return <NodesView nodes={nodes} onCreate={handleCreateNode} onDelete={handleDeleteNode} />;
-            case 'admins': return <AdminsView admins={admins} domains={domains} onCreate={handleCreateAdmin} onDelete={handleDeleteAdmin} onUpdate={handleUpdateAdmin} />;
+            case 'identity_providers': return <IdentityProvidersView />;
+            case 'nodes': return <NodesView nodes={nodes} grant={user?.grant} onCreate={handleCreateNode} onIssueToken={handleIssueEnrollmentToken} onResetEnrollment={handleResetEnrollment} onHardwareChange={handleHardwareChange} onSetGroup={handleSetNodeGroup} onSetEgress={handleSetNodeEgress} onGroupsChanged={fetchNodes} onDelete={handleDeleteNode} />;
+            case 'admins': return <AdminsView admins={admins} domains={domains} onCreate={handleCreateAdmin} onDelete={handleDeleteAdmin} onUpdate={handleUpdateAdmin} onResetMFA={handleResetAdminMFA} canManage={can(user?.grant, 'admins:write')} />;
+            case 'audit': return <AuditLogView />;
             case 'settings': return <SettingsView tenant={tenant} onRefresh={checkSession} user={user} />;
             default: return <DashboardView tenant={tenant} />;
         }
@@ -304,4 +399,4 @@ const App: React.FC = () => {
     );
 };
 
-export default App;
\ No newline at end of file
+export default App;
\ No newline at end of file
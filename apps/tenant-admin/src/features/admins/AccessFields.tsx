@@ -0,0 +1,103 @@
+import React from 'react';
+import {
+    Box, Typography, Select, MenuItem, InputLabel, FormControl, Chip, ListSubheader
+} from '@mui/material';
+import { AdminAccess, Application, BuiltinAdminRole, Node, Role } from '../../types';
+import { roleLabels } from '../../types/permissions';
+
+const builtinRoles: { value: BuiltinAdminRole; hint: string }[] = [
+    { value: 'super_admin', hint: 'Everything' },
+    { value: 'admin', hint: 'Gateways, apps, policies, sessions' },
+    { value: 'policy_admin', hint: 'Policies only' },
+    { value: 'helpdesk', hint: 'Views and ends VPN sessions' },
+    { value: 'auditor', hint: 'Reads everything, changes nothing' }
+];
+
+interface AccessFieldsProps {
+    value: AdminAccess;
+    onChange: (access: AdminAccess) => void;
+    roles: Role[];
+    nodes: Node[];
+    applications: Application[];
+}
+
+// AccessFields picks an administrator's role, built-in or custom, and
+// optionally limits it to some gateways and applications.
+const AccessFields: React.FC<AccessFieldsProps> = ({ value, onChange, roles, nodes, applications }) => {
+    // Custom roles are selected by id, built-in roles by name
+    const selected = value.role === 'custom' ? `custom:${value.role_id}` : value.role;
+
+    const handleRole = (v: string) => {
+        if (v.startsWith('custom:')) {
+            onChange({ ...value, role: 'custom', role_id: v.slice('custom:'.length) });
+        } else {
+            onChange({ ...value, role: v as BuiltinAdminRole, role_id: null });
+        }
+    };
+
+    const nameOf = (list: { id: string; name: string }[], id: string) => list.find(x => x.id === id)?.name || id;
+
+    return (
+        <Box>
+            <FormControl fullWidth sx={{ mb: 3 }}>
+                <InputLabel>Role</InputLabel>
+                <Select
+                    value={selected}
+                    label="Role"
+                    onChange={(e) => handleRole(e.target.value)}
+                    sx={{ borderRadius: 2 }}
+                >
+                    <ListSubheader>Built-in roles</ListSubheader>
+                    {builtinRoles.map(r => (
+                        <MenuItem key={r.value} value={r.value}>{roleLabels[r.value]} ({r.hint})</MenuItem>
+                    ))}
+                    {roles.length > 0 && <ListSubheader>Custom roles</ListSubheader>}
+                    {roles.map(r => (
+                        <MenuItem key={r.id} value={`custom:${r.id}`}>{r.name}</MenuItem>
+                    ))}
+                </Select>
+            </FormControl>
+
+            <Typography variant="subtitle2" sx={{ fontWeight: 700 }}>Scope</Typography>
+            <Typography variant="caption" color="text.secondary" display="block" sx={{ mb: 2 }}>
+                Leave empty for all. When set, gateway, session and application permissions only apply to the selected ones.
+            </Typography>
+            <FormControl fullWidth sx={{ mb: 2 }}>
+                <InputLabel>Gateways</InputLabel>
+                <Select
+                    multiple
+                    value={value.node_ids}
+                    label="Gateways"
+                    onChange={(e) => onChange({ ...value, node_ids: e.target.value as string[] })}
+                    renderValue={(ids) => (
+                        <Box sx={{ display: 'flex', flexWrap: 'wrap', gap: 0.5 }}>
+                            {(ids as string[]).map(id => <Chip key={id} size="small" label={nameOf(nodes, id)} />)}
+                        </Box>
+                    )}
+                    sx={{ borderRadius: 2 }}
+                >
+                    {nodes.map(n => <MenuItem key={n.id} value={n.id}>{n.name}</MenuItem>)}
+                </Select>
+            </FormControl>
+            <FormControl fullWidth>
+                <InputLabel>Applications</InputLabel>
+                <Select
+                    multiple
+                    value={value.application_ids}
+                    label="Applications"
+                    onChange={(e) => onChange({ ...value, application_ids: e.target.value as string[] })}
+                    renderValue={(ids) => (
+                        <Box sx={{ display: 'flex', flexWrap: 'wrap', gap: 0.5 }}>
+                            {(ids as string[]).map(id => <Chip key={id} size="small" label={nameOf(applications, id)} />)}
+                        </Box>
+                    )}
+                    sx={{ borderRadius: 2 }}
+                >
+                    {applications.map(a => <MenuItem key={a.id} value={a.id}>{a.name}</MenuItem>)}
+                </Select>
+            </FormControl>
+        </Box>
+    );
+};
+
+export default AccessFields;
@@ -3,29 +3,37 @@ import {
     Box, Typography, Button, Table, TableHead, TableRow, TableCell,
     TableBody, Paper, IconButton, Dialog, DialogTitle, DialogContent,
     TextField, DialogActions, Select, MenuItem, InputLabel, FormControl, Alert, Grid,
-    Avatar, Chip, Tooltip, Stack, useMediaQuery, useTheme
+    Avatar, Chip, Tooltip, Stack, FormControlLabel, Switch, useMediaQuery, useTheme
 } from '@mui/material';
 import {
     Add as AddIcon,
     Delete as DeleteIcon,
     Edit as EditIcon,
+    LockReset as LockResetIcon,
     ContentCopy as CopyIcon,
     Person as PersonIcon,
     Security as SecurityIcon,
     SupervisorAccount as SupervisorIcon,
     Warning as WarningIcon
 } from '@mui/icons-material';
-import { Admin } from '../../types';
+import { Admin, AdminAccess, Application, Node, Permission, Role } from '../../types';
+import { roleLabels } from '../../types/permissions';
+import AccessFields from './AccessFields';
+import RolesCard from './RolesCard';
+
+const defaultAccess: AdminAccess = { role: 'admin', role_id: null, node_ids: [], application_ids: [] };
 
 interface AdminsViewProps {
     admins: Admin[];
     domains: string[];
     onCreate: (admin: any) => Promise<string | null>;
     onDelete: (id: string) => Promise<void>;
-    onUpdate: (id: string, name: string, role: string) => Promise<void>;
+    onUpdate: (id: string, name: string, access: AdminAccess, breakGlass: boolean) => Promise<void>;
+    onResetMFA: (id: string) => Promise<void>;
+    canManage: boolean; // Holds admins:write; others only see the list
 }
 
-const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDelete, onUpdate }) => {
+const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDelete, onUpdate, onResetMFA, canManage }) => {
     const theme = useTheme();
     const isMobile = useMediaQuery(theme.breakpoints.down('md'));
     const isSmallMobile = useMediaQuery(theme.breakpoints.down('sm'));
@@ -35,9 +43,30 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
     const [name, setName] = useState('');
     const [username, setUsername] = useState('');
     const [selectedDomain, setSelectedDomain] = useState('');
-    const [role, setRole] = useState<'super_admin' | 'admin' | 'policy_admin'>('admin');
+    const [access, setAccess] = useState<AdminAccess>(defaultAccess);
     const [error, setError] = useState<string | null>(null);
 
+    // Custom roles and the gateways and applications an administrator can be scoped to
+    const [roles, setRoles] = useState<Role[]>([]);
+    const [permissions, setPermissions] = useState<Permission[]>([]);
+    const [nodes, setNodes] = useState<Node[]>([]);
+    const [applications, setApplications] = useState<Application[]>([]);
+
+    const fetchRoles = async () => {
+        const res = await fetch('/api/v1/roles');
+        const data = await res.json();
+        if (data.success) {
+            setRoles(data.data.roles || []);
+            setPermissions(data.data.permissions || []);
+        }
+    };
+
+    useEffect(() => {
+        fetchRoles();
+        fetch('/api/v1/nodes').then(res => res.json()).then(data => { if (data.success) setNodes(data.data || []); });
+        fetch('/api/v1/applications').then(res => res.json()).then(data => { if (data.success) setApplications(data.data || []); });
+    }, []);
+
     // Success Dialog State
     const [generatedPassword, setGeneratedPassword] = useState<string | null>(null);
     const [createdAdminEmail, setCreatedAdminEmail] = useState('');
@@ -49,11 +78,12 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
     }, [showDialog, domains, selectedDomain]);
 
     // Edit Name Dialog State
-    const [editDialog, setEditDialog] = useState<{ open: boolean; adminId: string; name: string; role: 'super_admin' | 'admin' | 'policy_admin' }>({
+    const [editDialog, setEditDialog] = useState<{ open: boolean; adminId: string; name: string; access: AdminAccess; breakGlass: boolean }>({
         open: false,
         adminId: '',
         name: '',
-        role: 'admin'
+        access: defaultAccess,
+        breakGlass: false
     });
 
     // Delete Confirmation State
@@ -64,12 +94,18 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
     });
 
     const handleOpenEdit = (admin: Admin) => {
-        setEditDialog({ open: true, adminId: admin.id, name: admin.name, role: admin.role });
+        setEditDialog({
+            open: true,
+            adminId: admin.id,
+            name: admin.name,
+            access: { role: admin.role, role_id: admin.role_id || null, node_ids: admin.node_ids || [], application_ids: admin.application_ids || [] },
+            breakGlass: !!admin.break_glass
+        });
     };
 
     const handleSaveEdit = async () => {
         if (editDialog.name.trim()) {
-            await onUpdate(editDialog.adminId, editDialog.name, editDialog.role);
+            await onUpdate(editDialog.adminId, editDialog.name, editDialog.access, editDialog.breakGlass);
             setEditDialog({ ...editDialog, open: false });
         }
     };
@@ -92,7 +128,7 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
         }
 
         const email = `${username}@${selectedDomain}`;
-        const newAdmin = { name, email, role }; // No password sent
+        const newAdmin = { name, email, ...access }; // No password sent
 
         const password = await onCreate(newAdmin);
 
@@ -107,7 +143,7 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
         setShowDialog(false);
         setName('');
         setUsername('');
-        setRole('admin');
+        setAccess(defaultAccess);
         setError(null);
     };
 
@@ -116,7 +152,7 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
         setCreatedAdminEmail('');
         setName('');
         setUsername('');
-        setRole('admin');
+        setAccess(defaultAccess);
     };
 
     const stringToColor = (string: string) => {
@@ -140,16 +176,18 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
                     <Typography variant={isSmallMobile ? "h5" : "h4"} sx={{ fontWeight: 800, color: '#202124' }}>Console Administrators</Typography>
                     <Typography color="text.secondary" sx={{ fontSize: isSmallMobile ? '0.85rem' : '1rem' }}>Manage administrators for this Tenant.</Typography>
                 </Box>
-                <Button
-                    variant="contained"
-                    disableElevation
-                    size={isSmallMobile ? "small" : "medium"}
-                    startIcon={<AddIcon />}
-                    onClick={() => setShowDialog(true)}
-                    sx={{ borderRadius: 2, px: isSmallMobile ? 2 : 3, bgcolor: '#1a73e8', '&:hover': { bgcolor: '#1765cc' } }}
-                >
-                    {isSmallMobile ? "Add" : "Add Administrator"}
-                </Button>
+                {canManage && (
+                    <Button
+                        variant="contained"
+                        disableElevation
+                        size={isSmallMobile ? "small" : "medium"}
+                        startIcon={<AddIcon />}
+                        onClick={() => setShowDialog(true)}
+                        sx={{ borderRadius: 2, px: isSmallMobile ? 2 : 3, bgcolor: '#1a73e8', '&:hover': { bgcolor: '#1765cc' } }}
+                    >
+                        {isSmallMobile ? "Add" : "Add Administrator"}
+                    </Button>
+                )}
             </Box>
 
             {admins.length === 0 ? (
@@ -190,6 +228,11 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
                                                 {isSmallMobile && (
                                                     <Typography variant="caption" display="block" color="text.secondary">{admin.email}</Typography>
                                                 )}
+                                                {(admin.break_glass || admin.sso) && (
+                                                    <Typography variant="caption" display="block" color="text.secondary">
+                                                        {admin.break_glass ? 'Break-glass password account' : 'Signs in with single sign-on'}
+                                                    </Typography>
+                                                )}
                                             </Box>
                                         </Box>
                                     </TableCell>
@@ -202,7 +245,7 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
                                         <TableCell>
                                             <Chip
                                                 icon={<SecurityIcon sx={{ fontSize: '14px !important' }} />}
-                                                label={admin.role === 'super_admin' ? 'Super Admin' : admin.role === 'admin' ? 'Administrator' : 'Policy Admin'}
+                                                label={(admin.role === 'custom' ? admin.custom_role?.name || roleLabels.custom : roleLabels[admin.role]) + ((admin.node_ids?.length || admin.application_ids?.length) ? ' (scoped)' : '')}
                                                 size="small"
                                                 sx={{
                                                     height: 24,
@@ -216,24 +259,31 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
                                         </TableCell>
                                     )}
                                     <TableCell align="right">
-                                        <Tooltip title="Edit Name">
-                                            <IconButton size="small" onClick={() => handleOpenEdit(admin)} sx={{ color: '#5f6368' }}>
-                                                <EditIcon fontSize="small" />
-                                            </IconButton>
-                                        </Tooltip>
-                                        <Tooltip title="Delete Administrator">
-                                            <span>
-                                                <IconButton
-                                                    size="small"
-                                                    onClick={() => handleOpenDelete(admin)}
-                                                    color="error"
-                                                    disabled={admin.email.startsWith('admin@')}
-                                                    sx={{ ml: 1, opacity: admin.email.startsWith('admin@') ? 0.3 : 1 }}
-                                                >
-                                                    <DeleteIcon fontSize="small" />
+                                        {canManage && (<>
+                                            <Tooltip title="Edit Administrator">
+                                                <IconButton size="small" onClick={() => handleOpenEdit(admin)} sx={{ color: '#5f6368' }}>
+                                                    <EditIcon fontSize="small" />
+                                                </IconButton>
+                                            </Tooltip>
+                                            <Tooltip title="Reset Two-step Verification">
+                                                <IconButton size="small" onClick={() => onResetMFA(admin.id)} sx={{ ml: 1, color: '#5f6368' }}>
+                                                    <LockResetIcon fontSize="small" />
                                                 </IconButton>
-                                            </span>
-                                        </Tooltip>
+                                            </Tooltip>
+                                            <Tooltip title="Delete Administrator">
+                                                <span>
+                                                    <IconButton
+                                                        size="small"
+                                                        onClick={() => handleOpenDelete(admin)}
+                                                        color="error"
+                                                        disabled={admin.email.startsWith('admin@')}
+                                                        sx={{ ml: 1, opacity: admin.email.startsWith('admin@') ? 0.3 : 1 }}
+                                                    >
+                                                        <DeleteIcon fontSize="small" />
+                                                    </IconButton>
+                                                </span>
+                                            </Tooltip>
+                                        </>)}
                                     </TableCell>
                                 </TableRow>
                             ))}
@@ -242,6 +292,8 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
                 </Paper>
             )}
 
+            <RolesCard roles={roles} permissions={permissions} onChange={fetchRoles} canManage={canManage} />
+
             {/* Create Admin Dialog */}
             <Dialog
                 open={showDialog}
@@ -301,19 +353,7 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
                         </Grid>
                     </Grid>
 
-                    <FormControl fullWidth sx={{ mb: 3 }}>
-                        <InputLabel>Role</InputLabel>
-                        <Select
-                            value={role}
-                            label="Role"
-                            onChange={(e) => setRole(e.target.value as any)}
-                            sx={{ borderRadius: 2 }}
-                        >
-                            <MenuItem value="super_admin">Super Administrator</MenuItem>
-                            <MenuItem value="admin">Administrator (Gateway, App, Policy)</MenuItem>
-                            <MenuItem value="policy_admin">Policy Administrator (Policy Only)</MenuItem>
-                        </Select>
-                    </FormControl>
+                    <AccessFields value={access} onChange={setAccess} roles={roles} nodes={nodes} applications={applications} />
 
                     <Box sx={{ mt: 2, p: 2, bgcolor: '#f8f9fa', borderRadius: 2, display: 'flex', alignItems: 'center', gap: 1.5 }}>
                         <PersonIcon sx={{ color: '#5f6368' }} />
@@ -404,16 +444,16 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
                 </DialogActions>
             </Dialog>
 
-            {/* Edit Name Dialog */}
+            {/* Edit Administrator Dialog */}
             <Dialog
                 open={editDialog.open}
                 fullScreen={isMobile}
                 onClose={() => setEditDialog({ ...editDialog, open: false })}
                 fullWidth
-                maxWidth="xs"
+                maxWidth="sm"
                 PaperProps={{ sx: { borderRadius: isMobile ? 0 : 3 } }}
             >
-                <DialogTitle sx={{ fontWeight: 800 }}>Edit Name</DialogTitle>
+                <DialogTitle sx={{ fontWeight: 800 }}>Edit Administrator</DialogTitle>
                 <DialogContent>
                     <TextField
                         autoFocus
@@ -425,19 +465,17 @@ const AdminsView: React.FC<AdminsViewProps> = ({ admins, domains, onCreate, onDe
                         onChange={(e) => setEditDialog({ ...editDialog, name: e.target.value })}
                         sx={{ mt: 1, mb: 3, '& .MuiOutlinedInput-root': { borderRadius: 2 } }}
                     />
-                    <FormControl fullWidth>
-                        <InputLabel>Role</InputLabel>
-                        <Select
-                            value={editDialog.role}
-                            label="Role"
-                            onChange={(e) => setEditDialog({ ...editDialog, role: e.target.value as any })}
-                            sx={{ borderRadius: 2 }}
-                        >
-                            <MenuItem value="super_admin">Super Administrator</MenuItem>
-                            <MenuItem value="admin">Administrator (Proxy, App, Policy)</MenuItem>
-                            <MenuItem value="policy_admin">Policy Administrator (Policy Only)</MenuItem>
-                        </Select>
-                    </FormControl>
+                    <AccessFields value={editDialog.access} onChange={(a) => setEditDialog({ ...editDialog, access: a })} roles={roles} nodes={nodes} applications={applications} />
+                    <FormControlLabel
+                        control={<Switch checked={editDialog.breakGlass} onChange={(e) => setEditDialog({ ...editDialog, breakGlass: e.target.checked })} />}
+                        label={
+                            <Box>
+                                <Typography variant="body2" sx={{ fontWeight: 600 }}>Break-glass account</Typography>
+                                <Typography variant="caption" color="text.secondary">Can still sign in with a password when single sign-on is on</Typography>
+                            </Box>
+                        }
+                        sx={{ mt: 2 }}
+                    />
                 </DialogContent>
                 <DialogActions sx={{ p: 2 }}>
                     <Button onClick={() => setEditDialog({ ...editDialog, open: false })} sx={{ fontWeight: 600, color: '#5f6368' }}>Cancel</Button>
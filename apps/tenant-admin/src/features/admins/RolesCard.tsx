@@ -0,0 +1,156 @@
+import React, { useState } from 'react';
+import {
+    Box, Typography, Button, Paper, IconButton, Dialog, DialogTitle, DialogContent,
+    DialogActions, TextField, Chip, Alert, Checkbox, FormControlLabel, Tooltip, Grid
+} from '@mui/material';
+import {
+    Add as AddIcon,
+    Delete as DeleteIcon,
+    Edit as EditIcon
+} from '@mui/icons-material';
+import { Permission, Role } from '../../types';
+
+interface RolesCardProps {
+    roles: Role[];
+    permissions: Permission[];
+    onChange: () => void;
+    canManage: boolean;
+}
+
+const emptyRole: Role = { id: '', name: '', description: '', permissions: [] };
+
+// RolesCard lists the tenant's custom administrator roles and edits their
+// permissions.
+const RolesCard: React.FC<RolesCardProps> = ({ roles, permissions, onChange, canManage }) => {
+    const [editing, setEditing] = useState<Role | null>(null);
+    const [error, setError] = useState<string | null>(null);
+
+    // Group "resource:action" permissions by resource for the editor
+    const resources = Array.from(new Set(permissions.map(p => p.split(':')[0])));
+
+    const togglePermission = (p: Permission) => {
+        if (!editing) return;
+        const has = editing.permissions.includes(p);
+        setEditing({ ...editing, permissions: has ? editing.permissions.filter(x => x !== p) : [...editing.permissions, p] });
+    };
+
+    const handleSave = async () => {
+        if (!editing) return;
+        setError(null);
+        const res = await fetch('/api/v1/roles', {
+            method: editing.id ? 'PATCH' : 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(editing)
+        });
+        const data = await res.json();
+        if (!data.success) {
+            setError(data.error || 'Failed to save role');
+            return;
+        }
+        setEditing(null);
+        onChange();
+    };
+
+    const handleDelete = async (role: Role) => {
+        if (!confirm(`Delete the role "${role.name}"?`)) return;
+        const res = await fetch('/api/v1/roles', {
+            method: 'DELETE',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ id: role.id })
+        });
+        const data = await res.json();
+        if (!data.success) alert('Error: ' + data.error);
+        onChange();
+    };
+
+    return (
+        <Box sx={{ mt: 6 }}>
+            <Box sx={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', mb: 2 }}>
+                <Box>
+                    <Typography variant="h6" sx={{ fontWeight: 700 }}>Custom Roles</Typography>
+                    <Typography variant="body2" color="text.secondary">Roles made of individual permissions, for duties the built-in roles do not fit.</Typography>
+                </Box>
+                {canManage && (
+                    <Button variant="outlined" startIcon={<AddIcon />} onClick={() => { setError(null); setEditing({ ...emptyRole }); }} sx={{ borderRadius: 2 }}>
+                        New Role
+                    </Button>
+                )}
+            </Box>
+
+            <Paper variant="outlined" sx={{ borderRadius: 3, overflow: 'hidden', border: '1px solid #dadce0' }}>
+                {roles.length === 0 && (
+                    <Typography variant="body2" color="text.secondary" sx={{ p: 3, textAlign: 'center' }}>No custom roles yet.</Typography>
+                )}
+                {roles.map((role, i) => (
+                    <Box key={role.id} sx={{ p: 2, display: 'flex', alignItems: 'flex-start', gap: 2, borderTop: i > 0 ? '1px solid #f1f3f4' : 'none' }}>
+                        <Box sx={{ flexGrow: 1 }}>
+                            <Typography variant="subtitle2" sx={{ fontWeight: 600 }}>{role.name}</Typography>
+                            {role.description && <Typography variant="caption" color="text.secondary" display="block">{role.description}</Typography>}
+                            <Box sx={{ display: 'flex', flexWrap: 'wrap', gap: 0.5, mt: 1 }}>
+                                {role.permissions.map(p => <Chip key={p} size="small" label={p} sx={{ fontFamily: 'monospace', fontSize: '0.75rem' }} />)}
+                            </Box>
+                        </Box>
+                        {canManage && (<>
+                            <Tooltip title="Edit Role">
+                                <IconButton size="small" onClick={() => { setError(null); setEditing({ ...role }); }} sx={{ color: '#5f6368' }}>
+                                    <EditIcon fontSize="small" />
+                                </IconButton>
+                            </Tooltip>
+                            <Tooltip title="Delete Role">
+                                <IconButton size="small" color="error" onClick={() => handleDelete(role)}>
+                                    <DeleteIcon fontSize="small" />
+                                </IconButton>
+                            </Tooltip>
+                        </>)}
+                    </Box>
+                ))}
+            </Paper>
+
+            <Dialog open={!!editing} onClose={() => setEditing(null)} fullWidth maxWidth="sm" PaperProps={{ sx: { borderRadius: 3 } }}>
+                <DialogTitle sx={{ fontWeight: 800 }}>{editing?.id ? 'Edit Role' : 'New Role'}</DialogTitle>
+                <DialogContent>
+                    <TextField
+                        autoFocus
+                        margin="dense"
+                        label="Name"
+                        fullWidth
+                        value={editing?.name || ''}
+                        onChange={(e) => editing && setEditing({ ...editing, name: e.target.value })}
+                        sx={{ mt: 1, mb: 2, '& .MuiOutlinedInput-root': { borderRadius: 2 } }}
+                    />
+                    <TextField
+                        label="Description"
+                        fullWidth
+                        value={editing?.description || ''}
+                        onChange={(e) => editing && setEditing({ ...editing, description: e.target.value })}
+                        sx={{ mb: 3, '& .MuiOutlinedInput-root': { borderRadius: 2 } }}
+                    />
+                    <Typography variant="subtitle2" sx={{ fontWeight: 700, mb: 1 }}>Permissions</Typography>
+                    <Grid container spacing={1}>
+                        {resources.map(resource => (
+                            <Grid key={resource} size={{ xs: 12, sm: 6 }}>
+                                <Typography variant="caption" sx={{ fontWeight: 700, textTransform: 'uppercase', color: '#5f6368' }}>{resource}</Typography>
+                                <Box>
+                                    {permissions.filter(p => p.startsWith(resource + ':')).map(p => (
+                                        <FormControlLabel
+                                            key={p}
+                                            control={<Checkbox size="small" checked={!!editing?.permissions.includes(p)} onChange={() => togglePermission(p)} />}
+                                            label={<Typography variant="body2">{p.split(':')[1]}</Typography>}
+                                        />
+                                    ))}
+                                </Box>
+                            </Grid>
+                        ))}
+                    </Grid>
+                    {error && <Alert severity="error" sx={{ mt: 2, borderRadius: 2 }}>{error}</Alert>}
+                </DialogContent>
+                <DialogActions sx={{ p: 2 }}>
+                    <Button onClick={() => setEditing(null)} sx={{ fontWeight: 600, color: '#5f6368' }}>Cancel</Button>
+                    <Button onClick={handleSave} variant="contained" disabled={!editing?.name.trim() || !editing?.permissions.length} sx={{ borderRadius: 2, fontWeight: 700 }}>Save</Button>
+                </DialogActions>
+            </Dialog>
+        </Box>
+    );
+};
+
+export default RolesCard;
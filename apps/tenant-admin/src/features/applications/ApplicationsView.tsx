@@ -16,6 +16,7 @@ import {
     Paper,
     CircularProgress,
     Stack,
+    MenuItem,
     useMediaQuery,
     useTheme
 } from '@mui/material';
@@ -25,7 +26,28 @@ import {
     Edit as EditIcon,
     Apps as AppsIcon,
 } from '@mui/icons-material';
-import { Application, ApplicationCIDR } from '../../types';
+import { Application, ApplicationDestination } from '../../types';
+
+const emptyForm = {
+    name: '',
+    description: '',
+    owner: '',
+    tags: '',
+    ports: '',
+    health_check: '',
+    destinations: [{ type: 'cidr', value: '' }] as ApplicationDestination[]
+};
+
+const splitList = (value: string) => value.split(',').map(v => v.trim()).filter(Boolean);
+
+const healthLabel = (app: Application) => {
+    if (!app.health_check) return null;
+    if (!app.health || app.health.length === 0) return { label: 'Unknown', color: 'default' as const };
+    const up = app.health.filter(h => h.healthy).length;
+    if (up === app.health.length) return { label: 'Healthy', color: 'success' as const };
+    if (up > 0) return { label: `Degraded (${up}/${app.health.length})`, color: 'warning' as const };
+    return { label: 'Unreachable', color: 'error' as const };
+};
 
 const ApplicationsView: React.FC = () => {
     const theme = useTheme();
@@ -35,11 +57,8 @@ const ApplicationsView: React.FC = () => {
     const [loading, setLoading] = useState(false);
     const [dialogOpen, setDialogOpen] = useState(false);
     const [editingApp, setEditingApp] = useState<Application | null>(null);
-    const [formData, setFormData] = useState({
-        name: '',
-        description: '',
-        cidrs: ['']
-    });
+    const [formData, setFormData] = useState(emptyForm);
+    const [error, setError] = useState('');
 
     useEffect(() => {
         fetchApplications();
@@ -58,46 +77,42 @@ const ApplicationsView: React.FC = () => {
     };
 
     const handleOpenDialog = (app?: Application) => {
+        setError('');
         if (app) {
             setEditingApp(app);
-            // Fetch CIDRs for this app
-            fetchAppCIDRs(app.id);
-        } else {
-            setEditingApp(null);
             setFormData({
-                name: '',
-                description: '',
-                cidrs: ['']
+                name: app.name,
+                description: app.description || '',
+                owner: app.owner || '',
+                tags: app.tags || '',
+                ports: app.ports || '',
+                health_check: app.health_check || '',
+                destinations: app.destinations?.length
+                    ? app.destinations.map(d => ({ type: d.type, value: d.value }))
+                    : emptyForm.destinations
             });
+        } else {
+            setEditingApp(null);
+            setFormData(emptyForm);
         }
         setDialogOpen(true);
     };
 
-    const fetchAppCIDRs = async (appId: string) => {
-        try {
-            const res = await fetch(`/api/v1/applications?id=${appId}`);
-            const data = await res.json();
-            if (data.success) {
-                const cidrs = data.data.cidrs?.map((c: ApplicationCIDR) => c.cidr) || [''];
-                setFormData({
-                    name: data.data.application.name,
-                    description: data.data.application.description || '',
-                    cidrs: cidrs.length > 0 ? cidrs : ['']
-                });
-            }
-        } catch (err) {
-            console.error('Failed to fetch app CIDRs', err);
-        }
-    };
-
     const handleSave = async () => {
         setLoading(true);
+        setError('');
         try {
             const url = '/api/v1/applications';
             const method = editingApp ? 'PATCH' : 'POST';
+            const payload = {
+                ...formData,
+                tags: splitList(formData.tags),
+                ports: splitList(formData.ports),
+                destinations: formData.destinations.filter(d => d.value.trim() !== '')
+            };
             const body = editingApp
-                ? { id: editingApp.id, ...formData }
-                : formData;
+                ? { id: editingApp.id, ...payload }
+                : payload;
 
             const res = await fetch(url, {
                 method,
@@ -108,6 +123,9 @@ const ApplicationsView: React.FC = () => {
             if (res.ok) {
                 setDialogOpen(false);
                 fetchApplications();
+            } else {
+                const data = await res.json();
+                setError(data.error || 'Failed to save application');
             }
         } catch (err) {
             console.error('Save failed', err);
@@ -130,19 +148,19 @@ const ApplicationsView: React.FC = () => {
         }
     };
 
-    const handleAddCIDR = () => {
-        setFormData({ ...formData, cidrs: [...formData.cidrs, ''] });
+    const handleAddDestination = () => {
+        setFormData({ ...formData, destinations: [...formData.destinations, { type: 'cidr', value: '' }] });
     };
 
-    const handleRemoveCIDR = (index: number) => {
-        const newCIDRs = formData.cidrs.filter((_, i) => i !== index);
-        setFormData({ ...formData, cidrs: newCIDRs.length > 0 ? newCIDRs : [''] });
+    const handleRemoveDestination = (index: number) => {
+        const destinations = formData.destinations.filter((_, i) => i !== index);
+        setFormData({ ...formData, destinations: destinations.length > 0 ? destinations : emptyForm.destinations });
     };
 
-    const handleCIDRChange = (index: number, value: string) => {
-        const newCIDRs = [...formData.cidrs];
-        newCIDRs[index] = value;
-        setFormData({ ...formData, cidrs: newCIDRs });
+    const handleDestinationChange = (index: number, field: keyof ApplicationDestination, value: string) => {
+        const destinations = [...formData.destinations];
+        destinations[index] = { ...destinations[index], [field]: value };
+        setFormData({ ...formData, destinations });
     };
 
     return (
@@ -154,7 +172,7 @@ const ApplicationsView: React.FC = () => {
                         Applications
                     </Typography>
                     <Typography variant="body1" color="text.secondary" sx={{ mt: 1 }}>
-                        Pre-define applications with multiple CIDRs for use in access policies.
+                        Define applications by their networks, host names and ports, then reference them in access policies by name or tag.
                     </Typography>
                 </Box>
                 <Button
@@ -208,14 +226,30 @@ const ApplicationsView: React.FC = () => {
                                                 <Typography variant="h6" sx={{ fontWeight: 700 }}>{app.name}</Typography>
                                                 <Typography variant="caption" color="text.secondary">
                                                     {app.description || 'No description'}
+                                                    {app.owner && ` • Owner: ${app.owner}`}
                                                 </Typography>
+                                                <Box sx={{ display: 'flex', flexWrap: 'wrap', gap: 0.5, mt: 1 }}>
+                                                    {(app.tags ? app.tags.split(',') : []).map(tag => (
+                                                        <Chip key={tag} label={tag} size="small" color="primary" variant="outlined" />
+                                                    ))}
+                                                </Box>
                                             </Box>
                                         </Box>
                                     </Grid>
                                     <Grid size={{ xs: 6, md: 2 }} sx={{ display: { xs: 'none', md: 'block' } }}>
+                                        {app.destinations?.map(d => (
+                                            <Typography key={d.id || d.value} variant="caption" display="block" sx={{ fontFamily: 'monospace' }}>
+                                                {d.value}
+                                            </Typography>
+                                        ))}
                                         <Typography variant="caption" color="text.secondary">
-                                            CIDRs will be shown when editing
+                                            {app.ports ? `Ports: ${app.ports}` : 'All ports'}
                                         </Typography>
+                                        {healthLabel(app) && (
+                                            <Box sx={{ mt: 0.5 }}>
+                                                <Chip label={healthLabel(app)!.label} color={healthLabel(app)!.color} size="small" />
+                                            </Box>
+                                        )}
                                     </Grid>
                                     <Grid size={{ xs: 12, md: 2 }} sx={{ textAlign: 'right', mt: { xs: 2, md: 0 } }}>
                                         <IconButton size="small" onClick={() => handleOpenDialog(app)} sx={{ mr: 1, color: 'primary.main', bgcolor: 'rgba(26, 115, 232, 0.05)' }}>
@@ -237,7 +271,7 @@ const ApplicationsView: React.FC = () => {
                             <AppsIcon sx={{ fontSize: 64, color: 'text.disabled', mb: 2 }} />
                             <Typography variant="h6" color="text.secondary">No applications defined</Typography>
                             <Typography variant="body2" color="text.disabled" sx={{ mt: 1 }}>
-                                Start by creating your first application with multiple CIDRs.
+                                Start by creating your first application.
                             </Typography>
                         </Paper>
                     </Grid>
@@ -289,26 +323,83 @@ const ApplicationsView: React.FC = () => {
                             />
                         </Grid>
 
+                        <Grid size={{ xs: 12, md: 6 }}>
+                            <TextField
+                                fullWidth
+                                label="Owner"
+                                value={formData.owner}
+                                onChange={(e) => setFormData({ ...formData, owner: e.target.value })}
+                                placeholder="e.g. platform-team@acme.com"
+                                sx={{ '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
+                            />
+                        </Grid>
+
+                        <Grid size={{ xs: 12, md: 6 }}>
+                            <TextField
+                                fullWidth
+                                label="Tags"
+                                value={formData.tags}
+                                onChange={(e) => setFormData({ ...formData, tags: e.target.value })}
+                                placeholder="e.g. engineering, internal"
+                                helperText="Comma separated. Policies can target every application with a tag."
+                                sx={{ '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
+                            />
+                        </Grid>
+
+                        <Grid size={{ xs: 12, md: 6 }}>
+                            <TextField
+                                fullWidth
+                                label="Ports"
+                                value={formData.ports}
+                                onChange={(e) => setFormData({ ...formData, ports: e.target.value })}
+                                placeholder="e.g. tcp/443, udp/53, tcp/8000-8100"
+                                helperText="Leave empty to allow all ports."
+                                sx={{ '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
+                            />
+                        </Grid>
+
+                        <Grid size={{ xs: 12, md: 6 }}>
+                            <TextField
+                                fullWidth
+                                label="Health Check"
+                                value={formData.health_check}
+                                onChange={(e) => setFormData({ ...formData, health_check: e.target.value })}
+                                placeholder="e.g. 10.0.0.5:443"
+                                helperText="Optional host:port that gateways probe over TCP."
+                                sx={{ '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
+                            />
+                        </Grid>
+
                         <Grid size={12}>
                             <Typography variant="subtitle2" sx={{ fontWeight: 700, mb: 2, color: 'text.secondary' }}>
-                                Network CIDRs
+                                Destinations
                             </Typography>
                             <Stack spacing={2}>
-                                {formData.cidrs.map((cidr, index) => (
+                                {formData.destinations.map((dest, index) => (
                                     <Box key={index} sx={{ display: 'flex', gap: 1, alignItems: 'center' }}>
+                                        <TextField
+                                            select
+                                            label="Type"
+                                            value={dest.type}
+                                            onChange={(e) => handleDestinationChange(index, 'type', e.target.value)}
+                                            sx={{ minWidth: 140, '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
+                                        >
+                                            <MenuItem value="cidr">CIDR</MenuItem>
+                                            <MenuItem value="fqdn">Host name</MenuItem>
+                                        </TextField>
                                         <TextField
                                             fullWidth
-                                            label={`CIDR ${index + 1}`}
-                                            value={cidr}
-                                            onChange={(e) => handleCIDRChange(index, e.target.value)}
-                                            placeholder="e.g. 10.0.0.0/24"
+                                            label={`Destination ${index + 1}`}
+                                            value={dest.value}
+                                            onChange={(e) => handleDestinationChange(index, 'value', e.target.value)}
+                                            placeholder={dest.type === 'cidr' ? 'e.g. 10.0.0.0/24' : 'e.g. jira.corp.internal or *.corp.internal'}
                                             sx={{ '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
                                         />
-                                        {formData.cidrs.length > 1 && (
+                                        {formData.destinations.length > 1 && (
                                             <IconButton
                                                 size="small"
                                                 color="error"
-                                                onClick={() => handleRemoveCIDR(index)}
+                                                onClick={() => handleRemoveDestination(index)}
                                             >
                                                 <DeleteIcon fontSize="small" />
                                             </IconButton>
@@ -319,12 +410,18 @@ const ApplicationsView: React.FC = () => {
                             <Button
                                 size="small"
                                 startIcon={<AddIcon />}
-                                onClick={handleAddCIDR}
+                                onClick={handleAddDestination}
                                 sx={{ mt: 2, textTransform: 'none', fontWeight: 600 }}
                             >
-                                Add CIDR
+                                Add Destination
                             </Button>
                         </Grid>
+
+                        {error && (
+                            <Grid size={12}>
+                                <Typography variant="body2" color="error">{error}</Typography>
+                            </Grid>
+                        )}
                     </Grid>
                 </DialogContent>
                 <DialogActions sx={{ px: 4, pb: 4, pt: 2 }}>
@@ -0,0 +1,239 @@
+import React, { useState, useEffect, useCallback } from 'react';
+import {
+    Box,
+    Typography,
+    Button,
+    Paper,
+    TextField,
+    Grid,
+    Chip,
+    Alert,
+    Table,
+    TableHead,
+    TableBody,
+    TableRow,
+    TableCell,
+    TableContainer,
+    TablePagination,
+    Dialog,
+    DialogTitle,
+    DialogContent,
+    DialogActions,
+    Stack,
+    useMediaQuery,
+    useTheme
+} from '@mui/material';
+import {
+    History as HistoryIcon,
+    Download as DownloadIcon,
+    VerifiedUser as VerifiedUserIcon
+} from '@mui/icons-material';
+import { AuditLogEntry, AuditLogPage, AuditVerification } from '../../types';
+
+const emptyFilters = { actor: '', action: '', resource_type: '', since: '', until: '' };
+
+const actionColor = (action: string) => {
+    if (action.endsWith('.delete') || action.endsWith('.revoke') || action.endsWith('.reset')) return 'error' as const;
+    if (action.endsWith('.create')) return 'success' as const;
+    return 'default' as const;
+};
+
+const JsonBlock: React.FC<{ title: string; value: unknown }> = ({ title, value }) => (
+    <Box sx={{ flex: 1, minWidth: 0 }}>
+        <Typography variant="subtitle2" sx={{ fontWeight: 700, mb: 1 }}>{title}</Typography>
+        <Box component="pre" sx={{ m: 0, p: 2, bgcolor: '#f8f9fa', borderRadius: 2, fontSize: 12, overflow: 'auto', maxHeight: 400 }}>
+            {value === undefined ? '—' : JSON.stringify(value, null, 2)}
+        </Box>
+    </Box>
+);
+
+const AuditLogView: React.FC = () => {
+    const theme = useTheme();
+    const isMobile = useMediaQuery(theme.breakpoints.down('md'));
+
+    const [filters, setFilters] = useState(emptyFilters);
+    const [applied, setApplied] = useState(emptyFilters);
+    const [page, setPage] = useState(0);
+    const [pageSize, setPageSize] = useState(50);
+    const [result, setResult] = useState<AuditLogPage | null>(null);
+    const [error, setError] = useState('');
+    const [selected, setSelected] = useState<AuditLogEntry | null>(null);
+    const [verification, setVerification] = useState<AuditVerification | null>(null);
+    const [verifying, setVerifying] = useState(false);
+
+    const query = useCallback((extra: Record<string, string>) => {
+        const params = new URLSearchParams();
+        Object.entries({ ...applied, ...extra }).forEach(([k, v]) => { if (v) params.set(k, v); });
+        return params.toString();
+    }, [applied]);
+
+    useEffect(() => {
+        const fetchEntries = async () => {
+            try {
+                const res = await fetch(`/api/v1/audit-logs?${query({ page: String(page + 1), page_size: String(pageSize) })}`);
+                const data = await res.json();
+                if (data.success) {
+                    setResult(data.data);
+                    setError('');
+                } else {
+                    setError(data.error || 'Failed to load the audit log');
+                }
+            } catch (err) {
+                console.error('Failed to fetch audit log', err);
+            }
+        };
+        fetchEntries();
+    }, [query, page, pageSize]);
+
+    const handleApply = () => {
+        setPage(0);
+        setApplied(filters);
+    };
+
+    const handleVerify = async () => {
+        setVerifying(true);
+        try {
+            const res = await fetch('/api/v1/audit-logs/verify');
+            const data = await res.json();
+            if (data.success) setVerification(data.data);
+            else setError(data.error || 'Verification failed');
+        } finally {
+            setVerifying(false);
+        }
+    };
+
+    return (
+        <Box sx={{ p: 0 }}>
+            <Box sx={{ display: 'flex', flexDirection: isMobile ? 'column' : 'row', justifyContent: 'space-between', alignItems: isMobile ? 'flex-start' : 'center', mb: 4, gap: 2 }}>
+                <Box>
+                    <Typography variant="h4" sx={{ fontWeight: 800, color: 'text.primary', display: 'flex', alignItems: 'center', gap: 2 }}>
+                        <HistoryIcon sx={{ fontSize: 40, color: 'primary.main' }} />
+                        Audit Log
+                    </Typography>
+                    <Typography variant="body1" color="text.secondary" sx={{ mt: 1 }}>
+                        Every administrative change in this organization, who made it and from where.
+                    </Typography>
+                </Box>
+                <Stack direction="row" spacing={1}>
+                    <Button variant="outlined" startIcon={<VerifiedUserIcon />} onClick={handleVerify} disabled={verifying} sx={{ textTransform: 'none', fontWeight: 700, borderRadius: 2.5 }}>
+                        Verify
+                    </Button>
+                    <Button variant="outlined" startIcon={<DownloadIcon />} href={`/api/v1/audit-logs?${query({ format: 'csv' })}`} sx={{ textTransform: 'none', fontWeight: 700, borderRadius: 2.5 }}>
+                        CSV
+                    </Button>
+                    <Button variant="outlined" startIcon={<DownloadIcon />} href={`/api/v1/audit-logs?${query({ format: 'json' })}`} sx={{ textTransform: 'none', fontWeight: 700, borderRadius: 2.5 }}>
+                        JSON
+                    </Button>
+                </Stack>
+            </Box>
+
+            {verification && (
+                <Alert severity={verification.valid ? 'success' : 'error'} sx={{ mb: 3, borderRadius: 2 }} onClose={() => setVerification(null)}>
+                    {verification.valid
+                        ? `All ${verification.entries} entries verify. Latest hash: ${verification.head_hash || '—'}`
+                        : `The chain breaks at entry #${verification.broken_at}: ${verification.reason}.`}
+                </Alert>
+            )}
+            {error && <Alert severity="error" sx={{ mb: 3, borderRadius: 2 }}>{error}</Alert>}
+
+            <Paper variant="outlined" sx={{ p: 2, mb: 3, borderRadius: 3 }}>
+                <Grid container spacing={2} alignItems="center">
+                    <Grid size={{ xs: 12, md: 3 }}>
+                        <TextField fullWidth size="small" label="Actor" placeholder="Email or ID" value={filters.actor} onChange={e => setFilters({ ...filters, actor: e.target.value })} />
+                    </Grid>
+                    <Grid size={{ xs: 12, md: 2 }}>
+                        <TextField fullWidth size="small" label="Action" placeholder="e.g. access_policy." value={filters.action} onChange={e => setFilters({ ...filters, action: e.target.value })} />
+                    </Grid>
+                    <Grid size={{ xs: 12, md: 2 }}>
+                        <TextField fullWidth size="small" label="Resource type" value={filters.resource_type} onChange={e => setFilters({ ...filters, resource_type: e.target.value })} />
+                    </Grid>
+                    <Grid size={{ xs: 6, md: 2 }}>
+                        <TextField fullWidth size="small" type="date" label="From" slotProps={{ inputLabel: { shrink: true } }} value={filters.since} onChange={e => setFilters({ ...filters, since: e.target.value })} />
+                    </Grid>
+                    <Grid size={{ xs: 6, md: 2 }}>
+                        <TextField fullWidth size="small" type="date" label="To" slotProps={{ inputLabel: { shrink: true } }} value={filters.until} onChange={e => setFilters({ ...filters, until: e.target.value })} />
+                    </Grid>
+                    <Grid size={{ xs: 12, md: 1 }}>
+                        <Button fullWidth variant="contained" onClick={handleApply} sx={{ textTransform: 'none', fontWeight: 700 }}>Filter</Button>
+                    </Grid>
+                </Grid>
+            </Paper>
+
+            <Paper variant="outlined" sx={{ borderRadius: 3, overflow: 'hidden' }}>
+                <TableContainer>
+                    <Table size="small">
+                        <TableHead>
+                            <TableRow>
+                                <TableCell>#</TableCell>
+                                <TableCell>Time</TableCell>
+                                <TableCell>Actor</TableCell>
+                                <TableCell>Action</TableCell>
+                                <TableCell>Resource</TableCell>
+                                {!isMobile && <TableCell>Source IP</TableCell>}
+                            </TableRow>
+                        </TableHead>
+                        <TableBody>
+                            {(result?.entries || []).map(entry => (
+                                <TableRow key={entry.id} hover sx={{ cursor: 'pointer' }} onClick={() => setSelected(entry)}>
+                                    <TableCell>{entry.sequence}</TableCell>
+                                    <TableCell sx={{ whiteSpace: 'nowrap' }}>{new Date(entry.created_at).toLocaleString()}</TableCell>
+                                    <TableCell>
+                                        {entry.actor_email || entry.actor_type}
+                                        {entry.actor_type !== 'admin' && <Chip size="small" label={entry.actor_type} sx={{ ml: 1 }} />}
+                                    </TableCell>
+                                    <TableCell><Chip size="small" label={entry.action} color={actionColor(entry.action)} variant="outlined" /></TableCell>
+                                    <TableCell>
+                                        <Typography variant="body2">{entry.resource_type}</Typography>
+                                        {entry.resource_id && <Typography variant="caption" color="text.secondary">{entry.resource_id}</Typography>}
+                                    </TableCell>
+                                    {!isMobile && <TableCell>{entry.ip}</TableCell>}
+                                </TableRow>
+                            ))}
+                            {result && result.entries.length === 0 && (
+                                <TableRow>
+                                    <TableCell colSpan={6} align="center" sx={{ py: 4, color: 'text.secondary' }}>No matching entries</TableCell>
+                                </TableRow>
+                            )}
+                        </TableBody>
+                    </Table>
+                </TableContainer>
+                <TablePagination
+                    component="div"
+                    count={result?.total || 0}
+                    page={page}
+                    rowsPerPage={pageSize}
+                    rowsPerPageOptions={[25, 50, 100, 200]}
+                    onPageChange={(_, p) => setPage(p)}
+                    onRowsPerPageChange={e => { setPageSize(parseInt(e.target.value, 10)); setPage(0); }}
+                />
+            </Paper>
+
+            <Dialog open={!!selected} onClose={() => setSelected(null)} maxWidth="lg" fullWidth fullScreen={isMobile}>
+                {selected && (
+                    <>
+                        <DialogTitle sx={{ fontWeight: 700 }}>#{selected.sequence} · {selected.action}</DialogTitle>
+                        <DialogContent dividers>
+                            <Typography variant="body2" sx={{ mb: 0.5 }}>
+                                {new Date(selected.created_at).toLocaleString()} by {selected.actor_email || selected.actor_type}
+                                {selected.ip && ` from ${selected.ip}`}
+                            </Typography>
+                            {selected.user_agent && <Typography variant="caption" color="text.secondary" component="div" sx={{ mb: 2 }}>{selected.user_agent}</Typography>}
+                            <Stack direction={isMobile ? 'column' : 'row'} spacing={2} sx={{ mb: 2 }}>
+                                <JsonBlock title="Before" value={selected.before} />
+                                <JsonBlock title="After" value={selected.after} />
+                            </Stack>
+                            <Typography variant="caption" color="text.secondary" component="div" sx={{ fontFamily: 'monospace', wordBreak: 'break-all' }}>
+                                hash {selected.hash}<br />previous {selected.prev_hash || '—'}
+                            </Typography>
+                        </DialogContent>
+                        <DialogActions>
+                            <Button onClick={() => setSelected(null)} sx={{ textTransform: 'none' }}>Close</Button>
+                        </DialogActions>
+                    </>
+                )}
+            </Dialog>
+        </Box>
+    );
+};
+
+export default AuditLogView;
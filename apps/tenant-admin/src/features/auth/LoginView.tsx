@@ -1,19 +1,46 @@
 import React, { useState } from 'react';
-import { Box, Card, CardContent, Typography, TextField, Button, ThemeProvider } from '@mui/material';
+import { Box, Card, CardContent, Typography, TextField, Button, Alert, ThemeProvider } from '@mui/material';
 import { CloudQueue as CloudIcon } from '@mui/icons-material';
 import { theme } from '../../theme/theme';
+import MfaVerify, { MfaChallenge } from './MfaVerify';
+import MfaEnroll from './MfaEnroll';
 
 interface LoginViewProps {
-    onLogin: (email: string, password: string) => Promise<void>;
+    onLogin: (email: string, password: string) => Promise<any>;
 }
 
 const LoginView: React.FC<LoginViewProps> = ({ onLogin }) => {
     const [email, setEmail] = useState('');
     const [password, setPassword] = useState('');
+    const [error, setError] = useState('');
+    const [step, setStep] = useState<'password' | 'verify' | 'enroll'>('password');
+    const [challenge, setChallenge] = useState<MfaChallenge | null>(null);
+    const [enrollToken, setEnrollToken] = useState('');
 
-    const handleSubmit = (e: React.FormEvent) => {
+    const handleSubmit = async (e: React.FormEvent) => {
         e.preventDefault();
-        onLogin(email, password);
+        setError('');
+        const data = await onLogin(email, password);
+        if (!data?.success) {
+            setError(data?.error || 'Login failed');
+            return;
+        }
+        if (data.data?.mfa_required) {
+            setChallenge(data.data);
+            setStep('verify');
+        } else if (data.data?.mfa_enrollment_required) {
+            setEnrollToken(data.data.mfa_token);
+            setStep('enroll');
+        } else {
+            window.location.reload();
+        }
+    };
+
+    const restart = () => {
+        setPassword('');
+        setChallenge(null);
+        setEnrollToken('');
+        setStep('password');
     };
 
     return (
@@ -26,11 +53,37 @@ const LoginView: React.FC<LoginViewProps> = ({ onLogin }) => {
                             <Typography variant="h5" sx={{ fontWeight: 700 }}>Tridorian Console</Typography>
                             <Typography variant="body2" color="text.secondary">Sign in to manage your organization</Typography>
                         </Box>
-                        <form onSubmit={handleSubmit}>
-                            <TextField fullWidth label="Email" margin="normal" value={email} onChange={e => setEmail(e.target.value)} required />
-                            <TextField fullWidth label="Password" type="password" margin="normal" value={password} onChange={e => setPassword(e.target.value)} required />
-                            <Button fullWidth variant="contained" type="submit" sx={{ mt: 3, py: 1.5 }}>Sign In</Button>
-                        </form>
+
+                        {step === 'password' && (
+                            <form onSubmit={handleSubmit}>
+                                {error && <Alert severity="error" sx={{ mb: 1 }}>{error}</Alert>}
+                                <TextField fullWidth label="Email" margin="normal" value={email} onChange={e => setEmail(e.target.value)} required />
+                                <TextField fullWidth label="Password" type="password" margin="normal" value={password} onChange={e => setPassword(e.target.value)} required />
+                                <Button fullWidth variant="contained" type="submit" sx={{ mt: 3, py: 1.5 }}>Sign In</Button>
+                                <Button
+                                    fullWidth
+                                    variant="text"
+                                    sx={{ mt: 1 }}
+                                    disabled={!email.includes('@')}
+                                    onClick={() => { window.location.href = '/auth/mgmt/sso?email=' + encodeURIComponent(email); }}
+                                >
+                                    Sign in with single sign-on
+                                </Button>
+                            </form>
+                        )}
+
+                        {step === 'verify' && challenge && (
+                            <MfaVerify base="/auth/mgmt" challenge={challenge} onVerified={() => window.location.reload()} onCancel={restart} />
+                        )}
+
+                        {step === 'enroll' && (
+                            <>
+                                <Alert severity="info" sx={{ mb: 2 }}>
+                                    Your organization requires two-step verification. Set up a second factor to continue.
+                                </Alert>
+                                <MfaEnroll base="/auth/mgmt" token={enrollToken} onDone={() => window.location.reload()} onCancel={restart} />
+                            </>
+                        )}
                     </CardContent>
                 </Card>
             </Box>
@@ -0,0 +1,66 @@
+// Helpers for navigator.credentials: the API sends binary fields base64url
+// encoded, the browser wants ArrayBuffers.
+
+const toBuffer = (value: string): ArrayBuffer => {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    const padded = base64.padEnd(Math.ceil(base64.length / 4) * 4, '=');
+    return Uint8Array.from(atob(padded), c => c.charCodeAt(0)).buffer;
+};
+
+const toBase64url = (buffer: ArrayBuffer): string => {
+    let binary = '';
+    new Uint8Array(buffer).forEach(b => { binary += String.fromCharCode(b); });
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+};
+
+const toDescriptors = (list?: { type: string; id: string }[]) =>
+    (list || []).map(c => ({ type: 'public-key' as const, id: toBuffer(c.id) }));
+
+export const passkeysSupported = () => typeof window !== 'undefined' && !!window.PublicKeyCredential;
+
+// createPasskey registers a new credential with the options from .../mfa/webauthn.
+export const createPasskey = async (options: any) => {
+    const credential = await navigator.credentials.create({
+        publicKey: {
+            ...options,
+            challenge: toBuffer(options.challenge),
+            user: { ...options.user, id: toBuffer(options.user.id) },
+            excludeCredentials: toDescriptors(options.excludeCredentials),
+        },
+    }) as PublicKeyCredential | null;
+    if (!credential) throw new Error('No credential was created');
+
+    const response = credential.response as AuthenticatorAttestationResponse;
+    return {
+        id: credential.id,
+        type: credential.type,
+        response: {
+            clientDataJSON: toBase64url(response.clientDataJSON),
+            attestationObject: toBase64url(response.attestationObject),
+        },
+    };
+};
+
+// getPasskey signs the sign-in challenge from the login response.
+export const getPasskey = async (options: any) => {
+    const credential = await navigator.credentials.get({
+        publicKey: {
+            ...options,
+            challenge: toBuffer(options.challenge),
+            allowCredentials: toDescriptors(options.allowCredentials),
+        },
+    }) as PublicKeyCredential | null;
+    if (!credential) throw new Error('No credential was selected');
+
+    const response = credential.response as AuthenticatorAssertionResponse;
+    return {
+        id: credential.id,
+        type: credential.type,
+        response: {
+            clientDataJSON: toBase64url(response.clientDataJSON),
+            authenticatorData: toBase64url(response.authenticatorData),
+            signature: toBase64url(response.signature),
+            userHandle: response.userHandle ? toBase64url(response.userHandle) : undefined,
+        },
+    };
+};
@@ -2,7 +2,7 @@ import React, { useState, useEffect, useRef } from 'react';
 import {
     Box, Typography, Card, CardContent, Button, Divider, TextField, Grid,
     Alert, Fade, IconButton, Paper, CircularProgress, Dialog, DialogTitle,
-    DialogContent, DialogActions, Chip, useMediaQuery, useTheme
+    DialogContent, DialogActions, Chip, FormControlLabel, Switch, useMediaQuery, useTheme
 } from '@mui/material';
 import {
     Logout as LogoutIcon, Settings as SettingsIcon, Google as GoogleIcon,
@@ -11,7 +11,9 @@ import {
     Refresh as RefreshIcon, Upload as UploadIcon,
     DeleteForever as DeleteIcon
 } from '@mui/icons-material';
-import { Tenant, User } from '../../types';
+import { Tenant, User, LoginAttempt } from '../../types';
+import MfaSettings from '../auth/MfaSettings';
+import { can } from '../../types/permissions';
 
 interface SettingsViewProps {
     tenant: Tenant | null;
@@ -52,6 +54,22 @@ const SettingsView: React.FC<SettingsViewProps> = ({ tenant, onRefresh, user })
     const [loading, setLoading] = useState(false);
     const [success, setSuccess] = useState(false);
 
+    // Sign-in Security State
+    const [passwordMinLength, setPasswordMinLength] = useState(12);
+    const [loginAttempts, setLoginAttempts] = useState<LoginAttempt[]>([]);
+
+    useEffect(() => {
+        setPasswordMinLength(tenant?.password_min_length || 12);
+    }, [tenant?.password_min_length]);
+
+    useEffect(() => {
+        if (!can(user?.grant, 'security:read')) return;
+        fetch('/api/v1/security/login-attempts')
+            .then(res => res.json())
+            .then(data => { if (data.success) setLoginAttempts(data.data || []); })
+            .catch(err => console.error(err));
+    }, [user?.grant]);
+
     useEffect(() => {
         if (tenant) {
             setIdpConfig({
@@ -129,6 +147,22 @@ const SettingsView: React.FC<SettingsViewProps> = ({ tenant, onRefresh, user })
         }
     };
 
+    const handleSecurityUpdate = async (settings: Partial<Pick<Tenant, 'require_admin_mfa' | 'password_min_length' | 'password_require_complexity' | 'gateway_hardware_approval' | 'require_device_posture' | 'device_approval'>>) => {
+        try {
+            const res = await fetch('/api/v1/tenant/security', {
+                method: 'PATCH',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(settings)
+            });
+            const data = await res.json();
+            if (data.success) {
+                onRefresh();
+            } else {
+                alert('Error: ' + data.error);
+            }
+        } catch (err) { console.error(err); }
+    };
+
     // Domain Handlers
     const handleDomainSubmit = async () => {
         const domainToRegister = newDomain.toLowerCase().trim();
@@ -248,7 +282,7 @@ const SettingsView: React.FC<SettingsViewProps> = ({ tenant, onRefresh, user })
                                         />
                                     </Box>
                                 </Box>
-                                {user?.role === 'super_admin' && (
+                                {can(user?.grant, 'tenant:write') && (
                                     <Button
                                         variant="outlined"
                                         size="small"
@@ -265,8 +299,145 @@ const SettingsView: React.FC<SettingsViewProps> = ({ tenant, onRefresh, user })
                 </Grid>
             </Grid>
 
+            {/* Section: Sign-in Security */}
+            <Grid container spacing={4} sx={{ mb: 8 }}>
+                <Grid size={{ xs: 12, md: 4 }}>
+                    <Typography variant="h6" sx={{ fontWeight: 700, mb: 1 }}>Sign-in Security</Typography>
+                    <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                        Two-step verification for console administrators, with authenticator apps, passkeys and security keys.
+                    </Typography>
+                </Grid>
+                <Grid size={{ xs: 12, md: 8 }}>
+                    <Paper variant="outlined" sx={{ borderRadius: 3, overflow: 'hidden' }}>
+                        {can(user?.grant, 'security:write') && (
+                            <Box sx={{ p: isMobile ? 2 : 3, borderBottom: '1px solid #f0f0f0' }}>
+                                <FormControlLabel
+                                    control={
+                                        <Switch
+                                            checked={!!tenant?.require_admin_mfa}
+                                            onChange={e => handleSecurityUpdate({ require_admin_mfa: e.target.checked })}
+                                        />
+                                    }
+                                    label={
+                                        <Box>
+                                            <Typography variant="subtitle2" sx={{ fontWeight: 700 }}>Require two-step verification for all administrators</Typography>
+                                            <Typography variant="body2" color="text.secondary">Administrators without a second factor must set one up at their next sign-in.</Typography>
+                                        </Box>
+                                    }
+                                />
+                            </Box>
+                        )}
+                        {can(user?.grant, 'security:write') && (
+                            <Box sx={{ p: isMobile ? 2 : 3, borderBottom: '1px solid #f0f0f0' }}>
+                                <Typography variant="subtitle2" sx={{ fontWeight: 700 }}>Password policy</Typography>
+                                <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>Applies to new administrator passwords and password changes.</Typography>
+                                <Box sx={{ display: 'flex', flexDirection: isMobile ? 'column' : 'row', gap: 2, alignItems: isMobile ? 'stretch' : 'center' }}>
+                                    <TextField
+                                        label="Minimum length"
+                                        type="number"
+                                        size="small"
+                                        value={passwordMinLength}
+                                        onChange={e => setPasswordMinLength(parseInt(e.target.value) || 0)}
+                                        slotProps={{ htmlInput: { min: 8, max: 128 } }}
+                                        sx={{ width: isMobile ? '100%' : 160 }}
+                                    />
+                                    <Button
+                                        variant="outlined"
+                                        startIcon={<SaveIcon />}
+                                        disabled={passwordMinLength === (tenant?.password_min_length || 12)}
+                                        onClick={() => handleSecurityUpdate({ password_min_length: passwordMinLength })}
+                                    >
+                                        Save
+                                    </Button>
+                                    <FormControlLabel
+                                        control={
+                                            <Switch
+                                                checked={tenant?.password_require_complexity ?? true}
+                                                onChange={e => handleSecurityUpdate({ password_require_complexity: e.target.checked })}
+                                            />
+                                        }
+                                        label={<Typography variant="body2">Require three of: lowercase, uppercase, digits, symbols</Typography>}
+                                    />
+                                </Box>
+                            </Box>
+                        )}
+                        {can(user?.grant, 'security:write') && (
+                            <Box sx={{ p: isMobile ? 2 : 3, borderBottom: '1px solid #f0f0f0', display: 'flex', flexDirection: 'column', gap: 2 }}>
+                                <FormControlLabel
+                                    control={
+                                        <Switch
+                                            checked={!!tenant?.gateway_hardware_approval}
+                                            onChange={e => handleSecurityUpdate({ gateway_hardware_approval: e.target.checked })}
+                                        />
+                                    }
+                                    label={
+                                        <Box>
+                                            <Typography variant="subtitle2" sx={{ fontWeight: 700 }}>Approve gateway hardware changes</Typography>
+                                            <Typography variant="body2" color="text.secondary">A gateway that connects from different hardware waits for approval on the Gateways page instead of being refused.</Typography>
+                                        </Box>
+                                    }
+                                />
+                                <FormControlLabel
+                                    control={
+                                        <Switch
+                                            checked={!!tenant?.require_device_posture}
+                                            onChange={e => handleSecurityUpdate({ require_device_posture: e.target.checked })}
+                                        />
+                                    }
+                                    label={
+                                        <Box>
+                                            <Typography variant="subtitle2" sx={{ fontWeight: 700 }}>Require a device check</Typography>
+                                            <Typography variant="body2" color="text.secondary">Users can only connect from a client that sends a signed device posture report.</Typography>
+                                        </Box>
+                                    }
+                                />
+                                <FormControlLabel
+                                    control={
+                                        <Switch
+                                            checked={!!tenant?.device_approval}
+                                            onChange={e => handleSecurityUpdate({ device_approval: e.target.checked })}
+                                        />
+                                    }
+                                    label={
+                                        <Box>
+                                            <Typography variant="subtitle2" sx={{ fontWeight: 700 }}>Approve new devices</Typography>
+                                            <Typography variant="body2" color="text.secondary">A new device waits for approval and can then only be used by the user who registered it.</Typography>
+                                        </Box>
+                                    }
+                                />
+                            </Box>
+                        )}
+                        <Box sx={{ p: isMobile ? 2 : 3, borderBottom: loginAttempts.length > 0 ? '1px solid #f0f0f0' : 'none' }}>
+                            <Typography variant="subtitle1" sx={{ fontWeight: 700, mb: 1 }}>Your second factors</Typography>
+                            <MfaSettings base="/auth/mgmt" />
+                        </Box>
+                        {loginAttempts.length > 0 && (
+                            <Box sx={{ p: isMobile ? 2 : 3 }}>
+                                <Typography variant="subtitle1" sx={{ fontWeight: 700 }}>Recent failed sign-ins</Typography>
+                                <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>Refused console sign-ins for this organization, newest first.</Typography>
+                                {loginAttempts.slice(0, 20).map(attempt => (
+                                    <Box key={attempt.id} sx={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', py: 1, borderBottom: '1px solid #f5f5f5', gap: 2 }}>
+                                        <Box sx={{ minWidth: 0 }}>
+                                            <Typography variant="body2" sx={{ fontWeight: 600 }} noWrap>{attempt.email || '(no email)'}</Typography>
+                                            <Typography variant="caption" color="text.secondary">
+                                                {new Date(attempt.created_at).toLocaleString()} · {attempt.ip}{attempt.country ? ` (${attempt.country})` : ''}
+                                            </Typography>
+                                        </Box>
+                                        <Chip
+                                            size="small"
+                                            label={attempt.reason === 'invalid_credentials' ? 'Wrong password' : attempt.reason === 'invalid_mfa' ? 'Wrong code' : attempt.reason === 'sso_required' ? 'Single sign-on required' : attempt.reason === 'locked' ? 'Locked out' : 'Throttled'}
+                                            color={attempt.reason === 'locked' || attempt.reason === 'throttled' ? 'warning' : 'default'}
+                                        />
+                                    </Box>
+                                ))}
+                            </Box>
+                        )}
+                    </Paper>
+                </Grid>
+            </Grid>
+
             {/* Section: Identity Provider */}
-            {user?.role === 'super_admin' && (
+            {can(user?.grant, 'idp:write') && (
                 <Grid container spacing={4} sx={{ mb: 8 }}>
                     <Grid size={{ xs: 12, md: 4 }}>
                         <Typography variant="h6" sx={{ fontWeight: 700, mb: 1 }}>Identity Provider</Typography>
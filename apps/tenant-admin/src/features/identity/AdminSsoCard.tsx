@@ -0,0 +1,195 @@
+import React, { useState, useEffect } from 'react';
+import {
+    Box,
+    Typography,
+    Button,
+    Card,
+    CardContent,
+    TextField,
+    IconButton,
+    Alert,
+    MenuItem,
+    FormControlLabel,
+    Switch
+} from '@mui/material';
+import {
+    Add as AddIcon,
+    Delete as DeleteIcon,
+    Save as SaveIcon,
+    AdminPanelSettings as AdminIcon,
+} from '@mui/icons-material';
+import { AdminSSOSettings, IdentityProvider } from '../../types';
+
+const roleLabels: Record<string, string> = {
+    super_admin: 'Super Admin',
+    admin: 'Admin',
+    policy_admin: 'Policy Admin',
+    helpdesk: 'Helpdesk',
+    auditor: 'Auditor'
+};
+
+interface AdminSsoCardProps {
+    providers: IdentityProvider[];
+}
+
+const AdminSsoCard: React.FC<AdminSsoCardProps> = ({ providers }) => {
+    const [settings, setSettings] = useState<AdminSSOSettings | null>(null);
+    const [error, setError] = useState('');
+    const [saved, setSaved] = useState(false);
+
+    useEffect(() => {
+        fetchSettings();
+    }, []);
+
+    const fetchSettings = async () => {
+        try {
+            const res = await fetch('/api/v1/admin-sso');
+            const data = await res.json();
+            if (data.success) setSettings({ ...data.data, mappings: data.data.mappings || [] });
+        } catch (err) {
+            console.error('Failed to fetch admin SSO settings', err);
+        }
+    };
+
+    const handleSave = async () => {
+        if (!settings) return;
+        setError('');
+        setSaved(false);
+        try {
+            const res = await fetch('/api/v1/admin-sso', {
+                method: 'PUT',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(settings)
+            });
+            const data = await res.json();
+            if (data.success) {
+                setSaved(true);
+                fetchSettings();
+            } else {
+                setError(data.error || 'Failed to save');
+            }
+        } catch (err) {
+            console.error('Save failed', err);
+        }
+    };
+
+    // Only super admins can read the settings
+    if (!settings) return null;
+
+    const updateMapping = (index: number, field: 'group' | 'role', value: string) => {
+        const mappings = settings.mappings.map((m, i) => i === index ? { ...m, [field]: value } : m);
+        setSettings({ ...settings, mappings });
+    };
+
+    const origin = window.location.origin;
+
+    return (
+        <Card sx={{ mt: 4, borderRadius: 4, border: '1px solid #eef0f2', boxShadow: '0 2px 8px rgba(0,0,0,0.03)' }}>
+            <CardContent sx={{ p: 3 }}>
+                <Typography variant="h6" sx={{ fontWeight: 700, display: 'flex', alignItems: 'center', gap: 1 }}>
+                    <AdminIcon color="primary" />
+                    Administrator Single Sign-On
+                </Typography>
+                <Typography variant="body2" color="text.secondary" sx={{ mt: 1, mb: 2 }}>
+                    Let administrators sign in to this console with your identity provider. Register
+                    {' '}<Box component="span" sx={{ fontFamily: 'monospace' }}>{origin}/auth/mgmt/sso/callback</Box>{' '}
+                    as a redirect URI, or for SAML the ACS
+                    {' '}<Box component="span" sx={{ fontFamily: 'monospace' }}>{origin}/auth/mgmt/sso/acs</Box>{' '}
+                    and entity ID
+                    {' '}<Box component="span" sx={{ fontFamily: 'monospace' }}>{origin}/auth/mgmt/sso/metadata</Box>.
+                    While it is on, only break-glass administrators can use their password.
+                </Typography>
+
+                {error && <Alert severity="error" sx={{ mb: 2, borderRadius: 3 }}>{error}</Alert>}
+                {saved && <Alert severity="success" sx={{ mb: 2, borderRadius: 3 }} onClose={() => setSaved(false)}>Saved</Alert>}
+
+                <FormControlLabel
+                    control={<Switch checked={settings.enabled} onChange={e => setSettings({ ...settings, enabled: e.target.checked })} />}
+                    label="Sign administrators in through the identity provider"
+                    sx={{ mb: 2 }}
+                />
+
+                <Box sx={{ display: 'flex', gap: 2, mb: 3, flexWrap: 'wrap' }}>
+                    <TextField
+                        select
+                        size="small"
+                        label="Identity provider"
+                        value={settings.provider_id || ''}
+                        onChange={e => setSettings({ ...settings, provider_id: e.target.value || null })}
+                        sx={{ minWidth: 240, flex: 1 }}
+                    >
+                        <MenuItem value="">Default provider</MenuItem>
+                        {providers.filter(p => p.enabled).map(p => (
+                            <MenuItem key={p.id} value={p.id}>{p.name}</MenuItem>
+                        ))}
+                    </TextField>
+                    <TextField
+                        select
+                        size="small"
+                        label="Google Workspace administrators"
+                        value={settings.workspace_admin_role || ''}
+                        onChange={e => setSettings({ ...settings, workspace_admin_role: e.target.value as AdminSSOSettings['workspace_admin_role'] })}
+                        sx={{ minWidth: 240, flex: 1 }}
+                    >
+                        <MenuItem value="">No role</MenuItem>
+                        {Object.entries(roleLabels).map(([value, label]) => (
+                            <MenuItem key={value} value={value}>{label}</MenuItem>
+                        ))}
+                    </TextField>
+                </Box>
+
+                <Typography variant="subtitle2" sx={{ fontWeight: 700, mb: 1 }}>Group role mappings</Typography>
+                <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                    Members of a group get its role; the highest role wins. Users matching no mapping cannot sign in.
+                </Typography>
+                {settings.mappings.map((m, i) => (
+                    <Box key={i} sx={{ display: 'flex', gap: 2, mb: 1.5, alignItems: 'center' }}>
+                        <TextField
+                            size="small"
+                            label="Group"
+                            placeholder="it-admins@example.com"
+                            value={m.group}
+                            onChange={e => updateMapping(i, 'group', e.target.value)}
+                            sx={{ flex: 1 }}
+                        />
+                        <TextField
+                            select
+                            size="small"
+                            label="Role"
+                            value={m.role}
+                            onChange={e => updateMapping(i, 'role', e.target.value)}
+                            sx={{ minWidth: 160 }}
+                        >
+                            {Object.entries(roleLabels).map(([value, label]) => (
+                                <MenuItem key={value} value={value}>{label}</MenuItem>
+                            ))}
+                        </TextField>
+                        <IconButton size="small" onClick={() => setSettings({ ...settings, mappings: settings.mappings.filter((_, j) => j !== i) })} sx={{ color: 'error.main' }}>
+                            <DeleteIcon fontSize="small" />
+                        </IconButton>
+                    </Box>
+                ))}
+
+                <Box sx={{ display: 'flex', justifyContent: 'space-between', mt: 2 }}>
+                    <Button
+                        startIcon={<AddIcon />}
+                        onClick={() => setSettings({ ...settings, mappings: [...settings.mappings, { group: '', role: 'admin' }] })}
+                        sx={{ textTransform: 'none', fontWeight: 700 }}
+                    >
+                        Add Mapping
+                    </Button>
+                    <Button
+                        variant="contained"
+                        startIcon={<SaveIcon />}
+                        onClick={handleSave}
+                        sx={{ borderRadius: 2.5, textTransform: 'none', fontWeight: 700 }}
+                    >
+                        Save
+                    </Button>
+                </Box>
+            </CardContent>
+        </Card>
+    );
+};
+
+export default AdminSsoCard;
@@ -0,0 +1,128 @@
+import React, { useState, useEffect } from 'react';
+import {
+    Box,
+    Typography,
+    Button,
+    Card,
+    CardContent,
+    Chip,
+    Alert
+} from '@mui/material';
+import {
+    Refresh as RefreshIcon,
+    Groups as GroupsIcon,
+} from '@mui/icons-material';
+import { DirectorySync } from '../../types';
+
+const statusColor: Record<string, 'default' | 'info' | 'success' | 'error'> = {
+    running: 'info',
+    succeeded: 'success',
+    failed: 'error',
+};
+
+const DirectorySyncCard: React.FC = () => {
+    const [sync, setSync] = useState<DirectorySync | null>(null);
+    const [error, setError] = useState('');
+
+    useEffect(() => {
+        fetchStatus();
+    }, []);
+
+    // Poll while a sync is running
+    useEffect(() => {
+        if (sync?.status !== 'running') return;
+        const timer = setTimeout(fetchStatus, 3000);
+        return () => clearTimeout(timer);
+    }, [sync]);
+
+    const fetchStatus = async () => {
+        try {
+            const res = await fetch('/api/v1/directory/sync');
+            const data = await res.json();
+            if (data.success) setSync(data.data);
+        } catch (err) {
+            console.error('Failed to fetch directory sync status', err);
+        }
+    };
+
+    const handleSync = async () => {
+        setError('');
+        try {
+            const res = await fetch('/api/v1/directory/sync', { method: 'POST' });
+            const data = await res.json();
+            if (data.success) {
+                setSync((prev) => ({ ...(prev || {}), status: 'running' }));
+            } else {
+                setError(data.error || 'Failed to start sync');
+            }
+        } catch (err) {
+            console.error('Sync failed', err);
+        }
+    };
+
+    const formatTime = (value?: string) => value ? new Date(value).toLocaleString() : 'Never';
+
+    return (
+        <Card sx={{ mt: 4, borderRadius: 4, border: '1px solid #eef0f2', boxShadow: '0 2px 8px rgba(0,0,0,0.03)' }}>
+            <CardContent sx={{ p: 3 }}>
+                <Box sx={{ display: 'flex', alignItems: 'center', justifyContent: 'space-between' }}>
+                    <Typography variant="h6" sx={{ fontWeight: 700, display: 'flex', alignItems: 'center', gap: 1 }}>
+                        <GroupsIcon color="primary" />
+                        Google Workspace Directory
+                        {sync && (
+                            <Chip
+                                size="small"
+                                label={sync.status}
+                                color={statusColor[sync.status] || 'default'}
+                                sx={{ ml: 1, fontWeight: 600, textTransform: 'capitalize' }}
+                            />
+                        )}
+                    </Typography>
+                    <Button
+                        variant="outlined"
+                        startIcon={<RefreshIcon />}
+                        onClick={handleSync}
+                        disabled={sync?.status === 'running'}
+                        sx={{ borderRadius: 2.5, textTransform: 'none', fontWeight: 700 }}
+                    >
+                        Sync Now
+                    </Button>
+                </Box>
+                <Typography variant="body2" color="text.secondary" sx={{ mt: 1, mb: 2 }}>
+                    Users, groups and nested group membership are copied from Google Workspace on a schedule.
+                    Sign-in and the policy editor read from this copy instead of calling Google.
+                </Typography>
+
+                {error && <Alert severity="error" sx={{ mb: 2, borderRadius: 3 }}>{error}</Alert>}
+                {sync?.last_error && (
+                    <Alert severity="warning" sx={{ mb: 2, borderRadius: 3 }}>
+                        Last sync failed: {sync.last_error}
+                    </Alert>
+                )}
+
+                {sync && sync.status !== 'never' && (
+                    <Box sx={{ display: 'flex', gap: 4, flexWrap: 'wrap' }}>
+                        <Box>
+                            <Typography variant="caption" color="text.secondary">Users</Typography>
+                            <Typography variant="body1" sx={{ fontWeight: 700 }}>{sync.users ?? 0}</Typography>
+                        </Box>
+                        <Box>
+                            <Typography variant="caption" color="text.secondary">Groups</Typography>
+                            <Typography variant="body1" sx={{ fontWeight: 700 }}>{sync.groups ?? 0}</Typography>
+                        </Box>
+                        <Box>
+                            <Typography variant="caption" color="text.secondary">Last Successful Sync</Typography>
+                            <Typography variant="body1" sx={{ fontWeight: 700 }}>{formatTime(sync.last_succeeded_at)}</Typography>
+                        </Box>
+                        <Box>
+                            <Typography variant="caption" color="text.secondary">Changes</Typography>
+                            <Typography variant="body1" sx={{ fontWeight: 700 }}>{sync.changes ?? 0}</Typography>
+                        </Box>
+                    </Box>
+                )}
+            </CardContent>
+        </Card>
+    );
+};
+
+export default DirectorySyncCard;
@@ -0,0 +1,391 @@
+import React, { useState, useEffect } from 'react';
+import {
+    Box,
+    Typography,
+    Button,
+    Card,
+    CardContent,
+    Dialog,
+    DialogTitle,
+    DialogContent,
+    DialogActions,
+    TextField,
+    Grid,
+    IconButton,
+    Chip,
+    Paper,
+    CircularProgress,
+    MenuItem,
+    FormControlLabel,
+    Switch,
+    useMediaQuery,
+    useTheme
+} from '@mui/material';
+import {
+    Add as AddIcon,
+    Delete as DeleteIcon,
+    Edit as EditIcon,
+    Fingerprint as FingerprintIcon,
+} from '@mui/icons-material';
+import { IdentityProvider } from '../../types';
+import ScimTokensCard from './ScimTokensCard';
+import DirectorySyncCard from './DirectorySyncCard';
+import AdminSsoCard from './AdminSsoCard';
+
+const emptyForm = {
+    name: '',
+    type: 'oidc' as IdentityProvider['type'],
+    enabled: true,
+    is_default: false,
+    issuer_url: '',
+    client_id: '',
+    client_secret: '',
+    scopes: '',
+    sso_url: '',
+    entity_id: '',
+    certificate: '',
+    email_claim: '',
+    groups_claim: ''
+};
+
+const typeLabels: Record<IdentityProvider['type'], string> = {
+    google: 'Google',
+    oidc: 'OpenID Connect',
+    saml: 'SAML 2.0'
+};
+
+const IdentityProvidersView: React.FC = () => {
+    const theme = useTheme();
+    const isMobile = useMediaQuery(theme.breakpoints.down('md'));
+
+    const [providers, setProviders] = useState<IdentityProvider[]>([]);
+    const [loading, setLoading] = useState(false);
+    const [dialogOpen, setDialogOpen] = useState(false);
+    const [editing, setEditing] = useState<IdentityProvider | null>(null);
+    const [formData, setFormData] = useState(emptyForm);
+    const [error, setError] = useState('');
+
+    useEffect(() => {
+        fetchProviders();
+    }, []);
+
+    const fetchProviders = async () => {
+        try {
+            const res = await fetch('/api/v1/identity-providers');
+            const data = await res.json();
+            if (data.success) {
+                setProviders(data.data || []);
+            }
+        } catch (err) {
+            console.error('Failed to fetch identity providers', err);
+        }
+    };
+
+    const handleOpenDialog = (provider?: IdentityProvider) => {
+        setError('');
+        if (provider) {
+            setEditing(provider);
+            setFormData({
+                name: provider.name,
+                type: provider.type,
+                enabled: provider.enabled,
+                is_default: provider.is_default,
+                issuer_url: provider.issuer_url || '',
+                client_id: provider.client_id || '',
+                client_secret: '',
+                scopes: provider.scopes || '',
+                sso_url: provider.sso_url || '',
+                entity_id: provider.entity_id || '',
+                certificate: provider.certificate || '',
+                email_claim: provider.email_claim || '',
+                groups_claim: provider.groups_claim || ''
+            });
+        } else {
+            setEditing(null);
+            setFormData(emptyForm);
+        }
+        setDialogOpen(true);
+    };
+
+    const handleSave = async () => {
+        setLoading(true);
+        setError('');
+        try {
+            const body = editing ? { id: editing.id, ...formData } : formData;
+            const res = await fetch('/api/v1/identity-providers', {
+                method: editing ? 'PATCH' : 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(body)
+            });
+
+            if (res.ok) {
+                setDialogOpen(false);
+                fetchProviders();
+            } else {
+                const data = await res.json();
+                setError(data.error || 'Failed to save identity provider');
+            }
+        } catch (err) {
+            console.error('Save failed', err);
+        } finally {
+            setLoading(false);
+        }
+    };
+
+    const handleDelete = async (id: string) => {
+        if (!window.confirm('Are you sure you want to delete this identity provider? Users signing in with it will no longer be able to connect.')) return;
+        try {
+            const res = await fetch('/api/v1/identity-providers', {
+                method: 'DELETE',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id })
+            });
+            if (res.ok) fetchProviders();
+        } catch (err) {
+            console.error('Delete failed', err);
+        }
+    };
+
+    const field = (key: keyof typeof emptyForm, label: string, props: Record<string, unknown> = {}) => (
+        <TextField
+            fullWidth
+            label={label}
+            value={formData[key] as string}
+            onChange={(e) => setFormData({ ...formData, [key]: e.target.value })}
+            sx={{ '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
+            {...props}
+        />
+    );
+
+    const isSAML = formData.type === 'saml';
+
+    return (
+        <Box sx={{ p: 0 }}>
+            <Box sx={{ display: 'flex', justifyContent: 'space-between', alignItems: 'center', mb: 4 }}>
+                <Box>
+                    <Typography variant="h4" sx={{ fontWeight: 800, color: 'text.primary', display: 'flex', alignItems: 'center', gap: 2 }}>
+                        <FingerprintIcon sx={{ fontSize: 40, color: 'primary.main' }} />
+                        Identity Providers
+                    </Typography>
+                    <Typography variant="body1" color="text.secondary" sx={{ mt: 1 }}>
+                        Choose where VPN users sign in: Google, any OpenID Connect provider (Entra ID, Okta, Keycloak) or SAML 2.0.
+                    </Typography>
+                </Box>
+                <Button
+                    variant="contained"
+                    startIcon={<AddIcon />}
+                    onClick={() => handleOpenDialog()}
+                    sx={{
+                        borderRadius: 2.5,
+                        px: 3,
+                        py: 1,
+                        boxShadow: '0 4px 12px rgba(26, 115, 232, 0.2)',
+                        textTransform: 'none',
+                        fontWeight: 700
+                    }}
+                >
+                    Add Provider
+                </Button>
+            </Box>
+
+            <Grid container spacing={3}>
+                {providers.map((provider) => (
+                    <Grid key={provider.id} size={12}>
+                        <Card sx={{
+                            borderRadius: 4,
+                            border: '1px solid #eef0f2',
+                            boxShadow: '0 2px 8px rgba(0,0,0,0.03)',
+                            transition: 'all 0.2s',
+                            '&:hover': {
+                                boxShadow: '0 8px 16px rgba(0,0,0,0.06)',
+                                borderColor: 'primary.main'
+                            }
+                        }}>
+                            <CardContent sx={{ p: 3 }}>
+                                <Grid container spacing={2} alignItems="center">
+                                    <Grid size={{ xs: 12, md: 8 }}>
+                                        <Typography variant="h6" sx={{ fontWeight: 700 }}>{provider.name}</Typography>
+                                        <Typography variant="caption" color="text.secondary" sx={{ fontFamily: 'monospace' }}>
+                                            {provider.type === 'saml' ? provider.sso_url : (provider.issuer_url || provider.client_id)}
+                                        </Typography>
+                                        <Box sx={{ display: 'flex', flexWrap: 'wrap', gap: 0.5, mt: 1 }}>
+                                            <Chip label={typeLabels[provider.type]} size="small" color="primary" variant="outlined" />
+                                            {provider.is_default && <Chip label="Default" size="small" color="primary" />}
+                                            {!provider.enabled && <Chip label="Disabled" size="small" />}
+                                        </Box>
+                                    </Grid>
+                                    <Grid size={{ xs: 12, md: 4 }} sx={{ textAlign: 'right' }}>
+                                        <IconButton size="small" onClick={() => handleOpenDialog(provider)} sx={{ mr: 1, color: 'primary.main', bgcolor: 'rgba(26, 115, 232, 0.05)' }}>
+                                            <EditIcon fontSize="small" />
+                                        </IconButton>
+                                        <IconButton size="small" onClick={() => handleDelete(provider.id)} sx={{ color: 'error.main', bgcolor: 'rgba(211, 47, 47, 0.05)' }}>
+                                            <DeleteIcon fontSize="small" />
+                                        </IconButton>
+                                    </Grid>
+                                </Grid>
+                            </CardContent>
+                        </Card>
+                    </Grid>
+                ))}
+
+                {providers.length === 0 && (
+                    <Grid size={12}>
+                        <Paper sx={{ p: 8, textAlign: 'center', borderRadius: 4, bgcolor: 'grey.50', border: '2px dashed #e0e0e0' }}>
+                            <FingerprintIcon sx={{ fontSize: 64, color: 'text.disabled', mb: 2 }} />
+                            <Typography variant="h6" color="text.secondary">No identity providers</Typography>
+                            <Typography variant="body2" color="text.disabled" sx={{ mt: 1 }}>
+                                Users sign in with the Google identity configured in Settings.
+                            </Typography>
+                        </Paper>
+                    </Grid>
+                )}
+            </Grid>
+
+            <DirectorySyncCard />
+            <ScimTokensCard />
+            <AdminSsoCard providers={providers} />
+
+            <Dialog
+                open={dialogOpen}
+                onClose={(_, reason) => {
+                    if (reason !== 'backdropClick' && !loading) {
+                        setDialogOpen(false);
+                    }
+                }}
+                maxWidth="md"
+                fullWidth
+                fullScreen={isMobile}
+                PaperProps={{
+                    sx: { borderRadius: isMobile ? 0 : 4, boxShadow: '0 24px 48px rgba(0,0,0,0.1)' }
+                }}
+            >
+                <DialogTitle sx={{ px: 4, pt: 4, pb: 2 }}>
+                    <Typography variant="h5" sx={{ fontWeight: 800 }}>
+                        {editing ? 'Edit Identity Provider' : 'Add Identity Provider'}
+                    </Typography>
+                </DialogTitle>
+                <DialogContent sx={{ px: 4 }}>
+                    <Grid container spacing={3} sx={{ mt: 0.5 }}>
+                        <Grid size={{ xs: 12, md: 8 }}>
+                            {field('name', 'Name', { placeholder: 'e.g. Corporate Entra ID' })}
+                        </Grid>
+                        <Grid size={{ xs: 12, md: 4 }}>
+                            {field('type', 'Type', {
+                                select: true,
+                                children: Object.entries(typeLabels).map(([value, label]) => (
+                                    <MenuItem key={value} value={value}>{label}</MenuItem>
+                                ))
+                            })}
+                        </Grid>
+
+                        {!isSAML && (
+                            <>
+                                {formData.type === 'oidc' && (
+                                    <Grid size={12}>
+                                        {field('issuer_url', 'Issuer URL', {
+                                            placeholder: 'e.g. https://login.microsoftonline.com/<tenant-id>/v2.0',
+                                            helperText: 'Endpoints and signing keys are discovered from /.well-known/openid-configuration.'
+                                        })}
+                                    </Grid>
+                                )}
+                                <Grid size={{ xs: 12, md: 6 }}>
+                                    {field('client_id', 'Client ID')}
+                                </Grid>
+                                <Grid size={{ xs: 12, md: 6 }}>
+                                    {field('client_secret', 'Client Secret', {
+                                        type: 'password',
+                                        helperText: editing ? 'Leave empty to keep the current secret.' : undefined
+                                    })}
+                                </Grid>
+                                <Grid size={12}>
+                                    <Typography variant="caption" color="text.secondary">
+                                        Redirect URI: <Box component="span" sx={{ fontFamily: 'monospace' }}>https://&lt;your auth domain&gt;/callback</Box>
+                                    </Typography>
+                                </Grid>
+                            </>
+                        )}
+
+                        {formData.type === 'oidc' && (
+                            <Grid size={12}>
+                                {field('scopes', 'Scopes', { placeholder: 'email profile', helperText: '"openid" is always requested.' })}
+                            </Grid>
+                        )}
+
+                        {isSAML && (
+                            <>
+                                <Grid size={12}>
+                                    {field('sso_url', 'IdP Single Sign-On URL', { placeholder: 'e.g. https://idp.example.com/sso/saml' })}
+                                </Grid>
+                                <Grid size={12}>
+                                    {field('entity_id', 'IdP Entity ID (Issuer)', { helperText: 'Optional. Assertions from other issuers are rejected.' })}
+                                </Grid>
+                                <Grid size={12}>
+                                    {field('certificate', 'IdP Signing Certificate', { multiline: true, rows: 4, placeholder: '-----BEGIN CERTIFICATE-----' })}
+                                </Grid>
+                                <Grid size={12}>
+                                    <Typography variant="caption" color="text.secondary" component="div">
+                                        ACS URL: <Box component="span" sx={{ fontFamily: 'monospace' }}>https://&lt;your auth domain&gt;/saml/acs</Box>
+                                    </Typography>
+                                    <Typography variant="caption" color="text.secondary" component="div">
+                                        SP Entity ID / metadata: <Box component="span" sx={{ fontFamily: 'monospace' }}>https://&lt;your auth domain&gt;/saml/metadata</Box>
+                                    </Typography>
+                                </Grid>
+                            </>
+                        )}
+
+                        {formData.type !== 'google' && (
+                            <>
+                                <Grid size={{ xs: 12, md: 6 }}>
+                                    {field('email_claim', isSAML ? 'Email Attribute' : 'Email Claim', {
+                                        placeholder: isSAML ? 'NameID' : 'email'
+                                    })}
+                                </Grid>
+                                <Grid size={{ xs: 12, md: 6 }}>
+                                    {field('groups_claim', isSAML ? 'Groups Attribute' : 'Groups Claim', {
+                                        placeholder: 'groups',
+                                        helperText: isSAML ? undefined : 'Nested claims use dots, e.g. realm_access.roles'
+                                    })}
+                                </Grid>
+                            </>
+                        )}
+
+                        <Grid size={12}>
+                            <FormControlLabel
+                                control={<Switch checked={formData.enabled} onChange={(e) => setFormData({ ...formData, enabled: e.target.checked })} />}
+                                label="Enabled"
+                            />
+                            <FormControlLabel
+                                control={<Switch checked={formData.is_default} onChange={(e) => setFormData({ ...formData, is_default: e.target.checked })} />}
+                                label="Default for VPN sign-in"
+                            />
+                        </Grid>
+
+                        {error && (
+                            <Grid size={12}>
+                                <Typography variant="body2" color="error">{error}</Typography>
+                            </Grid>
+                        )}
+                    </Grid>
+                </DialogContent>
+                <DialogActions sx={{ px: 4, pb: 4, pt: 2 }}>
+                    <Button onClick={() => setDialogOpen(false)} disabled={loading} sx={{ fontWeight: 700 }}>Cancel</Button>
+                    <Button
+                        variant="contained"
+                        onClick={handleSave}
+                        disabled={loading}
+                        sx={{
+                            borderRadius: 2.5,
+                            px: 4,
+                            fontWeight: 700,
+                            boxShadow: '0 4px 12px rgba(26, 115, 232, 0.2)'
+                        }}
+                    >
+                        {loading ? <CircularProgress size={24} color="inherit" /> : (editing ? 'Update Provider' : 'Add Provider')}
+                    </Button>
+                </DialogActions>
+            </Dialog>
+        </Box>
+    );
+};
+
+export default IdentityProvidersView;
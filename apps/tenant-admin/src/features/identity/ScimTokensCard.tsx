@@ -0,0 +1,160 @@
+import React, { useState, useEffect } from 'react';
+import {
+    Box,
+    Typography,
+    Button,
+    Card,
+    CardContent,
+    TextField,
+    IconButton,
+    Alert,
+    Table,
+    TableBody,
+    TableCell,
+    TableHead,
+    TableRow
+} from '@mui/material';
+import {
+    Add as AddIcon,
+    Delete as DeleteIcon,
+    ContentCopy as CopyIcon,
+    Sync as SyncIcon,
+} from '@mui/icons-material';
+import { SCIMToken } from '../../types';
+
+const ScimTokensCard: React.FC = () => {
+    const [tokens, setTokens] = useState<SCIMToken[]>([]);
+    const [name, setName] = useState('');
+    const [secret, setSecret] = useState('');
+    const [error, setError] = useState('');
+
+    useEffect(() => {
+        fetchTokens();
+    }, []);
+
+    const fetchTokens = async () => {
+        try {
+            const res = await fetch('/api/v1/scim/tokens');
+            const data = await res.json();
+            if (data.success) setTokens(data.data || []);
+        } catch (err) {
+            console.error('Failed to fetch SCIM tokens', err);
+        }
+    };
+
+    const handleCreate = async () => {
+        setError('');
+        try {
+            const res = await fetch('/api/v1/scim/tokens', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ name })
+            });
+            const data = await res.json();
+            if (data.success) {
+                setSecret(data.data.secret);
+                setName('');
+                fetchTokens();
+            } else {
+                setError(data.error || 'Failed to create token');
+            }
+        } catch (err) {
+            console.error('Create failed', err);
+        }
+    };
+
+    const handleDelete = async (id: string) => {
+        if (!window.confirm('Revoke this token? Your identity provider will no longer be able to provision users with it.')) return;
+        try {
+            const res = await fetch('/api/v1/scim/tokens', {
+                method: 'DELETE',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ id })
+            });
+            if (res.ok) fetchTokens();
+        } catch (err) {
+            console.error('Delete failed', err);
+        }
+    };
+
+    return (
+        <Card sx={{ mt: 4, borderRadius: 4, border: '1px solid #eef0f2', boxShadow: '0 2px 8px rgba(0,0,0,0.03)' }}>
+            <CardContent sx={{ p: 3 }}>
+                <Typography variant="h6" sx={{ fontWeight: 700, display: 'flex', alignItems: 'center', gap: 1 }}>
+                    <SyncIcon color="primary" />
+                    SCIM Provisioning
+                </Typography>
+                <Typography variant="body2" color="text.secondary" sx={{ mt: 1, mb: 3 }}>
+                    Let your identity provider push users and groups to <Box component="span" sx={{ fontFamily: 'monospace' }}>{window.location.origin}/scim/v2</Box>.
+                    Once users are provisioned, only active directory users can sign in and deprovisioned users are disconnected.
+                </Typography>
+
+                {secret && (
+                    <Alert
+                        severity="success"
+                        sx={{ mb: 3, borderRadius: 3 }}
+                        action={
+                            <IconButton size="small" onClick={() => navigator.clipboard.writeText(secret)}>
+                                <CopyIcon fontSize="small" />
+                            </IconButton>
+                        }
+                        onClose={() => setSecret('')}
+                    >
+                        Copy this token now, it will not be shown again:
+                        <Box sx={{ fontFamily: 'monospace', wordBreak: 'break-all', mt: 0.5 }}>{secret}</Box>
+                    </Alert>
+                )}
+                {error && <Alert severity="error" sx={{ mb: 3, borderRadius: 3 }}>{error}</Alert>}
+
+                <Box sx={{ display: 'flex', gap: 2, mb: 2 }}>
+                    <TextField
+                        size="small"
+                        label="Token name"
+                        placeholder="Okta"
+                        value={name}
+                        onChange={(e) => setName(e.target.value)}
+                        sx={{ flex: 1, '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
+                    />
+                    <Button
+                        variant="contained"
+                        startIcon={<AddIcon />}
+                        onClick={handleCreate}
+                        disabled={!name.trim()}
+                        sx={{ borderRadius: 2.5, textTransform: 'none', fontWeight: 700 }}
+                    >
+                        Create Token
+                    </Button>
+                </Box>
+
+                {tokens.length > 0 && (
+                    <Table size="small">
+                        <TableHead>
+                            <TableRow>
+                                <TableCell sx={{ fontWeight: 700 }}>Name</TableCell>
+                                <TableCell sx={{ fontWeight: 700 }}>Token</TableCell>
+                                <TableCell sx={{ fontWeight: 700 }}>Last Used</TableCell>
+                                <TableCell />
+                            </TableRow>
+                        </TableHead>
+                        <TableBody>
+                            {tokens.map((token) => (
+                                <TableRow key={token.id}>
+                                    <TableCell>{token.name}</TableCell>
+                                    <TableCell sx={{ fontFamily: 'monospace' }}>{token.prefix}…</TableCell>
+                                    <TableCell>{token.last_used_at ? new Date(token.last_used_at).toLocaleString() : 'Never'}</TableCell>
+                                    <TableCell align="right">
+                                        <IconButton size="small" onClick={() => handleDelete(token.id)} sx={{ color: 'error.main' }}>
+                                            <DeleteIcon fontSize="small" />
+                                        </IconButton>
+                                    </TableCell>
+                                </TableRow>
+                            ))}
+                        </TableBody>
+                    </Table>
+                )}
+            </CardContent>
+        </Card>
+    );
+};
+
+export default ScimTokensCard;
@@ -0,0 +1,161 @@
+import React, { useState } from 'react';
+import {
+    Box, Typography, Button, Dialog, DialogTitle, DialogContent, DialogActions,
+    Table, TableHead, TableRow, TableCell, TableBody, Alert, TextField, IconButton
+} from '@mui/material';
+import { Hub as HubIcon, Delete as DeleteIcon, Edit as EditIcon } from '@mui/icons-material';
+import { GatewayGroup } from '../../types';
+
+interface GatewayGroupsDialogProps {
+    open: boolean;
+    groups: GatewayGroup[];
+    canWrite: boolean;
+    onClose: () => void;
+    onChanged: () => void;
+}
+
+const emptyForm = { id: '', name: '', description: '', client_cidr: '' };
+
+// GatewayGroupsDialog manages the sites served by several gateways. Clients
+// connect to a healthy member of a group and move to another when it fails.
+const GatewayGroupsDialog: React.FC<GatewayGroupsDialogProps> = ({ open, groups, canWrite, onClose, onChanged }) => {
+    const [form, setForm] = useState(emptyForm);
+    const [saving, setSaving] = useState(false);
+    const [error, setError] = useState<string | null>(null);
+
+    const handleSave = async () => {
+        setSaving(true);
+        setError(null);
+        const res = await fetch('/api/v1/gateway-groups', {
+            method: form.id ? 'PUT' : 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(form)
+        });
+        const data = await res.json();
+        setSaving(false);
+        if (!res.ok) {
+            setError(data.error || 'Failed to save the gateway group');
+            return;
+        }
+        setForm(emptyForm);
+        onChanged();
+    };
+
+    const handleDelete = async (group: GatewayGroup) => {
+        if (!confirm(`Delete ${group.name}? Its gateways stay, each on its own.`)) return;
+        const res = await fetch('/api/v1/gateway-groups', {
+            method: 'DELETE',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ id: group.id })
+        });
+        if (!res.ok) {
+            const data = await res.json();
+            setError(data.error || 'Failed to delete the gateway group');
+        }
+        onChanged();
+    };
+
+    const handleClose = () => {
+        setForm(emptyForm);
+        setError(null);
+        onClose();
+    };
+
+    return (
+        <Dialog open={open} onClose={handleClose} fullWidth maxWidth="md" PaperProps={{ sx: { borderRadius: 3 } }}>
+            <DialogTitle sx={{ fontWeight: 800, display: 'flex', alignItems: 'center', gap: 2 }}>
+                <HubIcon color="primary" />
+                Gateway Groups
+            </DialogTitle>
+            <DialogContent>
+                <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                    Users connect to a group rather than a gateway. The client picks a healthy member and moves to another one
+                    when it fails. With a shared client CIDR users keep their address on every member; without one, each member
+                    hands out addresses from its own client CIDR and these must not overlap.
+                </Typography>
+                {error && <Alert severity="error" sx={{ mb: 2, borderRadius: 2 }}>{error}</Alert>}
+                {groups.length === 0 ? (
+                    <Typography variant="body2" color="text.secondary" sx={{ py: 3, textAlign: 'center' }}>No gateway groups yet.</Typography>
+                ) : (
+                    <Table size="small">
+                        <TableHead>
+                            <TableRow>
+                                <TableCell sx={{ fontWeight: 700 }}>Name</TableCell>
+                                <TableCell sx={{ fontWeight: 700 }}>Client CIDR</TableCell>
+                                <TableCell sx={{ fontWeight: 700 }}>Gateways</TableCell>
+                                {canWrite && <TableCell align="right" sx={{ fontWeight: 700 }}>Actions</TableCell>}
+                            </TableRow>
+                        </TableHead>
+                        <TableBody>
+                            {groups.map(g => (
+                                <TableRow key={g.id}>
+                                    <TableCell>
+                                        <Typography variant="body2" sx={{ fontWeight: 600 }}>{g.name}</Typography>
+                                        {g.description && <Typography variant="caption" color="text.secondary">{g.description}</Typography>}
+                                    </TableCell>
+                                    <TableCell sx={{ fontFamily: 'monospace' }}>{g.client_cidr || 'Per gateway'}</TableCell>
+                                    <TableCell>{(g.nodes || []).map(n => n.name).join(', ') || '-'}</TableCell>
+                                    {canWrite && (
+                                        <TableCell align="right">
+                                            <IconButton size="small" onClick={() => setForm({ id: g.id, name: g.name, description: g.description || '', client_cidr: g.client_cidr || '' })}>
+                                                <EditIcon fontSize="small" />
+                                            </IconButton>
+                                            <IconButton size="small" color="error" onClick={() => handleDelete(g)}>
+                                                <DeleteIcon fontSize="small" />
+                                            </IconButton>
+                                        </TableCell>
+                                    )}
+                                </TableRow>
+                            ))}
+                        </TableBody>
+                    </Table>
+                )}
+
+                {canWrite && (
+                    <Box sx={{ mt: 3, display: 'flex', flexDirection: 'column', gap: 2 }}>
+                        <Typography variant="subtitle2" sx={{ fontWeight: 700 }}>{form.id ? 'Edit Group' : 'New Group'}</Typography>
+                        <TextField
+                            label="Name"
+                            size="small"
+                            value={form.name}
+                            onChange={(e) => setForm({ ...form, name: e.target.value })}
+                        />
+                        <TextField
+                            label="Description"
+                            size="small"
+                            value={form.description}
+                            onChange={(e) => setForm({ ...form, description: e.target.value })}
+                        />
+                        <TextField
+                            label="Shared Client CIDR"
+                            size="small"
+                            placeholder="10.8.0.0/22"
+                            helperText="Leave empty to use each gateway's own client CIDR. Gateways apply a change when they restart."
+                            value={form.client_cidr}
+                            onChange={(e) => setForm({ ...form, client_cidr: e.target.value })}
+                        />
+                        <Box sx={{ display: 'flex', gap: 1 }}>
+                            <Button
+                                variant="contained"
+                                disableElevation
+                                disabled={!form.name || saving}
+                                onClick={handleSave}
+                                sx={{ borderRadius: 2, fontWeight: 700, textTransform: 'none' }}
+                            >
+                                {saving ? 'Saving...' : form.id ? 'Save Group' : 'Create Group'}
+                            </Button>
+                            {form.id && (
+                                <Button onClick={() => setForm(emptyForm)} sx={{ textTransform: 'none' }}>Cancel</Button>
+                            )}
+                        </Box>
+                    </Box>
+                )}
+            </DialogContent>
+            <DialogActions>
+                <Button onClick={handleClose}>Close</Button>
+            </DialogActions>
+        </Dialog>
+    );
+};
+
+export default GatewayGroupsDialog;
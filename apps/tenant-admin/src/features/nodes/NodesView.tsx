@@ -2,7 +2,7 @@ import React, { useState, useMemo, useEffect } from 'react';
 import {
     Box, Typography, Button, TableContainer, Table, TableHead, TableRow, TableCell,
     TableBody, Paper, IconButton, Dialog, DialogTitle, DialogContent,
-    TextField, DialogActions, Alert, TablePagination, Radio, InputAdornment, Chip,
+    TextField, DialogActions, Alert, TablePagination, Radio, InputAdornment, Chip, MenuItem,
     useMediaQuery, useTheme
 } from '@mui/material';
 import {
@@ -15,28 +15,131 @@ import {
     Storage as StorageIcon,
     AttachMoney as MoneyIcon,
     HelpOutline as HelpIcon,
-    Terminal as TerminalIcon
+    Terminal as TerminalIcon,
+    People as PeopleIcon,
+    Hub as HubIcon
 } from '@mui/icons-material';
-import { Node, NodeSku } from '../../types';
+import { AccessGrant, GatewayGroup, Node, NodeEnrollment, NodeSku, SNATPool } from '../../types';
+import { can } from '../../types/permissions';
+import SessionsDialog from './SessionsDialog';
+import GatewayGroupsDialog from './GatewayGroupsDialog';
 
 interface NodesViewProps {
     nodes: Node[];
-    onCreate: (name: string, skuId: string, clientCIDR: string) => Promise<string | null>;
+    grant?: AccessGrant;
+    onCreate: (name: string, skuId: string, clientCIDR: string) => Promise<NodeEnrollment | null>;
+    onIssueToken: (id: string) => Promise<NodeEnrollment | null>;
+    onResetEnrollment: (id: string) => Promise<NodeEnrollment | null>;
+    onHardwareChange: (id: string, approve: boolean) => Promise<void>;
+    onSetGroup: (id: string, groupId: string) => Promise<boolean>;
+    onSetEgress: (id: string, mode: string, pools: SNATPool[]) => Promise<Node | null>;
+    onGroupsChanged: () => void;
     onDelete: (id: string) => Promise<void>;
 }
 
-const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
+const CommandBox: React.FC<{ comment: string; command: string }> = ({ comment, command }) => (
+    <Paper variant="outlined" sx={{ p: 2, bgcolor: '#202124', color: '#e8eaed', borderRadius: 2, fontFamily: 'Google Sans Mono, monospace', fontSize: '0.85rem' }}>
+        <Box sx={{ mb: 1, userSelect: 'none', color: '#9aa0a6' }}>
+            # {comment}
+        </Box>
+        <div style={{ wordBreak: 'break-all', lineHeight: 1.5 }}>
+            {command}
+        </div>
+    </Paper>
+);
+
+// The node's status, flagged when its gateway's new hardware waits for approval
+const NodeStatus: React.FC<{ node: Node }> = ({ node }) => (
+    <Box sx={{ display: 'flex', flexWrap: 'wrap', gap: 0.5 }}>
+        <Chip
+            label={node.status}
+            size="small"
+            color={node.status === 'ONLINE' ? 'success' : node.status === 'DRAINING' ? 'warning' : 'default'}
+            sx={{ borderRadius: 1.5, fontWeight: 700, height: 24, fontSize: '0.7rem' }}
+        />
+        {node.pending_device_hash && (
+            <Chip
+                label="HARDWARE CHANGED"
+                size="small"
+                color="warning"
+                sx={{ borderRadius: 1.5, fontWeight: 700, height: 24, fontSize: '0.7rem' }}
+            />
+        )}
+    </Box>
+);
+
+// Setup steps for a gateway that has not enrolled yet. The token is shown
+// only once and can be used once.
+const EnrollmentSteps: React.FC<{ enrollment: NodeEnrollment }> = ({ enrollment }) => {
+    const flags = `--enroll-token "${enrollment.enrollment_token}"` +
+        (enrollment.ca_fingerprint ? ` --ca-fingerprint "${enrollment.ca_fingerprint}"` : '');
+    return (
+        <>
+            <Box sx={{ mb: 3 }}>
+                <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
+                    1. Copy the Enrollment Token
+                </Typography>
+                <Paper variant="outlined" sx={{ p: 2, bgcolor: '#f8f9fa', borderRadius: 2, fontFamily: 'monospace', display: 'flex', justifyContent: 'space-between', alignItems: 'center', border: '1px solid #dadce0' }}>
+                    <span style={{ wordBreak: 'break-all', fontWeight: 600, color: '#202124' }}>{enrollment.enrollment_token}</span>
+                    <Button
+                        size="small"
+                        sx={{ textTransform: 'none', fontWeight: 700 }}
+                        onClick={() => navigator.clipboard.writeText(enrollment.enrollment_token)}
+                    >
+                        Copy
+                    </Button>
+                </Paper>
+                <Typography variant="caption" color="text.secondary" sx={{ display: 'block', mt: 1 }}>
+                    It is shown only once, can be used once
+                    {enrollment.enrollment_expires_at && <> and expires on {new Date(enrollment.enrollment_expires_at).toLocaleString()}</>}.
+                </Typography>
+            </Box>
+
+            <Box sx={{ mb: 3 }}>
+                <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
+                    2. Enroll the Gateway
+                </Typography>
+                <CommandBox comment="Exchange the token for the gateway's certificate and connect" command={`sudo ./gateway ${flags}`} />
+            </Box>
+
+            <Box sx={{ mb: 3 }}>
+                <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
+                    3. Install as Background Service
+                </Typography>
+                <CommandBox comment="Install and start as a system service, with the certificate from step 2" command="sudo ./gateway --install-service" />
+            </Box>
+        </>
+    );
+};
+
+const NodesView: React.FC<NodesViewProps> = ({ nodes, grant, onCreate, onIssueToken, onResetEnrollment, onHardwareChange, onSetGroup, onSetEgress, onGroupsChanged, onDelete }) => {
+    const canWrite = can(grant, 'nodes:write') && !grant?.node_ids?.length;
+    const canDelete = can(grant, 'nodes:write');
+    const canSessions = can(grant, 'sessions:read');
+
+    // Sessions Dialog State
+    const [sessionsNode, setSessionsNode] = useState<Node | null>(null);
+
+    // Gateway Groups
+    const [groups, setGroups] = useState<GatewayGroup[]>([]);
+    const [showGroups, setShowGroups] = useState(false);
+
     // Dialog State
     const [showDialog, setShowDialog] = useState(false);
     const [newNodeName, setNewNodeName] = useState('');
     const [selectedSkuId, setSelectedSkuId] = useState<string | null>(null);
-    const [createdNodeId, setCreatedNodeId] = useState<string | null>(null);
+    const [created, setCreated] = useState<NodeEnrollment | null>(null);
     const [loading, setLoading] = useState(false);
     const [clientCIDR, setClientCIDR] = useState('10.8.0.0/23');
     const [cidrError, setCidrError] = useState<string | null>(null);
 
     // View Guide State
     const [viewNode, setViewNode] = useState<Node | null>(null);
+    const [viewEnrollment, setViewEnrollment] = useState<NodeEnrollment | null>(null);
+
+    // Egress of the viewed node; SNAT pools as "destination=source" lines
+    const [egressMode, setEgressMode] = useState('masquerade');
+    const [snatPools, setSnatPools] = useState('');
 
     const theme = useTheme();
     const isMobile = useMediaQuery(theme.breakpoints.down('md'));
@@ -73,8 +176,22 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
 
     useEffect(() => {
         fetchSkus();
+        fetchGroups();
     }, []);
 
+    const fetchGroups = async () => {
+        const res = await fetch('/api/v1/gateway-groups');
+        if (res.ok) {
+            const data = await res.json();
+            setGroups(data.data || []);
+        }
+    };
+
+    const handleGroupsChanged = () => {
+        fetchGroups();
+        onGroupsChanged();
+    };
+
     const fetchSkus = async () => {
         setLoadingSkus(true);
         try {
@@ -106,18 +223,82 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
         if (!validateCIDR(clientCIDR)) return;
 
         setLoading(true);
-        const nodeId = await onCreate(newNodeName, selectedSkuId, clientCIDR);
+        const enrollment = await onCreate(newNodeName, selectedSkuId, clientCIDR);
+        setLoading(false);
+        if (enrollment) {
+            setCreated(enrollment);
+        }
+    };
+
+    const handleIssueToken = async () => {
+        if (!viewNode) return;
+        setLoading(true);
+        const enrollment = await onIssueToken(viewNode.id);
+        setLoading(false);
+        if (enrollment) {
+            setViewEnrollment(enrollment);
+        }
+    };
+
+    const handleResetEnrollment = async () => {
+        if (!viewNode) return;
+        setLoading(true);
+        const enrollment = await onResetEnrollment(viewNode.id);
+        setLoading(false);
+        if (enrollment) {
+            setViewEnrollment(enrollment);
+        }
+    };
+
+    const handleHardwareChange = async (approve: boolean) => {
+        if (!viewNode) return;
+        setLoading(true);
+        await onHardwareChange(viewNode.id, approve);
+        setLoading(false);
+        closeViewNode();
+    };
+
+    const handleSetGroup = async (groupId: string) => {
+        if (!viewNode) return;
+        setLoading(true);
+        if (await onSetGroup(viewNode.id, groupId)) {
+            setViewNode({ ...viewNode, gateway_group_id: groupId || undefined });
+            fetchGroups();
+        }
         setLoading(false);
-        if (nodeId) {
-            setCreatedNodeId(nodeId);
+    };
+
+    useEffect(() => {
+        setEgressMode(viewNode?.egress_mode || 'masquerade');
+        setSnatPools((viewNode?.snat_pools || []).map(p => `${p.destination}=${p.source}`).join('\n'));
+    }, [viewNode?.id]);
+
+    const handleSetEgress = async () => {
+        if (!viewNode) return;
+        const pools = egressMode === 'snat'
+            ? snatPools.split('\n').map(l => l.trim()).filter(Boolean).map(l => {
+                const [destination, source = ''] = l.split('=');
+                return { destination: destination.trim(), source: source.trim() };
+            })
+            : [];
+        setLoading(true);
+        const updated = await onSetEgress(viewNode.id, egressMode, pools);
+        if (updated) {
+            setViewNode({ ...viewNode, egress_mode: egressMode, snat_pools: pools, return_routes: updated.return_routes });
         }
+        setLoading(false);
+    };
+
+    const closeViewNode = () => {
+        setViewNode(null);
+        setViewEnrollment(null);
     };
 
     const handleClose = () => {
         setShowDialog(false);
         setNewNodeName('');
         setSelectedSkuId(null);
-        setCreatedNodeId(null);
+        setCreated(null);
         setPage(0);
         setSearchQuery('');
         setClientCIDR('10.8.0.0/23');
@@ -145,21 +326,33 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
                         Manage your edge gateways and connectors.
                     </Typography>
                 </Box>
-                <Button
-                    variant="contained"
-                    startIcon={<AddIcon />}
-                    onClick={() => setShowDialog(true)}
-                    sx={{
-                        bgcolor: '#1a73e8',
-                        borderRadius: 2,
-                        px: 3,
-                        py: 1,
-                        fontWeight: 700,
-                        textTransform: 'none'
-                    }}
-                >
-                    Register Gateway
-                </Button>
+                <Box sx={{ display: 'flex', gap: 1 }}>
+                    <Button
+                        variant="outlined"
+                        startIcon={<HubIcon />}
+                        onClick={() => setShowGroups(true)}
+                        sx={{ borderRadius: 2, px: 3, py: 1, fontWeight: 700, textTransform: 'none' }}
+                    >
+                        Groups
+                    </Button>
+                    {canWrite && (
+                        <Button
+                            variant="contained"
+                            startIcon={<AddIcon />}
+                            onClick={() => setShowDialog(true)}
+                            sx={{
+                                bgcolor: '#1a73e8',
+                                borderRadius: 2,
+                                px: 3,
+                                py: 1,
+                                fontWeight: 700,
+                                textTransform: 'none'
+                            }}
+                        >
+                            Register Gateway
+                        </Button>
+                    )}
+                </Box>
             </Box>
 
             {isMobile ? (
@@ -170,13 +363,10 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
                                 <Box>
                                     <Typography variant="body1" sx={{ fontWeight: 700 }}>{node.name}</Typography>
                                     <Typography variant="body2" color="text.secondary" sx={{ fontSize: '0.8rem' }}>{node.hostname}</Typography>
+                                    {node.gateway_group && <Chip icon={<HubIcon />} label={node.gateway_group.name} size="small" variant="outlined" sx={{ mt: 0.5, height: 22, fontSize: '0.7rem' }} />}
+                                    {node.connector && <Chip label="Connector" size="small" variant="outlined" sx={{ mt: 0.5, ml: node.gateway_group ? 0.5 : 0, height: 22, fontSize: '0.7rem' }} />}
                                 </Box>
-                                <Chip
-                                    label={node.status}
-                                    size="small"
-                                    color={node.status === 'ONLINE' ? 'success' : 'default'}
-                                    sx={{ borderRadius: 1.5, fontWeight: 700, height: 24, fontSize: '0.7rem' }}
-                                />
+                                <NodeStatus node={node} />
                             </Box>
 
                             <Box sx={{ display: 'flex', gap: 2, color: 'text.secondary', fontSize: '0.8rem' }}>
@@ -223,9 +413,16 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
                                 >
                                     Connect
                                 </Button>
-                                <IconButton onClick={() => onDelete(node.id)} size="small" color="error" sx={{ border: '1px solid #ffcdd2' }}>
-                                    <DeleteIcon fontSize="small" />
-                                </IconButton>
+                                {canSessions && (
+                                    <IconButton onClick={() => setSessionsNode(node)} size="small" sx={{ border: '1px solid #dadce0' }}>
+                                        <PeopleIcon fontSize="small" />
+                                    </IconButton>
+                                )}
+                                {canDelete && (
+                                    <IconButton onClick={() => onDelete(node.id)} size="small" color="error" sx={{ border: '1px solid #ffcdd2' }}>
+                                        <DeleteIcon fontSize="small" />
+                                    </IconButton>
+                                )}
                             </Box>
                         </Paper>
                     ))}
@@ -255,15 +452,16 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
                                         <Box>
                                             <Typography variant="body2" sx={{ fontWeight: 600 }}>{node.name}</Typography>
                                             <Typography variant="caption" color="text.secondary">{node.hostname}</Typography>
+                                            {node.gateway_group && (
+                                                <Box><Chip icon={<HubIcon />} label={node.gateway_group.name} size="small" variant="outlined" sx={{ mt: 0.5, height: 22, fontSize: '0.7rem' }} /></Box>
+                                            )}
+                                            {node.connector && (
+                                                <Box><Chip label="Connector" size="small" variant="outlined" sx={{ mt: 0.5, height: 22, fontSize: '0.7rem' }} /></Box>
+                                            )}
                                         </Box>
                                     </TableCell>
                                     <TableCell>
-                                        <Chip
-                                            label={node.status}
-                                            size="small"
-                                            color={node.status === 'ONLINE' ? 'success' : 'default'}
-                                            sx={{ borderRadius: 1.5, fontWeight: 700, height: 24, fontSize: '0.7rem' }}
-                                        />
+                                        <NodeStatus node={node} />
                                     </TableCell>
 
                                     {!isSmallMobile && <TableCell sx={{ fontFamily: 'monospace', fontSize: '0.85rem' }}>{node.ip_address || '-'}</TableCell>}
@@ -298,9 +496,16 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
                                             >
                                                 Connect
                                             </Button>
-                                            <IconButton onClick={() => onDelete(node.id)} size="small" color="error">
-                                                <DeleteIcon fontSize="small" />
-                                            </IconButton>
+                                            {canSessions && (
+                                                <IconButton onClick={() => setSessionsNode(node)} size="small" title="Active Sessions">
+                                                    <PeopleIcon fontSize="small" />
+                                                </IconButton>
+                                            )}
+                                            {canDelete && (
+                                                <IconButton onClick={() => onDelete(node.id)} size="small" color="error">
+                                                    <DeleteIcon fontSize="small" />
+                                                </IconButton>
+                                            )}
                                         </Box>
                                     </TableCell>
                                 </TableRow>
@@ -333,7 +538,7 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
                     Register New Gateway
                 </DialogTitle>
                 <DialogContent sx={{ p: isMobile ? 3 : 4 }}>
-                    {!createdNodeId ? (
+                    {!created ? (
                         <>
                             <Box sx={{ mb: 4 }}>
                                 <Typography variant="subtitle2" sx={{ fontWeight: 700, mb: 1 }}>Gateway Name</Typography>
@@ -469,49 +674,7 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
                                 Setup Instructions
                             </Typography>
 
-                            <Box sx={{ mb: 3 }}>
-                                <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
-                                    1. Copy your Node ID
-                                </Typography>
-                                <Paper variant="outlined" sx={{ p: 2, bgcolor: '#f8f9fa', borderRadius: 2, fontFamily: 'monospace', display: 'flex', justifyContent: 'space-between', alignItems: 'center', border: '1px solid #dadce0' }}>
-                                    <span style={{ wordBreak: 'break-all', fontWeight: 600, color: '#202124' }}>{createdNodeId}</span>
-                                    <Button
-                                        size="small"
-                                        sx={{ textTransform: 'none', fontWeight: 700 }}
-                                        onClick={() => navigator.clipboard.writeText(createdNodeId!)}
-                                    >
-                                        Copy
-                                    </Button>
-                                </Paper>
-                            </Box>
-
-                            <Box sx={{ mb: 3 }}>
-                                <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
-                                    2. Run the Gateway Registration Command
-                                </Typography>
-                                <Paper variant="outlined" sx={{ p: 2, bgcolor: '#202124', color: '#e8eaed', borderRadius: 2, fontFamily: 'Google Sans Mono, monospace', fontSize: '0.85rem' }}>
-                                    <Box sx={{ mb: 1, userSelect: 'none', color: '#9aa0a6' }}>
-                                        # Run this temporarily to test connection
-                                    </Box>
-                                    <div style={{ wordBreak: 'break-all', lineHeight: 1.5 }}>
-                                        ./gateway --node-id "{createdNodeId}"
-                                    </div>
-                                </Paper>
-                            </Box>
-
-                            <Box sx={{ mb: 3 }}>
-                                <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
-                                    3. Install as Background Service
-                                </Typography>
-                                <Paper variant="outlined" sx={{ p: 2, bgcolor: '#202124', color: '#e8eaed', borderRadius: 2, fontFamily: 'Google Sans Mono, monospace', fontSize: '0.85rem' }}>
-                                    <Box sx={{ mb: 1, userSelect: 'none', color: '#9aa0a6' }}>
-                                        # Install and start as a system service
-                                    </Box>
-                                    <div style={{ wordBreak: 'break-all', lineHeight: 1.5 }}>
-                                        sudo ./gateway --install-service --node-id "{createdNodeId}"
-                                    </div>
-                                </Paper>
-                            </Box>
+                            <EnrollmentSteps enrollment={created} />
 
                             <Alert severity="info" sx={{ borderRadius: 2, bgcolor: '#e8f0fe', color: '#174ea6', '& .MuiAlert-icon': { color: '#1967d2' } }}>
                                 The gateway status will update to <Box component="span" sx={{ fontWeight: 700 }}>Online</Box> once connected.
@@ -520,8 +683,8 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
                     )}
                 </DialogContent>
                 <DialogActions sx={{ p: 3, px: 4, bgcolor: '#f8f9fa', borderTop: '1px solid #f1f3f4' }}>
-                    <Button onClick={handleClose} sx={{ fontWeight: 600, color: '#5f6368' }}>{createdNodeId ? 'Close' : 'Cancel'}</Button>
-                    {!createdNodeId && (
+                    <Button onClick={handleClose} sx={{ fontWeight: 600, color: '#5f6368' }}>{created ? 'Close' : 'Cancel'}</Button>
+                    {!created && (
                         <Button
                             onClick={handleCreate}
                             variant="contained"
@@ -539,7 +702,7 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
             <Dialog
                 open={!!viewNode}
                 fullScreen={isMobile}
-                onClose={() => setViewNode(null)}
+                onClose={closeViewNode}
                 maxWidth="md"
                 fullWidth
                 PaperProps={{
@@ -551,58 +714,190 @@ const NodesView: React.FC<NodesViewProps> = ({ nodes, onCreate, onDelete }) => {
                     Setup Instructions: {viewNode?.name}
                 </DialogTitle>
                 <DialogContent sx={{ p: isMobile ? 3 : 4 }}>
-                    <Alert severity="info" sx={{ mb: 4, borderRadius: 2 }}>
-                        Follow these instructions to connect your gateway to the Tridorian control plane.
-                    </Alert>
-
-                    <Box sx={{ mb: 3 }}>
-                        <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
-                            1. Node ID
-                        </Typography>
-                        <Paper variant="outlined" sx={{ p: 2, bgcolor: '#f8f9fa', borderRadius: 2, fontFamily: 'monospace', display: 'flex', justifyContent: 'space-between', alignItems: 'center', border: '1px solid #dadce0' }}>
-                            <span style={{ wordBreak: 'break-all', fontWeight: 600, color: '#202124' }}>{viewNode?.id}</span>
-                            <Button
-                                size="small"
-                                sx={{ textTransform: 'none', fontWeight: 700 }}
-                                onClick={() => viewNode && navigator.clipboard.writeText(viewNode.id)}
-                            >
-                                Copy
-                            </Button>
-                        </Paper>
-                    </Box>
-
-                    <Box sx={{ mb: 3 }}>
-                        <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
-                            2. Run the Gateway Registration Command
-                        </Typography>
-                        <Paper variant="outlined" sx={{ p: 2, bgcolor: '#202124', color: '#e8eaed', borderRadius: 2, fontFamily: 'Google Sans Mono, monospace', fontSize: '0.85rem' }}>
-                            <Box sx={{ mb: 1, userSelect: 'none', color: '#9aa0a6' }}>
-                                # Run this temporarily to test connection
+                    {viewEnrollment ? (
+                        <EnrollmentSteps enrollment={viewEnrollment} />
+                    ) : viewNode?.enrolled_at ? (
+                        <>
+                            <Alert severity="success" sx={{ mb: 4, borderRadius: 2 }}>
+                                This gateway enrolled on {new Date(viewNode.enrolled_at).toLocaleString()}
+                                {viewNode.cert_expires_at && <>. Its certificate is valid until {new Date(viewNode.cert_expires_at).toLocaleString()} and is renewed automatically</>}.
+                            </Alert>
+                            <Box sx={{ mb: 3 }}>
+                                <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
+                                    Install as Background Service
+                                </Typography>
+                                <CommandBox comment="Run on the enrolled gateway to install and start it as a system service" command="sudo ./gateway --install-service" />
                             </Box>
-                            <div style={{ wordBreak: 'break-all', lineHeight: 1.5 }}>
-                                ./gateway --node-id "{viewNode?.id}"
-                            </div>
-                        </Paper>
-                    </Box>
-
-                    <Box sx={{ mb: 3 }}>
-                        <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
-                            3. Install as Background Service
-                        </Typography>
-                        <Paper variant="outlined" sx={{ p: 2, bgcolor: '#202124', color: '#e8eaed', borderRadius: 2, fontFamily: 'Google Sans Mono, monospace', fontSize: '0.85rem' }}>
-                            <Box sx={{ mb: 1, userSelect: 'none', color: '#9aa0a6' }}>
-                                # Install and start as a system service
+                            {viewNode.pending_device_hash && (
+                                <Alert
+                                    severity="warning"
+                                    sx={{ mb: 3, borderRadius: 2 }}
+                                    action={canDelete && (
+                                        <Box sx={{ display: 'flex', gap: 1 }}>
+                                            <Button color="inherit" size="small" disabled={loading} onClick={() => handleHardwareChange(false)} sx={{ fontWeight: 700, textTransform: 'none' }}>
+                                                Reject
+                                            </Button>
+                                            <Button color="inherit" size="small" disabled={loading} onClick={() => handleHardwareChange(true)} sx={{ fontWeight: 700, textTransform: 'none' }}>
+                                                Approve
+                                            </Button>
+                                        </Box>
+                                    )}
+                                >
+                                    The gateway connected from different hardware
+                                    {viewNode.pending_device_ip && <> at {viewNode.pending_device_ip}</>}
+                                    {viewNode.pending_device_at && <> on {new Date(viewNode.pending_device_at).toLocaleString()}</>} and
+                                    is refused until the change is approved. Rejecting it revokes the gateway's certificate.
+                                </Alert>
+                            )}
+                            <Box sx={{ mb: 3 }}>
+                                <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
+                                    Advertised Subnets
+                                </Typography>
+                                <Typography variant="body2" color="text.secondary" sx={{ mb: viewNode.advertised_routes?.length ? 1 : 2 }}>
+                                    Clients of the tenant's other gateways reach these subnets through this one. Set them with{' '}
+                                    <Box component="code" sx={{ fontFamily: 'monospace' }}>--advertise-routes</Box> on the gateway, and add{' '}
+                                    <Box component="code" sx={{ fontFamily: 'monospace' }}>--connector</Box> for a gateway inside a private network
+                                    without inbound ports: it then connects out to the other gateways and takes no clients itself.
+                                </Typography>
+                                <Box sx={{ display: 'flex', flexWrap: 'wrap', gap: 1 }}>
+                                    {(viewNode.advertised_routes || []).map(r => (
+                                        <Chip key={r} label={r} size="small" variant="outlined" sx={{ fontFamily: 'monospace' }} />
+                                    ))}
+                                </Box>
                             </Box>
-                            <div style={{ wordBreak: 'break-all', lineHeight: 1.5 }}>
-                                sudo ./gateway --install-service --node-id "{viewNode?.id}"
-                            </div>
-                        </Paper>
-                    </Box>
+                            {canDelete && (
+                                <Box sx={{ mb: 3 }}>
+                                    <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
+                                        Gateway Group
+                                    </Typography>
+                                    <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                                        Clients connecting to a group fail over between its gateways.
+                                    </Typography>
+                                    <TextField
+                                        select
+                                        size="small"
+                                        sx={{ minWidth: 260 }}
+                                        value={viewNode.gateway_group_id || ''}
+                                        disabled={loading}
+                                        onChange={(e) => handleSetGroup(e.target.value)}
+                                    >
+                                        <MenuItem value="">None</MenuItem>
+                                        {groups.map(g => (
+                                            <MenuItem key={g.id} value={g.id}>{g.name}</MenuItem>
+                                        ))}
+                                    </TextField>
+                                </Box>
+                            )}
+                            {canDelete && (
+                                <Box sx={{ mb: 3 }}>
+                                    <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
+                                        Egress
+                                    </Typography>
+                                    <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                                        {egressMode === 'routed'
+                                            ? <>Applications see the users' addresses. Your network must route {viewNode.egress_mode === 'routed' && viewNode.return_routes?.length
+                                                ? viewNode.return_routes.join(', ')
+                                                : viewNode.gateway_group?.client_cidr || viewNode.client_cidr || 'the client CIDR'} to this gateway.</>
+                                            : egressMode === 'snat'
+                                                ? <>Traffic to each destination leaves from its source addresses, one <Box component="code" sx={{ fontFamily: 'monospace' }}>destination=source</Box> per line; the rest from the gateway's address.</>
+                                                : <>Traffic leaves from the gateway's address.</>}
+                                    </Typography>
+                                    <Box sx={{ display: 'flex', gap: 2, alignItems: 'flex-start', flexWrap: 'wrap' }}>
+                                        <TextField
+                                            select
+                                            size="small"
+                                            sx={{ minWidth: 200 }}
+                                            value={egressMode}
+                                            disabled={loading}
+                                            onChange={(e) => setEgressMode(e.target.value)}
+                                        >
+                                            <MenuItem value="masquerade">Masquerade</MenuItem>
+                                            <MenuItem value="routed">Routed</MenuItem>
+                                            <MenuItem value="snat">SNAT pools</MenuItem>
+                                        </TextField>
+                                        {egressMode === 'snat' && (
+                                            <TextField
+                                                multiline
+                                                minRows={2}
+                                                size="small"
+                                                sx={{ flex: 1, minWidth: 260 }}
+                                                placeholder="10.1.0.0/16=192.0.2.10-192.0.2.20"
+                                                value={snatPools}
+                                                disabled={loading}
+                                                onChange={(e) => setSnatPools(e.target.value)}
+                                                InputProps={{ sx: { fontFamily: 'monospace' } }}
+                                            />
+                                        )}
+                                        <Button
+                                            variant="outlined"
+                                            onClick={handleSetEgress}
+                                            disabled={loading}
+                                            sx={{ borderRadius: 2, fontWeight: 700, textTransform: 'none' }}
+                                        >
+                                            Save
+                                        </Button>
+                                    </Box>
+                                </Box>
+                            )}
+                            {canDelete && (
+                                <Box>
+                                    <Typography variant="body2" sx={{ mb: 1, fontWeight: 600, color: '#5f6368' }}>
+                                        Rebuilt or Replaced Gateway
+                                    </Typography>
+                                    <Typography variant="body2" color="text.secondary" sx={{ mb: 2 }}>
+                                        Resetting the enrollment revokes the gateway's certificate and hardware binding and
+                                        generates a new enrollment token to enroll it again.
+                                    </Typography>
+                                    <Button
+                                        variant="outlined"
+                                        color="error"
+                                        onClick={handleResetEnrollment}
+                                        disabled={loading}
+                                        sx={{ borderRadius: 2, fontWeight: 700, textTransform: 'none' }}
+                                    >
+                                        {loading ? 'Resetting...' : 'Reset Enrollment'}
+                                    </Button>
+                                </Box>
+                            )}
+                        </>
+                    ) : (
+                        <>
+                            <Alert severity="info" sx={{ mb: 4, borderRadius: 2 }}>
+                                This gateway has not enrolled yet. Its enrollment token is shown only once, when it is generated: generate a new one to connect the gateway to the Tridorian control plane.
+                            </Alert>
+                            {canDelete && (
+                                <Button
+                                    variant="contained"
+                                    onClick={handleIssueToken}
+                                    disabled={loading}
+                                    disableElevation
+                                    sx={{ borderRadius: 2, fontWeight: 700, textTransform: 'none' }}
+                                >
+                                    {loading ? 'Generating...' : 'Generate Enrollment Token'}
+                                </Button>
+                            )}
+                        </>
+                    )}
                 </DialogContent>
                 <DialogActions sx={{ p: 3, bgcolor: '#f8f9fa', borderTop: '1px solid #f1f3f4' }}>
-                    <Button onClick={() => setViewNode(null)} sx={{ fontWeight: 600 }}>Close</Button>
+                    <Button onClick={closeViewNode} sx={{ fontWeight: 600 }}>Close</Button>
                 </DialogActions>
             </Dialog>
+
+            <GatewayGroupsDialog
+                open={showGroups}
+                groups={groups}
+                canWrite={canWrite}
+                onClose={() => setShowGroups(false)}
+                onChanged={handleGroupsChanged}
+            />
+
+            <SessionsDialog
+                node={sessionsNode}
+                canRevoke={can(grant, 'sessions:revoke')}
+                allNodes={!grant?.node_ids?.length}
+                onClose={() => setSessionsNode(null)}
+            />
         </Box >
     );
 };
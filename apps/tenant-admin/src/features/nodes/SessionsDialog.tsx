@@ -0,0 +1,105 @@
+import React, { useState, useEffect } from 'react';
+import {
+    Box, Typography, Button, Dialog, DialogTitle, DialogContent, DialogActions,
+    Table, TableHead, TableRow, TableCell, TableBody, Alert, CircularProgress
+} from '@mui/material';
+import { People as PeopleIcon } from '@mui/icons-material';
+import { Node, NodeSession } from '../../types';
+
+interface SessionsDialogProps {
+    node: Node | null;
+    canRevoke: boolean;
+    allNodes: boolean; // May end a user's sessions on every gateway, not only this one
+    onClose: () => void;
+}
+
+// SessionsDialog lists the users connected to a gateway and lets helpdesk
+// staff end their sessions.
+const SessionsDialog: React.FC<SessionsDialogProps> = ({ node, canRevoke, allNodes, onClose }) => {
+    const [sessions, setSessions] = useState<NodeSession[]>([]);
+    const [loading, setLoading] = useState(false);
+    const [message, setMessage] = useState<{ type: 'success' | 'error'; text: string } | null>(null);
+
+    const fetchSessions = async () => {
+        if (!node) return;
+        setLoading(true);
+        const res = await fetch(`/api/v1/nodes/sessions?node_id=${node.id}`);
+        const data = await res.json();
+        setSessions(data.success ? data.data || [] : []);
+        setLoading(false);
+    };
+
+    useEffect(() => {
+        setMessage(null);
+        fetchSessions();
+    }, [node?.id]);
+
+    const handleRevoke = async (email: string, everywhere: boolean) => {
+        const scope = everywhere ? 'on every gateway and sign them out of the client' : `on ${node?.name}`;
+        if (!confirm(`End the sessions of ${email} ${scope}?`)) return;
+        const res = await fetch('/api/v1/sessions/revoke', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ email, node_id: everywhere ? undefined : node?.id })
+        });
+        const data = await res.json();
+        setMessage(data.success
+            ? { type: 'success', text: `Sessions of ${email} end at the gateway's next configuration update.` }
+            : { type: 'error', text: data.error || 'Failed to end the session' });
+    };
+
+    return (
+        <Dialog open={!!node} onClose={onClose} fullWidth maxWidth="md" PaperProps={{ sx: { borderRadius: 3 } }}>
+            <DialogTitle sx={{ fontWeight: 800, display: 'flex', alignItems: 'center', gap: 2 }}>
+                <PeopleIcon color="primary" />
+                Active Sessions: {node?.name}
+            </DialogTitle>
+            <DialogContent>
+                {message && <Alert severity={message.type} sx={{ mb: 2, borderRadius: 2 }}>{message.text}</Alert>}
+                {loading ? (
+                    <Box sx={{ display: 'flex', justifyContent: 'center', py: 4 }}><CircularProgress /></Box>
+                ) : sessions.length === 0 ? (
+                    <Typography variant="body2" color="text.secondary" sx={{ py: 4, textAlign: 'center' }}>No users are connected to this gateway.</Typography>
+                ) : (
+                    <Table size="small">
+                        <TableHead>
+                            <TableRow>
+                                <TableCell sx={{ fontWeight: 700 }}>User</TableCell>
+                                <TableCell sx={{ fontWeight: 700 }}>Tunnel IP</TableCell>
+                                <TableCell sx={{ fontWeight: 700 }}>Connected</TableCell>
+                                {canRevoke && <TableCell align="right" sx={{ fontWeight: 700 }}>Actions</TableCell>}
+                            </TableRow>
+                        </TableHead>
+                        <TableBody>
+                            {sessions.map(s => (
+                                <TableRow key={s.user_id}>
+                                    <TableCell>{s.user_email}</TableCell>
+                                    <TableCell sx={{ fontFamily: 'monospace' }}>{s.ip_address}</TableCell>
+                                    <TableCell>{new Date(s.connected_at * 1000).toLocaleString()}</TableCell>
+                                    {canRevoke && (
+                                        <TableCell align="right">
+                                            <Button size="small" color="error" onClick={() => handleRevoke(s.user_email, false)} sx={{ textTransform: 'none' }}>
+                                                End here
+                                            </Button>
+                                            {allNodes && (
+                                                <Button size="small" color="error" onClick={() => handleRevoke(s.user_email, true)} sx={{ textTransform: 'none' }}>
+                                                    End everywhere
+                                                </Button>
+                                            )}
+                                        </TableCell>
+                                    )}
+                                </TableRow>
+                            ))}
+                        </TableBody>
+                    </Table>
+                )}
+            </DialogContent>
+            <DialogActions sx={{ p: 2 }}>
+                <Button onClick={fetchSessions} sx={{ fontWeight: 600 }}>Refresh</Button>
+                <Button onClick={onClose} sx={{ fontWeight: 600 }}>Close</Button>
+            </DialogActions>
+        </Dialog>
+    );
+};
+
+export default SessionsDialog;
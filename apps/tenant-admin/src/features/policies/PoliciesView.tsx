@@ -612,10 +612,12 @@ const PoliciesView: React.FC<PoliciesViewProps> = ({ policies, onRefresh }) => {
         name: string;
         priority: number;
         effect: 'allow' | 'deny';
-        destination_type: 'cidr' | 'app' | 'sni';
+        destination_type: 'cidr' | 'app' | 'app_tag' | 'sni' | 'fqdn';
         destination_cidr: string;
         destination_app_id: string;
+        destination_app_tag: string;
         destination_sni: string;
+        destination_fqdn: string;
         root_node: PolicyNode;
         node_ids: string[];
     }>({
@@ -625,7 +627,9 @@ const PoliciesView: React.FC<PoliciesViewProps> = ({ policies, onRefresh }) => {
         destination_type: 'cidr',
         destination_cidr: '',
         destination_app_id: '',
+        destination_app_tag: '',
         destination_sni: '',
+        destination_fqdn: '',
         root_node: { operator: 'AND', children: [] },
         node_ids: []
     });
@@ -700,7 +704,9 @@ const PoliciesView: React.FC<PoliciesViewProps> = ({ policies, onRefresh }) => {
                 destination_type: policy.destination_type || 'cidr',
                 destination_cidr: policy.destination_cidr || '',
                 destination_app_id: policy.destination_app_id || '',
+                destination_app_tag: policy.destination_app_tag || '',
                 destination_sni: policy.destination_sni || '',
+                destination_fqdn: policy.destination_fqdn || '',
                 root_node: policy.root_node || { operator: 'AND', children: [] },
                 node_ids: policy.nodes ? policy.nodes.map(n => n.id) : []
             });
@@ -713,7 +719,9 @@ const PoliciesView: React.FC<PoliciesViewProps> = ({ policies, onRefresh }) => {
                 destination_type: 'cidr',
                 destination_cidr: '',
                 destination_app_id: '',
+                destination_app_tag: '',
                 destination_sni: '',
+                destination_fqdn: '',
                 root_node: { operator: 'AND', children: [] },
                 node_ids: []
             });
@@ -969,6 +977,15 @@ const PoliciesView: React.FC<PoliciesViewProps> = ({ policies, onRefresh }) => {
                                                 {(!policy.destination_type || policy.destination_type === 'none') && (
                                                     <Typography variant="body2" sx={{ fontWeight: 600 }}>All Network Traffic</Typography>
                                                 )}
+                                                {policy.destination_type === 'fqdn' && (
+                                                    <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
+                                                        <DnsIcon fontSize="small" color="action" />
+                                                        <Box>
+                                                            <Typography variant="caption" display="block" color="text.secondary">Domain</Typography>
+                                                            <Typography variant="body2" sx={{ fontFamily: 'monospace', fontWeight: 600 }}>{policy.destination_fqdn}</Typography>
+                                                        </Box>
+                                                    </Box>
+                                                )}
                                                 {policy.destination_type === 'app' && (
                                                     <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
                                                         <DnsIcon fontSize="small" color="action" />
@@ -978,6 +995,15 @@ const PoliciesView: React.FC<PoliciesViewProps> = ({ policies, onRefresh }) => {
                                                         </Box>
                                                     </Box>
                                                 )}
+                                                {policy.destination_type === 'app_tag' && (
+                                                    <Box sx={{ display: 'flex', alignItems: 'center', gap: 1 }}>
+                                                        <DnsIcon fontSize="small" color="action" />
+                                                        <Box>
+                                                            <Typography variant="caption" display="block" color="text.secondary">Applications tagged</Typography>
+                                                            <Typography variant="body2" sx={{ fontFamily: 'monospace', fontWeight: 600 }}>{policy.destination_app_tag}</Typography>
+                                                        </Box>
+                                                    </Box>
+                                                )}
                                             </Box>
                                         </Box>
                                     </Grid>
@@ -1161,7 +1187,9 @@ const PoliciesView: React.FC<PoliciesViewProps> = ({ policies, onRefresh }) => {
                                     >
                                         <MenuItem value="cidr">Network CIDR</MenuItem>
                                         <MenuItem value="app">Application</MenuItem>
+                                        <MenuItem value="app_tag">Applications by Tag</MenuItem>
                                         <MenuItem value="sni">SNI (Server Name Indication)</MenuItem>
+                                        <MenuItem value="fqdn">Domain (FQDN / Wildcard)</MenuItem>
                                     </TextField>
                                 </Grid>
 
@@ -1214,11 +1242,25 @@ const PoliciesView: React.FC<PoliciesViewProps> = ({ policies, onRefresh }) => {
                                             isOptionEqualToValue={(option, value) => option.id === value.id}
                                         />
                                         <Typography variant="caption" color="text.secondary" sx={{ ml: 1, mt: 0.5, display: 'block' }}>
-                                            Applications are pre-defined with multiple CIDRs. Manage applications in the Applications section.
+                                            Applications bundle networks, host names and ports. Manage applications in the Applications section.
                                         </Typography>
                                     </Grid>
                                 )}
 
+                                {formData.destination_type === 'app_tag' && (
+                                    <Grid size={12}>
+                                        <TextField
+                                            fullWidth
+                                            label="Application Tag"
+                                            value={formData.destination_app_tag}
+                                            onChange={(e) => setFormData({ ...formData, destination_app_tag: e.target.value })}
+                                            placeholder="e.g. engineering"
+                                            helperText="Applies to every application carrying this tag, including ones added later."
+                                            sx={{ '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
+                                        />
+                                    </Grid>
+                                )}
+
                                 {formData.destination_type === 'sni' && (
                                     <Grid size={12}>
                                         <TextField
@@ -1231,6 +1273,20 @@ const PoliciesView: React.FC<PoliciesViewProps> = ({ policies, onRefresh }) => {
                                         />
                                     </Grid>
                                 )}
+
+                                {formData.destination_type === 'fqdn' && (
+                                    <Grid size={12}>
+                                        <TextField
+                                            fullWidth
+                                            label="Domains"
+                                            value={formData.destination_fqdn}
+                                            onChange={(e) => setFormData({ ...formData, destination_fqdn: e.target.value })}
+                                            placeholder="e.g. jira.example.com, *.corp.internal"
+                                            helperText="Comma separated. Resolved by the gateway; wildcards are learned from DNS answers on the tunnel."
+                                            sx={{ '& .MuiOutlinedInput-root': { borderRadius: 3 } }}
+                                        />
+                                    </Grid>
+                                )}
                             </Grid>
                         </Grid>
 
@@ -29,11 +29,14 @@ import {
     VpnKey as VpnKeyIcon,
     VerifiedUser as VerifiedUserIcon,
     Apps as AppsIcon,
+    Fingerprint as FingerprintIcon,
+    History as HistoryIcon,
     Menu as MenuIcon,
     Logout as LogoutIcon
 } from '@mui/icons-material';
 import { theme } from '../theme/theme';
 import { Tenant, User } from '../types';
+import { can, roleLabels } from '../types/permissions';
 
 const drawerWidth = 260;
 
@@ -85,14 +88,16 @@ const DashboardLayout: React.FC<DashboardLayoutProps> = ({ children, view, setVi
     };
 
     const navItems = [
-        { id: 'dashboard', label: 'Dashboard', icon: <DashboardIcon />, roles: ['super_admin', 'admin', 'policy_admin'] },
-        { id: 'signin_policies', label: 'Sign-in Policies', icon: <VpnKeyIcon />, roles: ['super_admin', 'admin', 'policy_admin'] },
-        { id: 'access_policies', label: 'Access Policies', icon: <VerifiedUserIcon />, roles: ['super_admin', 'admin', 'policy_admin'] },
-        { id: 'applications', label: 'Applications', icon: <AppsIcon />, roles: ['super_admin', 'admin'] },
-        { id: 'nodes', label: 'Gateways', icon: <CloudIcon />, roles: ['super_admin', 'admin'] },
-        { id: 'admins', label: 'Console Administrators', icon: <PeopleIcon />, roles: ['super_admin'] },
-        { id: 'settings', label: 'Settings', icon: <SettingsIcon />, roles: ['super_admin', 'admin'] },
-    ].filter(item => !user || item.roles.includes(user.role));
+        { id: 'dashboard', label: 'Dashboard', icon: <DashboardIcon />, permission: '' },
+        { id: 'signin_policies', label: 'Sign-in Policies', icon: <VpnKeyIcon />, permission: 'policies:read' },
+        { id: 'access_policies', label: 'Access Policies', icon: <VerifiedUserIcon />, permission: 'policies:read' },
+        { id: 'applications', label: 'Applications', icon: <AppsIcon />, permission: 'applications:read' },
+        { id: 'nodes', label: 'Gateways', icon: <CloudIcon />, permission: 'nodes:read' },
+        { id: 'identity_providers', label: 'Identity Providers', icon: <FingerprintIcon />, permission: 'idp:read' },
+        { id: 'admins', label: 'Console Administrators', icon: <PeopleIcon />, permission: 'admins:read' },
+        { id: 'audit', label: 'Audit Log', icon: <HistoryIcon />, permission: 'audit:read' },
+        { id: 'settings', label: 'Settings', icon: <SettingsIcon />, permission: 'tenant:read' },
+    ].filter(item => !user || !item.permission || can(user.grant, item.permission));
 
     const drawerContent = (
         <Box sx={{ height: '100%', display: 'flex', flexDirection: 'column' }}>
@@ -241,7 +246,7 @@ const DashboardLayout: React.FC<DashboardLayoutProps> = ({ children, view, setVi
                                         Access Level
                                     </Typography>
                                     <Typography variant="body2" sx={{ fontWeight: 700, color: '#1a73e8', fontSize: '0.8125rem' }}>
-                                        {user?.role === 'super_admin' ? 'Super Administrator' : user?.role === 'admin' ? 'Administrator' : 'Policy Admin'}
+                                        {user ? roleLabels[user.role] : ''}
                                     </Typography>
                                 </Box>
                             </Box>
@@ -1,9 +1,53 @@
+export type BuiltinAdminRole = 'super_admin' | 'admin' | 'policy_admin' | 'helpdesk' | 'auditor';
+export type AdminRole = BuiltinAdminRole | 'custom';
+
+// "resource:action", either part may be "*"
+export type Permission = string;
+
+// What the signed-in administrator may do, from /api/v1/profile/permissions
+export interface AccessGrant {
+    role: AdminRole;
+    permissions: Permission[];
+    node_ids?: string[];
+    application_ids?: string[];
+}
+
 export interface User {
     id: string;
     email: string;
     name: string;
     change_password_required: boolean;
-    role: 'super_admin' | 'admin' | 'policy_admin';
+    role: AdminRole;
+    grant?: AccessGrant;
+}
+
+export interface Role {
+    id: string;
+    name: string;
+    description?: string;
+    permissions: Permission[];
+}
+
+// The role and optional scope given to an administrator
+export interface AdminAccess {
+    role: AdminRole;
+    role_id?: string | null;
+    node_ids: string[];
+    application_ids: string[];
+}
+
+export interface RolesResponse {
+    roles: Role[];
+    builtin: { role: BuiltinAdminRole; permissions: Permission[] }[];
+    permissions: Permission[];
+}
+
+export interface NodeSession {
+    user_id: string;
+    user_email: string;
+    ip_address: string;
+    connected_at: number;
+    device_id?: string;
 }
 
 export interface Tenant {
@@ -14,6 +58,69 @@ export interface Tenant {
     google_admin_email?: string;
     google_client_id?: string;
     free_domain_suffix?: string;
+    require_admin_mfa?: boolean;
+    password_min_length?: number;
+    password_require_complexity?: boolean;
+    gateway_hardware_approval?: boolean;
+    require_device_posture?: boolean;
+    device_approval?: boolean;
+}
+
+export interface AdminRoleMapping {
+    id?: string;
+    group: string;
+    role: BuiltinAdminRole;
+}
+
+export interface AdminSSOSettings {
+    enabled: boolean;
+    provider_id: string | null;
+    workspace_admin_role: '' | AdminRoleMapping['role'];
+    mappings: AdminRoleMapping[];
+}
+
+export interface LoginAttempt {
+    id: string;
+    realm: string;
+    email: string;
+    ip: string;
+    country?: string;
+    user_agent?: string;
+    reason: 'invalid_credentials' | 'invalid_mfa' | 'sso_required' | 'throttled' | 'locked';
+    created_at: string;
+}
+
+export interface AuditLogEntry {
+    id: string;
+    sequence: number;
+    created_at: string;
+    actor_type: 'admin' | 'backoffice' | 'system';
+    actor_id?: string;
+    actor_email?: string;
+    ip?: string;
+    user_agent?: string;
+    action: string;
+    resource_type: string;
+    resource_id?: string;
+    before?: unknown;
+    after?: unknown;
+    prev_hash: string;
+    hash: string;
+}
+
+export interface AuditLogPage {
+    entries: AuditLogEntry[];
+    total: number;
+    page: number;
+    page_size: number;
+}
+
+export interface AuditVerification {
+    valid: boolean;
+    entries: number;
+    head_hash?: string;
+    broken_at?: number;
+    reason?: string;
 }
 
 
@@ -21,12 +128,61 @@ export interface Application {
     id: string;
     name: string;
     description?: string;
+    owner?: string;
+    tags?: string;
+    ports?: string;
+    health_check?: string;
+    destinations?: ApplicationDestination[];
+    health?: ApplicationHealth[];
+}
+
+export interface IdentityProvider {
+    id: string;
+    name: string;
+    type: 'google' | 'oidc' | 'saml';
+    enabled: boolean;
+    is_default: boolean;
+    issuer_url?: string;
+    client_id?: string;
+    scopes?: string;
+    sso_url?: string;
+    entity_id?: string;
+    certificate?: string;
+    email_claim?: string;
+    groups_claim?: string;
 }
 
-export interface ApplicationCIDR {
+export interface SCIMToken {
     id: string;
-    application_id: string;
-    cidr: string;
+    name: string;
+    prefix: string;
+    created_at: string;
+    last_used_at?: string;
+}
+
+export interface DirectorySync {
+    status: 'never' | 'running' | 'succeeded' | 'failed' | string;
+    last_started_at?: string;
+    last_finished_at?: string;
+    last_succeeded_at?: string;
+    last_error?: string;
+    users?: number;
+    groups?: number;
+    changes?: number;
+}
+
+export interface ApplicationDestination {
+    id?: string;
+    type: 'cidr' | 'fqdn' | string;
+    value: string;
+}
+
+export interface ApplicationHealth {
+    node_id: string;
+    healthy: boolean;
+    latency_ms: number;
+    error?: string;
+    checked_at: number;
 }
 
 export interface AccessPolicy {
@@ -34,11 +190,13 @@ export interface AccessPolicy {
     name: string;
     effect: 'allow' | 'deny';
     priority: number;
-    destination_type?: 'cidr' | 'app' | 'sni';
+    destination_type?: 'cidr' | 'app' | 'app_tag' | 'sni' | 'fqdn';
     destination_cidr?: string;
     destination_app_id?: string;
     destination_app?: Application;
+    destination_app_tag?: string;
     destination_sni?: string;
+    destination_fqdn?: string;
     root_node?: PolicyNode;
     enabled?: boolean;
     nodes?: Node[];
@@ -76,11 +234,46 @@ export interface Node {
     gateway_version?: string;
     hostname: string;
     ip_address?: string;
-    auth_token?: string;
     client_cidr?: string;
     last_seen_at?: string;
     is_active?: boolean;
     node_sku?: NodeSku;
+    enrollment_expires_at?: string;
+    enrolled_at?: string;
+    cert_expires_at?: string;
+    // Changed hardware waiting for approval
+    pending_device_hash?: string;
+    pending_device_ip?: string;
+    pending_device_at?: string;
+    gateway_group_id?: string;
+    gateway_group?: GatewayGroup;
+    advertised_routes?: string[]; // Subnets served to other gateways' clients
+    peer_address?: string;
+    connector?: boolean; // Serves its subnets over tunnels it opens; takes no clients
+    egress_mode?: string; // 'masquerade', 'routed' or 'snat'
+    snat_pools?: SNATPool[];
+    return_routes?: string[]; // In the routed mode, CIDRs to route back to the gateway
+}
+
+// Source addresses client traffic to a destination CIDR is translated to
+export interface SNATPool {
+    destination: string;
+    source: string; // Address, CIDR or "first-last" range
+}
+
+// Gateways serving one site; clients fail over between them
+export interface GatewayGroup {
+    id: string;
+    name: string;
+    description?: string;
+    client_cidr?: string; // Shared by the members; each member's own when empty
+    nodes?: Node[];
+}
+
+// A node with the one-time token its gateway enrolls with
+export interface NodeEnrollment extends Node {
+    enrollment_token: string;
+    ca_fingerprint?: string;
 }
 
 export interface NodeSku {
@@ -96,5 +289,11 @@ export interface Admin {
     id: string;
     name: string;
     email: string;
-    role: 'super_admin' | 'admin' | 'policy_admin';
+    role: AdminRole;
+    role_id?: string;
+    custom_role?: Role;
+    node_ids?: string[];
+    application_ids?: string[];
+    break_glass?: boolean;
+    sso?: boolean;
 }
@@ -0,0 +1,23 @@
+import { AccessGrant, AdminRole, Permission } from './index';
+
+// allows mirrors models.Permission.Allows on the server
+const allows = (held: Permission, want: Permission): boolean => {
+    if (held === '*') return true;
+    const [hr, ha] = held.split(':');
+    const [wr, wa] = want.split(':');
+    return (hr === '*' || hr === wr) && (ha === '*' || ha === wa);
+};
+
+// can reports whether the grant includes the permission. The server enforces
+// the same check; this only hides what the administrator cannot use.
+export const can = (grant: AccessGrant | undefined, want: Permission): boolean =>
+    !!grant && grant.permissions.some(p => allows(p, want));
+
+export const roleLabels: Record<AdminRole, string> = {
+    super_admin: 'Super Administrator',
+    admin: 'Administrator',
+    policy_admin: 'Policy Administrator',
+    helpdesk: 'Helpdesk',
+    auditor: 'Auditor (Read Only)',
+    custom: 'Custom Role'
+};
@@ -8,6 +8,7 @@ import (
 	_ "embed"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -38,6 +39,13 @@ type App struct {
 	userEmail   string
 	isConnected bool
 
+	// Desktop sign-in
+	tokenLock    sync.Mutex
+	refreshLock  sync.Mutex // Held for a whole renewal, so only one runs at a time
+	authBase     string     // Auth API the user signed in with
+	refreshToken string
+	tokenExpiry  time.Time
+
 	// Session Lifecycle
 	lifecycleLock sync.Mutex
 	sessionCancel context.CancelFunc
@@ -52,10 +60,11 @@ type App struct {
 }
 
 type HandshakeResponse struct {
-	AssignedIP string   `json:"assigned_ip"`
-	GW_IP      string   `json:"gw_ip"`
-	Routes     []string `json:"routes"`
-	SessionKey string   `json:"session_key"`
+	AssignedIP string       `json:"assigned_ip"`
+	GW_IP      string       `json:"gw_ip"`
+	Routes     []string     `json:"routes"`
+	SessionKey string       `json:"session_key"`
+	DNS        *DNSSettings `json:"dns,omitempty"`
 }
 
 // NewApp creates a new App application struct
@@ -120,7 +129,21 @@ func (a *App) Greet(domain string) string {
 	if !strings.HasPrefix(target, "http") {
 		target = "http://" + target
 	}
-	authURL := fmt.Sprintf("%s/?desktop_port=%d&os=%s", target, port, runtime.GOOS)
+	// The redirect only carries a one-time code; the verifier proves this
+	// process started the sign-in when exchanging it
+	verifier, challenge, err := newPKCE()
+	if err != nil {
+		return "Error starting login: " + err.Error()
+	}
+	authURL := fmt.Sprintf("%s/?desktop_port=%d&os=%s&code_challenge=%s&code_challenge_method=S256", target, port, runtime.GOOS, challenge)
+
+	// Attest device posture so sign-in policies can evaluate a signed report
+	// instead of the self-declared OS. Login still proceeds without it.
+	if postureID, err := attestPosture(target); err != nil {
+		log.Printf("Posture attestation failed: %v", err)
+	} else {
+		authURL += "&posture_id=" + postureID
+	}
 
 	log.Printf("Opening browser: %s", authURL)
 	go browser.OpenURL(authURL)
@@ -131,20 +154,28 @@ func (a *App) Greet(domain string) string {
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/callback", func(w http.ResponseWriter, r *http.Request) {
-		token := r.URL.Query().Get("token")
-		email := r.URL.Query().Get("email")
-
-		if token != "" {
-			a.authToken = token
-			a.userEmail = email
-			// Serve embedded callback HTML page
-			w.Header().Set("Content-Type", "text/html; charset=utf-8")
-			w.Write([]byte(callbackHTML))
-			successChan <- fmt.Sprintf("Logged in as %s", email)
-		} else {
-			errChan <- fmt.Errorf("login failed: no token received")
+		code := r.URL.Query().Get("code")
+		if code == "" {
 			w.WriteHeader(http.StatusBadRequest)
+			errChan <- fmt.Errorf("login failed: no code received")
+			return
+		}
+
+		tokens, err := exchangeCode(target, code, verifier)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			errChan <- fmt.Errorf("login failed: %w", err)
+			return
 		}
+		a.tokenLock.Lock()
+		a.authBase = target
+		a.tokenLock.Unlock()
+		a.setTokens(tokens)
+
+		// Serve embedded callback HTML page
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(callbackHTML))
+		successChan <- fmt.Sprintf("Logged in as %s", tokens.Email)
 	})
 
 	server := &http.Server{Handler: mux}
@@ -168,11 +199,33 @@ func (a *App) Greet(domain string) string {
 	}
 }
 
-// GetGateways fetches the list of gateways from the Auth API
+// GetGateways fetches the gateways the user can connect to from the Auth
+// API: groups of nodes and single nodes, with their members
 func (a *App) GetGateways(domain string) []map[string]interface{} {
-	if a.authToken == "" {
+	return a.fetchList(domain, "gateways")
+}
+
+// GetApplications fetches the applications the user is permitted to reach
+func (a *App) GetApplications(domain string) []map[string]interface{} {
+	return a.fetchList(domain, "applications")
+}
+
+// fetchList GETs an Auth API endpoint that returns a list
+func (a *App) fetchList(domain, path string) []map[string]interface{} {
+	var list []map[string]interface{}
+	if err := a.fetchJSON(domain, path, &list); err != nil {
+		log.Printf("Failed to fetch %s: %v", path, err)
 		return nil
 	}
+	return list
+}
+
+// fetchJSON GETs an Auth API endpoint and decodes its data into out
+func (a *App) fetchJSON(domain, path string, out interface{}) error {
+	token := a.currentToken()
+	if token == "" {
+		return errors.New("not signed in")
+	}
 
 	target := domain
 	if target == "" {
@@ -182,41 +235,54 @@ func (a *App) GetGateways(domain string) []map[string]interface{} {
 		target = "http://" + target
 	}
 
-	url := fmt.Sprintf("%s:8081/gateways", target)
+	url := fmt.Sprintf("%s:8081/%s", target, path)
 
 	req, err := http.NewRequest("GET", url, nil)
 	if err != nil {
-		log.Printf("Failed to create request: %v", err)
-		return nil
+		return err
 	}
-	req.Header.Set("Authorization", "Bearer "+a.authToken)
+	req.Header.Set("Authorization", "Bearer "+token)
 
 	client := &http.Client{Timeout: 5 * time.Second}
 	resp, err := client.Do(req)
 	if err != nil {
-		log.Printf("Failed to fetch gateways: %v", err)
-		return nil
+		return err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		log.Printf("Failed to fetch gateways: Status %d", resp.StatusCode)
-		return nil
+		return fmt.Errorf("status %d", resp.StatusCode)
 	}
 
-	var result struct {
-		Data []map[string]interface{} `json:"data"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		log.Printf("Failed to decode gateways: %v", err)
-		return nil
-	}
+	result := struct {
+		Data interface{} `json:"data"`
+	}{Data: out}
+	return json.NewDecoder(resp.Body).Decode(&result)
+}
+
+// failoverRounds is how many times the client tries a gateway's members
+// in a row before it gives up.
+const failoverRounds = 3
+
+// gatewayTarget is a gateway the user can connect to: a group of nodes
+// serving one site, or a single node.
+type gatewayTarget struct {
+	ID      string          `json:"id"`
+	Name    string          `json:"name"`
+	Members []gatewayMember `json:"members"`
+}
 
-	return result.Data
+type gatewayMember struct {
+	Address string `json:"address"`
+	Healthy bool   `json:"healthy"`
 }
 
-// Connect initiates the VPN connection to a specific gateway
-func (a *App) Connect(gatewayAddress string) {
+// Connect starts the VPN to a gateway from GetGateways. When the connection
+// to a member fails or drops, the client moves to another healthy member of
+// the group, or reconnects to the same node, with the same sign-in. The
+// control plane gives the user back their address when the new member's
+// address pool allows.
+func (a *App) Connect(domain string, gatewayID string) {
 	a.lifecycleLock.Lock()
 
 	// 1. Cancel previous session
@@ -268,298 +334,388 @@ func (a *App) Connect(gatewayAddress string) {
 			}
 		}()
 
-		if a.authToken == "" {
-			connectionFailed = true
-			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Authentication required first")
-			return
-		}
+		// 4. Connect to a member, and to another one whenever that fails
+		var lastAddress string
+		failures := 0
+		for {
+			connected := false
+			var lastErr error
+			for _, address := range a.gatewayCandidates(domain, gatewayID, lastAddress) {
+				var err error
+				connected, err = a.runSession(sessionCtx, address)
+				if sessionCtx.Err() != nil {
+					return
+				}
+				if connected {
+					log.Printf("Connection to %s lost", address)
+					lastAddress = address
+					break
+				}
+				log.Printf("Connection to %s failed: %v", address, err)
+				lastErr = err
+			}
 
-		log.Printf("Initiating connection to %s...", gatewayAddress)
-		wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Connecting...")
+			if connected {
+				failures = 0
+			} else if failures++; failures >= failoverRounds {
+				connectionFailed = true
+				if lastErr == nil {
+					lastErr = errors.New("Connection Failed: no gateway is available")
+				}
+				wailsRuntime.EventsEmit(a.ctx, "vpn_status", lastErr.Error())
+				return
+			}
 
-		// 1. Dial Gateway via QUIC
-		tlsConf := &tls.Config{
-			InsecureSkipVerify: true,
-			NextProtos:         []string{"vpn-quic"},
+			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Reconnecting...")
+			select {
+			case <-sessionCtx.Done():
+				return
+			case <-time.After(time.Duration(failures+1) * time.Second):
+			}
 		}
+	}()
+}
 
-		dialCtx, dialCancel := context.WithTimeout(sessionCtx, 10*time.Second)
-		defer dialCancel()
+// gatewayCandidates returns the addresses to try for a gateway: its healthy
+// members in the order the control plane prefers, with the member of the
+// session that just ended last since it has probably failed. Without a
+// healthy member every member is tried.
+func (a *App) gatewayCandidates(domain, gatewayID, last string) []string {
+	var gateways []gatewayTarget
+	if err := a.fetchJSON(domain, "gateways", &gateways); err != nil {
+		log.Printf("Failed to refresh gateways: %v", err)
+	}
 
-		conn, err := quic.DialAddr(dialCtx, fmt.Sprintf("%s:6500", gatewayAddress), tlsConf, &quic.Config{
-			EnableDatagrams: true,
-		})
-		if err != nil {
-			if sessionCtx.Err() != nil {
-				log.Println("Connection cancelled by user during dial")
-				return
+	var healthy, unhealthy []string
+	for _, gw := range gateways {
+		if gw.ID != gatewayID {
+			continue
+		}
+		for _, m := range gw.Members {
+			switch {
+			case m.Address == last:
+			case m.Healthy:
+				healthy = append(healthy, m.Address)
+			default:
+				unhealthy = append(unhealthy, m.Address)
 			}
-			log.Printf("QUIC Dial Error: %v", err)
-			connectionFailed = true
-			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Connection Failed: "+err.Error())
-			return
 		}
+	}
+	if last != "" {
+		healthy = append(healthy, last)
+	}
+	if len(healthy) == 0 {
+		return unhealthy
+	}
+	return healthy
+}
 
-		// Ensure connection is closed when we exit this scope
-		defer func() {
-			conn.CloseWithError(0, "Disconnecting")
-		}()
+// runSession connects to one gateway member and runs the VPN until the
+// connection ends. connected reports whether the tunnel was up, as opposed
+// to the connection failing.
+func (a *App) runSession(ctx context.Context, gatewayAddress string) (connected bool, err error) {
+	// Ends this session's goroutines when the next one replaces it
+	sessionCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	token := a.currentToken()
+	if token == "" {
+		return false, errors.New("Authentication required first")
+	}
 
-		// 2. Auth Handshake
-		stream, err := conn.OpenStreamSync(sessionCtx)
-		if err != nil {
-			connectionFailed = true
-			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Stream Error: "+err.Error())
-			return
+	log.Printf("Initiating connection to %s...", gatewayAddress)
+	wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Connecting...")
+
+	// 1. Dial Gateway via QUIC
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: true,
+		NextProtos:         []string{"vpn-quic"},
+	}
+
+	dialCtx, dialCancel := context.WithTimeout(sessionCtx, 10*time.Second)
+	defer dialCancel()
+
+	// Keep-alives let a failed gateway be noticed within the idle timeout
+	conn, err := quic.DialAddr(dialCtx, fmt.Sprintf("%s:6500", gatewayAddress), tlsConf, &quic.Config{
+		EnableDatagrams: true,
+		KeepAlivePeriod: 5 * time.Second,
+		MaxIdleTimeout:  15 * time.Second,
+	})
+	if err != nil {
+		if sessionCtx.Err() != nil {
+			log.Println("Connection cancelled by user during dial")
+			return false, sessionCtx.Err()
 		}
-		_, err = stream.Write([]byte(a.authToken))
+		log.Printf("QUIC Dial Error: %v", err)
+		return false, errors.New("Connection Failed: " + err.Error())
+	}
+
+	// Ensure connection is closed when we exit this scope
+	defer func() {
+		conn.CloseWithError(0, "Disconnecting")
+	}()
+
+	// 2. Auth Handshake
+	stream, err := conn.OpenStreamSync(sessionCtx)
+	if err != nil {
+		return false, errors.New("Stream Error: " + err.Error())
+	}
+	_, err = stream.Write([]byte(token))
+	if err != nil {
+		return false, errors.New("Auth Send Error: " + err.Error())
+	}
+	buf := make([]byte, 1024)
+	n, err := stream.Read(buf)
+	if err != nil && err != io.EOF {
+		return false, errors.New("Auth Read Error: " + err.Error())
+	}
+	if n == 0 {
+		return false, errors.New("Auth Read Error: Empty Response")
+	}
+	resp := string(buf[:n])
+
+	log.Printf("Gateway Response: %s", resp)
+	wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Authenticated")
+
+	var response HandshakeResponse
+	if err := json.Unmarshal([]byte(resp), &response); err != nil {
+		log.Printf("JSON Error: %v", err)
+		return false, errors.New("JSON Unmarshal Error: " + err.Error())
+	}
+
+	// Initialize encryption cipher from session key
+	if response.SessionKey != "" {
+		sessionKeyBytes, err := hex.DecodeString(response.SessionKey)
 		if err != nil {
-			connectionFailed = true
-			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Auth Send Error: "+err.Error())
-			return
-		}
-		buf := make([]byte, 1024)
-		n, err := stream.Read(buf)
-		if err != nil && err != io.EOF {
-			connectionFailed = true
-			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Auth Read Error: "+err.Error())
-			return
+			log.Printf("Session Key Decode Error: %v", err)
+			return false, errors.New("Session Key Error: " + err.Error())
 		}
-		if n == 0 {
-			connectionFailed = true
-			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Auth Read Error: Empty Response")
-			return
+
+		aead, err := chacha20poly1305.NewX(sessionKeyBytes)
+		if err != nil {
+			log.Printf("AEAD Creation Error: %v", err)
+			return false, errors.New("Cipher Error: " + err.Error())
 		}
-		resp := string(buf[:n])
 
-		log.Printf("Gateway Response: %s", resp)
-		wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Authenticated")
+		a.sessionAEAD = aead
+		log.Println("✅ Encryption enabled")
+	}
 
-		var response HandshakeResponse
-		if err := json.Unmarshal([]byte(resp), &response); err != nil {
-			log.Printf("JSON Error: %v", err)
-			connectionFailed = true
-			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "JSON Unmarshal Error: "+err.Error())
-			return
+	fmt.Println(response)
+
+	log.Println("Creating Wintun Adapter...")
+	switch runtime.GOOS {
+	case "windows":
+
+		rawLUID, _ := a.winTun.GetLUID()
+		luid := LUID(rawLUID)
+
+		a.winTun, err = OpenNativeWintun("TriVPN Adapter")
+		if err != nil {
+			log.Printf("OpenNativeWintun Error: %v", err)
+			return false, errors.New("Open Native Wintun Error: " + err.Error())
 		}
 
-		// Initialize encryption cipher from session key
-		if response.SessionKey != "" {
-			sessionKeyBytes, err := hex.DecodeString(response.SessionKey)
-			if err != nil {
-				log.Printf("Session Key Decode Error: %v", err)
-				connectionFailed = true
-				wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Session Key Error: "+err.Error())
-				return
+		log.Printf("Setting IP: %s", response.AssignedIP)
+		err = SetAdapterIP(luid, response.AssignedIP)
+		if err != nil {
+			log.Printf("SetAdapterIP Error: %v", err)
+			return false, errors.New("Set IP Error: " + err.Error())
+		}
+		// The next session may get another address and other routes
+		defer func() {
+			a.diffLock.Lock()
+			defer a.diffLock.Unlock()
+			for _, route := range a.currentRoutes {
+				RemoveWinsRoute(luid, route)
 			}
+			RemoveAdapterIP(luid, response.AssignedIP)
+		}()
+
+		log.Printf("Adding Routes: %v", response.Routes)
+		a.diffLock.Lock()
+		a.currentRoutes = response.Routes
+		a.diffLock.Unlock()
 
-			aead, err := chacha20poly1305.NewX(sessionKeyBytes)
+		for _, route := range response.Routes {
+			err = AddWinsRoute(luid, route)
 			if err != nil {
-				log.Printf("AEAD Creation Error: %v", err)
-				connectionFailed = true
-				wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Cipher Error: "+err.Error())
-				return
+				log.Printf("AddRoute Error: %v", err)
+				return false, errors.New("Add Route Error: " + err.Error())
 			}
+		}
 
-			a.sessionAEAD = aead
-			log.Println("✅ Encryption enabled")
+		if response.DNS != nil {
+			if err := applySplitDNS("TriVPN Adapter", response.DNS); err != nil {
+				log.Printf("Split DNS Error: %v", err)
+			}
+			defer clearSplitDNS("TriVPN Adapter")
 		}
 
-		fmt.Println(response)
+		// Check for cancellation before starting loop
+		if sessionCtx.Err() != nil {
+			log.Println("Session cancelled before starting loop")
+			return false, sessionCtx.Err()
+		}
 
-		log.Println("Creating Wintun Adapter...")
-		switch runtime.GOOS {
-		case "windows":
+		log.Println("Starting VPN Loop...")
+		wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Connected: "+resp)
 
-			rawLUID, _ := a.winTun.GetLUID()
-			luid := LUID(rawLUID)
+		// Start Control Stream Handler (Route Updates)
+		a.handleControlStreams(sessionCtx, conn, func(newRoutes []string) {
+			log.Printf("📥 Received Route Update: %v", newRoutes)
 
-			a.winTun, err = OpenNativeWintun("TriVPN Adapter")
-			if err != nil {
-				log.Printf("OpenNativeWintun Error: %v", err)
-				connectionFailed = true
-				wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Open Native Wintun Error: "+err.Error())
-				return
-			}
+			a.diffLock.Lock()
+			defer a.diffLock.Unlock()
 
-			log.Printf("Setting IP: %s", response.AssignedIP)
-			err = SetAdapterIP(luid, response.AssignedIP)
-			if err != nil {
-				log.Printf("SetAdapterIP Error: %v", err)
-				connectionFailed = true
-				wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Set IP Error: "+err.Error())
-				return
+			current := make(map[string]bool)
+			for _, r := range a.currentRoutes {
+				current[r] = true
 			}
 
-			log.Printf("Adding Routes: %v", response.Routes)
-			a.diffLock.Lock()
-			a.currentRoutes = response.Routes
-			a.diffLock.Unlock()
-
-			for _, route := range response.Routes {
-				err = AddWinsRoute(luid, route)
-				if err != nil {
-					log.Printf("AddRoute Error: %v", err)
-					connectionFailed = true
-					wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Add Route Error: "+err.Error())
-					return
-				}
+			target := make(map[string]bool)
+			for _, r := range newRoutes {
+				target[r] = true
 			}
 
-			// Check for cancellation before starting loop
-			if sessionCtx.Err() != nil {
-				log.Println("Session cancelled before starting loop")
-				return
+			// toAdd = target - current
+			var toAdd []string
+			for r := range target {
+				if !current[r] {
+					toAdd = append(toAdd, r)
+				}
 			}
 
-			log.Println("Starting VPN Loop...")
-			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Connected: "+resp)
-
-			// Start Control Stream Handler (Route Updates)
-			a.handleControlStreams(sessionCtx, conn, func(newRoutes []string) {
-				log.Printf("📥 Received Route Update: %v", newRoutes)
-
-				a.diffLock.Lock()
-				defer a.diffLock.Unlock()
-
-				current := make(map[string]bool)
-				for _, r := range a.currentRoutes {
-					current[r] = true
+			// toRemove = current - target
+			var toRemove []string
+			for r := range current {
+				if !target[r] {
+					toRemove = append(toRemove, r)
 				}
+			}
 
-				target := make(map[string]bool)
-				for _, r := range newRoutes {
-					target[r] = true
-				}
+			log.Printf("Diff: +%v, -%v", toAdd, toRemove)
 
-				// toAdd = target - current
-				var toAdd []string
-				for r := range target {
-					if !current[r] {
-						toAdd = append(toAdd, r)
-					}
+			// Apply Removals
+			for _, route := range toRemove {
+				if err := RemoveWinsRoute(luid, route); err != nil {
+					log.Printf("Failed to remove route %s: %v", route, err)
 				}
+			}
 
-				// toRemove = current - target
-				var toRemove []string
-				for r := range current {
-					if !target[r] {
-						toRemove = append(toRemove, r)
-					}
+			// Apply Additions
+			for _, route := range toAdd {
+				if err := AddWinsRoute(luid, route); err != nil {
+					log.Printf("Failed to add route %s: %v", route, err)
 				}
+			}
 
-				log.Printf("Diff: +%v, -%v", toAdd, toRemove)
+			a.currentRoutes = newRoutes
+			fmt.Println(toRemove, toAdd, newRoutes)
+			wailsRuntime.EventsEmit(a.ctx, "vpn_status", fmt.Sprintf("Routes Sync: +%d, -%d", len(toAdd), len(toRemove)))
+		})
+		a.reportPosture(sessionCtx, conn)
 
-				// Apply Removals
-				for _, route := range toRemove {
-					if err := RemoveWinsRoute(luid, route); err != nil {
-						log.Printf("Failed to remove route %s: %v", route, err)
-					}
-				}
+		a.vpnLoopWinTun(sessionCtx, conn, a.winTun)
+		return true, nil
 
-				// Apply Additions
-				for _, route := range toAdd {
-					if err := AddWinsRoute(luid, route); err != nil {
-						log.Printf("Failed to add route %s: %v", route, err)
-					}
-				}
+	case "linux":
 
-				a.currentRoutes = newRoutes
-				fmt.Println(toRemove, toAdd, newRoutes)
-				wailsRuntime.EventsEmit(a.ctx, "vpn_status", fmt.Sprintf("Routes Sync: +%d, -%d", len(toAdd), len(toRemove)))
-			})
+		var response HandshakeResponse
+		if err := json.Unmarshal([]byte(resp), &response); err != nil {
+			return false, errors.New("JSON Error: " + err.Error())
+		}
 
-			a.vpnLoopWinTun(sessionCtx, conn, a.winTun)
+		// Configure Interface
+		cmd := exec.Command("ip", "addr", "add", response.AssignedIP, "dev", a.unixTun.Name())
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return false, fmt.Errorf("IP Addr Error: %v, %s", err, string(output))
+		}
+		// The next session may get another address and other routes
+		defer exec.Command("ip", "addr", "flush", "dev", a.unixTun.Name()).Run()
+		defer exec.Command("ip", "route", "flush", "dev", a.unixTun.Name()).Run()
 
-		case "linux":
+		cmd = exec.Command("ip", "link", "set", "dev", a.unixTun.Name(), "up", "mtu", "1420")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return false, fmt.Errorf("Link Up Error: %v, %s", err, string(output))
+		}
 
-			var response HandshakeResponse
-			if err := json.Unmarshal([]byte(resp), &response); err != nil {
-				wailsRuntime.EventsEmit(a.ctx, "vpn_status", "JSON Error: "+err.Error())
-				return
-			}
+		// Add Routes
+		a.diffLock.Lock()
+		a.currentRoutes = response.Routes
+		a.diffLock.Unlock()
 
-			// Configure Interface
-			cmd := exec.Command("ip", "addr", "add", response.AssignedIP, "dev", a.unixTun.Name())
+		for _, route := range response.Routes {
+			cmd := exec.Command("ip", "route", "add", route, "dev", a.unixTun.Name())
 			if output, err := cmd.CombinedOutput(); err != nil {
-				wailsRuntime.EventsEmit(a.ctx, "vpn_status", fmt.Sprintf("IP Addr Error: %v, %s", err, string(output)))
-				return
+				log.Printf("Route Error for %s: %v %s", route, err, string(output))
 			}
+		}
 
-			cmd = exec.Command("ip", "link", "set", "dev", a.unixTun.Name(), "up", "mtu", "1420")
-			if output, err := cmd.CombinedOutput(); err != nil {
-				wailsRuntime.EventsEmit(a.ctx, "vpn_status", fmt.Sprintf("Link Up Error: %v, %s", err, string(output)))
-				return
+		if response.DNS != nil {
+			if err := applySplitDNS(a.unixTun.Name(), response.DNS); err != nil {
+				log.Printf("Split DNS Error: %v", err)
 			}
+			defer clearSplitDNS(a.unixTun.Name())
+		}
 
-			// Add Routes
-			a.diffLock.Lock()
-			a.currentRoutes = response.Routes
-			a.diffLock.Unlock()
+		// Check for cancellation before starting loop
+		if sessionCtx.Err() != nil {
+			log.Println("Session cancelled before starting loop")
+			return false, sessionCtx.Err()
+		}
 
-			for _, route := range response.Routes {
-				cmd := exec.Command("ip", "route", "add", route, "dev", a.unixTun.Name())
-				if output, err := cmd.CombinedOutput(); err != nil {
-					log.Printf("Route Error for %s: %v %s", route, err, string(output))
-				}
-			}
+		log.Println("Starting Linux VPN Loop...")
+		wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Connected: "+resp)
 
-			// Check for cancellation before starting loop
-			if sessionCtx.Err() != nil {
-				log.Println("Session cancelled before starting loop")
-				return
+		// Start Control Stream Handler
+		a.handleControlStreams(sessionCtx, conn, func(newRoutes []string) {
+			// (Same update logic as above)
+			log.Printf("📥 Received Route Update: %v", newRoutes)
+			a.diffLock.Lock()
+			defer a.diffLock.Unlock()
+			current := make(map[string]bool)
+			for _, r := range a.currentRoutes {
+				current[r] = true
 			}
-
-			log.Println("Starting Linux VPN Loop...")
-			wailsRuntime.EventsEmit(a.ctx, "vpn_status", "Connected: "+resp)
-
-			// Start Control Stream Handler
-			a.handleControlStreams(sessionCtx, conn, func(newRoutes []string) {
-				// (Same update logic as above)
-				log.Printf("📥 Received Route Update: %v", newRoutes)
-				a.diffLock.Lock()
-				defer a.diffLock.Unlock()
-				current := make(map[string]bool)
-				for _, r := range a.currentRoutes {
-					current[r] = true
-				}
-				target := make(map[string]bool)
-				for _, r := range newRoutes {
-					target[r] = true
-				}
-				var toAdd, toRemove []string
-				for r := range target {
-					if !current[r] {
-						toAdd = append(toAdd, r)
-					}
+			target := make(map[string]bool)
+			for _, r := range newRoutes {
+				target[r] = true
+			}
+			var toAdd, toRemove []string
+			for r := range target {
+				if !current[r] {
+					toAdd = append(toAdd, r)
 				}
-				for r := range current {
-					if !target[r] {
-						toRemove = append(toRemove, r)
-					}
+			}
+			for r := range current {
+				if !target[r] {
+					toRemove = append(toRemove, r)
 				}
-				// Apply Linux Removals
-				for _, route := range toRemove {
-					cmd := exec.Command("ip", "route", "del", route, "dev", a.unixTun.Name())
-					if output, err := cmd.CombinedOutput(); err != nil {
-						log.Printf("Failed to remove route %s: %v %s", route, err, string(output))
-					}
+			}
+			// Apply Linux Removals
+			for _, route := range toRemove {
+				cmd := exec.Command("ip", "route", "del", route, "dev", a.unixTun.Name())
+				if output, err := cmd.CombinedOutput(); err != nil {
+					log.Printf("Failed to remove route %s: %v %s", route, err, string(output))
 				}
-				// Apply Linux Additions
-				for _, route := range toAdd {
-					cmd := exec.Command("ip", "route", "add", route, "dev", a.unixTun.Name())
-					if output, err := cmd.CombinedOutput(); err != nil {
-						log.Printf("Failed to add route %s: %v %s", route, err, string(output))
-					}
+			}
+			// Apply Linux Additions
+			for _, route := range toAdd {
+				cmd := exec.Command("ip", "route", "add", route, "dev", a.unixTun.Name())
+				if output, err := cmd.CombinedOutput(); err != nil {
+					log.Printf("Failed to add route %s: %v %s", route, err, string(output))
 				}
-				a.currentRoutes = newRoutes
-				wailsRuntime.EventsEmit(a.ctx, "vpn_status", fmt.Sprintf("Routes Sync: +%d, -%d", len(toAdd), len(toRemove)))
-			})
-
-			a.vpnLoopWater(sessionCtx, conn, a.unixTun)
-		}
+			}
+			a.currentRoutes = newRoutes
+			wailsRuntime.EventsEmit(a.ctx, "vpn_status", fmt.Sprintf("Routes Sync: +%d, -%d", len(toAdd), len(toRemove)))
+		})
+		a.reportPosture(sessionCtx, conn)
 
-	}()
+		a.vpnLoopWater(sessionCtx, conn, a.unixTun)
+		return true, nil
+	}
+	return false, errors.New("Unsupported OS: " + runtime.GOOS)
 }
 
 func (a *App) vpnLoopWinTun(ctx context.Context, conn *quic.Conn, tun *NativeWintun) {
@@ -751,9 +907,18 @@ func (a *App) Disconnect() string {
 func (a *App) SignOut() string {
 	a.Disconnect()
 
+	// End the sign-in on the server too, so the refresh token is useless
+	a.tokenLock.Lock()
+	target, refresh := a.authBase, a.refreshToken
+	a.tokenLock.Unlock()
+	if refresh != "" {
+		if err := revokeRefreshToken(target, refresh); err != nil {
+			log.Printf("Failed to revoke refresh token: %v", err)
+		}
+	}
+
 	// Reset State for clean login
-	a.authToken = ""
-	a.userEmail = ""
+	a.clearTokens()
 	a.currentRoutes = nil
 
 	return "Signed Out"
@@ -781,8 +946,14 @@ func (a *App) handleControlStreams(ctx context.Context, conn *quic.Conn, updateR
 					log.Printf("Control Msg Decode Error: %v", err)
 					return
 				}
-				if msg.Type == "route_update" {
+				switch msg.Type {
+				case "route_update":
 					updateRoutes(msg.Routes)
+				case "reconnect":
+					// The gateway is draining: end the session so Connect
+					// moves to another member before this one stops
+					log.Println("Gateway asked to reconnect elsewhere")
+					conn.CloseWithError(0, "Reconnecting")
 				}
 			}()
 		}
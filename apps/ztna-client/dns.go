@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// nrptComment tags the NRPT rules we create so they can be removed on disconnect.
+const nrptComment = "Tridorian ZTNA"
+
+// dnsName matches a DNS name made of letters, digits and hyphens. Names from
+// the gateway end up in an elevated PowerShell script, so nothing else passes.
+var dnsName = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
+
+// DNSSettings mirrors vpn.DNSSettings on the gateway side.
+type DNSSettings struct {
+	Servers        []string `json:"servers"`
+	Domains        []string `json:"domains"`
+	SearchSuffixes []string `json:"search_suffixes,omitempty"`
+}
+
+// validate checks every value before it reaches resolvectl or PowerShell.
+func (d *DNSSettings) validate() error {
+	for _, s := range d.Servers {
+		if _, err := netip.ParseAddr(s); err != nil {
+			return fmt.Errorf("invalid DNS server %q", s)
+		}
+	}
+	for _, names := range [][]string{d.Domains, d.SearchSuffixes} {
+		for _, n := range names {
+			if len(n) > 253 || !dnsName.MatchString(n) {
+				return fmt.Errorf("invalid DNS domain %q", n)
+			}
+		}
+	}
+	return nil
+}
+
+// applySplitDNS sends queries for the internal domains to the gateway's
+// resolver while leaving all other lookups on the system resolver.
+// A Windows adapter has a single connection-specific suffix, so only the
+// first search suffix is applied there.
+func applySplitDNS(iface string, dns *DNSSettings) error {
+	if dns == nil || len(dns.Servers) == 0 || len(dns.Domains) == 0 {
+		return nil
+	}
+	if err := dns.validate(); err != nil {
+		return err
+	}
+	log.Printf("Applying split DNS: %v -> %v", dns.Domains, dns.Servers)
+
+	switch runtime.GOOS {
+	case "linux":
+		// systemd-resolved: "~domain" makes the link the route for that domain only
+		args := append([]string{"dns", iface}, dns.Servers...)
+		if output, err := exec.Command("resolvectl", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("resolvectl dns: %v, %s", err, string(output))
+		}
+		args = []string{"domain", iface}
+		for _, d := range dns.Domains {
+			args = append(args, "~"+d)
+		}
+		args = append(args, dns.SearchSuffixes...)
+		if output, err := exec.Command("resolvectl", args...).CombinedOutput(); err != nil {
+			return fmt.Errorf("resolvectl domain: %v, %s", err, string(output))
+		}
+
+	case "windows":
+		clearSplitDNS(iface)
+		var script strings.Builder
+		for _, d := range dns.Domains {
+			fmt.Fprintf(&script, "Add-DnsClientNrptRule -Namespace '.%s' -NameServers %s -Comment '%s';",
+				d, psList(dns.Servers), nrptComment)
+		}
+		if len(dns.SearchSuffixes) > 1 {
+			log.Printf("Windows supports one search suffix per adapter, using %s", dns.SearchSuffixes[0])
+		}
+		if len(dns.SearchSuffixes) > 0 {
+			fmt.Fprintf(&script, "Set-DnsClient -InterfaceAlias '%s' -ConnectionSpecificSuffix '%s';",
+				iface, dns.SearchSuffixes[0])
+		}
+		if output, err := exec.Command("powershell", "-NoProfile", "-Command", script.String()).CombinedOutput(); err != nil {
+			return fmt.Errorf("NRPT setup: %v, %s", err, string(output))
+		}
+	}
+	return nil
+}
+
+// clearSplitDNS removes what applySplitDNS configured.
+func clearSplitDNS(iface string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "linux":
+		cmd = exec.Command("resolvectl", "revert", iface)
+	case "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-Command",
+			fmt.Sprintf("Get-DnsClientNrptRule | Where-Object { $_.Comment -eq '%s' } | Remove-DnsClientNrptRule -Force", nrptComment))
+	default:
+		return
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		log.Printf("Failed to clear split DNS: %v %s", err, string(output))
+	}
+}
+
+func psList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = "'" + v + "'"
+	}
+	return strings.Join(quoted, ",")
+}
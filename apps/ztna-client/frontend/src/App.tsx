@@ -1,12 +1,30 @@
 import { useState, useEffect } from 'react';
 import './App.css';
-import { Greet, GetGateways, Connect, Disconnect, SignOut } from "../wailsjs/go/main/App";
+import { Greet, GetGateways, GetApplications, Connect, Disconnect, SignOut } from "../wailsjs/go/main/App";
 import { WindowMinimise, Quit, EventsOn } from "../wailsjs/runtime/runtime";
 
+interface GatewayMember {
+    name: string;
+    address: string;
+    healthy: boolean;
+}
+
 interface Gateway {
+    id: string;
     name: string;
     address: string;
-    ping: string;
+    healthy: boolean;
+    group: boolean;
+    members?: GatewayMember[];
+}
+
+interface Application {
+    id: string;
+    name: string;
+    description?: string;
+    ports?: string;
+    destinations?: { type: string; value: string }[];
+    health?: { healthy: boolean }[];
 }
 
 function App() {
@@ -18,6 +36,7 @@ function App() {
     const [gateways, setGateways] = useState<Gateway[]>([]);
     const [ip, setIp] = useState("");
     const [selectedGateway, setSelectedGateway] = useState<string>("");
+    const [applications, setApplications] = useState<Application[]>([]);
 
     useEffect(() => {
         EventsOn("vpn_status", (status: string) => {
@@ -42,9 +61,10 @@ function App() {
                 setStatusText("Disconnected");
                 setIp("");
             } else {
-                // Connecting, Authenticated, or Error
+                // Connecting, Authenticated, Reconnecting, or Error
                 setStatusText(status);
-                if (status.startsWith("Error") || status.startsWith("Crash") || status.startsWith("Failed")) {
+                if (status.startsWith("Error") || status.startsWith("Crash") || status.startsWith("Failed") ||
+                    status.startsWith("Connection Failed") || status.includes("Error:")) {
                     setIsConnected(false);
                 }
             }
@@ -60,6 +80,7 @@ function App() {
             if (result.startsWith("Logged in as")) {
                 setShowInput(false);
                 fetchGateways(domain); // Pass domain
+                GetApplications(domain).then((result: any) => setApplications(result || []));
                 setStatusText("Select Gateway");
             } else {
                 setStatusText(result);
@@ -74,7 +95,7 @@ function App() {
             // Need to ensure types match.
             setGateways(result || []);
             if (result && result.length > 0) {
-                setSelectedGateway(result[0].address);
+                setSelectedGateway(result[0].id);
             }
         });
     }
@@ -93,7 +114,7 @@ function App() {
                 return;
             }
             setStatusText("Connecting...");
-            Connect(selectedGateway);
+            Connect(domain, selectedGateway);
         }
     };
 
@@ -103,6 +124,7 @@ function App() {
             setStatusText("Ready");
             setShowInput(true);
             setGateways([]);
+            setApplications([]);
         });
     };
 
@@ -181,8 +203,8 @@ function App() {
                                         onChange={(e) => setSelectedGateway(e.target.value)}
                                     >
                                         {gateways.map((gw, idx) => (
-                                            <option key={idx} value={gw.address}>
-                                                {gw.name} ({gw.address})
+                                            <option key={idx} value={gw.id}>
+                                                {gw.name} ({gw.group ? `${gw.members?.filter(m => m.healthy).length || 0} gateways` : gw.address})
                                             </option>
                                         ))}
                                     </select>
@@ -206,11 +228,27 @@ function App() {
                             {isConnected && (
                                 <div className="connection-details">
                                     <p>Duration: {duration}</p>
-                                    <p>Connected to: {gateways.find(g => g.address === selectedGateway)?.name}</p>
+                                    <p>Connected to: {gateways.find(g => g.id === selectedGateway)?.name}</p>
                                     <p>IP: {ip}</p>
                                 </div>
                             )}
 
+                            {isConnected && applications.length > 0 && (
+                                <div className="connection-details">
+                                    <label className="selector-label">Applications</label>
+                                    {applications.map((app) => {
+                                        const health = app.health || [];
+                                        const status = health.length === 0 ? "" : health.some(h => h.healthy) ? " ● up" : " ● down";
+                                        const address = app.destinations?.[0]?.value || "";
+                                        return (
+                                            <p key={app.id} title={app.description}>
+                                                {app.name} — {address}{app.ports ? ` (${app.ports})` : ""}{status}
+                                            </p>
+                                        );
+                                    })}
+                                </div>
+                            )}
+
                             {!isConnected && (
                                 <div className="connection-details">
                                     <p className="workspace-domain">{domain}</p>
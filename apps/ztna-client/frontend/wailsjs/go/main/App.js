@@ -2,14 +2,18 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
-export function Connect(arg1) {
-  return window['go']['main']['App']['Connect'](arg1);
+export function Connect(arg1, arg2) {
+  return window['go']['main']['App']['Connect'](arg1, arg2);
 }
 
 export function Disconnect() {
   return window['go']['main']['App']['Disconnect']();
 }
 
+export function GetApplications(arg1) {
+  return window['go']['main']['App']['GetApplications'](arg1);
+}
+
 export function GetGateways(arg1) {
   return window['go']['main']['App']['GetGateways'](arg1);
 }
@@ -16,6 +16,7 @@ var (
 	procConvertInterfaceLuidToIndex     = modIphlpapi.NewProc("ConvertInterfaceLuidToIndex")
 	procInitializeUnicastIpAddressEntry = modIphlpapi.NewProc("InitializeUnicastIpAddressEntry")
 	procCreateUnicastIpAddressEntry     = modIphlpapi.NewProc("CreateUnicastIpAddressEntry")
+	procDeleteUnicastIpAddressEntry     = modIphlpapi.NewProc("DeleteUnicastIpAddressEntry")
 	procInitializeIpForwardEntry        = modIphlpapi.NewProc("InitializeIpForwardEntry")
 	procCreateIpForwardEntry2           = modIphlpapi.NewProc("CreateIpForwardEntry2")
 	procDeleteIpForwardEntry2           = modIphlpapi.NewProc("DeleteIpForwardEntry2")
@@ -109,6 +110,27 @@ func SetAdapterIP(luid LUID, ipStr string) error {
 	return nil
 }
 
+// RemoveAdapterIP removes an address SetAdapterIP added.
+func RemoveAdapterIP(luid LUID, ipStr string) error {
+	ip, _, err := net.ParseCIDR(ipStr)
+	if err != nil {
+		return err
+	}
+
+	var row MibUnicastIpAddressRow
+	procInitializeUnicastIpAddressEntry.Call(uintptr(unsafe.Pointer(&row)))
+
+	row.InterfaceLuid = luid
+	row.Address.Family = 2 // AF_INET
+	copy(row.Address.Data[2:], ip.To4())
+
+	ret, _, _ := procDeleteUnicastIpAddressEntry.Call(uintptr(unsafe.Pointer(&row)))
+	if ret != 0 && ret != 1168 { // Element not found
+		return fmt.Errorf("DeleteUnicastIpAddressEntry failed: Code %d", ret)
+	}
+	return nil
+}
+
 func SetAdapterRoute(luid LUID, destCIDR string) error {
 	_, ipNet, err := net.ParseCIDR(destCIDR)
 	if err != nil {
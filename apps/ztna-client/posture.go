@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// ClientVersion is reported in every posture report so policies can require a minimum version.
+const ClientVersion = "0.2.0"
+
+// postureInterval is how often a fresh report is sent over the tunnel.
+const postureInterval = 5 * time.Minute
+
+// PostureReport mirrors pkg/posture.Report on the server side.
+type PostureReport struct {
+	Hostname          string `json:"hostname"`
+	OS                string `json:"os"`
+	OSVersion         string `json:"os_version"`
+	DiskEncrypted     bool   `json:"disk_encrypted"`
+	FirewallEnabled   bool   `json:"firewall_enabled"`
+	ScreenLockEnabled bool   `json:"screen_lock_enabled"`
+	ClientVersion     string `json:"client_version"`
+	Timestamp         int64  `json:"timestamp"`
+}
+
+// PostureEnvelope mirrors pkg/posture.Envelope on the server side.
+type PostureEnvelope struct {
+	Payload   string `json:"payload"`
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// loadDeviceKey returns the device identity key, creating it on first use.
+// The device ID the server sees is derived from its public half.
+func loadDeviceKey() (ed25519.PrivateKey, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "tridorian-ztna", "device.key")
+
+	if data, err := os.ReadFile(path); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid device key file %s", path)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		priv, ok := key.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("device key is not ed25519")
+		}
+		return priv, nil
+	}
+
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, err
+	}
+	log.Printf("Created device key at %s", path)
+	return priv, nil
+}
+
+// signedPosture collects the current device state and signs it with the device key.
+func signedPosture() (*PostureEnvelope, error) {
+	key, err := loadDeviceKey()
+	if err != nil {
+		return nil, err
+	}
+
+	report := collectPosture()
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+
+	return &PostureEnvelope{
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload)),
+	}, nil
+}
+
+// attestPosture sends a signed report to the auth-api before login and
+// returns the one-time posture_id to include in the login URL.
+func attestPosture(target string) (string, error) {
+	envelope, err := signedPosture()
+	if err != nil {
+		return "", err
+	}
+	body, _ := json.Marshal(envelope)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(target+"/posture", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool `json:"success"`
+		Data    struct {
+			PostureID string `json:"posture_id"`
+		} `json:"data"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK || result.Data.PostureID == "" {
+		return "", fmt.Errorf("posture attestation failed: %s", result.Error)
+	}
+	return result.Data.PostureID, nil
+}
+
+// reportPosture sends a signed report to the gateway now and then every
+// postureInterval until the session ends.
+func (a *App) reportPosture(ctx context.Context, conn *quic.Conn) {
+	go func() {
+		ticker := time.NewTicker(postureInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := sendPosture(ctx, conn); err != nil {
+				log.Printf("Posture report failed: %v", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func sendPosture(ctx context.Context, conn *quic.Conn) error {
+	envelope, err := signedPosture()
+	if err != nil {
+		return err
+	}
+
+	stream, err := conn.OpenUniStreamSync(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	msg := map[string]interface{}{
+		"type":   "posture_report",
+		"report": envelope,
+	}
+	return json.NewEncoder(stream).Encode(msg)
+}
+
+// collectPosture gathers the device state. Checks that cannot be performed
+// on this machine report false, which fails closed on the server.
+func collectPosture() PostureReport {
+	hostname, _ := os.Hostname()
+	report := PostureReport{
+		Hostname:      hostname,
+		OS:            runtime.GOOS,
+		ClientVersion: ClientVersion,
+		Timestamp:     time.Now().Unix(),
+	}
+
+	switch runtime.GOOS {
+	case "windows":
+		if out, err := exec.Command("cmd", "/c", "ver").Output(); err == nil {
+			if m := regexp.MustCompile(`\d+\.\d+\.\d+(\.\d+)?`).Find(out); m != nil {
+				report.OSVersion = string(m)
+			}
+		}
+		if out, err := exec.Command("manage-bde", "-status", "C:").Output(); err == nil {
+			report.DiskEncrypted = strings.Contains(string(out), "Protection On")
+		}
+		if out, err := exec.Command("netsh", "advfirewall", "show", "allprofiles", "state").Output(); err == nil {
+			report.FirewallEnabled = strings.Contains(string(out), "ON") && !strings.Contains(string(out), "OFF")
+		}
+		if out, err := exec.Command("reg", "query", `HKCU\Control Panel\Desktop`, "/v", "ScreenSaverIsSecure").Output(); err == nil {
+			fields := strings.Fields(string(out))
+			report.ScreenLockEnabled = len(fields) > 0 && fields[len(fields)-1] == "1"
+		}
+
+	case "darwin":
+		if out, err := exec.Command("sw_vers", "-productVersion").Output(); err == nil {
+			report.OSVersion = strings.TrimSpace(string(out))
+		}
+		if out, err := exec.Command("fdesetup", "status").Output(); err == nil {
+			report.DiskEncrypted = strings.Contains(string(out), "FileVault is On")
+		}
+		if out, err := exec.Command("/usr/libexec/ApplicationFirewall/socketfilterfw", "--getglobalstate").Output(); err == nil {
+			report.FirewallEnabled = strings.Contains(string(out), "enabled")
+		}
+		if out, err := exec.Command("sysadminctl", "-screenLock", "status").CombinedOutput(); err == nil {
+			report.ScreenLockEnabled = !strings.Contains(string(out), "screenLock is off")
+		}
+
+	case "linux":
+		if data, err := os.ReadFile("/etc/os-release"); err == nil {
+			for _, line := range strings.Split(string(data), "\n") {
+				if v, ok := strings.CutPrefix(line, "VERSION_ID="); ok {
+					report.OSVersion = strings.Trim(v, `"`)
+				}
+			}
+		}
+		if out, err := exec.Command("lsblk", "-n", "-o", "TYPE").Output(); err == nil {
+			report.DiskEncrypted = strings.Contains(string(out), "crypt")
+		}
+		if out, err := exec.Command("ufw", "status").Output(); err == nil && strings.Contains(string(out), "Status: active") {
+			report.FirewallEnabled = true
+		} else if err := exec.Command("systemctl", "is-active", "--quiet", "firewalld").Run(); err == nil {
+			report.FirewallEnabled = true
+		}
+		if out, err := exec.Command("gsettings", "get", "org.gnome.desktop.screensaver", "lock-enabled").Output(); err == nil {
+			report.ScreenLockEnabled = strings.TrimSpace(string(out)) == "true"
+		}
+	}
+
+	return report
+}
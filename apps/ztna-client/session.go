@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// tokenRenewMargin is how long before expiry the target token is renewed.
+const tokenRenewMargin = 5 * time.Minute
+
+// tokenResponse is the auth-api's answer to a code exchange or a refresh.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	Email        string `json:"email"`
+	Name         string `json:"name"`
+}
+
+// newPKCE returns a random verifier and its S256 challenge. Only the
+// challenge goes through the browser; the verifier never leaves the client.
+func newPKCE() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// exchangeCode trades the one-time code from the browser redirect for tokens.
+func exchangeCode(target, code, verifier string) (*tokenResponse, error) {
+	return requestTokens(target, map[string]string{
+		"grant_type":    "authorization_code",
+		"code":          code,
+		"code_verifier": verifier,
+	})
+}
+
+// refreshTokens renews the target token. A fresh posture report is sent
+// along so sign-in policies see the device's current state.
+func refreshTokens(target, refreshToken string) (*tokenResponse, error) {
+	body := map[string]string{
+		"grant_type":    "refresh_token",
+		"refresh_token": refreshToken,
+	}
+	if postureID, err := attestPosture(target); err != nil {
+		log.Printf("Posture attestation failed: %v", err)
+	} else {
+		body["posture_id"] = postureID
+	}
+	return requestTokens(target, body)
+}
+
+func requestTokens(target string, body map[string]string) (*tokenResponse, error) {
+	payload, _ := json.Marshal(body)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(target+"/token", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Success bool          `json:"success"`
+		Data    tokenResponse `json:"data"`
+		Error   string        `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK || result.Data.AccessToken == "" {
+		return nil, fmt.Errorf("token request failed: %s", result.Error)
+	}
+	return &result.Data, nil
+}
+
+// revokeRefreshToken ends the sign-in on the auth-api.
+func revokeRefreshToken(target, refreshToken string) error {
+	payload, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(target+"/token/revoke", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("revoke failed: status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// setTokens stores the tokens of a sign-in or refresh.
+func (a *App) setTokens(t *tokenResponse) {
+	a.tokenLock.Lock()
+	defer a.tokenLock.Unlock()
+	a.storeTokens(t)
+}
+
+// storeTokens sets the tokens; the caller holds tokenLock.
+func (a *App) storeTokens(t *tokenResponse) {
+	a.authToken = t.AccessToken
+	a.refreshToken = t.RefreshToken
+	a.tokenExpiry = time.Now().Add(time.Duration(t.ExpiresIn) * time.Second)
+	if t.Email != "" {
+		a.userEmail = t.Email
+	}
+}
+
+// currentToken returns a target token, renewing it first when it is about
+// to expire. Renewals are serialized: refresh tokens rotate, so a second
+// concurrent refresh would present a token that is already spent. Callers
+// that waited re-read the token and use the one just renewed. If renewal
+// fails once the token has expired, the user is signed out.
+func (a *App) currentToken() string {
+	a.refreshLock.Lock()
+	defer a.refreshLock.Unlock()
+
+	a.tokenLock.Lock()
+	token, refresh, expiry, target := a.authToken, a.refreshToken, a.tokenExpiry, a.authBase
+	a.tokenLock.Unlock()
+
+	if token == "" || refresh == "" || time.Until(expiry) > tokenRenewMargin {
+		return token
+	}
+
+	t, err := refreshTokens(target, refresh)
+	if err != nil {
+		log.Printf("Token refresh failed: %v", err)
+		if time.Now().After(expiry) {
+			a.clearTokens()
+			return ""
+		}
+		return token
+	}
+
+	// A sign-out or a new sign-in during the request wins over the renewal
+	a.tokenLock.Lock()
+	stale := a.refreshToken != refresh
+	if stale {
+		token = a.authToken
+	} else {
+		a.storeTokens(t)
+		token = t.AccessToken
+	}
+	a.tokenLock.Unlock()
+	if stale {
+		revokeRefreshToken(target, t.RefreshToken)
+	}
+	return token
+}
+
+func (a *App) clearTokens() {
+	a.tokenLock.Lock()
+	defer a.tokenLock.Unlock()
+
+	a.authToken = ""
+	a.refreshToken = ""
+	a.tokenExpiry = time.Time{}
+	a.userEmail = ""
+}
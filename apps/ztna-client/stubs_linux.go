@@ -29,6 +29,10 @@ func SetAdapterIP(luid LUID, ipStr string) error {
 	return fmt.Errorf("not supported")
 }
 
+func RemoveAdapterIP(luid LUID, ipStr string) error {
+	return fmt.Errorf("not supported")
+}
+
 func AddWinsRoute(luid LUID, destCIDR string) error {
 	return fmt.Errorf("not supported")
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"net"
+	"strings"
 	"tridorian-ztna/internal/grpc/gateway"
 	"tridorian-ztna/internal/infrastructure"
 	pb "tridorian-ztna/internal/proto/gateway/v1"
@@ -11,6 +12,7 @@ import (
 
 	"github.com/joho/godotenv"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -47,8 +49,26 @@ func main() {
 		log.Fatalf("failed to listen: %v", err)
 	}
 
-	grpcServer := grpc.NewServer()
-	gatewayServer := gateway.NewServer(nodeService, policyService, pubPEM)
+	deviceService := services.NewDeviceService(db, valkey)
+	tenantService := services.NewTenantService(db)
+	applicationService := services.NewApplicationService(db, valkey)
+	directoryService := services.NewDirectoryService(db, valkey)
+	sessionService := services.NewSessionService(db, valkey)
+	gatewayServer := gateway.NewServer(nodeService, policyService, deviceService, tenantService, applicationService, directoryService, sessionService, pubPEM)
+
+	// Gateways enroll for a client certificate signed by the gateway CA and
+	// authenticate every other call with it over mutual TLS
+	ca := nodeService.CA()
+	if ca == nil || ca.Key == nil {
+		log.Fatal("❌ GATEWAY_CA_CERT and GATEWAY_CA_KEY environment variables are required. Run: ./scripts/generate-keys.sh")
+	}
+	tlsConfig, err := gateway.TLSConfig(ca, utils.GetEnv("GRPC_TLS_CERT", ""), utils.GetEnv("GRPC_TLS_KEY", ""), strings.Split(utils.GetEnv("GRPC_TLS_HOSTS", "localhost"), ","))
+	if err != nil {
+		log.Fatalf("❌ gRPC TLS: %v", err)
+	}
+	log.Printf("🔏 Gateway CA fingerprint: %s", ca.Fingerprint())
+
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)), grpc.UnaryInterceptor(gatewayServer.UnaryAuthInterceptor))
 	pb.RegisterGatewayServiceServer(grpcServer, gatewayServer)
 
 	log.Printf("🔌 gRPC Gateway Server listening on :%s", grpcPort)
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+
+	pb "tridorian-ztna/internal/proto/gateway/v1"
+	"tridorian-ztna/internal/version"
+	"tridorian-ztna/pkg/pki"
+)
+
+// Files kept in the state directory once the gateway has enrolled
+const (
+	keyFile  = "node.key"
+	certFile = "node.crt"
+	caFile   = "ca.crt"
+)
+
+// identity is the gateway's client certificate and the CA it trusts for
+// the control plane.
+type identity struct {
+	stateDir string
+	ca       *x509.Certificate
+
+	mu   sync.RWMutex
+	cert tls.Certificate
+}
+
+// loadIdentity reads the credentials saved by a previous enrollment. The
+// error wraps os.ErrNotExist if the gateway has not enrolled.
+func loadIdentity(stateDir string) (*identity, error) {
+	cert, err := tls.LoadX509KeyPair(filepath.Join(stateDir, certFile), filepath.Join(stateDir, keyFile))
+	if err != nil {
+		return nil, err
+	}
+	caPEM, err := os.ReadFile(filepath.Join(stateDir, caFile))
+	if err != nil {
+		return nil, err
+	}
+	ca, err := pki.ParseCertificatePEM(caPEM)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", caFile, err)
+	}
+	return &identity{stateDir: stateDir, ca: ca, cert: cert}, nil
+}
+
+// enroll exchanges a one-time enrollment token for a client certificate and
+// saves it in the state directory. The control plane is trusted through the
+// pinned CA fingerprint, or through the system roots without one.
+func enroll(addr, token, caFingerprint, stateDir, hostname, deviceHash string) (*identity, error) {
+	key, keyPEM, err := pki.NewKey()
+	if err != nil {
+		return nil, err
+	}
+	csrPEM, err := pki.NewCSR(key, hostname)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(credentials.NewTLS(enrollTLSConfig(caFingerprint))), gatewayMetadata(deviceHash))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := pb.NewGatewayServiceClient(conn).Enroll(ctx, &pb.EnrollRequest{
+		EnrollmentToken: token,
+		CsrPem:          string(csrPEM),
+		Hostname:        hostname,
+		DeviceHash:      deviceHash,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := pki.ParseCertificatePEM([]byte(resp.CaCertificatePem))
+	if err != nil {
+		return nil, fmt.Errorf("control plane CA: %w", err)
+	}
+	if caFingerprint != "" && pki.Fingerprint(ca) != pki.NormalizeFingerprint(caFingerprint) {
+		return nil, errors.New("control plane CA does not match the pinned fingerprint")
+	}
+	cert, err := tls.X509KeyPair([]byte(resp.CertificatePem), keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(stateDir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(stateDir, caFile), []byte(resp.CaCertificatePem), 0o644); err != nil {
+		return nil, err
+	}
+	id := &identity{stateDir: stateDir, ca: ca}
+	if err := id.save(cert, keyPEM, []byte(resp.CertificatePem)); err != nil {
+		return nil, err
+	}
+	return id, nil
+}
+
+// enrollTLSConfig verifies the control plane before the gateway has the CA:
+// the server's chain must include the certificate with the pinned
+// fingerprint, and the server certificate must chain to it.
+func enrollTLSConfig(caFingerprint string) *tls.Config {
+	if caFingerprint == "" {
+		return &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	pin := pki.NormalizeFingerprint(caFingerprint)
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// Verified against the pinned CA in VerifyConnection instead
+		InsecureSkipVerify: true,
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			roots := x509.NewCertPool()
+			intermediates := x509.NewCertPool()
+			pinned := false
+			for _, c := range cs.PeerCertificates {
+				if pki.Fingerprint(c) == pin {
+					roots.AddCert(c)
+					pinned = true
+				} else {
+					intermediates.AddCert(c)
+				}
+			}
+			if !pinned {
+				return errors.New("control plane certificate is not issued by the pinned CA")
+			}
+			_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+				DNSName:       cs.ServerName,
+				Roots:         roots,
+				Intermediates: intermediates,
+			})
+			return err
+		},
+	}
+}
+
+// transportCredentials authenticates the gateway with its current
+// certificate and trusts the gateway CA as well as the system roots, in
+// case the control plane presents a publicly trusted certificate.
+func (id *identity) transportCredentials() credentials.TransportCredentials {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	roots.AddCert(id.ca)
+	return credentials.NewTLS(&tls.Config{
+		MinVersion: tls.VersionTLS12,
+		RootCAs:    roots,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return id.certificate(), nil
+		},
+	})
+}
+
+// certificate returns the current certificate, which renewal replaces.
+func (id *identity) certificate() *tls.Certificate {
+	id.mu.RLock()
+	defer id.mu.RUnlock()
+	cert := id.cert
+	return &cert
+}
+
+// nodeID is the node the certificate was issued to.
+func (id *identity) nodeID() string {
+	id.mu.RLock()
+	defer id.mu.RUnlock()
+	return id.cert.Leaf.Subject.CommonName
+}
+
+// renewDue reports whether less than a third of the certificate's
+// lifetime is left.
+func (id *identity) renewDue() bool {
+	id.mu.RLock()
+	defer id.mu.RUnlock()
+	leaf := id.cert.Leaf
+	lifetime := leaf.NotAfter.Sub(leaf.NotBefore)
+	return time.Until(leaf.NotAfter) < lifetime/3
+}
+
+// renew replaces the certificate and key, then reconnects: the control
+// plane refuses calls made with the previous certificate.
+func (id *identity) renew(cp *controlPlane) error {
+	key, keyPEM, err := pki.NewKey()
+	if err != nil {
+		return err
+	}
+	csrPEM, err := pki.NewCSR(key, id.nodeID())
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	resp, err := cp.client().RenewCertificate(ctx, &pb.RenewCertificateRequest{CsrPem: string(csrPEM)})
+	if err != nil {
+		return err
+	}
+	cert, err := tls.X509KeyPair([]byte(resp.CertificatePem), keyPEM)
+	if err != nil {
+		return err
+	}
+	if err := id.save(cert, keyPEM, []byte(resp.CertificatePem)); err != nil {
+		return err
+	}
+	return cp.reconnect()
+}
+
+// watchRenewal renews the certificate when it is due.
+func (id *identity) watchRenewal(ctx context.Context, cp *controlPlane, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !id.renewDue() {
+			continue
+		}
+		if err := id.renew(cp); err != nil {
+			log.Printf("❌ Certificate renewal failed: %v", err)
+			continue
+		}
+		log.Printf("🔏 Certificate renewed")
+	}
+}
+
+// save writes the key and certificate to the state directory and starts
+// using them.
+func (id *identity) save(cert tls.Certificate, keyPEM, certPEM []byte) error {
+	if err := writeFileAtomic(filepath.Join(id.stateDir, keyFile), keyPEM, 0o600); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(id.stateDir, certFile), certPEM, 0o644); err != nil {
+		return err
+	}
+	id.mu.Lock()
+	id.cert = cert
+	id.mu.Unlock()
+	return nil
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// controlPlane is the connection to the control plane, replaced when the
+// certificate is renewed.
+type controlPlane struct {
+	addr       string
+	id         *identity
+	deviceHash string
+
+	mu   sync.RWMutex
+	conn *grpc.ClientConn
+	c    pb.GatewayServiceClient
+}
+
+func dialControlPlane(addr string, id *identity, deviceHash string) (*controlPlane, error) {
+	cp := &controlPlane{addr: addr, id: id, deviceHash: deviceHash}
+	if err := cp.reconnect(); err != nil {
+		return nil, err
+	}
+	return cp, nil
+}
+
+func (cp *controlPlane) client() pb.GatewayServiceClient {
+	cp.mu.RLock()
+	defer cp.mu.RUnlock()
+	return cp.c
+}
+
+// reconnect dials a new connection, which presents the current
+// certificate. The previous one is closed once calls in flight are done.
+func (cp *controlPlane) reconnect() error {
+	conn, err := grpc.Dial(cp.addr, grpc.WithTransportCredentials(cp.id.transportCredentials()), gatewayMetadata(cp.deviceHash))
+	if err != nil {
+		return err
+	}
+	cp.mu.Lock()
+	old := cp.conn
+	cp.conn = conn
+	cp.c = pb.NewGatewayServiceClient(conn)
+	cp.mu.Unlock()
+	if old != nil {
+		time.AfterFunc(30*time.Second, func() { old.Close() })
+	}
+	return nil
+}
+
+func (cp *controlPlane) Close() error {
+	cp.mu.Lock()
+	defer cp.mu.Unlock()
+	return cp.conn.Close()
+}
+
+// gatewayMetadata sends the gateway version and device hash with every
+// call. The control plane holds calls from changed hardware for approval.
+func gatewayMetadata(deviceHash string) grpc.DialOption {
+	return grpc.WithUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, "x-gateway-version", version.Version, "x-device-hash", deviceHash)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	})
+}
@@ -4,22 +4,28 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"net/netip"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/joho/godotenv"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/metadata"
 
 	"tridorian-ztna/internal/gateway/firewall"
+	"tridorian-ztna/internal/gateway/healthcheck"
 	"tridorian-ztna/internal/gateway/vpn"
 	pb "tridorian-ztna/internal/proto/gateway/v1"
 	"tridorian-ztna/internal/version"
+	"tridorian-ztna/pkg/portrange"
+	"tridorian-ztna/pkg/posture"
+	"tridorian-ztna/pkg/schedule"
 	"tridorian-ztna/pkg/utils"
 )
 
@@ -28,27 +34,49 @@ func main() {
 	godotenv.Load()
 
 	// Flags
-	nodeIDFlag := flag.String("node-id", "", "The unique Node ID (UUID) for this gateway")
+	enrollTokenFlag := flag.String("enroll-token", "", "One-time enrollment token from the management console, used on first start")
+	caFingerprintFlag := flag.String("ca-fingerprint", "", "SHA-256 fingerprint of the gateway CA, to trust the control plane while enrolling")
+	stateDirFlag := flag.String("state-dir", "", "Directory for the gateway's key and certificates (default /var/lib/tridorian-gateway)")
 	controlPlaneFlag := flag.String("control-plane", "", "The address of the Control Plane (e.g., localhost:5443)")
 	hostnameFlag := flag.String("hostname", "", "The hostname of this gateway")
 	installServiceFlag := flag.Bool("install-service", false, "Install as a systemd service")
+	advertiseRoutesFlag := flag.String("advertise-routes", "", "Comma-separated subnets this gateway reaches, served to the clients of the tenant's other gateways")
+	peerAddressFlag := flag.String("peer-address", "", "host:port where other gateways reach this one's peer tunnel (default: the public address and PEER_PORT)")
+	connectorFlag := flag.Bool("connector", false, "Run as a connector: serve the advertised routes over tunnels opened to the other gateways, without inbound ports or clients")
+	drainTimeoutFlag := flag.Duration("drain-timeout", 0, "How long clients get to move to another gateway on SIGTERM before they are disconnected (default 30s)")
+	networkStateFlag := flag.Bool("network-state", false, "Print the host networking the gateway last applied and exit")
 	flag.Parse()
 
-	// Install Service Mode
-	if *installServiceFlag {
-		installService(*nodeIDFlag, *controlPlaneFlag)
-		return
-	}
-
 	// Configuration Priority: Flag > Env > Default
 	controlPlaneAddr := *controlPlaneFlag
 	if controlPlaneAddr == "" {
 		controlPlaneAddr = utils.GetEnv("CONTROL_PLANE_ADDR", "localhost:5443")
 	}
 
-	nodeID := *nodeIDFlag
-	if nodeID == "" {
-		nodeID = utils.GetEnv("NODE_ID", "")
+	enrollToken := *enrollTokenFlag
+	if enrollToken == "" {
+		enrollToken = utils.GetEnv("ENROLLMENT_TOKEN", "")
+	}
+
+	caFingerprint := *caFingerprintFlag
+	if caFingerprint == "" {
+		caFingerprint = utils.GetEnv("CA_FINGERPRINT", "")
+	}
+
+	stateDir := *stateDirFlag
+	if stateDir == "" {
+		stateDir = utils.GetEnv("GATEWAY_STATE_DIR", "/var/lib/tridorian-gateway")
+	}
+	networkStatePath := filepath.Join(stateDir, "network.json")
+
+	if *networkStateFlag {
+		data, err := os.ReadFile(networkStatePath)
+		if err != nil {
+			log.Fatalf("❌ No network state: %v", err)
+		}
+		os.Stdout.Write(data)
+		fmt.Println()
+		return
 	}
 
 	hostname := *hostnameFlag
@@ -61,89 +89,227 @@ func main() {
 		hostname = h
 	}
 
-	if nodeID == "" {
-		log.Fatal("❌ NODE_ID is required. Use --node-id flag or set NODE_ID environment variable.")
+	advertised := *advertiseRoutesFlag
+	if advertised == "" {
+		advertised = utils.GetEnv("ADVERTISE_ROUTES", "")
+	}
+	advertisedRoutes, err := parseRoutes(advertised)
+	if err != nil {
+		log.Fatalf("❌ Invalid advertised routes: %v", err)
+	}
+
+	connector = *connectorFlag || utils.GetEnv("CONNECTOR", "") == "true"
+	if connector && len(advertisedRoutes) == 0 {
+		log.Fatal("❌ A connector needs --advertise-routes or ADVERTISE_ROUTES")
+	}
+
+	drainTimeout := *drainTimeoutFlag
+	if drainTimeout == 0 {
+		drainTimeout, err = time.ParseDuration(utils.GetEnv("DRAIN_TIMEOUT", "30s"))
+		if err != nil {
+			log.Fatalf("❌ Invalid DRAIN_TIMEOUT: %v", err)
+		}
+	}
+
+	peerPort := utils.GetEnv("PEER_PORT", "6501")
+	peerAddress = *peerAddressFlag
+	if peerAddress == "" {
+		peerAddress = utils.GetEnv("PEER_ADDRESS", ":"+peerPort)
 	}
 
 	// Get Device Hash from actual Hardware
 	deviceHash := getDeviceHash()
 	log.Printf("💻 Device Hash: %s", deviceHash)
 
-	log.Printf("🔌 Connecting to Control Plane at %s...", controlPlaneAddr)
-
-	// Connect to gRPC Server
-	conn, err := grpc.Dial(controlPlaneAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		log.Fatalf("❌ Failed to connect: %v", err)
+	// Enroll on first start, or again with the new token after the node's
+	// enrollment was reset; otherwise the saved certificate is used
+	id, err := loadIdentity(stateDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		if enrollToken == "" {
+			log.Fatalf("❌ Failed to load the gateway certificate from %s: %v", stateDir, err)
+		}
+		log.Printf("⚠️ Failed to load the gateway certificate from %s, enrolling again: %v", stateDir, err)
+	}
+	if enrollToken != "" {
+		log.Printf("📝 Enrolling Gateway with %s [Host: %s]", controlPlaneAddr, hostname)
+		enrolled, err := enroll(controlPlaneAddr, enrollToken, caFingerprint, stateDir, hostname, deviceHash)
+		switch {
+		case err == nil:
+			id = enrolled
+			log.Printf("✅ Enrollment Successful! Certificate saved in %s", stateDir)
+		case id != nil:
+			// Typically a token already used, left in the environment
+			log.Printf("⚠️ Enrollment failed, using the saved certificate: %v", err)
+		default:
+			log.Fatalf("❌ Enrollment failed: %v", err)
+		}
+	} else if id == nil {
+		log.Fatal("❌ This gateway is not enrolled. Use --enroll-token flag or set ENROLLMENT_TOKEN environment variable.")
 	}
-	defer conn.Close()
 
-	client := pb.NewGatewayServiceClient(conn)
+	// Install Service Mode. Enrolled first, so the unit does not carry the
+	// one-time token.
+	if *installServiceFlag {
+		var siteArgs []string
+		if connector {
+			siteArgs = append(siteArgs, " --connector")
+		}
+		if advertised != "" {
+			siteArgs = append(siteArgs, ` --advertise-routes "`+advertised+`"`)
+		}
+		if *peerAddressFlag != "" {
+			siteArgs = append(siteArgs, ` --peer-address "`+*peerAddressFlag+`"`)
+		}
+		installService(controlPlaneAddr, stateDir, siteArgs)
+		return
+	}
 
-	// Register
-	log.Printf("📝 Registering Gateway [NodeID: %s, Host: %s]", nodeID, hostname)
-	// Create context with metadata
-	md := metadata.New(map[string]string{
-		"x-gateway-version": version.Version,
-	})
-	ctx := metadata.NewOutgoingContext(context.Background(), md)
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
+	log.Printf("🔌 Connecting to Control Plane at %s as node %s...", controlPlaneAddr, id.nodeID())
 
-	regResp, err := client.Register(ctx, &pb.RegisterRequest{
-		NodeId:     nodeID,
-		Hostname:   hostname,
-		DeviceHash: deviceHash,
-	})
+	// Connect to gRPC Server, authenticated by the node certificate
+	cp, err := dialControlPlane(controlPlaneAddr, id, deviceHash)
 	if err != nil {
-		log.Fatalf("❌ Registration failed: %v", err)
+		log.Fatalf("❌ Failed to connect: %v", err)
 	}
+	defer cp.Close()
+
+	// SIGTERM drains the gateway, then stops it and undoes its network
+	// changes. The gateway itself runs until the drain is over.
+	signalled, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, shutdown := context.WithCancel(context.Background())
+	defer shutdown()
 
-	token := regResp.AuthToken
-	log.Printf("✅ Registration Successful! Token acquired.")
+	go id.watchRenewal(ctx, cp, time.Hour)
 
 	// Start VPN Server
 	vpnPort := utils.GetEnv("VPN_PORT", "6500")
 	vpnAddr := ":" + vpnPort
 
 	vpnServer := vpn.NewServer(vpnAddr)
-	vpnServer.IPManager = &grpcIPManager{
-		client: client,
-		token:  token,
-	}
+	vpnServer.IPManager = &grpcIPManager{cp: cp}
+	vpnServer.AdvertisedRoutes = advertisedRoutes
+	vpnServer.Connector = connector
+	vpnServer.Network.StatePath = networkStatePath
 	go func() {
-		if err := vpnServer.Start(context.Background()); err != nil {
+		if err := vpnServer.Start(ctx); err != nil {
 			log.Printf("❌ VPN Server failed: %v", err)
 		}
 	}()
 
+	// Tunnel to the tenant's other gateways, for subnets behind other sites
+	if err := vpnServer.StartPeering(ctx, ":"+peerPort, id.certificate, id.ca); err != nil {
+		log.Printf("❌ Peer tunnel failed: %v", err)
+	}
+
 	// Initial Config fetch
-	if err := getAndApplyConfig(client, token, vpnServer); err != nil {
+	if err := getAndApplyConfig(cp.client(), vpnServer); err != nil {
 		log.Printf("❌ Failed to get initial config: %v", err)
 	}
 
+	// Enforce time-based policies on live sessions
+	go vpnServer.WatchSchedules(ctx, 30*time.Second)
+
+	// Keep FQDN destinations resolved and expire stale addresses
+	go vpnServer.WatchFQDNs(ctx, 30*time.Second)
+
+	// Probe application health checks; results go out with each heartbeat
+	go healthProber.Run(ctx, 30*time.Second)
+
+	// Repair addresses, routes, NAT and sysctls changed behind our back
+	go vpnServer.Network.Watch(ctx, time.Minute)
+
 	// Start Heartbeat Loop
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
 	// Initial Heartbeat
-	sendHeartbeat(client, token, vpnServer)
-
-	for range ticker.C {
-		sendHeartbeat(client, token, vpnServer)
+	sendHeartbeat(cp.client(), vpnServer)
+
+	for {
+		select {
+		case <-signalled.Done():
+			// A second signal stops the gateway right away
+			stop()
+			drain(cp.client(), vpnServer, drainTimeout)
+			shutdown()
+
+			log.Println("🛑 Shutting down, removing network changes...")
+			if err := vpnServer.Network.Teardown(); err != nil {
+				log.Printf("⚠️ Network teardown incomplete: %v", err)
+			}
+			return
+		case <-ticker.C:
+			sendHeartbeat(cp.client(), vpnServer)
+		}
 	}
 }
 
 var currentConfigHash = "none"
 
-func sendHeartbeat(client pb.GatewayServiceClient, token string, vpnServer *vpn.Server) {
+// peerAddress is reported to the control plane for the other gateways,
+// unless the gateway is a connector, which they cannot reach.
+var peerAddress string
+
+var connector bool
+
+// drain moves the gateway's clients to other gateways before it stops. The
+// control plane is told first, so it offers the node to no one, then the
+// clients are asked to reconnect elsewhere and given until timeout to
+// leave. Heartbeats go on meanwhile, so the node is not taken for failed.
+func drain(client pb.GatewayServiceClient, vpnServer *vpn.Server, timeout time.Duration) {
+	log.Printf("🚰 Draining: clients have %s to move to another gateway", timeout)
+	vpnServer.StopAccepting()
+	sendHeartbeat(client, vpnServer)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		vpnServer.Drain(ctx)
+		close(done)
+	}()
+
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			sendHeartbeat(client, vpnServer)
+		}
+	}
+}
+
+var healthProber = healthcheck.NewProber()
+
+func sendHeartbeat(client pb.GatewayServiceClient, vpnServer *vpn.Server) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	var appHealth []*pb.HeartbeatRequest_AppHealth
+	for _, r := range healthProber.Results() {
+		appHealth = append(appHealth, &pb.HeartbeatRequest_AppHealth{
+			ApplicationId: r.ApplicationID,
+			Healthy:       r.Healthy,
+			LatencyMs:     r.Latency.Milliseconds(),
+			Error:         r.Error,
+			CheckedAt:     r.CheckedAt.Unix(),
+		})
+	}
+
+	status := "ONLINE"
+	if vpnServer.Draining() {
+		status = "DRAINING"
+	}
 	resp, err := client.Heartbeat(ctx, &pb.HeartbeatRequest{
-		AuthToken:  token,
-		Status:     "ONLINE",
-		ConfigHash: currentConfigHash,
+		Status:           status,
+		ConfigHash:       currentConfigHash,
+		AppHealth:        appHealth,
+		AdvertisedRoutes: routeStrings(vpnServer.AdvertisedRoutes),
+		PeerAddress:      peerAddress,
+		Connector:        connector,
 	})
 
 	if err != nil {
@@ -160,11 +326,11 @@ func sendHeartbeat(client pb.GatewayServiceClient, token string, vpnServer *vpn.
 				UserEmail:   s.Email,
 				IpAddress:   s.IPAddress,
 				ConnectedAt: s.ConnectedAt,
+				DeviceId:    s.DeviceID,
 			})
 		}
 		_, err := client.SyncSessions(ctx, &pb.SyncSessionsRequest{
-			AuthToken: token,
-			Sessions:  pbSessions,
+			Sessions: pbSessions,
 		})
 		if err != nil {
 			log.Printf("❌ Session sync failed: %v", err)
@@ -172,18 +338,18 @@ func sendHeartbeat(client pb.GatewayServiceClient, token string, vpnServer *vpn.
 
 		if resp.ConfigUpdateAvailable {
 			log.Printf("📥 Config update available, pulling...")
-			if err := getAndApplyConfig(client, token, vpnServer); err != nil {
+			if err := getAndApplyConfig(client, vpnServer); err != nil {
 				log.Printf("❌ Failed to update config: %v", err)
 			}
 		}
 	}
 }
 
-func getAndApplyConfig(client pb.GatewayServiceClient, token string, vpnServer *vpn.Server) error {
+func getAndApplyConfig(client pb.GatewayServiceClient, vpnServer *vpn.Server) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	resp, err := client.GetConfig(ctx, &pb.GetConfigRequest{AuthToken: token})
+	resp, err := client.GetConfig(ctx, &pb.GetConfigRequest{})
 	if err != nil {
 		return err
 	}
@@ -201,6 +367,34 @@ func getAndApplyConfig(client pb.GatewayServiceClient, token string, vpnServer *
 	// 2. Update Firewall Policies
 	var policies []firewall.ConditionalAccessPolicy
 	for _, p := range resp.Policies {
+		var timeConditions []schedule.Condition
+		for _, t := range p.TimeConditions {
+			timeConditions = append(timeConditions, schedule.Condition{
+				Field:    t.Field,
+				Op:       t.Op,
+				Value:    t.Value,
+				Timezone: t.Timezone,
+			})
+		}
+
+		var deviceConditions []posture.Condition
+		for _, d := range p.DeviceConditions {
+			deviceConditions = append(deviceConditions, posture.Condition{
+				Field: d.Field,
+				Op:    d.Op,
+				Value: d.Value,
+			})
+		}
+
+		var ports []portrange.Range
+		for _, r := range p.Ports {
+			ports = append(ports, portrange.Range{
+				Protocol: r.Protocol,
+				From:     uint16(r.From),
+				To:       uint16(r.To),
+			})
+		}
+
 		policies = append(policies, firewall.ConditionalAccessPolicy{
 			Name:                  p.Name,
 			Action:                p.Action,
@@ -209,6 +403,9 @@ func getAndApplyConfig(client pb.GatewayServiceClient, token string, vpnServer *
 			DestinationTagType:    p.DestinationTagType,
 			DestinationMatchValue: p.DestinationMatchValue,
 			Priority:              int(p.Priority),
+			TimeConditions:        timeConditions,
+			DeviceConditions:      deviceConditions,
+			Ports:                 ports,
 		})
 	}
 
@@ -218,14 +415,68 @@ func getAndApplyConfig(client pb.GatewayServiceClient, token string, vpnServer *
 			BlockByDefault: true,
 		},
 		ConditionalAccessPolicies: policies,
+		BlockedDeviceIDs:          resp.BlockedDeviceIds,
+		RevokedUserEmails:         resp.RevokedUserEmails,
+		RevokedSessions:           resp.RevokedSessions,
 	}
 
 	// Re-init Engine
 	firewall.NewEngine()
 
+	// Application health checks
+	targets := make(map[string]string, len(resp.HealthChecks))
+	for _, c := range resp.HealthChecks {
+		targets[c.ApplicationId] = c.Target
+	}
+	healthProber.SetTargets(targets)
+
+	// Split DNS for the internal domains, served by the forwarder on the tunnel address
+	if dns := resp.Dns; dns != nil {
+		vpnServer.UpdateDNS(&vpn.DNSConfig{
+			Domains:        dns.Domains,
+			Resolvers:      dns.Resolvers,
+			SearchSuffixes: dns.SearchSuffixes,
+		})
+	} else {
+		vpnServer.UpdateDNS(nil)
+	}
+
+	// Other sites' gateways, for the subnets they advertise
+	var peers []vpn.Peer
+	for _, p := range resp.Peers {
+		peer := vpn.Peer{NodeID: p.NodeId, Address: p.Address, CertSerial: p.CertSerial}
+		peer.Routes, _ = parseRoutes(strings.Join(p.Routes, ","))
+		peer.ClientPool, _ = netip.ParsePrefix(p.ClientPool)
+		peers = append(peers, peer)
+	}
+	vpnServer.UpdatePeers(peers)
+
+	// Drop live sessions from devices blocked, users deprovisioned or sessions
+	// revoked by an administrator since they connected
+	vpnServer.DisconnectRevokedSessions()
+
+	// Resolve FQDN destinations so the broadcast below already includes them
+	vpnServer.ResolveFQDNs(ctx)
+
 	// 3. Broadcast Config/Route updates to connected clients
 	vpnServer.BroadcastRouteUpdates()
 
+	// NAT for client traffic leaving the gateway. On failure the config is
+	// pulled again with the next heartbeat
+	egress := vpn.Egress{Mode: resp.Egress.GetMode()}
+	for _, p := range resp.Egress.GetSnatPools() {
+		dst, err := netip.ParsePrefix(p.Destination)
+		if err != nil {
+			currentConfigHash = "none"
+			return fmt.Errorf("invalid SNAT destination %q: %v", p.Destination, err)
+		}
+		egress.SNAT = append(egress.SNAT, vpn.SNATPool{Destination: dst, Source: p.Source})
+	}
+	if err := vpnServer.UpdateEgress(egress); err != nil {
+		currentConfigHash = "none"
+		return err
+	}
+
 	return nil
 }
 
@@ -261,13 +512,11 @@ func getDeviceHash() string {
 }
 
 type grpcIPManager struct {
-	client pb.GatewayServiceClient
-	token  string
+	cp *controlPlane
 }
 
 func (m *grpcIPManager) AssignIP(ctx context.Context, userID, email string) (string, error) {
-	resp, err := m.client.GetSessionIP(ctx, &pb.GetSessionIPRequest{
-		AuthToken: m.token,
+	resp, err := m.cp.client().GetSessionIP(ctx, &pb.GetSessionIPRequest{
 		UserId:    userID,
 		UserEmail: email,
 	})
@@ -285,3 +534,27 @@ func (m *grpcIPManager) ReleaseIP(ctx context.Context, ip, email string) {
 func (m *grpcIPManager) SyncSessions(ctx context.Context, sessions []vpn.SessionInfo) {
 	// Handled in heartbeat loop
 }
+
+// parseRoutes parses a comma-separated list of IPv4 subnets.
+func parseRoutes(list string) ([]netip.Prefix, error) {
+	var routes []netip.Prefix
+	for _, r := range strings.Split(list, ",") {
+		if r = strings.TrimSpace(r); r == "" {
+			continue
+		}
+		prefix, err := netip.ParsePrefix(r)
+		if err != nil || !prefix.Addr().Is4() {
+			return nil, fmt.Errorf("invalid subnet %q", r)
+		}
+		routes = append(routes, prefix.Masked())
+	}
+	return routes, nil
+}
+
+func routeStrings(routes []netip.Prefix) []string {
+	var out []string
+	for _, r := range routes {
+		out = append(out, r.String())
+	}
+	return out
+}
@@ -4,13 +4,13 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"strings"
 )
 
-func installService(nodeID, controlPlaneAddr string) {
-	if nodeID == "" {
-		log.Fatal("❌ --node-id is required for installation")
-	}
-
+// installService runs the enrolled gateway as a systemd service. The unit
+// points at the state directory holding the gateway's certificate, and
+// carries the site routing flags in siteArgs.
+func installService(controlPlaneAddr, stateDir string, siteArgs []string) {
 	exePath, err := os.Executable()
 	if err != nil {
 		log.Fatalf("❌ Failed to get executable path: %v", err)
@@ -27,7 +27,7 @@ After=network.target
 
 [Service]
 Type=simple
-ExecStart=` + exePath + ` --node-id "` + nodeID + `" --control-plane "` + controlPlaneAddr + `"
+ExecStart=` + exePath + ` --control-plane "` + controlPlaneAddr + `" --state-dir "` + stateDir + `"` + strings.Join(siteArgs, "") + `
 Restart=always
 RestartSec=5
 User=root
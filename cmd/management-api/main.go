@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"time"
 	"tridorian-ztna/internal/api/auth"
 	"tridorian-ztna/internal/api/mgmt"
+	"tridorian-ztna/internal/api/scim"
 	"tridorian-ztna/internal/infrastructure"
+	"tridorian-ztna/internal/services"
 	"tridorian-ztna/internal/version"
 	"tridorian-ztna/pkg/utils"
 
@@ -54,11 +58,20 @@ func main() {
 	// Routers
 	mgmtRouter := mgmt.NewRouter(db, valkey, privKey, pubKey)
 	authRouter := auth.NewRouter(db, valkey, nil, privKey, pubKey)
+	scimRouter := scim.NewRouter(db, valkey)
+
+	// Mirror Google Workspace directories into the local directory
+	syncInterval, err := time.ParseDuration(utils.GetEnv("DIRECTORY_SYNC_INTERVAL", "15m"))
+	if err != nil {
+		log.Fatalf("invalid DIRECTORY_SYNC_INTERVAL: %v", err)
+	}
+	go services.NewDirectorySyncService(db, valkey).Run(context.Background(), syncInterval)
 
 	// Combine routers
 	mainMux := http.NewServeMux()
 	mainMux.Handle("/api/", mgmtRouter)
 	mainMux.Handle("/auth/", authRouter)
+	mainMux.Handle("/scim/", scimRouter)
 	mainMux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
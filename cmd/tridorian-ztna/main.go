@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net"
 	"net/http"
+	"strings"
+	"time"
 	"tridorian-ztna/internal/api/auth"
 	"tridorian-ztna/internal/api/mgmt"
+	"tridorian-ztna/internal/api/scim"
 	"tridorian-ztna/internal/grpc/gateway"
 	"tridorian-ztna/internal/infrastructure"
 	pb "tridorian-ztna/internal/proto/gateway/v1"
@@ -16,6 +20,7 @@ import (
 
 	"github.com/joho/godotenv"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 func main() {
@@ -59,11 +64,20 @@ func main() {
 
 	mgmtRouter := mgmt.NewRouter(db, valkey, privKey, pubKey)
 	authRouter := auth.NewRouter(db, valkey, nil, privKey, pubKey)
+	scimRouter := scim.NewRouter(db, valkey)
+
+	// Mirror Google Workspace directories into the local directory
+	syncInterval, err := time.ParseDuration(utils.GetEnv("DIRECTORY_SYNC_INTERVAL", "15m"))
+	if err != nil {
+		log.Fatalf("invalid DIRECTORY_SYNC_INTERVAL: %v", err)
+	}
+	go services.NewDirectorySyncService(db, valkey).Run(context.Background(), syncInterval)
 
 	// Combine routers
 	mainMux := http.NewServeMux()
 	mainMux.Handle("/api/", mgmtRouter)
 	mainMux.Handle("/auth/", authRouter)
+	mainMux.Handle("/scim/", scimRouter)
 	mainMux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
@@ -79,8 +93,26 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	grpcServer := grpc.NewServer()
-	gatewayServer := gateway.NewServer(nodeService, policyService, pubPEM)
+	deviceService := services.NewDeviceService(db, valkey)
+	tenantService := services.NewTenantService(db)
+	applicationService := services.NewApplicationService(db, valkey)
+	directoryService := services.NewDirectoryService(db, valkey)
+	sessionService := services.NewSessionService(db, valkey)
+	gatewayServer := gateway.NewServer(nodeService, policyService, deviceService, tenantService, applicationService, directoryService, sessionService, pubPEM)
+
+	// Gateways enroll for a client certificate signed by the gateway CA and
+	// authenticate every other call with it over mutual TLS
+	ca := nodeService.CA()
+	if ca == nil || ca.Key == nil {
+		log.Fatal("❌ GATEWAY_CA_CERT and GATEWAY_CA_KEY environment variables are required. Run: ./scripts/generate-keys.sh")
+	}
+	tlsConfig, err := gateway.TLSConfig(ca, utils.GetEnv("GRPC_TLS_CERT", ""), utils.GetEnv("GRPC_TLS_KEY", ""), strings.Split(utils.GetEnv("GRPC_TLS_HOSTS", "localhost"), ","))
+	if err != nil {
+		log.Fatalf("❌ gRPC TLS: %v", err)
+	}
+	log.Printf("🔏 Gateway CA fingerprint: %s", ca.Fingerprint())
+
+	grpcServer := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)), grpc.UnaryInterceptor(gatewayServer.UnaryAuthInterceptor))
 	pb.RegisterGatewayServiceServer(grpcServer, gatewayServer)
 
 	log.Printf("🔌 gRPC Gateway Server starting on :%s", grpcPort)
@@ -0,0 +1,568 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document kinds apply accepts.
+const (
+	kindApplication  = "Application"
+	kindAccessPolicy = "AccessPolicy"
+	kindSignInPolicy = "SignInPolicy"
+)
+
+// kindPaths are the API paths of each kind. Applications come first so
+// policies can name applications created by the same apply.
+var kindPaths = []struct {
+	kind string
+	path string
+}{
+	{kindApplication, "/api/v1/applications"},
+	{kindAccessPolicy, "/api/v1/policies/access"},
+	{kindSignInPolicy, "/api/v1/policies/sign-in"},
+}
+
+// kindFields are the fields each kind's documents may set. Access policies
+// name their destination application and nodes rather than giving IDs.
+var kindFields = map[string][]string{
+	kindApplication: {"name", "description", "owner", "tags", "ports", "health_check", "destinations"},
+	kindAccessPolicy: {"name", "priority", "enabled", "effect", "resource_type", "resource_id",
+		"destination_type", "destination_cidr", "destination_app", "destination_app_tag",
+		"destination_sni", "destination_fqdn", "nodes", "root_node"},
+	kindSignInPolicy: {"name", "priority", "enabled", "stage", "block", "root_node"},
+}
+
+// document is one resource read from a file.
+type document struct {
+	kind   string
+	name   string
+	source string
+	fields map[string]any // Everything but kind
+}
+
+// applyResult is what apply did with one document.
+type applyResult struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Action string `json:"action"` // "created", "updated" or "unchanged"
+	ID     string `json:"id,omitempty"`
+	DryRun bool   `json:"dry_run,omitempty"`
+}
+
+func runApply(c *cli, args []string) error {
+	fs := c.flags("apply", "-f FILE|DIR|- ...")
+	var files stringList
+	fs.Var(&files, "f", "YAML or JSON file, directory of them, or - for standard input (repeatable)")
+	dryRun := fs.Bool("dry-run", false, "Show what would change without changing anything")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return usagef("-f is required")
+	}
+
+	docs, err := readDocuments(files)
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return errors.New("no documents found")
+	}
+
+	a := &applier{c: c, dryRun: *dryRun, existing: map[string][]map[string]any{}}
+	var results []applyResult
+	var applyErr error
+	for _, kp := range kindPaths {
+		for _, doc := range docs {
+			if doc.kind != kp.kind {
+				continue
+			}
+			result, err := a.apply(doc, kp.path)
+			if err != nil {
+				applyErr = fmt.Errorf("%s: %s %q: %w", doc.source, doc.kind, doc.name, err)
+				break
+			}
+			results = append(results, *result)
+		}
+		if applyErr != nil {
+			break
+		}
+	}
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	if len(results) > 0 {
+		if err := c.print(data, []column{{"KIND", "kind"}, {"NAME", "name"}, {"ACTION", "action"}, {"ID", "id"}}); err != nil {
+			return err
+		}
+	}
+	if applyErr == nil && *dryRun && c.output == outputTable {
+		fmt.Fprintln(os.Stderr, "Dry run: nothing was changed.")
+	}
+	return applyErr
+}
+
+// readDocuments reads every document in the files. Directories contribute
+// their .yaml, .yml and .json files in name order.
+func readDocuments(paths []string) ([]document, error) {
+	var docs []document
+	seen := map[string]string{}
+	for _, path := range paths {
+		files := []string{path}
+		if path != "-" {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if info.IsDir() {
+				entries, err := os.ReadDir(path)
+				if err != nil {
+					return nil, err
+				}
+				files = nil
+				for _, e := range entries {
+					switch strings.ToLower(filepath.Ext(e.Name())) {
+					case ".yaml", ".yml", ".json":
+						if !e.IsDir() {
+							files = append(files, filepath.Join(path, e.Name()))
+						}
+					}
+				}
+			}
+		}
+
+		for _, file := range files {
+			var data []byte
+			var err error
+			if file == "-" {
+				data, err = io.ReadAll(os.Stdin)
+				file = "<stdin>"
+			} else {
+				data, err = os.ReadFile(file)
+			}
+			if err != nil {
+				return nil, err
+			}
+			fileDocs, err := parseDocuments(file, data)
+			if err != nil {
+				return nil, err
+			}
+			for _, doc := range fileDocs {
+				key := doc.kind + "/" + doc.name
+				if prev, ok := seen[key]; ok {
+					return nil, fmt.Errorf("%s: %s %q is also defined in %s", doc.source, doc.kind, doc.name, prev)
+				}
+				seen[key] = doc.source
+				docs = append(docs, doc)
+			}
+		}
+	}
+	return docs, nil
+}
+
+// parseDocuments reads YAML documents separated by "---", or JSON, which is
+// YAML too. A document may also be a list of documents.
+func parseDocuments(source string, data []byte) ([]document, error) {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	var docs []document
+	for {
+		var v any
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", source, err)
+		}
+		items, ok := v.([]any)
+		if !ok {
+			items = []any{v}
+		}
+		for _, item := range items {
+			if item == nil {
+				continue
+			}
+			doc, err := newDocument(source, item)
+			if err != nil {
+				return nil, err
+			}
+			docs = append(docs, doc)
+		}
+	}
+	return docs, nil
+}
+
+func newDocument(source string, v any) (document, error) {
+	// A round trip through JSON gives the types the API responses decode to
+	data, err := json.Marshal(v)
+	if err != nil {
+		return document{}, fmt.Errorf("%s: %w", source, err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return document{}, fmt.Errorf("%s: every document must be an object", source)
+	}
+
+	kind, _ := fields["kind"].(string)
+	allowed, ok := kindFields[kind]
+	if !ok {
+		return document{}, fmt.Errorf("%s: kind must be %s, %s or %s", source, kindApplication, kindAccessPolicy, kindSignInPolicy)
+	}
+	name, _ := fields["name"].(string)
+	if name == "" {
+		return document{}, fmt.Errorf("%s: %s without a name", source, kind)
+	}
+	delete(fields, "kind")
+	for key := range fields {
+		if !slices.Contains(allowed, key) {
+			return document{}, fmt.Errorf("%s: %s %q: unknown field %q", source, kind, name, key)
+		}
+	}
+	return document{kind: kind, name: name, source: source, fields: fields}, nil
+}
+
+// applier creates or updates documents, matching existing resources by name.
+type applier struct {
+	c        *cli
+	dryRun   bool
+	existing map[string][]map[string]any // By kind, and "Node"
+}
+
+func (a *applier) load(kind, path string) ([]map[string]any, error) {
+	if items, ok := a.existing[kind]; ok {
+		return items, nil
+	}
+	items, err := a.c.list(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	a.existing[kind] = items
+	return items, nil
+}
+
+func (a *applier) apply(doc document, path string) (*applyResult, error) {
+	items, err := a.load(doc.kind, path)
+	if err != nil {
+		return nil, err
+	}
+	var current map[string]any
+	for _, item := range items {
+		if item["name"] == doc.name {
+			if current != nil {
+				return nil, errors.New("several exist with this name: rename or delete the extras first")
+			}
+			current = item
+		}
+	}
+
+	desired, body, err := a.desired(doc)
+	if err != nil {
+		return nil, err
+	}
+	result := &applyResult{Kind: doc.kind, Name: doc.name, Action: "created", DryRun: a.dryRun}
+	method := "POST"
+	if current != nil {
+		result.ID, _ = current["id"].(string)
+		if reflect.DeepEqual(normalize(desired), normalize(canonical(doc.kind, current))) {
+			result.Action = "unchanged"
+			return result, nil
+		}
+		result.Action = "updated"
+		method = "PUT"
+		body["id"] = result.ID
+	}
+	if a.dryRun {
+		if current == nil {
+			a.existing[doc.kind] = append(items, map[string]any{"name": doc.name})
+		}
+		result.Action += " (dry run)"
+		return result, nil
+	}
+
+	api, err := a.c.client()
+	if err != nil {
+		return nil, err
+	}
+	var saved map[string]any
+	if err := api.call(method, path, nil, body, &saved); err != nil {
+		return nil, err
+	}
+	if current == nil {
+		result.ID, _ = saved["id"].(string)
+		a.existing[doc.kind] = append(items, map[string]any{"id": result.ID, "name": doc.name})
+	}
+	return result, nil
+}
+
+// desired returns the document in canonical form, for comparison with the
+// existing resource, and the API request body for it.
+func (a *applier) desired(doc document) (map[string]any, map[string]any, error) {
+	canonical := map[string]any{}
+	for key, value := range doc.fields {
+		canonical[key] = value
+	}
+
+	switch doc.kind {
+	case kindApplication:
+		for _, key := range []string{"tags", "ports"} {
+			list, err := stringsOf(canonical[key])
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", key, err)
+			}
+			canonical[key] = list
+		}
+		if dests, ok := canonical["destinations"].([]any); ok {
+			canonical["destinations"] = pickEach(dests, "type", "value")
+		}
+		return canonical, cloneMap(canonical), nil
+
+	case kindAccessPolicy, kindSignInPolicy:
+		if _, ok := canonical["enabled"]; !ok {
+			canonical["enabled"] = true
+		}
+		canonical["root_node"] = cleanTree(canonical["root_node"])
+	}
+	if doc.kind == kindSignInPolicy {
+		return canonical, cloneMap(canonical), nil
+	}
+
+	body := cloneMap(canonical)
+	delete(body, "destination_app")
+	delete(body, "nodes")
+	if ref, _ := canonical["destination_app"].(string); ref != "" {
+		apps, err := a.load(kindApplication, "/api/v1/applications")
+		if err != nil {
+			return nil, nil, err
+		}
+		app, err := findIn("application", apps, ref, "name")
+		if err != nil {
+			return nil, nil, err
+		}
+		canonical["destination_app"] = app["name"]
+		body["destination_app_id"] = app["id"]
+	}
+	refs, err := stringsOf(canonical["nodes"])
+	if err != nil {
+		return nil, nil, fmt.Errorf("nodes: %w", err)
+	}
+	names := []string{}
+	ids := []string{}
+	if len(refs) > 0 {
+		nodes, err := a.load("Node", "/api/v1/nodes")
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, ref := range refs {
+			node, err := findIn("node", nodes, ref, "name")
+			if err != nil {
+				return nil, nil, err
+			}
+			names = append(names, node["name"].(string))
+			ids = append(ids, node["id"].(string))
+		}
+	}
+	sort.Strings(names)
+	canonical["nodes"] = names
+	body["node_ids"] = ids
+	return canonical, body, nil
+}
+
+// canonical returns an existing resource in document form.
+func canonical(kind string, item map[string]any) map[string]any {
+	doc := map[string]any{}
+	for _, key := range kindFields[kind] {
+		if v, ok := item[key]; ok {
+			doc[key] = v
+		}
+	}
+
+	switch kind {
+	case kindApplication:
+		for _, key := range []string{"tags", "ports"} {
+			list, _ := stringsOf(item[key])
+			doc[key] = list
+		}
+		if dests, ok := item["destinations"].([]any); ok {
+			doc["destinations"] = pickEach(dests, "type", "value")
+		}
+		return doc
+	case kindAccessPolicy:
+		doc["destination_app"] = lookup(item, "destination_app.name")
+		var names []string
+		if nodes, ok := item["nodes"].([]any); ok {
+			for _, n := range nodes {
+				if name, ok := lookup(n, "name").(string); ok {
+					names = append(names, name)
+				}
+			}
+		}
+		sort.Strings(names)
+		doc["nodes"] = names
+	}
+	doc["root_node"] = cleanTree(item["root_node"])
+	return doc
+}
+
+// cleanTree keeps only what defines a policy rule tree, dropping IDs and
+// timestamps. Condition values given as lists are joined with commas.
+func cleanTree(v any) any {
+	node, ok := v.(map[string]any)
+	if !ok {
+		return nil
+	}
+	out := map[string]any{}
+	if op, ok := node["operator"]; ok {
+		out["operator"] = op
+	}
+	if children, ok := node["children"].([]any); ok {
+		cleaned := make([]any, 0, len(children))
+		for _, child := range children {
+			if c := cleanTree(child); c != nil {
+				cleaned = append(cleaned, c)
+			}
+		}
+		out["children"] = cleaned
+	}
+	if cond, ok := node["condition"].(map[string]any); ok {
+		c := pick(cond, "type", "field", "op", "value", "timezone")
+		switch value := c["value"].(type) {
+		case []any:
+			parts, _ := stringsOf(value)
+			c["value"] = strings.Join(parts, ",")
+		case float64, bool:
+			c["value"] = cell(value)
+		}
+		out["condition"] = c
+	}
+	return out
+}
+
+func pick(m map[string]any, keys ...string) map[string]any {
+	out := map[string]any{}
+	for _, key := range keys {
+		if v, ok := m[key]; ok {
+			out[key] = v
+		}
+	}
+	return out
+}
+
+// pickEach picks keys from each object of a list, sorted so that order does
+// not count as a change.
+func pickEach(list []any, keys ...string) []any {
+	out := make([]any, 0, len(list))
+	for _, item := range list {
+		if m, ok := item.(map[string]any); ok {
+			out = append(out, pick(m, keys...))
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		a, _ := json.Marshal(out[i])
+		b, _ := json.Marshal(out[j])
+		return string(a) < string(b)
+	})
+	return out
+}
+
+// stringsOf accepts a list of strings or a comma separated string.
+func stringsOf(v any) ([]string, error) {
+	var parts []string
+	switch v := v.(type) {
+	case nil:
+	case string:
+		parts = strings.Split(v, ",")
+	case []any:
+		for _, e := range v {
+			switch e := e.(type) {
+			case string:
+				parts = append(parts, e)
+			case float64:
+				parts = append(parts, strconv.FormatFloat(e, 'f', -1, 64))
+			default:
+				return nil, fmt.Errorf("expected a list of strings")
+			}
+		}
+	default:
+		return nil, fmt.Errorf("expected a list of strings")
+	}
+	out := []string{}
+	for _, p := range parts {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out, nil
+}
+
+func cloneMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+// normalize drops empty values, so a field left out of a document matches
+// one the API leaves out of its response. Lists of strings are compared as
+// []any.
+func normalize(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := map[string]any{}
+		for k, e := range v {
+			if n := normalize(e); n != nil {
+				out[k] = n
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	case []any:
+		if len(v) == 0 {
+			return nil
+		}
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = normalize(e)
+		}
+		return out
+	case []string:
+		if len(v) == 0 {
+			return nil
+		}
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = e
+		}
+		return out
+	case string:
+		if v == "" {
+			return nil
+		}
+	case bool:
+		if !v {
+			return nil
+		}
+	case float64:
+		if v == 0 {
+			return nil
+		}
+	}
+	return v
+}
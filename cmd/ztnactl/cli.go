@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+)
+
+var errFlagParse = errors.New("invalid flags")
+
+// cli holds the flags every command accepts and the stored login.
+type cli struct {
+	stdout io.Writer
+	output string
+	server string
+	token  string
+
+	cfg *config
+	api *apiClient
+}
+
+// flags returns a flag set for the command with the common flags added.
+// Usage describes the arguments, e.g. "NAME|ID".
+func (c *cli) flags(name, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	fs.StringVar(&c.output, "o", outputTable, "Output format: table, json or yaml")
+	fs.StringVar(&c.server, "server", "", "Management API URL (default: the stored login's)")
+	fs.StringVar(&c.token, "token", "", "Session token (default: the stored login's)")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: ztnactl %s [flags] %s\n\nFlags:\n", name, usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parse parses the command's flags. Flags may come before and after the
+// arguments; wantArgs is how many arguments the command takes, or -1 for
+// any number.
+func (c *cli) parse(fs *flag.FlagSet, args []string, wantArgs int) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errFlagParse
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+	if wantArgs >= 0 && len(positional) != wantArgs {
+		fs.Usage()
+		return nil, errFlagParse
+	}
+	switch c.output {
+	case outputTable, outputJSON, outputYAML:
+	default:
+		return nil, usagef("unknown output format %q: use table, json or yaml", c.output)
+	}
+	return positional, nil
+}
+
+// client returns an API client for the stored login, with the --server and
+// --token flags and the ZTNACTL_SERVER and ZTNACTL_TOKEN variables taking
+// precedence.
+func (c *cli) client() (*apiClient, error) {
+	if c.api != nil {
+		return c.api, nil
+	}
+	cfg, err := c.config()
+	if err != nil {
+		return nil, err
+	}
+	server := firstNonEmpty(c.server, os.Getenv("ZTNACTL_SERVER"), cfg.Server)
+	token := firstNonEmpty(c.token, os.Getenv("ZTNACTL_TOKEN"), cfg.Token)
+	if server == "" || token == "" {
+		return nil, errNotLoggedIn
+	}
+	authServer := cfg.AuthServer
+	if server != cfg.Server {
+		authServer = ""
+	}
+	c.api = newAPIClient(server, authServer, token)
+	return c.api, nil
+}
+
+func (c *cli) config() (*config, error) {
+	if c.cfg == nil {
+		cfg, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+		c.cfg = cfg
+	}
+	return c.cfg, nil
+}
+
+// get fetches a path and prints the response.
+func (c *cli) get(path string, query url.Values, columns []column) error {
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+	var data json.RawMessage
+	if err := api.call("GET", path, query, nil, &data); err != nil {
+		return err
+	}
+	return c.print(data, columns)
+}
+
+// send makes a change and prints the response.
+func (c *cli) send(method, path string, body any, columns []column) error {
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+	var data json.RawMessage
+	if err := api.call(method, path, nil, body, &data); err != nil {
+		return err
+	}
+	return c.print(data, columns)
+}
+
+func (c *cli) print(data json.RawMessage, columns []column) error {
+	return printData(c.stdout, c.output, data, columns)
+}
+
+// list fetches a list of resources.
+func (c *cli) list(path string, query url.Values) ([]map[string]any, error) {
+	api, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]any
+	if err := api.call("GET", path, query, nil, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// find returns the resource at path whose ID, or whose value of one of the
+// keys, is ref. A name shared by several resources must be given by ID.
+func (c *cli) find(kind, path string, ref string, keys ...string) (map[string]any, error) {
+	items, err := c.list(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return findIn(kind, items, ref, keys...)
+}
+
+func findIn(kind string, items []map[string]any, ref string, keys ...string) (map[string]any, error) {
+	var matches []map[string]any
+	for _, item := range items {
+		if id, _ := item["id"].(string); id == ref {
+			return item, nil
+		}
+		for _, key := range keys {
+			if v, _ := item[key].(string); v != "" && strings.EqualFold(v, ref) {
+				matches = append(matches, item)
+				break
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%s %q not found", kind, ref)
+	case 1:
+		return matches[0], nil
+	default:
+		return nil, fmt.Errorf("%d %ss are named %q: use the ID", len(matches), kind, ref)
+	}
+}
+
+// resolveIDs turns names or IDs of resources at path into IDs.
+func (c *cli) resolveIDs(kind, path string, refs []string) ([]string, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	items, err := c.list(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		item, err := findIn(kind, items, ref, "name")
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, item["id"].(string))
+	}
+	return ids, nil
+}
+
+// stringList is a repeatable flag that also accepts comma separated values.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			*l = append(*l, v)
+		}
+	}
+	return nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// apiError is an error response from the API.
+type apiError struct {
+	Status  int
+	Message string
+}
+
+func (e *apiError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("request failed: %d %s", e.Status, http.StatusText(e.Status))
+	}
+	return e.Message
+}
+
+var errNotLoggedIn = errors.New("not logged in: run ztnactl login")
+
+// apiClient calls the Management and Authentication APIs with a session
+// token. Paths under /auth/ go to the Authentication API.
+type apiClient struct {
+	server     string
+	authServer string
+	token      string
+	http       *http.Client
+}
+
+func newAPIClient(server, authServer, token string) *apiClient {
+	server = strings.TrimRight(server, "/")
+	authServer = strings.TrimRight(authServer, "/")
+	if authServer == "" {
+		authServer = server
+	}
+	return &apiClient{
+		server:     server,
+		authServer: authServer,
+		token:      token,
+		http:       &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// envelope is the common response body of both APIs.
+type envelope struct {
+	Success bool            `json:"success"`
+	Data    json.RawMessage `json:"data"`
+	Error   string          `json:"error"`
+}
+
+// send makes a request and unwraps the response envelope. The response is
+// returned so callers can read cookies.
+func (c *apiClient) send(method, path string, query url.Values, body any) (json.RawMessage, *http.Response, error) {
+	base := c.server
+	if strings.HasPrefix(path, "/auth/") {
+		base = c.authServer
+	}
+	if base == "" {
+		return nil, nil, errors.New("no server configured: run ztnactl login --server URL")
+	}
+	target := base + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, target, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "ztnactl")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp, err
+	}
+
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		// Routers answer unknown paths and methods without a body
+		return nil, resp, &apiError{Status: resp.StatusCode}
+	}
+	if resp.StatusCode >= 400 || !env.Success {
+		return nil, resp, &apiError{Status: resp.StatusCode, Message: env.Error}
+	}
+	return env.Data, resp, nil
+}
+
+// call makes a request and decodes the response data into out, unless out
+// is nil.
+func (c *apiClient) call(method, path string, query url.Values, body, out any) error {
+	data, _, err := c.send(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if raw, ok := out.(*json.RawMessage); ok {
+		*raw = data
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// download fetches a path whose response is not wrapped in an envelope.
+func (c *apiClient) download(path string, query url.Values, w io.Writer) error {
+	target := c.server + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "ztnactl")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := (&http.Client{}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		var env envelope
+		json.NewDecoder(resp.Body).Decode(&env)
+		return &apiError{Status: resp.StatusCode, Message: env.Error}
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
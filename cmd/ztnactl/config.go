@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Realms a stored login can belong to.
+const (
+	realmManagement = "mgmt"
+	realmBackoffice = "backoffice"
+)
+
+// config is the stored login. The token is a session token issued by the
+// Authentication API; it expires with the session and is replaced by the next
+// login.
+type config struct {
+	Server     string `json:"server"`                // Management API base URL
+	AuthServer string `json:"auth_server,omitempty"` // Authentication API base URL when it is not the Management API's
+	Realm      string `json:"realm"`                 // realmManagement or realmBackoffice
+	Email      string `json:"email"`
+	Token      string `json:"token"`
+}
+
+// configPath is $ZTNACTL_CONFIG, or ztnactl/config.json in the user's
+// configuration directory.
+func configPath() (string, error) {
+	if path := os.Getenv("ZTNACTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ztnactl", "config.json"), nil
+}
+
+// loadConfig reads the stored login. A missing file is an empty config.
+func loadConfig() (*config, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &config{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var cfg config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// save writes the config readable only by the user, as it holds a token.
+func (c *config) save() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
+
+func removeConfig() error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
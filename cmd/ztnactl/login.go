@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// loginChallenge is the data of a login response that asks for more.
+type loginChallenge struct {
+	MFARequired           bool     `json:"mfa_required"`
+	MFAEnrollmentRequired bool     `json:"mfa_enrollment_required"`
+	MFAToken              string   `json:"mfa_token"`
+	Methods               []string `json:"methods"`
+}
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func runLogin(c *cli, args []string) error {
+	fs := c.flags("login", "")
+	authServer := fs.String("auth-server", "", "Authentication API URL, when it is not served by the Management API")
+	email := fs.String("email", "", "Account email (prompted for when omitted)")
+	backoffice := fs.Bool("backoffice", false, "Sign in to the backoffice rather than a tenant")
+	passwordStdin := fs.Bool("password-stdin", false, "Read the password from the first line of standard input")
+	code := fs.String("code", "", "Authenticator or recovery code, for accounts with two-step verification")
+	recovery := fs.Bool("recovery", false, "The code is a recovery code")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	cfg, err := c.config()
+	if err != nil {
+		return err
+	}
+	server := firstNonEmpty(c.server, os.Getenv("ZTNACTL_SERVER"), cfg.Server)
+	if server == "" {
+		return usagef("--server is required for the first login")
+	}
+	if *authServer == "" && server == cfg.Server {
+		*authServer = cfg.AuthServer
+	}
+
+	realm := realmManagement
+	if *backoffice {
+		realm = realmBackoffice
+	}
+	if *email == "" {
+		if *passwordStdin {
+			return usagef("--email is required with --password-stdin")
+		}
+		if *email, err = prompt("Email: "); err != nil {
+			return err
+		}
+	}
+	var password string
+	if *passwordStdin {
+		password, err = readLine()
+	} else {
+		password, err = promptPassword("Password: ")
+	}
+	if err != nil {
+		return err
+	}
+
+	api := newAPIClient(server, *authServer, "")
+	data, resp, err := api.send("POST", "/auth/"+realm+"/login", nil, map[string]string{
+		"email":    *email,
+		"password": password,
+	})
+	if err != nil {
+		return err
+	}
+
+	var challenge loginChallenge
+	json.Unmarshal(data, &challenge)
+	switch {
+	case challenge.MFAEnrollmentRequired:
+		return errors.New("two-step verification must be set up in the console before signing in here")
+	case challenge.MFARequired:
+		method := "totp"
+		if *recovery || !slices.Contains(challenge.Methods, "totp") {
+			method = "recovery"
+		}
+		if !slices.Contains(challenge.Methods, method) {
+			return errors.New("this account only has passkeys: sign in to the console instead")
+		}
+		if *code == "" {
+			label := "Authentication code: "
+			if method == "recovery" {
+				label = "Recovery code: "
+			}
+			if *code, err = prompt(label); err != nil {
+				return err
+			}
+		}
+		if _, resp, err = api.send("POST", "/auth/"+realm+"/mfa/verify", nil, map[string]string{
+			"mfa_token": challenge.MFAToken,
+			"method":    method,
+			"code":      *code,
+		}); err != nil {
+			return err
+		}
+	}
+
+	token := ""
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name == realm+"_token" {
+			token = cookie.Value
+		}
+	}
+	if token == "" {
+		return errors.New("the server did not issue a session token")
+	}
+
+	*cfg = config{
+		Server:     strings.TrimRight(server, "/"),
+		AuthServer: strings.TrimRight(*authServer, "/"),
+		Realm:      realm,
+		Email:      *email,
+		Token:      token,
+	}
+	if err := cfg.save(); err != nil {
+		return fmt.Errorf("failed to store the login: %w", err)
+	}
+	path, _ := configPath()
+	fmt.Fprintf(os.Stderr, "Logged in to %s as %s (stored in %s)\n", cfg.Server, cfg.Email, path)
+	return nil
+}
+
+// runLogout forgets the session token. The server and email are kept for
+// the next login.
+func runLogout(c *cli, args []string) error {
+	fs := c.flags("logout", "")
+	purge := fs.Bool("purge", false, "Remove the stored configuration entirely")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *purge {
+		return removeConfig()
+	}
+	cfg, err := c.config()
+	if err != nil {
+		return err
+	}
+	cfg.Token = ""
+	return cfg.save()
+}
+
+func runWhoami(c *cli, args []string) error {
+	fs := c.flags("whoami", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	cfg, err := c.config()
+	if err != nil {
+		return err
+	}
+	realm := firstNonEmpty(cfg.Realm, realmManagement)
+	return c.get("/auth/"+realm+"/me", nil, []column{
+		{"ID", "id"}, {"NAME", "name"}, {"EMAIL", "email"}, {"ROLE", "role"}, {"TENANT", "tenant_id"},
+	})
+}
+
+// prompt reads a line from the terminal, or from standard input when it is
+// not a terminal.
+func prompt(label string) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	return readLine()
+}
+
+// promptPassword reads a password without echoing it.
+func promptPassword(label string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", usagef("no terminal to read the password from: use --password-stdin")
+	}
+	fmt.Fprint(os.Stderr, label)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	return string(password), err
+}
+
+func readLine() (string, error) {
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,200 @@
+// Command ztnactl manages a Tridorian ZTNA tenant through the Management API.
+//
+// It signs in once with "ztnactl login" and stores the session token, then
+// lists and changes tenants, administrators, nodes, policies, applications,
+// sessions and domains. "ztnactl apply -f" creates or updates access
+// policies, sign-in policies and applications from YAML or JSON files so
+// they can be kept in version control, and "ztnactl config" exports and
+// imports the whole tenant configuration as one document.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Exit codes.
+const (
+	exitOK       = 0
+	exitError    = 1
+	exitUsage    = 2
+	exitAuthFail = 3 // Not logged in, or the session has expired
+	exitChanges  = 4 // --exit-code found configuration changes
+)
+
+// usageError is a mistake in the command line.
+type usageError struct{ msg string }
+
+func (e *usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return &usageError{msg: fmt.Sprintf(format, args...)}
+}
+
+// command is one ztnactl command, such as "nodes list".
+type command struct {
+	name    string
+	summary string
+	run     func(c *cli, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{"login", "Sign in and store the session", runLogin},
+		{"logout", "Forget the stored session", runLogout},
+		{"whoami", "Show the signed-in account", runWhoami},
+
+		{"tenants list", "List tenants (backoffice)", runTenantsList},
+		{"tenants create", "Create a tenant and its first administrator (backoffice)", runTenantsCreate},
+		{"tenants delete", "Delete a tenant (backoffice)", runTenantsDelete},
+		{"tenants current", "Show the signed-in administrator's tenant", runTenantsCurrent},
+
+		{"admins list", "List administrators", runAdminsList},
+		{"admins create", "Create an administrator", runAdminsCreate},
+		{"admins update", "Change an administrator's name, role or scope", runAdminsUpdate},
+		{"admins delete", "Delete an administrator", runAdminsDelete},
+		{"admins reset-mfa", "Remove an administrator's two-step verification", runAdminsResetMFA},
+
+		{"nodes list", "List gateway nodes", runNodesList},
+		{"nodes skus", "List node sizes", runNodesSkus},
+		{"nodes create", "Create a gateway node", runNodesCreate},
+		{"nodes delete", "Delete a gateway node", runNodesDelete},
+		{"nodes enroll-token", "Issue a new enrollment token to a gateway node", runNodesEnrollToken},
+		{"nodes reset-enrollment", "Revoke a node's certificate and hardware binding and issue a new enrollment token", runNodesResetEnrollment},
+		{"nodes hardware-changes", "List gateways waiting for approval of changed hardware", runNodesHardwareChanges},
+		{"nodes approve-hardware", "Accept the hardware a node's gateway now runs on", runNodesApproveHardware},
+		{"nodes reject-hardware", "Refuse a node's changed hardware and revoke its certificate", runNodesRejectHardware},
+		{"nodes set-group", "Move a gateway node into a gateway group, or out of it", runNodesSetGroup},
+		{"nodes set-egress", "Set how client traffic leaves a gateway: masquerade, routed or snat", runNodesSetEgress},
+
+		{"groups list", "List gateway groups", runGroupsList},
+		{"groups create", "Create a gateway group", runGroupsCreate},
+		{"groups update", "Change a gateway group's name, description or address pool", runGroupsUpdate},
+		{"groups delete", "Delete a gateway group; its nodes become standalone gateways", runGroupsDelete},
+
+		{"sessions list", "List the VPN sessions on a node", runSessionsList},
+		{"sessions revoke", "End a user's VPN sessions", runSessionsRevoke},
+
+		{"policies list", "List access or sign-in policies", runPoliciesList},
+		{"policies get", "Show a policy", runPoliciesGet},
+		{"policies delete", "Delete a policy", runPoliciesDelete},
+
+		{"apps list", "List applications", runAppsList},
+		{"apps get", "Show an application", runAppsGet},
+		{"apps delete", "Delete an application", runAppsDelete},
+
+		{"domains list", "List the tenant's domains", runDomainsList},
+		{"domains add", "Register a custom domain", runDomainsAdd},
+		{"domains verify", "Verify a custom domain's DNS record", runDomainsVerify},
+		{"domains activate", "Make a domain the tenant's primary domain", runDomainsActivate},
+
+		{"audit list", "List or export the audit log", runAuditList},
+		{"audit verify", "Verify the audit log's hash chain", runAuditVerify},
+
+		{"config export", "Export the tenant's configuration as a document", runConfigExport},
+		{"config import", "Make the tenant's configuration match a document", runConfigImport},
+		{"config drift", "Compare the configuration with the last imported document", runConfigDrift},
+
+		{"apply", "Create or update policies and applications from files", runApply},
+	}
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout))
+}
+
+func run(args []string, stdout io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		printUsage(os.Stderr, "")
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	cmd, rest := findCommand(args)
+	if cmd == nil {
+		if isGroup(args[0]) {
+			printUsage(os.Stderr, args[0])
+		} else {
+			fmt.Fprintf(os.Stderr, "ztnactl: unknown command %q\n\n", strings.Join(args, " "))
+			printUsage(os.Stderr, "")
+		}
+		return exitUsage
+	}
+
+	c := &cli{stdout: stdout}
+	err := cmd.run(c, rest)
+
+	var usageErr *usageError
+	var apiErr *apiError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, flag.ErrHelp):
+		return exitOK
+	case errors.Is(err, errChanges):
+		return exitChanges
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(os.Stderr, "ztnactl %s: %s\n", cmd.name, err)
+		return exitUsage
+	case errors.Is(err, errFlagParse):
+		return exitUsage // The flag package has reported it
+	case errors.Is(err, errNotLoggedIn):
+		fmt.Fprintln(os.Stderr, "ztnactl:", err)
+		return exitAuthFail
+	case errors.As(err, &apiErr) && apiErr.Status == 401:
+		fmt.Fprintf(os.Stderr, "ztnactl: %s (run ztnactl login)\n", err)
+		return exitAuthFail
+	default:
+		fmt.Fprintln(os.Stderr, "ztnactl:", err)
+		return exitError
+	}
+}
+
+// findCommand matches the longest command name at the start of args.
+func findCommand(args []string) (*command, []string) {
+	for n := min(2, len(args)); n > 0; n-- {
+		name := strings.Join(args[:n], " ")
+		for i := range commands {
+			if commands[i].name == name {
+				return &commands[i], args[n:]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func isGroup(name string) bool {
+	for _, cmd := range commands {
+		if strings.HasPrefix(cmd.name, name+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// printUsage lists every command, or those of one group.
+func printUsage(w io.Writer, group string) {
+	fmt.Fprintln(w, "Usage: ztnactl <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands {
+		if group == "" || strings.HasPrefix(cmd.name, group+" ") {
+			fmt.Fprintf(w, "  %-20s %s\n", cmd.name, cmd.summary)
+		}
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Every command accepts -o table|json|yaml, --server URL and --token TOKEN.")
+	fmt.Fprintln(w, "ZTNACTL_SERVER and ZTNACTL_TOKEN override the stored login, and")
+	fmt.Fprintln(w, "ZTNACTL_CONFIG sets where it is stored.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run \"ztnactl <command> -h\" for a command's flags. Exit status is 0 on")
+	fmt.Fprintln(w, "success, 1 on errors, 2 on usage errors and 3 when not logged in.")
+}
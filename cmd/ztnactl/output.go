@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+// column is one table column: a header and a dotted path into each row,
+// such as "node_sku.name".
+type column struct {
+	header string
+	field  string
+}
+
+// printData writes API data in the selected format. Tables show the columns
+// of each element of a list, or of a single object; without columns an
+// object is shown as field and value pairs.
+func printData(w io.Writer, format string, data json.RawMessage, columns []column) error {
+	switch format {
+	case outputJSON:
+		return printJSON(w, data)
+	case outputYAML:
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+		return printYAML(w, v)
+	case outputTable, "":
+	default:
+		return fmt.Errorf("unknown output format %q: use table, json or yaml", format)
+	}
+
+	var v any
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &v); err != nil {
+			return err
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case []any:
+		if len(v) == 0 {
+			fmt.Fprintln(os.Stderr, "No resources found.")
+			return nil
+		}
+		return printTable(w, v, columns)
+	case map[string]any:
+		if msg, ok := v["message"].(string); ok && len(v) == 1 {
+			_, err := fmt.Fprintln(w, msg)
+			return err
+		}
+		if columns == nil {
+			return printFields(w, v)
+		}
+		return printTable(w, []any{v}, columns)
+	default:
+		_, err := fmt.Fprintln(w, cell(v))
+		return err
+	}
+}
+
+func printJSON(w io.Writer, data json.RawMessage) error {
+	if len(data) == 0 {
+		data = json.RawMessage("null")
+	}
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+func printYAML(w io.Writer, v any) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func printTable(w io.Writer, rows []any, columns []column) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	headers := make([]string, len(columns))
+	for i, c := range columns {
+		headers[i] = c.header
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		cells := make([]string, len(columns))
+		for i, c := range columns {
+			cells[i] = cell(lookup(row, c.field))
+		}
+		fmt.Fprintln(tw, strings.Join(cells, "\t"))
+	}
+	return tw.Flush()
+}
+
+func printFields(w io.Writer, obj map[string]any) error {
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	for _, k := range keys {
+		fmt.Fprintf(tw, "%s\t%s\n", k, cell(obj[k]))
+	}
+	return tw.Flush()
+}
+
+// lookup follows a dotted path through nested objects. An empty path is the
+// value itself.
+func lookup(v any, path string) any {
+	if path == "" {
+		return v
+	}
+	for _, key := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = obj[key]
+	}
+	return v
+}
+
+// cell formats a value for a table. Objects are shown by name, and lists as
+// the comma separated names of their elements.
+func cell(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, e := range v {
+			parts = append(parts, cell(e))
+		}
+		return strings.Join(parts, ",")
+	case map[string]any:
+		for _, key := range []string{"name", "email", "value", "id"} {
+			if s, ok := v[key].(string); ok && s != "" {
+				return s
+			}
+		}
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
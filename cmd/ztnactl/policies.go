@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"net/url"
+)
+
+// Policy types, as named by --type and the API paths.
+const (
+	policyTypeAccess = "access"
+	policyTypeSignIn = "sign-in"
+)
+
+var (
+	accessPolicyColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"PRIORITY", "priority"}, {"ENABLED", "enabled"}, {"EFFECT", "effect"},
+		{"DESTINATION", "destination_type"}, {"NODES", "nodes"},
+	}
+	signInPolicyColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"PRIORITY", "priority"}, {"ENABLED", "enabled"}, {"STAGE", "stage"}, {"BLOCK", "block"},
+	}
+	applicationColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"OWNER", "owner"}, {"TAGS", "tags"}, {"PORTS", "ports"}, {"DESTINATIONS", "destinations"},
+	}
+)
+
+// policyFlags adds --type and returns the API path and columns it selects.
+type policyFlags struct {
+	kind *string
+}
+
+func (p *policyFlags) path() (string, []column, error) {
+	switch *p.kind {
+	case policyTypeAccess:
+		return "/api/v1/policies/access", accessPolicyColumns, nil
+	case policyTypeSignIn:
+		return "/api/v1/policies/sign-in", signInPolicyColumns, nil
+	default:
+		return "", nil, usagef("--type must be %s or %s", policyTypeAccess, policyTypeSignIn)
+	}
+}
+
+func runPoliciesList(c *cli, args []string) error {
+	fs := c.flags("policies list", "")
+	p := policyFlags{fs.String("type", policyTypeAccess, "Policy type: access or sign-in")}
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	path, columns, err := p.path()
+	if err != nil {
+		return err
+	}
+	return c.get(path, nil, columns)
+}
+
+func runPoliciesGet(c *cli, args []string) error {
+	fs := c.flags("policies get", "NAME|ID")
+	p := policyFlags{fs.String("type", policyTypeAccess, "Policy type: access or sign-in")}
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	path, columns, err := p.path()
+	if err != nil {
+		return err
+	}
+	policy, err := c.find("policy", path, pos[0], "name")
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return c.print(data, columns)
+}
+
+func runPoliciesDelete(c *cli, args []string) error {
+	fs := c.flags("policies delete", "NAME|ID")
+	p := policyFlags{fs.String("type", policyTypeAccess, "Policy type: access or sign-in")}
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	path, _, err := p.path()
+	if err != nil {
+		return err
+	}
+	policy, err := c.find("policy", path, pos[0], "name")
+	if err != nil {
+		return err
+	}
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+	var data json.RawMessage
+	if err := api.call("DELETE", path, url.Values{"id": {policy["id"].(string)}}, nil, &data); err != nil {
+		return err
+	}
+	return c.print(data, nil)
+}
+
+func runAppsList(c *cli, args []string) error {
+	fs := c.flags("apps list", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	return c.get("/api/v1/applications", nil, applicationColumns)
+}
+
+func runAppsGet(c *cli, args []string) error {
+	fs := c.flags("apps get", "NAME|ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	app, err := c.find("application", "/api/v1/applications", pos[0], "name")
+	if err != nil {
+		return err
+	}
+	return c.get("/api/v1/applications", url.Values{"id": {app["id"].(string)}}, applicationColumns)
+}
+
+func runAppsDelete(c *cli, args []string) error {
+	fs := c.flags("apps delete", "NAME|ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	app, err := c.find("application", "/api/v1/applications", pos[0], "name")
+	if err != nil {
+		return err
+	}
+	return c.send("DELETE", "/api/v1/applications", map[string]any{"id": app["id"]}, nil)
+}
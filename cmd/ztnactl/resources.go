@@ -0,0 +1,702 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	tenantColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"SLUG", "slug"}, {"PRIMARY DOMAIN", "primary_domain"}, {"CREATED", "created_at"},
+	}
+	adminColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"EMAIL", "email"}, {"ROLE", "role"}, {"CUSTOM ROLE", "custom_role.name"},
+		{"BREAK GLASS", "break_glass"}, {"SSO", "sso"},
+	}
+	nodeColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"STATUS", "status"}, {"SKU", "node_sku.name"}, {"CLIENT CIDR", "client_cidr"},
+		{"IP", "ip_address"}, {"GROUP", "gateway_group.name"}, {"ROUTES", "advertised_routes"},
+		{"CONNECTOR", "connector"}, {"EGRESS", "egress_mode"}, {"VERSION", "gateway_version"}, {"LAST SEEN", "last_seen_at"},
+	}
+	egressColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"EGRESS", "egress_mode"}, {"RETURN ROUTES", "return_routes"},
+	}
+	gatewayGroupColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"CLIENT CIDR", "client_cidr"}, {"DESCRIPTION", "description"},
+	}
+	enrollmentColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"ENROLLMENT TOKEN", "enrollment_token"}, {"EXPIRES", "enrollment_expires_at"},
+		{"CA FINGERPRINT", "ca_fingerprint"},
+	}
+	hardwareChangeColumns = []column{
+		{"ID", "id"}, {"NAME", "name"}, {"HOSTNAME", "hostname"}, {"NEW DEVICE HASH", "pending_device_hash"},
+		{"FROM IP", "pending_device_ip"}, {"REQUESTED", "pending_device_at"},
+	}
+	auditColumns = []column{
+		{"#", "sequence"}, {"TIME", "created_at"}, {"ACTOR", "actor_email"}, {"ACTION", "action"},
+		{"RESOURCE", "resource_type"}, {"RESOURCE ID", "resource_id"}, {"IP", "ip"},
+	}
+)
+
+// Tenants
+
+// listTenants returns the tenants from the backoffice tenant list.
+func (c *cli) listTenants() (json.RawMessage, error) {
+	api, err := c.client()
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Tenants json.RawMessage `json:"tenants"`
+	}
+	if err := api.call("GET", "/api/v1/tenants", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return result.Tenants, nil
+}
+
+func runTenantsList(c *cli, args []string) error {
+	fs := c.flags("tenants list", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	tenants, err := c.listTenants()
+	if err != nil {
+		return err
+	}
+	return c.print(tenants, tenantColumns)
+}
+
+func runTenantsCreate(c *cli, args []string) error {
+	fs := c.flags("tenants create", "NAME")
+	adminEmail := fs.String("admin-email", "", "Email of the tenant's first administrator (required)")
+	adminPassword := fs.String("admin-password", "", "Initial password (generated when omitted)")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *adminEmail == "" {
+		return usagef("--admin-email is required")
+	}
+	return c.send("POST", "/api/v1/tenants", map[string]string{
+		"name":           pos[0],
+		"admin_email":    *adminEmail,
+		"admin_password": *adminPassword,
+	}, []column{
+		{"ID", "tenant.id"}, {"NAME", "tenant.name"}, {"SLUG", "tenant.slug"},
+		{"ADMIN EMAIL", "admin_email"}, {"ADMIN PASSWORD", "admin_password"},
+	})
+}
+
+func runTenantsDelete(c *cli, args []string) error {
+	fs := c.flags("tenants delete", "ID|SLUG")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	data, err := c.listTenants()
+	if err != nil {
+		return err
+	}
+	var tenants []map[string]any
+	if err := json.Unmarshal(data, &tenants); err != nil {
+		return err
+	}
+	tenant, err := findIn("tenant", tenants, pos[0], "slug")
+	if err != nil {
+		return err
+	}
+	return c.send("DELETE", "/api/v1/tenants", map[string]any{"id": tenant["id"]}, nil)
+}
+
+func runTenantsCurrent(c *cli, args []string) error {
+	fs := c.flags("tenants current", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	return c.get("/api/v1/tenant/me", nil, nil)
+}
+
+// Administrators
+
+func runAdminsList(c *cli, args []string) error {
+	fs := c.flags("admins list", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	return c.get("/api/v1/admins", nil, adminColumns)
+}
+
+// adminAccessFlags are the role and scope flags of admins create and update.
+type adminAccessFlags struct {
+	role       *string
+	customRole *string
+	nodes      stringList
+	apps       stringList
+}
+
+func newAdminAccessFlags(fs *flag.FlagSet) *adminAccessFlags {
+	a := &adminAccessFlags{}
+	a.role = fs.String("role", "", "Built-in role: super_admin, admin, policy_admin, auditor or helpdesk")
+	a.customRole = fs.String("custom-role", "", "Custom role name or ID (sets the role to custom)")
+	fs.Var(&a.nodes, "node", "Limit the administrator to a node, by name or ID (repeatable)")
+	fs.Var(&a.apps, "app", "Limit the administrator to an application, by name or ID (repeatable)")
+	return a
+}
+
+func (a *adminAccessFlags) set() bool {
+	return *a.role != "" || *a.customRole != "" || len(a.nodes) > 0 || len(a.apps) > 0
+}
+
+// body adds the access fields to a request body, starting from current.
+func (a *adminAccessFlags) body(c *cli, body, current map[string]any) error {
+	role, _ := current["role"].(string)
+	body["role"] = firstNonEmpty(*a.role, role, "admin")
+	body["role_id"] = current["role_id"]
+	body["node_ids"] = current["node_ids"]
+	body["application_ids"] = current["application_ids"]
+
+	if *a.customRole != "" {
+		api, err := c.client()
+		if err != nil {
+			return err
+		}
+		var result struct {
+			Roles []map[string]any `json:"roles"`
+		}
+		if err := api.call("GET", "/api/v1/roles", nil, nil, &result); err != nil {
+			return err
+		}
+		role, err := findIn("role", result.Roles, *a.customRole, "name")
+		if err != nil {
+			return err
+		}
+		body["role"] = "custom"
+		body["role_id"] = role["id"]
+	} else if *a.role != "" {
+		body["role_id"] = nil
+	}
+	if len(a.nodes) > 0 {
+		ids, err := c.resolveIDs("node", "/api/v1/nodes", a.nodes)
+		if err != nil {
+			return err
+		}
+		body["node_ids"] = ids
+	}
+	if len(a.apps) > 0 {
+		ids, err := c.resolveIDs("application", "/api/v1/applications", a.apps)
+		if err != nil {
+			return err
+		}
+		body["application_ids"] = ids
+	}
+	return nil
+}
+
+func runAdminsCreate(c *cli, args []string) error {
+	fs := c.flags("admins create", "EMAIL")
+	name := fs.String("name", "", "Display name")
+	password := fs.String("password", "", "Initial password (generated when omitted)")
+	access := newAdminAccessFlags(fs)
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	body := map[string]any{"email": pos[0], "name": *name, "password": *password}
+	if err := access.body(c, body, map[string]any{}); err != nil {
+		return err
+	}
+	return c.send("POST", "/api/v1/admins", body, []column{
+		{"ID", "admin.id"}, {"EMAIL", "admin.email"}, {"ROLE", "admin.role"}, {"PASSWORD", "password"},
+	})
+}
+
+func runAdminsUpdate(c *cli, args []string) error {
+	fs := c.flags("admins update", "EMAIL|ID")
+	name := fs.String("name", "", "Display name")
+	breakGlass := fs.String("break-glass", "", "Whether the administrator may use a password while admin SSO is on: true or false")
+	access := newAdminAccessFlags(fs)
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	admin, err := c.find("administrator", "/api/v1/admins", pos[0], "email")
+	if err != nil {
+		return err
+	}
+
+	current, _ := admin["name"].(string)
+	body := map[string]any{"id": admin["id"], "name": firstNonEmpty(*name, current)}
+	if *breakGlass != "" {
+		value, err := strconv.ParseBool(*breakGlass)
+		if err != nil {
+			return usagef("--break-glass must be true or false")
+		}
+		body["break_glass"] = value
+	}
+	if access.set() {
+		if err := access.body(c, body, admin); err != nil {
+			return err
+		}
+	}
+	return c.send("PUT", "/api/v1/admins", body, nil)
+}
+
+func runAdminsDelete(c *cli, args []string) error {
+	fs := c.flags("admins delete", "EMAIL|ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	admin, err := c.find("administrator", "/api/v1/admins", pos[0], "email")
+	if err != nil {
+		return err
+	}
+	return c.send("DELETE", "/api/v1/admins", map[string]any{"id": admin["id"]}, nil)
+}
+
+func runAdminsResetMFA(c *cli, args []string) error {
+	fs := c.flags("admins reset-mfa", "EMAIL|ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	admin, err := c.find("administrator", "/api/v1/admins", pos[0], "email")
+	if err != nil {
+		return err
+	}
+	return c.send("POST", "/api/v1/admins/mfa/reset", map[string]any{"id": admin["id"]}, nil)
+}
+
+// Nodes and sessions
+
+func runNodesList(c *cli, args []string) error {
+	fs := c.flags("nodes list", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	return c.get("/api/v1/nodes", nil, nodeColumns)
+}
+
+func runNodesSkus(c *cli, args []string) error {
+	fs := c.flags("nodes skus", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	return c.get("/api/v1/nodes/skus", nil, []column{
+		{"ID", "id"}, {"NAME", "name"}, {"DESCRIPTION", "description"}, {"MAX USERS", "max_users"}, {"BANDWIDTH", "bandwidth"},
+	})
+}
+
+func runNodesCreate(c *cli, args []string) error {
+	fs := c.flags("nodes create", "NAME")
+	sku := fs.String("sku", "", "Node size, by name or ID (required)")
+	clientCIDR := fs.String("client-cidr", "", "Address range handed to VPN clients")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *sku == "" {
+		return usagef("--sku is required: see ztnactl nodes skus")
+	}
+	skuIDs, err := c.resolveIDs("node size", "/api/v1/nodes/skus", []string{*sku})
+	if err != nil {
+		return err
+	}
+	return c.send("POST", "/api/v1/nodes", map[string]string{
+		"name":        pos[0],
+		"sku_id":      skuIDs[0],
+		"client_cidr": *clientCIDR,
+	}, enrollmentColumns)
+}
+
+// runNodesEnrollToken issues a new enrollment token to a node that has not
+// enrolled yet.
+func runNodesEnrollToken(c *cli, args []string) error {
+	fs := c.flags("nodes enroll-token", "NAME|ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	node, err := c.find("node", "/api/v1/nodes", pos[0], "name")
+	if err != nil {
+		return err
+	}
+	return c.send("POST", "/api/v1/nodes/enrollment-token", map[string]any{"id": node["id"]}, enrollmentColumns)
+}
+
+// runNodesResetEnrollment revokes a node's certificate and hardware binding
+// and prints the token to enroll its gateway again.
+func runNodesResetEnrollment(c *cli, args []string) error {
+	fs := c.flags("nodes reset-enrollment", "NAME|ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	node, err := c.find("node", "/api/v1/nodes", pos[0], "name")
+	if err != nil {
+		return err
+	}
+	return c.send("POST", "/api/v1/nodes/reset-enrollment", map[string]any{"id": node["id"]}, enrollmentColumns)
+}
+
+func runNodesHardwareChanges(c *cli, args []string) error {
+	fs := c.flags("nodes hardware-changes", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	return c.get("/api/v1/nodes/hardware-changes", nil, hardwareChangeColumns)
+}
+
+func runNodesApproveHardware(c *cli, args []string) error {
+	return c.resolveHardwareChange("nodes approve-hardware", "/api/v1/nodes/hardware-changes/approve", args)
+}
+
+func runNodesRejectHardware(c *cli, args []string) error {
+	return c.resolveHardwareChange("nodes reject-hardware", "/api/v1/nodes/hardware-changes/reject", args)
+}
+
+func (c *cli) resolveHardwareChange(name, path string, args []string) error {
+	fs := c.flags(name, "NAME|ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	node, err := c.find("node", "/api/v1/nodes", pos[0], "name")
+	if err != nil {
+		return err
+	}
+	return c.send("POST", path, map[string]any{"id": node["id"]}, nodeColumns)
+}
+
+func runNodesDelete(c *cli, args []string) error {
+	fs := c.flags("nodes delete", "NAME|ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	node, err := c.find("node", "/api/v1/nodes", pos[0], "name")
+	if err != nil {
+		return err
+	}
+	return c.send("DELETE", "/api/v1/nodes", map[string]any{"id": node["id"]}, nil)
+}
+
+// runNodesSetGroup moves a node into a gateway group, or out of its group
+// with --none.
+func runNodesSetGroup(c *cli, args []string) error {
+	fs := c.flags("nodes set-group", "NAME|ID [GROUP]")
+	none := fs.Bool("none", false, "Remove the node from its group")
+	pos, err := c.parse(fs, args, -1)
+	if err != nil {
+		return err
+	}
+	if len(pos) != 2 && !(*none && len(pos) == 1) {
+		return usagef("expected a node and a group, or a node and --none")
+	}
+	node, err := c.find("node", "/api/v1/nodes", pos[0], "name")
+	if err != nil {
+		return err
+	}
+	groupID := ""
+	if !*none {
+		ids, err := c.resolveIDs("gateway group", "/api/v1/gateway-groups", pos[1:])
+		if err != nil {
+			return err
+		}
+		groupID = ids[0]
+	}
+	return c.send("POST", "/api/v1/nodes/group", map[string]any{"id": node["id"], "gateway_group_id": groupID}, nodeColumns)
+}
+
+// runNodesSetEgress sets how a node's client traffic leaves the gateway:
+// masquerade, routed, or snat with a source per destination.
+func runNodesSetEgress(c *cli, args []string) error {
+	fs := c.flags("nodes set-egress", "NAME|ID MODE")
+	var snat stringList
+	fs.Var(&snat, "snat", "DESTINATION=SOURCE for the snat mode, e.g. 10.1.0.0/16=192.0.2.10-192.0.2.20 (repeatable)")
+	pos, err := c.parse(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	pools := []map[string]string{}
+	for _, p := range snat {
+		dst, src, ok := strings.Cut(p, "=")
+		if !ok {
+			return usagef("invalid --snat %q: expected DESTINATION=SOURCE", p)
+		}
+		pools = append(pools, map[string]string{"destination": dst, "source": src})
+	}
+	node, err := c.find("node", "/api/v1/nodes", pos[0], "name")
+	if err != nil {
+		return err
+	}
+	return c.send("POST", "/api/v1/nodes/egress", map[string]any{"id": node["id"], "egress_mode": pos[1], "snat_pools": pools}, egressColumns)
+}
+
+// Gateway groups
+
+func runGroupsList(c *cli, args []string) error {
+	fs := c.flags("groups list", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	return c.get("/api/v1/gateway-groups", nil, gatewayGroupColumns)
+}
+
+func runGroupsCreate(c *cli, args []string) error {
+	fs := c.flags("groups create", "NAME")
+	description := fs.String("description", "", "Description")
+	clientCIDR := fs.String("client-cidr", "", "Address range shared by the members (each member's own when omitted)")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	return c.send("POST", "/api/v1/gateway-groups", map[string]string{
+		"name":        pos[0],
+		"description": *description,
+		"client_cidr": *clientCIDR,
+	}, gatewayGroupColumns)
+}
+
+func runGroupsUpdate(c *cli, args []string) error {
+	fs := c.flags("groups update", "NAME|ID")
+	name := fs.String("name", "", "New name")
+	description := fs.String("description", "", "Description")
+	clientCIDR := fs.String("client-cidr", "", "Address range shared by the members; empty to use each member's own")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	group, err := c.find("gateway group", "/api/v1/gateway-groups", pos[0], "name")
+	if err != nil {
+		return err
+	}
+
+	body := map[string]any{
+		"id":          group["id"],
+		"name":        group["name"],
+		"description": group["description"],
+		"client_cidr": group["client_cidr"],
+	}
+	// Flags given, even empty, replace the current values
+	fs.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "name":
+			body["name"] = *name
+		case "description":
+			body["description"] = *description
+		case "client-cidr":
+			body["client_cidr"] = *clientCIDR
+		}
+	})
+	return c.send("PUT", "/api/v1/gateway-groups", body, gatewayGroupColumns)
+}
+
+func runGroupsDelete(c *cli, args []string) error {
+	fs := c.flags("groups delete", "NAME|ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	group, err := c.find("gateway group", "/api/v1/gateway-groups", pos[0], "name")
+	if err != nil {
+		return err
+	}
+	return c.send("DELETE", "/api/v1/gateway-groups", map[string]any{"id": group["id"]}, nil)
+}
+
+func runSessionsList(c *cli, args []string) error {
+	fs := c.flags("sessions list", "NODE")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	ids, err := c.resolveIDs("node", "/api/v1/nodes", pos)
+	if err != nil {
+		return err
+	}
+	return c.get("/api/v1/nodes/sessions", url.Values{"node_id": {ids[0]}}, []column{
+		{"EMAIL", "user_email"}, {"IP", "ip_address"}, {"DEVICE", "device_id"}, {"CONNECTED", "connected_at"},
+	})
+}
+
+func runSessionsRevoke(c *cli, args []string) error {
+	fs := c.flags("sessions revoke", "EMAIL")
+	node := fs.String("node", "", "Only end the sessions on this node, by name or ID")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	body := map[string]string{"email": pos[0]}
+	if *node != "" {
+		ids, err := c.resolveIDs("node", "/api/v1/nodes", []string{*node})
+		if err != nil {
+			return err
+		}
+		body["node_id"] = ids[0]
+	}
+	return c.send("POST", "/api/v1/sessions/revoke", body, []column{
+		{"EMAIL", "email"}, {"NODE", "node_id"}, {"REVOKED AT", "revoked_at"},
+	})
+}
+
+// Domains
+
+func runDomainsList(c *cli, args []string) error {
+	fs := c.flags("domains list", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	return c.get("/api/v1/tenants/domains", nil, []column{{"DOMAIN", ""}})
+}
+
+// registerDomain registers a custom domain, or returns the tenant's existing
+// registration of it.
+func (c *cli) registerDomain(domain string) (json.RawMessage, map[string]any, error) {
+	api, err := c.client()
+	if err != nil {
+		return nil, nil, err
+	}
+	var data json.RawMessage
+	if err := api.call("POST", "/api/v1/tenants/domains", nil, map[string]string{"domain": domain}, &data); err != nil {
+		return nil, nil, err
+	}
+	var record map[string]any
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, nil, err
+	}
+	return data, record, nil
+}
+
+func runDomainsAdd(c *cli, args []string) error {
+	fs := c.flags("domains add", "DOMAIN")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	data, record, err := c.registerDomain(pos[0])
+	if err != nil {
+		return err
+	}
+	if err := c.print(data, []column{{"ID", "id"}, {"DOMAIN", "domain"}, {"VERIFIED", "is_verified"}}); err != nil {
+		return err
+	}
+	if verified, _ := record["is_verified"].(bool); !verified && c.output == outputTable {
+		fmt.Fprintf(os.Stderr, "\nAdd this DNS record, then run: ztnactl domains verify %s\n  _tridorian-challenge.%s TXT %q\n",
+			pos[0], pos[0], record["verification_token"])
+	}
+	return nil
+}
+
+func runDomainsVerify(c *cli, args []string) error {
+	fs := c.flags("domains verify", "DOMAIN")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	_, record, err := c.registerDomain(pos[0])
+	if err != nil {
+		return err
+	}
+	return c.send("POST", "/api/v1/tenants/domains/verify", map[string]any{"domain_id": record["id"]}, nil)
+}
+
+func runDomainsActivate(c *cli, args []string) error {
+	fs := c.flags("domains activate", "DOMAIN")
+	pos, err := c.parse(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	return c.send("POST", "/api/v1/tenants/activate", map[string]string{"domain": pos[0]}, nil)
+}
+
+// Audit log
+
+func runAuditList(c *cli, args []string) error {
+	fs := c.flags("audit list", "")
+	actor := fs.String("actor", "", "Actor email (substring) or ID")
+	action := fs.String("action", "", "Action or action prefix, e.g. access_policy.")
+	resourceType := fs.String("resource-type", "", "Resource type")
+	resourceID := fs.String("resource-id", "", "Resource ID")
+	since := fs.String("since", "", "Earliest time, RFC 3339 or YYYY-MM-DD")
+	until := fs.String("until", "", "Latest time, RFC 3339 or YYYY-MM-DD (inclusive)")
+	page := fs.Int("page", 1, "Page, newest entries first")
+	pageSize := fs.Int("page-size", 50, "Entries per page (at most 200)")
+	export := fs.String("export", "", "Write the whole filtered log, oldest first, as csv or json")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	for key, value := range map[string]string{
+		"actor": *actor, "action": *action, "resource_type": *resourceType,
+		"resource_id": *resourceID, "since": *since, "until": *until,
+	} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+	if *export != "" {
+		if *export != "csv" && *export != "json" {
+			return usagef("--export must be csv or json")
+		}
+		query.Set("format", *export)
+		return api.download("/api/v1/audit-logs", query, c.stdout)
+	}
+
+	query.Set("page", strconv.Itoa(*page))
+	query.Set("page_size", strconv.Itoa(*pageSize))
+	var result struct {
+		Entries json.RawMessage `json:"entries"`
+		Total   int64           `json:"total"`
+	}
+	if err := api.call("GET", "/api/v1/audit-logs", query, nil, &result); err != nil {
+		return err
+	}
+	if err := c.print(result.Entries, auditColumns); err != nil {
+		return err
+	}
+	if c.output == outputTable && result.Total > int64(*page**pageSize) {
+		fmt.Fprintf(os.Stderr, "Page %d of %d matching entries; use --page for more.\n", *page, result.Total)
+	}
+	return nil
+}
+
+func runAuditVerify(c *cli, args []string) error {
+	fs := c.flags("audit verify", "")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+	var data json.RawMessage
+	if err := api.call("GET", "/api/v1/audit-logs/verify", nil, nil, &data); err != nil {
+		return err
+	}
+	if err := c.print(data, []column{
+		{"VALID", "valid"}, {"ENTRIES", "entries"}, {"HEAD HASH", "head_hash"}, {"BROKEN AT", "broken_at"}, {"REASON", "reason"},
+	}); err != nil {
+		return err
+	}
+	var result struct {
+		Valid bool `json:"valid"`
+	}
+	json.Unmarshal(data, &result)
+	if !result.Valid {
+		return fmt.Errorf("the audit log does not verify")
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// errChanges is returned with --exit-code when a configuration import or
+// drift check finds changes.
+var errChanges = errors.New("the configuration has changes")
+
+var configChangeColumns = []column{
+	{"KIND", "kind"}, {"NAME", "name"}, {"ACTION", "action"}, {"FIELDS", "fields"},
+}
+
+func runConfigExport(c *cli, args []string) error {
+	fs := c.flags("config export", "")
+	format := fs.String("format", "yaml", "Document format: yaml or json")
+	file := fs.String("f", "", "Write the document to this file instead of standard output")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *format != "yaml" && *format != "json" {
+		return usagef("--format must be yaml or json")
+	}
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	w := c.stdout
+	if *file != "" {
+		f, err := os.OpenFile(*file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return api.download("/api/v1/config", url.Values{"format": {*format}}, w)
+}
+
+func runConfigImport(c *cli, args []string) error {
+	fs := c.flags("config import", "-f FILE|-")
+	file := fs.String("f", "", "YAML or JSON configuration document, or - for standard input")
+	dryRun := fs.Bool("dry-run", false, "Show the changes without making them")
+	exitCode := fs.Bool("exit-code", false, "Exit with status 4 if there are changes")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	if *file == "" {
+		return usagef("-f is required")
+	}
+
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+	// Sent as JSON, which the server reads like YAML
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", *file, err)
+	}
+	if _, ok := doc.(map[string]any); !ok {
+		return fmt.Errorf("%s: not a configuration document", *file)
+	}
+
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if *dryRun {
+		query.Set("dry_run", "true")
+	}
+	var plan struct {
+		Changes json.RawMessage `json:"changes"`
+		Applied bool            `json:"applied"`
+	}
+	if err := api.call("POST", "/api/v1/config/import", query, doc, &plan); err != nil {
+		return err
+	}
+	return c.printChanges(plan.Changes, *exitCode, func(n int) string {
+		if !plan.Applied {
+			return fmt.Sprintf("Dry run: %d changes would be made.", n)
+		}
+		return fmt.Sprintf("%d changes made.", n)
+	})
+}
+
+func runConfigDrift(c *cli, args []string) error {
+	fs := c.flags("config drift", "")
+	exitCode := fs.Bool("exit-code", false, "Exit with status 4 if the configuration has drifted")
+	if _, err := c.parse(fs, args, 0); err != nil {
+		return err
+	}
+	api, err := c.client()
+	if err != nil {
+		return err
+	}
+	var drift struct {
+		Changes   json.RawMessage `json:"changes"`
+		AppliedAt string          `json:"applied_at"`
+		AppliedBy string          `json:"applied_by"`
+	}
+	if err := api.call("GET", "/api/v1/config/drift", nil, nil, &drift); err != nil {
+		return err
+	}
+	return c.printChanges(drift.Changes, *exitCode, func(n int) string {
+		return fmt.Sprintf("%d changes since the import at %s by %s: importing it again would make them.", n, drift.AppliedAt, firstNonEmpty(drift.AppliedBy, "unknown"))
+	})
+}
+
+// printChanges prints a list of configuration changes, with a summary on
+// standard error for tables.
+func (c *cli) printChanges(data json.RawMessage, exitCode bool, summary func(n int) string) error {
+	var changes []any
+	json.Unmarshal(data, &changes)
+	if len(changes) == 0 {
+		if c.output == outputTable {
+			fmt.Fprintln(os.Stderr, "No changes.")
+			return nil
+		}
+		return c.print(data, nil)
+	}
+	if err := c.print(data, configChangeColumns); err != nil {
+		return err
+	}
+	if c.output == outputTable {
+		fmt.Fprintln(os.Stderr, summary(len(changes)))
+	}
+	if exitCode {
+		return errChanges
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"tridorian-ztna/internal/api/common"
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/internal/services"
+	"tridorian-ztna/pkg/utils"
+
+	"github.com/google/uuid"
+)
+
+// adminSSOStateCookie holds the state of an administrator sign-in through
+// the tenant's IdP. It is scoped to the SSO endpoints.
+const (
+	adminSSOStateCookie = "mgmt_sso_state"
+	adminSSOCookiePath  = "/auth/mgmt/sso"
+)
+
+// adminSSOProvider resolves the provider administrators of the tenant sign
+// in with. The tenant's configuration must already be decrypted.
+func (h *Handler) adminSSOProvider(tenant *models.Tenant, providerID uuid.UUID) (*models.IdentityProvider, error) {
+	requested := ""
+	if providerID != uuid.Nil {
+		requested = providerID.String()
+	} else if tenant.AdminSSOProviderID != nil {
+		requested = tenant.AdminSSOProviderID.String()
+	}
+	return h.idpService.ResolveLoginProvider(tenant, requested)
+}
+
+// StartAdminSSO sends an administrator to their organization's identity
+// provider. The tenant is found from the email (or domain) the console asked for.
+func (h *Handler) StartAdminSSO(w http.ResponseWriter, r *http.Request) {
+	ip := utils.GetClientIP(r)
+	country := ""
+	if h.geoIP != nil {
+		country = h.geoIP.Lookup(ip)
+	}
+
+	domain := r.URL.Query().Get("domain")
+	if email := r.URL.Query().Get("email"); email != "" {
+		_, domain, _ = strings.Cut(email, "@")
+	}
+	tenant, err := h.tenantService.FindByDomain(strings.ToLower(strings.TrimSpace(domain)))
+	if err != nil || !tenant.AdminSSOEnabled {
+		common.RenderErrorPage(w, http.StatusNotFound, "Single Sign-On Unavailable", "Single sign-on is not set up for this domain. Sign in with your email and password.", "Domain: "+domain, ip, country)
+		return
+	}
+	if err := h.tenantService.DecryptTenantConfig(tenant); err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to decrypt identity config")
+		return
+	}
+
+	provider, err := h.adminSSOProvider(tenant, uuid.Nil)
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusForbidden, "Configuration Error", "Tenant Identity Provider is incomplete.", err.Error(), ip, country)
+		return
+	}
+	signIn, err := h.idpService.Provider(r.Context(), tenant, provider, services.AdminEndpoints(authBaseURL(r)))
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusBadGateway, "Configuration Error", "The identity provider could not be reached.", err.Error(), ip, country)
+		return
+	}
+
+	state, err := services.NewLoginState()
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to start sign-in")
+		return
+	}
+	url, session, err := signIn.Begin(state)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to start sign-in")
+		return
+	}
+	if err := h.idpService.SaveAdminLoginSession(state, &services.LoginSession{
+		ProviderID: provider.ID,
+		Values:     session,
+		TenantID:   tenant.ID,
+	}); err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to store login session")
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminSSOStateCookie,
+		Value:    state,
+		Path:     adminSSOCookiePath,
+		MaxAge:   int(loginStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: loginStateSameSite(r),
+	})
+
+	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
+}
+
+// CallbackAdminSSO completes an administrator sign-in through the IdP (OAuth2
+// redirect or SAML POST), maps the user to a role and starts a console
+// session. Second factors are left to the identity provider.
+func (h *Handler) CallbackAdminSSO(w http.ResponseWriter, r *http.Request) {
+	ip := utils.GetClientIP(r)
+	country := ""
+	if h.geoIP != nil {
+		country = h.geoIP.Lookup(ip)
+	}
+
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = r.PostFormValue("RelayState")
+	}
+	cookie, err := r.Cookie(adminSSOStateCookie)
+	if state == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		common.RenderErrorPage(w, http.StatusBadRequest, "Sign-in Failed", "This sign-in was not started from this browser. Please sign in again from the console.", "login state mismatch", ip, country)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: adminSSOStateCookie, Path: adminSSOCookiePath, MaxAge: -1, HttpOnly: true, Secure: r.TLS != nil, SameSite: loginStateSameSite(r)})
+
+	session, err := h.idpService.TakeAdminLoginSession(state)
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusBadRequest, "Sign-in Expired", "Your sign-in took too long. Please sign in again from the console.", err.Error(), ip, country)
+		return
+	}
+	tenant, err := h.tenantService.GetTenantByID(session.TenantID)
+	if err != nil || !tenant.AdminSSOEnabled {
+		common.RenderErrorPage(w, http.StatusForbidden, "Single Sign-On Unavailable", "Single sign-on is no longer enabled for your organization.", "admin sso disabled", ip, country)
+		return
+	}
+	if err := h.tenantService.DecryptTenantConfig(tenant); err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to decrypt identity config")
+		return
+	}
+
+	provider, err := h.adminSSOProvider(tenant, session.ProviderID)
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusForbidden, "Configuration Error", "Tenant Identity Provider is incomplete.", err.Error(), ip, country)
+		return
+	}
+	signIn, err := h.idpService.Provider(r.Context(), tenant, provider, services.AdminEndpoints(authBaseURL(r)))
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusBadGateway, "Configuration Error", "The identity provider could not be reached.", err.Error(), ip, country)
+		return
+	}
+	user, err := signIn.Complete(r.Context(), r, session.Values)
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusUnauthorized, "Sign-in Failed", "Your identity provider did not confirm your sign-in.", err.Error(), ip, country)
+		return
+	}
+
+	groups, err := h.directoryGroups(tenant.ID, user.Email, user.Groups)
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusForbidden, "Access Denied", "Your account is not active in your organization's directory.", err.Error(), ip, country)
+		return
+	}
+	workspaceAdmin := false
+	if tenant.AdminSSOWorkspaceAdminRole != "" {
+		workspaceAdmin, err = h.adminSSOService.IsWorkspaceAdmin(r.Context(), tenant, user.Email)
+		if err != nil {
+			common.RenderErrorPage(w, http.StatusBadGateway, "Sign-in Failed", "Your administrator status could not be checked with Google Workspace.", err.Error(), ip, country)
+			return
+		}
+	}
+	role, err := h.adminSSOService.ResolveRole(tenant, groups, workspaceAdmin)
+	if errors.Is(err, services.ErrNoAdminRole) {
+		common.RenderErrorPage(w, http.StatusForbidden, "Access Denied", "Your account is not an administrator of this organization.", err.Error(), ip, country)
+		return
+	}
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to resolve administrator role")
+		return
+	}
+
+	admin, err := h.adminSSOService.SignIn(tenant.ID, user.Email, user.Name, role)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to sign in administrator")
+		return
+	}
+	if err := h.setManagementCookie(w, admin); err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// AdminSSOMetadata serves the SAML service provider metadata for
+// administrator sign-in of the tenant owning ?domain=.
+func (h *Handler) AdminSSOMetadata(w http.ResponseWriter, r *http.Request) {
+	tenant, err := h.tenantService.FindByDomain(strings.ToLower(r.URL.Query().Get("domain")))
+	if err != nil {
+		common.Error(w, http.StatusNotFound, "tenant not found")
+		return
+	}
+	if err := h.tenantService.DecryptTenantConfig(tenant); err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to decrypt identity config")
+		return
+	}
+
+	provider, err := h.adminSSOProvider(tenant, uuid.Nil)
+	if err != nil || provider.Type != models.IdentityProviderSAML {
+		common.Error(w, http.StatusNotFound, "SAML identity provider not found")
+		return
+	}
+	sp, err := h.idpService.SAMLProvider(provider, services.AdminEndpoints(authBaseURL(r)))
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(sp.Metadata())
+}
@@ -1,12 +1,14 @@
 package auth
 
 import (
-	"encoding/base64"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 	"tridorian-ztna/internal/api/common"
@@ -14,12 +16,12 @@ import (
 	"tridorian-ztna/internal/models"
 	"tridorian-ztna/internal/services"
 	"tridorian-ztna/pkg/geoip"
+	"tridorian-ztna/pkg/posture"
+	"tridorian-ztna/pkg/schedule"
 	"tridorian-ztna/pkg/utils"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
-	"golang.org/x/oauth2"
-	"golang.org/x/oauth2/google"
 	"gorm.io/gorm"
 )
 
@@ -32,9 +34,22 @@ type Handler struct {
 	backofficeService *services.BackofficeService
 	policyService     *services.PolicyService
 	nodeService       *services.NodeService // Injected
+	deviceService     *services.DeviceService
+	appService        *services.ApplicationService
+	gatewayGroups     *services.GatewayGroupService
+	idpService        *services.IdentityProviderService
+	directoryService  *services.DirectoryService
+	sessionService    *services.SessionService
+	mfaService        *services.MFAService
+	loginGuard        *services.LoginGuardService
+	adminSSOService   *services.AdminSSOService
 	cache             *redis.Client
 	privateKey        interface{}
 	publicKey         interface{}
+
+	backofficeRequireMFA bool
+	webauthnRPID         string
+	webauthnOrigins      []string
 }
 
 func NewHandler(db *gorm.DB, cache *redis.Client, geoIP *geoip.GeoIP, privateKey, publicKey interface{}) *Handler {
@@ -48,8 +63,21 @@ func NewHandler(db *gorm.DB, cache *redis.Client, geoIP *geoip.GeoIP, privateKey
 		backofficeService: services.NewBackofficeService(db),
 		policyService:     services.NewPolicyService(db, cache),
 		nodeService:       services.NewNodeService(db, cache), // Initialize
+		deviceService:     services.NewDeviceService(db, cache),
+		appService:        services.NewApplicationService(db, cache),
+		gatewayGroups:     services.NewGatewayGroupService(db, cache),
+		idpService:        services.NewIdentityProviderService(db, cache),
+		directoryService:  services.NewDirectoryService(db, cache),
+		sessionService:    services.NewSessionService(db, cache),
+		mfaService:        services.NewMFAService(db, cache),
+		loginGuard:        services.NewLoginGuardService(db, cache),
+		adminSSOService:   services.NewAdminSSOService(db, cache),
 		privateKey:        privateKey,
 		publicKey:         publicKey,
+
+		backofficeRequireMFA: utils.GetEnv("BACKOFFICE_REQUIRE_MFA", "false") == "true",
+		webauthnRPID:         utils.GetEnv("WEBAUTHN_RP_ID", ""),
+		webauthnOrigins:      splitList(utils.GetEnv("WEBAUTHN_ORIGINS", "")),
 	}
 }
 
@@ -64,18 +92,25 @@ func (h *Handler) LoginManagement(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Extract domain from email
-	parts := strings.Split(input.Email, "@")
-	if len(parts) != 2 {
-		common.Error(w, http.StatusBadRequest, "invalid email format")
+	key := loginAttemptKey(r, services.LoginRealmManagement, input.Email)
+
+	// Resolve tenant from the email domain
+	var tenant *models.Tenant
+	if parts := strings.Split(input.Email, "@"); len(parts) == 2 {
+		if t, err := h.tenantService.FindByDomain(parts[1]); err == nil {
+			tenant = t
+			key.TenantID = t.ID
+		}
+	}
+
+	if !h.allowLogin(w, r, key) {
 		return
 	}
-	domain := parts[1]
 
-	// Resolve tenant from the email domain
-	tenant, err := h.tenantService.FindByDomain(domain)
-	if err != nil {
-		common.Error(w, http.StatusUnauthorized, "invalid tenant domain")
+	// Unknown domains fail exactly like wrong passwords
+	if tenant == nil {
+		services.EqualizeLoginTiming(input.Password)
+		h.rejectLogin(w, r, key)
 		return
 	}
 
@@ -92,40 +127,20 @@ func (h *Handler) LoginManagement(w http.ResponseWriter, r *http.Request) {
 
 	admin, err := h.adminService.Authenticate(tenant.ID, input.Email, input.Password)
 	if err != nil {
-		common.Error(w, http.StatusUnauthorized, err.Error())
+		h.rejectLogin(w, r, key)
 		return
 	}
 
-	token, err := utils.GenerateToken(
-		h.privateKey,
-		utils.PurposeManagement,
-		admin.ID.String(),
-		admin.Email, // Email
-		tenant.ID.String(),
-		string(admin.Role),
-		nil, // Admins don't need groups for management access
-		"",  // No OS info for management login
-		24*time.Hour,
-	)
-	if err != nil {
-		common.Error(w, http.StatusInternalServerError, "failed to generate token")
+	// With single sign-on on, the local password is only for break-glass
+	// accounts. Others fail like a wrong password, so the answer does not
+	// confirm the password; the console offers single sign-on next to it.
+	if tenant.AdminSSOEnabled && !admin.BreakGlass {
+		h.recordLoginAttempt(r, key, models.LoginReasonSSORequired)
+		common.Error(w, http.StatusUnauthorized, errInvalidLogin)
 		return
 	}
 
-	// Set secure HTTP-Only cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "mgmt_token",
-		Value:    token,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		Secure:   false, // Set to true in production with HTTPS
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	common.Success(w, http.StatusOK, map[string]string{
-		"message": "login successful",
-	})
+	h.completeManagementLogin(w, r, tenant, admin, key)
 }
 
 // LoginBackoffice handles system administrator login for the Backoffice API.
@@ -139,42 +154,18 @@ func (h *Handler) LoginBackoffice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	user, err := h.backofficeService.Authenticate(input.Email, input.Password)
-	if err != nil {
-		common.Error(w, http.StatusUnauthorized, err.Error())
+	key := loginAttemptKey(r, services.LoginRealmBackoffice, input.Email)
+	if !h.allowLogin(w, r, key) {
 		return
 	}
 
-	token, err := utils.GenerateToken(
-		h.privateKey,
-		utils.PurposeBackoffice,
-		user.ID.String(),
-		user.Email, // Email
-		"",         // System wide, no tenant
-		"super_admin",
-		nil,
-		"", // No OS info for backoffice
-		24*time.Hour,
-	)
+	user, err := h.backofficeService.Authenticate(input.Email, input.Password)
 	if err != nil {
-		common.Error(w, http.StatusInternalServerError, "failed to generate token")
+		h.rejectLogin(w, r, key)
 		return
 	}
 
-	// Set secure HTTP-Only cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "backoffice_token",
-		Value:    token,
-		Path:     "/",
-		Expires:  time.Now().Add(24 * time.Hour),
-		HttpOnly: true,
-		Secure:   false,
-		SameSite: http.SameSiteLaxMode,
-	})
-
-	common.Success(w, http.StatusOK, map[string]string{
-		"message": "backoffice login successful",
-	})
+	h.completeBackofficeLogin(w, r, user, key)
 }
 
 // LogoutBackoffice clears the backoffice authentication cookie.
@@ -231,27 +222,16 @@ func (h *Handler) MeManagement(w http.ResponseWriter, r *http.Request) {
 	common.Success(w, http.StatusOK, admin)
 }
 
-// getOAuth2Config constructs the OAuth2 config using tenant-specific credentials
-func (h *Handler) getOAuth2Config(tenant *models.Tenant, r *http.Request) *oauth2.Config {
+// authBaseURL returns the origin the browser used to reach the auth service.
+func authBaseURL(r *http.Request) string {
 	protocol := "http"
 	if r.TLS != nil {
 		protocol = "https"
 	}
-	redirectURL := fmt.Sprintf("%s://%s/callback", protocol, r.Host)
-
-	return &oauth2.Config{
-		ClientID:     tenant.GoogleClientID,
-		ClientSecret: tenant.GoogleClientSecret,
-		RedirectURL:  redirectURL,
-		Scopes: []string{
-			"https://www.googleapis.com/auth/userinfo.profile",
-			"https://www.googleapis.com/auth/userinfo.email",
-		},
-		Endpoint: google.Endpoint,
-	}
+	return fmt.Sprintf("%s://%s", protocol, r.Host)
 }
 
-// LoginTarget initiates Google OAuth2 for VPN users
+// LoginTarget initiates sign-in with the tenant's identity provider for VPN users
 func (h *Handler) LoginTarget(w http.ResponseWriter, r *http.Request) {
 	// 404 Handling for unknown paths caught by "/" pattern matching
 	if r.URL.Path != "/" && r.URL.Path != "/login" {
@@ -271,8 +251,8 @@ func (h *Handler) LoginTarget(w http.ResponseWriter, r *http.Request) {
 		country = h.geoIP.Lookup(ip)
 	}
 
-	if tenant == nil || tenant.GoogleClientID == "" {
-		common.RenderErrorPage(w, http.StatusForbidden, "Configuration Error", "Tenant Identity Provider is incomplete.", "Tenant Google Identity is not configured", ip, country)
+	if tenant == nil {
+		common.RenderErrorPage(w, http.StatusForbidden, "Configuration Error", "Tenant Identity Provider is incomplete.", "Tenant not found", ip, country)
 		return
 	}
 
@@ -283,33 +263,97 @@ func (h *Handler) LoginTarget(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Check Network Policies (Pre-Auth)
-	// Filter out users based on IP/Country before they even go to Google
+	// Filter out users based on IP/Country before they even go to the identity provider
 	if err := h.checkNetworkPolicies(r, tenant.ID); err != nil {
 		common.RenderErrorPage(w, http.StatusForbidden, "Access Suspended", "Your connection location or device does not meet the security requirements.", err.Error(), ip, country)
 		return
 	}
 
+	provider, err := h.idpService.ResolveLoginProvider(tenant, r.URL.Query().Get("idp"))
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusForbidden, "Configuration Error", "Tenant Identity Provider is incomplete.", err.Error(), ip, country)
+		return
+	}
+	signIn, err := h.idpService.Provider(r.Context(), tenant, provider, services.TargetEndpoints(authBaseURL(r)))
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusBadGateway, "Configuration Error", "The identity provider could not be reached.", err.Error(), ip, country)
+		return
+	}
+
 	port := r.URL.Query().Get("desktop_port")
+	if port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			common.Error(w, http.StatusBadRequest, "invalid desktop_port")
+			return
+		}
+	}
+	// The desktop client proves it started this sign-in when exchanging the code
+	challenge := r.URL.Query().Get("code_challenge")
+	if port != "" && (challenge == "" || r.URL.Query().Get("code_challenge_method") != "S256") {
+		common.Error(w, http.StatusBadRequest, "desktop sign-in requires an S256 code_challenge")
+		return
+	}
 	osInfo := r.URL.Query().Get("os")
 	if osInfo == "" {
 		osInfo = r.URL.Query().Get("device_os")
 	}
 
-	stateMap := map[string]string{
-		"csrf": "todo-random-string",
-		"port": port,
-		"os":   osInfo,
+	// Only a random state goes through the IdP; the client's values and the
+	// provider's (PKCE verifier, nonce, SAML request ID) stay server-side
+	state, err := services.NewLoginState()
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to start sign-in")
+		return
+	}
+	url, session, err := signIn.Begin(state)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to start sign-in")
+		return
+	}
+	if err := h.idpService.SaveLoginSession(tenant.ID, state, &services.LoginSession{
+		ProviderID:    provider.ID,
+		Values:        session,
+		DesktopPort:   port,
+		CodeChallenge: challenge,
+		OS:            osInfo,
+		PostureID:     r.URL.Query().Get("posture_id"),
+	}); err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to store login session")
+		return
 	}
-	stateJSON, _ := json.Marshal(stateMap)
-	state := base64.StdEncoding.EncodeToString(stateJSON)
 
-	conf := h.getOAuth2Config(tenant, r)
-	url := conf.AuthCodeURL(state) // In production, use a secure random state
+	// Bind the state to this browser, so a callback URL started by someone
+	// else cannot be completed here
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginStateCookie,
+		Value:    state,
+		Path:     "/",
+		MaxAge:   int(loginStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: loginStateSameSite(r),
+	})
 
 	http.Redirect(w, r, url, http.StatusTemporaryRedirect)
 }
 
-// CallbackTarget handles the callback from Google, verifies the user, and issues a Target Token
+// loginStateCookie holds the state of the browser's sign-in in progress.
+const (
+	loginStateCookie = "ztna_login_state"
+	loginStateTTL    = 10 * time.Minute
+)
+
+// loginStateSameSite lets the cookie ride along SAML's cross-site POST
+// callback, which browsers only allow for Secure cookies.
+func loginStateSameSite(r *http.Request) http.SameSite {
+	if r.TLS != nil {
+		return http.SameSiteNoneMode
+	}
+	return http.SameSiteLaxMode
+}
+
+// CallbackTarget handles the identity provider's callback (OAuth2 redirect or
+// SAML POST), verifies the user, and issues a Target Token
 func (h *Handler) CallbackTarget(w http.ResponseWriter, r *http.Request) {
 	tenant := middleware.GetTenant(r.Context())
 	if tenant == nil {
@@ -324,85 +368,141 @@ func (h *Handler) CallbackTarget(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	code := r.URL.Query().Get("code")
-	if code == "" {
-		common.Error(w, http.StatusBadRequest, "authorization code is missing")
+	ip := utils.GetClientIP(r)
+	country := ""
+	if h.geoIP != nil {
+		country = h.geoIP.Lookup(ip)
+	}
+
+	// The state (RelayState for SAML) must be the one this browser started
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = r.PostFormValue("RelayState")
+	}
+	if state == "" {
+		common.Error(w, http.StatusBadRequest, "login state is missing")
+		return
+	}
+	cookie, err := r.Cookie(loginStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		common.RenderErrorPage(w, http.StatusBadRequest, "Sign-in Failed", "This sign-in was not started from this browser. Please reconnect from the client.", "login state mismatch", ip, country)
 		return
 	}
+	http.SetCookie(w, &http.Cookie{Name: loginStateCookie, Path: "/", MaxAge: -1, HttpOnly: true, Secure: r.TLS != nil, SameSite: loginStateSameSite(r)})
 
-	conf := h.getOAuth2Config(tenant, r)
-	tok, err := conf.Exchange(r.Context(), code)
+	session, err := h.idpService.TakeLoginSession(tenantID, state)
 	if err != nil {
-		common.Error(w, http.StatusInternalServerError, "failed to exchange token: "+err.Error())
+		common.RenderErrorPage(w, http.StatusBadRequest, "Sign-in Expired", "Your sign-in took too long. Please reconnect from the client.", err.Error(), ip, country)
 		return
 	}
-
-	// Fetch user info from Google using the token
-	client := conf.Client(r.Context(), tok)
-	resp, err := client.Get("https://www.googleapis.com/oauth2/v2/userinfo")
+	desktopPort := session.DesktopPort
+	osInfo := session.OS
+	postureID := session.PostureID
+	requested := ""
+	if session.ProviderID != uuid.Nil {
+		requested = session.ProviderID.String()
+	}
+	provider, err := h.idpService.ResolveLoginProvider(tenant, requested)
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusForbidden, "Configuration Error", "Tenant Identity Provider is incomplete.", err.Error(), ip, country)
+		return
+	}
+	signIn, err := h.idpService.Provider(r.Context(), tenant, provider, services.TargetEndpoints(authBaseURL(r)))
 	if err != nil {
-		common.Error(w, http.StatusInternalServerError, "failed to get user info")
+		common.RenderErrorPage(w, http.StatusBadGateway, "Configuration Error", "The identity provider could not be reached.", err.Error(), ip, country)
 		return
 	}
-	defer resp.Body.Close()
 
-	var googleUser struct {
-		ID    string `json:"id"`
-		Email string `json:"email"`
-		Name  string `json:"name"`
+	user, err := signIn.Complete(r.Context(), r, session.Values)
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusUnauthorized, "Sign-in Failed", "Your identity provider did not confirm your sign-in.", err.Error(), ip, country)
+		return
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&googleUser); err != nil {
-		common.Error(w, http.StatusInternalServerError, "failed to decode user info")
+	groups, err := h.directoryGroups(tenantID, user.Email, user.Groups)
+	if err != nil {
+		common.RenderErrorPage(w, http.StatusForbidden, "Access Denied", "Your account is not active in your organization's directory.", err.Error(), ip, country)
 		return
 	}
 
-	// Fetch groups using Service Account (Requires Admin SDK setup in Tenant)
-	var groups []string
-	if tenant.GoogleServiceAccountKey != "" {
-		groups, _ = h.identityService.GetUserGroups(
-			r.Context(),
-			[]byte(tenant.GoogleServiceAccountKey),
-			tenant.GoogleAdminEmail,
-			googleUser.Email,
-		)
+	// Bind the attested device posture (if the client sent one) to this login.
+	// A signed report replaces the self-declared OS from the query string.
+	var device *models.Device
+	var report *posture.Report
+	if postureID != "" {
+		attested, err := h.deviceService.Redeem(tenantID, postureID)
+		if err != nil {
+			common.RenderErrorPage(w, http.StatusForbidden, "Device Check Failed", "Your device posture could not be verified. Please reconnect from the client.", err.Error(), ip, country)
+			return
+		}
+		device, err = h.deviceService.RecordPosture(tenantID, attested, user.Email)
+		if err != nil {
+			common.Error(w, http.StatusInternalServerError, "failed to record device")
+			return
+		}
+		report = &attested.Report
+		osInfo = report.OS
 	}
-
-	// Retrieve Desktop Port and OS from State
-	stateParam := r.URL.Query().Get("state")
-	var desktopPort string
-	var osInfo string
-	if stateParam != "" {
-		if data, err := base64.StdEncoding.DecodeString(stateParam); err == nil {
-			var stateMap map[string]string
-			if json.Unmarshal(data, &stateMap) == nil {
-				desktopPort = stateMap["port"]
-				osInfo = stateMap["os"]
-			}
+	if err := services.CheckDeviceAccess(tenant, device, user.Email); err != nil {
+		detail := err.Error()
+		if device != nil {
+			detail = "Device ID: " + device.DeviceID
 		}
+		switch {
+		case errors.Is(err, services.ErrDeviceBlocked):
+			common.RenderErrorPage(w, http.StatusForbidden, "Device Blocked", "This device has been blocked by your administrator.", detail, ip, country)
+		case errors.Is(err, services.ErrDevicePending):
+			common.RenderErrorPage(w, http.StatusForbidden, "Device Not Approved", "This device is waiting for your administrator's approval.", detail, ip, country)
+		case errors.Is(err, services.ErrDeviceOtherUser):
+			common.RenderErrorPage(w, http.StatusForbidden, "Device Not Approved", "This device is registered to another user.", detail, ip, country)
+		default:
+			common.RenderErrorPage(w, http.StatusForbidden, "Device Check Failed", "Your organization requires a device check. Please sign in from an up-to-date client.", detail, ip, country)
+		}
+		return
 	}
 
 	// Check Identity Policies (Post-Auth)
-	if err := h.checkIdentityPolicies(r, tenant.ID, googleUser.Email, groups, osInfo); err != nil {
-		ip := utils.GetClientIP(r)
-		country := ""
-		if h.geoIP != nil {
-			country = h.geoIP.Lookup(ip)
-		}
+	if err := h.checkIdentityPolicies(r, tenant.ID, user.Email, groups, osInfo, device, report); err != nil {
 		common.RenderErrorPage(w, http.StatusForbidden, "Access Denied", "Your account does not have permission to access these resources.", err.Error(), ip, country)
 		return
 	}
 
+	deviceID := ""
+	if device != nil {
+		deviceID = device.DeviceID
+	}
+
+	// The desktop client only gets a one-time code; it exchanges it for
+	// tokens at /token with the PKCE verifier only it knows
+	if desktopPort != "" {
+		code, err := h.sessionService.CreateHandoff(tenantID, &services.Handoff{
+			Challenge: session.CodeChallenge,
+			Subject:   user.Subject,
+			Email:     user.Email,
+			Name:      user.Name,
+			Groups:    groups,
+			OS:        osInfo,
+			DeviceID:  deviceID,
+		})
+		if err != nil {
+			common.Error(w, http.StatusInternalServerError, "failed to store sign-in")
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("http://localhost:%s/callback?code=%s", desktopPort, code), http.StatusSeeOther)
+		return
+	}
+
 	// Issue Target Token with Groups
 	targetToken, err := utils.GenerateToken(
 		h.privateKey,
 		utils.PurposeTarget,
-		googleUser.ID,
-		googleUser.Email, // Email
+		user.Subject,
+		user.Email, // Email
 		tenantID.String(),
 		"user",
 		groups,
 		osInfo,
-		2*time.Hour,
+		deviceID,
+		targetTokenTTL,
 	)
 	if err != nil {
 		fmt.Println(err)
@@ -410,23 +510,250 @@ func (h *Handler) CallbackTarget(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Already retrieved above, removing duplicate extraction
-	if desktopPort != "" {
-		redirectURL := fmt.Sprintf("http://localhost:%s/callback?token=%s&email=%s&name=%s",
-			desktopPort, targetToken, googleUser.Email, googleUser.Name)
-		http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	common.Success(w, http.StatusOK, map[string]interface{}{
+		"token":  targetToken,
+		"email":  user.Email,
+		"name":   user.Name,
+		"groups": groups,
+	})
+}
+
+// targetTokenTTL is the lifetime of the target token used against gateways.
+const targetTokenTTL = 2 * time.Hour
+
+// Token exchanges the desktop client's one-time code (with its PKCE
+// verifier) or a refresh token for a target token and a new refresh token.
+// Refreshing re-checks the directory, the device and the sign-in policies.
+func (h *Handler) Token(w http.ResponseWriter, r *http.Request) {
+	tenant := middleware.GetTenant(r.Context())
+	if tenant == nil {
+		common.Error(w, http.StatusForbidden, "tenant not found")
+		return
+	}
+	tenantID := tenant.ID
+
+	var input struct {
+		GrantType    string `json:"grant_type"`
+		Code         string `json:"code"`
+		CodeVerifier string `json:"code_verifier"`
+		RefreshToken string `json:"refresh_token"`
+		PostureID    string `json:"posture_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	switch input.GrantType {
+	case "authorization_code":
+		signIn, err := h.sessionService.RedeemHandoff(tenantID, input.Code, input.CodeVerifier)
+		if err != nil {
+			common.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		refreshToken, err := h.sessionService.IssueRefreshToken(tenantID, signIn)
+		if err != nil {
+			common.Error(w, http.StatusInternalServerError, "failed to issue refresh token")
+			return
+		}
+		h.writeTokens(w, tenantID, signIn.Subject, signIn.Email, signIn.Name, signIn.Groups, signIn.OS, signIn.DeviceID, refreshToken)
+
+	case "refresh_token":
+		used, refreshToken, err := h.sessionService.RotateRefreshToken(tenantID, input.RefreshToken)
+		if errors.Is(err, services.ErrInvalidGrant) || errors.Is(err, services.ErrRefreshTokenReused) {
+			common.Error(w, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if err != nil {
+			common.Error(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		// Access ends for good when the directory or the device says so
+		deny := func(status int, reason string) {
+			if err := h.sessionService.RevokeFamily(tenantID, used.FamilyID); err != nil {
+				log.Printf("failed to revoke refresh tokens for %s: %v", used.Email, err)
+			}
+			common.Error(w, status, reason)
+		}
+		groups, err := h.directoryGroups(tenantID, used.Email, used.Groups)
+		if err != nil {
+			deny(http.StatusForbidden, err.Error())
+			return
+		}
+
+		// A fresh posture report replaces the one from the sign-in, but only
+		// from the same device
+		osInfo, deviceID := used.OS, used.DeviceID
+		var device *models.Device
+		var report *posture.Report
+		if input.PostureID != "" {
+			attested, err := h.deviceService.Redeem(tenantID, input.PostureID)
+			if err != nil {
+				common.Error(w, http.StatusForbidden, err.Error())
+				return
+			}
+			if deviceID != "" && attested.DeviceID != deviceID {
+				deny(http.StatusForbidden, "posture report is from another device")
+				return
+			}
+			device, err = h.deviceService.RecordPosture(tenantID, attested, used.Email)
+			if err != nil {
+				common.Error(w, http.StatusInternalServerError, "failed to record device")
+				return
+			}
+			report = &attested.Report
+			osInfo, deviceID = report.OS, device.DeviceID
+		} else if deviceID != "" {
+			device, err = h.deviceService.GetDeviceByDeviceID(tenantID, deviceID)
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				common.Error(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		if err := services.CheckDeviceAccess(tenant, device, used.Email); err != nil {
+			if errors.Is(err, services.ErrDeviceBlocked) || errors.Is(err, services.ErrDeviceOtherUser) {
+				deny(http.StatusForbidden, err.Error())
+			} else {
+				common.Error(w, http.StatusForbidden, err.Error())
+			}
+			return
+		}
+
+		if err := h.checkIdentityPolicies(r, tenantID, used.Email, groups, osInfo, device, report); err != nil {
+			common.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
+		h.writeTokens(w, tenantID, used.Subject, used.Email, used.Name, groups, osInfo, deviceID, refreshToken)
+
+	default:
+		common.Error(w, http.StatusBadRequest, "unsupported grant_type")
+	}
+}
+
+// RevokeToken ends a desktop sign-in, revoking its refresh tokens.
+func (h *Handler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	tenant := middleware.GetTenant(r.Context())
+	if tenant == nil {
+		common.Error(w, http.StatusForbidden, "tenant not found")
+		return
+	}
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.sessionService.RevokeRefreshToken(tenant.ID, input.RefreshToken); err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]string{"message": "signed out"})
+}
+
+func (h *Handler) writeTokens(w http.ResponseWriter, tenantID uuid.UUID, subject, email, name string, groups []string, osInfo, deviceID, refreshToken string) {
+	targetToken, err := utils.GenerateToken(h.privateKey, utils.PurposeTarget, subject, email, tenantID.String(), "user", groups, osInfo, deviceID, targetTokenTTL)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to generate target token")
 		return
 	}
 
 	common.Success(w, http.StatusOK, map[string]interface{}{
-		"token":  targetToken,
-		"email":  googleUser.Email,
-		"name":   googleUser.Name,
-		"groups": groups,
+		"access_token":  targetToken,
+		"refresh_token": refreshToken,
+		"token_type":    "Bearer",
+		"expires_in":    int(targetTokenTTL.Seconds()),
+		"email":         email,
+		"name":          name,
+		"groups":        groups,
+	})
+}
+
+// directoryGroups applies the tenant's directory to a signed-in user. With a
+// directory the user must be provisioned and active, and the directory's
+// groups replace the ones the IdP sent.
+func (h *Handler) directoryGroups(tenantID uuid.UUID, email string, idpGroups []string) ([]string, error) {
+	hasDirectory, err := h.directoryService.HasDirectory(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if !hasDirectory {
+		return idpGroups, nil
+	}
+
+	u, err := h.directoryService.FindUserByEmail(tenantID, email)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("user is not provisioned in the directory")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !u.Active {
+		return nil, errors.New("user is deactivated in the directory")
+	}
+
+	groups := make([]string, 0, len(u.Groups))
+	for _, g := range u.Groups {
+		groups = append(groups, g.PolicyName())
+	}
+	return groups, nil
+}
+
+// SAMLMetadata returns the service provider metadata for a tenant's SAML provider
+func (h *Handler) SAMLMetadata(w http.ResponseWriter, r *http.Request) {
+	tenant := middleware.GetTenant(r.Context())
+	if tenant == nil {
+		common.Error(w, http.StatusForbidden, "tenant not found")
+		return
+	}
+
+	provider, err := h.idpService.ResolveLoginProvider(tenant, r.URL.Query().Get("idp"))
+	if err != nil || provider.Type != models.IdentityProviderSAML {
+		common.Error(w, http.StatusNotFound, "SAML identity provider not found")
+		return
+	}
+	sp, err := h.idpService.SAMLProvider(provider, services.TargetEndpoints(authBaseURL(r)))
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/samlmetadata+xml")
+	w.Write(sp.Metadata())
+}
+
+// AttestPosture accepts a signed posture report from the ztna-client before login
+// and returns a one-time posture_id to pass along to the login URL.
+func (h *Handler) AttestPosture(w http.ResponseWriter, r *http.Request) {
+	tenant := middleware.GetTenant(r.Context())
+	if tenant == nil {
+		common.Error(w, http.StatusForbidden, "tenant not found")
+		return
+	}
+
+	var envelope posture.Envelope
+	if err := json.NewDecoder(r.Body).Decode(&envelope); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	postureID, err := h.deviceService.Attest(tenant.ID, &envelope)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusOK, map[string]string{
+		"posture_id": postureID,
 	})
 }
 
-// ListGateways returns the list of active gateways for the authenticated user's tenant
+// ListGateways returns the gateway groups and standalone gateways of the
+// authenticated user's tenant that have a healthy member. The client fails
+// over between the members of a group.
 func (h *Handler) ListGateways(w http.ResponseWriter, r *http.Request) {
 	// Extract Claims
 	claims := middleware.GetClaims(r.Context())
@@ -441,47 +768,52 @@ func (h *Handler) ListGateways(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch nodes
-	nodes, err := h.nodeService.ListNodes(tenantID)
+	gateways, err := h.gatewayGroups.ListTargets(tenantID)
 	if err != nil {
 		common.Error(w, http.StatusInternalServerError, "failed to list gateways")
 		return
 	}
 
-	// Filter for active gateways and return simplified struct
-	var gateways []map[string]interface{}
-	for _, node := range nodes {
-		// Only return active and fully registered nodes
-		if node.IsActive && node.Status == "CONNECTED" {
-			// Address: We need the public address (Hostname or IP) + Port
-			addr := node.IPAddress
-			if addr == "" {
-				addr = node.Hostname
-			}
-			if addr == "" {
-				addr = "unknown-host"
-			}
-			// Should probably include port if stored, or default
-
-			gateways = append(gateways, map[string]interface{}{
-				"name":    node.Name,
-				"address": addr,
-				"ping":    "unknown",
-				"region":  "unknown",
-			})
-		}
+	common.Success(w, http.StatusOK, gateways)
+}
+
+// ListMyApplications returns the applications the signed-in user is permitted to reach,
+// for the desktop client to display.
+func (h *Handler) ListMyApplications(w http.ResponseWriter, r *http.Request) {
+	claims := middleware.GetClaims(r.Context())
+	if claims == nil {
+		common.Error(w, http.StatusUnauthorized, "unauthorized")
+		return
 	}
 
-	common.Success(w, http.StatusOK, gateways)
+	tenantID, err := uuid.Parse(claims.TenantID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid tenant id in token")
+		return
+	}
+
+	apps, err := h.policyService.ListPermittedApplications(tenantID, claims.Email, claims.Groups, claims.OS)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to list applications")
+		return
+	}
+	if apps == nil {
+		apps = []models.Application{}
+	}
+	h.appService.AttachHealth(apps)
+
+	common.Success(w, http.StatusOK, apps)
 }
 
 // evalContext holds data for policy evaluation
 type evalContext struct {
-	IP      string
-	Country string
-	Email   string
-	Groups  []string
-	OS      string
+	IP           string
+	Country      string
+	Email        string
+	Groups       []string
+	OS           string
+	DeviceStatus string          // Empty when the client did not attest
+	Posture      *posture.Report // Nil when the client did not attest
 }
 
 // checkNetworkPolicies evaluates only Network/IP/Device based policies.
@@ -528,7 +860,7 @@ func (h *Handler) checkNetworkPolicies(r *http.Request, tenantID uuid.UUID) erro
 
 func (h *Handler) isNetworkOnly(node models.PolicyNode) bool {
 	if node.Condition != nil {
-		return node.Condition.Type == "Network" || node.Condition.Type == "Device"
+		return node.Condition.Type == "Network" || node.Condition.Type == "Device" || node.Condition.Type == "Time"
 	}
 	for _, child := range node.Children {
 		if !h.isNetworkOnly(child) {
@@ -540,7 +872,7 @@ func (h *Handler) isNetworkOnly(node models.PolicyNode) bool {
 
 // checkIdentityPolicies evaluates all policies (Full Context).
 // Used at post-auth stage (callback) with user info.
-func (h *Handler) checkIdentityPolicies(r *http.Request, tenantID uuid.UUID, userEmail string, groups []string, osInfo string) error {
+func (h *Handler) checkIdentityPolicies(r *http.Request, tenantID uuid.UUID, userEmail string, groups []string, osInfo string, device *models.Device, report *posture.Report) error {
 	policies, err := h.policyService.ListSignInPolicies(tenantID)
 	if err != nil {
 		return err
@@ -558,6 +890,10 @@ func (h *Handler) checkIdentityPolicies(r *http.Request, tenantID uuid.UUID, use
 		Email:   userEmail,
 		Groups:  groups,
 		OS:      osInfo,
+		Posture: report,
+	}
+	if device != nil {
+		ctx.DeviceStatus = string(device.Status)
 	}
 
 	for _, policy := range policies {
@@ -617,6 +953,26 @@ func (h *Handler) evaluateCondition(cond *models.PolicyCondition, ctx evalContex
 
 	log.Printf("[PolicyDebug] evaluateCondition: Type=%s, Field=%s, Op=%s, Value=%s", cond.Type, cond.Field, cond.Op, cond.Value)
 
+	// Time conditions are evaluated against the current clock, not the request
+	if cond.Type == "Time" {
+		tc := schedule.Condition{Field: cond.Field, Op: cond.Op, Value: cond.Value, Timezone: cond.Timezone}
+		res, err := tc.Matches(time.Now())
+		if err != nil {
+			log.Printf("[PolicyDebug] evaluateCondition time error: %v", err)
+			return false
+		}
+		log.Printf("[PolicyDebug] evaluateCondition time result: %v", res)
+		return res
+	}
+
+	// Posture fields are evaluated against the signed device report
+	if cond.Type == "Device" && posture.IsPostureField(cond.Field) {
+		pc := posture.Condition{Field: cond.Field, Op: cond.Op, Value: cond.Value}
+		res := pc.Matches(ctx.Posture)
+		log.Printf("[PolicyDebug] evaluateCondition posture result: %v (posture: %s)", res, ctx.Posture)
+		return res
+	}
+
 	// Special operator that doesn't depend on a field
 	if cond.Op == "is_private" {
 		res := ctx.Country == "PRIVATE"
@@ -635,6 +991,8 @@ func (h *Handler) evaluateCondition(cond *models.PolicyCondition, ctx evalContex
 		val = ctx.Email
 	case "os", "device_os":
 		val = ctx.OS
+	case "device_status":
+		val = ctx.DeviceStatus
 	case "group", "user_group":
 		matched := false
 		for _, g := range ctx.Groups {
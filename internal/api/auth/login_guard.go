@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"tridorian-ztna/internal/api/common"
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/internal/services"
+	"tridorian-ztna/pkg/utils"
+)
+
+// errInvalidLogin is the only failure a password login reports, whether the
+// domain, the account or the password was wrong.
+const errInvalidLogin = "invalid email or password"
+
+// allowLogin reserves the attempt with the login guard and answers 429 with
+// Retry-After when it has to wait. The attempt counts as a failure until the
+// sign-in completes.
+func (h *Handler) allowLogin(w http.ResponseWriter, r *http.Request, key services.LoginAttemptKey) bool {
+	err := h.loginGuard.Attempt(key)
+	if err == nil {
+		return true
+	}
+
+	var throttled *services.LoginThrottledError
+	if !errors.As(err, &throttled) {
+		return true
+	}
+
+	reason := models.LoginReasonThrottled
+	if throttled.Locked {
+		reason = models.LoginReasonLocked
+	}
+	h.recordLoginAttempt(r, key, reason)
+
+	seconds := int(throttled.RetryAfter.Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	common.Error(w, http.StatusTooManyRequests, throttled.Error())
+	return false
+}
+
+// rejectLogin records a failed password login, already counted by
+// allowLogin, and answers with the uniform error.
+func (h *Handler) rejectLogin(w http.ResponseWriter, r *http.Request, key services.LoginAttemptKey) {
+	h.recordLoginAttempt(r, key, models.LoginReasonInvalidCredentials)
+	common.Error(w, http.StatusUnauthorized, errInvalidLogin)
+}
+
+func (h *Handler) recordLoginAttempt(r *http.Request, key services.LoginAttemptKey, reason string) {
+	country := ""
+	if h.geoIP != nil {
+		country = h.geoIP.Lookup(key.IP)
+	}
+	h.loginGuard.Record(key, reason, country, r.UserAgent())
+}
+
+// loginAttemptKey keys an attempt on the peer address, or the address a
+// trusted proxy forwarded, never on headers the client can set itself.
+func loginAttemptKey(r *http.Request, realm, email string) services.LoginAttemptKey {
+	return services.LoginAttemptKey{Realm: realm, Email: email, IP: utils.TrustedClientIP(r)}
+}
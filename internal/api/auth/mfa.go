@@ -0,0 +1,528 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"tridorian-ztna/internal/api/common"
+	"tridorian-ztna/internal/api/middleware"
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/internal/services"
+	"tridorian-ztna/pkg/utils"
+	"tridorian-ztna/pkg/webauthn"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// sessionTTL is the lifetime of management and backoffice sessions.
+	sessionTTL = 24 * time.Hour
+	// mfaEnrollmentTokenTTL bounds enrollment during a sign-in.
+	mfaEnrollmentTokenTTL = 10 * time.Minute
+	// relyingPartyName is shown by the browser when registering a passkey.
+	relyingPartyName = "Tridorian ZTNA"
+)
+
+// errPasskeysUnavailable is returned when no relying party is configured.
+var errPasskeysUnavailable = errors.New("passkeys are not available: the console domain is not configured")
+
+// relyingParty returns the WebAuthn relying party for an account of the
+// tenant (uuid.Nil for the backoffice). WEBAUTHN_RP_ID and WEBAUTHN_ORIGINS
+// take precedence; otherwise a tenant's console is its primary domain over
+// HTTPS. The backoffice has no domain of its own and needs WEBAUTHN_RP_ID.
+func (h *Handler) relyingParty(tenantID uuid.UUID) (webauthn.Config, error) {
+	rp := webauthn.Config{RPID: h.webauthnRPID, RPName: relyingPartyName, Origins: h.webauthnOrigins}
+	if rp.RPID == "" && tenantID != uuid.Nil {
+		if tenant, err := h.tenantService.GetTenantByID(tenantID); err == nil && tenant.PrimaryDomain != "" {
+			rp.RPID = strings.ToLower(tenant.PrimaryDomain)
+			rp.Origins = nil
+		}
+	}
+	if rp.RPID == "" {
+		return webauthn.Config{}, errPasskeysUnavailable
+	}
+	if len(rp.Origins) == 0 {
+		rp.Origins = []string{"https://" + rp.RPID}
+	}
+	return rp, nil
+}
+
+// completeManagementLogin runs after the password was accepted: it asks for
+// the second factor, asks for enrollment when the tenant requires one, or
+// signs the administrator in.
+func (h *Handler) completeManagementLogin(w http.ResponseWriter, r *http.Request, tenant *models.Tenant, admin *models.Administrator, key services.LoginAttemptKey) {
+	owner := services.AdminMFAOwner(admin)
+	enrolled, err := h.mfaService.Enrolled(owner)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to check multi-factor authentication")
+		return
+	}
+	if enrolled {
+		h.startMFAChallenge(w, r, owner, key)
+		return
+	}
+	// Without a second factor the password completes the sign-in
+	h.loginGuard.Succeed(key, 1)
+	if tenant.RequireAdminMFA {
+		h.startMFAEnrollment(w, utils.PurposeManagementMFA, admin.ID, admin.Email, admin.TenantID.String(), string(admin.Role))
+		return
+	}
+	h.issueManagementSession(w, admin)
+}
+
+// completeBackofficeLogin is completeManagementLogin for backoffice users,
+// where BACKOFFICE_REQUIRE_MFA plays the part of the tenant setting.
+func (h *Handler) completeBackofficeLogin(w http.ResponseWriter, r *http.Request, user *models.BackofficeUser, key services.LoginAttemptKey) {
+	owner := services.BackofficeMFAOwner(user)
+	enrolled, err := h.mfaService.Enrolled(owner)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to check multi-factor authentication")
+		return
+	}
+	if enrolled {
+		h.startMFAChallenge(w, r, owner, key)
+		return
+	}
+	h.loginGuard.Succeed(key, 1)
+	if h.backofficeRequireMFA {
+		h.startMFAEnrollment(w, utils.PurposeBackofficeMFA, user.ID, user.Email, "", "super_admin")
+		return
+	}
+	h.issueBackofficeSession(w, user)
+}
+
+func (h *Handler) startMFAChallenge(w http.ResponseWriter, r *http.Request, owner services.MFAOwner, key services.LoginAttemptKey) {
+	// Without a relying party only the other factors are offered
+	rp, _ := h.relyingParty(owner.TenantID)
+	challenge, err := h.mfaService.StartChallenge(owner, rp, &key)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to start verification")
+		return
+	}
+	common.Success(w, http.StatusOK, struct {
+		MFARequired bool `json:"mfa_required"`
+		*services.MFAChallenge
+	}{MFARequired: true, MFAChallenge: challenge})
+}
+
+// startMFAEnrollment hands out a short-lived token that only allows enrolling
+// a second factor. Confirming the enrollment completes the sign-in.
+func (h *Handler) startMFAEnrollment(w http.ResponseWriter, purpose utils.TokenPurpose, id uuid.UUID, email, tenantID, role string) {
+	token, err := utils.GenerateToken(h.privateKey, purpose, id.String(), email, tenantID, role, nil, "", "", mfaEnrollmentTokenTTL)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]interface{}{
+		"mfa_enrollment_required": true,
+		"mfa_token":               token,
+	})
+}
+
+func (h *Handler) issueManagementSession(w http.ResponseWriter, admin *models.Administrator) {
+	if err := h.setManagementCookie(w, admin); err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]string{
+		"message": "login successful",
+	})
+}
+
+func (h *Handler) issueBackofficeSession(w http.ResponseWriter, user *models.BackofficeUser) {
+	if err := h.setBackofficeCookie(w, user); err != nil {
+		common.Error(w, http.StatusInternalServerError, "failed to generate token")
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]string{
+		"message": "backoffice login successful",
+	})
+}
+
+func (h *Handler) setManagementCookie(w http.ResponseWriter, admin *models.Administrator) error {
+	token, err := utils.GenerateToken(
+		h.privateKey,
+		utils.PurposeManagement,
+		admin.ID.String(),
+		admin.Email, // Email
+		admin.TenantID.String(),
+		string(admin.Role),
+		nil, // Admins don't need groups for management access
+		"",  // No OS info for management login
+		"",  // No device binding
+		sessionTTL,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Set secure HTTP-Only cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:     "mgmt_token",
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(sessionTTL),
+		HttpOnly: true,
+		Secure:   false, // Set to true in production with HTTPS
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (h *Handler) setBackofficeCookie(w http.ResponseWriter, user *models.BackofficeUser) error {
+	token, err := utils.GenerateToken(
+		h.privateKey,
+		utils.PurposeBackoffice,
+		user.ID.String(),
+		user.Email, // Email
+		"",         // System wide, no tenant
+		"super_admin",
+		nil,
+		"", // No OS info for backoffice
+		"", // No device binding
+		sessionTTL,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Set secure HTTP-Only cookie
+	http.SetCookie(w, &http.Cookie{
+		Name:     "backoffice_token",
+		Value:    token,
+		Path:     "/",
+		Expires:  time.Now().Add(sessionTTL),
+		HttpOnly: true,
+		Secure:   false,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// VerifyManagementMFA completes an administrator sign-in with the second factor.
+func (h *Handler) VerifyManagementMFA(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := h.verifyMFA(w, r, models.MFAOwnerAdmin)
+	if !ok {
+		return
+	}
+	admin, err := h.adminService.GetByID(ownerID)
+	if err != nil {
+		common.Error(w, http.StatusUnauthorized, "admin not found")
+		return
+	}
+	h.issueManagementSession(w, admin)
+}
+
+// VerifyBackofficeMFA completes a backoffice sign-in with the second factor.
+func (h *Handler) VerifyBackofficeMFA(w http.ResponseWriter, r *http.Request) {
+	ownerID, ok := h.verifyMFA(w, r, models.MFAOwnerBackoffice)
+	if !ok {
+		return
+	}
+	user, err := h.backofficeService.GetByID(ownerID)
+	if err != nil {
+		common.Error(w, http.StatusUnauthorized, "user not found")
+		return
+	}
+	h.issueBackofficeSession(w, user)
+}
+
+func (h *Handler) verifyMFA(w http.ResponseWriter, r *http.Request, ownerType models.MFAOwnerType) (uuid.UUID, bool) {
+	var input struct {
+		Token string `json:"mfa_token"`
+		services.MFAVerification
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return uuid.Nil, false
+	}
+
+	// Each code counts against the account like a password, from whichever
+	// address it comes
+	login := h.mfaService.ChallengeLogin(input.Token)
+	if login == nil {
+		common.Error(w, http.StatusUnauthorized, services.ErrMFAChallengeExpired.Error())
+		return uuid.Nil, false
+	}
+	key := *login
+	key.IP = utils.TrustedClientIP(r)
+	if !h.allowLogin(w, r, key) {
+		return uuid.Nil, false
+	}
+
+	gotType, ownerID, err := h.mfaService.VerifyChallenge(input.Token, &input.MFAVerification)
+	if err != nil {
+		if errors.Is(err, services.ErrMFAInvalid) || errors.Is(err, services.ErrMFAChallengeExpired) {
+			h.recordLoginAttempt(r, key, models.LoginReasonInvalidMFA)
+		}
+		common.Error(w, http.StatusUnauthorized, err.Error())
+		return uuid.Nil, false
+	}
+	if gotType != ownerType {
+		common.Error(w, http.StatusUnauthorized, services.ErrMFAChallengeExpired.Error())
+		return uuid.Nil, false
+	}
+	// The password and this code
+	h.loginGuard.Succeed(key, 2)
+	return ownerID, true
+}
+
+// mfaAccount is the signed-in account managing its own second factors.
+type mfaAccount struct {
+	owner     services.MFAOwner
+	issuer    string // Shown in authenticator apps
+	required  bool   // The last factor cannot be removed
+	enrolling bool   // Signed in with an enrollment token, not a session
+	admin     *models.Administrator
+	user      *models.BackofficeUser
+}
+
+func (h *Handler) currentMFAAccount(r *http.Request) (*mfaAccount, error) {
+	claims := middleware.GetClaims(r.Context())
+	if claims == nil {
+		return nil, errors.New("authentication required")
+	}
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return nil, errors.New("invalid token subject")
+	}
+
+	switch claims.Purpose {
+	case utils.PurposeManagement, utils.PurposeManagementMFA:
+		admin, err := h.adminService.GetByID(id)
+		if err != nil || admin.TenantID.String() != claims.TenantID {
+			return nil, errors.New("admin not found")
+		}
+		tenant, err := h.tenantService.GetTenantByID(admin.TenantID)
+		if err != nil {
+			return nil, errors.New("tenant not found")
+		}
+		return &mfaAccount{
+			owner:     services.AdminMFAOwner(admin),
+			issuer:    relyingPartyName + " (" + tenant.Name + ")",
+			required:  tenant.RequireAdminMFA,
+			enrolling: claims.Purpose == utils.PurposeManagementMFA,
+			admin:     admin,
+		}, nil
+
+	case utils.PurposeBackoffice, utils.PurposeBackofficeMFA:
+		user, err := h.backofficeService.GetByID(id)
+		if err != nil {
+			return nil, errors.New("user not found")
+		}
+		return &mfaAccount{
+			owner:     services.BackofficeMFAOwner(user),
+			issuer:    relyingPartyName + " Backoffice",
+			required:  h.backofficeRequireMFA,
+			enrolling: claims.Purpose == utils.PurposeBackofficeMFA,
+			user:      user,
+		}, nil
+	}
+	return nil, errors.New("token not authorized for this action")
+}
+
+// finishEnrollment returns a newly enrolled factor. During a sign-in it also
+// starts the session the enrollment token stood in for.
+func (h *Handler) finishEnrollment(w http.ResponseWriter, account *mfaAccount, cred *models.MFACredential, codes []string) {
+	if account.enrolling {
+		var err error
+		if account.admin != nil {
+			err = h.setManagementCookie(w, account.admin)
+		} else {
+			err = h.setBackofficeCookie(w, account.user)
+		}
+		if err != nil {
+			common.Error(w, http.StatusInternalServerError, "failed to generate token")
+			return
+		}
+	}
+
+	common.Success(w, http.StatusCreated, map[string]interface{}{
+		"credential":     cred,
+		"recovery_codes": codes,
+		"logged_in":      account.enrolling,
+	})
+}
+
+// ListMFA returns the signed-in account's second factors.
+func (h *Handler) ListMFA(w http.ResponseWriter, r *http.Request) {
+	account, err := h.currentMFAAccount(r)
+	if err != nil {
+		common.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	creds, err := h.mfaService.ListCredentials(account.owner)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	remaining, err := h.mfaService.RemainingRecoveryCodes(account.owner)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]interface{}{
+		"credentials":              creds,
+		"recovery_codes_remaining": remaining,
+		"required":                 account.required,
+	})
+}
+
+// BeginTOTP starts enrolling an authenticator app.
+func (h *Handler) BeginTOTP(w http.ResponseWriter, r *http.Request) {
+	account, err := h.currentMFAAccount(r)
+	if err != nil {
+		common.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	secret, uri, err := h.mfaService.BeginTOTP(account.owner, account.issuer)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]string{"secret": secret, "uri": uri})
+}
+
+// ConfirmTOTP finishes enrolling an authenticator app with a code from it.
+func (h *Handler) ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	account, err := h.currentMFAAccount(r)
+	if err != nil {
+		common.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var input struct {
+		Name string `json:"name"`
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	cred, codes, err := h.mfaService.ConfirmTOTP(account.owner, input.Name, input.Code)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.finishEnrollment(w, account, cred, codes)
+}
+
+// BeginWebAuthn starts registering a passkey or security key.
+func (h *Handler) BeginWebAuthn(w http.ResponseWriter, r *http.Request) {
+	account, err := h.currentMFAAccount(r)
+	if err != nil {
+		common.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	rp, err := h.relyingParty(account.owner.TenantID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	options, err := h.mfaService.BeginWebAuthn(account.owner, rp)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, options)
+}
+
+// FinishWebAuthn stores a registered passkey or security key.
+func (h *Handler) FinishWebAuthn(w http.ResponseWriter, r *http.Request) {
+	account, err := h.currentMFAAccount(r)
+	if err != nil {
+		common.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var input struct {
+		Name       string                        `json:"name"`
+		Credential webauthn.RegistrationResponse `json:"credential"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	rp, err := h.relyingParty(account.owner.TenantID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	cred, codes, err := h.mfaService.FinishWebAuthn(account.owner, rp, input.Name, &input.Credential)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.finishEnrollment(w, account, cred, codes)
+}
+
+// RegenerateRecoveryCodes replaces the signed-in account's recovery codes.
+func (h *Handler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	account, err := h.currentMFAAccount(r)
+	if err != nil {
+		common.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if account.enrolling {
+		common.Error(w, http.StatusForbidden, "token not authorized for this action")
+		return
+	}
+	codes, err := h.mfaService.RegenerateRecoveryCodes(account.owner)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]interface{}{"recovery_codes": codes})
+}
+
+// DeleteMFACredential removes one of the signed-in account's second factors.
+func (h *Handler) DeleteMFACredential(w http.ResponseWriter, r *http.Request) {
+	account, err := h.currentMFAAccount(r)
+	if err != nil {
+		common.Error(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	if account.enrolling {
+		common.Error(w, http.StatusForbidden, "token not authorized for this action")
+		return
+	}
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	id, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid credential id")
+		return
+	}
+
+	if err := h.mfaService.DeleteCredential(account.owner, id, account.required); err != nil {
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			common.Error(w, http.StatusNotFound, "credential not found")
+		case errors.Is(err, services.ErrMFARequired):
+			common.Error(w, http.StatusBadRequest, err.Error())
+		default:
+			common.Error(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]string{"message": "credential removed"})
+}
+
+// splitList splits a comma separated setting, dropping empty entries.
+func splitList(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"net/http"
+	"strings"
 	"tridorian-ztna/internal/api/middleware"
 	"tridorian-ztna/internal/services"
 	"tridorian-ztna/pkg/geoip"
@@ -50,6 +51,22 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	if path == "/auth/backoffice/mfa/verify" {
+		if method == http.MethodPost {
+			r.handler.VerifyBackofficeMFA(w, req)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	if strings.HasPrefix(path, "/auth/backoffice/mfa") {
+		middleware.JWTAuthAny(r.publicKey, utils.PurposeBackoffice, utils.PurposeBackofficeMFA)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.serveMFA(w, req, strings.TrimPrefix(path, "/auth/backoffice/mfa"))
+		})).ServeHTTP(w, req)
+		return
+	}
+
 	// 1. Management Authentication (For local admins)
 	if path == "/auth/mgmt/login" {
 		if method == http.MethodPost {
@@ -70,10 +87,48 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// Administrator sign-in through the tenant's identity provider
+	if path == "/auth/mgmt/sso" && method == http.MethodGet {
+		r.handler.StartAdminSSO(w, req)
+		return
+	}
+
+	if path == "/auth/mgmt/sso/callback" || path == "/auth/mgmt/sso/acs" {
+		if path == "/auth/mgmt/sso/acs" && method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		r.handler.CallbackAdminSSO(w, req)
+		return
+	}
+
+	if path == "/auth/mgmt/sso/metadata" {
+		r.handler.AdminSSOMetadata(w, req)
+		return
+	}
+
+	if path == "/auth/mgmt/mfa/verify" {
+		if method == http.MethodPost {
+			r.handler.VerifyManagementMFA(w, req)
+		} else {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+		return
+	}
+
+	// Second factors of the signed-in admin; an enrollment token from the
+	// login response is accepted too
+	if strings.HasPrefix(path, "/auth/mgmt/mfa") {
+		middleware.JWTAuthAny(r.publicKey, utils.PurposeManagement, utils.PurposeManagementMFA)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			r.serveMFA(w, req, strings.TrimPrefix(path, "/auth/mgmt/mfa"))
+		})).ServeHTTP(w, req)
+		return
+	}
+
 	// Auth routes always require tenant context from host
 	tenantBoundHandlers := http.NewServeMux()
 
-	// 2. Target Authentication (For VPN users via Google Identity)
+	// 2. Target Authentication (For VPN users via the tenant's identity provider)
 	tenantBoundHandlers.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
 		r.handler.LoginTarget(w, req)
 	})
@@ -82,10 +137,56 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		r.handler.CallbackTarget(w, req)
 	})
 
+	// SAML assertion consumer service (HTTP-POST binding) and SP metadata
+	tenantBoundHandlers.HandleFunc("/saml/acs", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		r.handler.CallbackTarget(w, req)
+	})
+
+	tenantBoundHandlers.HandleFunc("/saml/metadata", func(w http.ResponseWriter, req *http.Request) {
+		r.handler.SAMLMetadata(w, req)
+	})
+
+	tenantBoundHandlers.HandleFunc("/posture", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		r.handler.AttestPosture(w, req)
+	})
+
+	// Desktop client token exchange, refresh and sign-out
+	tenantBoundHandlers.HandleFunc("/token", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		r.handler.Token(w, req)
+	})
+
+	tenantBoundHandlers.HandleFunc("/token/revoke", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		r.handler.RevokeToken(w, req)
+	})
+
 	tenantBoundHandlers.HandleFunc("/gateways", func(w http.ResponseWriter, req *http.Request) {
 		middleware.JWTAuth(r.publicKey, utils.PurposeTarget)(http.HandlerFunc(r.handler.ListGateways)).ServeHTTP(w, req)
 	})
 
+	tenantBoundHandlers.HandleFunc("/applications", func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		middleware.JWTAuth(r.publicKey, utils.PurposeTarget)(http.HandlerFunc(r.handler.ListMyApplications)).ServeHTTP(w, req)
+	})
+
 	// Public Health Check (Optional, but good to have inside the mux or outside)
 	if path == "/health" && method == http.MethodGet {
 		w.WriteHeader(http.StatusOK)
@@ -96,3 +197,26 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	// Wrap specific paths with tenant middleware
 	r.tenantMiddleware(tenantBoundHandlers).ServeHTTP(w, req)
 }
+
+// serveMFA routes the second factor endpoints shared by administrators and
+// backoffice users; sub is the path below .../mfa.
+func (r *Router) serveMFA(w http.ResponseWriter, req *http.Request, sub string) {
+	switch {
+	case sub == "" && req.Method == http.MethodGet:
+		r.handler.ListMFA(w, req)
+	case sub == "" && req.Method == http.MethodDelete:
+		r.handler.DeleteMFACredential(w, req)
+	case sub == "/totp" && req.Method == http.MethodPost:
+		r.handler.BeginTOTP(w, req)
+	case sub == "/totp/confirm" && req.Method == http.MethodPost:
+		r.handler.ConfirmTOTP(w, req)
+	case sub == "/webauthn" && req.Method == http.MethodPost:
+		r.handler.BeginWebAuthn(w, req)
+	case sub == "/webauthn/finish" && req.Method == http.MethodPost:
+		r.handler.FinishWebAuthn(w, req)
+	case sub == "/recovery-codes" && req.Method == http.MethodPost:
+		r.handler.RegenerateRecoveryCodes(w, req)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
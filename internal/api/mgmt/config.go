@@ -0,0 +1,132 @@
+package mgmt
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+	"tridorian-ztna/internal/api/common"
+	"tridorian-ztna/internal/api/middleware"
+	"tridorian-ztna/internal/services"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxConfigDocumentSize limits imported configuration documents.
+const maxConfigDocumentSize = 4 << 20
+
+// requireUnscoped refuses administrators scoped to some nodes or
+// applications: configuration documents and sign-in policies cover the
+// whole tenant.
+func requireUnscoped(w http.ResponseWriter, r *http.Request) bool {
+	grant := middleware.GetGrant(r.Context())
+	if grant != nil && (len(grant.NodeIDs) > 0 || len(grant.ApplicationIDs) > 0) {
+		common.Error(w, http.StatusForbidden, "administrators scoped to nodes or applications cannot manage tenant-wide settings")
+		return false
+	}
+	return true
+}
+
+// ExportConfig returns the tenant's configuration document, or with
+// format=yaml or format=json the document itself as a download.
+func (h *Handler) ExportConfig(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "yaml" && format != "json" {
+		common.Error(w, http.StatusBadRequest, "format must be yaml or json")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	config, err := h.configService.Export(tenantID)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if format == "" {
+		common.Success(w, http.StatusOK, config)
+		return
+	}
+
+	var data []byte
+	if format == "yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err = enc.Encode(config); err == nil {
+			err = enc.Close()
+		}
+		data = buf.Bytes()
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		data, err = json.MarshalIndent(config, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	filename := fmt.Sprintf("tenant-config-%s.%s", time.Now().UTC().Format("20060102-150405"), format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.Write(data)
+}
+
+// ImportConfig applies a YAML or JSON configuration document, or with
+// dry_run=true returns the changes it would make.
+func (h *Handler) ImportConfig(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxConfigDocumentSize))
+	if err != nil {
+		common.Error(w, http.StatusRequestEntityTooLarge, "configuration document is too large")
+		return
+	}
+
+	// JSON is YAML, so one decoder reads both. Unknown fields are refused
+	// so that a misspelt field is not silently ignored.
+	var doc services.TenantConfig
+	dec := yaml.NewDecoder(bytes.NewReader(body))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("empty document")
+		}
+		common.Error(w, http.StatusBadRequest, "invalid configuration document: "+err.Error())
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	plan, err := h.configService.Import(tenantID, &doc, dryRun, auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, plan)
+}
+
+// GetConfigDrift compares the live configuration with the last imported
+// document.
+func (h *Handler) GetConfigDrift(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
+	tenantID := middleware.GetTenantID(r.Context())
+	drift, err := h.configService.Drift(tenantID)
+	if errors.Is(err, services.ErrNoConfigRevision) {
+		common.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, drift)
+}
@@ -1,7 +1,9 @@
 package mgmt
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,6 +12,7 @@ import (
 	"tridorian-ztna/internal/api/middleware"
 	"tridorian-ztna/internal/models"
 	"tridorian-ztna/internal/services"
+	"tridorian-ztna/pkg/utils"
 
 	"github.com/google/uuid"
 )
@@ -19,18 +22,42 @@ type Handler struct {
 	tenantService      *services.TenantService
 	policyService      *services.PolicyService
 	nodeService        *services.NodeService
-	identityService    *services.IdentityService
 	applicationService *services.ApplicationService
+	deviceService      *services.DeviceService
+
+	identityProviderService *services.IdentityProviderService
+	directoryService        *services.DirectoryService
+	directorySyncService    *services.DirectorySyncService
+	mfaService              *services.MFAService
+	loginGuardService       *services.LoginGuardService
+	adminSSOService         *services.AdminSSOService
+	roleService             *services.RoleService
+	sessionService          *services.SessionService
+	auditService            *services.AuditService
+	configService           *services.ConfigService
+	gatewayGroupService     *services.GatewayGroupService
 }
 
-func NewHandler(adminService *services.AdminService, tenantService *services.TenantService, policyService *services.PolicyService, nodeService *services.NodeService, identityService *services.IdentityService, applicationService *services.ApplicationService) *Handler {
+func NewHandler(adminService *services.AdminService, tenantService *services.TenantService, policyService *services.PolicyService, nodeService *services.NodeService, applicationService *services.ApplicationService, deviceService *services.DeviceService, identityProviderService *services.IdentityProviderService, directoryService *services.DirectoryService, directorySyncService *services.DirectorySyncService, mfaService *services.MFAService, loginGuardService *services.LoginGuardService, adminSSOService *services.AdminSSOService, roleService *services.RoleService, sessionService *services.SessionService, auditService *services.AuditService, configService *services.ConfigService, gatewayGroupService *services.GatewayGroupService) *Handler {
 	return &Handler{
 		adminService:       adminService,
 		tenantService:      tenantService,
 		policyService:      policyService,
 		nodeService:        nodeService,
-		identityService:    identityService,
 		applicationService: applicationService,
+		deviceService:      deviceService,
+
+		identityProviderService: identityProviderService,
+		directoryService:        directoryService,
+		directorySyncService:    directorySyncService,
+		mfaService:              mfaService,
+		loginGuardService:       loginGuardService,
+		adminSSOService:         adminSSOService,
+		roleService:             roleService,
+		sessionService:          sessionService,
+		auditService:            auditService,
+		configService:           configService,
+		gatewayGroupService:     gatewayGroupService,
 	}
 }
 
@@ -60,19 +87,23 @@ func (h *Handler) ListAdmins(w http.ResponseWriter, r *http.Request) {
 func (h *Handler) CreateAdmin(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
 	var input struct {
-		Name     string           `json:"name"`
-		Email    string           `json:"email"`
-		Password string           `json:"password"`
-		Role     models.AdminRole `json:"role"`
+		Name     string `json:"name"`
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		services.AdminAccess
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		common.Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
-	admin, password, err := h.adminService.CreateAdmin(tenantID, input.Name, input.Email, input.Password, input.Role)
+	admin, password, err := h.adminService.CreateAdmin(tenantID, input.Name, input.Email, input.Password, input.AdminAccess, middleware.GetGrant(r.Context()), auditActor(r))
 	if err != nil {
-		common.Error(w, http.StatusInternalServerError, err.Error())
+		if errors.Is(err, services.ErrPrivilegeEscalation) {
+			common.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
+		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -115,7 +146,11 @@ func (h *Handler) DeleteAdmin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.adminService.DeleteAdmin(tenantID, adminID); err != nil {
+	if err := h.adminService.DeleteAdmin(tenantID, adminID, middleware.GetGrant(r.Context()), auditActor(r)); err != nil {
+		if errors.Is(err, services.ErrPrivilegeEscalation) {
+			common.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -123,12 +158,53 @@ func (h *Handler) DeleteAdmin(w http.ResponseWriter, r *http.Request) {
 	common.Success(w, http.StatusOK, map[string]string{"message": "admin deleted"})
 }
 
-func (h *Handler) UpdateAdmin(w http.ResponseWriter, r *http.Request) {
+// GetAdminSSO returns the tenant's administrator single sign-on settings and
+// role mappings.
+func (h *Handler) GetAdminSSO(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	settings, err := h.adminSSOService.GetSettings(tenantID)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, settings)
+}
+
+// UpdateAdminSSO replaces the tenant's administrator single sign-on settings
+// and role mappings.
+func (h *Handler) UpdateAdminSSO(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input services.AdminSSOSettings
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.adminSSOService.UpdateSettings(tenantID, &input, auditActor(r)); err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusOK, map[string]string{"message": "admin single sign-on updated"})
+}
+
+// ListLoginAttempts returns the tenant's recent refused console sign-ins.
+func (h *Handler) ListLoginAttempts(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	attempts, err := h.loginGuardService.ListAttempts(tenantID, 100)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, attempts)
+}
+
+// ResetAdminMFA removes another administrator's second factors, for when they
+// lost their authenticator and recovery codes.
+func (h *Handler) ResetAdminMFA(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
 	var input struct {
-		ID   string           `json:"id"`
-		Name string           `json:"name"`
-		Role models.AdminRole `json:"role"`
+		ID string `json:"id"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		common.Error(w, http.StatusBadRequest, "invalid request body")
@@ -140,15 +216,176 @@ func (h *Handler) UpdateAdmin(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusBadRequest, "invalid admin id")
 		return
 	}
+	if r.Context().Value(middleware.AdminIDKey).(string) == input.ID {
+		common.Error(w, http.StatusBadRequest, "use your recovery codes to reset your own second factors")
+		return
+	}
 
-	if err := h.adminService.UpdateAdmin(tenantID, adminID, input.Name, input.Role); err != nil {
+	admin, err := h.adminService.GetByID(adminID)
+	if err != nil || admin.TenantID != tenantID {
+		common.Error(w, http.StatusNotFound, "admin not found")
+		return
+	}
+	if err := h.adminService.CanManage(middleware.GetGrant(r.Context()), tenantID, adminID); err != nil {
+		common.Error(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if err := h.mfaService.Reset(services.AdminMFAOwner(admin), auditActor(r)); err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	common.Success(w, http.StatusOK, map[string]string{"message": "multi-factor authentication reset"})
+}
+
+func (h *Handler) UpdateAdmin(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		ID         string `json:"id"`
+		Name       string `json:"name"`
+		BreakGlass *bool  `json:"break_glass"` // Omitted leaves it unchanged
+		services.AdminAccess
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	adminID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid admin id")
+		return
+	}
+
+	// Without a role the administrator's access is left unchanged
+	var access *services.AdminAccess
+	if input.Role != "" {
+		access = &input.AdminAccess
+	}
+	if err := h.adminService.UpdateAdmin(tenantID, adminID, input.Name, access, input.BreakGlass, middleware.GetGrant(r.Context()), auditActor(r)); err != nil {
+		if errors.Is(err, services.ErrPrivilegeEscalation) {
+			common.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	common.Success(w, http.StatusOK, map[string]string{"message": "admin updated"})
 }
 
+// GetMyPermissions returns what the signed-in administrator may do, for the
+// console to hide what they cannot use.
+func (h *Handler) GetMyPermissions(w http.ResponseWriter, r *http.Request) {
+	common.Success(w, http.StatusOK, middleware.GetGrant(r.Context()))
+}
+
+// ListRoles returns the tenant's custom roles along with the built-in roles
+// and every permission a custom role can hold.
+func (h *Handler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	roles, err := h.roleService.ListRoles(tenantID)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]interface{}{
+		"roles":       roles,
+		"builtin":     services.BuiltinRoles(),
+		"permissions": models.AllPermissions,
+	})
+}
+
+// roleInput is the request body for creating and updating custom roles.
+type roleInput struct {
+	ID          string              `json:"id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+func (in *roleInput) toModel() *models.Role {
+	return &models.Role{
+		Name:        in.Name,
+		Description: in.Description,
+		Permissions: in.Permissions,
+	}
+}
+
+func (h *Handler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input roleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	role := input.toModel()
+	if err := h.roleService.CreateRole(tenantID, role, middleware.GetGrant(r.Context()), auditActor(r)); err != nil {
+		if errors.Is(err, services.ErrPrivilegeEscalation) {
+			common.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusCreated, role)
+}
+
+func (h *Handler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input roleInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	roleID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid role id")
+		return
+	}
+
+	role := input.toModel()
+	role.ID = roleID
+	if err := h.roleService.UpdateRole(tenantID, role, middleware.GetGrant(r.Context()), auditActor(r)); err != nil {
+		if errors.Is(err, services.ErrPrivilegeEscalation) {
+			common.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]string{"message": "role updated"})
+}
+
+func (h *Handler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	roleID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid role id")
+		return
+	}
+
+	if err := h.roleService.DeleteRole(tenantID, roleID, middleware.GetGrant(r.Context()), auditActor(r)); err != nil {
+		if errors.Is(err, services.ErrPrivilegeEscalation) {
+			common.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]string{"message": "role deleted"})
+}
+
 func (h *Handler) CreateTenant(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Name          string `json:"name"`
@@ -160,8 +397,13 @@ func (h *Handler) CreateTenant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tenant, admin, password, err := h.tenantService.CreateTenantWithAdmin(input.Name, input.AdminEmail, input.AdminPassword)
+	tenant, admin, password, err := h.tenantService.CreateTenantWithAdmin(input.Name, input.AdminEmail, input.AdminPassword, auditActor(r))
 	if err != nil {
+		var policyErr *utils.PasswordPolicyError
+		if errors.As(err, &policyErr) {
+			common.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -192,7 +434,7 @@ func (h *Handler) DeleteTenant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.tenantService.DeleteTenant(tenantID); err != nil {
+	if err := h.tenantService.DeleteTenant(tenantID, auditActor(r)); err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -210,7 +452,7 @@ func (h *Handler) ActivateDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.tenantService.ActivateDomain(tenantID, input.Domain); err != nil {
+	if err := h.tenantService.ActivateDomain(tenantID, input.Domain, auditActor(r)); err != nil {
 		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -230,11 +472,20 @@ func (h *Handler) UpdateIdentity(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.tenantService.UpdateGoogleIdentity(tenantID, input.ClientID, input.ClientSecret, input.SAKey, input.AdminEmail)
+	err := h.tenantService.UpdateGoogleIdentity(tenantID, input.ClientID, input.ClientSecret, input.SAKey, input.AdminEmail, auditActor(r))
 	if err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+
+	// Fill the directory now rather than at the next scheduled sync
+	if input.SAKey != "" && input.AdminEmail != "" {
+		go func() {
+			if err := h.directorySyncService.SyncTenant(context.Background(), tenantID); err != nil {
+				log.Printf("directory sync failed for tenant %s: %v", tenantID, err)
+			}
+		}()
+	}
 	common.Success(w, http.StatusOK, map[string]string{"message": "identity configuration updated and encrypted"})
 }
 
@@ -248,7 +499,7 @@ func (h *Handler) UpdateTenant(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.tenantService.UpdateTenant(tenantID, input.Name); err != nil {
+	if err := h.tenantService.UpdateTenant(tenantID, input.Name, auditActor(r)); err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -256,6 +507,44 @@ func (h *Handler) UpdateTenant(w http.ResponseWriter, r *http.Request) {
 	common.Success(w, http.StatusOK, map[string]string{"message": "tenant updated"})
 }
 
+// UpdateDNSSettings sets the split DNS configuration pushed to clients.
+func (h *Handler) UpdateDNSSettings(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		Domains        []string `json:"dns_domains"`
+		Resolvers      []string `json:"dns_resolvers"`
+		SearchSuffixes []string `json:"dns_search_suffixes"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.tenantService.UpdateDNSSettings(tenantID, input.Domains, input.Resolvers, input.SearchSuffixes, auditActor(r)); err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusOK, map[string]string{"message": "dns settings updated"})
+}
+
+// UpdateSecuritySettings sets the tenant's sign-in requirements for administrators.
+func (h *Handler) UpdateSecuritySettings(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input services.SecuritySettings
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if err := h.tenantService.UpdateSecuritySettings(tenantID, input, auditActor(r)); err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusOK, map[string]string{"message": "security settings updated"})
+}
+
 func (h *Handler) GetMyTenant(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
 
@@ -287,7 +576,7 @@ func (h *Handler) RegisterCustomDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	customDomain, err := h.tenantService.RegisterCustomDomain(tenantID, input.Domain)
+	customDomain, err := h.tenantService.RegisterCustomDomain(tenantID, input.Domain, auditActor(r))
 	if err != nil {
 		common.Error(w, http.StatusBadRequest, err.Error())
 		return
@@ -311,7 +600,7 @@ func (h *Handler) VerifyCustomDomain(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.tenantService.VerifyCustomDomain(tenantID, domainUUID); err != nil {
+	if err := h.tenantService.VerifyCustomDomain(tenantID, domainUUID, auditActor(r)); err != nil {
 		common.Error(w, http.StatusBadRequest, "verification failed: "+err.Error())
 		return
 	}
@@ -331,7 +620,7 @@ func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.adminService.ChangePassword(id, input.OldPassword, input.NewPassword); err != nil {
+	if err := h.adminService.ChangePassword(id, input.OldPassword, input.NewPassword, auditActor(r)); err != nil {
 		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -346,7 +635,14 @@ func (h *Handler) ListAccessPolicies(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	common.Success(w, http.StatusOK, policies)
+	grant := middleware.GetGrant(r.Context())
+	visible := make([]models.AccessPolicy, 0, len(policies))
+	for i := range policies {
+		if grant.CanAccessPolicy(&policies[i]) {
+			visible = append(visible, policies[i])
+		}
+	}
+	common.Success(w, http.StatusOK, visible)
 }
 
 func (h *Handler) CreateAccessPolicy(w http.ResponseWriter, r *http.Request) {
@@ -397,7 +693,12 @@ func (h *Handler) CreateAccessPolicy(w http.ResponseWriter, r *http.Request) {
 		policy.Nodes = nodes
 	}
 
-	created, err := h.policyService.CreateAccessPolicy(tenantID, &policy)
+	if !middleware.GetGrant(r.Context()).CanAccessPolicy(&policy) {
+		common.Error(w, http.StatusForbidden, "policy gateways or destination are outside your scope")
+		return
+	}
+
+	created, err := h.policyService.CreateAccessPolicy(tenantID, &policy, auditActor(r))
 	if err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
@@ -452,7 +753,21 @@ func (h *Handler) UpdateAccessPolicy(w http.ResponseWriter, r *http.Request) {
 		policy.Nodes = nodes
 	}
 
-	updated, err := h.policyService.UpdateAccessPolicy(tenantID, &policy)
+	// Both the stored policy and the change must be within the scope
+	grant := middleware.GetGrant(r.Context())
+	if grant.Scoped() {
+		stored, err := h.policyService.GetAccessPolicy(tenantID, policy.ID)
+		if err != nil {
+			common.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if !grant.CanAccessPolicy(stored) || !grant.CanAccessPolicy(&policy) {
+			common.Error(w, http.StatusForbidden, "policy gateways or destination are outside your scope")
+			return
+		}
+	}
+
+	updated, err := h.policyService.UpdateAccessPolicy(tenantID, &policy, auditActor(r))
 	if err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
@@ -474,7 +789,19 @@ func (h *Handler) DeleteAccessPolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.policyService.DeleteAccessPolicy(tenantID, policyID); err != nil {
+	if grant := middleware.GetGrant(r.Context()); grant.Scoped() {
+		stored, err := h.policyService.GetAccessPolicy(tenantID, policyID)
+		if err != nil {
+			common.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if !grant.CanAccessPolicy(stored) {
+			common.Error(w, http.StatusForbidden, "policy is outside your scope")
+			return
+		}
+	}
+
+	if err := h.policyService.DeleteAccessPolicy(tenantID, policyID, auditActor(r)); err != nil {
 		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -482,6 +809,9 @@ func (h *Handler) DeleteAccessPolicy(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ListSignInPolicies(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
 	tenantID := middleware.GetTenantID(r.Context())
 	policies, err := h.policyService.ListSignInPolicies(tenantID)
 	if err != nil {
@@ -492,6 +822,9 @@ func (h *Handler) ListSignInPolicies(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) CreateSignInPolicy(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
 	tenantID := middleware.GetTenantID(r.Context())
 	var policy models.SignInPolicy
 	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
@@ -499,7 +832,7 @@ func (h *Handler) CreateSignInPolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	created, err := h.policyService.CreateSignInPolicy(tenantID, &policy)
+	created, err := h.policyService.CreateSignInPolicy(tenantID, &policy, auditActor(r))
 	if err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
@@ -508,6 +841,9 @@ func (h *Handler) CreateSignInPolicy(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) UpdateSignInPolicy(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
 	tenantID := middleware.GetTenantID(r.Context())
 	var policy models.SignInPolicy
 	if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
@@ -515,7 +851,7 @@ func (h *Handler) UpdateSignInPolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	updated, err := h.policyService.UpdateSignInPolicy(tenantID, &policy)
+	updated, err := h.policyService.UpdateSignInPolicy(tenantID, &policy, auditActor(r))
 	if err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
@@ -524,6 +860,9 @@ func (h *Handler) UpdateSignInPolicy(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) DeleteSignInPolicy(w http.ResponseWriter, r *http.Request) {
+	if !requireUnscoped(w, r) {
+		return
+	}
 	tenantID := middleware.GetTenantID(r.Context())
 	id := r.URL.Query().Get("id")
 	if id == "" {
@@ -536,7 +875,7 @@ func (h *Handler) DeleteSignInPolicy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.policyService.DeleteSignInPolicy(tenantID, policyID); err != nil {
+	if err := h.policyService.DeleteSignInPolicy(tenantID, policyID, auditActor(r)); err != nil {
 		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
@@ -550,7 +889,15 @@ func (h *Handler) ListNodes(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	common.Success(w, http.StatusOK, nodes)
+
+	grant := middleware.GetGrant(r.Context())
+	visible := nodes[:0]
+	for _, n := range nodes {
+		if grant.CanNode(n.ID) {
+			visible = append(visible, n)
+		}
+	}
+	common.Success(w, http.StatusOK, visible)
 }
 
 func (h *Handler) ListNodeSkus(w http.ResponseWriter, r *http.Request) {
@@ -575,6 +922,10 @@ func (h *Handler) ListNodeSessions(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusBadRequest, "invalid node_id")
 		return
 	}
+	if !middleware.GetGrant(r.Context()).CanNode(nodeID) {
+		common.Error(w, http.StatusForbidden, "node is outside your scope")
+		return
+	}
 
 	sessions, err := h.nodeService.ListSessions(tenantID, nodeID)
 	if err != nil {
@@ -584,6 +935,42 @@ func (h *Handler) ListNodeSessions(w http.ResponseWriter, r *http.Request) {
 	common.Success(w, http.StatusOK, sessions)
 }
 
+// RevokeSessions ends a user's VPN sessions, on every gateway or on one node.
+// Administrators scoped to some nodes must name one of them.
+func (h *Handler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		Email  string `json:"email"`
+		NodeID string `json:"node_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	grant := middleware.GetGrant(r.Context())
+	var nodeID *uuid.UUID
+	if input.NodeID != "" {
+		id, err := uuid.Parse(input.NodeID)
+		if err != nil {
+			common.Error(w, http.StatusBadRequest, "invalid node_id")
+			return
+		}
+		nodeID = &id
+	}
+	if (nodeID == nil && len(grant.NodeIDs) > 0) || (nodeID != nil && !grant.CanNode(*nodeID)) {
+		common.Error(w, http.StatusForbidden, "node is outside your scope")
+		return
+	}
+
+	revocation, err := h.sessionService.RevokeUserSessions(tenantID, input.Email, nodeID, auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, revocation)
+}
+
 func (h *Handler) CreateNode(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
 	var input struct {
@@ -595,6 +982,10 @@ func (h *Handler) CreateNode(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if len(middleware.GetGrant(r.Context()).NodeIDs) > 0 {
+		common.Error(w, http.StatusForbidden, "administrators scoped to nodes cannot create nodes")
+		return
+	}
 
 	if input.SkuID == "" {
 		common.Error(w, http.StatusBadRequest, "sku_id is required")
@@ -607,15 +998,34 @@ func (h *Handler) CreateNode(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	node, err := h.nodeService.CreateNode(tenantID, input.Name, skuUUID, input.ClientCIDR)
+	node, token, err := h.nodeService.CreateNode(tenantID, input.Name, skuUUID, input.ClientCIDR, auditActor(r))
 	if err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	common.Success(w, http.StatusCreated, node)
+	common.Success(w, http.StatusCreated, h.nodeEnrollment(node, token))
 }
 
-func (h *Handler) DeleteNode(w http.ResponseWriter, r *http.Request) {
+// nodeEnrollment is a node with the token its gateway enrolls with, which
+// is shown only once, and the fingerprint of the CA the gateway pins when
+// it first connects.
+type nodeEnrollment struct {
+	*models.Node
+	EnrollmentToken string `json:"enrollment_token"`
+	CAFingerprint   string `json:"ca_fingerprint,omitempty"`
+}
+
+func (h *Handler) nodeEnrollment(node *models.Node, token string) nodeEnrollment {
+	e := nodeEnrollment{Node: node, EnrollmentToken: token}
+	if ca := h.nodeService.CA(); ca != nil {
+		e.CAFingerprint = ca.Fingerprint()
+	}
+	return e
+}
+
+// IssueEnrollmentToken replaces the enrollment token of a node that has not
+// enrolled yet.
+func (h *Handler) IssueEnrollmentToken(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
 	var input struct {
 		ID string `json:"id"`
@@ -630,95 +1040,344 @@ func (h *Handler) DeleteNode(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusBadRequest, "invalid node id")
 		return
 	}
+	if !middleware.GetGrant(r.Context()).CanNode(nodeID) {
+		common.Error(w, http.StatusForbidden, "node is outside your scope")
+		return
+	}
 
-	if err := h.nodeService.DeleteNode(tenantID, nodeID); err != nil {
+	node, token, err := h.nodeService.IssueEnrollmentToken(tenantID, nodeID, auditActor(r))
+	if err != nil {
 		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	common.Success(w, http.StatusOK, map[string]string{"message": "node deleted"})
+	common.Success(w, http.StatusOK, h.nodeEnrollment(node, token))
 }
-func (h *Handler) SearchIdentity(w http.ResponseWriter, r *http.Request) {
+
+// scopedNodeID reads the {"id"} body of a node action and checks that the
+// node is in the administrator's scope.
+func scopedNodeID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return uuid.Nil, false
+	}
+	nodeID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid node id")
+		return uuid.Nil, false
+	}
+	if !middleware.GetGrant(r.Context()).CanNode(nodeID) {
+		common.Error(w, http.StatusForbidden, "node is outside your scope")
+		return uuid.Nil, false
+	}
+	return nodeID, true
+}
+
+// ResetEnrollment revokes a node's certificate and hardware binding and
+// returns a new enrollment token, for a rebuilt or replaced gateway.
+func (h *Handler) ResetEnrollment(w http.ResponseWriter, r *http.Request) {
+	nodeID, ok := scopedNodeID(w, r)
+	if !ok {
+		return
+	}
 	tenantID := middleware.GetTenantID(r.Context())
-	query := r.URL.Query().Get("q")
-	if query == "" {
-		common.Error(w, http.StatusBadRequest, "missing query parameter q")
+	node, token, err := h.nodeService.ResetEnrollment(tenantID, nodeID, auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	common.Success(w, http.StatusOK, h.nodeEnrollment(node, token))
+}
 
-	tenant, err := h.tenantService.GetTenantByID(tenantID)
+// ListHardwareChanges returns the nodes whose gateway connected from changed
+// hardware and waits for approval.
+func (h *Handler) ListHardwareChanges(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	nodes, err := h.nodeService.ListHardwareChanges(tenantID)
 	if err != nil {
-		common.Error(w, http.StatusNotFound, "tenant not found")
+		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	if tenant.GoogleServiceAccountKey == "" || tenant.GoogleAdminEmail == "" {
-		common.Error(w, http.StatusBadRequest, "google identity not configured for this tenant")
+	grant := middleware.GetGrant(r.Context())
+	visible := nodes[:0]
+	for _, n := range nodes {
+		if grant.CanNode(n.ID) {
+			visible = append(visible, n)
+		}
+	}
+	common.Success(w, http.StatusOK, visible)
+}
+
+func (h *Handler) ApproveHardwareChange(w http.ResponseWriter, r *http.Request) {
+	nodeID, ok := scopedNodeID(w, r)
+	if !ok {
+		return
+	}
+	tenantID := middleware.GetTenantID(r.Context())
+	node, err := h.nodeService.ApproveHardwareChange(tenantID, nodeID, auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, node)
+}
+
+// RejectHardwareChange refuses the new hardware and revokes the node's
+// certificate; the node must be enrolled again.
+func (h *Handler) RejectHardwareChange(w http.ResponseWriter, r *http.Request) {
+	nodeID, ok := scopedNodeID(w, r)
+	if !ok {
 		return
 	}
+	tenantID := middleware.GetTenantID(r.Context())
+	node, err := h.nodeService.RejectHardwareChange(tenantID, nodeID, auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, node)
+}
 
-	// If it doesn't look like JSON, try to decrypt it
-	if !strings.HasPrefix(strings.TrimSpace(tenant.GoogleServiceAccountKey), "{") {
-		if err := h.tenantService.DecryptTenantConfig(tenant); err != nil {
-			log.Printf("failed to decrypt identity configuration for tenant %s: %v", tenantID, err)
-			common.Error(w, http.StatusInternalServerError, "failed to decrypt identity configuration. please re-configure google identity.")
-			return
+func (h *Handler) DeleteNode(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	nodeID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid node id")
+		return
+	}
+	if !middleware.GetGrant(r.Context()).CanNode(nodeID) {
+		common.Error(w, http.StatusForbidden, "node is outside your scope")
+		return
+	}
+
+	if err := h.nodeService.DeleteNode(tenantID, nodeID, auditActor(r)); err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]string{"message": "node deleted"})
+}
+
+// Gateway Groups
+
+// ListGatewayGroups returns the tenant's gateway groups with the members the
+// administrator can see.
+func (h *Handler) ListGatewayGroups(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	groups, err := h.gatewayGroupService.ListGroups(tenantID)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	grant := middleware.GetGrant(r.Context())
+	for i := range groups {
+		visible := groups[i].Nodes[:0]
+		for _, n := range groups[i].Nodes {
+			if grant.CanNode(n.ID) {
+				visible = append(visible, n)
+			}
 		}
+		groups[i].Nodes = visible
+	}
+	common.Success(w, http.StatusOK, groups)
+}
+
+type gatewayGroupInput struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ClientCIDR  string `json:"client_cidr"`
+}
+
+func (in gatewayGroupInput) toModel() *models.GatewayGroup {
+	return &models.GatewayGroup{Name: in.Name, Description: in.Description, ClientCIDR: in.ClientCIDR}
+}
+
+// decodeGatewayGroup reads a group body. Groups span nodes, so
+// administrators scoped to nodes cannot change them.
+func decodeGatewayGroup(w http.ResponseWriter, r *http.Request) (gatewayGroupInput, bool) {
+	var input gatewayGroupInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return input, false
+	}
+	if len(middleware.GetGrant(r.Context()).NodeIDs) > 0 {
+		common.Error(w, http.StatusForbidden, "administrators scoped to nodes cannot manage gateway groups")
+		return input, false
 	}
+	return input, true
+}
 
-	// Double check it's JSON now
-	if !strings.HasPrefix(strings.TrimSpace(tenant.GoogleServiceAccountKey), "{") {
-		log.Printf("identity configuration for tenant %s is not a valid JSON after decryption", tenantID)
-		common.Error(w, http.StatusBadRequest, "invalid identity configuration format. please re-upload your service account key.")
+func (h *Handler) CreateGatewayGroup(w http.ResponseWriter, r *http.Request) {
+	input, ok := decodeGatewayGroup(w, r)
+	if !ok {
+		return
+	}
+	tenantID := middleware.GetTenantID(r.Context())
+	group, err := h.gatewayGroupService.CreateGroup(tenantID, input.toModel(), auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
+	common.Success(w, http.StatusCreated, group)
+}
 
-	// Search Users - handle errors gracefully
-	users, err := h.identityService.SearchGoogleUsers(r.Context(), []byte(tenant.GoogleServiceAccountKey), tenant.GoogleAdminEmail, query)
+func (h *Handler) UpdateGatewayGroup(w http.ResponseWriter, r *http.Request) {
+	input, ok := decodeGatewayGroup(w, r)
+	if !ok {
+		return
+	}
+	groupID, err := uuid.Parse(input.ID)
 	if err != nil {
-		log.Printf("failed to search users for tenant %s: %v", tenantID, err)
-		users = []models.ExternalIdentity{} // Return empty slice instead of nil
+		common.Error(w, http.StatusBadRequest, "invalid gateway group id")
+		return
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	group := input.toModel()
+	group.ID = groupID
+	if err := h.gatewayGroupService.UpdateGroup(tenantID, group, auditActor(r)); err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
 	}
+	common.Success(w, http.StatusOK, group)
+}
 
-	// Search Groups - handle errors gracefully
-	groups, err := h.identityService.SearchGoogleGroups(r.Context(), []byte(tenant.GoogleServiceAccountKey), tenant.GoogleAdminEmail, query)
+func (h *Handler) DeleteGatewayGroup(w http.ResponseWriter, r *http.Request) {
+	input, ok := decodeGatewayGroup(w, r)
+	if !ok {
+		return
+	}
+	groupID, err := uuid.Parse(input.ID)
 	if err != nil {
-		log.Printf("failed to search groups for tenant %s: %v", tenantID, err)
-		groups = []string{} // Return empty slice instead of nil
+		common.Error(w, http.StatusBadRequest, "invalid gateway group id")
+		return
 	}
 
-	var results = []struct {
-		Type  string `json:"type"`
-		Value string `json:"value"`
-		Label string `json:"label"`
-	}{}
+	tenantID := middleware.GetTenantID(r.Context())
+	if err := h.gatewayGroupService.DeleteGroup(tenantID, groupID, auditActor(r)); err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, map[string]string{"message": "gateway group deleted"})
+}
 
-	for _, u := range users {
-		results = append(results, struct {
-			Type  string `json:"type"`
-			Value string `json:"value"`
-			Label string `json:"label"`
-		}{
-			Type:  "user",
-			Value: u.Email,
-			Label: fmt.Sprintf("%s (%s)", u.Name, u.Email),
-		})
+// SetNodeGroup moves a node into a gateway group, or out of its group when
+// gateway_group_id is empty.
+func (h *Handler) SetNodeGroup(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ID             string `json:"id"`
+		GatewayGroupID string `json:"gateway_group_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	nodeID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid node id")
+		return
+	}
+	if !middleware.GetGrant(r.Context()).CanNode(nodeID) {
+		common.Error(w, http.StatusForbidden, "node is outside your scope")
+		return
 	}
 
-	for _, g := range groups {
-		results = append(results, struct {
-			Type  string `json:"type"`
-			Value string `json:"value"`
-			Label string `json:"label"`
-		}{
-			Type:  "group",
-			Value: g,
-			Label: g,
-		})
+	var groupID *uuid.UUID
+	if input.GatewayGroupID != "" {
+		id, err := uuid.Parse(input.GatewayGroupID)
+		if err != nil {
+			common.Error(w, http.StatusBadRequest, "invalid gateway group id")
+			return
+		}
+		groupID = &id
+	}
+
+	tenantID := middleware.GetTenantID(r.Context())
+	node, err := h.gatewayGroupService.SetNodeGroup(tenantID, nodeID, groupID, auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, node)
+}
+
+// SetNodeEgress changes how a node's client traffic leaves for the networks
+// it reaches.
+func (h *Handler) SetNodeEgress(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		ID         string            `json:"id"`
+		EgressMode string            `json:"egress_mode"`
+		SNATPools  []models.SNATPool `json:"snat_pools"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	nodeID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid node id")
+		return
+	}
+	if !middleware.GetGrant(r.Context()).CanNode(nodeID) {
+		common.Error(w, http.StatusForbidden, "node is outside your scope")
+		return
 	}
 
-	// Always return success with results (even if empty)
-	// This prevents white screen errors on the frontend
+	tenantID := middleware.GetTenantID(r.Context())
+	node, err := h.nodeService.SetNodeEgress(tenantID, nodeID, input.EgressMode, input.SNATPools, auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, node)
+}
 
+// identityResult is one suggestion of the policy editor's identity search.
+type identityResult struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	Label string `json:"label"`
+}
+
+func (h *Handler) SearchIdentity(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	query := r.URL.Query().Get("q")
+	if query == "" {
+		common.Error(w, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+
+	// Suggestions come from the directory, provisioned over SCIM or synced
+	// from Google Workspace, never from a live IdP call
+	users, groups, err := h.directoryService.Search(tenantID, query, 20)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	results := []identityResult{}
+	for _, u := range users {
+		results = append(results, identityResult{Type: "user", Value: u.Email, Label: fmt.Sprintf("%s (%s)", u.DisplayName, u.Email)})
+	}
+	for _, g := range groups {
+		label := g.DisplayName
+		if g.Email != "" {
+			label = fmt.Sprintf("%s (%s)", g.DisplayName, g.Email)
+		}
+		results = append(results, identityResult{Type: "group", Value: g.PolicyName(), Label: label})
+	}
 	common.Success(w, http.StatusOK, results)
 }
 
@@ -731,11 +1390,15 @@ func (h *Handler) ListApplications(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	grant := middleware.GetGrant(r.Context())
 	// Ensure we always return an array, never null
-	if apps == nil {
-		apps = []models.Application{}
+	visible := []models.Application{}
+	for _, app := range apps {
+		if grant.CanApplication(app.ID) {
+			visible = append(visible, app)
+		}
 	}
-	common.Success(w, http.StatusOK, apps)
+	common.Success(w, http.StatusOK, visible)
 }
 
 func (h *Handler) GetApplication(w http.ResponseWriter, r *http.Request) {
@@ -746,34 +1409,59 @@ func (h *Handler) GetApplication(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusBadRequest, "invalid application id")
 		return
 	}
+	if !middleware.GetGrant(r.Context()).CanApplication(appID) {
+		common.Error(w, http.StatusForbidden, "application is outside your scope")
+		return
+	}
 
-	app, cidrs, err := h.applicationService.GetApplicationWithCIDRs(tenantID, appID)
+	app, err := h.applicationService.GetApplication(tenantID, appID)
 	if err != nil {
 		common.Error(w, http.StatusNotFound, "application not found")
 		return
 	}
 
-	common.Success(w, http.StatusOK, map[string]interface{}{
-		"application": app,
-		"cidrs":       cidrs,
-	})
+	common.Success(w, http.StatusOK, app)
+}
+
+// applicationInput is the request body for creating and updating applications.
+type applicationInput struct {
+	ID           string                          `json:"id"`
+	Name         string                          `json:"name"`
+	Description  string                          `json:"description"`
+	Owner        string                          `json:"owner"`
+	Tags         []string                        `json:"tags"`
+	Ports        []string                        `json:"ports"` // "tcp/443", "udp/53", "8000-8100"
+	HealthCheck  string                          `json:"health_check"`
+	Destinations []models.ApplicationDestination `json:"destinations"`
+}
+
+func (in *applicationInput) toModel() *models.Application {
+	return &models.Application{
+		Name:         in.Name,
+		Description:  in.Description,
+		Owner:        in.Owner,
+		Tags:         strings.Join(in.Tags, ","),
+		Ports:        strings.Join(in.Ports, ","),
+		HealthCheck:  in.HealthCheck,
+		Destinations: in.Destinations,
+	}
 }
 
 func (h *Handler) CreateApplication(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
-	var input struct {
-		Name        string   `json:"name"`
-		Description string   `json:"description"`
-		CIDRs       []string `json:"cidrs"`
-	}
+	var input applicationInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		common.Error(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
+	if len(middleware.GetGrant(r.Context()).ApplicationIDs) > 0 {
+		common.Error(w, http.StatusForbidden, "administrators scoped to applications cannot create applications")
+		return
+	}
 
-	app, err := h.applicationService.CreateApplication(tenantID, input.Name, input.Description, input.CIDRs)
+	app, err := h.applicationService.CreateApplication(tenantID, input.toModel(), auditActor(r))
 	if err != nil {
-		common.Error(w, http.StatusInternalServerError, err.Error())
+		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -782,12 +1470,7 @@ func (h *Handler) CreateApplication(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) UpdateApplication(w http.ResponseWriter, r *http.Request) {
 	tenantID := middleware.GetTenantID(r.Context())
-	var input struct {
-		ID          string   `json:"id"`
-		Name        string   `json:"name"`
-		Description string   `json:"description"`
-		CIDRs       []string `json:"cidrs"`
-	}
+	var input applicationInput
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
 		common.Error(w, http.StatusBadRequest, "invalid request body")
 		return
@@ -798,9 +1481,15 @@ func (h *Handler) UpdateApplication(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusBadRequest, "invalid application id")
 		return
 	}
+	if !middleware.GetGrant(r.Context()).CanApplication(appID) {
+		common.Error(w, http.StatusForbidden, "application is outside your scope")
+		return
+	}
 
-	if err := h.applicationService.UpdateApplication(tenantID, appID, input.Name, input.Description, input.CIDRs); err != nil {
-		common.Error(w, http.StatusInternalServerError, err.Error())
+	app := input.toModel()
+	app.ID = appID
+	if err := h.applicationService.UpdateApplication(tenantID, app, auditActor(r)); err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
@@ -822,11 +1511,289 @@ func (h *Handler) DeleteApplication(w http.ResponseWriter, r *http.Request) {
 		common.Error(w, http.StatusBadRequest, "invalid application id")
 		return
 	}
+	if !middleware.GetGrant(r.Context()).CanApplication(appID) {
+		common.Error(w, http.StatusForbidden, "application is outside your scope")
+		return
+	}
 
-	if err := h.applicationService.DeleteApplication(tenantID, appID); err != nil {
+	if err := h.applicationService.DeleteApplication(tenantID, appID, auditActor(r)); err != nil {
 		common.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	common.Success(w, http.StatusOK, map[string]string{"message": "application deleted"})
 }
+
+func (h *Handler) ListDevices(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	devices, err := h.deviceService.ListDevices(tenantID)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	common.Success(w, http.StatusOK, devices)
+}
+
+// UpdateDeviceStatus approves or blocks a device.
+func (h *Handler) UpdateDeviceStatus(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		ID     string              `json:"id"`
+		Status models.DeviceStatus `json:"status"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	deviceID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid device id")
+		return
+	}
+
+	if err := h.deviceService.SetStatus(tenantID, deviceID, input.Status, auditActor(r)); err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusOK, map[string]string{"message": "device updated"})
+}
+
+func (h *Handler) DeleteDevice(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	deviceID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid device id")
+		return
+	}
+
+	if err := h.deviceService.DeleteDevice(tenantID, deviceID, auditActor(r)); err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusOK, map[string]string{"message": "device deleted"})
+}
+
+// identityProviderInput is the request body for creating and updating identity providers.
+type identityProviderInput struct {
+	ID           string                      `json:"id"`
+	Name         string                      `json:"name"`
+	Type         models.IdentityProviderType `json:"type"`
+	Enabled      bool                        `json:"enabled"`
+	IsDefault    bool                        `json:"is_default"`
+	IssuerURL    string                      `json:"issuer_url"`
+	ClientID     string                      `json:"client_id"`
+	ClientSecret string                      `json:"client_secret"` // Empty on update keeps the stored secret
+	Scopes       string                      `json:"scopes"`
+	SSOURL       string                      `json:"sso_url"`
+	EntityID     string                      `json:"entity_id"`
+	Certificate  string                      `json:"certificate"`
+	EmailClaim   string                      `json:"email_claim"`
+	GroupsClaim  string                      `json:"groups_claim"`
+}
+
+func (in *identityProviderInput) toModel() *models.IdentityProvider {
+	return &models.IdentityProvider{
+		Name:         in.Name,
+		Type:         in.Type,
+		Enabled:      in.Enabled,
+		IsDefault:    in.IsDefault,
+		IssuerURL:    in.IssuerURL,
+		ClientID:     in.ClientID,
+		ClientSecret: in.ClientSecret,
+		Scopes:       in.Scopes,
+		SSOURL:       in.SSOURL,
+		EntityID:     in.EntityID,
+		Certificate:  in.Certificate,
+		EmailClaim:   in.EmailClaim,
+		GroupsClaim:  in.GroupsClaim,
+	}
+}
+
+func (h *Handler) ListIdentityProviders(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	providers, err := h.identityProviderService.ListProviders(tenantID)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if providers == nil {
+		providers = []models.IdentityProvider{}
+	}
+	common.Success(w, http.StatusOK, providers)
+}
+
+func (h *Handler) CreateIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input identityProviderInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	provider, err := h.identityProviderService.CreateProvider(tenantID, input.toModel(), auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusCreated, provider)
+}
+
+func (h *Handler) UpdateIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input identityProviderInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	providerID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid identity provider id")
+		return
+	}
+
+	provider := input.toModel()
+	provider.ID = providerID
+	if err := h.identityProviderService.UpdateProvider(tenantID, provider, auditActor(r)); err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusOK, map[string]string{"message": "identity provider updated"})
+}
+
+func (h *Handler) DeleteIdentityProvider(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	providerID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid identity provider id")
+		return
+	}
+
+	if err := h.identityProviderService.DeleteProvider(tenantID, providerID, auditActor(r)); err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusOK, map[string]string{"message": "identity provider deleted"})
+}
+
+// Directory Sync
+
+// GetDirectorySync returns the tenant's last Google Workspace sync.
+func (h *Handler) GetDirectorySync(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	status, err := h.directorySyncService.GetStatus(tenantID)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if status == nil {
+		common.Success(w, http.StatusOK, map[string]string{"status": "never"})
+		return
+	}
+	common.Success(w, http.StatusOK, status)
+}
+
+// SyncDirectory starts a sync now instead of waiting for the next interval.
+func (h *Handler) SyncDirectory(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	tenant, err := h.tenantService.GetTenantByID(tenantID)
+	if err != nil {
+		common.Error(w, http.StatusNotFound, "tenant not found")
+		return
+	}
+	if tenant.GoogleServiceAccountKey == "" || tenant.GoogleAdminEmail == "" {
+		common.Error(w, http.StatusBadRequest, "google identity not configured for this tenant")
+		return
+	}
+
+	go func() {
+		if err := h.directorySyncService.SyncTenant(context.Background(), tenantID); err != nil {
+			log.Printf("directory sync failed for tenant %s: %v", tenantID, err)
+		}
+	}()
+	common.Success(w, http.StatusAccepted, map[string]string{"message": "directory sync started"})
+}
+
+// SCIM Provisioning Tokens
+
+func (h *Handler) ListSCIMTokens(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	tokens, err := h.directoryService.ListSCIMTokens(tenantID)
+	if err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if tokens == nil {
+		tokens = []models.SCIMToken{}
+	}
+	common.Success(w, http.StatusOK, tokens)
+}
+
+// CreateSCIMToken returns the new token once; only its hash is kept.
+func (h *Handler) CreateSCIMToken(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	token, secret, err := h.directoryService.CreateSCIMToken(tenantID, input.Name, auditActor(r))
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusCreated, map[string]interface{}{
+		"token":  token,
+		"secret": secret,
+	})
+}
+
+func (h *Handler) DeleteSCIMToken(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+	var input struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	tokenID, err := uuid.Parse(input.ID)
+	if err != nil {
+		common.Error(w, http.StatusBadRequest, "invalid token id")
+		return
+	}
+
+	if err := h.directoryService.DeleteSCIMToken(tenantID, tokenID, auditActor(r)); err != nil {
+		common.Error(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	common.Success(w, http.StatusOK, map[string]string{"message": "token revoked"})
+}
@@ -0,0 +1,60 @@
+package mgmt
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"tridorian-ztna/internal/api/middleware"
+	"tridorian-ztna/internal/models"
+
+	"github.com/google/uuid"
+)
+
+func TestSignInPoliciesRequireUnscoped(t *testing.T) {
+	h := &Handler{}
+	handlers := []struct {
+		name    string
+		method  string
+		handler http.HandlerFunc
+	}{
+		{"list", "GET", h.ListSignInPolicies},
+		{"create", "POST", h.CreateSignInPolicy},
+		{"update", "PUT", h.UpdateSignInPolicy},
+		{"delete", "DELETE", h.DeleteSignInPolicy},
+	}
+	grants := []struct {
+		name  string
+		grant *models.AccessGrant
+	}{
+		{"node scope", &models.AccessGrant{Role: models.RoleCustom, Permissions: []models.Permission{models.PermPoliciesWrite}, NodeIDs: []uuid.UUID{uuid.New()}}},
+		{"application scope", &models.AccessGrant{Role: models.RoleCustom, Permissions: []models.Permission{models.PermPoliciesWrite}, ApplicationIDs: []uuid.UUID{uuid.New()}}},
+	}
+	for _, hh := range handlers {
+		for _, g := range grants {
+			t.Run(hh.name+" with "+g.name, func(t *testing.T) {
+				r := httptest.NewRequest(hh.method, "/api/v1/policies/sign-in?id="+uuid.NewString(), strings.NewReader(`{"name":"everyone"}`))
+				r = r.WithContext(context.WithValue(r.Context(), middleware.GrantKey, g.grant))
+				w := httptest.NewRecorder()
+				hh.handler(w, r)
+				if w.Code != http.StatusForbidden {
+					t.Fatalf("status = %d, want %d", w.Code, http.StatusForbidden)
+				}
+			})
+		}
+	}
+}
+
+func TestRequireUnscoped(t *testing.T) {
+	for _, grant := range []*models.AccessGrant{nil, {Role: models.RoleCustom, Permissions: []models.Permission{models.PermPoliciesWrite}}} {
+		r := httptest.NewRequest("GET", "/api/v1/policies/sign-in", nil)
+		if grant != nil {
+			r = r.WithContext(context.WithValue(r.Context(), middleware.GrantKey, grant))
+		}
+		w := httptest.NewRecorder()
+		if !requireUnscoped(w, r) || w.Code != http.StatusOK {
+			t.Fatalf("requireUnscoped refused grant %+v with status %d", grant, w.Code)
+		}
+	}
+}
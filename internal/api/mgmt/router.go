@@ -12,9 +12,21 @@ import (
 	"gorm.io/gorm"
 )
 
+// route is one tenant management endpoint and the permission it requires.
+// Methods is space separated; an empty permission admits any signed-in
+// administrator.
+type route struct {
+	Methods    string
+	Path       string
+	Permission models.Permission
+	Handler    http.HandlerFunc
+}
+
 type Router struct {
 	handler   *Handler
 	publicKey interface{}
+	routes    []route
+	auth      func(http.Handler) http.Handler
 }
 
 func NewRouter(db *gorm.DB, cache *redis.Client, privateKey, publicKey interface{}) *Router {
@@ -22,13 +34,141 @@ func NewRouter(db *gorm.DB, cache *redis.Client, privateKey, publicKey interface
 	tenantService := services.NewTenantService(db)
 	policyService := services.NewPolicyService(db, cache)
 	nodeService := services.NewNodeService(db, cache)
-	identityService := services.NewIdentityService()
-	applicationService := services.NewApplicationService(db)
-
-	return &Router{
-		handler:   NewHandler(adminService, tenantService, policyService, nodeService, identityService, applicationService),
+	applicationService := services.NewApplicationService(db, cache)
+	deviceService := services.NewDeviceService(db, cache)
+	identityProviderService := services.NewIdentityProviderService(db, cache)
+	directoryService := services.NewDirectoryService(db, cache)
+	directorySyncService := services.NewDirectorySyncService(db, cache)
+	mfaService := services.NewMFAService(db, cache)
+	loginGuardService := services.NewLoginGuardService(db, cache)
+	adminSSOService := services.NewAdminSSOService(db, cache)
+	roleService := services.NewRoleService(db)
+	sessionService := services.NewSessionService(db, cache)
+	auditService := services.NewAuditService(db)
+	configService := services.NewConfigService(db, cache)
+	gatewayGroupService := services.NewGatewayGroupService(db, cache)
+
+	r := &Router{
+		handler:   NewHandler(adminService, tenantService, policyService, nodeService, applicationService, deviceService, identityProviderService, directoryService, directorySyncService, mfaService, loginGuardService, adminSSOService, roleService, sessionService, auditService, configService, gatewayGroupService),
 		publicKey: publicKey,
 	}
+	r.routes = r.tenantRoutes()
+
+	// Tenant management routes require a PurposeManagement token, which
+	// carries the TenantID, and the administrator's current permissions
+	jwtAuth := middleware.JWTAuth(publicKey, utils.PurposeManagement)
+	loadGrant := middleware.LoadGrant(adminService)
+	r.auth = func(next http.Handler) http.Handler {
+		return jwtAuth(loadGrant(next))
+	}
+	return r
+}
+
+// tenantRoutes is the tenant management API. Every endpoint is listed here
+// with the permission it needs; handlers only add node and application
+// scope checks.
+func (r *Router) tenantRoutes() []route {
+	h := r.handler
+	return []route{
+		{"POST", "/api/v1/tenants/activate", models.PermTenantWrite, h.ActivateDomain},
+		{"POST", "/api/v1/tenants/identity", models.PermIdPWrite, h.UpdateIdentity},
+		{"GET", "/api/v1/tenant/me", "", h.GetMyTenant},
+		{"PATCH PUT", "/api/v1/tenant/me", models.PermTenantWrite, h.UpdateTenant},
+		{"PATCH PUT", "/api/v1/tenant/dns", models.PermTenantWrite, h.UpdateDNSSettings},
+		{"PATCH PUT", "/api/v1/tenant/security", models.PermSecurityWrite, h.UpdateSecuritySettings},
+		{"GET", "/api/v1/security/login-attempts", models.PermSecurityRead, h.ListLoginAttempts},
+		{"GET", "/api/v1/admin-sso", models.PermIdPRead, h.GetAdminSSO},
+		{"PUT", "/api/v1/admin-sso", models.PermIdPWrite, h.UpdateAdminSSO},
+
+		// Custom Domain Management
+		{"GET", "/api/v1/tenants/domains", models.PermTenantRead, h.ListDomains},
+		{"POST", "/api/v1/tenants/domains", models.PermTenantWrite, h.RegisterCustomDomain},
+		{"POST", "/api/v1/tenants/domains/verify", models.PermTenantWrite, h.VerifyCustomDomain},
+
+		// The signed-in administrator
+		{"POST", "/api/v1/profile/change-password", "", h.ChangePassword},
+		{"GET", "/api/v1/profile/permissions", "", h.GetMyPermissions},
+
+		// Administrators and roles
+		{"GET", "/api/v1/admins", models.PermAdminsRead, h.ListAdmins},
+		{"POST", "/api/v1/admins", models.PermAdminsWrite, h.CreateAdmin},
+		{"PATCH PUT", "/api/v1/admins", models.PermAdminsWrite, h.UpdateAdmin},
+		{"DELETE", "/api/v1/admins", models.PermAdminsWrite, h.DeleteAdmin},
+		{"POST", "/api/v1/admins/mfa/reset", models.PermAdminsWrite, h.ResetAdminMFA},
+		{"GET", "/api/v1/roles", models.PermAdminsRead, h.ListRoles},
+		{"POST", "/api/v1/roles", models.PermAdminsWrite, h.CreateRole},
+		{"PATCH PUT", "/api/v1/roles", models.PermAdminsWrite, h.UpdateRole},
+		{"DELETE", "/api/v1/roles", models.PermAdminsWrite, h.DeleteRole},
+
+		// Policy Management
+		{"GET", "/api/v1/policies/access", models.PermPoliciesRead, h.ListAccessPolicies},
+		{"POST", "/api/v1/policies/access", models.PermPoliciesWrite, h.CreateAccessPolicy},
+		{"PATCH PUT", "/api/v1/policies/access", models.PermPoliciesWrite, h.UpdateAccessPolicy},
+		{"DELETE", "/api/v1/policies/access", models.PermPoliciesWrite, h.DeleteAccessPolicy},
+		{"GET", "/api/v1/policies/sign-in", models.PermPoliciesRead, h.ListSignInPolicies},
+		{"POST", "/api/v1/policies/sign-in", models.PermPoliciesWrite, h.CreateSignInPolicy},
+		{"PATCH PUT", "/api/v1/policies/sign-in", models.PermPoliciesWrite, h.UpdateSignInPolicy},
+		{"DELETE", "/api/v1/policies/sign-in", models.PermPoliciesWrite, h.DeleteSignInPolicy},
+
+		// Application Management
+		{"GET", "/api/v1/applications", models.PermApplicationsRead, func(w http.ResponseWriter, req *http.Request) {
+			if req.URL.Query().Has("id") {
+				h.GetApplication(w, req)
+			} else {
+				h.ListApplications(w, req)
+			}
+		}},
+		{"POST", "/api/v1/applications", models.PermApplicationsWrite, h.CreateApplication},
+		{"PATCH PUT", "/api/v1/applications", models.PermApplicationsWrite, h.UpdateApplication},
+		{"DELETE", "/api/v1/applications", models.PermApplicationsWrite, h.DeleteApplication},
+
+		// Node Management
+		{"GET", "/api/v1/nodes/skus", models.PermNodesRead, h.ListNodeSkus},
+		{"GET", "/api/v1/nodes", models.PermNodesRead, h.ListNodes},
+		{"POST", "/api/v1/nodes", models.PermNodesWrite, h.CreateNode},
+		{"DELETE", "/api/v1/nodes", models.PermNodesWrite, h.DeleteNode},
+		{"POST", "/api/v1/nodes/enrollment-token", models.PermNodesWrite, h.IssueEnrollmentToken},
+		{"POST", "/api/v1/nodes/reset-enrollment", models.PermNodesWrite, h.ResetEnrollment},
+		{"GET", "/api/v1/nodes/hardware-changes", models.PermNodesRead, h.ListHardwareChanges},
+		{"POST", "/api/v1/nodes/hardware-changes/approve", models.PermNodesWrite, h.ApproveHardwareChange},
+		{"POST", "/api/v1/nodes/hardware-changes/reject", models.PermNodesWrite, h.RejectHardwareChange},
+		{"POST", "/api/v1/nodes/group", models.PermNodesWrite, h.SetNodeGroup},
+		{"POST", "/api/v1/nodes/egress", models.PermNodesWrite, h.SetNodeEgress},
+		{"GET", "/api/v1/nodes/sessions", models.PermSessionsRead, h.ListNodeSessions},
+		{"POST", "/api/v1/sessions/revoke", models.PermSessionsRevoke, h.RevokeSessions},
+
+		// Gateway Groups
+		{"GET", "/api/v1/gateway-groups", models.PermNodesRead, h.ListGatewayGroups},
+		{"POST", "/api/v1/gateway-groups", models.PermNodesWrite, h.CreateGatewayGroup},
+		{"PATCH PUT", "/api/v1/gateway-groups", models.PermNodesWrite, h.UpdateGatewayGroup},
+		{"DELETE", "/api/v1/gateway-groups", models.PermNodesWrite, h.DeleteGatewayGroup},
+
+		// Identity Management
+		{"GET", "/api/v1/identity/search", models.PermIdentityRead, h.SearchIdentity},
+		{"GET", "/api/v1/directory/sync", models.PermIdentityRead, h.GetDirectorySync},
+		{"POST", "/api/v1/directory/sync", models.PermIdentityWrite, h.SyncDirectory},
+		{"GET", "/api/v1/identity-providers", models.PermIdPRead, h.ListIdentityProviders},
+		{"POST", "/api/v1/identity-providers", models.PermIdPWrite, h.CreateIdentityProvider},
+		{"PATCH PUT", "/api/v1/identity-providers", models.PermIdPWrite, h.UpdateIdentityProvider},
+		{"DELETE", "/api/v1/identity-providers", models.PermIdPWrite, h.DeleteIdentityProvider},
+		{"GET", "/api/v1/scim/tokens", models.PermIdPRead, h.ListSCIMTokens},
+		{"POST", "/api/v1/scim/tokens", models.PermIdPWrite, h.CreateSCIMToken},
+		{"DELETE", "/api/v1/scim/tokens", models.PermIdPWrite, h.DeleteSCIMToken},
+
+		// Device Inventory
+		{"GET", "/api/v1/devices", models.PermDevicesRead, h.ListDevices},
+		{"PATCH PUT", "/api/v1/devices", models.PermDevicesWrite, h.UpdateDeviceStatus},
+		{"DELETE", "/api/v1/devices", models.PermDevicesWrite, h.DeleteDevice},
+
+		// Audit Log
+		{"GET", "/api/v1/audit-logs", models.PermAuditRead, h.ListAuditLogs},
+		{"GET", "/api/v1/audit-logs/verify", models.PermAuditRead, h.VerifyAuditLog},
+
+		// Configuration as code
+		{"GET", "/api/v1/config", models.PermConfigRead, h.ExportConfig},
+		{"POST", "/api/v1/config/import", models.PermConfigWrite, h.ImportConfig},
+		{"GET", "/api/v1/config/drift", models.PermConfigRead, h.GetConfigDrift},
+	}
 }
 
 func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -58,177 +198,22 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// 2. Tenant Management Routes (Tenant Admin)
-	// These routes require PurposeManagement token which contains the TenantID
-	tenantRoutes := []string{
-		"/api/v1/tenants/activate",
-		"/api/v1/tenants/identity",
-		"/api/v1/admins",
-		"/api/v1/tenant/me",
-		"/api/v1/tenants/domains", // Includes /verify
-		"/api/v1/profile/change-password",
-		"/api/v1/policies/access",
-		"/api/v1/policies/sign-in",
-		"/api/v1/applications",
-		"/api/v1/nodes",
-		"/api/v1/nodes/skus",
-		"/api/v1/identity/search",
-	}
-
-	isTenantRoute := false
-	for _, route := range tenantRoutes {
-		if strings.HasPrefix(path, route) {
-			isTenantRoute = true
-			break
+	knownPath := false
+	for _, rt := range r.routes {
+		if rt.Path != path {
+			continue
+		}
+		knownPath = true
+		if !strings.Contains(" "+rt.Methods+" ", " "+req.Method+" ") {
+			continue
 		}
+		r.auth(middleware.RequirePermission(rt.Permission)(rt.Handler)).ServeHTTP(w, req)
+		return
 	}
 
-	if isTenantRoute {
-		middleware.JWTAuth(r.publicKey, utils.PurposeManagement)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			switch {
-			case path == "/api/v1/tenants/activate" && req.Method == "POST":
-				middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					r.handler.ActivateDomain(w, req)
-				})).ServeHTTP(w, req)
-
-			case path == "/api/v1/tenants/identity" && req.Method == "POST":
-				middleware.RequireRole(models.RoleSuperAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					r.handler.UpdateIdentity(w, req)
-				})).ServeHTTP(w, req)
-
-			case path == "/api/v1/tenant/me" && req.Method == "GET":
-				r.handler.GetMyTenant(w, req)
-
-			case path == "/api/v1/tenant/me" && (req.Method == "PATCH" || req.Method == "PUT"):
-				middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					r.handler.UpdateTenant(w, req)
-				})).ServeHTTP(w, req)
-
-			// Custom Domain Management
-			case path == "/api/v1/tenants/domains":
-				switch req.Method {
-				case "GET":
-					r.handler.ListDomains(w, req)
-				case "POST":
-					middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-						r.handler.RegisterCustomDomain(w, req)
-					})).ServeHTTP(w, req)
-				}
-
-			case path == "/api/v1/tenants/domains/verify" && req.Method == "POST":
-				middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					r.handler.VerifyCustomDomain(w, req)
-				})).ServeHTTP(w, req)
-
-			case path == "/api/v1/profile/change-password" && req.Method == "POST":
-				r.handler.ChangePassword(w, req)
-
-			case strings.HasPrefix(path, "/api/v1/admins"):
-				middleware.RequireRole(models.RoleSuperAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					switch req.Method {
-					case "GET":
-						r.handler.ListAdmins(w, req)
-					case "POST":
-						r.handler.CreateAdmin(w, req)
-					case "PATCH", "PUT":
-						r.handler.UpdateAdmin(w, req)
-					case "DELETE":
-						r.handler.DeleteAdmin(w, req)
-					default:
-						w.WriteHeader(http.StatusMethodNotAllowed)
-					}
-				})).ServeHTTP(w, req)
-
-			// Policy Management
-			case path == "/api/v1/policies/access":
-				middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin, models.RolePolicyAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					switch req.Method {
-					case "GET":
-						r.handler.ListAccessPolicies(w, req)
-					case "POST":
-						r.handler.CreateAccessPolicy(w, req)
-					case "PATCH", "PUT":
-						r.handler.UpdateAccessPolicy(w, req)
-					case "DELETE":
-						r.handler.DeleteAccessPolicy(w, req)
-					default:
-						w.WriteHeader(http.StatusMethodNotAllowed)
-					}
-				})).ServeHTTP(w, req)
-
-			case path == "/api/v1/policies/sign-in":
-				middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin, models.RolePolicyAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					switch req.Method {
-					case "GET":
-						r.handler.ListSignInPolicies(w, req)
-					case "POST":
-						r.handler.CreateSignInPolicy(w, req)
-					case "PATCH", "PUT":
-						r.handler.UpdateSignInPolicy(w, req)
-					case "DELETE":
-						r.handler.DeleteSignInPolicy(w, req)
-					default:
-						w.WriteHeader(http.StatusMethodNotAllowed)
-					}
-				})).ServeHTTP(w, req)
-
-			// Application Management
-			case strings.HasPrefix(path, "/api/v1/applications"):
-				middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					switch req.Method {
-					case "GET":
-						if strings.Contains(req.URL.RawQuery, "id=") {
-							r.handler.GetApplication(w, req)
-						} else {
-							r.handler.ListApplications(w, req)
-						}
-					case "POST":
-						r.handler.CreateApplication(w, req)
-					case "PATCH", "PUT":
-						r.handler.UpdateApplication(w, req)
-					case "DELETE":
-						r.handler.DeleteApplication(w, req)
-					default:
-						w.WriteHeader(http.StatusMethodNotAllowed)
-					}
-				})).ServeHTTP(w, req)
-
-			// Node Management
-			case path == "/api/v1/nodes/skus" && req.Method == "GET":
-				r.handler.ListNodeSkus(w, req)
-
-			case path == "/api/v1/nodes":
-				middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					switch req.Method {
-					case "GET":
-						if strings.Contains(path, "/sessions") {
-							r.handler.ListNodeSessions(w, req)
-						} else {
-							r.handler.ListNodes(w, req)
-						}
-					case "POST":
-						r.handler.CreateNode(w, req)
-					case "DELETE":
-						r.handler.DeleteNode(w, req)
-					}
-				})).ServeHTTP(w, req)
-
-			case path == "/api/v1/nodes/sessions" && req.Method == "GET":
-				middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					r.handler.ListNodeSessions(w, req)
-				})).ServeHTTP(w, req)
-
-			// Identity Management
-			case path == "/api/v1/identity/search" && req.Method == "GET":
-				middleware.RequireRole(models.RoleSuperAdmin, models.RoleAdmin, models.RolePolicyAdmin)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-					r.handler.SearchIdentity(w, req)
-				})).ServeHTTP(w, req)
-
-			default:
-				w.WriteHeader(http.StatusNotFound)
-			}
-		})).ServeHTTP(w, req)
+	if knownPath {
+		w.WriteHeader(http.StatusMethodNotAllowed)
 		return
 	}
-
 	w.WriteHeader(http.StatusNotFound)
 }
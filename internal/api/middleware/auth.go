@@ -5,7 +5,6 @@ import (
 	"net/http"
 	"strings"
 	"tridorian-ztna/internal/api/common"
-	"tridorian-ztna/internal/models"
 	"tridorian-ztna/pkg/utils"
 
 	"github.com/google/uuid"
@@ -26,6 +25,13 @@ func GetClaims(ctx context.Context) *utils.Claims {
 }
 
 func JWTAuth(key interface{}, purpose utils.TokenPurpose) func(http.Handler) http.Handler {
+	return JWTAuthAny(key, purpose)
+}
+
+// JWTAuthAny accepts a token issued for any of the given purposes. The first
+// purpose decides which session cookie is read when no header is sent.
+func JWTAuthAny(key interface{}, purposes ...utils.TokenPurpose) func(http.Handler) http.Handler {
+	purpose := purposes[0]
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			token := ""
@@ -62,7 +68,14 @@ func JWTAuth(key interface{}, purpose utils.TokenPurpose) func(http.Handler) htt
 			}
 
 			// Validate Purpose
-			if claims.Purpose != purpose {
+			allowed := false
+			for _, p := range purposes {
+				if claims.Purpose == p {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
 				common.Error(w, http.StatusForbidden, "token not authorized for this action")
 				return
 			}
@@ -82,30 +95,3 @@ func JWTAuth(key interface{}, purpose utils.TokenPurpose) func(http.Handler) htt
 		})
 	}
 }
-
-func RequireRole(roles ...models.AdminRole) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			role, ok := r.Context().Value(RoleKey).(string)
-			if !ok {
-				common.Error(w, http.StatusUnauthorized, "role not found in token")
-				return
-			}
-
-			// Super Admin can do anything
-			if role == string(models.RoleSuperAdmin) {
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			for _, allowedRole := range roles {
-				if role == string(allowedRole) {
-					next.ServeHTTP(w, r)
-					return
-				}
-			}
-
-			common.Error(w, http.StatusForbidden, "you do not have permission to perform this action")
-		})
-	}
-}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"tridorian-ztna/internal/api/common"
+	"tridorian-ztna/internal/models"
+
+	"github.com/google/uuid"
+)
+
+const GrantKey contextKey = "grant"
+
+// GrantResolver looks up what a signed-in administrator may do.
+type GrantResolver interface {
+	Grant(tenantID, adminID uuid.UUID) (*models.AccessGrant, error)
+}
+
+// GetGrant retrieves the administrator's access grant from context
+func GetGrant(ctx context.Context) *models.AccessGrant {
+	if grant, ok := ctx.Value(GrantKey).(*models.AccessGrant); ok {
+		return grant
+	}
+	return nil
+}
+
+// LoadGrant resolves the access grant of the administrator JWTAuth signed in.
+// It is read on every request so that role changes apply immediately.
+func LoadGrant(resolver GrantResolver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			adminIDStr, _ := r.Context().Value(AdminIDKey).(string)
+			adminID, err := uuid.Parse(adminIDStr)
+			if err != nil {
+				common.Error(w, http.StatusUnauthorized, "invalid token subject")
+				return
+			}
+
+			grant, err := resolver.Grant(GetTenantID(r.Context()), adminID)
+			if err != nil {
+				common.Error(w, http.StatusUnauthorized, "administrator not found")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), GrantKey, grant)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequirePermission lets the request through when the administrator's grant
+// includes perm. An empty perm only requires a signed-in administrator.
+func RequirePermission(perm models.Permission) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			grant := GetGrant(r.Context())
+			if grant == nil {
+				common.Error(w, http.StatusUnauthorized, "permissions not loaded")
+				return
+			}
+			if perm != "" && !grant.Has(perm) {
+				common.Error(w, http.StatusForbidden, "you do not have permission to perform this action")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,885 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"tridorian-ztna/internal/api/middleware"
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/internal/services"
+	scimfilter "tridorian-ztna/pkg/scim"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	schemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	schemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaConfig       = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	schemaResourceType = "urn:ietf:params:scim:schemas:core:2.0:ResourceType"
+
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+type Handler struct {
+	directoryService *services.DirectoryService
+}
+
+func NewHandler(directoryService *services.DirectoryService) *Handler {
+	return &Handler{directoryService: directoryService}
+}
+
+// Resources
+
+type meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+type name struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type multiValue struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type userResource struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	Name        *name        `json:"name,omitempty"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []multiValue `json:"emails,omitempty"`
+	Active      bool         `json:"active"`
+	Groups      []multiValue `json:"groups,omitempty"`
+	Meta        meta         `json:"meta"`
+}
+
+type groupResource struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []multiValue `json:"members,omitempty"`
+	Meta        meta         `json:"meta"`
+}
+
+type listResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int64         `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+// userInput is the body of a POST or PUT on /Users.
+type userInput struct {
+	ExternalID  string       `json:"externalId"`
+	UserName    string       `json:"userName"`
+	Name        name         `json:"name"`
+	DisplayName string       `json:"displayName"`
+	Emails      []multiValue `json:"emails"`
+	Active      *bool        `json:"active"`
+}
+
+// groupInput is the body of a POST or PUT on /Groups.
+type groupInput struct {
+	ExternalID  string       `json:"externalId"`
+	DisplayName string       `json:"displayName"`
+	Members     []multiValue `json:"members"`
+}
+
+type patchRequest struct {
+	Operations []patchOperation `json:"Operations"`
+}
+
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// Discovery
+
+func (h *Handler) ServiceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"schemas":        []string{schemaConfig},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]interface{}{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]interface{}{"supported": true, "maxResults": maxPageSize},
+		"changePassword": map[string]bool{"supported": false},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]string{{
+			"type":        "oauthbearertoken",
+			"name":        "Bearer Token",
+			"description": "A SCIM token created in the tenant admin console",
+		}},
+	})
+}
+
+func (h *Handler) ResourceTypes(w http.ResponseWriter, r *http.Request) {
+	types := []interface{}{
+		map[string]interface{}{
+			"schemas":  []string{schemaResourceType},
+			"id":       "User",
+			"name":     "User",
+			"endpoint": "/Users",
+			"schema":   schemaUser,
+		},
+		map[string]interface{}{
+			"schemas":  []string{schemaResourceType},
+			"id":       "Group",
+			"name":     "Group",
+			"endpoint": "/Groups",
+			"schema":   schemaGroup,
+		},
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: int64(len(types)),
+		StartIndex:   1,
+		ItemsPerPage: len(types),
+		Resources:    types,
+	})
+}
+
+// Users
+
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+
+	filter, startIndex, count, err := listParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	users, total, err := h.directoryService.ListUsers(tenantID, filter, startIndex-1, count)
+	if err != nil {
+		h.serviceError(w, err)
+		return
+	}
+
+	resources := make([]interface{}, 0, len(users))
+	for i := range users {
+		resources = append(resources, toUserResource(r, &users[i]))
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID := middleware.GetTenantID(r.Context())
+	user, err := h.loadUser(tenantID, id)
+	if err != nil {
+		h.serviceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toUserResource(r, user))
+}
+
+func (h *Handler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+
+	var input userInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+
+	user := &models.DirectoryUser{}
+	input.apply(user)
+	if strings.TrimSpace(user.UserName) == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	if err := h.directoryService.CreateUser(tenantID, user); err != nil {
+		h.serviceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toUserResource(r, user))
+}
+
+func (h *Handler) ReplaceUser(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID := middleware.GetTenantID(r.Context())
+	user, err := h.loadUser(tenantID, id)
+	if err != nil {
+		h.serviceError(w, err)
+		return
+	}
+
+	var input userInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+
+	input.apply(user)
+	if strings.TrimSpace(user.UserName) == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	if err := h.directoryService.UpdateUser(tenantID, user); err != nil {
+		h.serviceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toUserResource(r, user))
+}
+
+func (h *Handler) PatchUser(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID := middleware.GetTenantID(r.Context())
+	user, err := h.loadUser(tenantID, id)
+	if err != nil {
+		h.serviceError(w, err)
+		return
+	}
+
+	var patch patchRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+
+	for _, op := range patch.Operations {
+		if err := patchUser(user, op); err != nil {
+			writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+
+	if strings.TrimSpace(user.UserName) == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+	if err := h.directoryService.UpdateUser(tenantID, user); err != nil {
+		h.serviceError(w, err)
+		return
+	}
+	if !user.Active {
+		log.Printf("🚫 SCIM deactivated %s in tenant %s", user.UserName, tenantID)
+	}
+	writeJSON(w, http.StatusOK, toUserResource(r, user))
+}
+
+func (h *Handler) DeleteUser(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID := middleware.GetTenantID(r.Context())
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		h.serviceError(w, gorm.ErrRecordNotFound)
+		return
+	}
+	if err := h.directoryService.DeleteUser(tenantID, userID); err != nil {
+		h.serviceError(w, err)
+		return
+	}
+	log.Printf("🚫 SCIM deleted user %s in tenant %s", id, tenantID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) loadUser(tenantID uuid.UUID, id string) (*models.DirectoryUser, error) {
+	userID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return h.directoryService.GetUser(tenantID, userID)
+}
+
+// apply copies the input over the user. A missing active flag means active.
+func (in *userInput) apply(u *models.DirectoryUser) {
+	u.ExternalID = in.ExternalID
+	u.UserName = strings.TrimSpace(in.UserName)
+	u.GivenName = in.Name.GivenName
+	u.FamilyName = in.Name.FamilyName
+	u.DisplayName = in.DisplayName
+	if u.DisplayName == "" {
+		u.DisplayName = in.Name.Formatted
+	}
+	if u.DisplayName == "" {
+		u.DisplayName = strings.TrimSpace(in.Name.GivenName + " " + in.Name.FamilyName)
+	}
+	u.Email = primaryValue(in.Emails)
+	u.Active = in.Active == nil || *in.Active
+}
+
+// patchUser applies one PATCH operation. Attributes the directory does not
+// keep, such as phone numbers or the enterprise extension, are ignored.
+func patchUser(u *models.DirectoryUser, op patchOperation) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return fmt.Errorf("unsupported op %q", op.Op)
+	}
+
+	if op.Path == "" {
+		if kind == "remove" {
+			return errors.New("remove requires a path")
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return errors.New("value must be an object when path is empty")
+		}
+		for key, value := range values {
+			if err := patchUser(u, patchOperation{Op: op.Op, Path: key, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := scimfilter.ParsePath(op.Path)
+	if err != nil {
+		return err
+	}
+	remove := kind == "remove"
+
+	switch path.Attr {
+	case "username":
+		return patchString(&u.UserName, op.Value, remove)
+	case "externalid":
+		return patchString(&u.ExternalID, op.Value, remove)
+	case "displayname":
+		return patchString(&u.DisplayName, op.Value, remove)
+	case "active":
+		if remove {
+			u.Active = false
+			return nil
+		}
+		return patchBool(&u.Active, op.Value)
+	case "name":
+		switch path.SubAttr {
+		case "givenname":
+			return patchString(&u.GivenName, op.Value, remove)
+		case "familyname":
+			return patchString(&u.FamilyName, op.Value, remove)
+		case "formatted":
+			return patchString(&u.DisplayName, op.Value, remove)
+		case "":
+			if remove {
+				u.GivenName, u.FamilyName = "", ""
+				return nil
+			}
+			var n name
+			if err := json.Unmarshal(op.Value, &n); err != nil {
+				return errors.New("invalid name")
+			}
+			u.GivenName, u.FamilyName = n.GivenName, n.FamilyName
+		}
+	case "emails":
+		if remove {
+			u.Email = ""
+			return nil
+		}
+		if path.SubAttr == "value" {
+			return patchString(&u.Email, op.Value, false)
+		}
+		if path.SubAttr == "" && path.Filter == nil {
+			var emails []multiValue
+			if err := json.Unmarshal(op.Value, &emails); err != nil {
+				return errors.New("invalid emails")
+			}
+			u.Email = primaryValue(emails)
+		}
+	}
+	return nil
+}
+
+// Groups
+
+func (h *Handler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+
+	filter, startIndex, count, err := listParams(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	withMembers := includeMembers(r)
+	groups, total, err := h.directoryService.ListGroups(tenantID, filter, startIndex-1, count, withMembers)
+	if err != nil {
+		h.serviceError(w, err)
+		return
+	}
+
+	resources := make([]interface{}, 0, len(groups))
+	for i := range groups {
+		resources = append(resources, toGroupResource(r, &groups[i]))
+	}
+	writeJSON(w, http.StatusOK, listResponse{
+		Schemas:      []string{schemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (h *Handler) GetGroup(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID := middleware.GetTenantID(r.Context())
+	group, err := h.loadGroup(tenantID, id, includeMembers(r))
+	if err != nil {
+		h.serviceError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toGroupResource(r, group))
+}
+
+func (h *Handler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	tenantID := middleware.GetTenantID(r.Context())
+
+	var input groupInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+
+	group := &models.DirectoryGroup{ExternalID: input.ExternalID, DisplayName: strings.TrimSpace(input.DisplayName)}
+	if group.DisplayName == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	if err := h.directoryService.CreateGroup(tenantID, group, memberIDs(input.Members)); err != nil {
+		h.serviceError(w, err)
+		return
+	}
+
+	h.writeGroup(w, r, http.StatusCreated, tenantID, group.ID)
+}
+
+func (h *Handler) ReplaceGroup(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID := middleware.GetTenantID(r.Context())
+	group, err := h.loadGroup(tenantID, id, false)
+	if err != nil {
+		h.serviceError(w, err)
+		return
+	}
+
+	var input groupInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+
+	group.ExternalID = input.ExternalID
+	group.DisplayName = strings.TrimSpace(input.DisplayName)
+	if group.DisplayName == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	members := memberIDs(input.Members)
+	if members == nil {
+		members = []uuid.UUID{}
+	}
+	if err := h.directoryService.UpdateGroup(tenantID, group, members); err != nil {
+		h.serviceError(w, err)
+		return
+	}
+
+	h.writeGroup(w, r, http.StatusOK, tenantID, group.ID)
+}
+
+// PatchGroup applies membership changes incrementally, so adding one member
+// to a large group does not rewrite all of them.
+func (h *Handler) PatchGroup(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID := middleware.GetTenantID(r.Context())
+	group, err := h.loadGroup(tenantID, id, false)
+	if err != nil {
+		h.serviceError(w, err)
+		return
+	}
+
+	var patch patchRequest
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "invalidSyntax", "invalid request body")
+		return
+	}
+
+	changes := &memberChanges{}
+	for _, op := range patch.Operations {
+		if err := patchGroup(group, changes, op); err != nil {
+			writeError(w, http.StatusBadRequest, "invalidValue", err.Error())
+			return
+		}
+	}
+
+	if strings.TrimSpace(group.DisplayName) == "" {
+		writeError(w, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+	if err := h.directoryService.UpdateGroup(tenantID, group, changes.replace); err != nil {
+		h.serviceError(w, err)
+		return
+	}
+	if len(changes.add) > 0 || len(changes.remove) > 0 {
+		if err := h.directoryService.ModifyGroupMembers(tenantID, group.ID, changes.add, changes.remove); err != nil {
+			h.serviceError(w, err)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) DeleteGroup(w http.ResponseWriter, r *http.Request, id string) {
+	tenantID := middleware.GetTenantID(r.Context())
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		h.serviceError(w, gorm.ErrRecordNotFound)
+		return
+	}
+	if err := h.directoryService.DeleteGroup(tenantID, groupID); err != nil {
+		h.serviceError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) loadGroup(tenantID uuid.UUID, id string, withMembers bool) (*models.DirectoryGroup, error) {
+	groupID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return h.directoryService.GetGroup(tenantID, groupID, withMembers)
+}
+
+func (h *Handler) writeGroup(w http.ResponseWriter, r *http.Request, status int, tenantID uuid.UUID, id uuid.UUID) {
+	group, err := h.directoryService.GetGroup(tenantID, id, true)
+	if err != nil {
+		h.serviceError(w, err)
+		return
+	}
+	writeJSON(w, status, toGroupResource(r, group))
+}
+
+// memberChanges collects the membership edits of a PATCH request. Once a
+// replace is seen, later edits apply to the replacement list.
+type memberChanges struct {
+	replace []uuid.UUID
+	add     []uuid.UUID
+	remove  []uuid.UUID
+}
+
+func (c *memberChanges) addMembers(ids []uuid.UUID) {
+	if c.replace != nil {
+		c.replace = append(c.replace, ids...)
+		return
+	}
+	c.add = append(c.add, ids...)
+	c.remove = withoutIDs(c.remove, ids)
+}
+
+func (c *memberChanges) removeMembers(ids []uuid.UUID) {
+	if c.replace != nil {
+		c.replace = withoutIDs(c.replace, ids)
+		return
+	}
+	c.remove = append(c.remove, ids...)
+	c.add = withoutIDs(c.add, ids)
+}
+
+func (c *memberChanges) replaceMembers(ids []uuid.UUID) {
+	if ids == nil {
+		ids = []uuid.UUID{}
+	}
+	c.replace, c.add, c.remove = ids, nil, nil
+}
+
+func patchGroup(g *models.DirectoryGroup, changes *memberChanges, op patchOperation) error {
+	kind := strings.ToLower(op.Op)
+	if kind != "add" && kind != "replace" && kind != "remove" {
+		return fmt.Errorf("unsupported op %q", op.Op)
+	}
+
+	if op.Path == "" {
+		if kind == "remove" {
+			return errors.New("remove requires a path")
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return errors.New("value must be an object when path is empty")
+		}
+		for key, value := range values {
+			if err := patchGroup(g, changes, patchOperation{Op: op.Op, Path: key, Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	path, err := scimfilter.ParsePath(op.Path)
+	if err != nil {
+		return err
+	}
+
+	switch path.Attr {
+	case "displayname":
+		if kind == "remove" {
+			return errors.New("displayName cannot be removed")
+		}
+		return patchString(&g.DisplayName, op.Value, false)
+
+	case "externalid":
+		return patchString(&g.ExternalID, op.Value, kind == "remove")
+
+	case "members":
+		var members []multiValue
+		if len(op.Value) > 0 && string(op.Value) != "null" {
+			if err := json.Unmarshal(op.Value, &members); err != nil {
+				return errors.New("members must be a list of {\"value\": id}")
+			}
+		}
+		ids := memberIDs(members)
+
+		switch kind {
+		case "add":
+			changes.addMembers(ids)
+		case "replace":
+			changes.replaceMembers(ids)
+		case "remove":
+			if path.Filter != nil {
+				ids = append(ids, filterValues(path.Filter)...)
+			}
+			if path.Filter == nil && len(members) == 0 {
+				changes.replaceMembers(nil)
+			} else {
+				changes.removeMembers(ids)
+			}
+		}
+	}
+	return nil
+}
+
+// filterValues collects the IDs of `value eq "id"` terms in a members filter.
+func filterValues(e scimfilter.Expr) []uuid.UUID {
+	switch e := e.(type) {
+	case *scimfilter.Compare:
+		if s, ok := e.Value.(string); ok && e.Attr == "value" && e.Op == "eq" {
+			if id, err := uuid.Parse(s); err == nil {
+				return []uuid.UUID{id}
+			}
+		}
+	case *scimfilter.Logical:
+		if e.Op == "or" {
+			return append(filterValues(e.Left), filterValues(e.Right)...)
+		}
+	}
+	return nil
+}
+
+// memberIDs returns the valid user IDs of a members list, nil when empty.
+func memberIDs(members []multiValue) []uuid.UUID {
+	var ids []uuid.UUID
+	for _, m := range members {
+		if id, err := uuid.Parse(m.Value); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func withoutIDs(list, ids []uuid.UUID) []uuid.UUID {
+	drop := make(map[uuid.UUID]bool, len(ids))
+	for _, id := range ids {
+		drop[id] = true
+	}
+	kept := list[:0]
+	for _, id := range list {
+		if !drop[id] {
+			kept = append(kept, id)
+		}
+	}
+	return kept
+}
+
+// Helpers
+
+// listParams reads filter, startIndex (1-based) and count from the query.
+func listParams(r *http.Request) (scimfilter.Expr, int, int, error) {
+	q := r.URL.Query()
+
+	var filter scimfilter.Expr
+	if f := strings.TrimSpace(q.Get("filter")); f != "" {
+		var err error
+		if filter, err = scimfilter.ParseFilter(f); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	startIndex, err := strconv.Atoi(q.Get("startIndex"))
+	if err != nil || startIndex < 1 {
+		startIndex = 1
+	}
+	count, err := strconv.Atoi(q.Get("count"))
+	if err != nil || count < 0 {
+		count = defaultPageSize
+	}
+	if count > maxPageSize {
+		count = maxPageSize
+	}
+	return filter, startIndex, count, nil
+}
+
+// includeMembers is false when the client asks to leave members out, as
+// Entra ID does when it only checks that a group exists.
+func includeMembers(r *http.Request) bool {
+	for _, attr := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+func primaryValue(values []multiValue) string {
+	for _, v := range values {
+		if v.Primary {
+			return v.Value
+		}
+	}
+	if len(values) > 0 {
+		return values[0].Value
+	}
+	return ""
+}
+
+func patchString(field *string, value json.RawMessage, remove bool) error {
+	if remove {
+		*field = ""
+		return nil
+	}
+	if err := json.Unmarshal(value, field); err != nil {
+		return errors.New("value must be a string")
+	}
+	return nil
+}
+
+// patchBool accepts true/false as JSON booleans or, as Entra ID sends them, strings.
+func patchBool(field *bool, value json.RawMessage) error {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		*field = b
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			*field = b
+			return nil
+		}
+	}
+	return errors.New("value must be a boolean")
+}
+
+func resourceURL(r *http.Request, kind string, id uuid.UUID) string {
+	protocol := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		protocol = "https"
+	}
+	return fmt.Sprintf("%s://%s/scim/v2/%s/%s", protocol, r.Host, kind, id)
+}
+
+func toUserResource(r *http.Request, u *models.DirectoryUser) userResource {
+	res := userResource{
+		Schemas:     []string{schemaUser},
+		ID:          u.ID.String(),
+		ExternalID:  u.ExternalID,
+		UserName:    u.UserName,
+		DisplayName: u.DisplayName,
+		Active:      u.Active,
+		Meta: meta{
+			ResourceType: "User",
+			Created:      u.CreatedAt.UTC().Format(time.RFC3339),
+			LastModified: u.UpdatedAt.UTC().Format(time.RFC3339),
+			Location:     resourceURL(r, "Users", u.ID),
+		},
+	}
+	if u.GivenName != "" || u.FamilyName != "" {
+		res.Name = &name{
+			Formatted:  strings.TrimSpace(u.GivenName + " " + u.FamilyName),
+			GivenName:  u.GivenName,
+			FamilyName: u.FamilyName,
+		}
+	}
+	if u.Email != "" {
+		res.Emails = []multiValue{{Value: u.Email, Type: "work", Primary: true}}
+	}
+	for _, g := range u.Groups {
+		res.Groups = append(res.Groups, multiValue{Value: g.ID.String(), Display: g.DisplayName, Ref: resourceURL(r, "Groups", g.ID)})
+	}
+	return res
+}
+
+func toGroupResource(r *http.Request, g *models.DirectoryGroup) groupResource {
+	res := groupResource{
+		Schemas:     []string{schemaGroup},
+		ID:          g.ID.String(),
+		ExternalID:  g.ExternalID,
+		DisplayName: g.DisplayName,
+		Meta: meta{
+			ResourceType: "Group",
+			Created:      g.CreatedAt.UTC().Format(time.RFC3339),
+			LastModified: g.UpdatedAt.UTC().Format(time.RFC3339),
+			Location:     resourceURL(r, "Groups", g.ID),
+		},
+	}
+	for _, m := range g.Members {
+		res.Members = append(res.Members, multiValue{Value: m.ID.String(), Display: m.UserName, Ref: resourceURL(r, "Users", m.ID)})
+	}
+	return res
+}
+
+// serviceError maps a directory error to a SCIM error response.
+func (h *Handler) serviceError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		writeError(w, http.StatusNotFound, "", "resource not found")
+	case errors.Is(err, services.ErrDirectoryConflict):
+		writeError(w, http.StatusConflict, "uniqueness", err.Error())
+	case errors.Is(err, services.ErrInvalidFilter):
+		writeError(w, http.StatusBadRequest, "invalidFilter", err.Error())
+	default:
+		log.Printf("SCIM request failed: %v", err)
+		writeError(w, http.StatusInternalServerError, "", "internal error")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/scim+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, scimType, detail string) {
+	body := map[string]interface{}{
+		"schemas": []string{schemaError},
+		"status":  strconv.Itoa(status),
+		"detail":  detail,
+	}
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+	writeJSON(w, status, body)
+}
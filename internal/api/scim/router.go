@@ -0,0 +1,103 @@
+package scim
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"tridorian-ztna/internal/api/middleware"
+	"tridorian-ztna/internal/services"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// Router serves the SCIM 2.0 endpoint under /scim/v2. The tenant is the one
+// the bearer token was issued for.
+type Router struct {
+	handler          *Handler
+	directoryService *services.DirectoryService
+}
+
+func NewRouter(db *gorm.DB, cache *redis.Client) *Router {
+	directoryService := services.NewDirectoryService(db, cache)
+	return &Router{
+		handler:          NewHandler(directoryService),
+		directoryService: directoryService,
+	}
+}
+
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	path := strings.TrimSuffix(strings.TrimPrefix(req.URL.Path, "/scim/v2"), "/")
+
+	token := ""
+	if scheme, value, ok := strings.Cut(req.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(value)
+	}
+	tenantID, err := r.directoryService.AuthenticateSCIMToken(token)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, "", "invalid or missing bearer token")
+		return
+	}
+	req = req.WithContext(context.WithValue(req.Context(), middleware.TenantIDKey, tenantID))
+
+	switch {
+	case path == "/ServiceProviderConfig" && req.Method == "GET":
+		r.handler.ServiceProviderConfig(w, req)
+
+	case path == "/ResourceTypes" && req.Method == "GET":
+		r.handler.ResourceTypes(w, req)
+
+	case path == "/Users":
+		switch req.Method {
+		case "GET":
+			r.handler.ListUsers(w, req)
+		case "POST":
+			r.handler.CreateUser(w, req)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "", "method not allowed")
+		}
+
+	case strings.HasPrefix(path, "/Users/"):
+		id := strings.TrimPrefix(path, "/Users/")
+		switch req.Method {
+		case "GET":
+			r.handler.GetUser(w, req, id)
+		case "PUT":
+			r.handler.ReplaceUser(w, req, id)
+		case "PATCH":
+			r.handler.PatchUser(w, req, id)
+		case "DELETE":
+			r.handler.DeleteUser(w, req, id)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "", "method not allowed")
+		}
+
+	case path == "/Groups":
+		switch req.Method {
+		case "GET":
+			r.handler.ListGroups(w, req)
+		case "POST":
+			r.handler.CreateGroup(w, req)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "", "method not allowed")
+		}
+
+	case strings.HasPrefix(path, "/Groups/"):
+		id := strings.TrimPrefix(path, "/Groups/")
+		switch req.Method {
+		case "GET":
+			r.handler.GetGroup(w, req, id)
+		case "PUT":
+			r.handler.ReplaceGroup(w, req, id)
+		case "PATCH":
+			r.handler.PatchGroup(w, req, id)
+		case "DELETE":
+			r.handler.DeleteGroup(w, req, id)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "", "method not allowed")
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, "", "endpoint not found")
+	}
+}
@@ -7,6 +7,13 @@ import (
 	"net/netip"
 	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"tridorian-ztna/pkg/fqdn"
+	"tridorian-ztna/pkg/portrange"
+	"tridorian-ztna/pkg/posture"
+	"tridorian-ztna/pkg/schedule"
 )
 
 var CurrentConfig *AgentExecutionConfig
@@ -16,6 +23,15 @@ type EngineType struct {
 	DefaultRule ConditionalAccessDefaultPolicies
 
 	Rules []ParsedRule
+
+	// active[i] reports whether Rules[i] is inside its schedule.
+	// Refreshed by RefreshSchedules so the packet path never parses time conditions.
+	active atomic.Pointer[[]bool]
+
+	blockedDevices map[string]bool
+	revokedUsers   map[string]bool // lower-cased emails
+
+	revokedSessions map[string]int64 // lower-cased email to Unix time
 }
 
 type ParsedRule struct {
@@ -27,9 +43,14 @@ type ParsedRule struct {
 	SourceType     string //  "Identity", "DeviceOS"
 	SourceIdentity string
 
-	DestType     string //  "CIDR, SNI, Tag"
+	DestType     string //  "CIDR, SNI, FQDN, Tag"
 	DestNet      []netip.Prefix
 	DestIdentity string
+	DestDomains  []string          // For FQDN: patterns looked up in FQDNs
+	DestPorts    []portrange.Range // Empty = all ports
+
+	TimeConditions   []schedule.Condition
+	DeviceConditions []posture.Condition
 }
 
 type ValType struct {
@@ -37,10 +58,13 @@ type ValType struct {
 	Identity string
 	Groups   []string
 	OS       string
+	Posture  *posture.Report // Latest signed report from the client, nil if none
 }
 
 func NewEngine() {
 	var parsedRules []ParsedRule
+	var domains []string
+	seenDomains := make(map[string]bool)
 
 	for _, r := range CurrentConfig.ConditionalAccessPolicies {
 
@@ -62,16 +86,31 @@ func NewEngine() {
 
 		}
 
+		var dstDomains []string
+		if r.DestinationTagType == "FQDN" {
+			dstDomains = fqdn.Split(r.DestinationMatchValue)
+			for _, d := range dstDomains {
+				if !seenDomains[d] {
+					seenDomains[d] = true
+					domains = append(domains, d)
+				}
+			}
+		}
+
 		// Append เข้า List
 		parsedRules = append(parsedRules, ParsedRule{
-			Name:           r.Name,
-			Priority:       r.Priority,
-			Allow:          isAllow,
-			SourceType:     r.SourceTagType,
-			SourceIdentity: r.SourceMatchValue,
-			DestType:       r.DestinationTagType,
-			DestNet:        dstPrefixes,
-			DestIdentity:   r.DestinationMatchValue,
+			Name:             r.Name,
+			Priority:         r.Priority,
+			Allow:            isAllow,
+			SourceType:       r.SourceTagType,
+			SourceIdentity:   r.SourceMatchValue,
+			DestType:         r.DestinationTagType,
+			DestNet:          dstPrefixes,
+			DestIdentity:     r.DestinationMatchValue,
+			DestDomains:      dstDomains,
+			DestPorts:        r.Ports,
+			TimeConditions:   r.TimeConditions,
+			DeviceConditions: r.DeviceConditions,
 		})
 	}
 
@@ -82,8 +121,76 @@ func NewEngine() {
 	// dstBitsI := parsedRules[i].DestNet.Bits()
 	// dstBitsJ := parsedRules[j].DestNet.Bits()
 
+	FQDNs.SetPatterns(domains)
+
 	log.Printf("✅ Firewall Engine loaded %d rules", len(parsedRules))
-	Engine = &EngineType{Rules: parsedRules, DefaultRule: CurrentConfig.ConditionalAccessDefaultPolicies}
+	blocked := make(map[string]bool, len(CurrentConfig.BlockedDeviceIDs))
+	for _, id := range CurrentConfig.BlockedDeviceIDs {
+		blocked[id] = true
+	}
+
+	revoked := make(map[string]bool, len(CurrentConfig.RevokedUserEmails))
+	for _, email := range CurrentConfig.RevokedUserEmails {
+		revoked[strings.ToLower(email)] = true
+	}
+
+	revokedSessions := make(map[string]int64, len(CurrentConfig.RevokedSessions))
+	for email, at := range CurrentConfig.RevokedSessions {
+		revokedSessions[strings.ToLower(email)] = at
+	}
+
+	engine := &EngineType{Rules: parsedRules, DefaultRule: CurrentConfig.ConditionalAccessDefaultPolicies, blockedDevices: blocked, revokedUsers: revoked, revokedSessions: revokedSessions}
+	engine.RefreshSchedules(time.Now())
+	Engine = engine
+}
+
+// RefreshSchedules re-evaluates the time conditions of every rule and
+// reports whether any rule became active or inactive since the last call.
+func (e *EngineType) RefreshSchedules(now time.Time) bool {
+	next := make([]bool, len(e.Rules))
+	for i, rule := range e.Rules {
+		next[i] = len(rule.TimeConditions) == 0 || schedule.AllMatch(rule.TimeConditions, now)
+	}
+
+	prev := e.active.Swap(&next)
+	if prev == nil || len(*prev) != len(next) {
+		return prev != nil
+	}
+
+	changed := false
+	for i := range next {
+		if (*prev)[i] != next[i] {
+			log.Printf("⏰ Rule %s is now active=%v", e.Rules[i].Name, next[i])
+			changed = true
+		}
+	}
+	return changed
+}
+
+// isActive reports whether the rule at index i is currently inside its schedule.
+func (e *EngineType) isActive(i int) bool {
+	active := e.active.Load()
+	if active == nil || i >= len(*active) {
+		return len(e.Rules[i].TimeConditions) == 0
+	}
+	return (*active)[i]
+}
+
+// IsDeviceBlocked reports whether the administrator has blocked the device.
+func (e *EngineType) IsDeviceBlocked(deviceID string) bool {
+	return deviceID != "" && e.blockedDevices[deviceID]
+}
+
+// IsUserRevoked reports whether the directory has deprovisioned the user.
+func (e *EngineType) IsUserRevoked(email string) bool {
+	return email != "" && e.revokedUsers[strings.ToLower(email)]
+}
+
+// IsSessionRevoked reports whether an administrator ended the user's sessions
+// at or after since, a Unix time such as a token's issue or a connection's start.
+func (e *EngineType) IsSessionRevoked(email string, since int64) bool {
+	at, ok := e.revokedSessions[strings.ToLower(email)]
+	return ok && at >= since
 }
 
 func MatchSNI(packet []byte, sni string) SniResponseType {
@@ -198,7 +305,7 @@ func MatchSNI(packet []byte, sni string) SniResponseType {
 
 				domain := string(payload[startSNI:endSNI])
 
-				if domain == sni {
+				if fqdn.Match(sni, domain) {
 					return SNI_RESPONSE_MATCH
 				}
 			}
@@ -213,30 +320,13 @@ func MatchSNI(packet []byte, sni string) SniResponseType {
 func (e *EngineType) IsAllowed(packetData []byte, sourceVal ValType, destVal ValType) bool {
 
 	// 2. Loop Through Rules (Sorted)
-	for _, rule := range e.Rules {
-
-		// --- Check Source ---
-		matchSrc := false
-		switch rule.SourceType {
-		case "Identity":
-			if rule.SourceIdentity == sourceVal.Identity {
-				matchSrc = true
-			} else if strings.HasPrefix(rule.SourceIdentity, "group:") {
-				groupName := strings.TrimPrefix(rule.SourceIdentity, "group:")
-				for _, g := range sourceVal.Groups {
-					if g == groupName {
-						matchSrc = true
-						break
-					}
-				}
-			}
-		case "DeviceOS":
-			if strings.EqualFold(rule.SourceIdentity, sourceVal.OS) {
-				matchSrc = true
-			}
+	for i, rule := range e.Rules {
+		if !e.isActive(i) {
+			continue
 		}
 
-		if !matchSrc {
+		// --- Check Source ---
+		if !rule.matchesSource(sourceVal) {
 			continue
 		}
 
@@ -261,12 +351,29 @@ func (e *EngineType) IsAllowed(packetData []byte, sourceVal ValType, destVal Val
 
 			destVal.Identity = rule.DestIdentity
 
+		case "FQDN":
+			for _, d := range rule.DestDomains {
+				if FQDNs.Contains(d, destVal.Addr) {
+					matchDst = true
+					break
+				}
+			}
+
+			destVal.Identity = rule.DestIdentity
+
 		}
 
 		if !matchDst {
 			continue
 		}
 
+		if len(rule.DestPorts) > 0 {
+			proto, port, ok := destinationPort(packetData)
+			if !ok || !portrange.MatchAny(rule.DestPorts, proto, port) {
+				continue
+			}
+		}
+
 		if rule.Allow {
 			return true
 		} else {
@@ -285,11 +392,67 @@ func (e *EngineType) IsAllowed(packetData []byte, sourceVal ValType, destVal Val
 
 }
 
-func (e *EngineType) GetAllowedCIDRs(identity string, groups []string, os string) []string {
+// matchesSource reports whether the rule applies to the session described by sourceVal.
+func (rule *ParsedRule) matchesSource(sourceVal ValType) bool {
+	matchSrc := false
+	switch rule.SourceType {
+	case "Identity":
+		if rule.SourceIdentity == sourceVal.Identity {
+			matchSrc = true
+		} else if strings.HasPrefix(rule.SourceIdentity, "group:") {
+			groupName := strings.TrimPrefix(rule.SourceIdentity, "group:")
+			for _, g := range sourceVal.Groups {
+				if g == groupName {
+					matchSrc = true
+					break
+				}
+			}
+		}
+	case "DeviceOS":
+		if strings.EqualFold(rule.SourceIdentity, sourceVal.OS) {
+			matchSrc = true
+		}
+	}
+
+	if !matchSrc {
+		return false
+	}
+
+	return len(rule.DeviceConditions) == 0 || posture.AllMatch(rule.DeviceConditions, sourceVal.Posture)
+}
+
+// IsNameAllowed applies FQDN rules to a DNS query name. The first active FQDN
+// rule covering both the session and the name decides; names covered only by
+// rules for other users fall back to the default policy. Names no FQDN rule
+// covers are answered; traffic to them is still filtered by IsAllowed.
+func (e *EngineType) IsNameAllowed(sourceVal ValType, name string) bool {
+	covered := false
+	for i := range e.Rules {
+		rule := &e.Rules[i]
+		if rule.DestType != "FQDN" || !e.isActive(i) || !fqdn.MatchAny(rule.DestDomains, name) {
+			continue
+		}
+		covered = true
+		if !rule.matchesSource(sourceVal) {
+			continue
+		}
+		if !rule.Allow {
+			log.Printf("🔴 DNS query for %s denied by rule: %s (Src: %s)", name, rule.Name, sourceVal.Identity)
+		}
+		return rule.Allow
+	}
+	return !covered || !e.DefaultRule.BlockByDefault
+}
+
+func (e *EngineType) GetAllowedCIDRs(identity string, groups []string, os string, report *posture.Report) []string {
 	var cidrs []string
 	seen := make(map[string]bool)
 
-	for _, rule := range e.Rules {
+	for i, rule := range e.Rules {
+		if !e.isActive(i) {
+			continue
+		}
+
 		match := false
 		if rule.SourceType == "Identity" {
 			if rule.SourceIdentity == identity {
@@ -307,6 +470,10 @@ func (e *EngineType) GetAllowedCIDRs(identity string, groups []string, os string
 			match = true
 		}
 
+		if match && len(rule.DeviceConditions) > 0 && !posture.AllMatch(rule.DeviceConditions, report) {
+			match = false
+		}
+
 		if match {
 			if rule.Allow && rule.DestType == "CIDR" {
 				for _, prefix := range rule.DestNet {
@@ -317,11 +484,38 @@ func (e *EngineType) GetAllowedCIDRs(identity string, groups []string, os string
 					}
 				}
 			}
+			if rule.Allow && rule.DestType == "FQDN" {
+				for _, d := range rule.DestDomains {
+					for _, prefix := range FQDNs.Prefixes(d) {
+						s := prefix.String()
+						if !seen[s] {
+							cidrs = append(cidrs, s)
+							seen[s] = true
+						}
+					}
+				}
+			}
 		}
 	}
 	return cidrs
 }
 
+// destinationPort returns the protocol number and destination port of an IPv4 TCP or UDP packet.
+func destinationPort(packet []byte) (uint8, uint16, bool) {
+	if len(packet) < 20 {
+		return 0, 0, false
+	}
+	proto := packet[9]
+	if proto != portrange.ProtoTCP && proto != portrange.ProtoUDP {
+		return proto, 0, false
+	}
+	ihl := int(packet[0]&0x0F) * 4
+	if len(packet) < ihl+4 {
+		return proto, 0, false
+	}
+	return proto, binary.BigEndian.Uint16(packet[ihl+2 : ihl+4]), true
+}
+
 // Helper: ตัด Port ทิ้งถ้ามี
 func parseIP(s string) (netip.Addr, error) {
 	// ลอง Parse แบบมี Port ก่อน (1.1.1.1:80)
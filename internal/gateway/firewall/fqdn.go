@@ -0,0 +1,323 @@
+package firewall
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tridorian-ztna/pkg/fqdn"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// FQDNs holds the addresses currently known for FQDN destinations.
+// It lives outside the engine so config reloads keep what was already resolved.
+var FQDNs = NewFQDNTable()
+
+const (
+	minFQDNTTL     = 30 * time.Second
+	maxFQDNTTL     = time.Hour
+	defaultFQDNTTL = 5 * time.Minute
+)
+
+// FQDNTable maps each destination pattern ("jira.example.com", "*.corp.internal")
+// to the addresses it resolved to and when each address expires.
+type FQDNTable struct {
+	mu       sync.RWMutex
+	patterns []string
+	entries  map[string]map[netip.Addr]time.Time
+}
+
+func NewFQDNTable() *FQDNTable {
+	return &FQDNTable{entries: make(map[string]map[netip.Addr]time.Time)}
+}
+
+// SetPatterns replaces the tracked patterns and drops addresses of removed ones.
+func (t *FQDNTable) SetPatterns(patterns []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	keep := make(map[string]bool, len(patterns))
+	for _, p := range patterns {
+		keep[p] = true
+		if t.entries[p] == nil {
+			t.entries[p] = make(map[netip.Addr]time.Time)
+		}
+	}
+	for p := range t.entries {
+		if !keep[p] {
+			delete(t.entries, p)
+		}
+	}
+	t.patterns = patterns
+}
+
+// Learn records addresses seen for a name, either from the gateway's own lookup
+// or from an answer its DNS forwarder got from a tenant resolver. It returns true if any pattern
+// gained an address it did not have before.
+func (t *FQDNTable) Learn(name string, addrs []netip.Addr, ttl time.Duration, now time.Time) bool {
+	if len(addrs) == 0 {
+		return false
+	}
+	ttl = max(minFQDNTTL, min(ttl, maxFQDNTTL))
+	expiry := now.Add(ttl)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	added := false
+	for _, p := range t.patterns {
+		if !fqdn.Match(p, name) {
+			continue
+		}
+		set := t.entries[p]
+		for _, addr := range addrs {
+			if _, ok := set[addr]; !ok {
+				added = true
+				log.Printf("🌐 %s -> %s (via %s, ttl %s)", p, addr, name, ttl)
+			}
+			if set[addr].Before(expiry) {
+				set[addr] = expiry
+			}
+		}
+	}
+	return added
+}
+
+// Contains reports whether addr is currently resolved for the pattern.
+func (t *FQDNTable) Contains(pattern string, addr netip.Addr) bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	_, ok := t.entries[pattern][addr]
+	return ok
+}
+
+// Prefixes returns the addresses resolved for the pattern as sorted host routes.
+func (t *FQDNTable) Prefixes(pattern string) []netip.Prefix {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	prefixes := make([]netip.Prefix, 0, len(t.entries[pattern]))
+	for addr := range t.entries[pattern] {
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	sort.Slice(prefixes, func(i, j int) bool {
+		return prefixes[i].Addr().Less(prefixes[j].Addr())
+	})
+	return prefixes
+}
+
+// Expire drops addresses whose TTL has passed and reports whether any were removed.
+func (t *FQDNTable) Expire(now time.Time) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	removed := false
+	for p, set := range t.entries {
+		for addr, expiry := range set {
+			if now.After(expiry) {
+				delete(set, addr)
+				removed = true
+				log.Printf("⌛ %s -> %s expired", p, addr)
+			}
+		}
+	}
+	return removed
+}
+
+// Resolve looks up every non-wildcard pattern. Wildcards cannot be resolved
+// directly and are only learned from the answers of the gateway's forwarder.
+// It returns true if new addresses were learned.
+func (t *FQDNTable) Resolve(ctx context.Context, now time.Time) bool {
+	t.mu.RLock()
+	patterns := t.patterns
+	t.mu.RUnlock()
+
+	added := false
+	for _, p := range patterns {
+		if fqdn.IsWildcard(p) {
+			continue
+		}
+		addrs, ttl, err := lookupHost(ctx, p)
+		if err != nil {
+			log.Printf("⚠️ Failed to resolve %s: %v", p, err)
+			continue
+		}
+		if t.Learn(p, addrs, ttl, now) {
+			added = true
+		}
+	}
+	return added
+}
+
+// LearnFromExchange learns the addresses in resp, the answer a tenant
+// resolver gave the gateway's DNS forwarder for query. Used for wildcard
+// patterns. Answers that do not match the query's ID and question are
+// ignored, so nothing but the gateway's own exchanges adds addresses.
+func (t *FQDNTable) LearnFromExchange(query, resp []byte) bool {
+	t.mu.RLock()
+	tracking := len(t.patterns) > 0
+	t.mu.RUnlock()
+	if !tracking {
+		return false
+	}
+
+	name, addrs, ttl, err := answerFor(query, resp)
+	if err != nil {
+		return false
+	}
+	return t.Learn(name, addrs, ttl, time.Now())
+}
+
+// answerFor parses resp as the answer to query: the same ID and the same
+// single question.
+func answerFor(query, resp []byte) (string, []netip.Addr, time.Duration, error) {
+	var qp, rp dnsmessage.Parser
+	qh, err := qp.Start(query)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	q, err := qp.Question()
+	if err != nil {
+		return "", nil, 0, err
+	}
+	rh, err := rp.Start(resp)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	rq, err := rp.Question()
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if qh.Response || rh.ID != qh.ID || rq.Type != q.Type || rq.Class != q.Class ||
+		!strings.EqualFold(rq.Name.String(), q.Name.String()) {
+		return "", nil, 0, errors.New("answer does not match the query")
+	}
+	return parseDNSAnswer(resp)
+}
+
+// parseDNSAnswer extracts the question name, A records and lowest TTL of a DNS response.
+func parseDNSAnswer(msg []byte) (string, []netip.Addr, time.Duration, error) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(msg)
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if !hdr.Response || hdr.RCode != dnsmessage.RCodeSuccess {
+		return "", nil, 0, errors.New("not a successful response")
+	}
+
+	q, err := p.Question()
+	if err != nil {
+		return "", nil, 0, err
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return "", nil, 0, err
+	}
+
+	var addrs []netip.Addr
+	ttl := maxFQDNTTL
+	for {
+		h, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return "", nil, 0, err
+		}
+		if h.Type != dnsmessage.TypeA {
+			if err := p.SkipAnswer(); err != nil {
+				return "", nil, 0, err
+			}
+			continue
+		}
+		a, err := p.AResource()
+		if err != nil {
+			return "", nil, 0, err
+		}
+		addrs = append(addrs, netip.AddrFrom4(a.A))
+		ttl = min(ttl, time.Duration(h.TTL)*time.Second)
+	}
+
+	return q.Name.String(), addrs, ttl, nil
+}
+
+// lookupHost resolves IPv4 addresses for name using the system nameservers so
+// the record TTL is known. It falls back to the Go resolver with a default TTL.
+func lookupHost(ctx context.Context, name string) ([]netip.Addr, time.Duration, error) {
+	for _, server := range systemNameservers() {
+		addrs, ttl, err := queryA(ctx, server, name)
+		if err == nil {
+			return addrs, ttl, nil
+		}
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip4", name)
+	if err != nil {
+		return nil, 0, err
+	}
+	return addrs, defaultFQDNTTL, nil
+}
+
+func queryA(ctx context.Context, server, name string) ([]netip.Addr, time.Duration, error) {
+	qname, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, 0, err
+	}
+	query, err := (&dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: uint16(rand.Uint32()), RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}).Pack()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", net.JoinHostPort(server, "53"))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(3 * time.Second))
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, 0, err
+	}
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	_, addrs, ttl, err := answerFor(query, buf[:n])
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(addrs) == 0 {
+		return nil, 0, errors.New("no A records")
+	}
+	return addrs, ttl, nil
+}
+
+func systemNameservers() []string {
+	data, err := os.ReadFile("/etc/resolv.conf")
+	if err != nil {
+		return nil
+	}
+	var servers []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
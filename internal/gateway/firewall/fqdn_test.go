@@ -0,0 +1,154 @@
+package firewall
+
+import (
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type dnsAnswer struct {
+	name string
+	addr string
+	ttl  uint32
+}
+
+func dnsMessage(t *testing.T, id uint16, response bool, rcode dnsmessage.RCode, question string, qtype dnsmessage.Type, answers ...dnsAnswer) []byte {
+	t.Helper()
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, Response: response, RCode: rcode},
+		Questions: []dnsmessage.Question{{
+			Name: dnsmessage.MustNewName(question), Type: qtype, Class: dnsmessage.ClassINET,
+		}},
+	}
+	for _, a := range answers {
+		msg.Answers = append(msg.Answers, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(a.name), Class: dnsmessage.ClassINET, TTL: a.ttl},
+			Body:   &dnsmessage.AResource{A: netip.MustParseAddr(a.addr).As4()},
+		})
+	}
+	data, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("pack DNS message: %v", err)
+	}
+	return data
+}
+
+func TestLearnFromExchange(t *testing.T) {
+	const name = "git.corp.internal."
+	query := dnsMessage(t, 0x1234, false, dnsmessage.RCodeSuccess, name, dnsmessage.TypeA)
+	answer := dnsAnswer{name, "10.1.2.3", 300}
+
+	tests := []struct {
+		name  string
+		query []byte
+		resp  []byte
+		want  []netip.Prefix
+	}{
+		{
+			name:  "matching answer",
+			query: query,
+			resp:  dnsMessage(t, 0x1234, true, dnsmessage.RCodeSuccess, name, dnsmessage.TypeA, answer, dnsAnswer{name, "10.1.2.4", 60}),
+			want:  []netip.Prefix{netip.MustParsePrefix("10.1.2.3/32"), netip.MustParsePrefix("10.1.2.4/32")},
+		},
+		{
+			name:  "question in another case",
+			query: query,
+			resp:  dnsMessage(t, 0x1234, true, dnsmessage.RCodeSuccess, "GIT.Corp.Internal.", dnsmessage.TypeA, answer),
+			want:  []netip.Prefix{netip.MustParsePrefix("10.1.2.3/32")},
+		},
+		{
+			name:  "other transaction ID",
+			query: query,
+			resp:  dnsMessage(t, 0x4321, true, dnsmessage.RCodeSuccess, name, dnsmessage.TypeA, answer),
+		},
+		{
+			name:  "answer to another question",
+			query: query,
+			resp:  dnsMessage(t, 0x1234, true, dnsmessage.RCodeSuccess, "wiki.corp.internal.", dnsmessage.TypeA, dnsAnswer{"wiki.corp.internal.", "10.1.2.3", 300}),
+		},
+		{
+			name:  "answer for another record type",
+			query: query,
+			resp:  dnsMessage(t, 0x1234, true, dnsmessage.RCodeSuccess, name, dnsmessage.TypeAAAA, answer),
+		},
+		{
+			name:  "query presented as the answer",
+			query: query,
+			resp:  query,
+		},
+		{
+			name:  "a response in place of the query",
+			query: dnsMessage(t, 0x1234, true, dnsmessage.RCodeSuccess, name, dnsmessage.TypeA),
+			resp:  dnsMessage(t, 0x1234, true, dnsmessage.RCodeSuccess, name, dnsmessage.TypeA, answer),
+		},
+		{
+			name:  "failed lookup",
+			query: query,
+			resp:  dnsMessage(t, 0x1234, true, dnsmessage.RCodeServerFailure, name, dnsmessage.TypeA, answer),
+		},
+		{
+			name:  "name outside the patterns",
+			query: dnsMessage(t, 0x1234, false, dnsmessage.RCodeSuccess, "corp.internal.", dnsmessage.TypeA),
+			resp:  dnsMessage(t, 0x1234, true, dnsmessage.RCodeSuccess, "corp.internal.", dnsmessage.TypeA, dnsAnswer{"corp.internal.", "10.1.2.3", 300}),
+		},
+		{
+			name:  "truncated answer",
+			query: query,
+			resp:  dnsMessage(t, 0x1234, true, dnsmessage.RCodeSuccess, name, dnsmessage.TypeA, answer)[:20],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			table := NewFQDNTable()
+			table.SetPatterns([]string{"*.corp.internal"})
+
+			learned := table.LearnFromExchange(tt.query, tt.resp)
+			if learned != (len(tt.want) > 0) {
+				t.Fatalf("LearnFromExchange = %v, want %v", learned, len(tt.want) > 0)
+			}
+			if got := table.Prefixes("*.corp.internal"); len(got) != len(tt.want) || (len(got) > 0 && !reflect.DeepEqual(got, tt.want)) {
+				t.Fatalf("learned %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("no patterns", func(t *testing.T) {
+		table := NewFQDNTable()
+		resp := dnsMessage(t, 0x1234, true, dnsmessage.RCodeSuccess, name, dnsmessage.TypeA, answer)
+		if table.LearnFromExchange(query, resp) {
+			t.Fatal("learned without any patterns")
+		}
+	})
+}
+
+func TestFQDNTableExpiry(t *testing.T) {
+	now := time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC)
+	addr := netip.MustParseAddr("10.1.2.3")
+
+	table := NewFQDNTable()
+	table.SetPatterns([]string{"jira.example.com"})
+	if !table.Learn("jira.example.com.", []netip.Addr{addr}, time.Second, now) {
+		t.Fatal("Learn did not add the address")
+	}
+	if table.Learn("jira.example.com", []netip.Addr{addr}, time.Second, now) {
+		t.Fatal("Learn reported a known address as new")
+	}
+
+	// TTLs are raised to the minimum
+	if table.Expire(now.Add(minFQDNTTL)) || !table.Contains("jira.example.com", addr) {
+		t.Fatal("address expired before the minimum TTL")
+	}
+	if !table.Expire(now.Add(minFQDNTTL+time.Second)) || table.Contains("jira.example.com", addr) {
+		t.Fatal("address did not expire")
+	}
+
+	// Removed patterns lose their addresses
+	table.Learn("jira.example.com", []netip.Addr{addr}, time.Minute, now)
+	table.SetPatterns([]string{"wiki.example.com"})
+	if table.Contains("jira.example.com", addr) {
+		t.Fatal("address kept for a removed pattern")
+	}
+}
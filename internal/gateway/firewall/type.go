@@ -1,5 +1,11 @@
 package firewall
 
+import (
+	"tridorian-ztna/pkg/portrange"
+	"tridorian-ztna/pkg/posture"
+	"tridorian-ztna/pkg/schedule"
+)
+
 type SniResponseType string
 
 type AgentExecutionConfig struct {
@@ -18,6 +24,15 @@ type AgentExecutionConfig struct {
 
 	ConditionalAccessDefaultPolicies ConditionalAccessDefaultPolicies `json:"conditional_access_default_policies"`
 	ConditionalAccessPolicies        []ConditionalAccessPolicy        `json:"conditional_access_policies"`
+
+	// Device IDs an administrator has blocked; their sessions are refused.
+	BlockedDeviceIDs []string `json:"blocked_device_ids"`
+
+	// Users the directory deprovisioned; their sessions are refused.
+	RevokedUserEmails []string `json:"revoked_user_emails"`
+
+	// Sessions an administrator ended: email to the Unix time of the revocation.
+	RevokedSessions map[string]int64 `json:"revoked_sessions"`
 }
 
 type ConditionalAccessDefaultPolicies struct {
@@ -46,4 +61,13 @@ type ConditionalAccessPolicy struct {
 
 	// Action: "ALLOW", "DENY", "LOG"
 	Action string `gorm:"size:20;not null"`
+
+	// Schedule: the rule only applies while all time conditions hold
+	TimeConditions []schedule.Condition `gorm:"-"`
+
+	// Posture: the rule only applies to sessions whose device report satisfies all conditions
+	DeviceConditions []posture.Condition `gorm:"-"`
+
+	// Ports: the rule only applies to these destination ports; empty = all
+	Ports []portrange.Range `gorm:"-"`
 }
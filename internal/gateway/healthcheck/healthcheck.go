@@ -0,0 +1,124 @@
+package healthcheck
+
+import (
+	"context"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+// probeTimeout bounds a single TCP connect.
+const probeTimeout = 3 * time.Second
+
+// Result is the outcome of the latest probe of an application.
+type Result struct {
+	ApplicationID string
+	Healthy       bool
+	Latency       time.Duration
+	Error         string
+	CheckedAt     time.Time
+}
+
+// Prober periodically connects to the health check target of each
+// application and keeps the latest result for the heartbeat.
+type Prober struct {
+	mu      sync.RWMutex
+	targets map[string]string // application ID -> host:port
+	results map[string]Result
+}
+
+func NewProber() *Prober {
+	return &Prober{
+		targets: make(map[string]string),
+		results: make(map[string]Result),
+	}
+}
+
+// SetTargets replaces the probed applications and drops results of removed ones.
+func (p *Prober) SetTargets(targets map[string]string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id := range p.results {
+		if targets[id] != p.targets[id] {
+			delete(p.results, id)
+		}
+	}
+	p.targets = targets
+}
+
+// Results returns the latest results sorted by application ID.
+func (p *Prober) Results() []Result {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	results := make([]Result, 0, len(p.results))
+	for _, r := range p.results {
+		results = append(results, r)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].ApplicationID < results[j].ApplicationID
+	})
+	return results
+}
+
+// Run probes every target at the interval until ctx is cancelled.
+func (p *Prober) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.probeAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *Prober) probeAll(ctx context.Context) {
+	p.mu.RLock()
+	targets := p.targets
+	p.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for id, target := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result := probe(ctx, id, target)
+			if !result.Healthy {
+				log.Printf("🩺 Health check for application %s (%s) failed: %s", id, target, result.Error)
+			}
+
+			p.mu.Lock()
+			// Skip the result if the target changed while probing
+			if p.targets[id] == target {
+				p.results[id] = result
+			}
+			p.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+func probe(ctx context.Context, id, target string) Result {
+	start := time.Now()
+	dialer := net.Dialer{Timeout: probeTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", target)
+	result := Result{
+		ApplicationID: id,
+		Latency:       time.Since(start),
+		CheckedAt:     start,
+	}
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	conn.Close()
+	result.Healthy = true
+	return result
+}
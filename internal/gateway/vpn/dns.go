@@ -0,0 +1,237 @@
+package vpn
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
+	"tridorian-ztna/internal/gateway/firewall"
+	"tridorian-ztna/pkg/fqdn"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DNSConfig is the tenant's split DNS configuration.
+type DNSConfig struct {
+	Domains        []string
+	Resolvers      []string
+	SearchSuffixes []string
+}
+
+// DNSSettings is sent to clients in the handshake so they route queries for
+// the internal domains to the gateway's forwarder.
+type DNSSettings struct {
+	Servers        []string `json:"servers"`
+	Domains        []string `json:"domains"`
+	SearchSuffixes []string `json:"search_suffixes,omitempty"`
+}
+
+// UpdateDNS replaces the split DNS configuration used by the forwarder and
+// announced to newly connecting clients.
+func (s *Server) UpdateDNS(cfg *DNSConfig) {
+	s.dnsConfig.Store(cfg)
+}
+
+// dnsSettings returns the settings for the handshake, or nil if split DNS is off.
+func (s *Server) dnsSettings() *DNSSettings {
+	cfg := s.dnsConfig.Load()
+	if cfg == nil || len(cfg.Domains) == 0 {
+		return nil
+	}
+	gwIP, _, _ := strings.Cut(s.GetHostIPAddress(), "/")
+	if gwIP == "" {
+		return nil
+	}
+	return &DNSSettings{
+		Servers:        []string{gwIP},
+		Domains:        cfg.Domains,
+		SearchSuffixes: cfg.SearchSuffixes,
+	}
+}
+
+// maxDNSQueries limits the queries the forwarder handles at once. Queries
+// beyond it are dropped, and clients retry them.
+const maxDNSQueries = 256
+
+// runDNSForwarder listens on the tun address once UpdateConfig has set it,
+// until ctx ends. Binding is retried because the tun may still be coming up.
+func (s *Server) runDNSForwarder(ctx context.Context) {
+	var addr string
+	select {
+	case hostIP := <-s.dnsAddr:
+		addr = net.JoinHostPort(hostIP, "53")
+	case <-ctx.Done():
+		return
+	}
+	for {
+		conn, err := net.ListenPacket("udp4", addr)
+		if err == nil {
+			log.Printf("🔎 DNS forwarder listening on %s", addr)
+			s.serveDNS(ctx, conn)
+			return
+		}
+		log.Printf("⚠️ DNS forwarder bind on %s failed, retrying: %v", addr, err)
+		select {
+		case <-time.After(5 * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// serveDNS answers queries on conn until ctx ends, which closes it.
+func (s *Server) serveDNS(ctx context.Context, conn net.PacketConn) {
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	queries := make(chan struct{}, maxDNSQueries)
+	buf := make([]byte, 1500)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("DNS forwarder stopped: %v", err)
+			}
+			return
+		}
+		select {
+		case queries <- struct{}{}:
+		default:
+			continue
+		}
+		query := append([]byte(nil), buf[:n]...)
+		go func() {
+			defer func() { <-queries }()
+			s.handleDNSQuery(conn, from, query)
+		}()
+	}
+}
+
+// handleDNSQuery answers a query from a tunnel client. Only names under the
+// tenant's internal domains are forwarded, and FQDN policies of the querying
+// user are applied before the upstream resolver is asked.
+func (s *Server) handleDNSQuery(conn net.PacketConn, from net.Addr, query []byte) {
+	var p dnsmessage.Parser
+	hdr, err := p.Start(query)
+	if err != nil {
+		return
+	}
+	q, err := p.Question()
+	if err != nil {
+		return
+	}
+	name := fqdn.Normalize(q.Name.String())
+
+	udpAddr, ok := from.(*net.UDPAddr)
+	if !ok {
+		return
+	}
+	sessionVal, ok := s.ClientConns.Load(udpAddr.IP.String())
+	if !ok {
+		s.replyDNS(conn, from, hdr, q, dnsmessage.RCodeRefused)
+		return
+	}
+	session := sessionVal.(*ClientSession)
+
+	cfg := s.dnsConfig.Load()
+	if cfg == nil || !inDomains(cfg.Domains, name) {
+		s.replyDNS(conn, from, hdr, q, dnsmessage.RCodeRefused)
+		return
+	}
+
+	if engine := firewall.Engine; engine != nil && !engine.IsNameAllowed(firewall.ValType{
+		Identity: session.Email,
+		Groups:   session.Groups,
+		OS:       session.OS,
+		Posture:  session.Posture(),
+	}, name) {
+		s.replyDNS(conn, from, hdr, q, dnsmessage.RCodeRefused)
+		return
+	}
+
+	for _, resolver := range cfg.Resolvers {
+		resp, err := exchangeDNS(resolver, query)
+		if err != nil {
+			log.Printf("⚠️ DNS upstream %s failed for %s: %v", resolver, name, err)
+			continue
+		}
+		// FQDN addresses are learned from the gateway's own exchange only.
+		// The client gets its new routes before it sees the answer, and
+		// everyone else is updated after.
+		if firewall.FQDNs.LearnFromExchange(query, resp) {
+			s.sendRouteUpdate(session)
+			select {
+			case s.fqdnLearned <- struct{}{}:
+			default:
+			}
+		}
+		conn.WriteTo(resp, from)
+		return
+	}
+
+	s.replyDNS(conn, from, hdr, q, dnsmessage.RCodeServerFailure)
+}
+
+func (s *Server) replyDNS(conn net.PacketConn, to net.Addr, hdr dnsmessage.Header, q dnsmessage.Question, rcode dnsmessage.RCode) {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               hdr.ID,
+			Response:         true,
+			RecursionDesired: hdr.RecursionDesired,
+			RCode:            rcode,
+		},
+		Questions: []dnsmessage.Question{q},
+	}
+	if resp, err := msg.Pack(); err == nil {
+		conn.WriteTo(resp, to)
+	}
+}
+
+// exchangeDNS forwards a raw query to an upstream resolver ("ip" or "ip:port").
+func exchangeDNS(resolver string, query []byte) ([]byte, error) {
+	addr := resolver
+	if _, err := netip.ParseAddr(resolver); err == nil {
+		addr = net.JoinHostPort(resolver, "53")
+	}
+
+	conn, err := net.DialTimeout("udp", addr, 2*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf[:n], nil
+}
+
+// inDomains reports whether name is one of the domains or below one of them.
+func inDomains(domains []string, name string) bool {
+	for _, d := range domains {
+		if name == d || strings.HasSuffix(name, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGatewayDNS reports whether a client packet is a DNS query to the gateway's forwarder.
+func isGatewayDNS(packet []byte, dst, gw netip.Addr) bool {
+	if dst != gw || len(packet) < 28 || packet[9] != 17 {
+		return false
+	}
+	ihl := int(packet[0]&0x0F) * 4
+	return len(packet) >= ihl+4 && packet[ihl+2] == 0 && packet[ihl+3] == 53
+}
@@ -0,0 +1,59 @@
+package vpn
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestServeDNS(t *testing.T) {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen on UDP: %v", err)
+	}
+	s := NewServer(":0")
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.serveDNS(ctx, conn)
+		close(stopped)
+	}()
+
+	client, err := net.Dial("udp4", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: 0x1234},
+		Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName("git.corp.internal."), Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET}},
+	}
+	data, _ := query.Pack()
+	if _, err := client.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 512)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("no answer: %v", err)
+	}
+	var resp dnsmessage.Message
+	if err := resp.Unpack(buf[:n]); err != nil || resp.ID != 0x1234 || resp.RCode != dnsmessage.RCodeRefused {
+		t.Fatalf("answer to a query from outside the tunnel = %+v, %v; want refused", resp.Header, err)
+	}
+
+	// Shutting down closes the socket and ends the read loop
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("serveDNS still running after its context ended")
+	}
+	if _, _, err := conn.ReadFrom(buf); err == nil {
+		t.Fatal("socket still open")
+	}
+}
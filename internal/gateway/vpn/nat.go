@@ -0,0 +1,114 @@
+package vpn
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"slices"
+
+	"tridorian-ztna/pkg/snat"
+)
+
+const (
+	natTable = "tridorian_nat"
+	natChain = "postrouting"
+)
+
+// Egress modes, as set on the node.
+const (
+	EgressMasquerade = "masquerade"
+	EgressRouted     = "routed"
+	EgressSNAT       = "snat"
+)
+
+// Egress is how client traffic leaves the gateway for the networks it
+// reaches: masqueraded to the gateway's address, routed with the client
+// addresses, or translated to a source per destination.
+type Egress struct {
+	Mode string
+	SNAT []SNATPool
+}
+
+// SNATPool translates client traffic to Destination to Source, an address,
+// a CIDR or a "first-last" range.
+type SNATPool struct {
+	Destination netip.Prefix
+	Source      string
+}
+
+// UpdateEgress replaces the NAT ruleset with the one for egress, in a single
+// nft transaction, so it is the same after any number of restarts. It is
+// only applied when it changed or the table is gone.
+func (s *Server) UpdateEgress(egress Egress) error {
+	return s.Network.SetEgress(egress)
+}
+
+// natRuleset builds the nft JSON ruleset for egress. The table is created,
+// deleted and created again, which replaces it whether it existed or not.
+// Every rule matches traffic from the tunnel interface leaving through
+// another one: the gateway's clients and the peers' relayed to it. SNAT
+// pools are matched most specific destination first, whatever their order.
+func natRuleset(egress Egress) ([]byte, error) {
+	table := map[string]any{"family": "ip", "name": natTable}
+	commands := []map[string]any{
+		{"add": map[string]any{"table": table}},
+		{"delete": map[string]any{"table": table}},
+		{"add": map[string]any{"table": table}},
+		{"add": map[string]any{"chain": map[string]any{
+			"family": "ip", "table": natTable, "name": natChain,
+			"type": "nat", "hook": "postrouting", "prio": 100, "policy": "accept",
+		}}},
+	}
+	rule := func(expr ...any) {
+		commands = append(commands, map[string]any{"add": map[string]any{"rule": map[string]any{
+			"family": "ip", "table": natTable, "chain": natChain,
+			"expr": append([]any{
+				nftMatch("==", map[string]any{"meta": map[string]any{"key": "iifname"}}, VPNInterface),
+				nftMatch("!=", map[string]any{"meta": map[string]any{"key": "oifname"}}, VPNInterface),
+			}, expr...),
+		}}})
+	}
+
+	switch egress.Mode {
+	case "", EgressMasquerade:
+		rule(map[string]any{"masquerade": nil})
+	case EgressRouted:
+		// No translation: the network routes the client addresses back
+	case EgressSNAT:
+		pools := slices.Clone(egress.SNAT)
+		slices.SortStableFunc(pools, func(a, b SNATPool) int { return b.Destination.Bits() - a.Destination.Bits() })
+		for _, p := range pools {
+			addr, err := snatAddr(p.Source)
+			if err != nil {
+				return nil, fmt.Errorf("SNAT pool for %s: %v", p.Destination, err)
+			}
+			rule(
+				nftMatch("==", map[string]any{"payload": map[string]any{"protocol": "ip", "field": "daddr"}},
+					map[string]any{"prefix": map[string]any{"addr": p.Destination.Addr().String(), "len": p.Destination.Bits()}}),
+				map[string]any{"snat": map[string]any{"addr": addr}},
+			)
+		}
+		rule(map[string]any{"masquerade": nil})
+	default:
+		return nil, fmt.Errorf("unknown egress mode %q", egress.Mode)
+	}
+
+	return json.Marshal(map[string]any{"nftables": commands})
+}
+
+func nftMatch(op string, left, right any) map[string]any {
+	return map[string]any{"match": map[string]any{"op": op, "left": left, "right": right}}
+}
+
+// snatAddr converts an SNAT source to an nft address: a single address or
+// a range.
+func snatAddr(source string) (any, error) {
+	s, err := snat.ParseSource(source)
+	if err != nil {
+		return nil, err
+	}
+	if s.Single() {
+		return s.First.String(), nil
+	}
+	return map[string]any{"range": []string{s.First.String(), s.Last.String()}}, nil
+}
@@ -0,0 +1,129 @@
+package vpn
+
+import (
+	"encoding/json"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSNATAddr(t *testing.T) {
+	tests := []struct {
+		source  string
+		want    string // JSON of the nft address
+		wantErr bool
+	}{
+		{source: "203.0.113.10", want: `"203.0.113.10"`},
+		{source: "203.0.113.10-203.0.113.20", want: `{"range":["203.0.113.10","203.0.113.20"]}`},
+		{source: "203.0.113.10-203.0.113.10", want: `"203.0.113.10"`},
+		{source: "203.0.113.0/28", want: `{"range":["203.0.113.0","203.0.113.15"]}`},
+		{source: "203.0.113.10/32", want: `"203.0.113.10"`},
+
+		{source: "gateway.example.com", wantErr: true},
+		{source: "203.0.113.20-203.0.113.10", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			addr, err := snatAddr(tt.source)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("snatAddr(%q) = %v, want an error", tt.source, addr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("snatAddr(%q): %v", tt.source, err)
+			}
+			got, _ := json.Marshal(addr)
+			if string(got) != tt.want {
+				t.Fatalf("snatAddr(%q) = %s, want %s", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNATRuleset(t *testing.T) {
+	const (
+		table    = `{"add":{"table":{"family":"ip","name":"tridorian_nat"}}},{"delete":{"table":{"family":"ip","name":"tridorian_nat"}}},{"add":{"table":{"family":"ip","name":"tridorian_nat"}}}`
+		chain    = `{"add":{"chain":{"family":"ip","table":"tridorian_nat","name":"postrouting","type":"nat","hook":"postrouting","prio":100,"policy":"accept"}}}`
+		fromTun  = `{"match":{"op":"==","left":{"meta":{"key":"iifname"}},"right":"tun0"}},{"match":{"op":"!=","left":{"meta":{"key":"oifname"}},"right":"tun0"}}`
+		ruleHead = `{"add":{"rule":{"family":"ip","table":"tridorian_nat","chain":"postrouting","expr":[` + fromTun
+		masq     = ruleHead + `,{"masquerade":null}]}}}`
+	)
+	snatRule := func(dst, bits, addr string) string {
+		return ruleHead + `,{"match":{"op":"==","left":{"payload":{"protocol":"ip","field":"daddr"}},"right":{"prefix":{"addr":"` + dst + `","len":` + bits + `}}}},{"snat":{"addr":` + addr + `}}]}}}`
+	}
+
+	tests := []struct {
+		name    string
+		egress  Egress
+		want    []string // commands after the table and chain
+		wantErr string
+	}{
+		{name: "default masquerades", egress: Egress{}, want: []string{masq}},
+		{name: "masquerade", egress: Egress{Mode: EgressMasquerade}, want: []string{masq}},
+		{name: "routed has no rules", egress: Egress{Mode: EgressRouted, SNAT: []SNATPool{{Destination: netip.MustParsePrefix("10.0.0.0/8"), Source: "203.0.113.10"}}}},
+		{
+			name: "SNAT pools, then masquerade",
+			egress: Egress{Mode: EgressSNAT, SNAT: []SNATPool{
+				{Destination: netip.MustParsePrefix("10.20.0.0/16"), Source: "203.0.113.10"},
+				{Destination: netip.MustParsePrefix("10.0.0.0/8"), Source: "203.0.113.0/30"},
+			}},
+			want: []string{
+				snatRule("10.20.0.0", "16", `"203.0.113.10"`),
+				snatRule("10.0.0.0", "8", `{"range":["203.0.113.0","203.0.113.3"]}`),
+				masq,
+			},
+		},
+		{
+			name: "SNAT pools most specific first",
+			egress: Egress{Mode: EgressSNAT, SNAT: []SNATPool{
+				{Destination: netip.MustParsePrefix("0.0.0.0/0"), Source: "203.0.113.1"},
+				{Destination: netip.MustParsePrefix("10.0.0.0/8"), Source: "203.0.113.2"},
+				{Destination: netip.MustParsePrefix("10.1.0.0/16"), Source: "203.0.113.3"},
+				{Destination: netip.MustParsePrefix("10.2.0.0/16"), Source: "203.0.113.4"},
+			}},
+			want: []string{
+				snatRule("10.1.0.0", "16", `"203.0.113.3"`),
+				snatRule("10.2.0.0", "16", `"203.0.113.4"`),
+				snatRule("10.0.0.0", "8", `"203.0.113.2"`),
+				snatRule("0.0.0.0", "0", `"203.0.113.1"`),
+				masq,
+			},
+		},
+		{name: "SNAT without pools", egress: Egress{Mode: EgressSNAT}, want: []string{masq}},
+		{
+			name:    "invalid SNAT source",
+			egress:  Egress{Mode: EgressSNAT, SNAT: []SNATPool{{Destination: netip.MustParsePrefix("10.0.0.0/8"), Source: "nat.example.com"}}},
+			wantErr: "SNAT pool for 10.0.0.0/8",
+		},
+		{name: "unknown mode", egress: Egress{Mode: "bridge"}, wantErr: "unknown egress mode"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := natRuleset(tt.egress)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("natRuleset error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("natRuleset: %v", err)
+			}
+
+			want := `{"nftables":[` + strings.Join(append([]string{table, chain}, tt.want...), ",") + `]}`
+			var gotJSON, wantJSON any
+			if err := json.Unmarshal(got, &gotJSON); err != nil {
+				t.Fatalf("ruleset is not JSON: %v", err)
+			}
+			if err := json.Unmarshal([]byte(want), &wantJSON); err != nil {
+				t.Fatalf("expected ruleset is not JSON: %v", err)
+			}
+			if !reflect.DeepEqual(gotJSON, wantJSON) {
+				t.Fatalf("natRuleset =\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
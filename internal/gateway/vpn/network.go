@@ -0,0 +1,453 @@
+package vpn
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VPNMTU is the MTU of the tunnel interface.
+const VPNMTU = 1420
+
+// gatewaySysctls are the kernel settings the gateway needs: forwarding, and
+// buffers and congestion control for many tunnelled flows.
+var gatewaySysctls = map[string]string{
+	"net.core.rmem_max":               "67108864",
+	"net.core.wmem_max":               "67108864",
+	"net.core.rmem_default":           "33554432",
+	"net.core.wmem_default":           "33554432",
+	"net.netfilter.nf_conntrack_max":  "1048576",
+	"net.ipv4.ip_forward":             "1",
+	"net.core.default_qdisc":          "fq",
+	"net.ipv4.tcp_congestion_control": "bbr",
+}
+
+// Network keeps the host's networking the way the gateway needs it: the
+// tunnel interface up with its address and MTU, routes to the peers' client
+// pools, the NAT table and the sysctls. Reconciling only changes what
+// differs, so it can run any number of times, and Teardown undoes it all
+// and restores the sysctls to their values from before the gateway.
+type Network struct {
+	// StatePath, when set, is where the state is saved after every change,
+	// for diagnostics and to keep the original sysctls across crashes.
+	StatePath string
+
+	mu        sync.Mutex
+	address   netip.Prefix // Host address of the tunnel interface, if any
+	routes    []netip.Prefix
+	egress    Egress
+	ruleset   []byte // Last NAT ruleset applied
+	originals map[string]string
+	state     NetworkState
+	down      bool // Torn down; nothing is applied anymore
+}
+
+// NetworkState is what the gateway last found and did, for diagnostics.
+type NetworkState struct {
+	Interface       string            `json:"interface"`
+	Up              bool              `json:"up"`
+	MTU             int               `json:"mtu"`
+	Addresses       []string          `json:"addresses"`
+	Routes          []string          `json:"routes"`
+	EgressMode      string            `json:"egress_mode"`
+	NAT             json.RawMessage   `json:"nat,omitempty"` // nft -j list of the NAT table
+	Sysctls         map[string]string `json:"sysctls"`
+	SysctlOriginals map[string]string `json:"sysctl_originals,omitempty"`
+	ReconciledAt    time.Time         `json:"reconciled_at"`
+	Errors          []string          `json:"errors,omitempty"`
+}
+
+func NewNetwork() *Network {
+	return &Network{egress: Egress{Mode: EgressMasquerade}}
+}
+
+// SetAddress sets the host address of the tunnel interface, e.g.
+// 10.8.0.1/23, or none with the zero prefix, and applies it.
+func (n *Network) SetAddress(address netip.Prefix) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.address = address
+	if n.down {
+		return nil
+	}
+	err := errors.Join(n.reconcileLink(), n.reconcileAddresses())
+	n.save()
+	return err
+}
+
+// SetRoutes sets the subnets routed into the tunnel interface and applies
+// them; the interface must be up for them.
+func (n *Network) SetRoutes(routes []netip.Prefix) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.routes = slices.Clone(routes)
+	if n.down {
+		return nil
+	}
+	err := errors.Join(n.reconcileLink(), n.reconcileRoutes())
+	n.save()
+	return err
+}
+
+// SetEgress sets the NAT for client traffic and applies it.
+func (n *Network) SetEgress(egress Egress) error {
+	if _, err := natRuleset(egress); err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.egress = egress
+	if n.down {
+		return nil
+	}
+	err := n.reconcileNAT()
+	n.save()
+	return err
+}
+
+// Reconcile brings everything back to the desired state, and returns what
+// could not be.
+func (n *Network) Reconcile() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.down {
+		return nil
+	}
+	err := errors.Join(
+		n.reconcileSysctls(),
+		n.reconcileLink(),
+		n.reconcileAddresses(),
+		n.reconcileRoutes(),
+		n.reconcileNAT(),
+	)
+	n.state.ReconciledAt = time.Now()
+	n.state.Errors = nil
+	if err != nil {
+		n.state.Errors = strings.Split(err.Error(), "\n")
+	}
+	n.save()
+	return err
+}
+
+// Watch reconciles every interval, which repairs changes made behind the
+// gateway's back. Errors are logged when they change.
+func (n *Network) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	last := ""
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		err := n.Reconcile()
+		if msg := fmt.Sprint(err); err != nil && msg != last {
+			log.Printf("⚠️ Network reconcile: %v", err)
+			last = msg
+		} else if err == nil {
+			last = ""
+		}
+	}
+}
+
+// State returns the state found by the last change or reconcile.
+func (n *Network) State() NetworkState {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	state := n.state
+	state.Interface = VPNInterface
+	state.EgressMode = n.egress.Mode
+	return state
+}
+
+// Teardown removes the NAT table, routes and address and restores the
+// sysctls the gateway changed. Nothing is applied after it.
+func (n *Network) Teardown() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.down = true
+
+	var errs []error
+	if n.natTableExists() {
+		if err := run("nft", "delete", "table", "ip", natTable); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	n.ruleset = nil
+
+	n.routes, n.address = nil, netip.Prefix{}
+	if linkExists() {
+		errs = append(errs, n.reconcileRoutes(), n.reconcileAddresses())
+	}
+
+	if n.originals == nil {
+		n.originals = n.savedOriginals()
+	}
+	for key, value := range n.originals {
+		if err := writeSysctl(key, value); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(n.originals, key)
+	}
+	n.state = NetworkState{ReconciledAt: time.Now()}
+	n.save()
+	return errors.Join(errs...)
+}
+
+// reconcileSysctls sets the gateway's sysctls, after recording the values
+// they had. Values recorded by a previous run that did not tear down are
+// kept, since the current ones are that run's.
+func (n *Network) reconcileSysctls() error {
+	if n.originals == nil {
+		n.originals = n.savedOriginals()
+	}
+	var errs []error
+	n.state.Sysctls = make(map[string]string, len(gatewaySysctls))
+	for key, want := range gatewaySysctls {
+		current, err := readSysctl(key)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		n.state.Sysctls[key] = current
+		if current == want {
+			continue
+		}
+		if err := writeSysctl(key, want); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, ok := n.originals[key]; !ok {
+			n.originals[key] = current
+		}
+		n.state.Sysctls[key] = want
+	}
+	n.state.SysctlOriginals = n.originals
+	return errors.Join(errs...)
+}
+
+// reconcileLink brings the tunnel interface up with its MTU.
+func (n *Network) reconcileLink() error {
+	var links []struct {
+		MTU   int      `json:"mtu"`
+		Flags []string `json:"flags"`
+	}
+	if err := ipJSON(&links, "link", "show", "dev", VPNInterface); err != nil {
+		return err
+	}
+	if len(links) == 0 {
+		return fmt.Errorf("interface %s not found", VPNInterface)
+	}
+	up := slices.Contains(links[0].Flags, "UP")
+	if !up || links[0].MTU != VPNMTU {
+		if err := run("ip", "link", "set", "dev", VPNInterface, "up", "mtu", fmt.Sprint(VPNMTU)); err != nil {
+			return err
+		}
+	}
+	n.state.Up, n.state.MTU = true, VPNMTU
+	return nil
+}
+
+// reconcileAddresses leaves the host address as the interface's only IPv4
+// address.
+func (n *Network) reconcileAddresses() error {
+	var links []struct {
+		AddrInfo []struct {
+			Family    string `json:"family"`
+			Local     string `json:"local"`
+			PrefixLen int    `json:"prefixlen"`
+		} `json:"addr_info"`
+	}
+	if err := ipJSON(&links, "addr", "show", "dev", VPNInterface); err != nil {
+		return err
+	}
+
+	var errs []error
+	found := false
+	n.state.Addresses = nil
+	for _, link := range links {
+		for _, a := range link.AddrInfo {
+			if a.Family != "inet" {
+				continue
+			}
+			addr := fmt.Sprintf("%s/%d", a.Local, a.PrefixLen)
+			if n.address.IsValid() && addr == n.address.String() {
+				found = true
+				n.state.Addresses = append(n.state.Addresses, addr)
+				continue
+			}
+			if err := run("ip", "addr", "del", addr, "dev", VPNInterface); err != nil {
+				errs = append(errs, err)
+				n.state.Addresses = append(n.state.Addresses, addr)
+			}
+		}
+	}
+	if n.address.IsValid() && !found {
+		if err := run("ip", "addr", "add", n.address.String(), "dev", VPNInterface); err != nil {
+			errs = append(errs, err)
+		} else {
+			n.state.Addresses = append(n.state.Addresses, n.address.String())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reconcileRoutes leaves the desired routes as the only ones into the
+// tunnel interface, besides the kernel's route for its address.
+func (n *Network) reconcileRoutes() error {
+	var routes []struct {
+		Dst      string `json:"dst"`
+		Protocol string `json:"protocol"`
+	}
+	if err := ipJSON(&routes, "route", "show", "dev", VPNInterface); err != nil {
+		return err
+	}
+
+	var errs []error
+	var present []netip.Prefix
+	for _, r := range routes {
+		if r.Protocol == "kernel" {
+			continue
+		}
+		dst := r.Dst
+		if !strings.Contains(dst, "/") {
+			dst += "/32"
+		}
+		prefix, err := netip.ParsePrefix(dst)
+		if err != nil {
+			continue
+		}
+		if slices.Contains(n.routes, prefix) {
+			present = append(present, prefix)
+			continue
+		}
+		if err := run("ip", "route", "del", prefix.String(), "dev", VPNInterface); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	n.state.Routes = nil
+	for _, prefix := range n.routes {
+		if !slices.Contains(present, prefix) {
+			if err := run("ip", "route", "replace", prefix.String(), "dev", VPNInterface); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		n.state.Routes = append(n.state.Routes, prefix.String())
+	}
+	return errors.Join(errs...)
+}
+
+// reconcileNAT applies the egress ruleset when it changed or the table is
+// gone.
+func (n *Network) reconcileNAT() error {
+	ruleset, err := natRuleset(n.egress)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(ruleset, n.ruleset) || !n.natTableExists() {
+		cmd := exec.Command("nft", "-j", "-f", "-")
+		cmd.Stdin = bytes.NewReader(ruleset)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to apply the %s egress ruleset: %v: %s", n.egress.Mode, err, strings.TrimSpace(string(output)))
+		}
+		n.ruleset = ruleset
+	}
+	n.state.NAT, _ = exec.Command("nft", "-j", "list", "table", "ip", natTable).Output()
+	return nil
+}
+
+func (n *Network) natTableExists() bool {
+	return exec.Command("nft", "list", "table", "ip", natTable).Run() == nil
+}
+
+// savedOriginals returns the sysctl values recorded in the state file.
+func (n *Network) savedOriginals() map[string]string {
+	originals := make(map[string]string)
+	if n.StatePath == "" {
+		return originals
+	}
+	data, err := os.ReadFile(n.StatePath)
+	if err != nil {
+		return originals
+	}
+	var saved NetworkState
+	if json.Unmarshal(data, &saved) == nil && saved.SysctlOriginals != nil {
+		originals = saved.SysctlOriginals
+	}
+	return originals
+}
+
+// save writes the state to StatePath.
+func (n *Network) save() {
+	if n.StatePath == "" {
+		return
+	}
+	state := n.state
+	state.Interface = VPNInterface
+	state.EgressMode = n.egress.Mode
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return
+	}
+	tmp := n.StatePath + ".tmp"
+	if err := os.MkdirAll(filepath.Dir(n.StatePath), 0700); err != nil {
+		return
+	}
+	if err := os.WriteFile(tmp, data, 0600); err == nil {
+		os.Rename(tmp, n.StatePath)
+	}
+}
+
+func linkExists() bool {
+	return exec.Command("ip", "link", "show", "dev", VPNInterface).Run() == nil
+}
+
+func sysctlPath(key string) string {
+	return "/proc/sys/" + strings.ReplaceAll(key, ".", "/")
+}
+
+func readSysctl(key string) (string, error) {
+	data, err := os.ReadFile(sysctlPath(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", key, err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func writeSysctl(key, value string) error {
+	if err := os.WriteFile(sysctlPath(key), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to set %s: %v", key, err)
+	}
+	return nil
+}
+
+// run runs a command, with its output in the error.
+func run(name string, args ...string) error {
+	if output, err := exec.Command(name, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// ipJSON runs an ip command with JSON output and decodes it into v.
+func ipJSON(v any, args ...string) error {
+	output, err := exec.Command("ip", append([]string{"-j"}, args...)...).Output()
+	if err != nil {
+		return fmt.Errorf("ip %s: %v", strings.Join(args, " "), err)
+	}
+	return json.Unmarshal(output, v)
+}
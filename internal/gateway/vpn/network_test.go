@@ -0,0 +1,212 @@
+package vpn
+
+import (
+	"net/netip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"syscall"
+	"testing"
+)
+
+// inNetns moves the test's goroutine into a network namespace of its own,
+// with a tunnel interface, so Network can change it freely. The goroutine
+// stays locked to its thread, which exits with it and takes the namespace
+// along. Tests are skipped where namespaces cannot be created.
+func inNetns(t *testing.T) {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to create a network namespace")
+	}
+	if _, err := exec.LookPath("ip"); err != nil {
+		t.Skip("ip is not installed")
+	}
+	runtime.LockOSThread()
+	if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
+		t.Skipf("cannot create a network namespace: %v", err)
+	}
+	if err := run("ip", "link", "set", "dev", "lo", "up"); err != nil {
+		t.Fatal(err)
+	}
+	if err := run("ip", "tuntap", "add", "dev", VPNInterface, "mode", "tun"); err != nil {
+		t.Skipf("cannot create %s: %v", VPNInterface, err)
+	}
+
+	// Only forwarding is per namespace; the other settings would change
+	// the host's. New namespaces may inherit the host's forwarding.
+	if err := writeSysctl("net.ipv4.ip_forward", "0"); err != nil {
+		t.Fatal(err)
+	}
+	saved := gatewaySysctls
+	gatewaySysctls = map[string]string{"net.ipv4.ip_forward": "1"}
+	t.Cleanup(func() { gatewaySysctls = saved })
+}
+
+type linkState struct {
+	up        bool
+	mtu       int
+	addresses []string
+	routes    []string
+}
+
+func currentLink(t *testing.T) linkState {
+	t.Helper()
+	var links []struct {
+		MTU      int      `json:"mtu"`
+		Flags    []string `json:"flags"`
+		AddrInfo []struct {
+			Family    string `json:"family"`
+			Local     string `json:"local"`
+			PrefixLen int    `json:"prefixlen"`
+		} `json:"addr_info"`
+	}
+	if err := ipJSON(&links, "addr", "show", "dev", VPNInterface); err != nil || len(links) != 1 {
+		t.Fatalf("ip addr show: %v", err)
+	}
+	var routes []struct {
+		Dst      string `json:"dst"`
+		Protocol string `json:"protocol"`
+	}
+	if err := ipJSON(&routes, "route", "show", "dev", VPNInterface); err != nil {
+		t.Fatalf("ip route show: %v", err)
+	}
+
+	s := linkState{up: slices.Contains(links[0].Flags, "UP"), mtu: links[0].MTU}
+	for _, a := range links[0].AddrInfo {
+		if a.Family == "inet" {
+			s.addresses = append(s.addresses, netip.PrefixFrom(netip.MustParseAddr(a.Local), a.PrefixLen).String())
+		}
+	}
+	for _, r := range routes {
+		if r.Protocol != "kernel" {
+			s.routes = append(s.routes, r.Dst)
+		}
+	}
+	slices.Sort(s.routes)
+	return s
+}
+
+// reconcileLinkState runs the parts of Reconcile that a namespace without
+// nft supports, and saves the state like Reconcile.
+func reconcileLinkState(t *testing.T, n *Network) {
+	t.Helper()
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, reconcile := range []func() error{n.reconcileSysctls, n.reconcileLink, n.reconcileAddresses, n.reconcileRoutes} {
+		if err := reconcile(); err != nil {
+			t.Fatalf("reconcile: %v", err)
+		}
+	}
+	n.save()
+}
+
+func TestNetworkReconcile(t *testing.T) {
+	inNetns(t)
+
+	n := NewNetwork()
+	if err := n.SetAddress(netip.MustParsePrefix("10.8.0.1/23")); err != nil {
+		t.Fatalf("SetAddress: %v", err)
+	}
+	if err := n.SetRoutes([]netip.Prefix{netip.MustParsePrefix("10.9.0.0/23"), netip.MustParsePrefix("10.10.0.0/23")}); err != nil {
+		t.Fatalf("SetRoutes: %v", err)
+	}
+	want := linkState{up: true, mtu: VPNMTU, addresses: []string{"10.8.0.1/23"}, routes: []string{"10.10.0.0/23", "10.9.0.0/23"}}
+
+	tests := []struct {
+		name  string
+		drift [][]string // ip commands run behind the gateway's back
+	}{
+		{name: "nothing changed"},
+		{name: "interface down", drift: [][]string{{"link", "set", "dev", VPNInterface, "down"}}},
+		{name: "MTU changed", drift: [][]string{{"link", "set", "dev", VPNInterface, "mtu", "1500"}}},
+		{name: "address removed", drift: [][]string{{"addr", "flush", "dev", VPNInterface}}},
+		{
+			name:  "address replaced",
+			drift: [][]string{{"addr", "flush", "dev", VPNInterface}, {"addr", "add", "10.99.0.1/24", "dev", VPNInterface}},
+		},
+		{name: "extra address", drift: [][]string{{"addr", "add", "10.99.0.1/24", "dev", VPNInterface}}},
+		{name: "route removed", drift: [][]string{{"route", "del", "10.9.0.0/23", "dev", VPNInterface}}},
+		{name: "extra route", drift: [][]string{{"route", "add", "192.0.2.0/24", "dev", VPNInterface}, {"route", "add", "198.51.100.7", "dev", VPNInterface}}},
+	}
+	for _, tt := range tests {
+		for _, args := range tt.drift {
+			if err := run("ip", args...); err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+		}
+		reconcileLinkState(t, n)
+		if got := currentLink(t); !slices.Equal(got.addresses, want.addresses) || !slices.Equal(got.routes, want.routes) ||
+			got.up != want.up || got.mtu != want.mtu {
+			t.Fatalf("%s: link is %+v after reconcile, want %+v", tt.name, got, want)
+		}
+	}
+
+	// Changing the desired state replaces what was applied
+	if err := n.SetAddress(netip.MustParsePrefix("10.8.2.1/23")); err != nil {
+		t.Fatalf("SetAddress: %v", err)
+	}
+	if err := n.SetRoutes([]netip.Prefix{netip.MustParsePrefix("10.10.0.0/23")}); err != nil {
+		t.Fatalf("SetRoutes: %v", err)
+	}
+	if got := currentLink(t); !slices.Equal(got.addresses, []string{"10.8.2.1/23"}) || !slices.Equal(got.routes, []string{"10.10.0.0/23"}) {
+		t.Fatalf("link is %+v after the change", got)
+	}
+	state := n.State()
+	if !slices.Equal(state.Addresses, []string{"10.8.2.1/23"}) || !slices.Equal(state.Routes, []string{"10.10.0.0/23"}) || !state.Up {
+		t.Fatalf("state %+v does not match the link", state)
+	}
+}
+
+func TestNetworkTeardown(t *testing.T) {
+	inNetns(t)
+	statePath := filepath.Join(t.TempDir(), "network.json")
+
+	n := NewNetwork()
+	n.StatePath = statePath
+	n.SetAddress(netip.MustParsePrefix("10.8.0.1/23"))
+	n.SetRoutes([]netip.Prefix{netip.MustParsePrefix("10.9.0.0/23")})
+	reconcileLinkState(t, n)
+	if v, _ := readSysctl("net.ipv4.ip_forward"); v != "1" {
+		t.Fatalf("ip_forward = %s after reconcile, want 1", v)
+	}
+
+	// A gateway that crashed and starts again finds forwarding on; the
+	// value to restore is still the one from before the first run.
+	restarted := NewNetwork()
+	restarted.StatePath = statePath
+	reconcileLinkState(t, restarted)
+	if got := restarted.State().SysctlOriginals["net.ipv4.ip_forward"]; got != "0" {
+		t.Fatalf("original ip_forward after a restart = %q, want 0", got)
+	}
+
+	if err := restarted.Teardown(); err != nil {
+		t.Fatalf("Teardown: %v", err)
+	}
+	if got := currentLink(t); len(got.addresses) != 0 || len(got.routes) != 0 {
+		t.Fatalf("link is %+v after teardown", got)
+	}
+	if v, _ := readSysctl("net.ipv4.ip_forward"); v != "0" {
+		t.Fatalf("ip_forward = %s after teardown, want 0", v)
+	}
+	if len(restarted.savedOriginals()) != 0 {
+		t.Fatal("state file still records sysctls to restore")
+	}
+
+	// Nothing is applied after teardown
+	if err := restarted.SetAddress(netip.MustParsePrefix("10.8.0.1/23")); err != nil {
+		t.Fatalf("SetAddress after teardown: %v", err)
+	}
+	if err := restarted.Reconcile(); err != nil {
+		t.Fatalf("Reconcile after teardown: %v", err)
+	}
+	if got := currentLink(t); len(got.addresses) != 0 {
+		t.Fatalf("address applied after teardown: %+v", got)
+	}
+
+	// A second teardown has nothing left to do
+	if err := restarted.Teardown(); err != nil {
+		t.Fatalf("second Teardown: %v", err)
+	}
+}
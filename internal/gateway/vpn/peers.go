@@ -0,0 +1,357 @@
+package vpn
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/netip"
+	"slices"
+	"sort"
+	"time"
+
+	"tridorian-ztna/pkg/pki"
+
+	quic "github.com/quic-go/quic-go"
+	"github.com/songgao/water"
+)
+
+// peerProtocol is the ALPN of the tunnel between gateways.
+const peerProtocol = "tridorian-peer"
+
+// Peer is another gateway of the tenant. Client traffic to its routes is
+// relayed to it, and it sends back the replies to its own clients.
+type Peer struct {
+	NodeID     string
+	Address    string
+	Routes     []netip.Prefix
+	ClientPool netip.Prefix
+	CertSerial string // Serial of its current certificate, as pki.SerialHex
+}
+
+// peerRoute is one relayed subnet; routes are kept longest prefix first.
+type peerRoute struct {
+	prefix netip.Prefix
+	peer   *Peer
+}
+
+type peerTable struct {
+	byID   map[string]*Peer
+	routes []peerRoute
+}
+
+// lookup returns the peer serving addr, by longest prefix match.
+func (t *peerTable) lookup(addr netip.Addr) *Peer {
+	if t == nil {
+		return nil
+	}
+	for _, r := range t.routes {
+		if r.prefix.Contains(addr) {
+			return r.peer
+		}
+	}
+	return nil
+}
+
+// poolOwner returns the peer whose clients get addr.
+func (t *peerTable) poolOwner(addr netip.Addr) *Peer {
+	if t == nil {
+		return nil
+	}
+	for _, p := range t.byID {
+		if p.ClientPool.IsValid() && p.ClientPool.Contains(addr) {
+			return p
+		}
+	}
+	return nil
+}
+
+// StartPeering listens for the tunnels of the tenant's other gateways. Both
+// ends authenticate with their node certificates, issued by ca, and only
+// gateways in the current peer list are accepted. A connector listens for
+// none and keeps its own tunnels to its peers open instead.
+func (s *Server) StartPeering(ctx context.Context, addr string, cert func() *tls.Certificate, ca *x509.Certificate) error {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	s.peerRoots = roots
+	s.peerCert = cert
+
+	if s.Connector {
+		go s.keepPeerLinks(ctx, 10*time.Second)
+		return nil
+	}
+
+	listener, err := quic.ListenAddr(addr, &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		NextProtos: []string{peerProtocol},
+		ClientAuth: tls.RequireAnyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return cert(), nil
+		},
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, err := s.verifyPeer(rawCerts, "")
+			return err
+		},
+	}, s.peerQUICConfig())
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", addr, err)
+	}
+	log.Printf("🔗 Peer tunnel listening on %s", addr)
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	go func() {
+		for {
+			conn, err := listener.Accept(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					log.Printf("Peer Accept Error: %v", err)
+				}
+				return
+			}
+			nodeID := conn.ConnectionState().TLS.PeerCertificates[0].Subject.CommonName
+			log.Printf("🔗 Peer %s connected from %s", nodeID, conn.RemoteAddr())
+			s.peerLinks.Store(nodeID, conn)
+			go s.servePeer(nodeID, conn)
+		}
+	}()
+	return nil
+}
+
+// keepPeerLinks opens the tunnels to the peers that have none, on start and
+// then every interval, so they can relay to the connector's subnets.
+func (s *Server) keepPeerLinks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if table := s.peers.Load(); table != nil {
+			for _, peer := range table.byID {
+				if _, ok := s.peerLinks.Load(peer.NodeID); ok {
+					continue
+				}
+				if _, dialing := s.peerDials.LoadOrStore(peer.NodeID, struct{}{}); !dialing {
+					go s.dialPeer(peer)
+				}
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) peerQUICConfig() *quic.Config {
+	return &quic.Config{
+		EnableDatagrams: true,
+		MaxIdleTimeout:  30 * time.Second,
+		KeepAlivePeriod: 10 * time.Second,
+	}
+}
+
+// verifyPeer checks that a peer's certificate was issued by the gateway CA
+// to a gateway in the peer list, or to nodeID when it is set, and is that
+// gateway's current one, and returns the peer's node ID. A certificate that
+// was renewed or belongs to a reset enrollment still verifies against the
+// CA, so only the serial revokes it.
+func (s *Server) verifyPeer(rawCerts [][]byte, nodeID string) (string, error) {
+	if len(rawCerts) == 0 || s.peerRoots == nil {
+		return "", errors.New("no peer certificate")
+	}
+	leaf, err := x509.ParseCertificate(rawCerts[0])
+	if err != nil {
+		return "", err
+	}
+	// Node certificates are issued for client authentication; here they
+	// authenticate both ends
+	if _, err := leaf.Verify(x509.VerifyOptions{
+		Roots:     s.peerRoots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return "", err
+	}
+	id := leaf.Subject.CommonName
+	if nodeID != "" && id != nodeID {
+		return "", fmt.Errorf("peer certificate is for %s, not %s", id, nodeID)
+	}
+	var peer *Peer
+	if table := s.peers.Load(); table != nil {
+		peer = table.byID[id]
+	}
+	if peer == nil {
+		return "", fmt.Errorf("%s is not a peer of this gateway", id)
+	}
+	if peer.CertSerial == "" || pki.SerialHex(leaf) != peer.CertSerial {
+		return "", fmt.Errorf("certificate of %s has been replaced or revoked", id)
+	}
+	return id, nil
+}
+
+// UpdatePeers replaces the peer list. Tunnels to gateways no longer in it,
+// or opened with a certificate they no longer hold, are closed, and the
+// peers' client pools are routed into the tunnel interface so replies to
+// their clients reach the relay.
+func (s *Server) UpdatePeers(peers []Peer) {
+	table := &peerTable{byID: make(map[string]*Peer, len(peers))}
+	for i := range peers {
+		p := &peers[i]
+		table.byID[p.NodeID] = p
+		for _, prefix := range p.Routes {
+			table.routes = append(table.routes, peerRoute{prefix: prefix, peer: p})
+		}
+	}
+	sort.SliceStable(table.routes, func(i, j int) bool {
+		return table.routes[i].prefix.Bits() > table.routes[j].prefix.Bits()
+	})
+	s.peers.Store(table)
+
+	s.peerLinks.Range(func(key, value any) bool {
+		conn := value.(*quic.Conn)
+		peer := table.byID[key.(string)]
+		if peer == nil {
+			conn.CloseWithError(0, "Peer Removed")
+			s.peerLinks.Delete(key)
+		} else if certs := conn.ConnectionState().TLS.PeerCertificates; len(certs) == 0 || pki.SerialHex(certs[0]) != peer.CertSerial {
+			conn.CloseWithError(0, "Peer Certificate Replaced")
+			s.peerLinks.Delete(key)
+		}
+		return true
+	})
+
+	s.routePeerPools(peers)
+}
+
+// routePeerPools keeps a route into the tunnel interface for each peer
+// client pool outside this gateway's own.
+func (s *Server) routePeerPools(peers []Peer) {
+	var own netip.Prefix
+	s.mu.RLock()
+	if s.Config != nil {
+		own, _ = netip.ParsePrefix(s.Config.VPNCIDR)
+	}
+	s.mu.RUnlock()
+
+	var pools []netip.Prefix
+	for _, p := range peers {
+		pool := p.ClientPool
+		if !pool.IsValid() || slices.Contains(pools, pool) || (own.IsValid() && own.Bits() <= pool.Bits() && own.Contains(pool.Addr())) {
+			continue
+		}
+		pools = append(pools, pool)
+	}
+	if err := s.Network.SetRoutes(pools); err != nil {
+		log.Printf("⚠️ Failed to route peer pools: %v", err)
+	}
+}
+
+// relay sends a client packet to the peer serving its destination. Without
+// a tunnel yet, one is opened and the packet is dropped; the client's
+// transport retries. Connectors open theirs, so until one has, its packets
+// are dropped.
+func (s *Server) relay(peer *Peer, packet []byte) {
+	if conn, ok := s.peerLinks.Load(peer.NodeID); ok {
+		conn.(*quic.Conn).SendDatagram(packet)
+		return
+	}
+	if peer.Address == "" {
+		return
+	}
+	if _, dialing := s.peerDials.LoadOrStore(peer.NodeID, struct{}{}); !dialing {
+		go s.dialPeer(peer)
+	}
+}
+
+// relayReply sends a reply for a peer's client back through the tunnel its
+// traffic came in on, or to the peer whose pool the address is from.
+func (s *Server) relayReply(dst netip.Addr, packet []byte) {
+	if conn, ok := s.returnPaths.Load(dst); ok && conn.(*quic.Conn).Context().Err() == nil {
+		conn.(*quic.Conn).SendDatagram(packet)
+		return
+	}
+	if peer := s.peers.Load().poolOwner(dst); peer != nil {
+		s.relay(peer, packet)
+	}
+}
+
+func (s *Server) dialPeer(peer *Peer) {
+	defer s.peerDials.Delete(peer.NodeID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, peer.Address, &tls.Config{
+		MinVersion: tls.VersionTLS13,
+		NextProtos: []string{peerProtocol},
+		// Verified against the gateway CA and the peer's node ID instead
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			_, err := s.verifyPeer(rawCerts, peer.NodeID)
+			return err
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.peerCert(), nil
+		},
+	}, s.peerQUICConfig())
+	if err != nil {
+		log.Printf("⚠️ Failed to open the peer tunnel to %s (%s): %v", peer.NodeID, peer.Address, err)
+		return
+	}
+	log.Printf("🔗 Peer tunnel to %s (%s) open", peer.NodeID, peer.Address)
+	s.peerLinks.Store(peer.NodeID, conn)
+	go s.servePeer(peer.NodeID, conn)
+}
+
+// servePeer handles the packets a peer sends: replies to this gateway's
+// clients, and traffic of the peer's clients to the subnets this gateway
+// advertises, which is routed out like its own clients' traffic.
+func (s *Server) servePeer(nodeID string, conn *quic.Conn) {
+	ifce := s.nextIfce()
+	defer s.peerLinks.CompareAndDelete(nodeID, conn)
+
+	for {
+		packet, err := conn.ReceiveDatagram(context.Background())
+		if err != nil {
+			log.Printf("🔗 Peer tunnel to %s closed: %v", nodeID, err)
+			return
+		}
+		if len(packet) < 20 || packet[0]>>4 != 4 {
+			continue
+		}
+		src, dst, _ := parseIPv4Header(packet)
+
+		if connVal, ok := s.ClientConns.Load(dst.String()); ok {
+			s.sendToClient(connVal.(*ClientSession), packet)
+			continue
+		}
+
+		peer := s.peers.Load().byID[nodeID]
+		if peer == nil || !peer.ClientPool.Contains(src) || !s.advertises(dst) {
+			continue
+		}
+		s.returnPaths.Store(src, conn)
+		if _, err := ifce.Write(packet); err != nil {
+			log.Printf("TUN Write Error: %v", err)
+		}
+	}
+}
+
+// advertises reports whether dst is in a subnet this gateway serves to
+// its peers.
+func (s *Server) advertises(dst netip.Addr) bool {
+	for _, prefix := range s.AdvertisedRoutes {
+		if prefix.Contains(dst) {
+			return true
+		}
+	}
+	return false
+}
+
+// nextIfce picks a TUN queue, round-robin.
+func (s *Server) nextIfce() *water.Interface {
+	return s.Ifces[int(s.rr.Add(1)%uint64(len(s.Ifces)))]
+}
@@ -0,0 +1,105 @@
+package vpn
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"tridorian-ztna/pkg/pki"
+)
+
+func testGatewayCA(t *testing.T) *pki.CA {
+	t.Helper()
+	key, keyPEM, err := pki.NewKey()
+	if err != nil {
+		t.Fatalf("NewKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Gateway CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	ca, err := pki.LoadCA(string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), string(keyPEM))
+	if err != nil {
+		t.Fatalf("LoadCA: %v", err)
+	}
+	return ca
+}
+
+func nodeCertificate(t *testing.T, ca *pki.CA, nodeID string) *x509.Certificate {
+	t.Helper()
+	key, _, _ := pki.NewKey()
+	csr, err := pki.NewCSR(key, nodeID)
+	if err != nil {
+		t.Fatalf("NewCSR: %v", err)
+	}
+	cert, _, err := ca.SignClientCSR(csr, nodeID, time.Hour)
+	if err != nil {
+		t.Fatalf("SignClientCSR: %v", err)
+	}
+	return cert
+}
+
+func TestVerifyPeer(t *testing.T) {
+	ca := testGatewayCA(t)
+	const peerID, otherID = "11111111-1111-1111-1111-111111111111", "22222222-2222-2222-2222-222222222222"
+
+	current := nodeCertificate(t, ca, peerID)
+	previous := nodeCertificate(t, ca, peerID) // replaced by current
+	other := nodeCertificate(t, ca, otherID)
+	foreign := nodeCertificate(t, testGatewayCA(t), peerID)
+
+	s := NewServer(":0")
+	s.peerRoots = ca.Pool()
+	s.peers.Store(&peerTable{byID: map[string]*Peer{
+		peerID:  {NodeID: peerID, CertSerial: pki.SerialHex(current)},
+		otherID: {NodeID: otherID},
+	}})
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		nodeID  string
+		wantErr string
+	}{
+		{name: "current certificate", cert: current},
+		{name: "current certificate of the dialled peer", cert: current, nodeID: peerID},
+		{name: "replaced certificate", cert: previous, wantErr: "replaced or revoked"},
+		{name: "replaced certificate of the dialled peer", cert: previous, nodeID: peerID, wantErr: "replaced or revoked"},
+		{name: "peer without a known certificate", cert: other, wantErr: "replaced or revoked"},
+		{name: "another peer than dialled", cert: other, nodeID: peerID, wantErr: "not " + peerID},
+		{name: "another CA", cert: foreign, wantErr: "unknown authority"},
+		{name: "not a peer", cert: nodeCertificate(t, ca, "33333333-3333-3333-3333-333333333333"), wantErr: "not a peer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := s.verifyPeer([][]byte{tt.cert.Raw}, tt.nodeID)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("verifyPeer = %q, %v; want error containing %q", id, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || id != peerID {
+				t.Fatalf("verifyPeer = %q, %v; want %s", id, err, peerID)
+			}
+		})
+	}
+
+	if _, err := s.verifyPeer(nil, ""); err == nil {
+		t.Fatal("verifyPeer accepted no certificate")
+	}
+}
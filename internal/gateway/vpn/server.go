@@ -12,17 +12,21 @@ import (
 	"encoding/json"
 	"encoding/pem"
 	"fmt"
+	"io"
 	"log"
 	"math/big"
+	mrand "math/rand/v2"
 	"net"
 	"net/netip"
-	"os/exec"
 	"runtime"
+	"slices"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"tridorian-ztna/internal/gateway/firewall"
+	"tridorian-ztna/pkg/posture"
 
 	"github.com/golang-jwt/jwt/v5"
 	quic "github.com/quic-go/quic-go"
@@ -46,6 +50,7 @@ type SessionInfo struct {
 	Email       string
 	IPAddress   string
 	ConnectedAt int64
+	DeviceID    string
 }
 
 type Server struct {
@@ -57,6 +62,34 @@ type Server struct {
 	Config        *Config
 	GlobalLimiter *rate.Limiter
 	mu            sync.RWMutex
+
+	// fqdnLearned is signalled when DNS answers add addresses to FQDN destinations.
+	fqdnLearned chan struct{}
+
+	dnsConfig atomic.Pointer[DNSConfig]
+	dnsAddr   chan string // Tun address the DNS forwarder listens on, once known
+
+	// AdvertisedRoutes are the subnets this gateway serves to the clients of
+	// its peers.
+	AdvertisedRoutes []netip.Prefix
+	// Connector turns off the client listener and the peer listener: the
+	// gateway opens the peer tunnels itself, from a network without inbound
+	// ports.
+	Connector bool
+
+	rr          atomic.Uint64 // TUN queue round-robin
+	peers       atomic.Pointer[peerTable]
+	peerRoots   *x509.CertPool
+	peerCert    func() *tls.Certificate
+	peerLinks   sync.Map // Node ID -> *quic.Conn
+	peerDials   sync.Map // Node IDs being dialed
+	returnPaths sync.Map // Peer client address -> *quic.Conn its traffic came in on
+
+	// Network is the host networking the gateway keeps in place.
+	Network *Network
+
+	listener *quic.Listener
+	draining atomic.Bool
 }
 
 type Config struct {
@@ -70,18 +103,38 @@ type ClientSession struct {
 	Email       string
 	Groups      []string
 	OS          string
+	DeviceID    string // From the token; empty if the client did not attest at login
 	SessionKey  []byte
 	AEAD        cipher.AEAD
 	ConnectedAt int64
+
+	posture atomic.Pointer[posture.Report]
+
+	routesMu sync.Mutex
+	routes   []string // Last routes pushed to the client
+}
+
+// Posture returns the latest verified posture report for the session, or nil.
+func (c *ClientSession) Posture() *posture.Report {
+	return c.posture.Load()
+}
+
+// controlMessage is a JSON message sent by the client on a unidirectional stream.
+type controlMessage struct {
+	Type   string            `json:"type"`
+	Report *posture.Envelope `json:"report,omitempty"`
 }
 
 func NewServer(addr string) *Server {
 	return &Server{
-		Addr: addr,
+		Addr:        addr,
+		fqdnLearned: make(chan struct{}, 1),
+		dnsAddr:     make(chan string, 1),
+		Network:     NewNetwork(),
 	}
 }
 
-// BroadcastRouteUpdates iterates over all connected clients and sends them the updated routes
+// BroadcastRouteUpdates iterates over all connected clients and sends the updated routes to those whose routes changed
 func (s *Server) BroadcastRouteUpdates() {
 	log.Println("📢 Broadcasting route updates to connected clients...")
 	s.ClientConns.Range(func(key, value interface{}) bool {
@@ -90,37 +143,253 @@ func (s *Server) BroadcastRouteUpdates() {
 			return true
 		}
 
-		// Re-calculate routes
-		var routes []string
-		if firewall.Engine != nil {
-			routes = firewall.Engine.GetAllowedCIDRs(session.Email, session.Groups, session.OS)
-		}
+		go s.sendRouteUpdate(session)
 
-		// Send Update
-		go func(sess *ClientSession, r []string) {
-			// Open a unidirectional stream for control message
-			stream, err := (*sess.Conn).OpenUniStream()
-			if err != nil {
-				log.Printf("Failed to open stream to client %s: %v", sess.Email, err)
-				return
-			}
-			defer stream.Close()
+		return true
+	})
+}
 
-			updateMsg := map[string]interface{}{
-				"type":   "route_update",
-				"routes": r,
-			}
+// sendRouteUpdate recalculates the routes for a single session and pushes them
+// to the client. Nothing is sent if the routes did not change.
+func (s *Server) sendRouteUpdate(sess *ClientSession) {
+	var routes []string
+	if firewall.Engine != nil {
+		routes = firewall.Engine.GetAllowedCIDRs(sess.Email, sess.Groups, sess.OS, sess.Posture())
+	}
 
-			if err := json.NewEncoder(stream).Encode(updateMsg); err != nil {
-				log.Printf("Failed to encode route update for %s: %v", sess.Email, err)
-			}
-			log.Printf("✅ Sent route update to %s: %v", sess.Email, r)
-		}(session, routes)
+	sess.routesMu.Lock()
+	defer sess.routesMu.Unlock()
+	if slices.Equal(sess.routes, routes) {
+		return
+	}
+	sess.routes = routes
+
+	updateMsg := map[string]interface{}{
+		"type":   "route_update",
+		"routes": routes,
+	}
+
+	if err := sendControl(sess, updateMsg); err != nil {
+		log.Printf("Failed to send route update to %s: %v", sess.Email, err)
+		return
+	}
+	log.Printf("✅ Sent route update to %s: %v", sess.Email, routes)
+}
+
+// sendControl sends a control message to the client on a unidirectional
+// stream.
+func sendControl(sess *ClientSession, msg any) error {
+	stream, err := sess.Conn.OpenUniStream()
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	return json.NewEncoder(stream).Encode(msg)
+}
+
+// drainSpread is the fraction of the drain timeout over which clients are
+// asked to reconnect, so they do not all reach the other gateways at once.
+const drainSpread = 4
+
+// StopAccepting refuses new clients from now on. Connected clients stay
+// until Drain moves them away.
+func (s *Server) StopAccepting() {
+	if s.draining.Swap(true) {
+		return
+	}
+	s.mu.RLock()
+	listener := s.listener
+	s.mu.RUnlock()
+	if listener != nil {
+		listener.Close()
+	}
+}
+
+// Draining reports whether the server stopped accepting clients.
+func (s *Server) Draining() bool {
+	return s.draining.Load()
+}
+
+// Drain stops taking clients and asks the connected ones to reconnect to
+// another gateway, each at a random moment within the first part of the
+// timeout, then waits for them to leave until ctx ends, when the rest are
+// disconnected. Peer tunnels stay up, so relayed traffic flows until the
+// gateway stops.
+func (s *Server) Drain(ctx context.Context) {
+	s.StopAccepting()
+
+	deadline, _ := ctx.Deadline()
+	spread := time.Until(deadline) / drainSpread
+	msg := map[string]interface{}{
+		"type":     "reconnect",
+		"reason":   "draining",
+		"deadline": deadline.Unix(),
+	}
+	s.ClientConns.Range(func(key, value interface{}) bool {
+		if session, ok := value.(*ClientSession); ok {
+			go func() {
+				if spread > 0 {
+					select {
+					case <-time.After(mrand.N(spread)):
+					case <-ctx.Done():
+						return
+					}
+				}
+				if err := sendControl(session, msg); err != nil {
+					log.Printf("Failed to ask %s to reconnect: %v", session.Email, err)
+				}
+			}()
+		}
+		return true
+	})
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		remaining := len(s.GetActiveSessions())
+		if remaining == 0 {
+			log.Println("✅ All clients moved away")
+			return
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("⏱️ Drain deadline passed, disconnecting %d clients", remaining)
+			s.ClientConns.Range(func(key, value interface{}) bool {
+				if session, ok := value.(*ClientSession); ok {
+					session.Conn.CloseWithError(0, "Gateway Shutting Down")
+				}
+				return true
+			})
+			return
+		case <-ticker.C:
+		}
+	}
+}
 
+// DisconnectRevokedSessions closes every session whose device has been
+// blocked, whose user the directory has deprovisioned, or that an
+// administrator ended.
+func (s *Server) DisconnectRevokedSessions() {
+	engine := firewall.Engine
+	if engine == nil {
+		return
+	}
+	s.ClientConns.Range(func(key, value interface{}) bool {
+		session, ok := value.(*ClientSession)
+		if !ok {
+			return true
+		}
+		if engine.IsDeviceBlocked(session.DeviceID) {
+			log.Printf("🚫 Disconnecting %s: device %s is blocked", session.Email, session.DeviceID)
+			session.Conn.CloseWithError(1, "Device Blocked")
+		} else if engine.IsUserRevoked(session.Email) {
+			log.Printf("🚫 Disconnecting %s: user was deprovisioned", session.Email)
+			session.Conn.CloseWithError(1, "User Revoked")
+		} else if engine.IsSessionRevoked(session.Email, session.ConnectedAt) {
+			log.Printf("🚫 Disconnecting %s: session was revoked by an administrator", session.Email)
+			session.Conn.CloseWithError(1, "Session Revoked")
+		}
 		return true
 	})
 }
 
+// acceptControlStreams reads control messages the client sends on unidirectional
+// streams. Currently only periodic posture reports are expected.
+func (s *Server) acceptControlStreams(sess *ClientSession) {
+	for {
+		stream, err := sess.Conn.AcceptUniStream(context.Background())
+		if err != nil {
+			return
+		}
+
+		var msg controlMessage
+		err = json.NewDecoder(io.LimitReader(stream, 64*1024)).Decode(&msg)
+		stream.CancelRead(0)
+		if err != nil {
+			log.Printf("Invalid control message from %s: %v", sess.Email, err)
+			continue
+		}
+
+		switch msg.Type {
+		case "posture_report":
+			s.handlePostureReport(sess, msg.Report)
+		default:
+			log.Printf("Unknown control message %q from %s", msg.Type, sess.Email)
+		}
+	}
+}
+
+// handlePostureReport verifies a signed report and re-evaluates the session's access.
+// The report must be signed by the device the user attested at login.
+func (s *Server) handlePostureReport(sess *ClientSession, envelope *posture.Envelope) {
+	if envelope == nil {
+		return
+	}
+	report, deviceID, err := envelope.Verify(time.Now())
+	if err != nil {
+		log.Printf("Rejected posture report from %s: %v", sess.Email, err)
+		return
+	}
+	if sess.DeviceID == "" || deviceID != sess.DeviceID {
+		log.Printf("Rejected posture report from %s: device %s does not match login", sess.Email, deviceID)
+		return
+	}
+
+	sess.posture.Store(report)
+	log.Printf("📋 Posture from %s: %s", sess.Email, report)
+
+	s.sendRouteUpdate(sess)
+}
+
+// WatchSchedules periodically re-evaluates time-based policy conditions.
+// When a rule's window opens or closes, connected clients get a route update
+// so access is granted or withdrawn on live sessions, not only at connect time.
+func (s *Server) WatchSchedules(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			engine := firewall.Engine
+			if engine != nil && engine.RefreshSchedules(now) {
+				s.BroadcastRouteUpdates()
+			}
+		}
+	}
+}
+
+// ResolveFQDNs refreshes the addresses of FQDN destinations right away,
+// e.g. after a config update added new names.
+func (s *Server) ResolveFQDNs(ctx context.Context) {
+	firewall.FQDNs.Resolve(ctx, time.Now())
+}
+
+// WatchFQDNs keeps FQDN destinations resolved and expires addresses whose TTL
+// has passed. Clients get a route update whenever their address set changes,
+// including when the DNS forwarder's answers match a wildcard destination.
+func (s *Server) WatchFQDNs(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.fqdnLearned:
+			s.BroadcastRouteUpdates()
+		case now := <-ticker.C:
+			added := firewall.FQDNs.Resolve(ctx, now)
+			removed := firewall.FQDNs.Expire(now)
+			if added || removed {
+				s.BroadcastRouteUpdates()
+			}
+		}
+	}
+}
+
 // UpdateConfig updates the server configuration dynamically
 func (s *Server) UpdateConfig(cidr string, pubKeyPEM string, maxMbps int64) error {
 	s.mu.Lock()
@@ -153,10 +422,19 @@ func (s *Server) UpdateConfig(cidr string, pubKeyPEM string, maxMbps int64) erro
 	// For simplicity, we assume CIDR doesn't change often or requires restart for net change.
 	// But if it's the first time:
 	if s.Config == nil && cidr != "" {
-		// Setup IP & NAT (moved from Start)
-		if err := setupNetwork(cidr); err != nil {
+		hostAddr := NewFastIPPool(cidr).GetHostIPAddress()
+		address, _ := netip.ParsePrefix(hostAddr)
+		s.Network.SetAddress(address)
+		if err := s.Network.Reconcile(); err != nil {
 			log.Printf("⚠️ Failed to setup network for CIDR %s: %v", cidr, err)
 		}
+		hostIP, _, _ := strings.Cut(hostAddr, "/")
+		s.dnsAddr <- hostIP
+	} else if s.Config == nil && s.Connector {
+		// Connectors without a client pool only forward their peers' traffic
+		if err := s.Network.Reconcile(); err != nil {
+			log.Printf("⚠️ Failed to setup network: %v", err)
+		}
 	} else if s.Config != nil && s.Config.VPNCIDR != cidr {
 		log.Println("⚠️ CIDR change detected. This may require restart or complex re-net implementation. Ignoring net re-setup for now.")
 	}
@@ -169,59 +447,6 @@ func (s *Server) UpdateConfig(cidr string, pubKeyPEM string, maxMbps int64) erro
 	return nil
 }
 
-func setupNetwork(cidr string) error {
-	// 1. System Tuning
-	if err := tuneSystem(); err != nil {
-		log.Printf("⚠️ System tuning failed: %v", err)
-	}
-
-	// 2. Interface Setup
-	ipPool := NewFastIPPool(cidr) // Just to get host IP
-	hostIP := ipPool.GetHostIPAddress()
-
-	exec.Command("ip", "addr", "add", hostIP, "dev", VPNInterface).Run()
-	exec.Command("ip", "link", "set", "dev", VPNInterface, "up", "mtu", "1420").Run()
-
-	// 3. NFTables NAT (Masquerade)
-	// Flush legacy iptables to avoid conflicts if possible, or just apply nftables
-	// Note: It is often good practice to use one or the other. We assume nftables is present.
-
-	// Create table
-	if err := exec.Command("nft", "add", "table", "ip", "tridorian_nat").Run(); err != nil {
-		log.Printf("⚠️ Failed to create nft table: %v", err)
-	}
-	// Create chain
-	if err := exec.Command("nft", "add", "chain", "ip", "tridorian_nat", "postrouting", "{ type nat hook postrouting priority 100 ; }").Run(); err != nil {
-		log.Printf("⚠️ Failed to create nft chain: %v", err)
-	}
-	// Add masquerade rule
-	if err := exec.Command("nft", "add", "rule", "ip", "tridorian_nat", "postrouting", "ip", "saddr", cidr, "masquerade").Run(); err != nil {
-		log.Printf("⚠️ Failed to add nft masquerade rule: %v", err)
-	}
-
-	return nil
-}
-
-func tuneSystem() error {
-	params := map[string]string{
-		"net.core.rmem_max":               "67108864",
-		"net.core.wmem_max":               "67108864",
-		"net.core.rmem_default":           "33554432",
-		"net.core.wmem_default":           "33554432",
-		"net.netfilter.nf_conntrack_max":  "1048576",
-		"net.ipv4.ip_forward":             "1",
-		"net.core.default_qdisc":          "fq",
-		"net.ipv4.tcp_congestion_control": "bbr",
-	}
-
-	for key, value := range params {
-		if err := exec.Command("sysctl", "-w", fmt.Sprintf("%s=%s", key, value)).Run(); err != nil {
-			log.Printf("⚠️ Failed to set %s: %v", key, err)
-		}
-	}
-	return nil
-}
-
 func (s *Server) Start(ctx context.Context) error {
 	// Tuning
 	numCPU := runtime.NumCPU()
@@ -245,17 +470,16 @@ func (s *Server) Start(ctx context.Context) error {
 		}
 	}
 
-	// Start Listeners
-	tlsConf := generateTLS()
-	listener, err := quic.ListenAddr(s.Addr, tlsConf, &quic.Config{
-		EnableDatagrams: true,
-		MaxIdleTimeout:  30 * time.Second,
-		KeepAlivePeriod: 10 * time.Second,
-	})
-	if err != nil {
-		return fmt.Errorf("failed to listen on %s: %v", s.Addr, err)
-	}
-	log.Printf("🛡️ VPN Server (QUIC) listening on %s", s.Addr)
+	// Closing the queues ends the readers, and the interface goes with the
+	// last one
+	go func() {
+		<-ctx.Done()
+		for _, ifce := range s.Ifces {
+			ifce.Close()
+		}
+	}()
+
+	go s.runDNSForwarder(ctx)
 
 	// Start TUN Readers (Parallel)
 	for i := range numCPU {
@@ -264,35 +488,52 @@ func (s *Server) Start(ctx context.Context) error {
 			for {
 				n, err := ifce.Read(buf)
 				if err != nil {
-					log.Printf("TUN Read Error: %v", err)
+					if ctx.Err() == nil {
+						log.Printf("TUN Read Error: %v", err)
+					}
 					return
 				}
 				packet := buf[:n]
 				if len(packet) >= 20 {
 					// Extract Dest IP from IPv4 Header (bytes 16-20)
-					dstIP := net.IP(packet[16:20]).String()
-					if connVal, ok := s.ClientConns.Load(dstIP); ok {
-						session, ok := connVal.(*ClientSession)
-						if ok {
-							// Apply Global Bandwidth Limiter
-							if s.GlobalLimiter != nil {
-								s.GlobalLimiter.WaitN(context.Background(), len(packet))
-							}
-							// Encrypt packet with session key
-							nonce := make([]byte, session.AEAD.NonceSize())
-							rand.Read(nonce)
-							encrypted := session.AEAD.Seal(nonce, nonce, packet, nil)
-
-							(*session.Conn).SendDatagram(encrypted)
+					dstIP := netip.AddrFrom4([4]byte(packet[16:20]))
+					if connVal, ok := s.ClientConns.Load(dstIP.String()); ok {
+						if session, ok := connVal.(*ClientSession); ok {
+							s.sendToClient(session, packet)
 						}
+					} else {
+						// Replies to the clients of peers using this gateway's subnets
+						s.relayReply(dstIP, packet)
 					}
 				}
 			}
 		}(s.Ifces[i])
 	}
 
+	// A connector takes no clients; the tunnels it opens to the other
+	// gateways carry all its traffic
+	if s.Connector {
+		log.Printf("🔌 Connector mode: not accepting clients")
+		<-ctx.Done()
+		return nil
+	}
+
+	// Start Listeners
+	tlsConf := generateTLS()
+	listener, err := quic.ListenAddr(s.Addr, tlsConf, &quic.Config{
+		EnableDatagrams: true,
+		MaxIdleTimeout:  30 * time.Second,
+		KeepAlivePeriod: 10 * time.Second,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %v", s.Addr, err)
+	}
+	log.Printf("🛡️ VPN Server (QUIC) listening on %s", s.Addr)
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+
 	// Accept Loop
-	var rr uint64
 	go func() {
 		<-ctx.Done()
 		listener.Close()
@@ -305,15 +546,32 @@ func (s *Server) Start(ctx context.Context) error {
 			case <-ctx.Done():
 				return nil
 			default:
+				if s.draining.Load() {
+					return nil
+				}
 				log.Printf("Accept Error: %v", err)
 				continue
 			}
 		}
 
 		// Round-Robin Select Interface for Writing
-		idx := int(atomic.AddUint64(&rr, 1) % uint64(numCPU))
-		go s.handleClient(conn, s.Ifces[idx])
+		go s.handleClient(conn, s.nextIfce())
+	}
+}
+
+// sendToClient encrypts a packet with the session key and sends it to the
+// client.
+func (s *Server) sendToClient(session *ClientSession, packet []byte) {
+	// Apply Global Bandwidth Limiter
+	if s.GlobalLimiter != nil {
+		s.GlobalLimiter.WaitN(context.Background(), len(packet))
 	}
+	// Encrypt packet with session key
+	nonce := make([]byte, session.AEAD.NonceSize())
+	rand.Read(nonce)
+	encrypted := session.AEAD.Seal(nonce, nonce, packet, nil)
+
+	(*session.Conn).SendDatagram(encrypted)
 }
 
 func (s *Server) handleClient(conn *quic.Conn, ifce *water.Interface) {
@@ -373,6 +631,12 @@ func (s *Server) handleClient(conn *quic.Conn, ifce *water.Interface) {
 		return
 	}
 
+	// A connection accepted just before the drain began
+	if s.draining.Load() {
+		conn.CloseWithError(1, "Gateway Draining")
+		return
+	}
+
 	// Assign IP
 	if s.IPManager == nil {
 		conn.CloseWithError(1, "IP Manager Not Ready")
@@ -380,6 +644,30 @@ func (s *Server) handleClient(conn *quic.Conn, ifce *water.Interface) {
 	}
 
 	osInfo, _ := claims["os"].(string)
+	deviceID, _ := claims["device_id"].(string)
+
+	if firewall.Engine != nil && firewall.Engine.IsDeviceBlocked(deviceID) {
+		log.Printf("Refusing %s: device %s is blocked", email, deviceID)
+		conn.CloseWithError(1, "Device Blocked")
+		return
+	}
+
+	if firewall.Engine != nil && firewall.Engine.IsUserRevoked(email) {
+		log.Printf("Refusing %s: user was deprovisioned", email)
+		conn.CloseWithError(1, "User Revoked")
+		return
+	}
+
+	// Tokens issued before an administrator ended the user's sessions are refused
+	var issuedAt int64
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Unix()
+	}
+	if firewall.Engine != nil && firewall.Engine.IsSessionRevoked(email, issuedAt) {
+		log.Printf("Refusing %s: session was revoked by an administrator", email)
+		conn.CloseWithError(1, "Session Revoked")
+		return
+	}
 
 	var groups []string
 	if g, ok := claims["groups"].([]interface{}); ok {
@@ -411,17 +699,20 @@ func (s *Server) handleClient(conn *quic.Conn, ifce *water.Interface) {
 
 	// Prepare JSON Response
 	type HandshakeResponse struct {
-		AssignedIP string   `json:"assigned_ip"`
-		GW_IP      string   `json:"gw_ip"`
-		Routes     []string `json:"routes"`
-		SessionKey string   `json:"session_key"` // Base64 encoded
+		AssignedIP string       `json:"assigned_ip"`
+		GW_IP      string       `json:"gw_ip"`
+		Routes     []string     `json:"routes"`
+		SessionKey string       `json:"session_key"` // Base64 encoded
+		DNS        *DNSSettings `json:"dns,omitempty"`
 	}
 
 	gwIP := s.GetHostIPAddress()
 
 	var routes []string
 	if firewall.Engine != nil {
-		routes = firewall.Engine.GetAllowedCIDRs(email, groups, osInfo)
+		// No posture yet; the client sends its first report right after the
+		// handshake and receives posture-dependent routes in a route update.
+		routes = firewall.Engine.GetAllowedCIDRs(email, groups, osInfo, nil)
 	}
 
 	// Generate session key for double encryption
@@ -442,6 +733,7 @@ func (s *Server) handleClient(conn *quic.Conn, ifce *water.Interface) {
 		GW_IP:      gwIP,
 		Routes:     routes,
 		SessionKey: fmt.Sprintf("%x", sessionKey), // Send as hex
+		DNS:        s.dnsSettings(),
 	}
 
 	respBytes, err := json.Marshal(resp)
@@ -454,16 +746,21 @@ func (s *Server) handleClient(conn *quic.Conn, ifce *water.Interface) {
 	stream.Write(respBytes)
 	stream.Close()
 
-	s.ClientConns.Store(myIP, &ClientSession{
+	session := &ClientSession{
 		Conn:        conn,
 		UserID:      userID,
 		Email:       email,
 		Groups:      groups,
 		OS:          osInfo,
+		DeviceID:    deviceID,
 		SessionKey:  sessionKey,
 		AEAD:        aead,
 		ConnectedAt: time.Now().Unix(),
-	})
+		routes:      routes,
+	}
+	s.ClientConns.Store(myIP, session)
+
+	go s.acceptControlStreams(session)
 
 	defer func() {
 		s.IPManager.ReleaseIP(context.Background(), myIP, email)
@@ -472,6 +769,9 @@ func (s *Server) handleClient(conn *quic.Conn, ifce *water.Interface) {
 
 	log.Printf("✅ Client Connected: %s (IP: %s)", email, myIP)
 
+	gwHost, _, _ := strings.Cut(gwIP, "/")
+	gwAddr, _ := netip.ParseAddr(gwHost)
+
 	// Data Loop
 	for {
 		encryptedData, err := conn.ReceiveDatagram(context.Background())
@@ -523,12 +823,14 @@ func (s *Server) handleClient(conn *quic.Conn, ifce *water.Interface) {
 		}
 
 		// Conditional Access / Firewall Check
-		if firewall.Engine != nil {
+		// Queries to the gateway's DNS forwarder are filtered per name by the forwarder itself
+		if firewall.Engine != nil && !isGatewayDNS(packetData, dstIP, gwAddr) {
 			if !firewall.Engine.IsAllowed(packetData, firewall.ValType{
 				Addr:     srcIP,
 				Identity: email,
 				Groups:   groups,
 				OS:       osInfo,
+				Posture:  session.Posture(),
 			}, firewall.ValType{
 				Addr: dstIP,
 			}) {
@@ -537,6 +839,12 @@ func (s *Server) handleClient(conn *quic.Conn, ifce *water.Interface) {
 			}
 		}
 
+		// Subnets behind another site go through its gateway
+		if peer := s.peers.Load().lookup(dstIP); peer != nil {
+			s.relay(peer, packetData)
+			continue
+		}
+
 		// Write to TUN Interface
 		_, err = ifce.Write(packetData)
 		if err != nil {
@@ -569,6 +877,7 @@ func (s *Server) GetActiveSessions() []SessionInfo {
 			Email:       sess.Email,
 			IPAddress:   ip,
 			ConnectedAt: sess.ConnectedAt,
+			DeviceID:    sess.DeviceID,
 		})
 		return true
 	})
@@ -0,0 +1,88 @@
+package gateway
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+	"tridorian-ztna/internal/models"
+	pb "tridorian-ztna/internal/proto/gateway/v1"
+	"tridorian-ztna/internal/services"
+	"tridorian-ztna/pkg/pki"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type nodeContextKey struct{}
+
+// serverCertValidity is the lifetime of a server certificate the gateway CA
+// issues to the control plane. A new one is issued at every start.
+const serverCertValidity = 365 * 24 * time.Hour
+
+// TLSConfig returns the control plane's TLS configuration. The server
+// certificate is certPEM and keyPEM when given, otherwise one the gateway
+// CA issues for hosts. Node client certificates are verified against the
+// gateway CA; one is optional at the TLS layer only so that nodes can
+// enroll, and the interceptor requires it for everything else.
+func TLSConfig(ca *pki.CA, certPEM, keyPEM string, hosts []string) (*tls.Config, error) {
+	var serverCert tls.Certificate
+	var err error
+	if certPEM != "" {
+		serverCert, err = tls.X509KeyPair([]byte(certPEM), []byte(keyPEM))
+	} else {
+		serverCert, err = ca.ServerCertificate(hosts, serverCertValidity)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("server certificate: %w", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{serverCert},
+		ClientCAs:    ca.Pool(),
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// UnaryAuthInterceptor authenticates each call by the node certificate,
+// checks that the gateway still runs on the hardware it enrolled from and
+// makes the node available to the handler through nodeFromContext.
+func (s *Server) UnaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if info.FullMethod == pb.GatewayService_Enroll_FullMethodName {
+		return handler(ctx, req)
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "client certificate is required")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 {
+		return nil, status.Error(codes.Unauthenticated, "client certificate is required")
+	}
+
+	node, err := s.nodeService.GetNodeByCertificate(tlsInfo.State.VerifiedChains[0][0])
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err := s.nodeService.VerifyDevice(node, metadataValue(ctx, "x-device-hash"), peerIP(ctx)); err != nil {
+		if errors.Is(err, services.ErrDeviceChanged) || errors.Is(err, services.ErrDeviceApprovalPending) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, "failed to verify the gateway's hardware")
+	}
+	return handler(context.WithValue(ctx, nodeContextKey{}, node), req)
+}
+
+// nodeFromContext returns the node authenticated by UnaryAuthInterceptor.
+func nodeFromContext(ctx context.Context) (*models.Node, error) {
+	node, ok := ctx.Value(nodeContextKey{}).(*models.Node)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "client certificate is required")
+	}
+	return node, nil
+}
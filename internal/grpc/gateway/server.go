@@ -2,12 +2,12 @@ package gateway
 
 import (
 	"context"
+	"tridorian-ztna/internal/models"
 	pb "tridorian-ztna/internal/proto/gateway/v1"
 	"tridorian-ztna/internal/services"
 
 	"net"
 
-	"github.com/google/uuid"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
@@ -16,90 +16,123 @@ import (
 
 type Server struct {
 	pb.UnimplementedGatewayServiceServer
-	nodeService   *services.NodeService
-	policyService *services.PolicyService
-	publicKeyPEM  string
+	nodeService        *services.NodeService
+	policyService      *services.PolicyService
+	deviceService      *services.DeviceService
+	tenantService      *services.TenantService
+	applicationService *services.ApplicationService
+	directoryService   *services.DirectoryService
+	sessionService     *services.SessionService
+	publicKeyPEM       string
 }
 
-func NewServer(nodeService *services.NodeService, policyService *services.PolicyService, publicKeyPEM string) *Server {
+func NewServer(nodeService *services.NodeService, policyService *services.PolicyService, deviceService *services.DeviceService, tenantService *services.TenantService, applicationService *services.ApplicationService, directoryService *services.DirectoryService, sessionService *services.SessionService, publicKeyPEM string) *Server {
 	return &Server{
-		nodeService:   nodeService,
-		policyService: policyService,
-		publicKeyPEM:  publicKeyPEM,
+		nodeService:        nodeService,
+		policyService:      policyService,
+		deviceService:      deviceService,
+		tenantService:      tenantService,
+		applicationService: applicationService,
+		directoryService:   directoryService,
+		sessionService:     sessionService,
+		publicKeyPEM:       publicKeyPEM,
 	}
 }
 
-func (s *Server) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
-	if req.NodeId == "" {
-		return nil, status.Error(codes.InvalidArgument, "node_id is required")
+// Enroll is called without a client certificate: the enrollment token
+// identifies the node.
+func (s *Server) Enroll(ctx context.Context, req *pb.EnrollRequest) (*pb.EnrollResponse, error) {
+	if req.EnrollmentToken == "" {
+		return nil, status.Error(codes.InvalidArgument, "enrollment_token is required")
+	}
+	if req.CsrPem == "" {
+		return nil, status.Error(codes.InvalidArgument, "csr_pem is required")
 	}
 
-	nodeID, err := uuid.Parse(req.NodeId)
+	node, certPEM, err := s.nodeService.EnrollGateway(req.EnrollmentToken, []byte(req.CsrPem), req.Hostname, req.DeviceHash, peerIP(ctx), gatewayVersion(ctx))
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "invalid node_id format")
+		return nil, status.Error(codes.PermissionDenied, err.Error())
 	}
 
-	ipAddress := ""
-	if p, ok := peer.FromContext(ctx); ok {
-		ipAddress = p.Addr.String()
-		if host, _, err := net.SplitHostPort(ipAddress); err == nil {
-			ipAddress = host
-		}
+	return &pb.EnrollResponse{
+		NodeId:           node.ID.String(),
+		CertificatePem:   string(certPEM),
+		CaCertificatePem: string(s.nodeService.CA().CertPEM),
+	}, nil
+}
 
-		// Handle IPv6 loopback mapping to IPv4 loopback for consistency if needed
-		if ipAddress == "::1" {
-			ipAddress = "127.0.0.1"
-		}
+func (s *Server) RenewCertificate(ctx context.Context, req *pb.RenewCertificateRequest) (*pb.RenewCertificateResponse, error) {
+	node, err := nodeFromContext(ctx)
+	if err != nil {
+		return nil, err
 	}
-
-	// Extract version from metadata
-	clientVersion := ""
-	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		if versions := md.Get("x-gateway-version"); len(versions) > 0 {
-			clientVersion = versions[0]
-		}
+	if req.CsrPem == "" {
+		return nil, status.Error(codes.InvalidArgument, "csr_pem is required")
 	}
 
-	token, err := s.nodeService.RegisterGateway(nodeID, req.Hostname, req.DeviceHash, ipAddress, clientVersion)
+	certPEM, err := s.nodeService.RenewCertificate(node, []byte(req.CsrPem))
 	if err != nil {
-		if err.Error() == "gateway node not found" {
-			return nil, status.Error(codes.NotFound, "gateway not found")
-		}
-		// Assuming other errors are permission related or conflict
-		return nil, status.Error(codes.PermissionDenied, err.Error())
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
 	}
+	return &pb.RenewCertificateResponse{CertificatePem: string(certPEM)}, nil
+}
 
-	return &pb.RegisterResponse{
-		AuthToken: token,
-	}, nil
+// peerIP returns the caller's address.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+	ipAddress := p.Addr.String()
+	if host, _, err := net.SplitHostPort(ipAddress); err == nil {
+		ipAddress = host
+	}
+
+	// Handle IPv6 loopback mapping to IPv4 loopback for consistency if needed
+	if ipAddress == "::1" {
+		ipAddress = "127.0.0.1"
+	}
+	return ipAddress
 }
 
-func (s *Server) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
-	if req.AuthToken == "" {
-		return nil, status.Error(codes.Unauthenticated, "auth_token is required")
+// gatewayVersion returns the version the gateway reports in its metadata.
+func gatewayVersion(ctx context.Context) string {
+	return metadataValue(ctx, "x-gateway-version")
+}
+
+// metadataValue returns the first value of a metadata key the gateway sent.
+func metadataValue(ctx context.Context, key string) string {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
 	}
+	return ""
+}
 
-	// 1. Authenticate Node
-	node, err := s.nodeService.GetNodeByToken(req.AuthToken)
+func (s *Server) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.HeartbeatResponse, error) {
+	// 1. Authenticated Node
+	node, err := nodeFromContext(ctx)
 	if err != nil {
-		return nil, status.Error(codes.Unauthenticated, "invalid auth_token")
+		return nil, err
 	}
 
-	// 2. Load Policies
-	// 2. Load Policies
-	policies, err := s.policyService.ListAccessPoliciesByNodeID(node.TenantID, node.ID)
+	// 2. Generate Gateway Config & Calculate Hash
+	config, err := s.buildConfig(node)
 	if err != nil {
-		return nil, status.Error(codes.Internal, "failed to load policies")
+		return nil, err
 	}
 
-	// 3. Generate Gateway Config & Calculate Hash
-	gatewayPolicies := services.GenerateGatewayPolicies(policies)
-	currentHash := services.CalculateConfigHash(gatewayPolicies)
-
-	updateAvailable := currentHash != req.ConfigHash
+	updateAvailable := config.ConfigHash != req.ConfigHash
 
 	// 4. Update Node Status/Heartbeat in Valkey
 	_ = s.nodeService.UpdateHeartbeat(node.ID)
+	_ = s.nodeService.UpdateGatewayInfo(node, peerIP(ctx), gatewayVersion(ctx))
+	_ = s.nodeService.UpdateSiteRouting(node, req.AdvertisedRoutes, req.PeerAddress, req.Connector)
+	_ = s.nodeService.UpdateDraining(node.ID, req.Status == "DRAINING")
+
+	// 5. Store application health check results
+	_ = s.applicationService.RecordHealth(node, req.AppHealth)
 
 	// Simple stub for now
 	return &pb.HeartbeatResponse{
@@ -109,46 +142,77 @@ func (s *Server) Heartbeat(ctx context.Context, req *pb.HeartbeatRequest) (*pb.H
 }
 
 func (s *Server) GetConfig(ctx context.Context, req *pb.GetConfigRequest) (*pb.GetConfigResponse, error) {
-	if req.AuthToken == "" {
-		return nil, status.Error(codes.Unauthenticated, "auth_token is required")
-	}
-
-	// 1. Authenticate Node
-	node, err := s.nodeService.GetNodeByToken(req.AuthToken)
+	// 1. Authenticated Node
+	node, err := nodeFromContext(ctx)
 	if err != nil {
-		return nil, status.Error(codes.Unauthenticated, "invalid auth_token")
+		return nil, err
 	}
 
-	// 2. Load Policies
-	// 2. Load Policies
+	// 2. Generate Gateway Config
+	return s.buildConfig(node)
+}
+
+// buildConfig assembles the gateway config for a node. Heartbeat uses the same
+// path so the hash it compares always matches what GetConfig returns.
+func (s *Server) buildConfig(node *models.Node) (*pb.GetConfigResponse, error) {
 	policies, err := s.policyService.ListAccessPoliciesByNodeID(node.TenantID, node.ID)
 	if err != nil {
 		return nil, status.Error(codes.Internal, "failed to load policies")
 	}
 
-	// 3. Generate Gateway Config
+	blockedDevices, err := s.deviceService.ListBlockedDeviceIDs(node.TenantID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to load blocked devices")
+	}
+
+	revokedUsers, err := s.directoryService.ListRevokedUserEmails(node.TenantID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to load revoked users")
+	}
+
+	revokedSessions, err := s.sessionService.ListSessionRevocations(node.TenantID, node.ID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to load session revocations")
+	}
+
+	tenant, err := s.tenantService.GetTenantByID(node.TenantID)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to load tenant")
+	}
+
+	peers, err := s.nodeService.ListPeers(node)
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to load peer gateways")
+	}
+
 	gatewayPolicies := services.GenerateGatewayPolicies(policies)
-	currentHash := services.CalculateConfigHash(gatewayPolicies)
+	healthChecks := services.GenerateHealthChecks(policies)
+	dns := services.GenerateDNSConfig(tenant)
+	egress := s.nodeService.EgressConfig(node)
+	currentHash := services.CalculateConfigHash(gatewayPolicies, blockedDevices, revokedUsers, revokedSessions, dns, healthChecks, peers, egress)
 
 	// Return config from Node and generated policies
 	return &pb.GetConfigResponse{
-		VpnCidr:          node.ClientCIDR,
-		PublicKeyPem:     s.publicKeyPEM, // Use global/tenant key for verification
-		ConfigHash:       currentHash,
-		Policies:         gatewayPolicies,
-		MaxBandwidthMbps: node.NodeSku.Bandwidth,
+		VpnCidr:           node.ClientPool(),
+		PublicKeyPem:      s.publicKeyPEM, // Use global/tenant key for verification
+		ConfigHash:        currentHash,
+		Policies:          gatewayPolicies,
+		MaxBandwidthMbps:  node.NodeSku.Bandwidth,
+		BlockedDeviceIds:  blockedDevices,
+		Dns:               dns,
+		HealthChecks:      healthChecks,
+		RevokedUserEmails: revokedUsers,
+		RevokedSessions:   revokedSessions,
+		Peers:             peers,
+		Egress:            egress,
 	}, nil
 }
 
 func (s *Server) GetSessionIP(ctx context.Context, req *pb.GetSessionIPRequest) (*pb.GetSessionIPResponse, error) {
-	if req.AuthToken == "" {
-		return nil, status.Error(codes.Unauthenticated, "auth_token is required")
-	}
-
-	// 1. Authenticate Node
-	node, err := s.nodeService.GetNodeByToken(req.AuthToken)
+	// 1. Authenticated Node
+	node, err := nodeFromContext(ctx)
 	if err != nil {
-		return nil, status.Error(codes.Unauthenticated, "invalid auth_token")
+		return nil, err
 	}
 
 	// 2. Get/Allocate IP
@@ -163,14 +227,10 @@ func (s *Server) GetSessionIP(ctx context.Context, req *pb.GetSessionIPRequest)
 }
 
 func (s *Server) SyncSessions(ctx context.Context, req *pb.SyncSessionsRequest) (*pb.SyncSessionsResponse, error) {
-	if req.AuthToken == "" {
-		return nil, status.Error(codes.Unauthenticated, "auth_token is required")
-	}
-
-	// 1. Authenticate Node
-	node, err := s.nodeService.GetNodeByToken(req.AuthToken)
+	// 1. Authenticated Node
+	node, err := nodeFromContext(ctx)
 	if err != nil {
-		return nil, status.Error(codes.Unauthenticated, "invalid auth_token")
+		return nil, err
 	}
 
 	// 2. Sync
@@ -13,6 +13,20 @@ import (
 	"gorm.io/gorm/logger"
 )
 
+// auditLogGuard makes the database refuse to update, delete or truncate
+// audit log entries.
+var auditLogGuard = []string{
+	`CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit log entries cannot be changed or deleted';
+END;
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_logs_append_only ON audit_logs`,
+	`CREATE TRIGGER audit_logs_append_only BEFORE UPDATE OR DELETE ON audit_logs FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only()`,
+	`DROP TRIGGER IF EXISTS audit_logs_no_truncate ON audit_logs`,
+	`CREATE TRIGGER audit_logs_no_truncate BEFORE TRUNCATE ON audit_logs FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_append_only()`,
+}
+
 func SetupDatabase() *gorm.DB {
 
 	dbHost := utils.GetEnv("DB_HOST", "localhost")
@@ -71,16 +85,32 @@ func SetupDatabase() *gorm.DB {
 		all_model := []any{&models.Tenant{},
 			&models.Administrator{},
 			&models.NodeSku{},
+			&models.GatewayGroup{},
 			&models.Node{},
 			&models.PolicyNode{},
 			&models.PolicyCondition{},
 			&models.AccessPolicy{},
 			&models.SignInPolicy{},
 			&models.Application{},
-			&models.ApplicationCIDR{},
+			&models.ApplicationDestination{},
 			&models.CustomDomain{},
 			&models.BackofficeUser{},
 			&models.AccessPolicyNode{},
+			&models.Device{},
+			&models.IdentityProvider{},
+			&models.DirectoryUser{},
+			&models.DirectoryGroup{},
+			&models.SCIMToken{},
+			&models.DirectorySync{},
+			&models.RefreshToken{},
+			&models.MFACredential{},
+			&models.MFARecoveryCode{},
+			&models.LoginAttempt{},
+			&models.AdminRoleMapping{},
+			&models.Role{},
+			&models.SessionRevocation{},
+			&models.AuditLog{},
+			&models.ConfigRevision{},
 		}
 
 		// db.Migrator().DropTable(all_model...)
@@ -92,6 +122,13 @@ func SetupDatabase() *gorm.DB {
 			log.Fatalf("Failed to get SQL DB object: %v", err)
 		}
 
+		// The audit log is append-only, also for anything bypassing GORM
+		for _, stmt := range auditLogGuard {
+			if err := db.Exec(stmt).Error; err != nil {
+				log.Fatalf("Failed to protect audit log: %v", err)
+			}
+		}
+
 		backofficeEmail := utils.GetEnv("BACKOFFICE_USER", "tri")
 		backofficePass := utils.GetEnv("BACKOFFICE_PASSWORD", "password")
 		backofficeUser := &models.BackofficeUser{
@@ -8,7 +8,7 @@ type AccessPolicy struct {
 
 	ResourceType    string `json:"resource_type,omitempty"`
 	ResourceID      string `json:"resource_id,omitempty"`
-	DestinationType string `json:"destination_type,omitempty"` // "cidr", "app", "sni"
+	DestinationType string `json:"destination_type,omitempty"` // "cidr", "app", "app_tag", "sni", "fqdn"
 
 	// For type "cidr"
 	DestinationCIDR string `gorm:"column:destination_cidr" json:"destination_cidr,omitempty"`
@@ -17,9 +17,17 @@ type AccessPolicy struct {
 	DestinationAppID *uuid.UUID   `gorm:"type:uuid" json:"destination_app_id,omitempty"`
 	DestinationApp   *Application `json:"destination_app,omitempty"`
 
+	// For type "app_tag": every application carrying the tag
+	DestinationAppTag string        `gorm:"column:destination_app_tag" json:"destination_app_tag,omitempty"`
+	TaggedApps        []Application `gorm:"-" json:"tagged_apps,omitempty"` // Resolved when policies are loaded
+
 	// For type "sni"
 	DestinationSNI string `json:"destination_sni,omitempty"`
 
+	// For type "fqdn": comma separated host names, wildcards allowed ("*.corp.internal").
+	// Gateways resolve them into address sets.
+	DestinationFQDN string `gorm:"column:destination_fqdn" json:"destination_fqdn,omitempty"`
+
 	RootNodeID *uuid.UUID `json:"root_node_id,omitempty"`
 	RootNode   PolicyNode `json:"root_node,omitempty"`
 
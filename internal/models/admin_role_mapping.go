@@ -0,0 +1,11 @@
+package models
+
+// AdminRoleMapping grants an administrator role to members of an identity
+// provider group when they sign in to the management console.
+type AdminRoleMapping struct {
+	BaseModel
+	BaseTenant
+
+	Group string    `gorm:"size:255;not null" json:"group"` // As policies see it: the Google group email or the IdP group name
+	Role  AdminRole `gorm:"type:varchar(20);not null" json:"role"`
+}
@@ -1,24 +1,64 @@
 package models
 
-import "github.com/google/uuid"
+import (
+	"strings"
+
+	"github.com/google/uuid"
+)
 
 type Application struct {
 	BaseModel
 	BaseTenant
 
-	Name        string            `gorm:"size:255;not null" json:"name,omitempty"`
-	Description string            `gorm:"size:500" json:"description,omitempty"`
-	CIDRs       []ApplicationCIDR `gorm:"foreignKey:ApplicationID" json:"cidrs,omitempty"`
+	Name        string `gorm:"size:255;not null" json:"name,omitempty"`
+	Description string `gorm:"size:500" json:"description,omitempty"`
+	Owner       string `gorm:"size:255" json:"owner,omitempty"` // Email of the person responsible for the application
+	Tags        string `gorm:"size:500" json:"tags,omitempty"`  // Comma separated, referenced by "app_tag" policies
+
+	// Ports lists allowed protocols and ports, e.g. "tcp/443,udp/53,tcp/8000-8100".
+	// Empty allows every port.
+	Ports string `gorm:"size:500" json:"ports,omitempty"`
+
+	// HealthCheck is an optional "host:port" that gateways probe over TCP.
+	HealthCheck string `gorm:"size:255" json:"health_check,omitempty"`
+
+	Destinations []ApplicationDestination `gorm:"foreignKey:ApplicationID" json:"destinations,omitempty"`
+
+	// Health holds the latest probe result reported by each gateway. Not persisted.
+	Health []ApplicationHealth `gorm:"-" json:"health,omitempty"`
 }
 
-type ApplicationCIDR struct {
+// HasTag reports whether the application carries the tag (case-insensitive).
+func (a *Application) HasTag(tag string) bool {
+	tag = strings.TrimSpace(tag)
+	for _, t := range strings.Split(a.Tags, ",") {
+		if t = strings.TrimSpace(t); t != "" && strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ApplicationDestination is one address of an application: a CIDR, a host
+// name, or a wildcard such as "*.corp.internal".
+type ApplicationDestination struct {
 	BaseModel
 	BaseTenant
 
 	ApplicationID uuid.UUID `gorm:"type:uuid;not null;index" json:"application_id,omitempty"`
-	CIDR          string    `gorm:"size:100;not null;column:cidr" json:"cidr,omitempty"`
+	Type          string    `gorm:"size:20;not null" json:"type,omitempty"` // "cidr", "fqdn"
+	Value         string    `gorm:"size:255;not null" json:"value,omitempty"`
+}
+
+func (ApplicationDestination) TableName() string {
+	return "application_destinations"
 }
 
-func (ApplicationCIDR) TableName() string {
-	return "application_cidrs"
+// ApplicationHealth is a gateway's latest health check result for an application.
+type ApplicationHealth struct {
+	NodeID    string `json:"node_id"`
+	Healthy   bool   `json:"healthy"`
+	LatencyMs int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+	CheckedAt int64  `json:"checked_at"`
 }
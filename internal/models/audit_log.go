@@ -0,0 +1,97 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Who made an audited change.
+const (
+	AuditActorAdmin      = "admin"
+	AuditActorBackoffice = "backoffice"
+	AuditActorSystem     = "system"
+)
+
+// ErrAuditLogImmutable is returned when something tries to change or remove
+// an audit log entry.
+var ErrAuditLogImmutable = errors.New("audit log entries cannot be changed or deleted")
+
+// AuditLog is one administrative change. Entries are append-only and chained
+// per tenant: Hash covers the entry and the previous entry's hash, so editing,
+// removing or reordering an entry breaks every hash after it.
+type AuditLog struct {
+	ID        uuid.UUID `gorm:"type:uuid;primary_key" json:"id"`
+	TenantID  uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_audit_log_tenant_sequence,priority:1" json:"tenant_id"`
+	Sequence  int64     `gorm:"not null;uniqueIndex:idx_audit_log_tenant_sequence,priority:2" json:"sequence"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+
+	ActorType  string     `gorm:"type:varchar(20);not null" json:"actor_type"`
+	ActorID    *uuid.UUID `gorm:"type:uuid;index" json:"actor_id,omitempty"`
+	ActorEmail string     `gorm:"size:255;index" json:"actor_email,omitempty"`
+	IP         string     `gorm:"size:64" json:"ip,omitempty"`
+	UserAgent  string     `gorm:"type:text" json:"user_agent,omitempty"`
+
+	Action       string `gorm:"size:100;index;not null" json:"action"` // e.g. "access_policy.update"
+	ResourceType string `gorm:"size:50;index;not null" json:"resource_type"`
+	ResourceID   string `gorm:"size:255;index" json:"resource_id,omitempty"`
+	Before       string `gorm:"type:text" json:"-"` // JSON of the resource before the change
+	After        string `gorm:"type:text" json:"-"` // JSON of the resource after the change
+
+	PrevHash string `gorm:"size:64" json:"prev_hash"`
+	Hash     string `gorm:"size:64;not null" json:"hash"`
+}
+
+// MarshalJSON embeds the before and after snapshots as JSON rather than strings.
+func (l AuditLog) MarshalJSON() ([]byte, error) {
+	type plain AuditLog
+	return json.Marshal(struct {
+		plain
+		Before json.RawMessage `json:"before,omitempty"`
+		After  json.RawMessage `json:"after,omitempty"`
+	}{plain(l), rawJSON(l.Before), rawJSON(l.After)})
+}
+
+func rawJSON(s string) json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	return json.RawMessage(s)
+}
+
+// ComputeHash returns the chain hash of the entry. Timestamps are hashed in
+// UTC at microsecond precision, as stored by the database.
+func (l *AuditLog) ComputeHash() string {
+	content, _ := json.Marshal([]any{
+		l.PrevHash,
+		l.ID.String(),
+		l.TenantID.String(),
+		l.Sequence,
+		l.CreatedAt.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano),
+		l.ActorType,
+		l.ActorID,
+		l.ActorEmail,
+		l.IP,
+		l.UserAgent,
+		l.Action,
+		l.ResourceType,
+		l.ResourceID,
+		l.Before,
+		l.After,
+	})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func (l *AuditLog) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
+
+func (l *AuditLog) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditLogImmutable
+}
@@ -0,0 +1,14 @@
+package models
+
+// ConfigRevision is a configuration document imported into a tenant. The
+// latest revision is what drift detection compares the live configuration
+// with.
+type ConfigRevision struct {
+	BaseModel
+	BaseTenant
+
+	Document  string `gorm:"type:text;not null" json:"document"` // Canonical JSON of the imported document
+	Hash      string `gorm:"size:64;not null" json:"hash"`       // SHA-256 of Document
+	AppliedBy string `gorm:"size:255" json:"applied_by,omitempty"`
+	Changes   int    `gorm:"not null;default:0" json:"changes"` // Changes the import made
+}
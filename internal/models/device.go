@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+type DeviceStatus string
+
+const (
+	DeviceStatusPending  DeviceStatus = "pending"
+	DeviceStatusApproved DeviceStatus = "approved"
+	DeviceStatusBlocked  DeviceStatus = "blocked"
+)
+
+// Device is an endpoint running the ztna-client, identified by the
+// fingerprint of its device key. Created on first attested login.
+type Device struct {
+	BaseModel
+	BaseTenant
+
+	DeviceID  string `gorm:"size:64;not null;uniqueIndex:idx_device_tenant" json:"device_id,omitempty"`
+	PublicKey string `gorm:"type:text" json:"public_key,omitempty"`
+
+	Hostname   string `gorm:"size:255" json:"hostname,omitempty"`
+	UserEmail  string `gorm:"size:255;index" json:"user_email,omitempty"`  // Last user seen on this device
+	OwnerEmail string `gorm:"size:255;index" json:"owner_email,omitempty"` // User who registered the device
+
+	Status DeviceStatus `gorm:"type:varchar(20);default:'pending'" json:"status,omitempty"`
+
+	// Latest posture
+	OS                string     `gorm:"size:50" json:"os,omitempty"`
+	OSVersion         string     `gorm:"size:100" json:"os_version,omitempty"`
+	DiskEncrypted     bool       `json:"disk_encrypted"`
+	FirewallEnabled   bool       `json:"firewall_enabled"`
+	ScreenLockEnabled bool       `json:"screen_lock_enabled"`
+	ClientVersion     string     `gorm:"size:50" json:"client_version,omitempty"`
+	LastPostureAt     *time.Time `json:"last_posture_at,omitempty"`
+}
@@ -0,0 +1,85 @@
+package models
+
+import "time"
+
+// Directory sources: pushed by the IdP over SCIM, or pulled from Google Workspace.
+const (
+	DirectorySourceSCIM   = "scim"
+	DirectorySourceGoogle = "google"
+)
+
+// DirectoryUser is a user pushed by the tenant's IdP over SCIM or mirrored
+// from Google Workspace. When a tenant has a directory, it decides who may
+// sign in and which groups policies see.
+type DirectoryUser struct {
+	BaseModel
+	BaseTenant
+
+	Source      string `gorm:"size:20;default:'scim';index" json:"source,omitempty"`
+	ExternalID  string `gorm:"size:255;index" json:"external_id,omitempty"`
+	UserName    string `gorm:"size:255;not null;index" json:"user_name,omitempty"` // Unique per tenant, case-insensitively
+	Email       string `gorm:"size:255;index" json:"email,omitempty"`              // Lower-cased
+	DisplayName string `gorm:"size:255" json:"display_name,omitempty"`
+	GivenName   string `gorm:"size:255" json:"given_name,omitempty"`
+	FamilyName  string `gorm:"size:255" json:"family_name,omitempty"`
+	Active      bool   `json:"active"`
+	IsAdmin     bool   `json:"is_admin"`          // Workspace administrator, Google only
+	ETag        string `gorm:"size:255" json:"-"` // Google's etag, to skip unchanged users
+
+	Groups []DirectoryGroup `gorm:"many2many:directory_group_members" json:"groups,omitempty"`
+}
+
+// DirectoryGroup is a group pushed over SCIM or mirrored from Google.
+// Policies match it by PolicyName.
+type DirectoryGroup struct {
+	BaseModel
+	BaseTenant
+
+	Source      string `gorm:"size:20;default:'scim';index" json:"source,omitempty"`
+	ExternalID  string `gorm:"size:255;index" json:"external_id,omitempty"`
+	DisplayName string `gorm:"size:255;not null" json:"display_name,omitempty"`
+	Email       string `gorm:"size:255" json:"email,omitempty"` // Google groups only
+	ETag        string `gorm:"size:255" json:"-"`
+	MembersETag string `gorm:"size:255" json:"-"` // Etag of the last member list, to skip unchanged groups
+
+	Members []DirectoryUser `gorm:"many2many:directory_group_members" json:"members,omitempty"`
+}
+
+// PolicyName is the value policies and tokens use for the group: the group
+// email for Google, which is what sign-in reported before the directory
+// existed, and the display name otherwise.
+func (g *DirectoryGroup) PolicyName() string {
+	if g.Email != "" {
+		return g.Email
+	}
+	return g.DisplayName
+}
+
+// DirectorySync records the last Google Workspace sync of a tenant.
+type DirectorySync struct {
+	BaseModel
+	BaseTenant
+
+	Source          string     `gorm:"size:20;not null" json:"source,omitempty"`
+	Status          string     `gorm:"size:20" json:"status,omitempty"` // "running", "succeeded", "failed"
+	LastStartedAt   *time.Time `json:"last_started_at,omitempty"`
+	LastFinishedAt  *time.Time `json:"last_finished_at,omitempty"`
+	LastSucceededAt *time.Time `json:"last_succeeded_at,omitempty"`
+	LastFullSyncAt  *time.Time `json:"last_full_sync_at,omitempty"` // Last sync that refetched every member list
+	LastError       string     `gorm:"type:text" json:"last_error,omitempty"`
+	Users           int        `json:"users"`
+	Groups          int        `json:"groups"`
+	Changes         int        `json:"changes"` // Rows written by the last sync
+}
+
+// SCIMToken authenticates a tenant's IdP against the SCIM endpoint. Only the
+// SHA-256 of the token is stored; the token itself is shown once on creation.
+type SCIMToken struct {
+	BaseModel
+	BaseTenant
+
+	Name       string     `gorm:"size:255;not null" json:"name,omitempty"`
+	TokenHash  string     `gorm:"size:64;not null;uniqueIndex" json:"-"`
+	Prefix     string     `gorm:"size:16" json:"prefix,omitempty"` // First characters, to tell tokens apart
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
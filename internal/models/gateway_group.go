@@ -0,0 +1,18 @@
+package models
+
+// GatewayGroup is a site served by several gateway nodes. Clients connect to
+// a healthy member and move to another member when it fails.
+type GatewayGroup struct {
+	BaseTenant
+	BaseModel
+
+	Name        string `gorm:"size:255;not null" json:"name"`
+	Description string `json:"description,omitempty"`
+
+	// Client address pool shared by all members, so that a user keeps their
+	// address on whichever member they connect to. When empty, each member
+	// assigns addresses from its own ClientCIDR.
+	ClientCIDR string `gorm:"size:50;column:client_cidr" json:"client_cidr,omitempty"`
+
+	Nodes []Node `gorm:"foreignKey:GatewayGroupID" json:"nodes,omitempty"`
+}
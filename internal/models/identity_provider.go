@@ -0,0 +1,36 @@
+package models
+
+type IdentityProviderType string
+
+const (
+	IdentityProviderGoogle IdentityProviderType = "google"
+	IdentityProviderOIDC   IdentityProviderType = "oidc"
+	IdentityProviderSAML   IdentityProviderType = "saml"
+)
+
+// IdentityProvider is a tenant's sign-in source for VPN users. Tenants
+// without one fall back to the Google fields on the Tenant.
+type IdentityProvider struct {
+	BaseModel
+	BaseTenant
+
+	Name      string               `gorm:"size:255;not null" json:"name,omitempty"`
+	Type      IdentityProviderType `gorm:"type:varchar(20);not null" json:"type,omitempty"`
+	Enabled   bool                 `json:"enabled"`
+	IsDefault bool                 `json:"is_default"` // Used when the login URL does not pick a provider
+
+	// Google and OIDC
+	IssuerURL    string `gorm:"size:500" json:"issuer_url,omitempty"` // OIDC discovery base, e.g. "https://login.microsoftonline.com/<tenant>/v2.0"
+	ClientID     string `gorm:"size:255" json:"client_id,omitempty"`
+	ClientSecret string `gorm:"type:text" json:"-"`               // sensitive, encrypted
+	Scopes       string `gorm:"size:500" json:"scopes,omitempty"` // Space or comma separated, defaults to "email profile"
+
+	// SAML 2.0
+	SSOURL      string `gorm:"column:sso_url;size:500" json:"sso_url,omitempty"`
+	EntityID    string `gorm:"size:500" json:"entity_id,omitempty"` // Issuer of the IdP's assertions
+	Certificate string `gorm:"type:text" json:"certificate,omitempty"`
+
+	// Claim (OIDC) or attribute (SAML) mapping
+	EmailClaim  string `gorm:"size:255" json:"email_claim,omitempty"`
+	GroupsClaim string `gorm:"size:255" json:"groups_claim,omitempty"`
+}
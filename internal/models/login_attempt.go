@@ -0,0 +1,26 @@
+package models
+
+import "github.com/google/uuid"
+
+// Reasons a console sign-in attempt was refused.
+const (
+	LoginReasonInvalidCredentials = "invalid_credentials"
+	LoginReasonInvalidMFA         = "invalid_mfa"
+	LoginReasonSSORequired        = "sso_required" // Right password, but the tenant signs administrators in through its IdP
+	LoginReasonThrottled          = "throttled"
+	LoginReasonLocked             = "locked"
+)
+
+// LoginAttempt records a refused administrator or backoffice sign-in, so
+// administrators can see password guessing against their tenant.
+type LoginAttempt struct {
+	BaseModel
+
+	TenantID  *uuid.UUID `gorm:"type:uuid;index" json:"tenant_id,omitempty"` // Nil for backoffice users and unknown domains
+	Realm     string     `gorm:"type:varchar(20);not null" json:"realm"`     // "mgmt" or "backoffice"
+	Email     string     `gorm:"index" json:"email"`
+	IP        string     `json:"ip"`
+	Country   string     `json:"country,omitempty"`
+	UserAgent string     `json:"user_agent,omitempty"`
+	Reason    string     `gorm:"type:varchar(40)" json:"reason"`
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MFAOwnerType tells which kind of local account a second factor belongs to.
+type MFAOwnerType string
+
+const (
+	MFAOwnerAdmin      MFAOwnerType = "admin"
+	MFAOwnerBackoffice MFAOwnerType = "backoffice"
+)
+
+type MFAMethod string
+
+const (
+	MFAMethodTOTP     MFAMethod = "totp"
+	MFAMethodWebAuthn MFAMethod = "webauthn"
+	MFAMethodRecovery MFAMethod = "recovery"
+)
+
+// MFACredential is a second factor enrolled by an administrator or a
+// backoffice user: an authenticator app or a passkey/security key.
+type MFACredential struct {
+	BaseModel
+
+	OwnerType MFAOwnerType `gorm:"type:varchar(20);index:idx_mfa_credential_owner;not null" json:"-"`
+	OwnerID   uuid.UUID    `gorm:"type:uuid;index:idx_mfa_credential_owner;not null" json:"-"`
+	Type      MFAMethod    `gorm:"type:varchar(20);not null" json:"type"`
+	Name      string       `json:"name"`
+
+	Secret       string `json:"-"` // TOTP secret, encrypted
+	LastStep     int64  `json:"-"` // Last TOTP step accepted, so codes cannot be replayed
+	CredentialID []byte `gorm:"index" json:"-"`
+	PublicKey    []byte `json:"-"` // COSE encoded WebAuthn public key
+	SignCount    uint32 `json:"-"`
+
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// MFARecoveryCode is a single-use code for signing in without the second factor.
+type MFARecoveryCode struct {
+	BaseModel
+
+	OwnerType MFAOwnerType `gorm:"type:varchar(20);index:idx_mfa_recovery_owner;not null" json:"-"`
+	OwnerID   uuid.UUID    `gorm:"type:uuid;index:idx_mfa_recovery_owner;not null" json:"-"`
+	CodeHash  string       `gorm:"not null" json:"-"`
+	UsedAt    *time.Time   `json:"used_at,omitempty"`
+}
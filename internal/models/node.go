@@ -19,8 +19,21 @@ type Node struct {
 	DeviceHash     string `gorm:"size:255" json:"device_hash,omitempty"`
 
 	// Authentication & Security
-	AuthToken    *string `gorm:"uniqueIndex" json:"auth_token,omitempty"`
-	PublicKeyPEM string  `gorm:"type:text" json:"public_key_pem,omitempty"`
+	PublicKeyPEM string `gorm:"type:text" json:"public_key_pem,omitempty"`
+
+	// Enrollment: a one-time token exchanged for a client certificate, which
+	// authenticates the gateway to the control plane over mutual TLS
+	EnrollmentTokenHash string     `gorm:"size:64;index" json:"-"` // SHA-256 of the token's secret
+	EnrollmentExpiresAt *time.Time `json:"enrollment_expires_at,omitempty"`
+	EnrolledAt          *time.Time `json:"enrolled_at,omitempty"`
+	CertSerial          string     `gorm:"size:64" json:"cert_serial,omitempty"` // Only this certificate is accepted
+	CertExpiresAt       *time.Time `json:"cert_expires_at,omitempty"`
+
+	// Hardware change waiting for approval: the gateway connected from a
+	// machine with this device hash
+	PendingDeviceHash string     `gorm:"size:255" json:"pending_device_hash,omitempty"`
+	PendingDeviceIP   string     `gorm:"size:50" json:"pending_device_ip,omitempty"`
+	PendingDeviceAt   *time.Time `json:"pending_device_at,omitempty"`
 
 	// License
 	ExpiresAt *time.Time `json:"expires_at,omitempty"`
@@ -35,4 +48,52 @@ type Node struct {
 
 	NodeSkuID uuid.UUID `gorm:"index" json:"node_sku_id,omitempty"`
 	NodeSku   NodeSku   `json:"node_sku,omitempty"`
+
+	// Site routing: subnets the gateway reaches for the tenant's other
+	// gateways, and the "host:port" they open the peer tunnel to. A connector
+	// takes no clients and no inbound connections: it opens the tunnels to
+	// the other gateways itself
+	AdvertisedRoutes []string `gorm:"serializer:json;type:text" json:"advertised_routes,omitempty"`
+	PeerAddress      string   `gorm:"size:255" json:"peer_address,omitempty"`
+	Connector        bool     `gorm:"default:false;not null" json:"connector,omitempty"`
+
+	// Egress: how client traffic leaves the gateway for the networks it
+	// reaches. See the Egress* modes
+	EgressMode string     `gorm:"size:20;default:'masquerade';not null" json:"egress_mode,omitempty"`
+	SNATPools  []SNATPool `gorm:"serializer:json;type:text" json:"snat_pools,omitempty"`
+	// In the routed mode, the CIDRs the network must route back to the
+	// gateway. Computed when the mode is set, not stored
+	ReturnRoutes []string `gorm:"-" json:"return_routes,omitempty"`
+
+	// Site the node serves with the other members of its group
+	GatewayGroupID *uuid.UUID    `gorm:"type:uuid;index" json:"gateway_group_id,omitempty"`
+	GatewayGroup   *GatewayGroup `json:"gateway_group,omitempty"`
+}
+
+const (
+	// EgressMasquerade translates client traffic to the gateway's address
+	EgressMasquerade = "masquerade"
+	// EgressRouted keeps client addresses: the network routes the client
+	// CIDR back to the gateway
+	EgressRouted = "routed"
+	// EgressSNAT translates traffic to the destinations of SNATPools to
+	// their source addresses, and masquerades the rest
+	EgressSNAT = "snat"
+)
+
+// SNATPool translates client traffic to Destination, a CIDR, to Source: an
+// address, a CIDR or a "first-last" range.
+type SNATPool struct {
+	Destination string `json:"destination" yaml:"destination"`
+	Source      string `json:"source" yaml:"source"`
+}
+
+// ClientPool returns the CIDR the node assigns client addresses from: its
+// group's shared pool if it has one, otherwise its own ClientCIDR. The
+// group must be loaded.
+func (n *Node) ClientPool() string {
+	if n.GatewayGroup != nil && n.GatewayGroup.ClientCIDR != "" {
+		return n.GatewayGroup.ClientCIDR
+	}
+	return n.ClientCIDR
 }
@@ -10,10 +10,13 @@ type PolicyCondition struct {
 
 	NodeID uuid.UUID `json:"node_id,omitempty"`
 
-	Type string `gorm:"size:50" json:"type,omitempty"` // "User", "Network", "Device", ...
+	Type string `gorm:"size:50" json:"type,omitempty"` // "User", "Network", "Device", "Time", ...
 
-	Field string `gorm:"size:100" json:"field,omitempty"` // "group", "ip", "os"
-	Op    string `gorm:"size:20" json:"op,omitempty"`     // "equals", "in", "cidr", "contains"
+	Field string `gorm:"size:100" json:"field,omitempty"` // "group", "ip", "os", "time_of_day", "weekday", "date"
+	Op    string `gorm:"size:20" json:"op,omitempty"`     // "equals", "in", "cidr", "contains", "between", "until"
 
 	Value string `gorm:"size:255" json:"value,omitempty"` // JSON / string / array
+
+	// For type "Time": IANA time zone the value is expressed in (default UTC)
+	Timezone string `gorm:"size:64" json:"timezone,omitempty"`
 }
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken lets the desktop client renew its target token without a new
+// browser sign-in. Only the SHA-256 of the token is stored. Every use rotates
+// it within the same family; presenting a rotated token again revokes the
+// whole family.
+type RefreshToken struct {
+	BaseModel
+	BaseTenant
+
+	FamilyID  uuid.UUID `gorm:"type:uuid;index;not null" json:"family_id"`
+	TokenHash string    `gorm:"size:64;not null;uniqueIndex" json:"-"`
+
+	// The signed-in user, as at the browser sign-in
+	Subject  string   `gorm:"size:255" json:"subject,omitempty"`
+	Email    string   `gorm:"size:255;index" json:"email,omitempty"`
+	Name     string   `gorm:"size:255" json:"name,omitempty"`
+	Groups   []string `gorm:"serializer:json;type:text" json:"groups,omitempty"`
+	OS       string   `gorm:"size:50" json:"os,omitempty"`
+	DeviceID string   `gorm:"size:64" json:"device_id,omitempty"`
+
+	ExpiresAt time.Time  `json:"expires_at"` // End of the family, counted from the sign-in
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,221 @@
+package models
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Permission allows one action on one kind of resource, written
+// "resource:action". Either part may be "*", and "*" alone allows everything.
+type Permission string
+
+const (
+	PermTenantRead        Permission = "tenant:read"
+	PermTenantWrite       Permission = "tenant:write"
+	PermSecurityRead      Permission = "security:read"
+	PermSecurityWrite     Permission = "security:write"
+	PermAdminsRead        Permission = "admins:read"
+	PermAdminsWrite       Permission = "admins:write"
+	PermPoliciesRead      Permission = "policies:read"
+	PermPoliciesWrite     Permission = "policies:write"
+	PermApplicationsRead  Permission = "applications:read"
+	PermApplicationsWrite Permission = "applications:write"
+	PermNodesRead         Permission = "nodes:read"
+	PermNodesWrite        Permission = "nodes:write"
+	PermSessionsRead      Permission = "sessions:read"
+	PermSessionsRevoke    Permission = "sessions:revoke"
+	PermIdentityRead      Permission = "identity:read"  // Directory search and sync status
+	PermIdentityWrite     Permission = "identity:write" // Directory sync
+	PermIdPRead           Permission = "idp:read"       // Identity providers and SCIM tokens
+	PermIdPWrite          Permission = "idp:write"
+	PermDevicesRead       Permission = "devices:read"
+	PermDevicesWrite      Permission = "devices:write"
+	PermAuditRead         Permission = "audit:read"   // The audit log of administrative changes
+	PermConfigRead        Permission = "config:read"  // Configuration export and drift
+	PermConfigWrite       Permission = "config:write" // Configuration import
+
+	PermAll Permission = "*"
+)
+
+// AllPermissions lists every concrete permission, for role editors.
+var AllPermissions = []Permission{
+	PermTenantRead, PermTenantWrite,
+	PermSecurityRead, PermSecurityWrite,
+	PermAdminsRead, PermAdminsWrite,
+	PermPoliciesRead, PermPoliciesWrite,
+	PermApplicationsRead, PermApplicationsWrite,
+	PermNodesRead, PermNodesWrite,
+	PermSessionsRead, PermSessionsRevoke,
+	PermIdentityRead, PermIdentityWrite,
+	PermIdPRead, PermIdPWrite,
+	PermDevicesRead, PermDevicesWrite,
+	PermAuditRead,
+	PermConfigRead, PermConfigWrite,
+}
+
+// builtinRolePermissions are the permissions of the built-in roles.
+var builtinRolePermissions = map[AdminRole][]Permission{
+	RoleSuperAdmin: {PermAll},
+	RoleAdmin: {
+		"tenant:*", PermSecurityRead, "policies:*", "applications:*", "nodes:*",
+		"sessions:*", "identity:*", "devices:*", PermAuditRead, "config:*",
+	},
+	RolePolicyAdmin: {PermTenantRead, "policies:*", PermIdentityRead},
+	RoleAuditor:     {"*:read"},
+	RoleHelpdesk:    {PermTenantRead, PermNodesRead, PermSessionsRead, PermSessionsRevoke},
+}
+
+// Permissions returns the permissions of a built-in role, nil for others.
+func (r AdminRole) Permissions() []Permission {
+	return builtinRolePermissions[r]
+}
+
+// Valid reports whether p is "*" or "resource:action" with known parts.
+func (p Permission) Valid() bool {
+	if p == PermAll {
+		return true
+	}
+	resource, action, ok := strings.Cut(string(p), ":")
+	if !ok {
+		return false
+	}
+	for _, known := range AllPermissions {
+		r, a, _ := strings.Cut(string(known), ":")
+		if (resource == "*" || resource == r) && (action == "*" || action == a) {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows reports whether p, possibly a wildcard, covers want, which may be
+// a wildcard too.
+func (p Permission) Allows(want Permission) bool {
+	if p == PermAll {
+		return true
+	}
+	if want == PermAll {
+		return false
+	}
+	pr, pa, _ := strings.Cut(string(p), ":")
+	wr, wa, _ := strings.Cut(string(want), ":")
+	return (pr == "*" || pr == wr) && (pa == "*" || pa == wa)
+}
+
+// Role is a tenant's custom administrator role.
+type Role struct {
+	BaseModel
+	BaseTenant
+
+	Name        string       `gorm:"size:100;not null" json:"name"`
+	Description string       `gorm:"size:500" json:"description,omitempty"`
+	Permissions []Permission `gorm:"serializer:json;type:text" json:"permissions"`
+}
+
+// AccessGrant is what a signed-in administrator may do: their role's
+// permissions, narrowed to their node and application scope if they have one.
+type AccessGrant struct {
+	Role           AdminRole    `json:"role"`
+	Permissions    []Permission `json:"permissions"`
+	NodeIDs        []uuid.UUID  `json:"node_ids,omitempty"`        // Empty means all nodes
+	ApplicationIDs []uuid.UUID  `json:"application_ids,omitempty"` // Empty means all applications
+}
+
+// Grant builds the access grant of an administrator whose CustomRole is
+// loaded when Role is RoleCustom.
+func (a *Administrator) Grant() *AccessGrant {
+	g := &AccessGrant{Role: a.Role, NodeIDs: a.NodeIDs, ApplicationIDs: a.ApplicationIDs}
+	if a.Role == RoleCustom {
+		if a.CustomRole != nil {
+			g.Permissions = a.CustomRole.Permissions
+		}
+	} else {
+		g.Permissions = a.Role.Permissions()
+	}
+	return g
+}
+
+// Has reports whether the grant includes the permission.
+func (g *AccessGrant) Has(want Permission) bool {
+	for _, p := range g.Permissions {
+		if p.Allows(want) {
+			return true
+		}
+	}
+	return false
+}
+
+// Covers reports whether the grant includes every one of perms, so its
+// holder may hand them to someone else.
+func (g *AccessGrant) Covers(perms []Permission) bool {
+	for _, p := range perms {
+		if !g.Has(p) {
+			return false
+		}
+	}
+	return true
+}
+
+// Contains reports whether other gives nothing beyond g: no permission g
+// lacks and no node or application outside g's scope.
+func (g *AccessGrant) Contains(other *AccessGrant) bool {
+	return g.Covers(other.Permissions) &&
+		withinScope(g.NodeIDs, other.NodeIDs) &&
+		withinScope(g.ApplicationIDs, other.ApplicationIDs)
+}
+
+// withinScope reports whether the inner scope is no wider than the outer one,
+// an empty scope being unlimited.
+func withinScope(outer, inner []uuid.UUID) bool {
+	if len(outer) == 0 {
+		return true
+	}
+	if len(inner) == 0 {
+		return false
+	}
+	for _, id := range inner {
+		if !slices.Contains(outer, id) {
+			return false
+		}
+	}
+	return true
+}
+
+// Scoped reports whether the grant is limited to some nodes or applications.
+func (g *AccessGrant) Scoped() bool {
+	return len(g.NodeIDs) > 0 || len(g.ApplicationIDs) > 0
+}
+
+// CanNode reports whether the node is within the grant's scope.
+func (g *AccessGrant) CanNode(id uuid.UUID) bool {
+	return len(g.NodeIDs) == 0 || slices.Contains(g.NodeIDs, id)
+}
+
+// CanApplication reports whether the application is within the grant's scope.
+func (g *AccessGrant) CanApplication(id uuid.UUID) bool {
+	return len(g.ApplicationIDs) == 0 || slices.Contains(g.ApplicationIDs, id)
+}
+
+// CanAccessPolicy reports whether an access policy is within the grant's
+// scope: bound to some of the grant's nodes and no others, and aimed at one
+// of the grant's applications.
+func (g *AccessGrant) CanAccessPolicy(p *AccessPolicy) bool {
+	if len(g.NodeIDs) > 0 {
+		if len(p.Nodes) == 0 {
+			return false
+		}
+		for _, n := range p.Nodes {
+			if !slices.Contains(g.NodeIDs, n.ID) {
+				return false
+			}
+		}
+	}
+	if len(g.ApplicationIDs) > 0 {
+		if p.DestinationType != "app" || p.DestinationAppID == nil || !slices.Contains(g.ApplicationIDs, *p.DestinationAppID) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,20 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SessionRevocation records an administrator ending a user's VPN sessions.
+// Gateways close sessions and refuse tokens of that user issued before
+// RevokedAt, on every gateway or only on NodeID.
+type SessionRevocation struct {
+	BaseModel
+	BaseTenant
+
+	Email     string     `gorm:"size:255;index;not null" json:"email"`
+	NodeID    *uuid.UUID `gorm:"type:uuid" json:"node_id,omitempty"` // Empty means every gateway
+	RevokedAt time.Time  `gorm:"index;not null" json:"revoked_at"`
+	RevokedBy uuid.UUID  `gorm:"type:uuid" json:"revoked_by"` // The administrator
+}
@@ -1,5 +1,7 @@
 package models
 
+import "github.com/google/uuid"
+
 type Tenant struct {
 	BaseModel
 	Name          string `json:"name,omitempty"`
@@ -11,4 +13,32 @@ type Tenant struct {
 	GoogleClientSecret      string `json:"-"`                  // sensitive
 	GoogleServiceAccountKey string `gorm:"type:text" json:"-"` // sensitive JSON
 	GoogleAdminEmail        string `json:"google_admin_email,omitempty"`
+
+	// Split DNS pushed to clients (comma separated lists)
+	DNSDomains        string `gorm:"column:dns_domains" json:"dns_domains,omitempty"`                 // Internal domains resolved through the tunnel, e.g. "corp.internal"
+	DNSResolvers      string `gorm:"column:dns_resolvers" json:"dns_resolvers,omitempty"`             // Upstream resolvers reachable from the gateways, e.g. "10.0.0.2,10.0.0.3:5353"
+	DNSSearchSuffixes string `gorm:"column:dns_search_suffixes" json:"dns_search_suffixes,omitempty"` // Appended to short names on the client
+
+	// Administrators without a second factor must enroll one at their next sign-in
+	RequireAdminMFA bool `gorm:"default:false" json:"require_admin_mfa"`
+
+	// A gateway connecting from changed hardware waits for an administrator's
+	// approval instead of being refused
+	GatewayHardwareApproval bool `gorm:"default:false" json:"gateway_hardware_approval"`
+
+	// VPN sign-ins must carry a signed device posture report
+	RequireDevicePosture bool `gorm:"default:false" json:"require_device_posture"`
+	// A device can only be used once an administrator approved it, and only
+	// by the user who registered it
+	DeviceApproval bool `gorm:"default:false" json:"device_approval"`
+
+	// Password policy for local administrators
+	PasswordMinLength         int  `gorm:"default:12" json:"password_min_length"`
+	PasswordRequireComplexity bool `gorm:"default:true" json:"password_require_complexity"`
+
+	// Administrator sign-in through the tenant's identity provider. While it
+	// is on, only break-glass administrators may use their local password.
+	AdminSSOEnabled            bool       `gorm:"default:false" json:"admin_sso_enabled"`
+	AdminSSOProviderID         *uuid.UUID `gorm:"type:uuid" json:"admin_sso_provider_id,omitempty"`                 // Nil uses the tenant's default provider
+	AdminSSOWorkspaceAdminRole AdminRole  `gorm:"type:varchar(20)" json:"admin_sso_workspace_admin_role,omitempty"` // Role for Google Workspace administrators, empty for none
 }
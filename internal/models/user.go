@@ -1,6 +1,9 @@
 package models
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
 
 type AdminRole string
 
@@ -8,8 +11,36 @@ const (
 	RoleAdmin       AdminRole = "admin"
 	RoleSuperAdmin  AdminRole = "super_admin"
 	RolePolicyAdmin AdminRole = "policy_admin"
+	RoleAuditor     AdminRole = "auditor"  // Reads everything, changes nothing
+	RoleHelpdesk    AdminRole = "helpdesk" // Sees and ends VPN sessions
+
+	// RoleCustom means the permissions come from the administrator's RoleID
+	RoleCustom AdminRole = "custom"
 )
 
+// Valid reports whether r is one of the built-in administrator roles.
+func (r AdminRole) Valid() bool {
+	_, ok := builtinRolePermissions[r]
+	return ok
+}
+
+// Rank orders built-in roles by privilege, higher is more.
+func (r AdminRole) Rank() int {
+	switch r {
+	case RoleSuperAdmin:
+		return 5
+	case RoleAdmin:
+		return 4
+	case RolePolicyAdmin:
+		return 3
+	case RoleHelpdesk:
+		return 2
+	case RoleAuditor:
+		return 1
+	}
+	return 0
+}
+
 // Administrator is a local account for managing the system.
 // These are created and stored in our database.
 type Administrator struct {
@@ -21,6 +52,17 @@ type Administrator struct {
 	Password               string    `json:"-"` // Locally managed password
 	ChangePasswordRequired bool      `gorm:"default:true" json:"change_password_required"`
 	Role                   AdminRole `gorm:"type:varchar(20);default:'admin'" json:"role,omitempty"`
+	BreakGlass             bool      `gorm:"default:false" json:"break_glass"`    // May use the local password while the tenant signs admins in through its IdP
+	SSO                    bool      `gorm:"column:sso;default:false" json:"sso"` // Created by a sign-in through the tenant's IdP, has no password
+
+	// Permissions of a custom role, when Role is RoleCustom
+	RoleID     *uuid.UUID `gorm:"type:uuid" json:"role_id,omitempty"`
+	CustomRole *Role      `gorm:"foreignKey:RoleID" json:"custom_role,omitempty"`
+
+	// Optional scope: when set, node, session and application permissions
+	// only apply to these nodes and applications
+	NodeIDs        []uuid.UUID `gorm:"serializer:json;type:text" json:"node_ids,omitempty"`
+	ApplicationIDs []uuid.UUID `gorm:"serializer:json;type:text" json:"application_ids,omitempty"`
 }
 
 func (a *Administrator) SetPassword(password string) error {
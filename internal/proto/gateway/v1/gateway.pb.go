@@ -23,7 +23,6 @@ const (
 
 type GetSessionIPRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	AuthToken     string                 `protobuf:"bytes,1,opt,name=auth_token,json=authToken,proto3" json:"auth_token,omitempty"` // Gateway auth token
 	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
 	UserEmail     string                 `protobuf:"bytes,3,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`
 	unknownFields protoimpl.UnknownFields
@@ -60,13 +59,6 @@ func (*GetSessionIPRequest) Descriptor() ([]byte, []int) {
 	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{0}
 }
 
-func (x *GetSessionIPRequest) GetAuthToken() string {
-	if x != nil {
-		return x.AuthToken
-	}
-	return ""
-}
-
 func (x *GetSessionIPRequest) GetUserId() string {
 	if x != nil {
 		return x.UserId
@@ -127,7 +119,6 @@ func (x *GetSessionIPResponse) GetIpAddress() string {
 
 type SyncSessionsRequest struct {
 	state         protoimpl.MessageState         `protogen:"open.v1"`
-	AuthToken     string                         `protobuf:"bytes,1,opt,name=auth_token,json=authToken,proto3" json:"auth_token,omitempty"`
 	Sessions      []*SyncSessionsRequest_Session `protobuf:"bytes,2,rep,name=sessions,proto3" json:"sessions,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -163,13 +154,6 @@ func (*SyncSessionsRequest) Descriptor() ([]byte, []int) {
 	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{2}
 }
 
-func (x *SyncSessionsRequest) GetAuthToken() string {
-	if x != nil {
-		return x.AuthToken
-	}
-	return ""
-}
-
 func (x *SyncSessionsRequest) GetSessions() []*SyncSessionsRequest_Session {
 	if x != nil {
 		return x.Sessions
@@ -221,29 +205,30 @@ func (x *SyncSessionsResponse) GetSuccess() bool {
 	return false
 }
 
-type RegisterRequest struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	NodeId        string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
-	Hostname      string                 `protobuf:"bytes,2,opt,name=hostname,proto3" json:"hostname,omitempty"`
-	DeviceHash    string                 `protobuf:"bytes,3,opt,name=device_hash,json=deviceHash,proto3" json:"device_hash,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+type EnrollRequest struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	EnrollmentToken string                 `protobuf:"bytes,1,opt,name=enrollment_token,json=enrollmentToken,proto3" json:"enrollment_token,omitempty"`
+	CsrPem          string                 `protobuf:"bytes,2,opt,name=csr_pem,json=csrPem,proto3" json:"csr_pem,omitempty"` // PKCS#10 request for the gateway's private key
+	Hostname        string                 `protobuf:"bytes,3,opt,name=hostname,proto3" json:"hostname,omitempty"`
+	DeviceHash      string                 `protobuf:"bytes,4,opt,name=device_hash,json=deviceHash,proto3" json:"device_hash,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
 }
 
-func (x *RegisterRequest) Reset() {
-	*x = RegisterRequest{}
+func (x *EnrollRequest) Reset() {
+	*x = EnrollRequest{}
 	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *RegisterRequest) String() string {
+func (x *EnrollRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*RegisterRequest) ProtoMessage() {}
+func (*EnrollRequest) ProtoMessage() {}
 
-func (x *RegisterRequest) ProtoReflect() protoreflect.Message {
+func (x *EnrollRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -255,53 +240,62 @@ func (x *RegisterRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use RegisterRequest.ProtoReflect.Descriptor instead.
-func (*RegisterRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use EnrollRequest.ProtoReflect.Descriptor instead.
+func (*EnrollRequest) Descriptor() ([]byte, []int) {
 	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{4}
 }
 
-func (x *RegisterRequest) GetNodeId() string {
+func (x *EnrollRequest) GetEnrollmentToken() string {
 	if x != nil {
-		return x.NodeId
+		return x.EnrollmentToken
+	}
+	return ""
+}
+
+func (x *EnrollRequest) GetCsrPem() string {
+	if x != nil {
+		return x.CsrPem
 	}
 	return ""
 }
 
-func (x *RegisterRequest) GetHostname() string {
+func (x *EnrollRequest) GetHostname() string {
 	if x != nil {
 		return x.Hostname
 	}
 	return ""
 }
 
-func (x *RegisterRequest) GetDeviceHash() string {
+func (x *EnrollRequest) GetDeviceHash() string {
 	if x != nil {
 		return x.DeviceHash
 	}
 	return ""
 }
 
-type RegisterResponse struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	AuthToken     string                 `protobuf:"bytes,1,opt,name=auth_token,json=authToken,proto3" json:"auth_token,omitempty"`
-	unknownFields protoimpl.UnknownFields
-	sizeCache     protoimpl.SizeCache
+type EnrollResponse struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	NodeId           string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`
+	CertificatePem   string                 `protobuf:"bytes,2,opt,name=certificate_pem,json=certificatePem,proto3" json:"certificate_pem,omitempty"`
+	CaCertificatePem string                 `protobuf:"bytes,3,opt,name=ca_certificate_pem,json=caCertificatePem,proto3" json:"ca_certificate_pem,omitempty"` // Gateway CA, trusted for the control plane from now on
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
 }
 
-func (x *RegisterResponse) Reset() {
-	*x = RegisterResponse{}
+func (x *EnrollResponse) Reset() {
+	*x = EnrollResponse{}
 	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *RegisterResponse) String() string {
+func (x *EnrollResponse) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*RegisterResponse) ProtoMessage() {}
+func (*EnrollResponse) ProtoMessage() {}
 
-func (x *RegisterResponse) ProtoReflect() protoreflect.Message {
+func (x *EnrollResponse) ProtoReflect() protoreflect.Message {
 	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -313,41 +307,53 @@ func (x *RegisterResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use RegisterResponse.ProtoReflect.Descriptor instead.
-func (*RegisterResponse) Descriptor() ([]byte, []int) {
+// Deprecated: Use EnrollResponse.ProtoReflect.Descriptor instead.
+func (*EnrollResponse) Descriptor() ([]byte, []int) {
 	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{5}
 }
 
-func (x *RegisterResponse) GetAuthToken() string {
+func (x *EnrollResponse) GetNodeId() string {
 	if x != nil {
-		return x.AuthToken
+		return x.NodeId
 	}
 	return ""
 }
 
-type HeartbeatRequest struct {
+func (x *EnrollResponse) GetCertificatePem() string {
+	if x != nil {
+		return x.CertificatePem
+	}
+	return ""
+}
+
+func (x *EnrollResponse) GetCaCertificatePem() string {
+	if x != nil {
+		return x.CaCertificatePem
+	}
+	return ""
+}
+
+type RenewCertificateRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	AuthToken     string                 `protobuf:"bytes,1,opt,name=auth_token,json=authToken,proto3" json:"auth_token,omitempty"`
-	Status        string                 `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`
-	ConfigHash    string                 `protobuf:"bytes,3,opt,name=config_hash,json=configHash,proto3" json:"config_hash,omitempty"` // Current config hash
+	CsrPem        string                 `protobuf:"bytes,1,opt,name=csr_pem,json=csrPem,proto3" json:"csr_pem,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *HeartbeatRequest) Reset() {
-	*x = HeartbeatRequest{}
+func (x *RenewCertificateRequest) Reset() {
+	*x = RenewCertificateRequest{}
 	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *HeartbeatRequest) String() string {
+func (x *RenewCertificateRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*HeartbeatRequest) ProtoMessage() {}
+func (*RenewCertificateRequest) ProtoMessage() {}
 
-func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+func (x *RenewCertificateRequest) ProtoReflect() protoreflect.Message {
 	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -359,18 +365,109 @@ func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
-func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+// Deprecated: Use RenewCertificateRequest.ProtoReflect.Descriptor instead.
+func (*RenewCertificateRequest) Descriptor() ([]byte, []int) {
 	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{6}
 }
 
-func (x *HeartbeatRequest) GetAuthToken() string {
+func (x *RenewCertificateRequest) GetCsrPem() string {
+	if x != nil {
+		return x.CsrPem
+	}
+	return ""
+}
+
+type RenewCertificateResponse struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	CertificatePem string                 `protobuf:"bytes,1,opt,name=certificate_pem,json=certificatePem,proto3" json:"certificate_pem,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *RenewCertificateResponse) Reset() {
+	*x = RenewCertificateResponse{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenewCertificateResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenewCertificateResponse) ProtoMessage() {}
+
+func (x *RenewCertificateResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenewCertificateResponse.ProtoReflect.Descriptor instead.
+func (*RenewCertificateResponse) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *RenewCertificateResponse) GetCertificatePem() string {
 	if x != nil {
-		return x.AuthToken
+		return x.CertificatePem
 	}
 	return ""
 }
 
+type HeartbeatRequest struct {
+	state      protoimpl.MessageState        `protogen:"open.v1"`
+	Status     string                        `protobuf:"bytes,2,opt,name=status,proto3" json:"status,omitempty"`                           // ONLINE, or DRAINING while the gateway moves its clients away to shut down
+	ConfigHash string                        `protobuf:"bytes,3,opt,name=config_hash,json=configHash,proto3" json:"config_hash,omitempty"` // Current config hash
+	AppHealth  []*HeartbeatRequest_AppHealth `protobuf:"bytes,4,rep,name=app_health,json=appHealth,proto3" json:"app_health,omitempty"`    // Latest results of the configured health checks
+	// Subnets this gateway reaches, served to the tenant's other sites
+	AdvertisedRoutes []string `protobuf:"bytes,5,rep,name=advertised_routes,json=advertisedRoutes,proto3" json:"advertised_routes,omitempty"`
+	// Where other gateways open the peer tunnel: "host:port", or ":port" for
+	// the address the control plane sees the gateway connect from
+	PeerAddress string `protobuf:"bytes,6,opt,name=peer_address,json=peerAddress,proto3" json:"peer_address,omitempty"`
+	// A connector serves its advertised routes to the other gateways over
+	// tunnels it opens itself, and takes no clients
+	Connector     bool `protobuf:"varint,7,opt,name=connector,proto3" json:"connector,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest) Reset() {
+	*x = HeartbeatRequest{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest) ProtoMessage() {}
+
+func (x *HeartbeatRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatRequest.ProtoReflect.Descriptor instead.
+func (*HeartbeatRequest) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{8}
+}
+
 func (x *HeartbeatRequest) GetStatus() string {
 	if x != nil {
 		return x.Status
@@ -385,6 +482,34 @@ func (x *HeartbeatRequest) GetConfigHash() string {
 	return ""
 }
 
+func (x *HeartbeatRequest) GetAppHealth() []*HeartbeatRequest_AppHealth {
+	if x != nil {
+		return x.AppHealth
+	}
+	return nil
+}
+
+func (x *HeartbeatRequest) GetAdvertisedRoutes() []string {
+	if x != nil {
+		return x.AdvertisedRoutes
+	}
+	return nil
+}
+
+func (x *HeartbeatRequest) GetPeerAddress() string {
+	if x != nil {
+		return x.PeerAddress
+	}
+	return ""
+}
+
+func (x *HeartbeatRequest) GetConnector() bool {
+	if x != nil {
+		return x.Connector
+	}
+	return false
+}
+
 type HeartbeatResponse struct {
 	state                 protoimpl.MessageState `protogen:"open.v1"`
 	Success               bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
@@ -395,7 +520,7 @@ type HeartbeatResponse struct {
 
 func (x *HeartbeatResponse) Reset() {
 	*x = HeartbeatResponse{}
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[7]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -407,7 +532,7 @@ func (x *HeartbeatResponse) String() string {
 func (*HeartbeatResponse) ProtoMessage() {}
 
 func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[7]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -420,7 +545,7 @@ func (x *HeartbeatResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use HeartbeatResponse.ProtoReflect.Descriptor instead.
 func (*HeartbeatResponse) Descriptor() ([]byte, []int) {
-	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{7}
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *HeartbeatResponse) GetSuccess() bool {
@@ -439,14 +564,13 @@ func (x *HeartbeatResponse) GetConfigUpdateAvailable() bool {
 
 type GetConfigRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	AuthToken     string                 `protobuf:"bytes,1,opt,name=auth_token,json=authToken,proto3" json:"auth_token,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GetConfigRequest) Reset() {
 	*x = GetConfigRequest{}
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[8]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -458,7 +582,7 @@ func (x *GetConfigRequest) String() string {
 func (*GetConfigRequest) ProtoMessage() {}
 
 func (x *GetConfigRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[8]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -471,30 +595,32 @@ func (x *GetConfigRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetConfigRequest.ProtoReflect.Descriptor instead.
 func (*GetConfigRequest) Descriptor() ([]byte, []int) {
-	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{8}
-}
-
-func (x *GetConfigRequest) GetAuthToken() string {
-	if x != nil {
-		return x.AuthToken
-	}
-	return ""
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{10}
 }
 
 type GetConfigResponse struct {
-	state            protoimpl.MessageState      `protogen:"open.v1"`
-	VpnCidr          string                      `protobuf:"bytes,1,opt,name=vpn_cidr,json=vpnCidr,proto3" json:"vpn_cidr,omitempty"`
-	PublicKeyPem     string                      `protobuf:"bytes,2,opt,name=public_key_pem,json=publicKeyPem,proto3" json:"public_key_pem,omitempty"`
-	ConfigHash       string                      `protobuf:"bytes,3,opt,name=config_hash,json=configHash,proto3" json:"config_hash,omitempty"`
-	Policies         []*GetConfigResponse_Policy `protobuf:"bytes,4,rep,name=policies,proto3" json:"policies,omitempty"`
-	MaxBandwidthMbps int64                       `protobuf:"varint,5,opt,name=max_bandwidth_mbps,json=maxBandwidthMbps,proto3" json:"max_bandwidth_mbps,omitempty"`
-	unknownFields    protoimpl.UnknownFields
-	sizeCache        protoimpl.SizeCache
+	state             protoimpl.MessageState           `protogen:"open.v1"`
+	VpnCidr           string                           `protobuf:"bytes,1,opt,name=vpn_cidr,json=vpnCidr,proto3" json:"vpn_cidr,omitempty"`
+	PublicKeyPem      string                           `protobuf:"bytes,2,opt,name=public_key_pem,json=publicKeyPem,proto3" json:"public_key_pem,omitempty"`
+	ConfigHash        string                           `protobuf:"bytes,3,opt,name=config_hash,json=configHash,proto3" json:"config_hash,omitempty"`
+	Policies          []*GetConfigResponse_Policy      `protobuf:"bytes,4,rep,name=policies,proto3" json:"policies,omitempty"`
+	MaxBandwidthMbps  int64                            `protobuf:"varint,5,opt,name=max_bandwidth_mbps,json=maxBandwidthMbps,proto3" json:"max_bandwidth_mbps,omitempty"`
+	BlockedDeviceIds  []string                         `protobuf:"bytes,6,rep,name=blocked_device_ids,json=blockedDeviceIds,proto3" json:"blocked_device_ids,omitempty"` // Devices whose sessions must be refused
+	Dns               *GetConfigResponse_DNSConfig     `protobuf:"bytes,7,opt,name=dns,proto3" json:"dns,omitempty"`
+	HealthChecks      []*GetConfigResponse_HealthCheck `protobuf:"bytes,8,rep,name=health_checks,json=healthChecks,proto3" json:"health_checks,omitempty"`
+	RevokedUserEmails []string                         `protobuf:"bytes,9,rep,name=revoked_user_emails,json=revokedUserEmails,proto3" json:"revoked_user_emails,omitempty"` // Users deprovisioned by the directory; their sessions are closed
+	// Sessions ended by an administrator: user email to the Unix time of the
+	// revocation. Sessions and tokens from before it are refused.
+	RevokedSessions map[string]int64          `protobuf:"bytes,10,rep,name=revoked_sessions,json=revokedSessions,proto3" json:"revoked_sessions,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	Peers           []*GetConfigResponse_Peer `protobuf:"bytes,11,rep,name=peers,proto3" json:"peers,omitempty"`
+	Egress          *GetConfigResponse_Egress `protobuf:"bytes,12,opt,name=egress,proto3" json:"egress,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
 }
 
 func (x *GetConfigResponse) Reset() {
 	*x = GetConfigResponse{}
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[9]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -506,7 +632,7 @@ func (x *GetConfigResponse) String() string {
 func (*GetConfigResponse) ProtoMessage() {}
 
 func (x *GetConfigResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[9]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -519,7 +645,7 @@ func (x *GetConfigResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetConfigResponse.ProtoReflect.Descriptor instead.
 func (*GetConfigResponse) Descriptor() ([]byte, []int) {
-	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{9}
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *GetConfigResponse) GetVpnCidr() string {
@@ -557,19 +683,69 @@ func (x *GetConfigResponse) GetMaxBandwidthMbps() int64 {
 	return 0
 }
 
+func (x *GetConfigResponse) GetBlockedDeviceIds() []string {
+	if x != nil {
+		return x.BlockedDeviceIds
+	}
+	return nil
+}
+
+func (x *GetConfigResponse) GetDns() *GetConfigResponse_DNSConfig {
+	if x != nil {
+		return x.Dns
+	}
+	return nil
+}
+
+func (x *GetConfigResponse) GetHealthChecks() []*GetConfigResponse_HealthCheck {
+	if x != nil {
+		return x.HealthChecks
+	}
+	return nil
+}
+
+func (x *GetConfigResponse) GetRevokedUserEmails() []string {
+	if x != nil {
+		return x.RevokedUserEmails
+	}
+	return nil
+}
+
+func (x *GetConfigResponse) GetRevokedSessions() map[string]int64 {
+	if x != nil {
+		return x.RevokedSessions
+	}
+	return nil
+}
+
+func (x *GetConfigResponse) GetPeers() []*GetConfigResponse_Peer {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+func (x *GetConfigResponse) GetEgress() *GetConfigResponse_Egress {
+	if x != nil {
+		return x.Egress
+	}
+	return nil
+}
+
 type SyncSessionsRequest_Session struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
 	UserEmail     string                 `protobuf:"bytes,2,opt,name=user_email,json=userEmail,proto3" json:"user_email,omitempty"`
 	IpAddress     string                 `protobuf:"bytes,3,opt,name=ip_address,json=ipAddress,proto3" json:"ip_address,omitempty"`
 	ConnectedAt   int64                  `protobuf:"varint,4,opt,name=connected_at,json=connectedAt,proto3" json:"connected_at,omitempty"`
+	DeviceId      string                 `protobuf:"bytes,5,opt,name=device_id,json=deviceId,proto3" json:"device_id,omitempty"` // Attested device, empty if the client did not report posture
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *SyncSessionsRequest_Session) Reset() {
 	*x = SyncSessionsRequest_Session{}
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[10]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -581,7 +757,7 @@ func (x *SyncSessionsRequest_Session) String() string {
 func (*SyncSessionsRequest_Session) ProtoMessage() {}
 
 func (x *SyncSessionsRequest_Session) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[10]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -625,6 +801,89 @@ func (x *SyncSessionsRequest_Session) GetConnectedAt() int64 {
 	return 0
 }
 
+func (x *SyncSessionsRequest_Session) GetDeviceId() string {
+	if x != nil {
+		return x.DeviceId
+	}
+	return ""
+}
+
+type HeartbeatRequest_AppHealth struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ApplicationId string                 `protobuf:"bytes,1,opt,name=application_id,json=applicationId,proto3" json:"application_id,omitempty"`
+	Healthy       bool                   `protobuf:"varint,2,opt,name=healthy,proto3" json:"healthy,omitempty"`
+	LatencyMs     int64                  `protobuf:"varint,3,opt,name=latency_ms,json=latencyMs,proto3" json:"latency_ms,omitempty"`
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"`
+	CheckedAt     int64                  `protobuf:"varint,5,opt,name=checked_at,json=checkedAt,proto3" json:"checked_at,omitempty"` // Unix seconds
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HeartbeatRequest_AppHealth) Reset() {
+	*x = HeartbeatRequest_AppHealth{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HeartbeatRequest_AppHealth) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HeartbeatRequest_AppHealth) ProtoMessage() {}
+
+func (x *HeartbeatRequest_AppHealth) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HeartbeatRequest_AppHealth.ProtoReflect.Descriptor instead.
+func (*HeartbeatRequest_AppHealth) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{8, 0}
+}
+
+func (x *HeartbeatRequest_AppHealth) GetApplicationId() string {
+	if x != nil {
+		return x.ApplicationId
+	}
+	return ""
+}
+
+func (x *HeartbeatRequest_AppHealth) GetHealthy() bool {
+	if x != nil {
+		return x.Healthy
+	}
+	return false
+}
+
+func (x *HeartbeatRequest_AppHealth) GetLatencyMs() int64 {
+	if x != nil {
+		return x.LatencyMs
+	}
+	return 0
+}
+
+func (x *HeartbeatRequest_AppHealth) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *HeartbeatRequest_AppHealth) GetCheckedAt() int64 {
+	if x != nil {
+		return x.CheckedAt
+	}
+	return 0
+}
+
 type GetConfigResponse_Policy struct {
 	state                 protoimpl.MessageState `protogen:"open.v1"`
 	Name                  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
@@ -634,13 +893,19 @@ type GetConfigResponse_Policy struct {
 	DestinationTagType    string                 `protobuf:"bytes,5,opt,name=destination_tag_type,json=destinationTagType,proto3" json:"destination_tag_type,omitempty"`
 	DestinationMatchValue string                 `protobuf:"bytes,6,opt,name=destination_match_value,json=destinationMatchValue,proto3" json:"destination_match_value,omitempty"`
 	Priority              int32                  `protobuf:"varint,7,opt,name=priority,proto3" json:"priority,omitempty"`
-	unknownFields         protoimpl.UnknownFields
-	sizeCache             protoimpl.SizeCache
+	// All time conditions must hold for the rule to be active (AND)
+	TimeConditions []*GetConfigResponse_TimeCondition `protobuf:"bytes,8,rep,name=time_conditions,json=timeConditions,proto3" json:"time_conditions,omitempty"`
+	// All device posture conditions must hold for the session (AND)
+	DeviceConditions []*GetConfigResponse_DeviceCondition `protobuf:"bytes,9,rep,name=device_conditions,json=deviceConditions,proto3" json:"device_conditions,omitempty"`
+	// Destination ports the rule is limited to; empty = all ports
+	Ports         []*GetConfigResponse_PortRange `protobuf:"bytes,10,rep,name=ports,proto3" json:"ports,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *GetConfigResponse_Policy) Reset() {
 	*x = GetConfigResponse_Policy{}
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[11]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -652,7 +917,7 @@ func (x *GetConfigResponse_Policy) String() string {
 func (*GetConfigResponse_Policy) ProtoMessage() {}
 
 func (x *GetConfigResponse_Policy) ProtoReflect() protoreflect.Message {
-	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[11]
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -665,7 +930,7 @@ func (x *GetConfigResponse_Policy) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetConfigResponse_Policy.ProtoReflect.Descriptor instead.
 func (*GetConfigResponse_Policy) Descriptor() ([]byte, []int) {
-	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{9, 0}
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11, 0}
 }
 
 func (x *GetConfigResponse_Policy) GetName() string {
@@ -717,61 +982,593 @@ func (x *GetConfigResponse_Policy) GetPriority() int32 {
 	return 0
 }
 
-var File_internal_proto_gateway_v1_gateway_proto protoreflect.FileDescriptor
+func (x *GetConfigResponse_Policy) GetTimeConditions() []*GetConfigResponse_TimeCondition {
+	if x != nil {
+		return x.TimeConditions
+	}
+	return nil
+}
 
-const file_internal_proto_gateway_v1_gateway_proto_rawDesc = "" +
-	"\n" +
-	"'internal/proto/gateway/v1/gateway.proto\x12\n" +
-	"gateway.v1\"l\n" +
-	"\x13GetSessionIPRequest\x12\x1d\n" +
+func (x *GetConfigResponse_Policy) GetDeviceConditions() []*GetConfigResponse_DeviceCondition {
+	if x != nil {
+		return x.DeviceConditions
+	}
+	return nil
+}
+
+func (x *GetConfigResponse_Policy) GetPorts() []*GetConfigResponse_PortRange {
+	if x != nil {
+		return x.Ports
+	}
+	return nil
+}
+
+type GetConfigResponse_PortRange struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Protocol      string                 `protobuf:"bytes,1,opt,name=protocol,proto3" json:"protocol,omitempty"` // "tcp", "udp", empty = both
+	From          uint32                 `protobuf:"varint,2,opt,name=from,proto3" json:"from,omitempty"`
+	To            uint32                 `protobuf:"varint,3,opt,name=to,proto3" json:"to,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse_PortRange) Reset() {
+	*x = GetConfigResponse_PortRange{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse_PortRange) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse_PortRange) ProtoMessage() {}
+
+func (x *GetConfigResponse_PortRange) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse_PortRange.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse_PortRange) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11, 1}
+}
+
+func (x *GetConfigResponse_PortRange) GetProtocol() string {
+	if x != nil {
+		return x.Protocol
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_PortRange) GetFrom() uint32 {
+	if x != nil {
+		return x.From
+	}
+	return 0
+}
+
+func (x *GetConfigResponse_PortRange) GetTo() uint32 {
+	if x != nil {
+		return x.To
+	}
+	return 0
+}
+
+type GetConfigResponse_TimeCondition struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"` // "time_of_day", "weekday", "date"
+	Op            string                 `protobuf:"bytes,2,opt,name=op,proto3" json:"op,omitempty"`
+	Value         string                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	Timezone      string                 `protobuf:"bytes,4,opt,name=timezone,proto3" json:"timezone,omitempty"` // IANA name, empty = UTC
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse_TimeCondition) Reset() {
+	*x = GetConfigResponse_TimeCondition{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse_TimeCondition) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse_TimeCondition) ProtoMessage() {}
+
+func (x *GetConfigResponse_TimeCondition) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse_TimeCondition.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse_TimeCondition) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11, 2}
+}
+
+func (x *GetConfigResponse_TimeCondition) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_TimeCondition) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_TimeCondition) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_TimeCondition) GetTimezone() string {
+	if x != nil {
+		return x.Timezone
+	}
+	return ""
+}
+
+type GetConfigResponse_DeviceCondition struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"` // "os_version", "disk_encrypted", "firewall_enabled", "screen_lock_enabled", "client_version"
+	Op            string                 `protobuf:"bytes,2,opt,name=op,proto3" json:"op,omitempty"`
+	Value         string                 `protobuf:"bytes,3,opt,name=value,proto3" json:"value,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse_DeviceCondition) Reset() {
+	*x = GetConfigResponse_DeviceCondition{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse_DeviceCondition) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse_DeviceCondition) ProtoMessage() {}
+
+func (x *GetConfigResponse_DeviceCondition) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse_DeviceCondition.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse_DeviceCondition) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11, 3}
+}
+
+func (x *GetConfigResponse_DeviceCondition) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_DeviceCondition) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_DeviceCondition) GetValue() string {
+	if x != nil {
+		return x.Value
+	}
+	return ""
+}
+
+// Split DNS served by the gateway's forwarder and pushed to clients
+type GetConfigResponse_DNSConfig struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Domains        []string               `protobuf:"bytes,1,rep,name=domains,proto3" json:"domains,omitempty"`     // Internal domains, e.g. "corp.internal"
+	Resolvers      []string               `protobuf:"bytes,2,rep,name=resolvers,proto3" json:"resolvers,omitempty"` // Upstream resolvers, "ip" or "ip:port"
+	SearchSuffixes []string               `protobuf:"bytes,3,rep,name=search_suffixes,json=searchSuffixes,proto3" json:"search_suffixes,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse_DNSConfig) Reset() {
+	*x = GetConfigResponse_DNSConfig{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse_DNSConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse_DNSConfig) ProtoMessage() {}
+
+func (x *GetConfigResponse_DNSConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse_DNSConfig.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse_DNSConfig) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11, 4}
+}
+
+func (x *GetConfigResponse_DNSConfig) GetDomains() []string {
+	if x != nil {
+		return x.Domains
+	}
+	return nil
+}
+
+func (x *GetConfigResponse_DNSConfig) GetResolvers() []string {
+	if x != nil {
+		return x.Resolvers
+	}
+	return nil
+}
+
+func (x *GetConfigResponse_DNSConfig) GetSearchSuffixes() []string {
+	if x != nil {
+		return x.SearchSuffixes
+	}
+	return nil
+}
+
+// Application health checks the gateway probes and reports in its heartbeat
+type GetConfigResponse_HealthCheck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ApplicationId string                 `protobuf:"bytes,1,opt,name=application_id,json=applicationId,proto3" json:"application_id,omitempty"`
+	Target        string                 `protobuf:"bytes,2,opt,name=target,proto3" json:"target,omitempty"` // "host:port", probed over TCP
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse_HealthCheck) Reset() {
+	*x = GetConfigResponse_HealthCheck{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse_HealthCheck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse_HealthCheck) ProtoMessage() {}
+
+func (x *GetConfigResponse_HealthCheck) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse_HealthCheck.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse_HealthCheck) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11, 5}
+}
+
+func (x *GetConfigResponse_HealthCheck) GetApplicationId() string {
+	if x != nil {
+		return x.ApplicationId
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_HealthCheck) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+// Other gateways of the tenant, reached over the peer tunnel. Client
+// traffic to a peer's routes is relayed to it, and replies to its clients
+// are sent back to it.
+type GetConfigResponse_Peer struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	NodeId        string                 `protobuf:"bytes,1,opt,name=node_id,json=nodeId,proto3" json:"node_id,omitempty"`             // Common name of the peer's certificate
+	Address       string                 `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`                         // "host:port" of its peer tunnel; empty for a connector, which opens it
+	Routes        []string               `protobuf:"bytes,3,rep,name=routes,proto3" json:"routes,omitempty"`                           // Subnets this gateway relays to the peer
+	ClientPool    string                 `protobuf:"bytes,4,opt,name=client_pool,json=clientPool,proto3" json:"client_pool,omitempty"` // The peer's client addresses
+	CertSerial    string                 `protobuf:"bytes,5,opt,name=cert_serial,json=certSerial,proto3" json:"cert_serial,omitempty"` // Serial of the peer's current certificate, in hex; others are refused
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse_Peer) Reset() {
+	*x = GetConfigResponse_Peer{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse_Peer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse_Peer) ProtoMessage() {}
+
+func (x *GetConfigResponse_Peer) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse_Peer.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse_Peer) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11, 7}
+}
+
+func (x *GetConfigResponse_Peer) GetNodeId() string {
+	if x != nil {
+		return x.NodeId
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_Peer) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_Peer) GetRoutes() []string {
+	if x != nil {
+		return x.Routes
+	}
+	return nil
+}
+
+func (x *GetConfigResponse_Peer) GetClientPool() string {
+	if x != nil {
+		return x.ClientPool
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_Peer) GetCertSerial() string {
+	if x != nil {
+		return x.CertSerial
+	}
+	return ""
+}
+
+// How client traffic leaves the gateway: "masquerade" (the default),
+// "routed" without translation, or "snat" with a source per destination
+type GetConfigResponse_Egress struct {
+	state         protoimpl.MessageState               `protogen:"open.v1"`
+	Mode          string                               `protobuf:"bytes,1,opt,name=mode,proto3" json:"mode,omitempty"`
+	SnatPools     []*GetConfigResponse_Egress_SNATPool `protobuf:"bytes,2,rep,name=snat_pools,json=snatPools,proto3" json:"snat_pools,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse_Egress) Reset() {
+	*x = GetConfigResponse_Egress{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse_Egress) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse_Egress) ProtoMessage() {}
+
+func (x *GetConfigResponse_Egress) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse_Egress.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse_Egress) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11, 8}
+}
+
+func (x *GetConfigResponse_Egress) GetMode() string {
+	if x != nil {
+		return x.Mode
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_Egress) GetSnatPools() []*GetConfigResponse_Egress_SNATPool {
+	if x != nil {
+		return x.SnatPools
+	}
+	return nil
+}
+
+type GetConfigResponse_Egress_SNATPool struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Destination   string                 `protobuf:"bytes,1,opt,name=destination,proto3" json:"destination,omitempty"` // CIDR
+	Source        string                 `protobuf:"bytes,2,opt,name=source,proto3" json:"source,omitempty"`           // Address, CIDR or "first-last" range
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetConfigResponse_Egress_SNATPool) Reset() {
+	*x = GetConfigResponse_Egress_SNATPool{}
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetConfigResponse_Egress_SNATPool) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetConfigResponse_Egress_SNATPool) ProtoMessage() {}
+
+func (x *GetConfigResponse_Egress_SNATPool) ProtoReflect() protoreflect.Message {
+	mi := &file_internal_proto_gateway_v1_gateway_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetConfigResponse_Egress_SNATPool.ProtoReflect.Descriptor instead.
+func (*GetConfigResponse_Egress_SNATPool) Descriptor() ([]byte, []int) {
+	return file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP(), []int{11, 8, 0}
+}
+
+func (x *GetConfigResponse_Egress_SNATPool) GetDestination() string {
+	if x != nil {
+		return x.Destination
+	}
+	return ""
+}
+
+func (x *GetConfigResponse_Egress_SNATPool) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+var File_internal_proto_gateway_v1_gateway_proto protoreflect.FileDescriptor
+
+const file_internal_proto_gateway_v1_gateway_proto_rawDesc = "" +
 	"\n" +
-	"auth_token\x18\x01 \x01(\tR\tauthToken\x12\x17\n" +
+	"'internal/proto/gateway/v1/gateway.proto\x12\n" +
+	"gateway.v1\"_\n" +
+	"\x13GetSessionIPRequest\x12\x17\n" +
 	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1d\n" +
 	"\n" +
-	"user_email\x18\x03 \x01(\tR\tuserEmail\"5\n" +
+	"user_email\x18\x03 \x01(\tR\tuserEmailJ\x04\b\x01\x10\x02R\n" +
+	"auth_token\"5\n" +
 	"\x14GetSessionIPResponse\x12\x1d\n" +
 	"\n" +
-	"ip_address\x18\x01 \x01(\tR\tipAddress\"\xff\x01\n" +
-	"\x13SyncSessionsRequest\x12\x1d\n" +
-	"\n" +
-	"auth_token\x18\x01 \x01(\tR\tauthToken\x12C\n" +
-	"\bsessions\x18\x02 \x03(\v2'.gateway.v1.SyncSessionsRequest.SessionR\bsessions\x1a\x83\x01\n" +
+	"ip_address\x18\x01 \x01(\tR\tipAddress\"\x8f\x02\n" +
+	"\x13SyncSessionsRequest\x12C\n" +
+	"\bsessions\x18\x02 \x03(\v2'.gateway.v1.SyncSessionsRequest.SessionR\bsessions\x1a\xa0\x01\n" +
 	"\aSession\x12\x17\n" +
 	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1d\n" +
 	"\n" +
 	"user_email\x18\x02 \x01(\tR\tuserEmail\x12\x1d\n" +
 	"\n" +
 	"ip_address\x18\x03 \x01(\tR\tipAddress\x12!\n" +
-	"\fconnected_at\x18\x04 \x01(\x03R\vconnectedAt\"0\n" +
+	"\fconnected_at\x18\x04 \x01(\x03R\vconnectedAt\x12\x1b\n" +
+	"\tdevice_id\x18\x05 \x01(\tR\bdeviceIdJ\x04\b\x01\x10\x02R\n" +
+	"auth_token\"0\n" +
 	"\x14SyncSessionsResponse\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess\"g\n" +
-	"\x0fRegisterRequest\x12\x17\n" +
-	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12\x1a\n" +
-	"\bhostname\x18\x02 \x01(\tR\bhostname\x12\x1f\n" +
-	"\vdevice_hash\x18\x03 \x01(\tR\n" +
-	"deviceHash\"1\n" +
-	"\x10RegisterResponse\x12\x1d\n" +
-	"\n" +
-	"auth_token\x18\x01 \x01(\tR\tauthToken\"j\n" +
-	"\x10HeartbeatRequest\x12\x1d\n" +
-	"\n" +
-	"auth_token\x18\x01 \x01(\tR\tauthToken\x12\x16\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\"\x90\x01\n" +
+	"\rEnrollRequest\x12)\n" +
+	"\x10enrollment_token\x18\x01 \x01(\tR\x0fenrollmentToken\x12\x17\n" +
+	"\acsr_pem\x18\x02 \x01(\tR\x06csrPem\x12\x1a\n" +
+	"\bhostname\x18\x03 \x01(\tR\bhostname\x12\x1f\n" +
+	"\vdevice_hash\x18\x04 \x01(\tR\n" +
+	"deviceHash\"\x80\x01\n" +
+	"\x0eEnrollResponse\x12\x17\n" +
+	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12'\n" +
+	"\x0fcertificate_pem\x18\x02 \x01(\tR\x0ecertificatePem\x12,\n" +
+	"\x12ca_certificate_pem\x18\x03 \x01(\tR\x10caCertificatePem\"2\n" +
+	"\x17RenewCertificateRequest\x12\x17\n" +
+	"\acsr_pem\x18\x01 \x01(\tR\x06csrPem\"C\n" +
+	"\x18RenewCertificateResponse\x12'\n" +
+	"\x0fcertificate_pem\x18\x01 \x01(\tR\x0ecertificatePem\"\xb5\x03\n" +
+	"\x10HeartbeatRequest\x12\x16\n" +
 	"\x06status\x18\x02 \x01(\tR\x06status\x12\x1f\n" +
 	"\vconfig_hash\x18\x03 \x01(\tR\n" +
-	"configHash\"e\n" +
+	"configHash\x12E\n" +
+	"\n" +
+	"app_health\x18\x04 \x03(\v2&.gateway.v1.HeartbeatRequest.AppHealthR\tappHealth\x12+\n" +
+	"\x11advertised_routes\x18\x05 \x03(\tR\x10advertisedRoutes\x12!\n" +
+	"\fpeer_address\x18\x06 \x01(\tR\vpeerAddress\x12\x1c\n" +
+	"\tconnector\x18\a \x01(\bR\tconnector\x1a\xa0\x01\n" +
+	"\tAppHealth\x12%\n" +
+	"\x0eapplication_id\x18\x01 \x01(\tR\rapplicationId\x12\x18\n" +
+	"\ahealthy\x18\x02 \x01(\bR\ahealthy\x12\x1d\n" +
+	"\n" +
+	"latency_ms\x18\x03 \x01(\x03R\tlatencyMs\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\x12\x1d\n" +
+	"\n" +
+	"checked_at\x18\x05 \x01(\x03R\tcheckedAtJ\x04\b\x01\x10\x02R\n" +
+	"auth_token\"e\n" +
 	"\x11HeartbeatResponse\x12\x18\n" +
 	"\asuccess\x18\x01 \x01(\bR\asuccess\x126\n" +
-	"\x17config_update_available\x18\x02 \x01(\bR\x15configUpdateAvailable\"1\n" +
-	"\x10GetConfigRequest\x12\x1d\n" +
-	"\n" +
-	"auth_token\x18\x01 \x01(\tR\tauthToken\"\xf8\x03\n" +
+	"\x17config_update_available\x18\x02 \x01(\bR\x15configUpdateAvailable\"$\n" +
+	"\x10GetConfigRequestJ\x04\b\x01\x10\x02R\n" +
+	"auth_token\"\xf7\x0f\n" +
 	"\x11GetConfigResponse\x12\x19\n" +
 	"\bvpn_cidr\x18\x01 \x01(\tR\avpnCidr\x12$\n" +
 	"\x0epublic_key_pem\x18\x02 \x01(\tR\fpublicKeyPem\x12\x1f\n" +
 	"\vconfig_hash\x18\x03 \x01(\tR\n" +
 	"configHash\x12@\n" +
 	"\bpolicies\x18\x04 \x03(\v2$.gateway.v1.GetConfigResponse.PolicyR\bpolicies\x12,\n" +
-	"\x12max_bandwidth_mbps\x18\x05 \x01(\x03R\x10maxBandwidthMbps\x1a\x90\x02\n" +
+	"\x12max_bandwidth_mbps\x18\x05 \x01(\x03R\x10maxBandwidthMbps\x12,\n" +
+	"\x12blocked_device_ids\x18\x06 \x03(\tR\x10blockedDeviceIds\x129\n" +
+	"\x03dns\x18\a \x01(\v2'.gateway.v1.GetConfigResponse.DNSConfigR\x03dns\x12N\n" +
+	"\rhealth_checks\x18\b \x03(\v2).gateway.v1.GetConfigResponse.HealthCheckR\fhealthChecks\x12.\n" +
+	"\x13revoked_user_emails\x18\t \x03(\tR\x11revokedUserEmails\x12]\n" +
+	"\x10revoked_sessions\x18\n" +
+	" \x03(\v22.gateway.v1.GetConfigResponse.RevokedSessionsEntryR\x0frevokedSessions\x128\n" +
+	"\x05peers\x18\v \x03(\v2\".gateway.v1.GetConfigResponse.PeerR\x05peers\x12<\n" +
+	"\x06egress\x18\f \x01(\v2$.gateway.v1.GetConfigResponse.EgressR\x06egress\x1a\x81\x04\n" +
 	"\x06Policy\x12\x12\n" +
 	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
 	"\x06action\x18\x02 \x01(\tR\x06action\x12&\n" +
@@ -779,9 +1576,52 @@ const file_internal_proto_gateway_v1_gateway_proto_rawDesc = "" +
 	"\x12source_match_value\x18\x04 \x01(\tR\x10sourceMatchValue\x120\n" +
 	"\x14destination_tag_type\x18\x05 \x01(\tR\x12destinationTagType\x126\n" +
 	"\x17destination_match_value\x18\x06 \x01(\tR\x15destinationMatchValue\x12\x1a\n" +
-	"\bpriority\x18\a \x01(\x05R\bpriority2\x91\x03\n" +
-	"\x0eGatewayService\x12E\n" +
-	"\bRegister\x12\x1b.gateway.v1.RegisterRequest\x1a\x1c.gateway.v1.RegisterResponse\x12H\n" +
+	"\bpriority\x18\a \x01(\x05R\bpriority\x12T\n" +
+	"\x0ftime_conditions\x18\b \x03(\v2+.gateway.v1.GetConfigResponse.TimeConditionR\x0etimeConditions\x12Z\n" +
+	"\x11device_conditions\x18\t \x03(\v2-.gateway.v1.GetConfigResponse.DeviceConditionR\x10deviceConditions\x12=\n" +
+	"\x05ports\x18\n" +
+	" \x03(\v2'.gateway.v1.GetConfigResponse.PortRangeR\x05ports\x1aK\n" +
+	"\tPortRange\x12\x1a\n" +
+	"\bprotocol\x18\x01 \x01(\tR\bprotocol\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\rR\x04from\x12\x0e\n" +
+	"\x02to\x18\x03 \x01(\rR\x02to\x1ag\n" +
+	"\rTimeCondition\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x0e\n" +
+	"\x02op\x18\x02 \x01(\tR\x02op\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\x12\x1a\n" +
+	"\btimezone\x18\x04 \x01(\tR\btimezone\x1aM\n" +
+	"\x0fDeviceCondition\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x0e\n" +
+	"\x02op\x18\x02 \x01(\tR\x02op\x12\x14\n" +
+	"\x05value\x18\x03 \x01(\tR\x05value\x1al\n" +
+	"\tDNSConfig\x12\x18\n" +
+	"\adomains\x18\x01 \x03(\tR\adomains\x12\x1c\n" +
+	"\tresolvers\x18\x02 \x03(\tR\tresolvers\x12'\n" +
+	"\x0fsearch_suffixes\x18\x03 \x03(\tR\x0esearchSuffixes\x1aL\n" +
+	"\vHealthCheck\x12%\n" +
+	"\x0eapplication_id\x18\x01 \x01(\tR\rapplicationId\x12\x16\n" +
+	"\x06target\x18\x02 \x01(\tR\x06target\x1aB\n" +
+	"\x14RevokedSessionsEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\x1a\x93\x01\n" +
+	"\x04Peer\x12\x17\n" +
+	"\anode_id\x18\x01 \x01(\tR\x06nodeId\x12\x18\n" +
+	"\aaddress\x18\x02 \x01(\tR\aaddress\x12\x16\n" +
+	"\x06routes\x18\x03 \x03(\tR\x06routes\x12\x1f\n" +
+	"\vclient_pool\x18\x04 \x01(\tR\n" +
+	"clientPool\x12\x1f\n" +
+	"\vcert_serial\x18\x05 \x01(\tR\n" +
+	"certSerial\x1a\xb0\x01\n" +
+	"\x06Egress\x12\x12\n" +
+	"\x04mode\x18\x01 \x01(\tR\x04mode\x12L\n" +
+	"\n" +
+	"snat_pools\x18\x02 \x03(\v2-.gateway.v1.GetConfigResponse.Egress.SNATPoolR\tsnatPools\x1aD\n" +
+	"\bSNATPool\x12 \n" +
+	"\vdestination\x18\x01 \x01(\tR\vdestination\x12\x16\n" +
+	"\x06source\x18\x02 \x01(\tR\x06source2\xea\x03\n" +
+	"\x0eGatewayService\x12?\n" +
+	"\x06Enroll\x12\x19.gateway.v1.EnrollRequest\x1a\x1a.gateway.v1.EnrollResponse\x12]\n" +
+	"\x10RenewCertificate\x12#.gateway.v1.RenewCertificateRequest\x1a$.gateway.v1.RenewCertificateResponse\x12H\n" +
 	"\tHeartbeat\x12\x1c.gateway.v1.HeartbeatRequest\x1a\x1d.gateway.v1.HeartbeatResponse\x12H\n" +
 	"\tGetConfig\x12\x1c.gateway.v1.GetConfigRequest\x1a\x1d.gateway.v1.GetConfigResponse\x12Q\n" +
 	"\fGetSessionIP\x12\x1f.gateway.v1.GetSessionIPRequest\x1a .gateway.v1.GetSessionIPResponse\x12Q\n" +
@@ -799,39 +1639,63 @@ func file_internal_proto_gateway_v1_gateway_proto_rawDescGZIP() []byte {
 	return file_internal_proto_gateway_v1_gateway_proto_rawDescData
 }
 
-var file_internal_proto_gateway_v1_gateway_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_internal_proto_gateway_v1_gateway_proto_msgTypes = make([]protoimpl.MessageInfo, 24)
 var file_internal_proto_gateway_v1_gateway_proto_goTypes = []any{
-	(*GetSessionIPRequest)(nil),         // 0: gateway.v1.GetSessionIPRequest
-	(*GetSessionIPResponse)(nil),        // 1: gateway.v1.GetSessionIPResponse
-	(*SyncSessionsRequest)(nil),         // 2: gateway.v1.SyncSessionsRequest
-	(*SyncSessionsResponse)(nil),        // 3: gateway.v1.SyncSessionsResponse
-	(*RegisterRequest)(nil),             // 4: gateway.v1.RegisterRequest
-	(*RegisterResponse)(nil),            // 5: gateway.v1.RegisterResponse
-	(*HeartbeatRequest)(nil),            // 6: gateway.v1.HeartbeatRequest
-	(*HeartbeatResponse)(nil),           // 7: gateway.v1.HeartbeatResponse
-	(*GetConfigRequest)(nil),            // 8: gateway.v1.GetConfigRequest
-	(*GetConfigResponse)(nil),           // 9: gateway.v1.GetConfigResponse
-	(*SyncSessionsRequest_Session)(nil), // 10: gateway.v1.SyncSessionsRequest.Session
-	(*GetConfigResponse_Policy)(nil),    // 11: gateway.v1.GetConfigResponse.Policy
+	(*GetSessionIPRequest)(nil),               // 0: gateway.v1.GetSessionIPRequest
+	(*GetSessionIPResponse)(nil),              // 1: gateway.v1.GetSessionIPResponse
+	(*SyncSessionsRequest)(nil),               // 2: gateway.v1.SyncSessionsRequest
+	(*SyncSessionsResponse)(nil),              // 3: gateway.v1.SyncSessionsResponse
+	(*EnrollRequest)(nil),                     // 4: gateway.v1.EnrollRequest
+	(*EnrollResponse)(nil),                    // 5: gateway.v1.EnrollResponse
+	(*RenewCertificateRequest)(nil),           // 6: gateway.v1.RenewCertificateRequest
+	(*RenewCertificateResponse)(nil),          // 7: gateway.v1.RenewCertificateResponse
+	(*HeartbeatRequest)(nil),                  // 8: gateway.v1.HeartbeatRequest
+	(*HeartbeatResponse)(nil),                 // 9: gateway.v1.HeartbeatResponse
+	(*GetConfigRequest)(nil),                  // 10: gateway.v1.GetConfigRequest
+	(*GetConfigResponse)(nil),                 // 11: gateway.v1.GetConfigResponse
+	(*SyncSessionsRequest_Session)(nil),       // 12: gateway.v1.SyncSessionsRequest.Session
+	(*HeartbeatRequest_AppHealth)(nil),        // 13: gateway.v1.HeartbeatRequest.AppHealth
+	(*GetConfigResponse_Policy)(nil),          // 14: gateway.v1.GetConfigResponse.Policy
+	(*GetConfigResponse_PortRange)(nil),       // 15: gateway.v1.GetConfigResponse.PortRange
+	(*GetConfigResponse_TimeCondition)(nil),   // 16: gateway.v1.GetConfigResponse.TimeCondition
+	(*GetConfigResponse_DeviceCondition)(nil), // 17: gateway.v1.GetConfigResponse.DeviceCondition
+	(*GetConfigResponse_DNSConfig)(nil),       // 18: gateway.v1.GetConfigResponse.DNSConfig
+	(*GetConfigResponse_HealthCheck)(nil),     // 19: gateway.v1.GetConfigResponse.HealthCheck
+	nil,                                       // 20: gateway.v1.GetConfigResponse.RevokedSessionsEntry
+	(*GetConfigResponse_Peer)(nil),            // 21: gateway.v1.GetConfigResponse.Peer
+	(*GetConfigResponse_Egress)(nil),          // 22: gateway.v1.GetConfigResponse.Egress
+	(*GetConfigResponse_Egress_SNATPool)(nil), // 23: gateway.v1.GetConfigResponse.Egress.SNATPool
 }
 var file_internal_proto_gateway_v1_gateway_proto_depIdxs = []int32{
-	10, // 0: gateway.v1.SyncSessionsRequest.sessions:type_name -> gateway.v1.SyncSessionsRequest.Session
-	11, // 1: gateway.v1.GetConfigResponse.policies:type_name -> gateway.v1.GetConfigResponse.Policy
-	4,  // 2: gateway.v1.GatewayService.Register:input_type -> gateway.v1.RegisterRequest
-	6,  // 3: gateway.v1.GatewayService.Heartbeat:input_type -> gateway.v1.HeartbeatRequest
-	8,  // 4: gateway.v1.GatewayService.GetConfig:input_type -> gateway.v1.GetConfigRequest
-	0,  // 5: gateway.v1.GatewayService.GetSessionIP:input_type -> gateway.v1.GetSessionIPRequest
-	2,  // 6: gateway.v1.GatewayService.SyncSessions:input_type -> gateway.v1.SyncSessionsRequest
-	5,  // 7: gateway.v1.GatewayService.Register:output_type -> gateway.v1.RegisterResponse
-	7,  // 8: gateway.v1.GatewayService.Heartbeat:output_type -> gateway.v1.HeartbeatResponse
-	9,  // 9: gateway.v1.GatewayService.GetConfig:output_type -> gateway.v1.GetConfigResponse
-	1,  // 10: gateway.v1.GatewayService.GetSessionIP:output_type -> gateway.v1.GetSessionIPResponse
-	3,  // 11: gateway.v1.GatewayService.SyncSessions:output_type -> gateway.v1.SyncSessionsResponse
-	7,  // [7:12] is the sub-list for method output_type
-	2,  // [2:7] is the sub-list for method input_type
-	2,  // [2:2] is the sub-list for extension type_name
-	2,  // [2:2] is the sub-list for extension extendee
-	0,  // [0:2] is the sub-list for field type_name
+	12, // 0: gateway.v1.SyncSessionsRequest.sessions:type_name -> gateway.v1.SyncSessionsRequest.Session
+	13, // 1: gateway.v1.HeartbeatRequest.app_health:type_name -> gateway.v1.HeartbeatRequest.AppHealth
+	14, // 2: gateway.v1.GetConfigResponse.policies:type_name -> gateway.v1.GetConfigResponse.Policy
+	18, // 3: gateway.v1.GetConfigResponse.dns:type_name -> gateway.v1.GetConfigResponse.DNSConfig
+	19, // 4: gateway.v1.GetConfigResponse.health_checks:type_name -> gateway.v1.GetConfigResponse.HealthCheck
+	20, // 5: gateway.v1.GetConfigResponse.revoked_sessions:type_name -> gateway.v1.GetConfigResponse.RevokedSessionsEntry
+	21, // 6: gateway.v1.GetConfigResponse.peers:type_name -> gateway.v1.GetConfigResponse.Peer
+	22, // 7: gateway.v1.GetConfigResponse.egress:type_name -> gateway.v1.GetConfigResponse.Egress
+	16, // 8: gateway.v1.GetConfigResponse.Policy.time_conditions:type_name -> gateway.v1.GetConfigResponse.TimeCondition
+	17, // 9: gateway.v1.GetConfigResponse.Policy.device_conditions:type_name -> gateway.v1.GetConfigResponse.DeviceCondition
+	15, // 10: gateway.v1.GetConfigResponse.Policy.ports:type_name -> gateway.v1.GetConfigResponse.PortRange
+	23, // 11: gateway.v1.GetConfigResponse.Egress.snat_pools:type_name -> gateway.v1.GetConfigResponse.Egress.SNATPool
+	4,  // 12: gateway.v1.GatewayService.Enroll:input_type -> gateway.v1.EnrollRequest
+	6,  // 13: gateway.v1.GatewayService.RenewCertificate:input_type -> gateway.v1.RenewCertificateRequest
+	8,  // 14: gateway.v1.GatewayService.Heartbeat:input_type -> gateway.v1.HeartbeatRequest
+	10, // 15: gateway.v1.GatewayService.GetConfig:input_type -> gateway.v1.GetConfigRequest
+	0,  // 16: gateway.v1.GatewayService.GetSessionIP:input_type -> gateway.v1.GetSessionIPRequest
+	2,  // 17: gateway.v1.GatewayService.SyncSessions:input_type -> gateway.v1.SyncSessionsRequest
+	5,  // 18: gateway.v1.GatewayService.Enroll:output_type -> gateway.v1.EnrollResponse
+	7,  // 19: gateway.v1.GatewayService.RenewCertificate:output_type -> gateway.v1.RenewCertificateResponse
+	9,  // 20: gateway.v1.GatewayService.Heartbeat:output_type -> gateway.v1.HeartbeatResponse
+	11, // 21: gateway.v1.GatewayService.GetConfig:output_type -> gateway.v1.GetConfigResponse
+	1,  // 22: gateway.v1.GatewayService.GetSessionIP:output_type -> gateway.v1.GetSessionIPResponse
+	3,  // 23: gateway.v1.GatewayService.SyncSessions:output_type -> gateway.v1.SyncSessionsResponse
+	18, // [18:24] is the sub-list for method output_type
+	12, // [12:18] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
 }
 
 func init() { file_internal_proto_gateway_v1_gateway_proto_init() }
@@ -845,7 +1709,7 @@ func file_internal_proto_gateway_v1_gateway_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_internal_proto_gateway_v1_gateway_proto_rawDesc), len(file_internal_proto_gateway_v1_gateway_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   12,
+			NumMessages:   24,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
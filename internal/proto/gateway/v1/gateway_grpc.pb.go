@@ -19,19 +19,24 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	GatewayService_Register_FullMethodName     = "/gateway.v1.GatewayService/Register"
-	GatewayService_Heartbeat_FullMethodName    = "/gateway.v1.GatewayService/Heartbeat"
-	GatewayService_GetConfig_FullMethodName    = "/gateway.v1.GatewayService/GetConfig"
-	GatewayService_GetSessionIP_FullMethodName = "/gateway.v1.GatewayService/GetSessionIP"
-	GatewayService_SyncSessions_FullMethodName = "/gateway.v1.GatewayService/SyncSessions"
+	GatewayService_Enroll_FullMethodName           = "/gateway.v1.GatewayService/Enroll"
+	GatewayService_RenewCertificate_FullMethodName = "/gateway.v1.GatewayService/RenewCertificate"
+	GatewayService_Heartbeat_FullMethodName        = "/gateway.v1.GatewayService/Heartbeat"
+	GatewayService_GetConfig_FullMethodName        = "/gateway.v1.GatewayService/GetConfig"
+	GatewayService_GetSessionIP_FullMethodName     = "/gateway.v1.GatewayService/GetSessionIP"
+	GatewayService_SyncSessions_FullMethodName     = "/gateway.v1.GatewayService/SyncSessions"
 )
 
 // GatewayServiceClient is the client API for GatewayService service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type GatewayServiceClient interface {
-	// Register performs the initial enrollment of a gateway
-	Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error)
+	// Enroll exchanges a one-time enrollment token and a certificate request
+	// for the node's client certificate. It is the only call made without one:
+	// every other call is authenticated by the certificate over mutual TLS.
+	Enroll(ctx context.Context, in *EnrollRequest, opts ...grpc.CallOption) (*EnrollResponse, error)
+	// RenewCertificate replaces the calling node's certificate before it expires
+	RenewCertificate(ctx context.Context, in *RenewCertificateRequest, opts ...grpc.CallOption) (*RenewCertificateResponse, error)
 	// Heartbeat sends status updates
 	Heartbeat(ctx context.Context, in *HeartbeatRequest, opts ...grpc.CallOption) (*HeartbeatResponse, error)
 	// GetConfig retrieves the configuration for the gateway
@@ -50,10 +55,20 @@ func NewGatewayServiceClient(cc grpc.ClientConnInterface) GatewayServiceClient {
 	return &gatewayServiceClient{cc}
 }
 
-func (c *gatewayServiceClient) Register(ctx context.Context, in *RegisterRequest, opts ...grpc.CallOption) (*RegisterResponse, error) {
+func (c *gatewayServiceClient) Enroll(ctx context.Context, in *EnrollRequest, opts ...grpc.CallOption) (*EnrollResponse, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
-	out := new(RegisterResponse)
-	err := c.cc.Invoke(ctx, GatewayService_Register_FullMethodName, in, out, cOpts...)
+	out := new(EnrollResponse)
+	err := c.cc.Invoke(ctx, GatewayService_Enroll_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayServiceClient) RenewCertificate(ctx context.Context, in *RenewCertificateRequest, opts ...grpc.CallOption) (*RenewCertificateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RenewCertificateResponse)
+	err := c.cc.Invoke(ctx, GatewayService_RenewCertificate_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
 	}
@@ -104,8 +119,12 @@ func (c *gatewayServiceClient) SyncSessions(ctx context.Context, in *SyncSession
 // All implementations must embed UnimplementedGatewayServiceServer
 // for forward compatibility.
 type GatewayServiceServer interface {
-	// Register performs the initial enrollment of a gateway
-	Register(context.Context, *RegisterRequest) (*RegisterResponse, error)
+	// Enroll exchanges a one-time enrollment token and a certificate request
+	// for the node's client certificate. It is the only call made without one:
+	// every other call is authenticated by the certificate over mutual TLS.
+	Enroll(context.Context, *EnrollRequest) (*EnrollResponse, error)
+	// RenewCertificate replaces the calling node's certificate before it expires
+	RenewCertificate(context.Context, *RenewCertificateRequest) (*RenewCertificateResponse, error)
 	// Heartbeat sends status updates
 	Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error)
 	// GetConfig retrieves the configuration for the gateway
@@ -124,8 +143,11 @@ type GatewayServiceServer interface {
 // pointer dereference when methods are called.
 type UnimplementedGatewayServiceServer struct{}
 
-func (UnimplementedGatewayServiceServer) Register(context.Context, *RegisterRequest) (*RegisterResponse, error) {
-	return nil, status.Error(codes.Unimplemented, "method Register not implemented")
+func (UnimplementedGatewayServiceServer) Enroll(context.Context, *EnrollRequest) (*EnrollResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Enroll not implemented")
+}
+func (UnimplementedGatewayServiceServer) RenewCertificate(context.Context, *RenewCertificateRequest) (*RenewCertificateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method RenewCertificate not implemented")
 }
 func (UnimplementedGatewayServiceServer) Heartbeat(context.Context, *HeartbeatRequest) (*HeartbeatResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Heartbeat not implemented")
@@ -160,20 +182,38 @@ func RegisterGatewayServiceServer(s grpc.ServiceRegistrar, srv GatewayServiceSer
 	s.RegisterService(&GatewayService_ServiceDesc, srv)
 }
 
-func _GatewayService_Register_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(RegisterRequest)
+func _GatewayService_Enroll_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EnrollRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(GatewayServiceServer).Register(ctx, in)
+		return srv.(GatewayServiceServer).Enroll(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: GatewayService_Register_FullMethodName,
+		FullMethod: GatewayService_Enroll_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(GatewayServiceServer).Register(ctx, req.(*RegisterRequest))
+		return srv.(GatewayServiceServer).Enroll(ctx, req.(*EnrollRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GatewayService_RenewCertificate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenewCertificateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServiceServer).RenewCertificate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GatewayService_RenewCertificate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServiceServer).RenewCertificate(ctx, req.(*RenewCertificateRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
@@ -258,8 +298,12 @@ var GatewayService_ServiceDesc = grpc.ServiceDesc{
 	HandlerType: (*GatewayServiceServer)(nil),
 	Methods: []grpc.MethodDesc{
 		{
-			MethodName: "Register",
-			Handler:    _GatewayService_Register_Handler,
+			MethodName: "Enroll",
+			Handler:    _GatewayService_Enroll_Handler,
+		},
+		{
+			MethodName: "RenewCertificate",
+			Handler:    _GatewayService_RenewCertificate_Handler,
 		},
 		{
 			MethodName: "Heartbeat",
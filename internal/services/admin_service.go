@@ -2,10 +2,13 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"sync"
 	"tridorian-ztna/internal/models"
 	"tridorian-ztna/pkg/utils"
 
 	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
@@ -19,7 +22,7 @@ func NewAdminService(db *gorm.DB) *AdminService {
 
 func (s *AdminService) ListAdmins(tenantID uuid.UUID) ([]models.Administrator, error) {
 	var admins []models.Administrator
-	if err := s.db.Scopes(models.TenantScope(tenantID)).Find(&admins).Error; err != nil {
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Preload("CustomRole").Find(&admins).Error; err != nil {
 		return nil, err
 	}
 	return admins, nil
@@ -29,6 +32,7 @@ func (s *AdminService) Authenticate(tenantID uuid.UUID, email, password string)
 	var admin models.Administrator
 	err := s.db.Scopes(models.TenantScope(tenantID)).Where("email = ?", email).First(&admin).Error
 	if err != nil {
+		EqualizeLoginTiming(password)
 		return nil, errors.New("invalid email or password")
 	}
 
@@ -38,6 +42,117 @@ func (s *AdminService) Authenticate(tenantID uuid.UUID, email, password string)
 
 	return &admin, nil
 }
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// EqualizeLoginTiming spends as long as a real password check, so unknown
+// accounts and domains cannot be told apart by response time.
+func EqualizeLoginTiming(password string) {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte(utils.GenerateRandomPassword(16)), bcrypt.DefaultCost)
+	})
+	bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+}
+
+// PasswordPolicy returns the tenant's policy for administrator passwords.
+func (s *AdminService) PasswordPolicy(tenantID uuid.UUID) utils.PasswordPolicy {
+	var tenant models.Tenant
+	if err := s.db.Select("password_min_length", "password_require_complexity").First(&tenant, "id = ?", tenantID).Error; err != nil {
+		return utils.DefaultPasswordPolicy
+	}
+	return utils.PasswordPolicy{
+		MinLength:         tenant.PasswordMinLength,
+		RequireComplexity: tenant.PasswordRequireComplexity,
+	}
+}
+
+// ErrPrivilegeEscalation is returned when an administrator tries to grant, or
+// manage someone holding, permissions or scope beyond their own.
+var ErrPrivilegeEscalation = errors.New("you cannot grant or manage access beyond your own")
+
+// AdminAccess is the role and optional scope given to an administrator.
+type AdminAccess struct {
+	Role           models.AdminRole `json:"role"`
+	RoleID         *uuid.UUID       `json:"role_id"` // The custom role, when Role is custom
+	NodeIDs        []uuid.UUID      `json:"node_ids"`
+	ApplicationIDs []uuid.UUID      `json:"application_ids"`
+}
+
+// Grant resolves what an administrator may do. It reads the database on every
+// request, so role and scope changes apply to sessions already signed in.
+func (s *AdminService) Grant(tenantID, adminID uuid.UUID) (*models.AccessGrant, error) {
+	var admin models.Administrator
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Preload("CustomRole").First(&admin, "id = ?", adminID).Error; err != nil {
+		return nil, err
+	}
+	return admin.Grant(), nil
+}
+
+// accessGrant checks that the access names an existing role and nodes and
+// applications of the tenant, and returns the grant it gives.
+func (s *AdminService) accessGrant(tenantID uuid.UUID, access *AdminAccess) (*models.AccessGrant, error) {
+	admin := models.Administrator{
+		Role:           access.Role,
+		NodeIDs:        access.NodeIDs,
+		ApplicationIDs: access.ApplicationIDs,
+	}
+	switch {
+	case access.Role == models.RoleCustom:
+		if access.RoleID == nil {
+			return nil, errors.New("role_id is required for a custom role")
+		}
+		var role models.Role
+		if err := s.db.Scopes(models.TenantScope(tenantID)).First(&role, "id = ?", *access.RoleID).Error; err != nil {
+			return nil, errors.New("role not found")
+		}
+		admin.RoleID = &role.ID
+		admin.CustomRole = &role
+	case access.Role.Valid():
+		access.RoleID = nil
+	default:
+		return nil, fmt.Errorf("invalid role %q", access.Role)
+	}
+
+	if err := s.countInTenant(tenantID, &models.Node{}, access.NodeIDs); err != nil {
+		return nil, fmt.Errorf("node scope: %w", err)
+	}
+	if err := s.countInTenant(tenantID, &models.Application{}, access.ApplicationIDs); err != nil {
+		return nil, fmt.Errorf("application scope: %w", err)
+	}
+	return admin.Grant(), nil
+}
+
+// countInTenant checks that every id is a row of model in the tenant.
+func (s *AdminService) countInTenant(tenantID uuid.UUID, model interface{}, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	var count int64
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Model(model).Where("id IN ?", ids).Count(&count).Error; err != nil {
+		return err
+	}
+	if int(count) != len(ids) {
+		return errors.New("unknown or duplicate id")
+	}
+	return nil
+}
+
+// CanManage returns ErrPrivilegeEscalation unless the granter holds at least
+// the access of the administrator.
+func (s *AdminService) CanManage(granter *models.AccessGrant, tenantID, adminID uuid.UUID) error {
+	grant, err := s.Grant(tenantID, adminID)
+	if err != nil {
+		return err
+	}
+	if !granter.Contains(grant) {
+		return ErrPrivilegeEscalation
+	}
+	return nil
+}
+
 func (s *AdminService) GetByID(id uuid.UUID) (*models.Administrator, error) {
 	var admin models.Administrator
 	err := s.db.First(&admin, "id = ?", id).Error
@@ -47,7 +162,7 @@ func (s *AdminService) GetByID(id uuid.UUID) (*models.Administrator, error) {
 	return &admin, nil
 }
 
-func (s *AdminService) ChangePassword(id uuid.UUID, oldPassword, newPassword string) error {
+func (s *AdminService) ChangePassword(id uuid.UUID, oldPassword, newPassword string, actor Actor) error {
 	var admin models.Administrator
 	if err := s.db.First(&admin, "id = ?", id).Error; err != nil {
 		return err
@@ -57,48 +172,126 @@ func (s *AdminService) ChangePassword(id uuid.UUID, oldPassword, newPassword str
 		return errors.New("incorrect old password")
 	}
 
+	if err := s.PasswordPolicy(admin.TenantID).Validate(newPassword, admin.Email); err != nil {
+		return err
+	}
+	if admin.CheckPassword(newPassword) {
+		return errors.New("new password must differ from the current one")
+	}
+
 	if err := admin.SetPassword(newPassword); err != nil {
 		return err
 	}
 
 	// Reset flag
 	admin.ChangePasswordRequired = false
-	return s.db.Save(&admin).Error
+	return audited(s.db, admin.TenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Save(&admin).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "administrator.password.change", ResourceType: "administrator", ResourceID: id.String()}, nil
+	})
 }
-func (s *AdminService) CreateAdmin(tenantID uuid.UUID, name, email, password string, role models.AdminRole) (*models.Administrator, string, error) {
+
+// CreateAdmin adds an administrator with access no wider than the granter's.
+func (s *AdminService) CreateAdmin(tenantID uuid.UUID, name, email, password string, access AdminAccess, granter *models.AccessGrant, actor Actor) (*models.Administrator, string, error) {
+	grant, err := s.accessGrant(tenantID, &access)
+	if err != nil {
+		return nil, "", err
+	}
+	if !granter.Contains(grant) {
+		return nil, "", ErrPrivilegeEscalation
+	}
+
 	admin := &models.Administrator{
-		BaseTenant: models.BaseTenant{TenantID: tenantID},
-		Name:       name,
-		Email:      email,
-		Role:       role,
+		BaseTenant:     models.BaseTenant{TenantID: tenantID},
+		Name:           name,
+		Email:          email,
+		Role:           access.Role,
+		RoleID:         access.RoleID,
+		NodeIDs:        access.NodeIDs,
+		ApplicationIDs: access.ApplicationIDs,
 	}
 
+	policy := s.PasswordPolicy(tenantID)
 	if password == "" {
-		password = utils.GenerateRandomPassword(12)
+		password = policy.Generate()
+	} else if err := policy.Validate(password, email); err != nil {
+		return nil, "", err
 	}
 
 	if err := admin.SetPassword(password); err != nil {
 		return nil, "", err
 	}
 
-	if err := s.db.Create(admin).Error; err != nil {
+	err = audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Create(admin).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "administrator.create", ResourceType: "administrator", ResourceID: admin.ID.String(), After: admin}, nil
+	})
+	if err != nil {
 		return nil, "", err
 	}
-
 	return admin, password, nil
 }
 
-func (s *AdminService) DeleteAdmin(tenantID uuid.UUID, adminID uuid.UUID) error {
-	// Don't allow deleting the last admin? Or maybe just check if it exists in this tenant.
-	return s.db.Scopes(models.TenantScope(tenantID)).Delete(&models.Administrator{}, "id = ?", adminID).Error
+func (s *AdminService) DeleteAdmin(tenantID uuid.UUID, adminID uuid.UUID, granter *models.AccessGrant, actor Actor) error {
+	if err := s.CanManage(granter, tenantID, adminID); err != nil {
+		return err
+	}
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var admin models.Administrator
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&admin, "id = ?", adminID).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Delete(&admin).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "administrator.delete", ResourceType: "administrator", ResourceID: adminID.String(), Before: admin}, nil
+	})
 }
 
-func (s *AdminService) UpdateAdmin(tenantID uuid.UUID, adminID uuid.UUID, name string, role models.AdminRole) error {
-	updates := map[string]interface{}{
-		"name": name,
+// UpdateAdmin renames an administrator and, when access is given, replaces
+// their role and scope. The granter must hold at least both the old and the
+// new access.
+func (s *AdminService) UpdateAdmin(tenantID uuid.UUID, adminID uuid.UUID, name string, access *AdminAccess, breakGlass *bool, granter *models.AccessGrant, actor Actor) error {
+	if err := s.CanManage(granter, tenantID, adminID); err != nil {
+		return err
+	}
+
+	// Updating through the struct applies the JSON serializer of the scope fields
+	admin := models.Administrator{Name: name}
+	columns := []string{"name"}
+	if access != nil {
+		grant, err := s.accessGrant(tenantID, access)
+		if err != nil {
+			return err
+		}
+		if !granter.Contains(grant) {
+			return ErrPrivilegeEscalation
+		}
+		admin.Role = access.Role
+		admin.RoleID = access.RoleID
+		admin.NodeIDs = access.NodeIDs
+		admin.ApplicationIDs = access.ApplicationIDs
+		columns = append(columns, "role", "role_id", "node_ids", "application_ids")
 	}
-	if role != "" {
-		updates["role"] = role
+	if breakGlass != nil {
+		admin.BreakGlass = *breakGlass
+		columns = append(columns, "break_glass")
 	}
-	return s.db.Scopes(models.TenantScope(tenantID)).Model(&models.Administrator{}).Where("id = ?", adminID).Updates(updates).Error
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var before, after models.Administrator
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&before, "id = ?", adminID).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.Administrator{}).Where("id = ?", adminID).Select(columns).Updates(&admin).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.First(&after, "id = ?", adminID).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "administrator.update", ResourceType: "administrator", ResourceID: adminID.String(), Before: before, After: after}, nil
+	})
 }
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"tridorian-ztna/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// ErrNoAdminRole means a sign-in through the IdP matched no role mapping.
+var ErrNoAdminRole = errors.New("account has no administrator role in this organization")
+
+// AdminSSOService signs administrators in to the management console through
+// the tenant's identity provider, mapping IdP groups and the Google
+// Workspace administrator flag to administrator roles.
+type AdminSSOService struct {
+	db              *gorm.DB
+	cache           *redis.Client
+	identityService *IdentityService
+}
+
+func NewAdminSSOService(db *gorm.DB, cache *redis.Client) *AdminSSOService {
+	return &AdminSSOService{db: db, cache: cache, identityService: NewIdentityService()}
+}
+
+// AdminSSOSettings is a tenant's administrator sign-in configuration.
+type AdminSSOSettings struct {
+	Enabled            bool                      `json:"enabled"`
+	ProviderID         *uuid.UUID                `json:"provider_id"`
+	WorkspaceAdminRole models.AdminRole          `json:"workspace_admin_role"`
+	Mappings           []models.AdminRoleMapping `json:"mappings"`
+}
+
+func (s *AdminSSOService) GetSettings(tenantID uuid.UUID) (*AdminSSOSettings, error) {
+	return loadAdminSSOSettings(s.db, tenantID)
+}
+
+func loadAdminSSOSettings(db *gorm.DB, tenantID uuid.UUID) (*AdminSSOSettings, error) {
+	var tenant models.Tenant
+	if err := db.First(&tenant, "id = ?", tenantID).Error; err != nil {
+		return nil, err
+	}
+	mappings := []models.AdminRoleMapping{}
+	if err := db.Scopes(models.TenantScope(tenantID)).Order("created_at asc").Find(&mappings).Error; err != nil {
+		return nil, err
+	}
+	return &AdminSSOSettings{
+		Enabled:            tenant.AdminSSOEnabled,
+		ProviderID:         tenant.AdminSSOProviderID,
+		WorkspaceAdminRole: tenant.AdminSSOWorkspaceAdminRole,
+		Mappings:           mappings,
+	}, nil
+}
+
+// UpdateSettings replaces the tenant's administrator sign-in configuration
+// and role mappings. Turning it on requires a break-glass super admin with a
+// password, so a broken IdP cannot lock the tenant out.
+func (s *AdminSSOService) UpdateSettings(tenantID uuid.UUID, settings *AdminSSOSettings, actor Actor) error {
+	if settings.WorkspaceAdminRole != "" && !settings.WorkspaceAdminRole.Valid() {
+		return fmt.Errorf("invalid role %q", settings.WorkspaceAdminRole)
+	}
+	for i := range settings.Mappings {
+		m := &settings.Mappings[i]
+		m.Group = strings.TrimSpace(m.Group)
+		if m.Group == "" {
+			return errors.New("role mapping group is required")
+		}
+		if !m.Role.Valid() {
+			return fmt.Errorf("invalid role %q for group %s", m.Role, m.Group)
+		}
+	}
+
+	if settings.ProviderID != nil {
+		var count int64
+		if err := s.db.Model(&models.IdentityProvider{}).Scopes(models.TenantScope(tenantID)).
+			Where("id = ? AND enabled = ?", *settings.ProviderID, true).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return errors.New("identity provider not found or disabled")
+		}
+	}
+
+	if settings.Enabled {
+		if settings.WorkspaceAdminRole == "" && len(settings.Mappings) == 0 {
+			return errors.New("add a role mapping before enabling administrator single sign-on")
+		}
+		var breakGlass int64
+		if err := s.db.Model(&models.Administrator{}).Scopes(models.TenantScope(tenantID)).
+			Where("role = ? AND break_glass = ? AND password <> ''", models.RoleSuperAdmin, true).
+			Count(&breakGlass).Error; err != nil {
+			return err
+		}
+		if breakGlass == 0 {
+			return errors.New("mark at least one super admin as break-glass before enabling administrator single sign-on")
+		}
+	}
+
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		before, err := loadAdminSSOSettings(tx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.Tenant{}).Where("id = ?", tenantID).Updates(map[string]interface{}{
+			"admin_sso_enabled":              settings.Enabled,
+			"admin_sso_provider_id":          settings.ProviderID,
+			"admin_sso_workspace_admin_role": settings.WorkspaceAdminRole,
+		}).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Scopes(models.TenantScope(tenantID)).Delete(&models.AdminRoleMapping{}).Error; err != nil {
+			return nil, err
+		}
+		for _, m := range settings.Mappings {
+			mapping := models.AdminRoleMapping{
+				BaseTenant: models.BaseTenant{TenantID: tenantID},
+				Group:      m.Group,
+				Role:       m.Role,
+			}
+			if err := tx.Create(&mapping).Error; err != nil {
+				return nil, err
+			}
+		}
+		after, err := loadAdminSSOSettings(tx, tenantID)
+		if err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "admin_sso.update", ResourceType: "tenant", ResourceID: tenantID.String(), Before: before, After: after}, nil
+	})
+}
+
+// IsWorkspaceAdmin reports whether the user is a Google Workspace
+// administrator, from the synced directory or else the Admin SDK. The
+// tenant's configuration must already be decrypted.
+func (s *AdminSSOService) IsWorkspaceAdmin(ctx context.Context, tenant *models.Tenant, email string) (bool, error) {
+	directory := NewDirectoryService(s.db, s.cache)
+	hasDirectory, err := directory.HasDirectory(tenant.ID)
+	if err != nil {
+		return false, err
+	}
+	if hasDirectory {
+		u, err := directory.FindUserByEmail(tenant.ID, email)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return u.IsAdmin, nil
+	}
+
+	if tenant.GoogleServiceAccountKey == "" {
+		return false, nil
+	}
+	u, err := s.identityService.GetGoogleUser(ctx, []byte(tenant.GoogleServiceAccountKey), tenant.GoogleAdminEmail, email)
+	if err != nil {
+		return false, err
+	}
+	return u.IsAdmin, nil
+}
+
+// ResolveRole returns the most privileged role the user's groups and
+// Workspace administrator flag map to, or ErrNoAdminRole.
+func (s *AdminSSOService) ResolveRole(tenant *models.Tenant, groups []string, workspaceAdmin bool) (models.AdminRole, error) {
+	var mappings []models.AdminRoleMapping
+	if err := s.db.Scopes(models.TenantScope(tenant.ID)).Find(&mappings).Error; err != nil {
+		return "", err
+	}
+
+	var role models.AdminRole
+	if workspaceAdmin && tenant.AdminSSOWorkspaceAdminRole.Valid() {
+		role = tenant.AdminSSOWorkspaceAdminRole
+	}
+	for _, m := range mappings {
+		if m.Role.Rank() <= role.Rank() {
+			continue
+		}
+		for _, g := range groups {
+			if strings.EqualFold(g, m.Group) {
+				role = m.Role
+				break
+			}
+		}
+	}
+	if role == "" {
+		return "", ErrNoAdminRole
+	}
+	return role, nil
+}
+
+// SignIn returns the administrator for an IdP sign-in, creating it on first
+// use. The IdP decides the role on every sign-in, except for break-glass
+// administrators, whose role is managed locally.
+func (s *AdminSSOService) SignIn(tenantID uuid.UUID, email, name string, role models.AdminRole) (*models.Administrator, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var admin models.Administrator
+	err := s.db.Scopes(models.TenantScope(tenantID)).Where("LOWER(email) = ?", email).First(&admin).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		admin = models.Administrator{
+			BaseTenant: models.BaseTenant{TenantID: tenantID},
+			Name:       name,
+			Email:      email,
+			Role:       role,
+			SSO:        true,
+		}
+		if err := s.db.Create(&admin).Error; err != nil {
+			return nil, err
+		}
+		// The column defaults to true, which GORM applies for a false field
+		if err := s.db.Model(&admin).Update("change_password_required", false).Error; err != nil {
+			return nil, err
+		}
+		return &admin, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if admin.BreakGlass {
+		return &admin, nil
+	}
+	updates := map[string]interface{}{
+		"role":                     role,
+		"role_id":                  nil,
+		"change_password_required": false,
+	}
+	if admin.Name == "" && name != "" {
+		updates["name"] = name
+	}
+	if err := s.db.Model(&admin).Updates(updates).Error; err != nil {
+		return nil, err
+	}
+	return &admin, nil
+}
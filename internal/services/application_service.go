@@ -1,126 +1,302 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+
 	"tridorian-ztna/internal/models"
+	pb "tridorian-ztna/internal/proto/gateway/v1"
+	"tridorian-ztna/pkg/fqdn"
+	"tridorian-ztna/pkg/portrange"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
+// appHealthTTL keeps a gateway's health result visible for a few missed heartbeats.
+const appHealthTTL = 2 * time.Minute
+
 type ApplicationService struct {
-	db *gorm.DB
+	db    *gorm.DB
+	cache *redis.Client
 }
 
-func NewApplicationService(db *gorm.DB) *ApplicationService {
-	return &ApplicationService{db: db}
+func NewApplicationService(db *gorm.DB, cache *redis.Client) *ApplicationService {
+	return &ApplicationService{db: db, cache: cache}
 }
 
 func (s *ApplicationService) ListApplications(tenantID uuid.UUID) ([]models.Application, error) {
 	var apps []models.Application
-	if err := s.db.Scopes(models.TenantScope(tenantID)).Find(&apps).Error; err != nil {
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Preload("Destinations").
+		Order("name asc").
+		Find(&apps).Error; err != nil {
 		return nil, err
 	}
+	s.AttachHealth(apps)
 	return apps, nil
 }
 
-func (s *ApplicationService) GetApplicationWithCIDRs(tenantID uuid.UUID, appID uuid.UUID) (*models.Application, []models.ApplicationCIDR, error) {
+func (s *ApplicationService) GetApplication(tenantID uuid.UUID, appID uuid.UUID) (*models.Application, error) {
 	var app models.Application
-	if err := s.db.Scopes(models.TenantScope(tenantID)).First(&app, "id = ?", appID).Error; err != nil {
-		return nil, nil, err
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Preload("Destinations").
+		First(&app, "id = ?", appID).Error; err != nil {
+		return nil, err
 	}
+	apps := []models.Application{app}
+	s.AttachHealth(apps)
+	return &apps[0], nil
+}
+
+// ListApplicationsByTag returns the applications carrying the tag.
+func (s *ApplicationService) ListApplicationsByTag(tenantID uuid.UUID, tag string) ([]models.Application, error) {
+	return listApplicationsByTag(s.db, tenantID, tag)
+}
 
-	var cidrs []models.ApplicationCIDR
-	if err := s.db.Where("application_id = ?", appID).Find(&cidrs).Error; err != nil {
-		return nil, nil, err
+func listApplicationsByTag(db *gorm.DB, tenantID uuid.UUID, tag string) ([]models.Application, error) {
+	var apps []models.Application
+	if err := db.Scopes(models.TenantScope(tenantID)).
+		Preload("Destinations").
+		Where("tags ILIKE ?", "%"+tag+"%").
+		Find(&apps).Error; err != nil {
+		return nil, err
 	}
 
-	return &app, cidrs, nil
+	// ILIKE narrows the search; the exact tag match is done here
+	var tagged []models.Application
+	for _, app := range apps {
+		if app.HasTag(tag) {
+			tagged = append(tagged, app)
+		}
+	}
+	return tagged, nil
 }
 
-func (s *ApplicationService) CreateApplication(tenantID uuid.UUID, name, description string, cidrs []string) (*models.Application, error) {
-	app := &models.Application{
-		BaseTenant:  models.BaseTenant{TenantID: tenantID},
-		Name:        name,
-		Description: description,
+func (s *ApplicationService) CreateApplication(tenantID uuid.UUID, app *models.Application, actor Actor) (*models.Application, error) {
+	if err := validateApplication(app); err != nil {
+		return nil, err
+	}
+	app.TenantID = tenantID
+	for i := range app.Destinations {
+		app.Destinations[i].TenantID = tenantID
 	}
 
-	err := s.db.Transaction(func(tx *gorm.DB) error {
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
 		if err := tx.Create(app).Error; err != nil {
-			return err
-		}
-
-		for _, cidr := range cidrs {
-			appCIDR := &models.ApplicationCIDR{
-				BaseTenant:    models.BaseTenant{TenantID: tenantID},
-				ApplicationID: app.ID,
-				CIDR:          cidr,
-			}
-			if err := tx.Create(appCIDR).Error; err != nil {
-				return err
-			}
+			return nil, err
 		}
-
-		return nil
+		return &AuditChange{Action: "application.create", ResourceType: "application", ResourceID: app.ID.String(), After: app}, nil
 	})
-
 	if err != nil {
 		return nil, err
 	}
-
 	return app, nil
 }
 
-func (s *ApplicationService) UpdateApplication(tenantID uuid.UUID, appID uuid.UUID, name, description string, cidrs []string) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+// loadApplication loads an application with its destinations, in db.
+func loadApplication(db *gorm.DB, tenantID, appID uuid.UUID) (*models.Application, error) {
+	var app models.Application
+	if err := db.Scopes(models.TenantScope(tenantID)).Preload("Destinations").First(&app, "id = ?", appID).Error; err != nil {
+		return nil, errors.New("application not found")
+	}
+	return &app, nil
+}
+
+func (s *ApplicationService) UpdateApplication(tenantID uuid.UUID, app *models.Application, actor Actor) error {
+	if err := validateApplication(app); err != nil {
+		return err
+	}
+
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		before, err := loadApplication(tx, tenantID, app.ID)
+		if err != nil {
+			return nil, err
+		}
+
 		// Update application
-		if err := tx.Scopes(models.TenantScope(tenantID)).
+		result := tx.Scopes(models.TenantScope(tenantID)).
 			Model(&models.Application{}).
-			Where("id = ?", appID).
+			Where("id = ?", app.ID).
 			Updates(map[string]interface{}{
-				"name":        name,
-				"description": description,
-			}).Error; err != nil {
-			return err
+				"name":         app.Name,
+				"description":  app.Description,
+				"owner":        app.Owner,
+				"tags":         app.Tags,
+				"ports":        app.Ports,
+				"health_check": app.HealthCheck,
+			})
+		if result.Error != nil {
+			return nil, result.Error
 		}
 
-		// Delete old CIDRs
-		if err := tx.Where("application_id = ?", appID).Delete(&models.ApplicationCIDR{}).Error; err != nil {
-			return err
+		// Replace destinations
+		if err := tx.Where("application_id = ?", app.ID).Delete(&models.ApplicationDestination{}).Error; err != nil {
+			return nil, err
 		}
-
-		// Create new CIDRs
-		for _, cidr := range cidrs {
-			appCIDR := &models.ApplicationCIDR{
+		for _, d := range app.Destinations {
+			dest := &models.ApplicationDestination{
 				BaseTenant:    models.BaseTenant{TenantID: tenantID},
-				ApplicationID: appID,
-				CIDR:          cidr,
+				ApplicationID: app.ID,
+				Type:          d.Type,
+				Value:         d.Value,
 			}
-			if err := tx.Create(appCIDR).Error; err != nil {
-				return err
+			if err := tx.Create(dest).Error; err != nil {
+				return nil, err
 			}
 		}
 
-		return nil
+		after, err := loadApplication(tx, tenantID, app.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "application.update", ResourceType: "application", ResourceID: app.ID.String(), Before: before, After: after}, nil
 	})
 }
 
-func (s *ApplicationService) DeleteApplication(tenantID uuid.UUID, appID uuid.UUID) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
-		// Delete CIDRs first
-		if err := tx.Where("application_id = ?", appID).Delete(&models.ApplicationCIDR{}).Error; err != nil {
-			return err
+func (s *ApplicationService) DeleteApplication(tenantID uuid.UUID, appID uuid.UUID, actor Actor) error {
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		app, err := loadApplication(tx, tenantID, appID)
+		if err != nil {
+			return nil, err
 		}
 
 		// Delete application
-		result := tx.Scopes(models.TenantScope(tenantID)).Delete(&models.Application{}, "id = ?", appID)
-		if result.Error != nil {
-			return result.Error
+		if err := tx.Delete(app).Error; err != nil {
+			return nil, err
 		}
-		if result.RowsAffected == 0 {
-			return errors.New("application not found")
+
+		// Then its destinations
+		if err := tx.Where("application_id = ?", appID).Delete(&models.ApplicationDestination{}).Error; err != nil {
+			return nil, err
 		}
+		return &AuditChange{Action: "application.delete", ResourceType: "application", ResourceID: appID.String(), Before: app}, nil
+	})
+}
 
+// RecordHealth stores the health check results a gateway sent with its heartbeat.
+// Results for applications outside the node's tenant are ignored.
+func (s *ApplicationService) RecordHealth(node *models.Node, results []*pb.HeartbeatRequest_AppHealth) error {
+	if s.cache == nil || len(results) == 0 {
 		return nil
-	})
+	}
+
+	var ids []uuid.UUID
+	for _, r := range results {
+		if id, err := uuid.Parse(r.ApplicationId); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	var owned []uuid.UUID
+	if err := s.db.Model(&models.Application{}).
+		Scopes(models.TenantScope(node.TenantID)).
+		Where("id IN ?", ids).
+		Pluck("id", &owned).Error; err != nil {
+		return err
+	}
+	isOwned := make(map[string]bool, len(owned))
+	for _, id := range owned {
+		isOwned[id.String()] = true
+	}
+
+	ctx := context.Background()
+	for _, r := range results {
+		if !isOwned[r.ApplicationId] {
+			continue
+		}
+		data, _ := json.Marshal(models.ApplicationHealth{
+			NodeID:    node.ID.String(),
+			Healthy:   r.Healthy,
+			LatencyMs: r.LatencyMs,
+			Error:     r.Error,
+			CheckedAt: r.CheckedAt,
+		})
+		key := fmt.Sprintf("app:health:%s", r.ApplicationId)
+		s.cache.HSet(ctx, key, node.ID.String(), data)
+		s.cache.Expire(ctx, key, appHealthTTL)
+	}
+	return nil
+}
+
+// AttachHealth fills in the latest results reported by gateways.
+func (s *ApplicationService) AttachHealth(apps []models.Application) {
+	if s.cache == nil {
+		return
+	}
+	ctx := context.Background()
+	for i := range apps {
+		if apps[i].HealthCheck == "" {
+			continue
+		}
+		data, err := s.cache.HGetAll(ctx, fmt.Sprintf("app:health:%s", apps[i].ID)).Result()
+		if err != nil {
+			continue
+		}
+		for _, val := range data {
+			var h models.ApplicationHealth
+			if err := json.Unmarshal([]byte(val), &h); err == nil {
+				apps[i].Health = append(apps[i].Health, h)
+			}
+		}
+	}
+}
+
+// validateApplication checks and normalizes destinations, ports, tags and the health check target.
+func validateApplication(app *models.Application) error {
+	app.Name = strings.TrimSpace(app.Name)
+	if app.Name == "" {
+		return errors.New("name is required")
+	}
+	if len(app.Destinations) == 0 {
+		return errors.New("at least one destination is required")
+	}
+
+	for i := range app.Destinations {
+		d := &app.Destinations[i]
+		d.Type = strings.ToLower(strings.TrimSpace(d.Type))
+		d.Value = strings.TrimSpace(d.Value)
+		switch d.Type {
+		case "cidr":
+			prefix, err := netip.ParsePrefix(d.Value)
+			if err != nil {
+				return fmt.Errorf("invalid CIDR %q", d.Value)
+			}
+			d.Value = prefix.Masked().String()
+		case "fqdn":
+			if err := fqdn.Validate(d.Value); err != nil {
+				return err
+			}
+			d.Value = fqdn.Normalize(d.Value)
+		default:
+			return fmt.Errorf("invalid destination type %q: must be cidr or fqdn", d.Type)
+		}
+	}
+
+	ranges, err := portrange.Parse(app.Ports)
+	if err != nil {
+		return err
+	}
+	app.Ports = portrange.Format(ranges)
+
+	var tags []string
+	for _, t := range strings.Split(app.Tags, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	app.Tags = strings.Join(tags, ",")
+
+	if app.HealthCheck = strings.TrimSpace(app.HealthCheck); app.HealthCheck != "" {
+		if _, port, err := net.SplitHostPort(app.HealthCheck); err != nil || port == "" {
+			return fmt.Errorf("invalid health check target %q: expected host:port", app.HealthCheck)
+		}
+	}
+	return nil
 }
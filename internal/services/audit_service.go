@@ -0,0 +1,236 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+	"tridorian-ztna/internal/models"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Actor is who makes an administrative change, and from where.
+type Actor struct {
+	Type      string // models.AuditActorAdmin, AuditActorBackoffice or AuditActorSystem
+	ID        *uuid.UUID
+	Email     string
+	IP        string
+	UserAgent string
+}
+
+// SystemActor is recorded for changes the platform makes on its own.
+var SystemActor = Actor{Type: models.AuditActorSystem}
+
+// AuditChange describes one change for the audit log. Before and After are
+// snapshots of the resource, marshalled to JSON; nil means it did not exist.
+type AuditChange struct {
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Before       any
+	After        any
+}
+
+// audited runs change in a transaction and appends the change it reports to
+// the tenant's audit log in the same transaction, so a change is never saved
+// without its entry. A nil change records nothing.
+func audited(db *gorm.DB, tenantID uuid.UUID, actor Actor, change func(tx *gorm.DB) (*AuditChange, error)) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		c, err := change(tx)
+		if err != nil || c == nil {
+			return err
+		}
+		return recordAudit(tx, tenantID, actor, c)
+	})
+}
+
+// recordAudit appends an entry to the tenant's hash chain. Appends to one
+// tenant are serialized with a transaction-scoped advisory lock, so two
+// entries never claim the same predecessor.
+func recordAudit(tx *gorm.DB, tenantID uuid.UUID, actor Actor, c *AuditChange) error {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", "audit_log:"+tenantID.String()).Error; err != nil {
+		return err
+	}
+
+	var last models.AuditLog
+	if err := tx.Where("tenant_id = ?", tenantID).Order("sequence desc").Limit(1).Find(&last).Error; err != nil {
+		return err
+	}
+	return tx.Create(newAuditEntry(&last, tenantID, actor, c, time.Now())).Error
+}
+
+// newAuditEntry builds the entry that follows last, the tenant's newest entry
+// (zero for an empty log), and seals it with its hash.
+func newAuditEntry(last *models.AuditLog, tenantID uuid.UUID, actor Actor, c *AuditChange, now time.Time) *models.AuditLog {
+	if actor.Type == "" {
+		actor.Type = models.AuditActorSystem
+	}
+	entry := &models.AuditLog{
+		ID:           uuid.New(),
+		TenantID:     tenantID,
+		Sequence:     last.Sequence + 1,
+		CreatedAt:    now.UTC().Truncate(time.Microsecond),
+		ActorType:    actor.Type,
+		ActorID:      actor.ID,
+		ActorEmail:   actor.Email,
+		IP:           actor.IP,
+		UserAgent:    actor.UserAgent,
+		Action:       c.Action,
+		ResourceType: c.ResourceType,
+		ResourceID:   c.ResourceID,
+		Before:       auditSnapshot(c.Before),
+		After:        auditSnapshot(c.After),
+		PrevHash:     last.Hash,
+	}
+	entry.Hash = entry.ComputeHash()
+	return entry
+}
+
+func auditSnapshot(v any) string {
+	if v == nil {
+		return ""
+	}
+	data, err := json.Marshal(v)
+	if err != nil || string(data) == "null" {
+		return ""
+	}
+	return string(data)
+}
+
+// AuditService reads a tenant's audit log. Entries are written by the
+// services that make the changes.
+type AuditService struct {
+	db *gorm.DB
+}
+
+func NewAuditService(db *gorm.DB) *AuditService {
+	return &AuditService{db: db}
+}
+
+// AuditFilter narrows the audit log. Empty fields match everything; Action
+// also matches by prefix, so "access_policy." finds every policy change.
+type AuditFilter struct {
+	Actor        string // Email or administrator ID
+	Action       string
+	ResourceType string
+	ResourceID   string
+	Since        *time.Time
+	Until        *time.Time
+}
+
+func (s *AuditService) query(tenantID uuid.UUID, f AuditFilter) *gorm.DB {
+	q := s.db.Model(&models.AuditLog{}).Where("tenant_id = ?", tenantID)
+	if f.Actor != "" {
+		if id, err := uuid.Parse(f.Actor); err == nil {
+			q = q.Where("actor_id = ?", id)
+		} else {
+			q = q.Where("actor_email ILIKE ?", "%"+escapeLike(f.Actor)+"%")
+		}
+	}
+	if f.Action != "" {
+		q = q.Where("action LIKE ?", escapeLike(f.Action)+"%")
+	}
+	if f.ResourceType != "" {
+		q = q.Where("resource_type = ?", f.ResourceType)
+	}
+	if f.ResourceID != "" {
+		q = q.Where("resource_id = ?", f.ResourceID)
+	}
+	if f.Since != nil {
+		q = q.Where("created_at >= ?", *f.Since)
+	}
+	if f.Until != nil {
+		q = q.Where("created_at < ?", *f.Until)
+	}
+	return q
+}
+
+// ListEntries returns one page of matching entries, newest first, and the
+// number of matching entries.
+func (s *AuditService) ListEntries(tenantID uuid.UUID, f AuditFilter, page, pageSize int) ([]models.AuditLog, int64, error) {
+	var total int64
+	if err := s.query(tenantID, f).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var entries []models.AuditLog
+	if err := s.query(tenantID, f).Order("sequence desc").Offset((page - 1) * pageSize).Limit(pageSize).Find(&entries).Error; err != nil {
+		return nil, 0, err
+	}
+	return entries, total, nil
+}
+
+// auditBatchSize is how many entries exports and verification read at a time.
+const auditBatchSize = 500
+
+// ExportEntries calls fn for every matching entry, oldest first, reading the
+// log in batches so large exports are streamed.
+func (s *AuditService) ExportEntries(tenantID uuid.UUID, f AuditFilter, fn func(*models.AuditLog) error) error {
+	var after int64
+	for {
+		var batch []models.AuditLog
+		if err := s.query(tenantID, f).Where("sequence > ?", after).Order("sequence asc").Limit(auditBatchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		for i := range batch {
+			if err := fn(&batch[i]); err != nil {
+				return err
+			}
+		}
+		if len(batch) < auditBatchSize {
+			return nil
+		}
+		after = batch[len(batch)-1].Sequence
+	}
+}
+
+// AuditVerification is the result of checking a tenant's hash chain.
+type AuditVerification struct {
+	Valid    bool   `json:"valid"`
+	Entries  int64  `json:"entries"`
+	HeadHash string `json:"head_hash,omitempty"` // Hash of the newest entry; keep a copy to detect truncation
+	BrokenAt *int64 `json:"broken_at,omitempty"` // Sequence of the first entry that does not verify
+	Reason   string `json:"reason,omitempty"`
+}
+
+// VerifyChain recomputes every entry's hash and checks that each entry links
+// to its predecessor without gaps.
+func (s *AuditService) VerifyChain(tenantID uuid.UUID) (*AuditVerification, error) {
+	result := &AuditVerification{Valid: true}
+	var prev models.AuditLog
+	errBroken := errors.New("chain broken")
+
+	err := s.ExportEntries(tenantID, AuditFilter{}, func(entry *models.AuditLog) error {
+		if reason := auditLinkError(&prev, entry); reason != "" {
+			seq := entry.Sequence
+			result.Valid = false
+			result.BrokenAt = &seq
+			result.Reason = reason
+			return errBroken
+		}
+		result.Entries++
+		result.HeadHash = entry.Hash
+		prev = *entry
+		return nil
+	})
+	if err != nil && !errors.Is(err, errBroken) {
+		return nil, err
+	}
+	return result, nil
+}
+
+// auditLinkError says why entry does not follow prev in a chain, or returns
+// "" if it does. prev is zero for the first entry.
+func auditLinkError(prev, entry *models.AuditLog) string {
+	switch {
+	case entry.Sequence != prev.Sequence+1:
+		return fmt.Sprintf("expected sequence %d", prev.Sequence+1)
+	case entry.PrevHash != prev.Hash:
+		return "previous hash does not match"
+	case entry.ComputeHash() != entry.Hash:
+		return "entry content does not match its hash"
+	}
+	return ""
+}
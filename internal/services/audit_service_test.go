@@ -0,0 +1,183 @@
+package services
+
+import (
+	"testing"
+	"time"
+	"tridorian-ztna/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// auditChain builds n chained entries the way recordAudit appends them.
+func auditChain(n int) []*models.AuditLog {
+	tenantID := uuid.New()
+	start := time.Date(2026, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	var chain []*models.AuditLog
+	last := &models.AuditLog{}
+	for i := 0; i < n; i++ {
+		entry := newAuditEntry(last, tenantID, Actor{Email: "admin@example.com"}, &AuditChange{
+			Action:       "access_policy.update",
+			ResourceType: "access_policy",
+			ResourceID:   uuid.NewString(),
+			Before:       map[string]any{"name": "before", "step": i},
+			After:        map[string]any{"name": "after", "step": i},
+		}, start.Add(time.Duration(i)*time.Minute))
+		chain = append(chain, entry)
+		last = entry
+	}
+	return chain
+}
+
+// verifyAuditEntries walks entries like VerifyChain and returns the sequence
+// of the first entry that does not verify, with the reason.
+func verifyAuditEntries(entries []*models.AuditLog) (int64, string) {
+	prev := &models.AuditLog{}
+	for _, entry := range entries {
+		if reason := auditLinkError(prev, entry); reason != "" {
+			return entry.Sequence, reason
+		}
+		prev = entry
+	}
+	return 0, ""
+}
+
+func TestAuditChain(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func(chain []*models.AuditLog) []*models.AuditLog
+		wantBroken int64
+		wantReason string
+	}{
+		{name: "intact"},
+		{
+			name: "read back in another time zone",
+			tamper: func(c []*models.AuditLog) []*models.AuditLog {
+				c[1].CreatedAt = c[1].CreatedAt.In(time.FixedZone("CET", 3600))
+				return c
+			},
+		},
+		{
+			name:       "snapshot edited",
+			tamper:     func(c []*models.AuditLog) []*models.AuditLog { c[1].After = `{"name":"forged"}`; return c },
+			wantBroken: 2,
+			wantReason: "entry content does not match its hash",
+		},
+		{
+			name:       "actor edited",
+			tamper:     func(c []*models.AuditLog) []*models.AuditLog { c[2].ActorEmail = "someone@example.com"; return c },
+			wantBroken: 3,
+			wantReason: "entry content does not match its hash",
+		},
+		{
+			name: "timestamp edited",
+			tamper: func(c []*models.AuditLog) []*models.AuditLog {
+				c[0].CreatedAt = c[0].CreatedAt.Add(-time.Hour)
+				return c
+			},
+			wantBroken: 1,
+			wantReason: "entry content does not match its hash",
+		},
+		{
+			name: "edited and rehashed",
+			tamper: func(c []*models.AuditLog) []*models.AuditLog {
+				c[1].Action = "access_policy.delete"
+				c[1].Hash = c[1].ComputeHash()
+				return c
+			},
+			wantBroken: 3,
+			wantReason: "previous hash does not match",
+		},
+		{
+			name: "previous hash rewritten",
+			tamper: func(c []*models.AuditLog) []*models.AuditLog {
+				c[2].PrevHash = c[0].Hash
+				c[2].Hash = c[2].ComputeHash()
+				return c
+			},
+			wantBroken: 3,
+			wantReason: "previous hash does not match",
+		},
+		{
+			name:       "entry removed",
+			tamper:     func(c []*models.AuditLog) []*models.AuditLog { return append(c[:1], c[2:]...) },
+			wantBroken: 3,
+			wantReason: "expected sequence 2",
+		},
+		{
+			name:       "first entry removed",
+			tamper:     func(c []*models.AuditLog) []*models.AuditLog { return c[1:] },
+			wantBroken: 2,
+			wantReason: "expected sequence 1",
+		},
+		{
+			name: "first entry removed and renumbered",
+			tamper: func(c []*models.AuditLog) []*models.AuditLog {
+				c = c[1:]
+				for _, e := range c {
+					e.Sequence--
+					e.Hash = e.ComputeHash()
+				}
+				return c
+			},
+			wantBroken: 1,
+			wantReason: "previous hash does not match",
+		},
+		{
+			name:       "entries reordered",
+			tamper:     func(c []*models.AuditLog) []*models.AuditLog { c[1], c[2] = c[2], c[1]; return c },
+			wantBroken: 3,
+			wantReason: "expected sequence 2",
+		},
+		{
+			name: "entries reordered and renumbered",
+			tamper: func(c []*models.AuditLog) []*models.AuditLog {
+				c[1], c[2] = c[2], c[1]
+				c[1].Sequence, c[2].Sequence = 2, 3
+				return c
+			},
+			wantBroken: 2,
+			wantReason: "previous hash does not match",
+		},
+		{
+			name: "entry from another tenant spliced in",
+			tamper: func(c []*models.AuditLog) []*models.AuditLog {
+				other := auditChain(2)[1]
+				other.PrevHash = c[0].Hash
+				c[1] = other
+				return c
+			},
+			wantBroken: 2,
+			wantReason: "entry content does not match its hash",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := auditChain(4)
+			if tt.tamper != nil {
+				chain = tt.tamper(chain)
+			}
+			broken, reason := verifyAuditEntries(chain)
+			if broken != tt.wantBroken || reason != tt.wantReason {
+				t.Fatalf("chain broken at %d (%q), want %d (%q)", broken, reason, tt.wantBroken, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestNewAuditEntry(t *testing.T) {
+	first := newAuditEntry(&models.AuditLog{}, uuid.New(), Actor{}, &AuditChange{Action: "tenant.create", ResourceType: "tenant"}, time.Now())
+	if first.Sequence != 1 || first.PrevHash != "" || first.ActorType != models.AuditActorSystem {
+		t.Fatalf("unexpected first entry %+v", first)
+	}
+	if first.Before != "" || first.After != "" {
+		t.Fatalf("nil snapshots recorded as %q and %q", first.Before, first.After)
+	}
+	if first.CreatedAt.Location() != time.UTC || first.CreatedAt.Nanosecond()%1000 != 0 {
+		t.Fatalf("CreatedAt %v is not UTC at microsecond precision", first.CreatedAt)
+	}
+
+	next := newAuditEntry(first, first.TenantID, Actor{Type: models.AuditActorAdmin}, &AuditChange{Action: "tenant.update", ResourceType: "tenant"}, time.Now())
+	if next.Sequence != 2 || next.PrevHash != first.Hash || next.Hash != next.ComputeHash() {
+		t.Fatalf("entry %+v does not follow %+v", next, first)
+	}
+}
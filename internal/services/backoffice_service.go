@@ -20,6 +20,7 @@ func (s *BackofficeService) Authenticate(email, password string) (*models.Backof
 	var user models.BackofficeUser
 	err := s.db.Where("email = ?", email).First(&user).Error
 	if err != nil {
+		EqualizeLoginTiming(password)
 		return nil, errors.New("invalid email or password")
 	}
 
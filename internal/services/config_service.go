@@ -0,0 +1,1022 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/pkg/fqdn"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// TenantConfigVersion is the version of the configuration document format.
+const TenantConfigVersion = 1
+
+// ErrNoConfigRevision is returned by Drift before any configuration was imported.
+var ErrNoConfigRevision = errors.New("no configuration has been imported yet")
+
+// TenantConfig is a tenant's configuration as a document that can be kept in
+// version control. Resources refer to each other by name, and lists are
+// sorted, so exporting an unchanged tenant gives the same document.
+//
+// A section left out of an imported document is not managed by it; an empty
+// section removes everything in it.
+type TenantConfig struct {
+	Version        int                  `json:"version" yaml:"version"`
+	PrimaryDomain  string               `json:"primary_domain,omitempty" yaml:"primary_domain,omitempty"`
+	Domains        []string             `json:"domains" yaml:"domains"` // Custom domains; the free domain is implicit
+	Nodes          []NodeConfig         `json:"nodes" yaml:"nodes"`
+	Applications   []ApplicationConfig  `json:"applications" yaml:"applications"`
+	AccessPolicies []AccessPolicyConfig `json:"access_policies" yaml:"access_policies"`
+	SignInPolicies []SignInPolicyConfig `json:"sign_in_policies" yaml:"sign_in_policies"`
+}
+
+type NodeConfig struct {
+	Name       string `json:"name" yaml:"name"`
+	SKU        string `json:"sku" yaml:"sku"` // Node SKU name
+	ClientCIDR string `json:"client_cidr,omitempty" yaml:"client_cidr,omitempty"`
+	// Empty for the default masquerade
+	EgressMode string            `json:"egress_mode,omitempty" yaml:"egress_mode,omitempty"`
+	SNATPools  []models.SNATPool `json:"snat_pools,omitempty" yaml:"snat_pools,omitempty"`
+}
+
+type ApplicationConfig struct {
+	Name         string              `json:"name" yaml:"name"`
+	Description  string              `json:"description,omitempty" yaml:"description,omitempty"`
+	Owner        string              `json:"owner,omitempty" yaml:"owner,omitempty"`
+	Tags         []string            `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Ports        []string            `json:"ports,omitempty" yaml:"ports,omitempty"` // e.g. "tcp/443", "udp/8000-8100"
+	HealthCheck  string              `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+	Destinations []DestinationConfig `json:"destinations" yaml:"destinations"`
+}
+
+type DestinationConfig struct {
+	Type  string `json:"type" yaml:"type"` // "cidr" or "fqdn"
+	Value string `json:"value" yaml:"value"`
+}
+
+type AccessPolicyConfig struct {
+	Name              string      `json:"name" yaml:"name"`
+	Priority          int         `json:"priority" yaml:"priority"`
+	Enabled           *bool       `json:"enabled,omitempty" yaml:"enabled,omitempty"` // Default true
+	Effect            string      `json:"effect,omitempty" yaml:"effect,omitempty"`
+	ResourceType      string      `json:"resource_type,omitempty" yaml:"resource_type,omitempty"`
+	ResourceID        string      `json:"resource_id,omitempty" yaml:"resource_id,omitempty"`
+	DestinationType   string      `json:"destination_type" yaml:"destination_type"`
+	DestinationCIDR   string      `json:"destination_cidr,omitempty" yaml:"destination_cidr,omitempty"`
+	DestinationApp    string      `json:"destination_app,omitempty" yaml:"destination_app,omitempty"` // Application name
+	DestinationAppTag string      `json:"destination_app_tag,omitempty" yaml:"destination_app_tag,omitempty"`
+	DestinationSNI    string      `json:"destination_sni,omitempty" yaml:"destination_sni,omitempty"`
+	DestinationFQDN   string      `json:"destination_fqdn,omitempty" yaml:"destination_fqdn,omitempty"`
+	Nodes             []string    `json:"nodes,omitempty" yaml:"nodes,omitempty"` // Node names
+	Rule              *PolicyRule `json:"rule,omitempty" yaml:"rule,omitempty"`
+}
+
+type SignInPolicyConfig struct {
+	Name     string      `json:"name" yaml:"name"`
+	Priority int         `json:"priority" yaml:"priority"`
+	Enabled  *bool       `json:"enabled,omitempty" yaml:"enabled,omitempty"` // Default true
+	Stage    string      `json:"stage,omitempty" yaml:"stage,omitempty"`     // "pre_auth" (default) or "post_auth"
+	Block    bool        `json:"block,omitempty" yaml:"block,omitempty"`
+	Rule     *PolicyRule `json:"rule,omitempty" yaml:"rule,omitempty"`
+}
+
+// PolicyRule is a policy's rule tree: an AND/OR of child rules, or a
+// single condition.
+type PolicyRule struct {
+	Operator  string         `json:"operator,omitempty" yaml:"operator,omitempty"`
+	Condition *RuleCondition `json:"condition,omitempty" yaml:"condition,omitempty"`
+	Children  []PolicyRule   `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+type RuleCondition struct {
+	Type     string `json:"type" yaml:"type"`
+	Field    string `json:"field" yaml:"field"`
+	Op       string `json:"op" yaml:"op"`
+	Value    string `json:"value" yaml:"value"`
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"`
+}
+
+// Kinds of configuration changes.
+const (
+	ConfigKindDomain        = "domain"
+	ConfigKindPrimaryDomain = "primary_domain"
+	ConfigKindNode          = "node"
+	ConfigKindApplication   = "application"
+	ConfigKindAccessPolicy  = "access_policy"
+	ConfigKindSignInPolicy  = "sign_in_policy"
+)
+
+// ConfigChange is one change an import makes, or would make.
+type ConfigChange struct {
+	Kind   string   `json:"kind" yaml:"kind"`
+	Name   string   `json:"name" yaml:"name"`
+	Action string   `json:"action" yaml:"action"`                     // "create", "update" or "delete"
+	Fields []string `json:"fields,omitempty" yaml:"fields,omitempty"` // The fields an update changes
+}
+
+// ConfigPlan is the result of an import: the changes in the order they are
+// made, and whether they were.
+type ConfigPlan struct {
+	Changes    []ConfigChange `json:"changes"`
+	Applied    bool           `json:"applied"`
+	RevisionID *uuid.UUID     `json:"revision_id,omitempty"`
+}
+
+// ConfigDrift compares the live configuration with the last import.
+// Changes are what importing that document again would do.
+type ConfigDrift struct {
+	InSync     bool           `json:"in_sync"`
+	RevisionID uuid.UUID      `json:"revision_id"`
+	AppliedAt  time.Time      `json:"applied_at"`
+	AppliedBy  string         `json:"applied_by,omitempty"`
+	Changes    []ConfigChange `json:"changes"`
+}
+
+// ConfigService exports and imports tenant configuration documents.
+type ConfigService struct {
+	db    *gorm.DB
+	cache *redis.Client
+}
+
+func NewConfigService(db *gorm.DB, cache *redis.Client) *ConfigService {
+	return &ConfigService{db: db, cache: cache}
+}
+
+// configState is a tenant's live configuration with the records behind the
+// names.
+type configState struct {
+	config TenantConfig
+
+	freeDomain      string
+	verifiedDomains map[string]bool
+	skus            map[string]uuid.UUID
+	nodes           map[string]models.Node
+	apps            map[string]models.Application
+	accessPolicies  map[string]models.AccessPolicy
+	signInPolicies  map[string]models.SignInPolicy
+}
+
+// Export returns the tenant's configuration.
+func (s *ConfigService) Export(tenantID uuid.UUID) (*TenantConfig, error) {
+	state, err := s.load(s.db, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return &state.config, nil
+}
+
+// Import makes the tenant's configuration match doc, or with dryRun only
+// plans the changes. All changes are made in one transaction, each recorded
+// in the audit log, and the document is kept as the new revision.
+func (s *ConfigService) Import(tenantID uuid.UUID, doc *TenantConfig, dryRun bool, actor Actor) (*ConfigPlan, error) {
+	if doc.Version != TenantConfigVersion {
+		return nil, fmt.Errorf("unsupported configuration version %d: expected %d", doc.Version, TenantConfigVersion)
+	}
+	if dryRun {
+		_, changes, err := s.plan(s.db, tenantID, doc)
+		if err != nil {
+			return nil, err
+		}
+		return &ConfigPlan{Changes: changes}, nil
+	}
+
+	plan := &ConfigPlan{Applied: true}
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// One import at a time per tenant, so plans are made against what they change
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtextextended(?, 0))", "config_import:"+tenantID.String()).Error; err != nil {
+			return err
+		}
+		desired, changes, err := s.plan(tx, tenantID, doc)
+		if err != nil {
+			return err
+		}
+		plan.Changes = changes
+		if err := s.apply(tx, tenantID, desired, changes, actor); err != nil {
+			return err
+		}
+
+		document, err := json.Marshal(desired)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(document)
+		hash := hex.EncodeToString(sum[:])
+
+		var last models.ConfigRevision
+		if err := tx.Scopes(models.TenantScope(tenantID)).Order("created_at desc").Limit(1).Find(&last).Error; err != nil {
+			return err
+		}
+		if len(changes) == 0 && last.Hash == hash {
+			plan.RevisionID = &last.ID
+			return nil
+		}
+		revision := models.ConfigRevision{
+			BaseTenant: models.BaseTenant{TenantID: tenantID},
+			Document:   string(document),
+			Hash:       hash,
+			AppliedBy:  actor.Email,
+			Changes:    len(changes),
+		}
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+		plan.RevisionID = &revision.ID
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// Drift plans the last imported document against the live configuration.
+func (s *ConfigService) Drift(tenantID uuid.UUID) (*ConfigDrift, error) {
+	var revision models.ConfigRevision
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Order("created_at desc").Limit(1).Find(&revision).Error; err != nil {
+		return nil, err
+	}
+	if revision.ID == uuid.Nil {
+		return nil, ErrNoConfigRevision
+	}
+
+	var doc TenantConfig
+	if err := json.Unmarshal([]byte(revision.Document), &doc); err != nil {
+		return nil, fmt.Errorf("stored configuration is unreadable: %w", err)
+	}
+	_, changes, err := s.plan(s.db, tenantID, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("the last imported configuration no longer applies: %w", err)
+	}
+	return &ConfigDrift{
+		InSync:     len(changes) == 0,
+		RevisionID: revision.ID,
+		AppliedAt:  revision.CreatedAt,
+		AppliedBy:  revision.AppliedBy,
+		Changes:    changes,
+	}, nil
+}
+
+// load reads the tenant's live configuration. Resources that share a name
+// cannot be told apart in a document, so they are reported as an error.
+func (s *ConfigService) load(db *gorm.DB, tenantID uuid.UUID) (*configState, error) {
+	tenants := NewTenantService(db)
+	tenant, err := tenants.GetTenantByID(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	state := &configState{
+		config: TenantConfig{
+			Version:       TenantConfigVersion,
+			PrimaryDomain: strings.ToLower(tenant.PrimaryDomain),
+		},
+		freeDomain:      strings.ToLower(tenant.Slug + tenants.GetFreeDomainSuffix()),
+		verifiedDomains: make(map[string]bool),
+		skus:            make(map[string]uuid.UUID),
+		nodes:           make(map[string]models.Node),
+		apps:            make(map[string]models.Application),
+		accessPolicies:  make(map[string]models.AccessPolicy),
+		signInPolicies:  make(map[string]models.SignInPolicy),
+	}
+	cfg := &state.config
+
+	var domains []models.CustomDomain
+	if err := db.Scopes(models.TenantScope(tenantID)).Find(&domains).Error; err != nil {
+		return nil, err
+	}
+	cfg.Domains = []string{}
+	for _, d := range domains {
+		name := strings.ToLower(d.Domain)
+		cfg.Domains = append(cfg.Domains, name)
+		state.verifiedDomains[name] = d.IsVerified
+	}
+
+	var skus []models.NodeSku
+	if err := db.Order("created_at asc").Find(&skus).Error; err != nil {
+		return nil, err
+	}
+	skuNames := make(map[uuid.UUID]string)
+	for _, sku := range skus {
+		skuNames[sku.ID] = sku.Name
+		if _, ok := state.skus[sku.Name]; !ok {
+			state.skus[sku.Name] = sku.ID
+		}
+	}
+
+	var nodes []models.Node
+	if err := db.Scopes(models.TenantScope(tenantID)).Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	nodeNames := make(map[uuid.UUID]string)
+	cfg.Nodes = []NodeConfig{}
+	for _, n := range nodes {
+		if _, ok := state.nodes[n.Name]; ok {
+			return nil, duplicateNameError("nodes", n.Name)
+		}
+		state.nodes[n.Name] = n
+		nodeNames[n.ID] = n.Name
+		node := NodeConfig{Name: n.Name, SKU: skuNames[n.NodeSkuID], ClientCIDR: n.ClientCIDR}
+		if n.EgressMode != "" && n.EgressMode != models.EgressMasquerade {
+			node.EgressMode, node.SNATPools = n.EgressMode, n.SNATPools
+		}
+		cfg.Nodes = append(cfg.Nodes, node)
+	}
+
+	var apps []models.Application
+	if err := db.Scopes(models.TenantScope(tenantID)).Preload("Destinations").Find(&apps).Error; err != nil {
+		return nil, err
+	}
+	appNames := make(map[uuid.UUID]string)
+	cfg.Applications = []ApplicationConfig{}
+	for _, a := range apps {
+		if _, ok := state.apps[a.Name]; ok {
+			return nil, duplicateNameError("applications", a.Name)
+		}
+		state.apps[a.Name] = a
+		appNames[a.ID] = a.Name
+		cfg.Applications = append(cfg.Applications, applicationConfig(&a))
+	}
+
+	policyService := NewPolicyService(db, s.cache)
+	var accessPolicies []models.AccessPolicy
+	if err := db.Scopes(models.TenantScope(tenantID)).Preload("Nodes").Find(&accessPolicies).Error; err != nil {
+		return nil, err
+	}
+	cfg.AccessPolicies = []AccessPolicyConfig{}
+	for _, p := range accessPolicies {
+		if _, ok := state.accessPolicies[p.Name]; ok {
+			return nil, duplicateNameError("access policies", p.Name)
+		}
+		if p.RootNodeID != nil {
+			if node, err := policyService.LoadNodeRecursive(*p.RootNodeID); err == nil {
+				p.RootNode = *node
+			}
+		}
+		state.accessPolicies[p.Name] = p
+		cfg.AccessPolicies = append(cfg.AccessPolicies, accessPolicyConfig(&p, appNames, nodeNames))
+	}
+
+	var signInPolicies []models.SignInPolicy
+	if err := db.Scopes(models.TenantScope(tenantID)).Find(&signInPolicies).Error; err != nil {
+		return nil, err
+	}
+	cfg.SignInPolicies = []SignInPolicyConfig{}
+	for _, p := range signInPolicies {
+		if _, ok := state.signInPolicies[p.Name]; ok {
+			return nil, duplicateNameError("sign-in policies", p.Name)
+		}
+		if p.RootNodeID != uuid.Nil {
+			if node, err := policyService.LoadNodeRecursive(p.RootNodeID); err == nil {
+				p.RootNode = *node
+			}
+		}
+		state.signInPolicies[p.Name] = p
+		cfg.SignInPolicies = append(cfg.SignInPolicies, signInPolicyConfig(&p))
+	}
+
+	// Sorted here rather than by the database, whose collation may differ
+	slices.Sort(cfg.Domains)
+	slices.SortFunc(cfg.Nodes, func(a, b NodeConfig) int { return strings.Compare(a.Name, b.Name) })
+	slices.SortFunc(cfg.Applications, func(a, b ApplicationConfig) int { return strings.Compare(a.Name, b.Name) })
+	sortPolicies(cfg.AccessPolicies, func(p AccessPolicyConfig) (int, string) { return p.Priority, p.Name })
+	sortPolicies(cfg.SignInPolicies, func(p SignInPolicyConfig) (int, string) { return p.Priority, p.Name })
+	return state, nil
+}
+
+func duplicateNameError(kind, name string) error {
+	return fmt.Errorf("several %s are named %q: give them unique names first", kind, name)
+}
+
+// plan validates doc against the tenant's live configuration and returns
+// it in canonical form with the changes needed, in the order apply makes
+// them: new things before the things that refer to them, removals after.
+func (s *ConfigService) plan(db *gorm.DB, tenantID uuid.UUID, doc *TenantConfig) (*configState, []ConfigChange, error) {
+	current, err := s.load(db, tenantID)
+	if err != nil {
+		return nil, nil, err
+	}
+	desired, err := canonicalConfig(current, doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	cur, want := &current.config, &desired.config
+
+	changes := []ConfigChange{}
+	var domainDeletes []ConfigChange
+	if want.Domains != nil {
+		var creates []ConfigChange
+		creates, domainDeletes = diffSection(ConfigKindDomain, cur.Domains, want.Domains, func(d string) string { return d })
+		changes = append(changes, creates...)
+	}
+	if want.PrimaryDomain != "" && want.PrimaryDomain != cur.PrimaryDomain {
+		changes = append(changes, ConfigChange{Kind: ConfigKindPrimaryDomain, Name: want.PrimaryDomain, Action: "update"})
+	}
+	changes = append(changes, domainDeletes...)
+
+	var nodeDeletes, appDeletes []ConfigChange
+	if want.Nodes != nil {
+		var upserts []ConfigChange
+		upserts, nodeDeletes = diffSection(ConfigKindNode, cur.Nodes, want.Nodes, func(n NodeConfig) string { return n.Name })
+		changes = append(changes, upserts...)
+	}
+	if want.Applications != nil {
+		var upserts []ConfigChange
+		upserts, appDeletes = diffSection(ConfigKindApplication, cur.Applications, want.Applications, func(a ApplicationConfig) string { return a.Name })
+		changes = append(changes, upserts...)
+	}
+	var policyUpserts []ConfigChange
+	if want.AccessPolicies != nil {
+		upserts, deletes := diffSection(ConfigKindAccessPolicy, cur.AccessPolicies, want.AccessPolicies, func(p AccessPolicyConfig) string { return p.Name })
+		changes = append(changes, deletes...)
+		policyUpserts = append(policyUpserts, upserts...)
+	}
+	if want.SignInPolicies != nil {
+		upserts, deletes := diffSection(ConfigKindSignInPolicy, cur.SignInPolicies, want.SignInPolicies, func(p SignInPolicyConfig) string { return p.Name })
+		changes = append(changes, deletes...)
+		policyUpserts = append(policyUpserts, upserts...)
+	}
+	// Users and groups the new rules name must exist, as the policy editor checks
+	policyService := NewPolicyService(db, s.cache)
+	for _, c := range policyUpserts {
+		var rule *PolicyRule
+		if c.Kind == ConfigKindAccessPolicy {
+			rule = findByName(want.AccessPolicies, c.Name, func(p AccessPolicyConfig) string { return p.Name }).Rule
+		} else {
+			rule = findByName(want.SignInPolicies, c.Name, func(p SignInPolicyConfig) string { return p.Name }).Rule
+		}
+		node := policyNode(rule)
+		if err := policyService.validateIdentities(tenantID, &node); err != nil {
+			return nil, nil, fmt.Errorf("%s %q: %w", strings.ReplaceAll(c.Kind, "_", " "), c.Name, err)
+		}
+	}
+	changes = append(changes, policyUpserts...)
+	changes = append(changes, appDeletes...)
+	changes = append(changes, nodeDeletes...)
+	return desired, changes, nil
+}
+
+// diffSection compares a section by name. Creates and updates are returned
+// in the desired order, deletes in the current order.
+func diffSection[T any](kind string, current, desired []T, name func(T) string) (upserts, deletes []ConfigChange) {
+	byName := make(map[string]T, len(current))
+	for _, item := range current {
+		byName[name(item)] = item
+	}
+	wanted := make(map[string]bool, len(desired))
+	for _, item := range desired {
+		wanted[name(item)] = true
+		existing, ok := byName[name(item)]
+		if !ok {
+			upserts = append(upserts, ConfigChange{Kind: kind, Name: name(item), Action: "create"})
+		} else if fields := changedFields(existing, item); len(fields) > 0 {
+			upserts = append(upserts, ConfigChange{Kind: kind, Name: name(item), Action: "update", Fields: fields})
+		}
+	}
+	for _, item := range current {
+		if !wanted[name(item)] {
+			deletes = append(deletes, ConfigChange{Kind: kind, Name: name(item), Action: "delete"})
+		}
+	}
+	return upserts, deletes
+}
+
+// changedFields lists the document fields that differ between a and b.
+func changedFields(a, b any) []string {
+	var fa, fb map[string]any
+	if data, err := json.Marshal(a); err == nil {
+		json.Unmarshal(data, &fa)
+	}
+	if data, err := json.Marshal(b); err == nil {
+		json.Unmarshal(data, &fb)
+	}
+	if fa == nil || fb == nil {
+		return nil
+	}
+
+	var fields []string
+	for k, v := range fa {
+		if !reflect.DeepEqual(v, fb[k]) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range fb {
+		if _, ok := fa[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// canonicalConfig validates doc and normalizes it the way the services
+// store it, so that an unchanged resource compares equal. References are
+// checked against the document's sections, or the live configuration for
+// sections the document does not manage.
+func canonicalConfig(current *configState, doc *TenantConfig) (*configState, error) {
+	desired := &configState{
+		config:          TenantConfig{Version: doc.Version},
+		freeDomain:      current.freeDomain,
+		verifiedDomains: current.verifiedDomains,
+		skus:            current.skus,
+		nodes:           current.nodes,
+		apps:            current.apps,
+		accessPolicies:  current.accessPolicies,
+		signInPolicies:  current.signInPolicies,
+	}
+	want := &desired.config
+
+	domains := current.config.Domains
+	if doc.Domains != nil {
+		want.Domains = []string{}
+		seen := make(map[string]bool)
+		for _, d := range doc.Domains {
+			d = strings.ToLower(strings.TrimSpace(d))
+			if d == current.freeDomain {
+				return nil, fmt.Errorf("domain %q is the tenant's free domain, which is always available: remove it from domains", d)
+			}
+			if err := fqdn.Validate(d); err != nil || fqdn.IsWildcard(d) {
+				return nil, fmt.Errorf("invalid domain %q", d)
+			}
+			if seen[d] {
+				return nil, fmt.Errorf("domain %q is listed twice", d)
+			}
+			seen[d] = true
+			want.Domains = append(want.Domains, d)
+		}
+		slices.Sort(want.Domains)
+		domains = want.Domains
+	}
+
+	primary := current.config.PrimaryDomain
+	if doc.PrimaryDomain != "" {
+		primary = strings.ToLower(strings.TrimSpace(doc.PrimaryDomain))
+		if primary != current.freeDomain && (!current.verifiedDomains[primary] || !slices.Contains(domains, primary)) {
+			return nil, fmt.Errorf("primary domain %q must be the free domain or a verified custom domain", primary)
+		}
+		want.PrimaryDomain = primary
+	}
+	if primary != "" && primary != current.freeDomain && !slices.Contains(domains, primary) {
+		return nil, fmt.Errorf("domain %q is the primary domain: set primary_domain to another domain to remove it", primary)
+	}
+
+	if doc.Nodes != nil {
+		want.Nodes = []NodeConfig{}
+		seen := make(map[string]bool)
+		for _, n := range doc.Nodes {
+			n.Name = strings.TrimSpace(n.Name)
+			n.SKU = strings.TrimSpace(n.SKU)
+			n.ClientCIDR = strings.TrimSpace(n.ClientCIDR)
+			if n.Name == "" {
+				return nil, errors.New("every node needs a name")
+			}
+			if seen[n.Name] {
+				return nil, duplicateNameError("nodes", n.Name)
+			}
+			seen[n.Name] = true
+			if _, ok := current.skus[n.SKU]; !ok {
+				return nil, fmt.Errorf("node %q: unknown SKU %q", n.Name, n.SKU)
+			}
+			if n.ClientCIDR != "" {
+				if _, err := netip.ParsePrefix(n.ClientCIDR); err != nil {
+					return nil, fmt.Errorf("node %q: invalid client CIDR %q", n.Name, n.ClientCIDR)
+				}
+			}
+			mode, pools, err := validateEgress(n.EgressMode, n.SNATPools)
+			if err != nil {
+				return nil, fmt.Errorf("node %q: %v", n.Name, err)
+			}
+			n.EgressMode, n.SNATPools = mode, pools
+			if mode == models.EgressMasquerade {
+				n.EgressMode = ""
+			}
+			want.Nodes = append(want.Nodes, n)
+		}
+		slices.SortFunc(want.Nodes, func(a, b NodeConfig) int { return strings.Compare(a.Name, b.Name) })
+	}
+	nodeExists := func(name string) bool {
+		if want.Nodes != nil {
+			return slices.ContainsFunc(want.Nodes, func(n NodeConfig) bool { return n.Name == name })
+		}
+		_, ok := current.nodes[name]
+		return ok
+	}
+
+	if doc.Applications != nil {
+		want.Applications = []ApplicationConfig{}
+		seen := make(map[string]bool)
+		for _, a := range doc.Applications {
+			app := applicationModel(&a)
+			if err := validateApplication(app); err != nil {
+				return nil, fmt.Errorf("application %q: %w", a.Name, err)
+			}
+			if seen[app.Name] {
+				return nil, duplicateNameError("applications", app.Name)
+			}
+			seen[app.Name] = true
+			want.Applications = append(want.Applications, applicationConfig(app))
+		}
+		slices.SortFunc(want.Applications, func(a, b ApplicationConfig) int { return strings.Compare(a.Name, b.Name) })
+	}
+	appExists := func(name string) bool {
+		if want.Applications != nil {
+			return slices.ContainsFunc(want.Applications, func(a ApplicationConfig) bool { return a.Name == name })
+		}
+		_, ok := current.apps[name]
+		return ok
+	}
+
+	policies := current.config.AccessPolicies
+	if doc.AccessPolicies != nil {
+		want.AccessPolicies = []AccessPolicyConfig{}
+		seen := make(map[string]bool)
+		for _, p := range doc.AccessPolicies {
+			p.Name = strings.TrimSpace(p.Name)
+			if p.Name == "" {
+				return nil, errors.New("every access policy needs a name")
+			}
+			if seen[p.Name] {
+				return nil, duplicateNameError("access policies", p.Name)
+			}
+			seen[p.Name] = true
+
+			if p.DestinationType == "app" && strings.TrimSpace(p.DestinationApp) == "" {
+				return nil, fmt.Errorf("access policy %q: destination_app is required", p.Name)
+			}
+			p.DestinationApp = strings.TrimSpace(p.DestinationApp)
+			// The model is only for validation, so new applications get a placeholder ID
+			policy := accessPolicyModel(&p, func(string) uuid.UUID { return uuid.New() }, nil)
+			if err := validateDestination(policy); err != nil {
+				return nil, fmt.Errorf("access policy %q: %w", p.Name, err)
+			}
+			if err := validatePolicyTree(&policy.RootNode); err != nil {
+				return nil, fmt.Errorf("access policy %q: %w", p.Name, err)
+			}
+			p.DestinationAppTag = policy.DestinationAppTag
+			if p.DestinationType != "app" {
+				p.DestinationApp = ""
+			} else if !appExists(p.DestinationApp) {
+				return nil, fmt.Errorf("access policy %q: unknown application %q", p.Name, p.DestinationApp)
+			}
+			var nodes []string
+			for _, name := range p.Nodes {
+				name = strings.TrimSpace(name)
+				if !nodeExists(name) {
+					return nil, fmt.Errorf("access policy %q: unknown node %q", p.Name, name)
+				}
+				if !slices.Contains(nodes, name) {
+					nodes = append(nodes, name)
+				}
+			}
+			slices.Sort(nodes)
+			p.Nodes = nodes
+			p.Enabled = boolPtr(p.Enabled == nil || *p.Enabled)
+			p.Rule = policyRule(&policy.RootNode)
+			want.AccessPolicies = append(want.AccessPolicies, p)
+		}
+		sortPolicies(want.AccessPolicies, func(p AccessPolicyConfig) (int, string) { return p.Priority, p.Name })
+		policies = want.AccessPolicies
+	}
+	// Sections the document manages must not remove what live policies use
+	for _, p := range policies {
+		if p.DestinationApp != "" && !appExists(p.DestinationApp) {
+			return nil, fmt.Errorf("application %q is used by access policy %q", p.DestinationApp, p.Name)
+		}
+		for _, name := range p.Nodes {
+			if !nodeExists(name) {
+				return nil, fmt.Errorf("node %q is used by access policy %q", name, p.Name)
+			}
+		}
+	}
+
+	if doc.SignInPolicies != nil {
+		want.SignInPolicies = []SignInPolicyConfig{}
+		seen := make(map[string]bool)
+		for _, p := range doc.SignInPolicies {
+			p.Name = strings.TrimSpace(p.Name)
+			if p.Name == "" {
+				return nil, errors.New("every sign-in policy needs a name")
+			}
+			if seen[p.Name] {
+				return nil, duplicateNameError("sign-in policies", p.Name)
+			}
+			seen[p.Name] = true
+			if p.Stage == "" {
+				p.Stage = "pre_auth"
+			}
+			if p.Stage != "pre_auth" && p.Stage != "post_auth" {
+				return nil, fmt.Errorf("sign-in policy %q: stage must be pre_auth or post_auth", p.Name)
+			}
+			policy := signInPolicyModel(&p)
+			if err := validatePolicyTree(&policy.RootNode); err != nil {
+				return nil, fmt.Errorf("sign-in policy %q: %w", p.Name, err)
+			}
+			p.Enabled = boolPtr(p.Enabled == nil || *p.Enabled)
+			p.Rule = policyRule(&policy.RootNode)
+			want.SignInPolicies = append(want.SignInPolicies, p)
+		}
+		sortPolicies(want.SignInPolicies, func(p SignInPolicyConfig) (int, string) { return p.Priority, p.Name })
+	}
+	return desired, nil
+}
+
+func sortPolicies[T any](policies []T, key func(T) (int, string)) {
+	slices.SortStableFunc(policies, func(a, b T) int {
+		pa, na := key(a)
+		pb, nb := key(b)
+		if pa != pb {
+			return pa - pb
+		}
+		return strings.Compare(na, nb)
+	})
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// apply makes the planned changes in tx with the services that make them
+// through the API, so each one is validated and audited the same way.
+func (s *ConfigService) apply(tx *gorm.DB, tenantID uuid.UUID, desired *configState, changes []ConfigChange, actor Actor) error {
+	tenants := NewTenantService(tx)
+	nodeService := NewNodeService(tx, s.cache)
+	appService := NewApplicationService(tx, s.cache)
+	policyService := NewPolicyService(tx, s.cache)
+	want := &desired.config
+
+	// IDs of the nodes and applications policies refer to, including new ones
+	nodeIDs := make(map[string]uuid.UUID)
+	for name, n := range desired.nodes {
+		nodeIDs[name] = n.ID
+	}
+	appIDs := make(map[string]uuid.UUID)
+	for name, a := range desired.apps {
+		appIDs[name] = a.ID
+	}
+	appID := func(name string) uuid.UUID { return appIDs[name] }
+
+	for _, c := range changes {
+		var err error
+		switch c.Kind + "." + c.Action {
+		case "domain.create":
+			_, err = tenants.RegisterCustomDomain(tenantID, c.Name, actor)
+		case "domain.delete":
+			err = tenants.DeleteCustomDomain(tenantID, c.Name, actor)
+		case "primary_domain.update":
+			err = tenants.ActivateDomain(tenantID, c.Name, actor)
+
+		case "node.create":
+			n := findByName(want.Nodes, c.Name, func(n NodeConfig) string { return n.Name })
+			// The enrollment token is not shown: administrators issue a
+			// new one when they install the gateway
+			var node *models.Node
+			if node, _, err = nodeService.CreateNode(tenantID, n.Name, desired.skus[n.SKU], n.ClientCIDR, actor); err == nil {
+				nodeIDs[n.Name] = node.ID
+				if n.EgressMode != "" {
+					_, err = nodeService.SetNodeEgress(tenantID, node.ID, n.EgressMode, n.SNATPools, actor)
+				}
+			}
+		case "node.update":
+			n := findByName(want.Nodes, c.Name, func(n NodeConfig) string { return n.Name })
+			if slices.Contains(c.Fields, "sku") || slices.Contains(c.Fields, "client_cidr") {
+				_, err = nodeService.UpdateNode(tenantID, nodeIDs[n.Name], desired.skus[n.SKU], n.ClientCIDR, actor)
+			}
+			if err == nil && (slices.Contains(c.Fields, "egress_mode") || slices.Contains(c.Fields, "snat_pools")) {
+				_, err = nodeService.SetNodeEgress(tenantID, nodeIDs[n.Name], n.EgressMode, n.SNATPools, actor)
+			}
+		case "node.delete":
+			err = nodeService.DeleteNode(tenantID, nodeIDs[c.Name], actor)
+
+		case "application.create":
+			a := findByName(want.Applications, c.Name, func(a ApplicationConfig) string { return a.Name })
+			var app *models.Application
+			if app, err = appService.CreateApplication(tenantID, applicationModel(&a), actor); err == nil {
+				appIDs[app.Name] = app.ID
+			}
+		case "application.update":
+			a := findByName(want.Applications, c.Name, func(a ApplicationConfig) string { return a.Name })
+			app := applicationModel(&a)
+			app.ID = appIDs[a.Name]
+			err = appService.UpdateApplication(tenantID, app, actor)
+		case "application.delete":
+			err = appService.DeleteApplication(tenantID, appIDs[c.Name], actor)
+
+		case "access_policy.create":
+			p := findByName(want.AccessPolicies, c.Name, func(p AccessPolicyConfig) string { return p.Name })
+			var policy *models.AccessPolicy
+			policy, err = policyService.CreateAccessPolicy(tenantID, accessPolicyModel(&p, appID, nodeIDs), actor)
+			// New policies start enabled
+			if err == nil && !*p.Enabled {
+				policy.Enabled = false
+				_, err = policyService.UpdateAccessPolicy(tenantID, policy, actor)
+			}
+		case "access_policy.update":
+			p := findByName(want.AccessPolicies, c.Name, func(p AccessPolicyConfig) string { return p.Name })
+			policy := accessPolicyModel(&p, appID, nodeIDs)
+			policy.BaseModel = desired.accessPolicies[p.Name].BaseModel
+			_, err = policyService.UpdateAccessPolicy(tenantID, policy, actor)
+		case "access_policy.delete":
+			err = policyService.DeleteAccessPolicy(tenantID, desired.accessPolicies[c.Name].ID, actor)
+
+		case "sign_in_policy.create":
+			p := findByName(want.SignInPolicies, c.Name, func(p SignInPolicyConfig) string { return p.Name })
+			var policy *models.SignInPolicy
+			policy, err = policyService.CreateSignInPolicy(tenantID, signInPolicyModel(&p), actor)
+			if err == nil && !*p.Enabled {
+				policy.Enabled = false
+				_, err = policyService.UpdateSignInPolicy(tenantID, policy, actor)
+			}
+		case "sign_in_policy.update":
+			p := findByName(want.SignInPolicies, c.Name, func(p SignInPolicyConfig) string { return p.Name })
+			policy := signInPolicyModel(&p)
+			policy.BaseModel = desired.signInPolicies[p.Name].BaseModel
+			_, err = policyService.UpdateSignInPolicy(tenantID, policy, actor)
+		case "sign_in_policy.delete":
+			err = policyService.DeleteSignInPolicy(tenantID, desired.signInPolicies[c.Name].ID, actor)
+
+		default:
+			err = errors.New("unknown change")
+		}
+		if err != nil {
+			return fmt.Errorf("%s %s %q: %w", c.Action, strings.ReplaceAll(c.Kind, "_", " "), c.Name, err)
+		}
+	}
+	return nil
+}
+
+func findByName[T any](items []T, name string, key func(T) string) T {
+	i := slices.IndexFunc(items, func(item T) bool { return key(item) == name })
+	return items[i]
+}
+
+func applicationConfig(app *models.Application) ApplicationConfig {
+	cfg := ApplicationConfig{
+		Name:         app.Name,
+		Description:  app.Description,
+		Owner:        app.Owner,
+		Tags:         splitList(app.Tags),
+		Ports:        splitList(app.Ports),
+		HealthCheck:  app.HealthCheck,
+		Destinations: []DestinationConfig{},
+	}
+	for _, d := range app.Destinations {
+		cfg.Destinations = append(cfg.Destinations, DestinationConfig{Type: d.Type, Value: d.Value})
+	}
+	slices.SortFunc(cfg.Destinations, func(a, b DestinationConfig) int {
+		return strings.Compare(a.Type+" "+a.Value, b.Type+" "+b.Value)
+	})
+	return cfg
+}
+
+func applicationModel(cfg *ApplicationConfig) *models.Application {
+	app := &models.Application{
+		Name:        cfg.Name,
+		Description: cfg.Description,
+		Owner:       cfg.Owner,
+		Tags:        strings.Join(cfg.Tags, ","),
+		Ports:       strings.Join(cfg.Ports, ","),
+		HealthCheck: cfg.HealthCheck,
+	}
+	for _, d := range cfg.Destinations {
+		app.Destinations = append(app.Destinations, models.ApplicationDestination{Type: d.Type, Value: d.Value})
+	}
+	return app
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func accessPolicyConfig(p *models.AccessPolicy, appNames, nodeNames map[uuid.UUID]string) AccessPolicyConfig {
+	cfg := AccessPolicyConfig{
+		Name:              p.Name,
+		Priority:          p.Priority,
+		Enabled:           boolPtr(p.Enabled),
+		Effect:            p.Effect,
+		ResourceType:      p.ResourceType,
+		ResourceID:        p.ResourceID,
+		DestinationType:   p.DestinationType,
+		DestinationCIDR:   p.DestinationCIDR,
+		DestinationAppTag: p.DestinationAppTag,
+		DestinationSNI:    p.DestinationSNI,
+		DestinationFQDN:   p.DestinationFQDN,
+		Rule:              policyRule(&p.RootNode),
+	}
+	if p.DestinationType == "app" && p.DestinationAppID != nil {
+		cfg.DestinationApp = appNames[*p.DestinationAppID]
+	}
+	for _, n := range p.Nodes {
+		if name, ok := nodeNames[n.ID]; ok {
+			cfg.Nodes = append(cfg.Nodes, name)
+		}
+	}
+	slices.Sort(cfg.Nodes)
+	return cfg
+}
+
+// accessPolicyModel builds the policy a document describes, resolving
+// names to IDs.
+func accessPolicyModel(cfg *AccessPolicyConfig, appID func(string) uuid.UUID, nodeIDs map[string]uuid.UUID) *models.AccessPolicy {
+	policy := &models.AccessPolicy{
+		BasePolicy: models.BasePolicy{
+			Name:     cfg.Name,
+			Priority: cfg.Priority,
+			Enabled:  cfg.Enabled == nil || *cfg.Enabled,
+		},
+		Effect:            cfg.Effect,
+		ResourceType:      cfg.ResourceType,
+		ResourceID:        cfg.ResourceID,
+		DestinationType:   cfg.DestinationType,
+		DestinationCIDR:   cfg.DestinationCIDR,
+		DestinationAppTag: cfg.DestinationAppTag,
+		DestinationSNI:    cfg.DestinationSNI,
+		DestinationFQDN:   cfg.DestinationFQDN,
+		RootNode:          policyNode(cfg.Rule),
+	}
+	if cfg.DestinationType == "app" && cfg.DestinationApp != "" {
+		id := appID(cfg.DestinationApp)
+		policy.DestinationAppID = &id
+	}
+	for _, name := range cfg.Nodes {
+		policy.Nodes = append(policy.Nodes, models.Node{BaseModel: models.BaseModel{ID: nodeIDs[name]}})
+	}
+	return policy
+}
+
+func signInPolicyConfig(p *models.SignInPolicy) SignInPolicyConfig {
+	return SignInPolicyConfig{
+		Name:     p.Name,
+		Priority: p.Priority,
+		Enabled:  boolPtr(p.Enabled),
+		Stage:    p.Stage,
+		Block:    p.Block,
+		Rule:     policyRule(&p.RootNode),
+	}
+}
+
+func signInPolicyModel(cfg *SignInPolicyConfig) *models.SignInPolicy {
+	return &models.SignInPolicy{
+		BasePolicy: models.BasePolicy{
+			Name:     cfg.Name,
+			Priority: cfg.Priority,
+			Enabled:  cfg.Enabled == nil || *cfg.Enabled,
+		},
+		Stage:    cfg.Stage,
+		Block:    cfg.Block,
+		RootNode: policyNode(cfg.Rule),
+	}
+}
+
+// policyRule converts a rule tree for a document. Empty nodes are dropped
+// and children are sorted, as their order does not matter.
+func policyRule(node *models.PolicyNode) *PolicyRule {
+	rule := &PolicyRule{Operator: node.Operator}
+	if c := node.Condition; c != nil {
+		rule.Condition = &RuleCondition{Type: c.Type, Field: c.Field, Op: c.Op, Value: c.Value, Timezone: c.Timezone}
+	}
+	for i := range node.Children {
+		if child := policyRule(&node.Children[i]); child != nil {
+			rule.Children = append(rule.Children, *child)
+		}
+	}
+	if rule.Operator == "" && rule.Condition == nil && len(rule.Children) == 0 {
+		return nil
+	}
+	slices.SortFunc(rule.Children, func(a, b PolicyRule) int {
+		ka, _ := json.Marshal(a)
+		kb, _ := json.Marshal(b)
+		return strings.Compare(string(ka), string(kb))
+	})
+	return rule
+}
+
+func policyNode(rule *PolicyRule) models.PolicyNode {
+	var node models.PolicyNode
+	if rule == nil {
+		return node
+	}
+	node.Operator = rule.Operator
+	if c := rule.Condition; c != nil {
+		node.Condition = &models.PolicyCondition{Type: c.Type, Field: c.Field, Op: c.Op, Value: c.Value, Timezone: c.Timezone}
+	}
+	for i := range rule.Children {
+		node.Children = append(node.Children, policyNode(&rule.Children[i]))
+	}
+	return node
+}
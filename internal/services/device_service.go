@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/pkg/posture"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// postureTTL is how long an attested report can be redeemed during login.
+const postureTTL = 10 * time.Minute
+
+var (
+	ErrDevicePostureRequired = errors.New("a signed device posture report is required")
+	ErrDeviceBlocked         = errors.New("device is blocked")
+	ErrDevicePending         = errors.New("device is waiting for administrator approval")
+	ErrDeviceOtherUser       = errors.New("device is registered to another user")
+)
+
+type DeviceService struct {
+	db    *gorm.DB
+	cache *redis.Client
+}
+
+func NewDeviceService(db *gorm.DB, cache *redis.Client) *DeviceService {
+	return &DeviceService{db: db, cache: cache}
+}
+
+// AttestedPosture is a verified report waiting to be bound to a login.
+type AttestedPosture struct {
+	DeviceID  string         `json:"device_id"`
+	PublicKey string         `json:"public_key"`
+	Report    posture.Report `json:"report"`
+}
+
+// Attest verifies a signed posture report and stores it for a short time.
+// It returns a one-time ID the client passes through the browser login.
+func (s *DeviceService) Attest(tenantID uuid.UUID, envelope *posture.Envelope) (string, error) {
+	if s.cache == nil {
+		return "", errors.New("cache not available")
+	}
+
+	report, deviceID, err := envelope.Verify(time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(AttestedPosture{
+		DeviceID:  deviceID,
+		PublicKey: envelope.PublicKey,
+		Report:    *report,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	postureID := uuid.New().String()
+	key := fmt.Sprintf("posture:%s:%s", tenantID, postureID)
+	if err := s.cache.Set(context.Background(), key, data, postureTTL).Err(); err != nil {
+		return "", err
+	}
+	return postureID, nil
+}
+
+// Redeem loads and deletes an attested posture record.
+func (s *DeviceService) Redeem(tenantID uuid.UUID, postureID string) (*AttestedPosture, error) {
+	if s.cache == nil {
+		return nil, errors.New("cache not available")
+	}
+
+	key := fmt.Sprintf("posture:%s:%s", tenantID, postureID)
+	data, err := s.cache.GetDel(context.Background(), key).Result()
+	if err != nil {
+		return nil, errors.New("posture report not found or expired")
+	}
+
+	var attested AttestedPosture
+	if err := json.Unmarshal([]byte(data), &attested); err != nil {
+		return nil, err
+	}
+	return &attested, nil
+}
+
+// RecordPosture creates or updates the device inventory entry for an attested login.
+func (s *DeviceService) RecordPosture(tenantID uuid.UUID, attested *AttestedPosture, userEmail string) (*models.Device, error) {
+	var device models.Device
+	err := s.db.Scopes(models.TenantScope(tenantID)).Where("device_id = ?", attested.DeviceID).First(&device).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	now := time.Now()
+	r := attested.Report
+	device.TenantID = tenantID
+	device.DeviceID = attested.DeviceID
+	device.PublicKey = attested.PublicKey
+	device.Hostname = r.Hostname
+	device.UserEmail = userEmail
+	if device.OwnerEmail == "" {
+		device.OwnerEmail = userEmail
+	}
+	device.OS = r.OS
+	device.OSVersion = r.OSVersion
+	device.DiskEncrypted = r.DiskEncrypted
+	device.FirewallEnabled = r.FirewallEnabled
+	device.ScreenLockEnabled = r.ScreenLockEnabled
+	device.ClientVersion = r.ClientVersion
+	device.LastPostureAt = &now
+	if device.Status == "" {
+		device.Status = models.DeviceStatusPending
+	}
+
+	if err := s.db.Save(&device).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// CheckDeviceAccess decides whether a VPN sign-in by email may use the
+// device, which is nil when the client sent no posture report. With device
+// approval on, a new device key is a new pending device tied to the user who
+// registered it, so re-keying a blocked device does not restore access.
+func CheckDeviceAccess(tenant *models.Tenant, device *models.Device, email string) error {
+	if device == nil {
+		if tenant.RequireDevicePosture || tenant.DeviceApproval {
+			return ErrDevicePostureRequired
+		}
+		return nil
+	}
+	if device.Status == models.DeviceStatusBlocked {
+		return ErrDeviceBlocked
+	}
+	if tenant.DeviceApproval {
+		if !strings.EqualFold(device.OwnerEmail, email) {
+			return ErrDeviceOtherUser
+		}
+		if device.Status != models.DeviceStatusApproved {
+			return ErrDevicePending
+		}
+	}
+	return nil
+}
+
+func (s *DeviceService) ListDevices(tenantID uuid.UUID) ([]models.Device, error) {
+	var devices []models.Device
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Order("updated_at desc").Find(&devices).Error; err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// SetStatus approves, blocks or resets a device. Blocked device IDs are part of
+// the gateway config, so gateways pick the change up on their next heartbeat.
+func (s *DeviceService) SetStatus(tenantID uuid.UUID, id uuid.UUID, status models.DeviceStatus, actor Actor) error {
+	switch status {
+	case models.DeviceStatusPending, models.DeviceStatusApproved, models.DeviceStatusBlocked:
+	default:
+		return errors.New("invalid device status")
+	}
+
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var device models.Device
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&device, "id = ?", id).Error; err != nil {
+			return nil, errors.New("device not found")
+		}
+		before := device
+		if err := tx.Model(&device).Update("status", status).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "device.update", ResourceType: "device", ResourceID: id.String(), Before: before, After: device}, nil
+	})
+}
+
+func (s *DeviceService) DeleteDevice(tenantID uuid.UUID, id uuid.UUID, actor Actor) error {
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var device models.Device
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&device, "id = ?", id).Error; err != nil {
+			return nil, errors.New("device not found")
+		}
+		if err := tx.Delete(&device).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "device.delete", ResourceType: "device", ResourceID: id.String(), Before: device}, nil
+	})
+}
+
+// GetDeviceByDeviceID looks a device up by its key fingerprint.
+func (s *DeviceService) GetDeviceByDeviceID(tenantID uuid.UUID, deviceID string) (*models.Device, error) {
+	var device models.Device
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Where("device_id = ?", deviceID).First(&device).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// ListBlockedDeviceIDs returns the device IDs gateways must refuse.
+func (s *DeviceService) ListBlockedDeviceIDs(tenantID uuid.UUID) ([]string, error) {
+	var ids []string
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Model(&models.Device{}).
+		Where("status = ?", models.DeviceStatusBlocked).
+		Order("device_id asc").
+		Pluck("device_id", &ids).Error; err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
@@ -0,0 +1,652 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/pkg/scim"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// revokedUserWindow is how long a deactivated or deleted directory user stays
+// on the gateways' revocation list. It outlives any VPN token issued before.
+const revokedUserWindow = 24 * time.Hour
+
+var (
+	// ErrDirectoryConflict is returned when a userName is already taken.
+	ErrDirectoryConflict = errors.New("a user with this userName already exists")
+	// ErrInvalidFilter is returned for SCIM filters the directory cannot evaluate.
+	ErrInvalidFilter = errors.New("invalid filter")
+)
+
+type DirectoryService struct {
+	db    *gorm.DB
+	cache *redis.Client
+}
+
+func NewDirectoryService(db *gorm.DB, cache *redis.Client) *DirectoryService {
+	return &DirectoryService{db: db, cache: cache}
+}
+
+// SCIM tokens
+
+// CreateSCIMToken issues a bearer token for the tenant's SCIM endpoint. The
+// returned token is not stored and cannot be shown again.
+func (s *DirectoryService) CreateSCIMToken(tenantID uuid.UUID, name string, actor Actor) (*models.SCIMToken, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", errors.New("name is required")
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	token := "scim_" + hex.EncodeToString(raw)
+
+	t := &models.SCIMToken{
+		Name:      name,
+		TokenHash: hashSCIMToken(token),
+		Prefix:    token[:13],
+	}
+	t.TenantID = tenantID
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Create(t).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "scim_token.create", ResourceType: "scim_token", ResourceID: t.ID.String(), After: t}, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return t, token, nil
+}
+
+func (s *DirectoryService) ListSCIMTokens(tenantID uuid.UUID) ([]models.SCIMToken, error) {
+	var tokens []models.SCIMToken
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Order("created_at desc").Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (s *DirectoryService) DeleteSCIMToken(tenantID uuid.UUID, id uuid.UUID, actor Actor) error {
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var t models.SCIMToken
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&t, "id = ?", id).Error; err != nil {
+			return nil, errors.New("token not found")
+		}
+		if err := tx.Delete(&t).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "scim_token.delete", ResourceType: "scim_token", ResourceID: id.String(), Before: t}, nil
+	})
+}
+
+// AuthenticateSCIMToken returns the tenant a bearer token belongs to.
+func (s *DirectoryService) AuthenticateSCIMToken(token string) (uuid.UUID, error) {
+	if !strings.HasPrefix(token, "scim_") {
+		return uuid.Nil, errors.New("invalid token")
+	}
+	var t models.SCIMToken
+	if err := s.db.Where("token_hash = ?", hashSCIMToken(token)).First(&t).Error; err != nil {
+		return uuid.Nil, errors.New("invalid token")
+	}
+
+	// Recording every request would write on each call of a bulk sync
+	now := time.Now()
+	if t.LastUsedAt == nil || now.Sub(*t.LastUsedAt) > time.Minute {
+		s.db.Model(&t).UpdateColumn("last_used_at", now)
+	}
+	return t.TenantID, nil
+}
+
+func hashSCIMToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Users
+
+func (s *DirectoryService) ListUsers(tenantID uuid.UUID, filter scim.Expr, offset, limit int) ([]models.DirectoryUser, int64, error) {
+	query := s.db.Scopes(models.TenantScope(tenantID)).Model(&models.DirectoryUser{})
+	if filter != nil {
+		where, args, err := filterSQL(filter, userFilterColumns, "")
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+		}
+		query = query.Where(where, args...)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var users []models.DirectoryUser
+	if err := query.Preload("Groups").Order("created_at asc").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		return nil, 0, err
+	}
+	return users, total, nil
+}
+
+func (s *DirectoryService) GetUser(tenantID uuid.UUID, id uuid.UUID) (*models.DirectoryUser, error) {
+	var u models.DirectoryUser
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Preload("Groups").First(&u, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (s *DirectoryService) CreateUser(tenantID uuid.UUID, u *models.DirectoryUser) error {
+	if err := s.normalizeUser(tenantID, u); err != nil {
+		return err
+	}
+	u.TenantID = tenantID
+	return s.db.Omit("Groups").Create(u).Error
+}
+
+// UpdateUser replaces the user's attributes. Group memberships are kept.
+func (s *DirectoryService) UpdateUser(tenantID uuid.UUID, u *models.DirectoryUser) error {
+	if err := s.normalizeUser(tenantID, u); err != nil {
+		return err
+	}
+	result := s.db.Scopes(models.TenantScope(tenantID)).
+		Model(&models.DirectoryUser{}).
+		Where("id = ?", u.ID).
+		Updates(map[string]interface{}{
+			"external_id":  u.ExternalID,
+			"user_name":    u.UserName,
+			"email":        u.Email,
+			"display_name": u.DisplayName,
+			"given_name":   u.GivenName,
+			"family_name":  u.FamilyName,
+			"active":       u.Active,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteUser deactivates and removes the user, so gateways still revoke its sessions.
+func (s *DirectoryService) DeleteUser(tenantID uuid.UUID, id uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(models.TenantScope(tenantID)).
+			Model(&models.DirectoryUser{}).
+			Where("id = ?", id).
+			Update("active", false)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Exec("DELETE FROM directory_group_members WHERE directory_user_id = ?", id).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.DirectoryUser{}, "id = ?", id).Error
+	})
+}
+
+// normalizeUser fills the email from userName when missing and checks that
+// userName is unique (case-insensitively) within the tenant.
+func (s *DirectoryService) normalizeUser(tenantID uuid.UUID, u *models.DirectoryUser) error {
+	u.UserName = strings.TrimSpace(u.UserName)
+	if u.UserName == "" {
+		return errors.New("userName is required")
+	}
+	u.Email = strings.ToLower(strings.TrimSpace(u.Email))
+	if u.Email == "" && strings.Contains(u.UserName, "@") {
+		u.Email = strings.ToLower(u.UserName)
+	}
+
+	var count int64
+	query := s.db.Scopes(models.TenantScope(tenantID)).
+		Model(&models.DirectoryUser{}).
+		Where("LOWER(user_name) = LOWER(?)", u.UserName)
+	if u.ID != uuid.Nil {
+		query = query.Where("id <> ?", u.ID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDirectoryConflict
+	}
+	return nil
+}
+
+// Groups
+
+func (s *DirectoryService) ListGroups(tenantID uuid.UUID, filter scim.Expr, offset, limit int, withMembers bool) ([]models.DirectoryGroup, int64, error) {
+	query := s.db.Scopes(models.TenantScope(tenantID)).Model(&models.DirectoryGroup{})
+	if filter != nil {
+		where, args, err := filterSQL(filter, groupFilterColumns, "")
+		if err != nil {
+			return nil, 0, fmt.Errorf("%w: %v", ErrInvalidFilter, err)
+		}
+		query = query.Where(where, args...)
+	}
+	query = query.Session(&gorm.Session{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if withMembers {
+		query = query.Preload("Members")
+	}
+	var groups []models.DirectoryGroup
+	if err := query.Order("created_at asc").Offset(offset).Limit(limit).Find(&groups).Error; err != nil {
+		return nil, 0, err
+	}
+	return groups, total, nil
+}
+
+func (s *DirectoryService) GetGroup(tenantID uuid.UUID, id uuid.UUID, withMembers bool) (*models.DirectoryGroup, error) {
+	query := s.db.Scopes(models.TenantScope(tenantID))
+	if withMembers {
+		query = query.Preload("Members")
+	}
+	var g models.DirectoryGroup
+	if err := query.First(&g, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (s *DirectoryService) CreateGroup(tenantID uuid.UUID, g *models.DirectoryGroup, memberIDs []uuid.UUID) error {
+	g.DisplayName = strings.TrimSpace(g.DisplayName)
+	if g.DisplayName == "" {
+		return errors.New("displayName is required")
+	}
+	g.TenantID = tenantID
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Members").Create(g).Error; err != nil {
+			return err
+		}
+		return addGroupMembers(tx, tenantID, g.ID, memberIDs)
+	})
+}
+
+// UpdateGroup saves the group's attributes and, when memberIDs is not nil,
+// replaces its members.
+func (s *DirectoryService) UpdateGroup(tenantID uuid.UUID, g *models.DirectoryGroup, memberIDs []uuid.UUID) error {
+	g.DisplayName = strings.TrimSpace(g.DisplayName)
+	if g.DisplayName == "" {
+		return errors.New("displayName is required")
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(models.TenantScope(tenantID)).
+			Model(&models.DirectoryGroup{}).
+			Where("id = ?", g.ID).
+			Updates(map[string]interface{}{
+				"external_id":  g.ExternalID,
+				"display_name": g.DisplayName,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if memberIDs == nil {
+			return nil
+		}
+		return replaceGroupMembers(tx, tenantID, g.ID, memberIDs)
+	})
+}
+
+// ModifyGroupMembers adds and removes members without rewriting the whole group.
+func (s *DirectoryService) ModifyGroupMembers(tenantID uuid.UUID, groupID uuid.UUID, add, remove []uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(models.TenantScope(tenantID)).
+			Model(&models.DirectoryGroup{}).
+			Where("id = ?", groupID).
+			Update("updated_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if len(remove) > 0 {
+			if err := tx.Exec("DELETE FROM directory_group_members WHERE directory_group_id = ? AND directory_user_id IN ?", groupID, remove).Error; err != nil {
+				return err
+			}
+		}
+		return addGroupMembers(tx, tenantID, groupID, add)
+	})
+}
+
+func (s *DirectoryService) DeleteGroup(tenantID uuid.UUID, id uuid.UUID) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Scopes(models.TenantScope(tenantID)).Delete(&models.DirectoryGroup{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return tx.Exec("DELETE FROM directory_group_members WHERE directory_group_id = ?", id).Error
+	})
+}
+
+// addGroupMembers links the tenant's users to a group, ignoring unknown IDs.
+func addGroupMembers(tx *gorm.DB, tenantID uuid.UUID, groupID uuid.UUID, userIDs []uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	return tx.Exec(`INSERT INTO directory_group_members (directory_group_id, directory_user_id)
+		SELECT ?, id FROM directory_users WHERE tenant_id = ? AND id IN ? AND deleted_at IS NULL
+		ON CONFLICT DO NOTHING`, groupID, tenantID, userIDs).Error
+}
+
+// replaceGroupMembers makes userIDs the group's only members.
+func replaceGroupMembers(tx *gorm.DB, tenantID uuid.UUID, groupID uuid.UUID, userIDs []uuid.UUID) error {
+	if err := tx.Exec("DELETE FROM directory_group_members WHERE directory_group_id = ?", groupID).Error; err != nil {
+		return err
+	}
+	return addGroupMembers(tx, tenantID, groupID, userIDs)
+}
+
+// Directory consumers
+
+// HasDirectory reports whether the tenant has a directory, provisioned over
+// SCIM or synced from Google Workspace.
+func (s *DirectoryService) HasDirectory(tenantID uuid.UUID) (bool, error) {
+	var count int64
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Model(&models.DirectoryUser{}).Limit(1).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// FindUserByEmail looks a signed-in user up by email or userName, with groups.
+func (s *DirectoryService) FindUserByEmail(tenantID uuid.UUID, email string) (*models.DirectoryUser, error) {
+	var u models.DirectoryUser
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Preload("Groups").
+		Where("email = LOWER(?) OR LOWER(user_name) = LOWER(?)", email, email).
+		Order("active desc").
+		First(&u).Error; err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Search finds active users and groups for the policy editor.
+func (s *DirectoryService) Search(tenantID uuid.UUID, query string, limit int) ([]models.DirectoryUser, []models.DirectoryGroup, error) {
+	pattern := "%" + escapeLike(query) + "%"
+
+	var users []models.DirectoryUser
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Where("active = ?", true).
+		Where("email ILIKE ? OR user_name ILIKE ? OR display_name ILIKE ?", pattern, pattern, pattern).
+		Order("display_name asc").
+		Limit(limit).
+		Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var groups []models.DirectoryGroup
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Where("display_name ILIKE ? OR email ILIKE ?", pattern, pattern).
+		Order("display_name asc").
+		Limit(limit).
+		Find(&groups).Error; err != nil {
+		return nil, nil, err
+	}
+	return users, groups, nil
+}
+
+// UnknownIdentities returns the emails and group names (by PolicyName) the
+// tenant's directory does not have, compared case-insensitively.
+func (s *DirectoryService) UnknownIdentities(tenantID uuid.UUID, emails, groups []string) ([]string, []string, error) {
+	var unknownEmails, unknownGroups []string
+	if len(emails) > 0 {
+		var known []string
+		if err := s.db.Scopes(models.TenantScope(tenantID)).
+			Model(&models.DirectoryUser{}).
+			Where("email IN ?", lowerAll(emails)).
+			Pluck("email", &known).Error; err != nil {
+			return nil, nil, err
+		}
+		unknownEmails = missing(emails, known)
+	}
+	if len(groups) > 0 {
+		var known []string
+		if err := s.db.Scopes(models.TenantScope(tenantID)).
+			Model(&models.DirectoryGroup{}).
+			Where("LOWER(email) IN ? OR (email = '' AND LOWER(display_name) IN ?)", lowerAll(groups), lowerAll(groups)).
+			Pluck("CASE WHEN email <> '' THEN email ELSE display_name END", &known).Error; err != nil {
+			return nil, nil, err
+		}
+		unknownGroups = missing(groups, known)
+	}
+	return unknownEmails, unknownGroups, nil
+}
+
+func lowerAll(values []string) []string {
+	lowered := make([]string, len(values))
+	for i, v := range values {
+		lowered[i] = strings.ToLower(v)
+	}
+	return lowered
+}
+
+// missing returns the wanted values not in known, case-insensitively.
+func missing(wanted, known []string) []string {
+	found := make(map[string]bool, len(known))
+	for _, k := range known {
+		found[strings.ToLower(k)] = true
+	}
+	var out []string
+	for _, w := range wanted {
+		if !found[strings.ToLower(w)] {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// ListRevokedUserEmails returns the emails of users deactivated or deleted
+// recently, whose gateway sessions must be closed. Emails that still have
+// an active user are left out.
+func (s *DirectoryService) ListRevokedUserEmails(tenantID uuid.UUID) ([]string, error) {
+	since := time.Now().Add(-revokedUserWindow)
+
+	var emails []string
+	if err := s.db.Unscoped().Model(&models.DirectoryUser{}).
+		Scopes(models.TenantScope(tenantID)).
+		Where("email <> ''").
+		Where("(active = ? AND updated_at > ?) OR deleted_at > ?", false, since, since).
+		Where("email NOT IN (?)", s.db.Model(&models.DirectoryUser{}).
+			Scopes(models.TenantScope(tenantID)).
+			Where("active = ?", true).
+			Select("email")).
+		Distinct("email").
+		Order("email asc").
+		Pluck("email", &emails).Error; err != nil {
+		return nil, err
+	}
+	return emails, nil
+}
+
+// SCIM filters
+
+// filterColumn maps a SCIM attribute to a column. caseExact columns compare
+// as stored; the rest compare case-insensitively.
+type filterColumn struct {
+	name      string
+	kind      string // "string", "uuid", "bool" or "time"
+	caseExact bool
+}
+
+var userFilterColumns = map[string]filterColumn{
+	"id":                {name: "id", kind: "uuid"},
+	"externalid":        {name: "external_id", kind: "string", caseExact: true},
+	"username":          {name: "user_name", kind: "string"},
+	"displayname":       {name: "display_name", kind: "string"},
+	"emails":            {name: "email", kind: "string"},
+	"emails.value":      {name: "email", kind: "string"},
+	"name.givenname":    {name: "given_name", kind: "string"},
+	"name.familyname":   {name: "family_name", kind: "string"},
+	"active":            {name: "active", kind: "bool"},
+	"meta.created":      {name: "created_at", kind: "time"},
+	"meta.lastmodified": {name: "updated_at", kind: "time"},
+}
+
+var groupFilterColumns = map[string]filterColumn{
+	"id":                {name: "id", kind: "uuid"},
+	"externalid":        {name: "external_id", kind: "string", caseExact: true},
+	"displayname":       {name: "display_name", kind: "string"},
+	"meta.created":      {name: "created_at", kind: "time"},
+	"meta.lastmodified": {name: "updated_at", kind: "time"},
+}
+
+// filterSQL translates a SCIM filter into a WHERE clause. prefix is the
+// multi-valued attribute a value path filter is relative to.
+func filterSQL(e scim.Expr, columns map[string]filterColumn, prefix string) (string, []interface{}, error) {
+	switch e := e.(type) {
+	case *scim.Logical:
+		left, leftArgs, err := filterSQL(e.Left, columns, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		right, rightArgs, err := filterSQL(e.Right, columns, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		return fmt.Sprintf("(%s) %s (%s)", left, strings.ToUpper(e.Op), right), append(leftArgs, rightArgs...), nil
+
+	case *scim.Not:
+		inner, args, err := filterSQL(e.X, columns, prefix)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + inner + ")", args, nil
+
+	case *scim.ValuePath:
+		return filterSQL(e.Filter, columns, e.Attr+".")
+
+	case *scim.Compare:
+		return compareSQL(e, columns, prefix+e.Attr)
+	}
+	return "", nil, errors.New("unsupported filter")
+}
+
+func compareSQL(c *scim.Compare, columns map[string]filterColumn, attr string) (string, []interface{}, error) {
+	switch attr {
+	case "emails.type", "emails.primary":
+		// Users keep a single work email
+		return "TRUE", nil, nil
+	case "members", "members.value":
+		if _, isUsers := columns["username"]; isUsers {
+			break
+		}
+		if c.Op == "pr" {
+			return "EXISTS (SELECT 1 FROM directory_group_members m WHERE m.directory_group_id = directory_groups.id)", nil, nil
+		}
+		id, ok := c.Value.(string)
+		if c.Op != "eq" || !ok {
+			return "", nil, fmt.Errorf("members only supports eq")
+		}
+		userID, err := uuid.Parse(id)
+		if err != nil {
+			return "FALSE", nil, nil
+		}
+		return "id IN (SELECT directory_group_id FROM directory_group_members WHERE directory_user_id = ?)", []interface{}{userID}, nil
+	}
+
+	col, ok := columns[attr]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported filter attribute %q", attr)
+	}
+
+	if c.Op == "pr" {
+		if col.kind == "string" {
+			return fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", col.name, col.name), nil, nil
+		}
+		return col.name + " IS NOT NULL", nil, nil
+	}
+
+	if c.Op == "ne" {
+		inner, args, err := compareSQL(&scim.Compare{Attr: c.Attr, Op: "eq", Value: c.Value}, columns, attr)
+		if err != nil {
+			return "", nil, err
+		}
+		return "NOT (" + inner + ")", args, nil
+	}
+
+	sqlOps := map[string]string{"eq": "=", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+
+	switch col.kind {
+	case "uuid":
+		s, ok := c.Value.(string)
+		if c.Op != "eq" || !ok {
+			return "", nil, fmt.Errorf("%s only supports eq", attr)
+		}
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return "FALSE", nil, nil
+		}
+		return col.name + " = ?", []interface{}{id}, nil
+
+	case "bool":
+		b, ok := c.Value.(bool)
+		if c.Op != "eq" || !ok {
+			return "", nil, fmt.Errorf("%s only supports eq with true or false", attr)
+		}
+		return col.name + " = ?", []interface{}{b}, nil
+
+	case "time":
+		s, _ := c.Value.(string)
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil || sqlOps[c.Op] == "" {
+			return "", nil, fmt.Errorf("invalid date comparison on %s", attr)
+		}
+		return col.name + " " + sqlOps[c.Op] + " ?", []interface{}{t}, nil
+	}
+
+	s, ok := c.Value.(string)
+	if !ok {
+		return "", nil, fmt.Errorf("%s must be compared with a string", attr)
+	}
+	like := "ILIKE"
+	column := "LOWER(" + col.name + ")"
+	value := "LOWER(?)"
+	if col.caseExact {
+		like, column, value = "LIKE", col.name, "?"
+	}
+
+	switch c.Op {
+	case "co":
+		return fmt.Sprintf("%s %s ?", col.name, like), []interface{}{"%" + escapeLike(s) + "%"}, nil
+	case "sw":
+		return fmt.Sprintf("%s %s ?", col.name, like), []interface{}{escapeLike(s) + "%"}, nil
+	case "ew":
+		return fmt.Sprintf("%s %s ?", col.name, like), []interface{}{"%" + escapeLike(s)}, nil
+	}
+	return fmt.Sprintf("%s %s %s", column, sqlOps[c.Op], value), []interface{}{s}, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
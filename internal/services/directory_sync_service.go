@@ -0,0 +1,380 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"tridorian-ztna/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	admin "google.golang.org/api/admin/directory/v1"
+	"gorm.io/gorm"
+)
+
+const (
+	// directoryFullSyncInterval is how often every member list is refetched,
+	// even when its etag says it is unchanged.
+	directoryFullSyncInterval = 24 * time.Hour
+	// directorySyncLockTTL bounds a sync that died without releasing its lock.
+	directorySyncLockTTL = 30 * time.Minute
+)
+
+// DirectorySyncService mirrors each tenant's Google Workspace users, groups
+// and nested group membership into the directory, so sign-in and the policy
+// editor do not depend on the Admin API being reachable.
+type DirectorySyncService struct {
+	db              *gorm.DB
+	cache           *redis.Client
+	tenantService   *TenantService
+	identityService *IdentityService
+}
+
+func NewDirectorySyncService(db *gorm.DB, cache *redis.Client) *DirectorySyncService {
+	return &DirectorySyncService{
+		db:              db,
+		cache:           cache,
+		tenantService:   NewTenantService(db),
+		identityService: NewIdentityService(),
+	}
+}
+
+// Run syncs every tenant with a Google service account now and then on each interval.
+func (s *DirectorySyncService) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.SyncAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SyncAll syncs every tenant with a Google service account configured.
+func (s *DirectorySyncService) SyncAll(ctx context.Context) {
+	var tenantIDs []uuid.UUID
+	if err := s.db.Model(&models.Tenant{}).
+		Where("google_service_account_key <> '' AND google_admin_email <> ''").
+		Pluck("id", &tenantIDs).Error; err != nil {
+		log.Printf("❌ Directory sync: failed to list tenants: %v", err)
+		return
+	}
+
+	for _, tenantID := range tenantIDs {
+		if err := s.SyncTenant(ctx, tenantID); err != nil {
+			log.Printf("❌ Directory sync failed for tenant %s: %v", tenantID, err)
+		}
+	}
+}
+
+// GetStatus returns the tenant's last sync, or nil if it never ran.
+func (s *DirectorySyncService) GetStatus(tenantID uuid.UUID) (*models.DirectorySync, error) {
+	var status models.DirectorySync
+	err := s.db.Scopes(models.TenantScope(tenantID)).
+		Where("source = ?", models.DirectorySourceGoogle).
+		First(&status).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// SyncTenant mirrors one tenant's Workspace directory. Users and groups are
+// compared by etag and only changed rows are written; member lists are
+// refetched only when their etag changed, and all of them once a day.
+// Users deleted in Workspace are removed, which revokes their sessions.
+func (s *DirectorySyncService) SyncTenant(ctx context.Context, tenantID uuid.UUID) error {
+	tenant, err := s.tenantService.GetTenantByID(tenantID)
+	if err != nil {
+		return err
+	}
+	if tenant.GoogleServiceAccountKey == "" || tenant.GoogleAdminEmail == "" {
+		return errors.New("google identity not configured for this tenant")
+	}
+	if err := s.tenantService.DecryptTenantConfig(tenant); err != nil {
+		return fmt.Errorf("failed to decrypt identity configuration: %w", err)
+	}
+
+	// Only one replica syncs a tenant at a time
+	if s.cache != nil {
+		lockKey := fmt.Sprintf("directory:sync:%s", tenantID)
+		acquired, err := s.cache.SetNX(ctx, lockKey, "1", directorySyncLockTTL).Result()
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			return nil
+		}
+		defer s.cache.Del(context.Background(), lockKey)
+	}
+
+	status, err := s.startSync(tenantID)
+	if err != nil {
+		return err
+	}
+
+	full := status.LastFullSyncAt == nil || time.Since(*status.LastFullSyncAt) > directoryFullSyncInterval
+	result, syncErr := s.syncGoogle(ctx, tenantID, []byte(tenant.GoogleServiceAccountKey), tenant.GoogleAdminEmail, full)
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"last_finished_at": now,
+		"changes":          result.changes,
+	}
+	if result.users > 0 || result.groups > 0 {
+		updates["users"] = result.users
+		updates["groups"] = result.groups
+	}
+	if syncErr != nil {
+		updates["status"] = "failed"
+		updates["last_error"] = syncErr.Error()
+	} else {
+		updates["status"] = "succeeded"
+		updates["last_error"] = ""
+		updates["last_succeeded_at"] = now
+		if full {
+			updates["last_full_sync_at"] = now
+		}
+	}
+	if err := s.db.Model(status).Updates(updates).Error; err != nil {
+		return err
+	}
+
+	if syncErr == nil {
+		log.Printf("📒 Directory sync for tenant %s: %d users, %d groups, %d changes", tenantID, result.users, result.groups, result.changes)
+	}
+	return syncErr
+}
+
+// startSync marks the tenant's sync as running, creating its record on first use.
+func (s *DirectorySyncService) startSync(tenantID uuid.UUID) (*models.DirectorySync, error) {
+	status, err := s.GetStatus(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if status == nil {
+		status = &models.DirectorySync{Source: models.DirectorySourceGoogle}
+		status.TenantID = tenantID
+	}
+	status.Status = "running"
+	status.LastStartedAt = &now
+	if err := s.db.Save(status).Error; err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+type syncResult struct {
+	users, groups, changes int
+}
+
+func (s *DirectorySyncService) syncGoogle(ctx context.Context, tenantID uuid.UUID, serviceAccountJSON []byte, adminEmail string, full bool) (syncResult, error) {
+	var result syncResult
+
+	srv, err := s.identityService.NewDirectoryClient(ctx, serviceAccountJSON, adminEmail)
+	if err != nil {
+		return result, err
+	}
+
+	// Fetch everything before writing, so an API failure leaves the cache intact
+	users, err := s.identityService.ListAllGoogleUsers(ctx, srv)
+	if err != nil {
+		return result, err
+	}
+	groups, err := s.identityService.ListAllGoogleGroups(ctx, srv)
+	if err != nil {
+		return result, err
+	}
+	result.users, result.groups = len(users), len(groups)
+
+	userIDs, changes, err := s.syncUsers(tenantID, users)
+	result.changes += changes
+	if err != nil {
+		return result, err
+	}
+
+	storedGroups, changes, err := s.syncGroups(tenantID, groups)
+	result.changes += changes
+	if err != nil {
+		return result, err
+	}
+
+	// Member lists fail one group at a time; the rest still sync
+	var failures []string
+	for _, g := range storedGroups {
+		etag := g.MembersETag
+		if full {
+			etag = ""
+		}
+		members, newETag, notModified, err := s.identityService.ListGoogleGroupMembers(ctx, srv, g.ExternalID, etag)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		if notModified {
+			continue
+		}
+
+		ids := make([]uuid.UUID, 0, len(members))
+		for _, googleID := range members {
+			if id, ok := userIDs[googleID]; ok {
+				ids = append(ids, id)
+			}
+		}
+		if err := s.db.Transaction(func(tx *gorm.DB) error {
+			if err := replaceGroupMembers(tx, tenantID, g.ID, ids); err != nil {
+				return err
+			}
+			return tx.Model(g).UpdateColumn("members_etag", newETag).Error
+		}); err != nil {
+			return result, err
+		}
+		result.changes++
+	}
+
+	if len(failures) > 0 {
+		if len(failures) > 3 {
+			failures = append(failures[:3], fmt.Sprintf("and %d more", len(failures)-3))
+		}
+		return result, fmt.Errorf("group membership sync failed: %s", strings.Join(failures, "; "))
+	}
+	return result, nil
+}
+
+// syncUsers upserts changed users and removes those gone from Workspace. It
+// returns the directory ID of every Google user ID.
+func (s *DirectorySyncService) syncUsers(tenantID uuid.UUID, users []*admin.User) (map[string]uuid.UUID, int, error) {
+	var stored []models.DirectoryUser
+	if err := s.db.Unscoped().Scopes(models.TenantScope(tenantID)).
+		Where("source = ?", models.DirectorySourceGoogle).
+		Find(&stored).Error; err != nil {
+		return nil, 0, err
+	}
+	if len(users) == 0 && len(stored) > 0 {
+		return nil, 0, errors.New("google returned no users; keeping the cached directory")
+	}
+
+	byExternalID := make(map[string]*models.DirectoryUser, len(stored))
+	for i := range stored {
+		byExternalID[stored[i].ExternalID] = &stored[i]
+	}
+
+	ids := make(map[string]uuid.UUID, len(users))
+	seen := make(map[string]bool, len(users))
+	changes := 0
+	for _, u := range users {
+		seen[u.Id] = true
+		existing := byExternalID[u.Id]
+		if existing != nil && existing.ETag == u.Etag && !existing.DeletedAt.Valid {
+			ids[u.Id] = existing.ID
+			continue
+		}
+
+		row := models.DirectoryUser{
+			Source:     models.DirectorySourceGoogle,
+			ExternalID: u.Id,
+			UserName:   u.PrimaryEmail,
+			Email:      strings.ToLower(u.PrimaryEmail),
+			Active:     !u.Suspended && !u.Archived,
+			IsAdmin:    u.IsAdmin,
+			ETag:       u.Etag,
+		}
+		if u.Name != nil {
+			row.DisplayName, row.GivenName, row.FamilyName = u.Name.FullName, u.Name.GivenName, u.Name.FamilyName
+		}
+		row.TenantID = tenantID
+
+		if existing != nil {
+			row.ID = existing.ID
+			row.CreatedAt = existing.CreatedAt
+			if err := s.db.Unscoped().Select("*").Omit("Groups").Save(&row).Error; err != nil {
+				return nil, changes, err
+			}
+		} else if err := s.db.Omit("Groups").Create(&row).Error; err != nil {
+			return nil, changes, err
+		}
+		ids[u.Id] = row.ID
+		changes++
+	}
+
+	// Deleted in Workspace: deactivate and remove, which revokes their sessions
+	for i := range stored {
+		u := &stored[i]
+		if seen[u.ExternalID] || u.DeletedAt.Valid {
+			continue
+		}
+		if err := NewDirectoryService(s.db, s.cache).DeleteUser(tenantID, u.ID); err != nil {
+			return nil, changes, err
+		}
+		changes++
+	}
+	return ids, changes, nil
+}
+
+// syncGroups upserts changed groups and removes those gone from Workspace.
+// It returns the current groups.
+func (s *DirectorySyncService) syncGroups(tenantID uuid.UUID, groups []*admin.Group) ([]*models.DirectoryGroup, int, error) {
+	var stored []models.DirectoryGroup
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Where("source = ?", models.DirectorySourceGoogle).
+		Find(&stored).Error; err != nil {
+		return nil, 0, err
+	}
+
+	byExternalID := make(map[string]*models.DirectoryGroup, len(stored))
+	for i := range stored {
+		byExternalID[stored[i].ExternalID] = &stored[i]
+	}
+
+	current := make([]*models.DirectoryGroup, 0, len(groups))
+	seen := make(map[string]bool, len(groups))
+	changes := 0
+	for _, g := range groups {
+		seen[g.Id] = true
+		existing := byExternalID[g.Id]
+		if existing != nil && existing.ETag == g.Etag {
+			current = append(current, existing)
+			continue
+		}
+
+		row := existing
+		if row == nil {
+			row = &models.DirectoryGroup{Source: models.DirectorySourceGoogle, ExternalID: g.Id}
+			row.TenantID = tenantID
+		}
+		row.DisplayName = g.Name
+		if row.DisplayName == "" {
+			row.DisplayName = g.Email
+		}
+		row.Email = strings.ToLower(g.Email)
+		row.ETag = g.Etag
+		if err := s.db.Omit("Members").Save(row).Error; err != nil {
+			return nil, changes, err
+		}
+		current = append(current, row)
+		changes++
+	}
+
+	directoryService := NewDirectoryService(s.db, s.cache)
+	for i := range stored {
+		if seen[stored[i].ExternalID] {
+			continue
+		}
+		if err := directoryService.DeleteGroup(tenantID, stored[i].ID); err != nil {
+			return nil, changes, err
+		}
+		changes++
+	}
+	return current, changes, nil
+}
@@ -0,0 +1,301 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/netip"
+	"sort"
+	"strings"
+
+	"tridorian-ztna/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+type GatewayGroupService struct {
+	db    *gorm.DB
+	cache *redis.Client
+}
+
+func NewGatewayGroupService(db *gorm.DB, cache *redis.Client) *GatewayGroupService {
+	return &GatewayGroupService{db: db, cache: cache}
+}
+
+// GatewayTarget is what a client can connect to: a gateway group, or a node
+// that is in none. Address is the member to try first.
+type GatewayTarget struct {
+	ID      uuid.UUID       `json:"id"`
+	Name    string          `json:"name"`
+	Address string          `json:"address"`
+	Group   bool            `json:"group"`
+	Healthy bool            `json:"healthy"`
+	Members []GatewayMember `json:"members"`
+}
+
+// GatewayMember is one node of a GatewayTarget. A member is healthy when it
+// is enabled, connected to the control plane and below its SKU's user limit.
+type GatewayMember struct {
+	ID       uuid.UUID `json:"id"`
+	Name     string    `json:"name"`
+	Address  string    `json:"address"`
+	Healthy  bool      `json:"healthy"`
+	Draining bool      `json:"draining,omitempty"` // Shutting down; its clients are moving away
+	Sessions int64     `json:"sessions"`
+	MaxUsers int       `json:"max_users,omitempty"`
+}
+
+func (s *GatewayGroupService) ListGroups(tenantID uuid.UUID) ([]models.GatewayGroup, error) {
+	var groups []models.GatewayGroup
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Preload("Nodes").
+		Order("name asc").
+		Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+func (s *GatewayGroupService) CreateGroup(tenantID uuid.UUID, group *models.GatewayGroup, actor Actor) (*models.GatewayGroup, error) {
+	if err := validateGatewayGroup(group); err != nil {
+		return nil, err
+	}
+	group.TenantID = tenantID
+	group.Nodes = nil
+
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Create(group).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "gateway_group.create", ResourceType: "gateway_group", ResourceID: group.ID.String(), After: group}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+// UpdateGroup changes a group's name, description and shared address pool.
+// Members apply a new pool when they restart.
+func (s *GatewayGroupService) UpdateGroup(tenantID uuid.UUID, group *models.GatewayGroup, actor Actor) error {
+	if err := validateGatewayGroup(group); err != nil {
+		return err
+	}
+
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var before models.GatewayGroup
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&before, "id = ?", group.ID).Error; err != nil {
+			return nil, errors.New("gateway group not found")
+		}
+		var members []models.Node
+		if err := tx.Where("gateway_group_id = ?", group.ID).Find(&members).Error; err != nil {
+			return nil, err
+		}
+		if err := validateGroupPools(group, members); err != nil {
+			return nil, err
+		}
+
+		if err := tx.Model(&before).Updates(map[string]interface{}{
+			"name":        group.Name,
+			"description": group.Description,
+			"client_cidr": group.ClientCIDR,
+		}).Error; err != nil {
+			return nil, err
+		}
+		group.TenantID = tenantID
+		group.CreatedAt = before.CreatedAt
+		group.Nodes = nil
+		return &AuditChange{Action: "gateway_group.update", ResourceType: "gateway_group", ResourceID: group.ID.String(), Before: before, After: group}, nil
+	})
+}
+
+// DeleteGroup deletes a group. Its members stay, as standalone gateways.
+func (s *GatewayGroupService) DeleteGroup(tenantID uuid.UUID, groupID uuid.UUID, actor Actor) error {
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var group models.GatewayGroup
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&group, "id = ?", groupID).Error; err != nil {
+			return nil, errors.New("gateway group not found")
+		}
+		if err := tx.Model(&models.Node{}).Where("gateway_group_id = ?", groupID).Update("gateway_group_id", nil).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Delete(&group).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "gateway_group.delete", ResourceType: "gateway_group", ResourceID: groupID.String(), Before: group}, nil
+	})
+}
+
+// SetNodeGroup moves a node into a group, or out of its group when groupID
+// is nil.
+func (s *GatewayGroupService) SetNodeGroup(tenantID uuid.UUID, nodeID uuid.UUID, groupID *uuid.UUID, actor Actor) (*models.Node, error) {
+	var node models.Node
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&node, "id = ?", nodeID).Error; err != nil {
+			return nil, errors.New("node not found")
+		}
+		before := node
+
+		if groupID != nil {
+			var group models.GatewayGroup
+			if err := tx.Scopes(models.TenantScope(tenantID)).First(&group, "id = ?", *groupID).Error; err != nil {
+				return nil, errors.New("gateway group not found")
+			}
+			var members []models.Node
+			if err := tx.Where("gateway_group_id = ? AND id <> ?", group.ID, node.ID).Find(&members).Error; err != nil {
+				return nil, err
+			}
+			if err := validateGroupPools(&group, append(members, node)); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := tx.Model(&node).Update("gateway_group_id", groupID).Error; err != nil {
+			return nil, err
+		}
+		node.GatewayGroupID = groupID
+		return &AuditChange{Action: "node.update", ResourceType: "node", ResourceID: nodeID.String(), Before: before, After: node}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// ListTargets returns the gateway groups and standalone nodes a client can
+// connect to, each with its members, healthy ones first and the least loaded
+// of those first. Draining members are not healthy. Targets without a healthy
+// member are left out, and so are connectors, which take no clients.
+func (s *GatewayGroupService) ListTargets(tenantID uuid.UUID) ([]GatewayTarget, error) {
+	var nodes []models.Node
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Preload("NodeSku").
+		Preload("GatewayGroup").
+		Where("status <> ? AND connector = ?", "PENDING_REGISTRATION", false).
+		Order("name asc").
+		Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+
+	var targets []GatewayTarget
+	byGroup := make(map[uuid.UUID]int)
+	for _, node := range nodes {
+		address := node.IPAddress
+		if address == "" {
+			address = node.Hostname
+		}
+		if address == "" {
+			continue
+		}
+
+		member := GatewayMember{
+			ID:       node.ID,
+			Name:     node.Name,
+			Address:  address,
+			MaxUsers: node.NodeSku.MaxUsers,
+		}
+		member.Healthy, member.Draining, member.Sessions = s.memberHealth(node)
+
+		if node.GatewayGroup == nil {
+			targets = append(targets, GatewayTarget{ID: node.ID, Name: node.Name, Members: []GatewayMember{member}})
+			continue
+		}
+		i, ok := byGroup[node.GatewayGroup.ID]
+		if !ok {
+			i = len(targets)
+			byGroup[node.GatewayGroup.ID] = i
+			targets = append(targets, GatewayTarget{ID: node.GatewayGroup.ID, Name: node.GatewayGroup.Name, Group: true})
+		}
+		targets[i].Members = append(targets[i].Members, member)
+	}
+
+	available := targets[:0]
+	for _, t := range targets {
+		sort.SliceStable(t.Members, func(i, j int) bool {
+			a, b := t.Members[i], t.Members[j]
+			if a.Healthy != b.Healthy {
+				return a.Healthy
+			}
+			return a.Sessions < b.Sessions
+		})
+		if !t.Members[0].Healthy {
+			continue
+		}
+		t.Healthy = true
+		t.Address = t.Members[0].Address
+		available = append(available, t)
+	}
+	sort.SliceStable(available, func(i, j int) bool { return available[i].Name < available[j].Name })
+	return available, nil
+}
+
+// memberHealth reports whether a node can take another client, whether it
+// is draining, and how many sessions it has.
+func (s *GatewayGroupService) memberHealth(node models.Node) (bool, bool, int64) {
+	if !node.IsActive {
+		return false, false, 0
+	}
+	if s.cache == nil {
+		return node.Status == "CONNECTED", false, 0
+	}
+
+	ctx := context.Background()
+	live, _ := s.cache.Exists(ctx, fmt.Sprintf("node:liveness:%s", node.ID)).Result()
+	draining, _ := s.cache.Exists(ctx, fmt.Sprintf("node:draining:%s", node.ID)).Result()
+	sessions, _ := s.cache.HLen(ctx, fmt.Sprintf("node:sessions:%s", node.ID)).Result()
+	if live == 0 {
+		return false, false, sessions
+	}
+	if draining > 0 {
+		return false, true, sessions
+	}
+	if limit := node.NodeSku.MaxUsers; limit > 0 && sessions >= int64(limit) {
+		return false, false, sessions
+	}
+	return true, false, sessions
+}
+
+func validateGatewayGroup(group *models.GatewayGroup) error {
+	group.Name = strings.TrimSpace(group.Name)
+	if group.Name == "" {
+		return errors.New("name is required")
+	}
+	group.ClientCIDR = strings.TrimSpace(group.ClientCIDR)
+	if group.ClientCIDR != "" {
+		prefix, err := netip.ParsePrefix(group.ClientCIDR)
+		if err != nil || !prefix.Addr().Is4() {
+			return fmt.Errorf("invalid client CIDR %q", group.ClientCIDR)
+		}
+		group.ClientCIDR = prefix.Masked().String()
+	}
+	return nil
+}
+
+// validateGroupPools checks that the members of a group without a shared
+// pool each have their own, and that no two of those overlap, so a user
+// never gets an address another member hands out too.
+func validateGroupPools(group *models.GatewayGroup, members []models.Node) error {
+	if group.ClientCIDR != "" {
+		return nil
+	}
+
+	var pools []netip.Prefix
+	for _, m := range members {
+		if m.ClientCIDR == "" {
+			return fmt.Errorf("gateway %s has no client CIDR and the group has no shared one", m.Name)
+		}
+		prefix, err := netip.ParsePrefix(m.ClientCIDR)
+		if err != nil {
+			return fmt.Errorf("gateway %s has an invalid client CIDR", m.Name)
+		}
+		for i, other := range pools {
+			if prefix.Overlaps(other) {
+				return fmt.Errorf("client CIDRs of %s and %s overlap", m.Name, members[i].Name)
+			}
+		}
+		pools = append(pools, prefix)
+	}
+	return nil
+}
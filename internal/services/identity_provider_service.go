@@ -0,0 +1,419 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/pkg/encryption"
+	"tridorian-ztna/pkg/idp"
+	"tridorian-ztna/pkg/utils"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// loginSessionTTL bounds the time between redirecting to the IdP and its callback.
+const loginSessionTTL = 10 * time.Minute
+
+type IdentityProviderService struct {
+	db              *gorm.DB
+	cache           *redis.Client
+	masterKey       string
+	identityService *IdentityService
+}
+
+func NewIdentityProviderService(db *gorm.DB, cache *redis.Client) *IdentityProviderService {
+	return &IdentityProviderService{
+		db:              db,
+		cache:           cache,
+		masterKey:       utils.GetEnv("MASTER_KEY", "default-master-key-32-chars-long"),
+		identityService: NewIdentityService(),
+	}
+}
+
+// LoginSession is everything the callback needs, kept in Valkey under the
+// login's state so none of it travels through the browser.
+type LoginSession struct {
+	ProviderID uuid.UUID   `json:"provider_id"`
+	Values     idp.Session `json:"values,omitempty"`
+
+	// Set for administrator sign-ins, which are not bound to a tenant host
+	TenantID uuid.UUID `json:"tenant_id,omitempty"`
+
+	// Captured from the client when the login started
+	DesktopPort   string `json:"desktop_port,omitempty"`
+	CodeChallenge string `json:"code_challenge,omitempty"` // The desktop client's S256 PKCE challenge
+	OS            string `json:"os,omitempty"`
+	PostureID     string `json:"posture_id,omitempty"`
+}
+
+// NewLoginState returns an unguessable state for one sign-in. It fits in
+// SAML's 80-byte RelayState.
+func NewLoginState() (string, error) {
+	return randomToken()
+}
+
+func (s *IdentityProviderService) ListProviders(tenantID uuid.UUID) ([]models.IdentityProvider, error) {
+	var providers []models.IdentityProvider
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Order("name asc").Find(&providers).Error; err != nil {
+		return nil, err
+	}
+	return providers, nil
+}
+
+func (s *IdentityProviderService) GetProvider(tenantID uuid.UUID, id uuid.UUID) (*models.IdentityProvider, error) {
+	var p models.IdentityProvider
+	if err := s.db.Scopes(models.TenantScope(tenantID)).First(&p, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (s *IdentityProviderService) CreateProvider(tenantID uuid.UUID, p *models.IdentityProvider, actor Actor) (*models.IdentityProvider, error) {
+	if err := validateIdentityProvider(p); err != nil {
+		return nil, err
+	}
+	if p.Type != models.IdentityProviderSAML && p.ClientSecret == "" {
+		return nil, errors.New("client secret is required")
+	}
+	secret, err := encryption.EncryptString(p.ClientSecret, s.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	p.ClientSecret = secret
+	p.TenantID = tenantID
+
+	err = audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if p.IsDefault {
+			if err := clearDefaultProvider(tx, tenantID); err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Create(p).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "identity_provider.create", ResourceType: "identity_provider", ResourceID: p.ID.String(), After: p}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// UpdateProvider saves the provider. An empty client secret keeps the stored one.
+func (s *IdentityProviderService) UpdateProvider(tenantID uuid.UUID, p *models.IdentityProvider, actor Actor) error {
+	if err := validateIdentityProvider(p); err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{
+		"name":         p.Name,
+		"type":         p.Type,
+		"enabled":      p.Enabled,
+		"is_default":   p.IsDefault,
+		"issuer_url":   p.IssuerURL,
+		"client_id":    p.ClientID,
+		"scopes":       p.Scopes,
+		"sso_url":      p.SSOURL,
+		"entity_id":    p.EntityID,
+		"certificate":  p.Certificate,
+		"email_claim":  p.EmailClaim,
+		"groups_claim": p.GroupsClaim,
+	}
+	if p.ClientSecret != "" {
+		secret, err := encryption.EncryptString(p.ClientSecret, s.masterKey)
+		if err != nil {
+			return err
+		}
+		updates["client_secret"] = secret
+	}
+
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var before models.IdentityProvider
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&before, "id = ?", p.ID).Error; err != nil {
+			return nil, errors.New("identity provider not found")
+		}
+		if p.IsDefault {
+			if err := clearDefaultProvider(tx, tenantID); err != nil {
+				return nil, err
+			}
+		}
+		if err := tx.Model(&models.IdentityProvider{}).Where("id = ?", p.ID).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+		var after models.IdentityProvider
+		if err := tx.First(&after, "id = ?", p.ID).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "identity_provider.update", ResourceType: "identity_provider", ResourceID: p.ID.String(), Before: before, After: after}, nil
+	})
+}
+
+func (s *IdentityProviderService) DeleteProvider(tenantID uuid.UUID, id uuid.UUID, actor Actor) error {
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var provider models.IdentityProvider
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&provider, "id = ?", id).Error; err != nil {
+			return nil, errors.New("identity provider not found")
+		}
+		if err := tx.Delete(&provider).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "identity_provider.delete", ResourceType: "identity_provider", ResourceID: id.String(), Before: provider}, nil
+	})
+}
+
+func clearDefaultProvider(tx *gorm.DB, tenantID uuid.UUID) error {
+	return tx.Scopes(models.TenantScope(tenantID)).
+		Model(&models.IdentityProvider{}).
+		Where("is_default = ?", true).
+		Update("is_default", false).Error
+}
+
+// ResolveLoginProvider picks the provider for a VPN login: the requested one,
+// else the tenant's default, else its only enabled one. Tenants without
+// providers use the legacy Google configuration on the tenant, which must
+// already be decrypted. The returned client secret is decrypted.
+func (s *IdentityProviderService) ResolveLoginProvider(tenant *models.Tenant, requested string) (*models.IdentityProvider, error) {
+	var providers []models.IdentityProvider
+	if err := s.db.Scopes(models.TenantScope(tenant.ID)).
+		Where("enabled = ?", true).
+		Order("created_at asc").
+		Find(&providers).Error; err != nil {
+		return nil, err
+	}
+
+	var chosen *models.IdentityProvider
+	for i := range providers {
+		p := &providers[i]
+		if (requested != "" && p.ID.String() == requested) || (requested == "" && p.IsDefault) {
+			chosen = p
+			break
+		}
+	}
+	if chosen == nil && requested == "" && len(providers) == 1 {
+		chosen = &providers[0]
+	}
+
+	if chosen == nil {
+		if requested != "" || len(providers) > 0 {
+			return nil, errors.New("identity provider not found")
+		}
+		if tenant.GoogleClientID == "" {
+			return nil, errors.New("tenant identity provider is not configured")
+		}
+		return &models.IdentityProvider{
+			Name:         "Google",
+			Type:         models.IdentityProviderGoogle,
+			Enabled:      true,
+			ClientID:     tenant.GoogleClientID,
+			ClientSecret: tenant.GoogleClientSecret,
+		}, nil
+	}
+
+	secret, err := encryption.DecryptString(chosen.ClientSecret, s.masterKey)
+	if err != nil {
+		return nil, err
+	}
+	chosen.ClientSecret = secret
+	return chosen, nil
+}
+
+// LoginEndpoints are where an identity provider sends the browser back to.
+type LoginEndpoints struct {
+	RedirectURL string // OAuth2 and OIDC
+	ACSURL      string // SAML assertion consumer service
+	EntityID    string // SAML service provider entity ID, also its metadata URL
+}
+
+// TargetEndpoints are the VPN user sign-in endpoints on the tenant's auth
+// origin, e.g. "https://acme.example.com".
+func TargetEndpoints(baseURL string) LoginEndpoints {
+	return LoginEndpoints{
+		RedirectURL: baseURL + "/callback",
+		ACSURL:      baseURL + "/saml/acs",
+		EntityID:    baseURL + "/saml/metadata",
+	}
+}
+
+// AdminEndpoints are the administrator sign-in endpoints on the management
+// console's origin.
+func AdminEndpoints(baseURL string) LoginEndpoints {
+	return LoginEndpoints{
+		RedirectURL: baseURL + "/auth/mgmt/sso/callback",
+		ACSURL:      baseURL + "/auth/mgmt/sso/acs",
+		EntityID:    baseURL + "/auth/mgmt/sso/metadata",
+	}
+}
+
+// Provider builds the sign-in protocol for a resolved provider.
+func (s *IdentityProviderService) Provider(ctx context.Context, tenant *models.Tenant, p *models.IdentityProvider, endpoints LoginEndpoints) (idp.Provider, error) {
+	switch p.Type {
+	case models.IdentityProviderGoogle:
+		cfg := idp.GoogleConfig{
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  endpoints.RedirectURL,
+		}
+		// Groups come from the synced directory once it exists; until the first
+		// sync they are looked up live, and a failed lookup fails the sign-in
+		// rather than granting the user no groups
+		hasDirectory, err := NewDirectoryService(s.db, s.cache).HasDirectory(tenant.ID)
+		if err != nil {
+			return nil, err
+		}
+		if tenant.GoogleServiceAccountKey != "" && !hasDirectory {
+			cfg.Groups = func(ctx context.Context, email string) ([]string, error) {
+				return s.identityService.GetUserGroups(ctx, []byte(tenant.GoogleServiceAccountKey), tenant.GoogleAdminEmail, email)
+			}
+		}
+		return idp.NewGoogle(cfg), nil
+
+	case models.IdentityProviderOIDC:
+		return idp.NewOIDC(ctx, idp.OIDCConfig{
+			IssuerURL:    p.IssuerURL,
+			ClientID:     p.ClientID,
+			ClientSecret: p.ClientSecret,
+			RedirectURL:  endpoints.RedirectURL,
+			Scopes:       idp.SplitList(p.Scopes),
+			EmailClaim:   p.EmailClaim,
+			GroupsClaim:  p.GroupsClaim,
+		})
+
+	case models.IdentityProviderSAML:
+		return s.SAMLProvider(p, endpoints)
+
+	default:
+		return nil, fmt.Errorf("unsupported identity provider type %q", p.Type)
+	}
+}
+
+// SAMLProvider builds the service provider side of a SAML identity provider.
+func (s *IdentityProviderService) SAMLProvider(p *models.IdentityProvider, endpoints LoginEndpoints) (*idp.SAML, error) {
+	return idp.NewSAML(idp.SAMLConfig{
+		EntityID:        endpoints.EntityID,
+		ACSURL:          endpoints.ACSURL,
+		IdPSSOURL:       p.SSOURL,
+		IdPEntityID:     p.EntityID,
+		IdPCertificate:  p.Certificate,
+		EmailAttribute:  p.EmailClaim,
+		GroupsAttribute: p.GroupsClaim,
+	})
+}
+
+// SaveLoginSession stores a login session under its state, the only value
+// carried through the IdP round trip.
+func (s *IdentityProviderService) SaveLoginSession(tenantID uuid.UUID, state string, session *LoginSession) error {
+	if s.cache == nil {
+		return errors.New("cache not available")
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("idp:login:%s:%s", tenantID, state)
+	return s.cache.Set(context.Background(), key, data, loginSessionTTL).Err()
+}
+
+// TakeLoginSession loads and deletes a login session, so each state is
+// accepted once.
+func (s *IdentityProviderService) TakeLoginSession(tenantID uuid.UUID, state string) (*LoginSession, error) {
+	if s.cache == nil {
+		return nil, errors.New("cache not available")
+	}
+	if state == "" {
+		return nil, errors.New("login state is missing")
+	}
+
+	key := fmt.Sprintf("idp:login:%s:%s", tenantID, state)
+	data, err := s.cache.GetDel(context.Background(), key).Result()
+	if err != nil {
+		return nil, errors.New("login session not found or expired")
+	}
+
+	var session LoginSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// validateIdentityProvider checks the settings each provider type needs.
+func validateIdentityProvider(p *models.IdentityProvider) error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	p.IssuerURL = strings.TrimSuffix(strings.TrimSpace(p.IssuerURL), "/")
+	p.ClientID = strings.TrimSpace(p.ClientID)
+	p.SSOURL = strings.TrimSpace(p.SSOURL)
+	p.EntityID = strings.TrimSpace(p.EntityID)
+	p.Certificate = strings.TrimSpace(p.Certificate)
+	p.EmailClaim = strings.TrimSpace(p.EmailClaim)
+	p.GroupsClaim = strings.TrimSpace(p.GroupsClaim)
+	p.Scopes = strings.Join(idp.SplitList(p.Scopes), " ")
+
+	switch p.Type {
+	case models.IdentityProviderGoogle:
+		if p.ClientID == "" {
+			return errors.New("client ID is required")
+		}
+	case models.IdentityProviderOIDC:
+		if p.ClientID == "" {
+			return errors.New("client ID is required")
+		}
+		if u, err := url.Parse(p.IssuerURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("issuer URL must be an https URL")
+		}
+	case models.IdentityProviderSAML:
+		if u, err := url.Parse(p.SSOURL); err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.New("SSO URL must be an https URL")
+		}
+		if _, err := idp.ParseCertificate(p.Certificate); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("invalid identity provider type %q: must be google, oidc or saml", p.Type)
+	}
+	return nil
+}
+
+// SaveAdminLoginSession stores an administrator sign-in. The console is not
+// a tenant host, so the tenant travels in the session.
+func (s *IdentityProviderService) SaveAdminLoginSession(state string, session *LoginSession) error {
+	if s.cache == nil {
+		return errors.New("cache not available")
+	}
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return s.cache.Set(context.Background(), "idp:admin-login:"+state, data, loginSessionTTL).Err()
+}
+
+// TakeAdminLoginSession loads and deletes an administrator sign-in.
+func (s *IdentityProviderService) TakeAdminLoginSession(state string) (*LoginSession, error) {
+	if s.cache == nil {
+		return nil, errors.New("cache not available")
+	}
+	if state == "" {
+		return nil, errors.New("login state is missing")
+	}
+
+	data, err := s.cache.GetDel(context.Background(), "idp:admin-login:"+state).Result()
+	if err != nil {
+		return nil, errors.New("login session not found or expired")
+	}
+
+	var session LoginSession
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
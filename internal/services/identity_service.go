@@ -3,11 +3,11 @@ package services
 import (
 	"context"
 	"fmt"
-	"log"
 	"tridorian-ztna/internal/models"
 
 	"golang.org/x/oauth2/google"
 	admin "google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 )
 
@@ -69,66 +69,6 @@ func (s *IdentityService) FetchGoogleUsers(ctx context.Context, serviceAccountJS
 	return allUsers, nil
 }
 
-// SearchGoogleUsers performs a search for users, ideal for Auto Complete.
-func (s *IdentityService) SearchGoogleUsers(ctx context.Context, serviceAccountJSON []byte, adminEmail string, queryStr string) ([]models.ExternalIdentity, error) {
-	config, err := google.JWTConfigFromJSON(serviceAccountJSON, admin.AdminDirectoryUserReadonlyScope)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse service account JSON: %w", err)
-	}
-	config.Subject = adminEmail
-
-	ts := config.TokenSource(ctx)
-	srv, err := admin.NewService(ctx, option.WithTokenSource(ts))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create admin service: %w", err)
-	}
-
-	// Google Admin API query doesn't support OR. We must do multiple queries or a single one if possible.
-	// For users, we can search by name:Prefix* or email:Prefix*
-	// We'll do two quick searches and merge them.
-
-	var foundUsers []models.ExternalIdentity
-	seenIDs := make(map[string]bool)
-
-	searchBy := func(query string) {
-		log.Printf("DEBUG: Google Identity search users query: %s", query)
-		resp, err := srv.Users.List().
-			Context(ctx).
-			Customer("my_customer").
-			MaxResults(20).
-			Query(query).
-			Do()
-		if err != nil {
-			log.Printf("DEBUG: Google Identity search users error for query [%s]: %v", query, err)
-			return
-		}
-		if resp.Users != nil {
-			for _, u := range resp.Users {
-				if !seenIDs[u.Id] {
-					foundUsers = append(foundUsers, models.ExternalIdentity{
-						Name:       u.Name.FullName,
-						Email:      u.PrimaryEmail,
-						ExternalID: u.Id,
-						IsAdmin:    u.IsAdmin,
-					})
-					seenIDs[u.Id] = true
-				}
-			}
-		}
-	}
-
-	// Try multiple query formats to be safe
-	searchBy(fmt.Sprintf("name:%s*", queryStr))
-	searchBy(fmt.Sprintf("email:%s*", queryStr))
-
-	// Fallback: simple search might be supported in some environments
-	if len(foundUsers) == 0 {
-		searchBy(queryStr)
-	}
-
-	return foundUsers, nil
-}
-
 // GetGoogleAdmins fetches only users who have administrator privileges in Google Workspace.
 func (s *IdentityService) GetGoogleAdmins(ctx context.Context, serviceAccountJSON []byte, adminEmail string) ([]models.ExternalIdentity, error) {
 	config, err := google.JWTConfigFromJSON(serviceAccountJSON, admin.AdminDirectoryUserReadonlyScope)
@@ -165,6 +105,37 @@ func (s *IdentityService) GetGoogleAdmins(ctx context.Context, serviceAccountJSO
 	return admins, nil
 }
 
+// GetGoogleUser fetches one Google Workspace user, including whether they
+// are a Workspace administrator.
+func (s *IdentityService) GetGoogleUser(ctx context.Context, serviceAccountJSON []byte, adminEmail, userEmail string) (*models.ExternalIdentity, error) {
+	config, err := google.JWTConfigFromJSON(serviceAccountJSON, admin.AdminDirectoryUserReadonlyScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse service account JSON: %w", err)
+	}
+	config.Subject = adminEmail
+
+	ts := config.TokenSource(ctx)
+	srv, err := admin.NewService(ctx, option.WithTokenSource(ts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create admin service: %w", err)
+	}
+
+	u, err := srv.Users.Get(userEmail).Context(ctx).Do()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	identity := &models.ExternalIdentity{
+		Email:      u.PrimaryEmail,
+		ExternalID: u.Id,
+		IsAdmin:    u.IsAdmin,
+	}
+	if u.Name != nil {
+		identity.Name = u.Name.FullName
+	}
+	return identity, nil
+}
+
 func (s *IdentityService) GetUserGroups(ctx context.Context, serviceAccountJSON []byte, adminEmail, userEmail string) ([]string, error) {
 	// We need both User and Group scopes to check group memberships
 	config, err := google.JWTConfigFromJSON(serviceAccountJSON,
@@ -197,52 +168,98 @@ func (s *IdentityService) GetUserGroups(ctx context.Context, serviceAccountJSON
 	return groups, nil
 }
 
-// SearchGoogleGroups performs a search for groups.
-func (s *IdentityService) SearchGoogleGroups(ctx context.Context, serviceAccountJSON []byte, adminEmail string, queryStr string) ([]string, error) {
-	config, err := google.JWTConfigFromJSON(serviceAccountJSON, admin.AdminDirectoryGroupReadonlyScope)
+// NewDirectoryClient authenticates to the Admin SDK as the delegated admin,
+// for callers that make many directory calls in a row.
+func (s *IdentityService) NewDirectoryClient(ctx context.Context, serviceAccountJSON []byte, adminEmail string) (*admin.Service, error) {
+	config, err := google.JWTConfigFromJSON(serviceAccountJSON,
+		admin.AdminDirectoryUserReadonlyScope,
+		admin.AdminDirectoryGroupReadonlyScope)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse service account JSON: %w", err)
 	}
 	config.Subject = adminEmail
 
-	ts := config.TokenSource(ctx)
-	srv, err := admin.NewService(ctx, option.WithTokenSource(ts))
+	srv, err := admin.NewService(ctx, option.WithTokenSource(config.TokenSource(ctx)))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create admin service: %w", err)
 	}
+	return srv, nil
+}
 
-	// Merge results for name and email prefix search since OR isn't supported
-	var groupEmails []string
-	seenEmails := make(map[string]bool)
+// ListAllGoogleUsers pages through every user of the Workspace customer.
+func (s *IdentityService) ListAllGoogleUsers(ctx context.Context, srv *admin.Service) ([]*admin.User, error) {
+	var users []*admin.User
+	err := srv.Users.List().
+		Context(ctx).
+		Customer("my_customer").
+		MaxResults(500).
+		Fields("nextPageToken", "users(id,etag,primaryEmail,name(fullName,givenName,familyName),suspended,archived,isAdmin)").
+		Pages(ctx, func(page *admin.Users) error {
+			users = append(users, page.Users...)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list users: %w", err)
+	}
+	return users, nil
+}
 
-	searchGroups := func(query string) {
-		log.Printf("DEBUG: Google Identity search groups query: %s", query)
-		resp, err := srv.Groups.List().
+// ListAllGoogleGroups pages through every group of the Workspace customer.
+func (s *IdentityService) ListAllGoogleGroups(ctx context.Context, srv *admin.Service) ([]*admin.Group, error) {
+	var groups []*admin.Group
+	err := srv.Groups.List().
+		Context(ctx).
+		Customer("my_customer").
+		MaxResults(200).
+		Fields("nextPageToken", "groups(id,etag,email,name)").
+		Pages(ctx, func(page *admin.Groups) error {
+			groups = append(groups, page.Groups...)
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	return groups, nil
+}
+
+// ListGoogleGroupMembers returns the IDs of the users in a group, including
+// those in nested groups, and the etag of the list. When etag is set and the
+// list is unchanged, it returns notModified without fetching it.
+func (s *IdentityService) ListGoogleGroupMembers(ctx context.Context, srv *admin.Service, groupID, etag string) (userIDs []string, newETag string, notModified bool, err error) {
+	pageToken := ""
+	for {
+		call := srv.Members.List(groupID).
 			Context(ctx).
-			Customer("my_customer").
-			MaxResults(20).
-			Query(query).
-			Do()
+			IncludeDerivedMembership(true).
+			MaxResults(200).
+			Fields("nextPageToken", "etag", "members(id,type)")
+		if pageToken != "" {
+			call = call.PageToken(pageToken)
+		} else if etag != "" {
+			call = call.IfNoneMatch(etag)
+		}
+
+		resp, err := call.Do()
+		if googleapi.IsNotModified(err) {
+			return nil, etag, true, nil
+		}
 		if err != nil {
-			log.Printf("DEBUG: Google Identity search groups error for query [%s]: %v", query, err)
-			return
+			return nil, "", false, fmt.Errorf("failed to list members of group %s: %w", groupID, err)
 		}
-		if resp.Groups != nil {
-			for _, g := range resp.Groups {
-				if !seenEmails[g.Email] {
-					groupEmails = append(groupEmails, g.Email)
-					seenEmails[g.Email] = true
-				}
-			}
+		if pageToken == "" {
+			newETag = resp.Etag
 		}
-	}
 
-	searchGroups(fmt.Sprintf("name:%s*", queryStr))
-	searchGroups(fmt.Sprintf("email:%s*", queryStr))
+		for _, m := range resp.Members {
+			// Nested groups are flattened by derived membership; skip the group entries themselves
+			if m.Type == "USER" {
+				userIDs = append(userIDs, m.Id)
+			}
+		}
 
-	if len(groupEmails) == 0 {
-		searchGroups(queryStr)
+		pageToken = resp.NextPageToken
+		if pageToken == "" {
+			return userIDs, newETag, false, nil
+		}
 	}
-
-	return groupEmails, nil
 }
@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/pkg/utils"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	LoginRealmManagement = "mgmt"
+	LoginRealmBackoffice = "backoffice"
+
+	// loginDelayAfter is how many failures an account gets before each
+	// further attempt has to wait, doubling from one second.
+	loginDelayAfter = 3
+	// loginMaxDelay caps the wait between attempts.
+	loginMaxDelay = time.Minute
+)
+
+// LoginThrottledError is returned while an account, address or tenant has
+// to wait before the next attempt.
+type LoginThrottledError struct {
+	RetryAfter time.Duration
+	Locked     bool
+}
+
+func (e *LoginThrottledError) Error() string {
+	return "too many failed sign-in attempts; try again later"
+}
+
+// LoginAttemptKey identifies what a sign-in attempt counts against.
+type LoginAttemptKey struct {
+	Realm    string
+	Email    string
+	IP       string
+	TenantID uuid.UUID // uuid.Nil when the domain is unknown or for the backoffice
+}
+
+// LoginGuardService throttles password and second factor guessing on the
+// management and backoffice logins. Failures are counted in Valkey per account, per client
+// address and per tenant: accounts get progressive delays and a temporary
+// lockout, addresses a lockout, and tenants a cap on failures per window.
+type LoginGuardService struct {
+	db    *gorm.DB
+	cache *redis.Client
+
+	maxAccountFailures int
+	maxIPFailures      int
+	maxTenantFailures  int
+	window             time.Duration
+	lockout            time.Duration
+}
+
+func NewLoginGuardService(db *gorm.DB, cache *redis.Client) *LoginGuardService {
+	return &LoginGuardService{
+		db:                 db,
+		cache:              cache,
+		maxAccountFailures: envInt("LOGIN_MAX_ACCOUNT_FAILURES", 10),
+		maxIPFailures:      envInt("LOGIN_MAX_IP_FAILURES", 30),
+		maxTenantFailures:  envInt("LOGIN_MAX_TENANT_FAILURES", 200),
+		window:             envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		lockout:            envDuration("LOGIN_LOCKOUT", 15*time.Minute),
+	}
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(utils.GetEnv(key, "")); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(utils.GetEnv(key, "")); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+func (k LoginAttemptKey) account() string {
+	return k.Realm + ":" + strings.ToLower(strings.TrimSpace(k.Email))
+}
+
+// attemptScript reserves one sign-in attempt in a single step, so parallel
+// requests cannot all pass before any failure is counted. It refuses the
+// attempt while the account or address is locked or the account has to
+// wait, or while the tenant is over its cap. Otherwise it counts the
+// attempt as a failure up front and applies delays and lockouts; Succeed
+// takes it back.
+//
+// KEYS: account failures, wait, lock; address failures, lock; tenant
+// failures ("" for none)
+// ARGV: window, lockout, max delay (ms); max account, address and tenant
+// failures; failures before delays start
+// Returns {-1, 0} when the attempt may go ahead, else {locked, retry ms}.
+var attemptScript = redis.NewScript(`
+for _, key in ipairs({KEYS[3], KEYS[5]}) do
+	local ttl = redis.call("PTTL", key)
+	if ttl > 0 then return {1, ttl} end
+end
+local wait = redis.call("PTTL", KEYS[2])
+if wait > 0 then return {0, wait} end
+if KEYS[6] ~= "" then
+	local n = tonumber(redis.call("GET", KEYS[6]) or "0")
+	if n >= tonumber(ARGV[6]) then return {0, math.max(redis.call("PTTL", KEYS[6]), 1000)} end
+end
+
+local window, lockout, maxDelay = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local failures = redis.call("INCR", KEYS[1])
+if failures == 1 then redis.call("PEXPIRE", KEYS[1], window) end
+if failures >= tonumber(ARGV[4]) then
+	redis.call("SET", KEYS[3], 1, "PX", lockout)
+	redis.call("DEL", KEYS[1])
+elseif failures >= tonumber(ARGV[7]) then
+	local delay = math.min(1000 * 2 ^ (failures - tonumber(ARGV[7])), maxDelay)
+	redis.call("SET", KEYS[2], 1, "PX", math.floor(delay))
+end
+
+local address = redis.call("INCR", KEYS[4])
+if address == 1 then redis.call("PEXPIRE", KEYS[4], window) end
+if address >= tonumber(ARGV[5]) then
+	redis.call("SET", KEYS[5], 1, "PX", lockout)
+	redis.call("DEL", KEYS[4])
+end
+
+if KEYS[6] ~= "" then
+	if redis.call("INCR", KEYS[6]) == 1 then redis.call("PEXPIRE", KEYS[6], window) end
+end
+return {-1, 0}
+`)
+
+func (k LoginAttemptKey) tenantKey() string {
+	if k.TenantID == uuid.Nil {
+		return ""
+	}
+	return fmt.Sprintf("login:fail:tenant:%s", k.TenantID)
+}
+
+// Attempt reserves one sign-in attempt, a password or a second factor, and
+// returns a *LoginThrottledError if it must not be evaluated. The attempt
+// counts as a failure until Succeed is called for the completed sign-in.
+// Without a cache, attempts are let through rather than locking everyone out.
+func (s *LoginGuardService) Attempt(k LoginAttemptKey) error {
+	if s.cache == nil {
+		return nil
+	}
+	keys := []string{
+		"login:fail:acct:" + k.account(), "login:wait:acct:" + k.account(), "login:lock:acct:" + k.account(),
+		"login:fail:ip:" + k.IP, "login:lock:ip:" + k.IP,
+		k.tenantKey(),
+	}
+	res, err := attemptScript.Run(context.Background(), s.cache, keys,
+		s.window.Milliseconds(), s.lockout.Milliseconds(), loginMaxDelay.Milliseconds(),
+		s.maxAccountFailures, s.maxIPFailures, s.maxTenantFailures, loginDelayAfter,
+	).Int64Slice()
+	if err != nil {
+		log.Printf("Login guard: failed to count an attempt: %v", err)
+		return nil
+	}
+	if len(res) == 2 && res[0] >= 0 {
+		return &LoginThrottledError{RetryAfter: time.Duration(res[1]) * time.Millisecond, Locked: res[0] == 1}
+	}
+	return nil
+}
+
+// Succeed clears the account's failures once a sign-in is complete,
+// including its second factor, and takes back from the address and tenant
+// the attempts it took: the password and the second factor, if any.
+func (s *LoginGuardService) Succeed(k LoginAttemptKey, attempts int) {
+	if s.cache == nil {
+		return
+	}
+	ctx := context.Background()
+	s.cache.Del(ctx, "login:fail:acct:"+k.account(), "login:wait:acct:"+k.account(), "login:lock:acct:"+k.account())
+	for _, key := range []string{"login:fail:ip:" + k.IP, k.tenantKey()} {
+		if key != "" {
+			s.refund(ctx, key, attempts)
+		}
+	}
+}
+
+// refund takes n back from a failure counter, never below zero.
+func (s *LoginGuardService) refund(ctx context.Context, key string, n int) {
+	if n, err := s.cache.DecrBy(ctx, key, int64(n)).Result(); err == nil && n <= 0 {
+		s.cache.Del(ctx, key)
+	}
+}
+
+// Record stores a refused attempt for the tenant's administrators to review.
+func (s *LoginGuardService) Record(k LoginAttemptKey, reason, country, userAgent string) {
+	attempt := &models.LoginAttempt{
+		Realm:     k.Realm,
+		Email:     strings.ToLower(strings.TrimSpace(k.Email)),
+		IP:        k.IP,
+		Country:   country,
+		UserAgent: userAgent,
+		Reason:    reason,
+	}
+	if k.TenantID != uuid.Nil {
+		tenantID := k.TenantID
+		attempt.TenantID = &tenantID
+	}
+	if err := s.db.Create(attempt).Error; err != nil {
+		log.Printf("Login guard: failed to record attempt: %v", err)
+	}
+}
+
+// ListAttempts returns the tenant's most recent refused sign-ins.
+func (s *LoginGuardService) ListAttempts(tenantID uuid.UUID, limit int) ([]models.LoginAttempt, error) {
+	var attempts []models.LoginAttempt
+	err := s.db.Where("tenant_id = ?", tenantID).
+		Order("created_at DESC").
+		Limit(limit).
+		Find(&attempts).Error
+	return attempts, err
+}
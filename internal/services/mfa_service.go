@@ -0,0 +1,594 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tridorian-ztna/internal/models"
+	"tridorian-ztna/pkg/encryption"
+	"tridorian-ztna/pkg/totp"
+	"tridorian-ztna/pkg/utils"
+	"tridorian-ztna/pkg/webauthn"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// mfaEnrollmentTTL bounds the time between starting and confirming enrollment.
+	mfaEnrollmentTTL = 10 * time.Minute
+	// mfaChallengeTTL bounds the second step of a sign-in.
+	mfaChallengeTTL = 5 * time.Minute
+	// mfaMaxAttempts is how many wrong codes a sign-in tolerates before the
+	// password has to be entered again.
+	mfaMaxAttempts = 5
+	// recoveryCodeCount is how many recovery codes are issued at a time.
+	recoveryCodeCount = 10
+)
+
+var (
+	// ErrMFAInvalid is returned for a wrong, replayed or expired second factor.
+	ErrMFAInvalid = errors.New("invalid verification code")
+	// ErrMFAChallengeExpired is returned when the sign-in must start over.
+	ErrMFAChallengeExpired = errors.New("verification expired; sign in again")
+	// ErrMFARequired is returned when removing the last second factor of an
+	// account that must have one.
+	ErrMFARequired = errors.New("multi-factor authentication is required; enroll another method first")
+)
+
+// MFAOwner identifies the account a second factor belongs to.
+type MFAOwner struct {
+	Type     models.MFAOwnerType
+	ID       uuid.UUID
+	TenantID uuid.UUID // uuid.Nil for backoffice users
+	Email    string
+	Name     string
+}
+
+func AdminMFAOwner(a *models.Administrator) MFAOwner {
+	return MFAOwner{Type: models.MFAOwnerAdmin, ID: a.ID, TenantID: a.TenantID, Email: a.Email, Name: a.Name}
+}
+
+func BackofficeMFAOwner(u *models.BackofficeUser) MFAOwner {
+	return MFAOwner{Type: models.MFAOwnerBackoffice, ID: u.ID, Email: u.Email, Name: u.Name}
+}
+
+// MFAChallenge is the second step of a sign-in, returned after the password
+// was accepted.
+type MFAChallenge struct {
+	Token    string                   `json:"mfa_token"`
+	Methods  []models.MFAMethod       `json:"methods"`
+	WebAuthn *webauthn.RequestOptions `json:"webauthn,omitempty"`
+}
+
+// MFAVerification is the user's answer to a challenge.
+type MFAVerification struct {
+	Method     models.MFAMethod            `json:"method"`
+	Code       string                      `json:"code,omitempty"`
+	Credential *webauthn.AssertionResponse `json:"credential,omitempty"`
+}
+
+// pendingMFA is a challenge stored between the two sign-in steps.
+type pendingMFA struct {
+	OwnerType models.MFAOwnerType `json:"owner_type"`
+	OwnerID   uuid.UUID           `json:"owner_id"`
+	Challenge string              `json:"challenge,omitempty"` // WebAuthn challenge
+	// Relying party the WebAuthn challenge was issued for
+	RP *webauthn.Config `json:"rp,omitempty"`
+	Attempts  int                 `json:"attempts"`
+	// The password sign-in this challenge completes; wrong answers count
+	// against it in the login guard
+	Login *LoginAttemptKey `json:"login,omitempty"`
+}
+
+// MFAService manages second factors for local administrators and backoffice
+// users and verifies them at sign-in.
+type MFAService struct {
+	db        *gorm.DB
+	cache     *redis.Client
+	masterKey string
+}
+
+func NewMFAService(db *gorm.DB, cache *redis.Client) *MFAService {
+	return &MFAService{
+		db:        db,
+		cache:     cache,
+		masterKey: utils.GetEnv("MASTER_KEY", "default-master-key-32-chars-long"),
+	}
+}
+
+func ownerScope(owner MFAOwner) func(db *gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("owner_type = ? AND owner_id = ?", owner.Type, owner.ID)
+	}
+}
+
+// ListCredentials returns the owner's second factors.
+func (s *MFAService) ListCredentials(owner MFAOwner) ([]models.MFACredential, error) {
+	var creds []models.MFACredential
+	if err := s.db.Scopes(ownerScope(owner)).Order("created_at").Find(&creds).Error; err != nil {
+		return nil, err
+	}
+	return creds, nil
+}
+
+// Enrolled reports whether the owner has at least one second factor.
+func (s *MFAService) Enrolled(owner MFAOwner) (bool, error) {
+	var count int64
+	if err := s.db.Model(&models.MFACredential{}).Scopes(ownerScope(owner)).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// RemainingRecoveryCodes returns how many unused recovery codes the owner has.
+func (s *MFAService) RemainingRecoveryCodes(owner MFAOwner) (int64, error) {
+	var count int64
+	err := s.db.Model(&models.MFARecoveryCode{}).Scopes(ownerScope(owner)).
+		Where("used_at IS NULL").Count(&count).Error
+	return count, err
+}
+
+// BeginTOTP generates a secret for an authenticator app. It is kept in the
+// cache until the user proves the app is set up by confirming a code.
+func (s *MFAService) BeginTOTP(owner MFAOwner, issuer string) (secret, uri string, err error) {
+	if s.cache == nil {
+		return "", "", errors.New("cache not available")
+	}
+	secret, err = totp.GenerateSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.cache.Set(context.Background(), enrollmentKey(owner, models.MFAMethodTOTP), secret, mfaEnrollmentTTL).Err(); err != nil {
+		return "", "", err
+	}
+	return secret, totp.URI(issuer, owner.Email, secret), nil
+}
+
+// ConfirmTOTP stores the pending authenticator app once a code from it checks
+// out. Recovery codes are returned when this is the owner's first factor.
+func (s *MFAService) ConfirmTOTP(owner MFAOwner, name, code string) (*models.MFACredential, []string, error) {
+	if s.cache == nil {
+		return nil, nil, errors.New("cache not available")
+	}
+	secret, err := s.cache.Get(context.Background(), enrollmentKey(owner, models.MFAMethodTOTP)).Result()
+	if err != nil {
+		return nil, nil, errors.New("no authenticator app enrollment in progress")
+	}
+	step, ok := totp.Validate(secret, code, time.Now(), 0)
+	if !ok {
+		return nil, nil, ErrMFAInvalid
+	}
+
+	encrypted, err := encryption.EncryptString(secret, s.masterKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	if name == "" {
+		name = "Authenticator app"
+	}
+	cred := &models.MFACredential{
+		OwnerType: owner.Type,
+		OwnerID:   owner.ID,
+		Type:      models.MFAMethodTOTP,
+		Name:      name,
+		Secret:    encrypted,
+		LastStep:  step,
+	}
+	codes, err := s.addCredential(owner, cred)
+	if err != nil {
+		return nil, nil, err
+	}
+	s.cache.Del(context.Background(), enrollmentKey(owner, models.MFAMethodTOTP))
+	return cred, codes, nil
+}
+
+// BeginWebAuthn returns options for registering a passkey or security key.
+func (s *MFAService) BeginWebAuthn(owner MFAOwner, rp webauthn.Config) (*webauthn.CreationOptions, error) {
+	if s.cache == nil {
+		return nil, errors.New("cache not available")
+	}
+	creds, err := s.ListCredentials(owner)
+	if err != nil {
+		return nil, err
+	}
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.Set(context.Background(), enrollmentKey(owner, models.MFAMethodWebAuthn), challenge, mfaEnrollmentTTL).Err(); err != nil {
+		return nil, err
+	}
+
+	name := owner.Name
+	if name == "" {
+		name = owner.Email
+	}
+	return rp.CreationOptions(challenge, owner.ID[:], owner.Email, name, webauthnIDs(creds)), nil
+}
+
+// FinishWebAuthn verifies and stores a registered passkey or security key.
+// Recovery codes are returned when this is the owner's first factor.
+func (s *MFAService) FinishWebAuthn(owner MFAOwner, rp webauthn.Config, name string, resp *webauthn.RegistrationResponse) (*models.MFACredential, []string, error) {
+	if s.cache == nil {
+		return nil, nil, errors.New("cache not available")
+	}
+	challenge, err := s.cache.GetDel(context.Background(), enrollmentKey(owner, models.MFAMethodWebAuthn)).Result()
+	if err != nil {
+		return nil, nil, errors.New("no security key registration in progress")
+	}
+	registered, err := rp.VerifyRegistration(challenge, resp)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var count int64
+	s.db.Model(&models.MFACredential{}).Where("credential_id = ?", registered.ID).Count(&count)
+	if count > 0 {
+		return nil, nil, errors.New("this security key is already registered")
+	}
+
+	if name == "" {
+		name = "Security key"
+	}
+	cred := &models.MFACredential{
+		OwnerType:    owner.Type,
+		OwnerID:      owner.ID,
+		Type:         models.MFAMethodWebAuthn,
+		Name:         name,
+		CredentialID: registered.ID,
+		PublicKey:    registered.PublicKey,
+		SignCount:    registered.SignCount,
+	}
+	codes, err := s.addCredential(owner, cred)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cred, codes, nil
+}
+
+// addCredential stores a credential and issues recovery codes alongside the
+// owner's first one.
+func (s *MFAService) addCredential(owner MFAOwner, cred *models.MFACredential) ([]string, error) {
+	var codes []string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.MFACredential{}).Scopes(ownerScope(owner)).Count(&count).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(cred).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, owner)
+		return err
+	})
+	return codes, err
+}
+
+// DeleteCredential removes a second factor. When required is set, the last
+// one cannot be removed. Removing the last one also drops the recovery codes.
+func (s *MFAService) DeleteCredential(owner MFAOwner, id uuid.UUID, required bool) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var count int64
+		if err := tx.Model(&models.MFACredential{}).Scopes(ownerScope(owner)).Count(&count).Error; err != nil {
+			return err
+		}
+		if required && count <= 1 {
+			return ErrMFARequired
+		}
+
+		result := tx.Scopes(ownerScope(owner)).Delete(&models.MFACredential{}, "id = ?", id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if count == 1 {
+			return tx.Unscoped().Scopes(ownerScope(owner)).Delete(&models.MFARecoveryCode{}).Error
+		}
+		return nil
+	})
+}
+
+// Reset removes all of the owner's second factors and recovery codes, for an
+// account that lost its authenticator. If MFA is required they enroll again
+// at the next sign-in.
+func (s *MFAService) Reset(owner MFAOwner, actor Actor) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(ownerScope(owner)).Delete(&models.MFACredential{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Scopes(ownerScope(owner)).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+			return err
+		}
+		if owner.TenantID == uuid.Nil {
+			return nil // Backoffice users have no tenant audit log
+		}
+		return recordAudit(tx, owner.TenantID, actor, &AuditChange{Action: "administrator.mfa.reset", ResourceType: "administrator", ResourceID: owner.ID.String()})
+	})
+}
+
+// RegenerateRecoveryCodes replaces the owner's recovery codes.
+func (s *MFAService) RegenerateRecoveryCodes(owner MFAOwner) ([]string, error) {
+	enrolled, err := s.Enrolled(owner)
+	if err != nil {
+		return nil, err
+	}
+	if !enrolled {
+		return nil, errors.New("enroll an authenticator app or security key first")
+	}
+
+	var codes []string
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, owner)
+		return err
+	})
+	return codes, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, owner MFAOwner) ([]string, error) {
+	if err := tx.Unscoped().Scopes(ownerScope(owner)).Delete(&models.MFARecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		record := &models.MFARecoveryCode{
+			OwnerType: owner.Type,
+			OwnerID:   owner.ID,
+			CodeHash:  hashToken(normalizeRecoveryCode(code)),
+		}
+		if err := tx.Create(record).Error; err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// newRecoveryCode returns a code like "k7f2-9xqm-4hd8", avoiding characters
+// that are easily confused.
+func newRecoveryCode() (string, error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789"
+	b := make([]byte, 0, 12)
+	buf := make([]byte, 1)
+	for len(b) < cap(b) {
+		if _, err := rand.Read(buf); err != nil {
+			return "", err
+		}
+		// Rejection sampling keeps every character equally likely
+		if int(buf[0]) < 256-256%len(alphabet) {
+			b = append(b, alphabet[int(buf[0])%len(alphabet)])
+		}
+	}
+	return fmt.Sprintf("%s-%s-%s", b[0:4], b[4:8], b[8:12]), nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(strings.TrimSpace(code)))
+}
+
+// StartChallenge begins the second step of a sign-in for an enrolled owner,
+// after the password sign-in login. Without a relying party (rp.RPID empty)
+// passkeys are not offered.
+func (s *MFAService) StartChallenge(owner MFAOwner, rp webauthn.Config, login *LoginAttemptKey) (*MFAChallenge, error) {
+	if s.cache == nil {
+		return nil, errors.New("cache not available")
+	}
+	creds, err := s.ListCredentials(owner)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := pendingMFA{OwnerType: owner.Type, OwnerID: owner.ID, Login: login}
+	challenge := &MFAChallenge{}
+	seen := map[models.MFAMethod]bool{}
+	for _, c := range creds {
+		if c.Type == models.MFAMethodWebAuthn && rp.RPID == "" {
+			continue
+		}
+		if !seen[c.Type] {
+			seen[c.Type] = true
+			challenge.Methods = append(challenge.Methods, c.Type)
+		}
+	}
+	if ids := webauthnIDs(creds); len(ids) > 0 && rp.RPID != "" {
+		pending.Challenge, err = webauthn.NewChallenge()
+		if err != nil {
+			return nil, err
+		}
+		pending.RP = &rp
+		challenge.WebAuthn = rp.RequestOptions(pending.Challenge, ids)
+	}
+	if remaining, err := s.RemainingRecoveryCodes(owner); err == nil && remaining > 0 {
+		challenge.Methods = append(challenge.Methods, models.MFAMethodRecovery)
+	}
+
+	challenge.Token, err = randomToken()
+	if err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(pending)
+	if err := s.cache.Set(context.Background(), challengeKey(challenge.Token), data, mfaChallengeTTL).Err(); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// ChallengeLogin returns the password sign-in a pending challenge completes,
+// or nil if there is no such challenge.
+func (s *MFAService) ChallengeLogin(token string) *LoginAttemptKey {
+	if s.cache == nil {
+		return nil
+	}
+	data, err := s.cache.Get(context.Background(), challengeKey(token)).Result()
+	if err != nil {
+		return nil
+	}
+	var pending pendingMFA
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		return nil
+	}
+	return pending.Login
+}
+
+// VerifyChallenge checks the second step of a sign-in and returns the owner's
+// type and ID. The challenge is single use and dropped after too many wrong
+// answers. Passkeys are checked against the relying party the challenge was
+// issued for.
+func (s *MFAService) VerifyChallenge(token string, v *MFAVerification) (models.MFAOwnerType, uuid.UUID, error) {
+	if s.cache == nil {
+		return "", uuid.Nil, errors.New("cache not available")
+	}
+	ctx := context.Background()
+	key := challengeKey(token)
+	data, err := s.cache.Get(ctx, key).Result()
+	if err != nil {
+		return "", uuid.Nil, ErrMFAChallengeExpired
+	}
+	var pending pendingMFA
+	if err := json.Unmarshal([]byte(data), &pending); err != nil {
+		return "", uuid.Nil, err
+	}
+	owner := MFAOwner{Type: pending.OwnerType, ID: pending.OwnerID}
+	var rp webauthn.Config
+	if pending.RP != nil {
+		rp = *pending.RP
+	}
+
+	if err := s.verify(owner, v, pending.Challenge, rp); err != nil {
+		if !errors.Is(err, ErrMFAInvalid) {
+			return "", uuid.Nil, err
+		}
+		pending.Attempts++
+		if pending.Attempts >= mfaMaxAttempts {
+			s.cache.Del(ctx, key)
+			return "", uuid.Nil, ErrMFAChallengeExpired
+		}
+		data, _ := json.Marshal(pending)
+		s.cache.Set(ctx, key, data, redis.KeepTTL)
+		return "", uuid.Nil, err
+	}
+
+	// Only one request may complete the sign-in
+	if n, err := s.cache.Del(ctx, key).Result(); err != nil || n == 0 {
+		return "", uuid.Nil, ErrMFAChallengeExpired
+	}
+	return pending.OwnerType, pending.OwnerID, nil
+}
+
+func (s *MFAService) verify(owner MFAOwner, v *MFAVerification, challenge string, rp webauthn.Config) error {
+	switch v.Method {
+	case models.MFAMethodTOTP:
+		return s.verifyTOTP(owner, v.Code)
+	case models.MFAMethodRecovery:
+		return s.useRecoveryCode(owner, v.Code)
+	case models.MFAMethodWebAuthn:
+		if v.Credential == nil || challenge == "" {
+			return ErrMFAInvalid
+		}
+		return s.verifyWebAuthn(owner, challenge, v.Credential, rp)
+	}
+	return errors.New("unsupported verification method")
+}
+
+func (s *MFAService) verifyTOTP(owner MFAOwner, code string) error {
+	var creds []models.MFACredential
+	if err := s.db.Scopes(ownerScope(owner)).Where("type = ?", models.MFAMethodTOTP).Find(&creds).Error; err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, c := range creds {
+		secret, err := encryption.DecryptString(c.Secret, s.masterKey)
+		if err != nil {
+			continue
+		}
+		step, ok := totp.Validate(secret, code, now, c.LastStep)
+		if !ok {
+			continue
+		}
+		// Accept each step once, even under concurrent requests
+		result := s.db.Model(&models.MFACredential{}).
+			Where("id = ? AND last_step < ?", c.ID, step).
+			Updates(map[string]interface{}{"last_step": step, "last_used_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			return nil
+		}
+	}
+	return ErrMFAInvalid
+}
+
+func (s *MFAService) useRecoveryCode(owner MFAOwner, code string) error {
+	result := s.db.Model(&models.MFARecoveryCode{}).Scopes(ownerScope(owner)).
+		Where("code_hash = ? AND used_at IS NULL", hashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrMFAInvalid
+	}
+	return nil
+}
+
+func (s *MFAService) verifyWebAuthn(owner MFAOwner, challenge string, resp *webauthn.AssertionResponse, rp webauthn.Config) error {
+	id, err := webauthn.DecodeID(resp.ID)
+	if err != nil {
+		return ErrMFAInvalid
+	}
+	var cred models.MFACredential
+	if err := s.db.Scopes(ownerScope(owner)).
+		Where("type = ? AND credential_id = ?", models.MFAMethodWebAuthn, id).
+		First(&cred).Error; err != nil {
+		return ErrMFAInvalid
+	}
+
+	count, err := rp.VerifyAssertion(challenge, &webauthn.Credential{
+		ID:        cred.CredentialID,
+		PublicKey: cred.PublicKey,
+		SignCount: cred.SignCount,
+	}, resp)
+	if err != nil {
+		return ErrMFAInvalid
+	}
+	return s.db.Model(&cred).Updates(map[string]interface{}{
+		"sign_count":   count,
+		"last_used_at": time.Now(),
+	}).Error
+}
+
+func webauthnIDs(creds []models.MFACredential) [][]byte {
+	var ids [][]byte
+	for _, c := range creds {
+		if c.Type == models.MFAMethodWebAuthn {
+			ids = append(ids, c.CredentialID)
+		}
+	}
+	return ids
+}
+
+func enrollmentKey(owner MFAOwner, method models.MFAMethod) string {
+	return fmt.Sprintf("mfa:enroll:%s:%s:%s", method, owner.Type, owner.ID)
+}
+
+func challengeKey(token string) string {
+	return "mfa:pending:" + token
+}
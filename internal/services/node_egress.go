@@ -0,0 +1,144 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"tridorian-ztna/internal/models"
+	pb "tridorian-ztna/internal/proto/gateway/v1"
+	"tridorian-ztna/pkg/snat"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// SetNodeEgress changes how client traffic leaves a node. The gateway
+// applies it with its next config.
+func (s *NodeService) SetNodeEgress(tenantID uuid.UUID, nodeID uuid.UUID, mode string, pools []models.SNATPool, actor Actor) (*models.Node, error) {
+	mode, pools, err := validateEgress(mode, pools)
+	if err != nil {
+		return nil, err
+	}
+
+	var node models.Node
+	err = audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&node, "id = ?", nodeID).Error; err != nil {
+			return nil, errors.New("node not found")
+		}
+		before := node
+		// A struct update, so the pools go through their JSON serializer
+		if err := tx.Model(&models.Node{}).Where("id = ?", nodeID).Select("egress_mode", "snat_pools").Updates(&models.Node{
+			EgressMode: mode,
+			SNATPools:  pools,
+		}).Error; err != nil {
+			return nil, err
+		}
+		node.EgressMode = mode
+		node.SNATPools = pools
+		return &AuditChange{Action: "node.update", ResourceType: "node", ResourceID: nodeID.String(), Before: before, After: node}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if node.ReturnRoutes, err = s.returnRoutes(&node); err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// returnRoutes lists the CIDRs the network must route back to a node in the
+// routed egress mode: its client pool and, when it advertises routes, the
+// pools of the peers that relay their clients' traffic to it.
+func (s *NodeService) returnRoutes(node *models.Node) ([]string, error) {
+	if node.EgressMode != models.EgressRouted {
+		return nil, nil
+	}
+	withPool := *node
+	if node.GatewayGroupID != nil && node.GatewayGroup == nil {
+		var group models.GatewayGroup
+		if err := s.db.First(&group, "id = ?", *node.GatewayGroupID).Error; err != nil {
+			return nil, err
+		}
+		withPool.GatewayGroup = &group
+	}
+
+	var routes []string
+	add := func(pool string) {
+		if pool != "" && !slices.Contains(routes, pool) {
+			routes = append(routes, pool)
+		}
+	}
+	add(withPool.ClientPool())
+	if len(node.AdvertisedRoutes) > 0 {
+		peers, err := s.ListPeers(node)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range peers {
+			add(p.ClientPool)
+		}
+	}
+	return routes, nil
+}
+
+// EgressConfig returns a node's egress for its gateway config, or nil for
+// the default masquerade.
+func (s *NodeService) EgressConfig(node *models.Node) *pb.GetConfigResponse_Egress {
+	if node.EgressMode == "" || node.EgressMode == models.EgressMasquerade {
+		return nil
+	}
+	egress := &pb.GetConfigResponse_Egress{Mode: node.EgressMode}
+	for _, p := range node.SNATPools {
+		egress.SnatPools = append(egress.SnatPools, &pb.GetConfigResponse_Egress_SNATPool{
+			Destination: p.Destination,
+			Source:      p.Source,
+		})
+	}
+	return egress
+}
+
+// validateEgress checks an egress mode and its SNAT pools and returns them
+// normalized. Only the snat mode takes pools, and needs at least one.
+func validateEgress(mode string, pools []models.SNATPool) (string, []models.SNATPool, error) {
+	mode = strings.ToLower(strings.TrimSpace(mode))
+	if mode == "" {
+		mode = models.EgressMasquerade
+	}
+	switch mode {
+	case models.EgressMasquerade, models.EgressRouted:
+		if len(pools) > 0 {
+			return "", nil, fmt.Errorf("SNAT pools need the %q egress mode", models.EgressSNAT)
+		}
+		return mode, nil, nil
+	case models.EgressSNAT:
+		if len(pools) == 0 {
+			return "", nil, errors.New("the snat egress mode needs at least one SNAT pool")
+		}
+	default:
+		return "", nil, fmt.Errorf("unknown egress mode %q", mode)
+	}
+
+	normalized := make([]models.SNATPool, 0, len(pools))
+	seen := make(map[string]bool)
+	for _, p := range pools {
+		dst, err := netip.ParsePrefix(strings.TrimSpace(p.Destination))
+		if err != nil || !dst.Addr().Is4() {
+			return "", nil, fmt.Errorf("invalid SNAT destination %q", p.Destination)
+		}
+		dst = dst.Masked()
+		if seen[dst.String()] {
+			return "", nil, fmt.Errorf("SNAT destination %s is given twice", dst)
+		}
+		seen[dst.String()] = true
+
+		source := strings.TrimSpace(p.Source)
+		if _, err := snat.ParseSource(source); err != nil {
+			return "", nil, fmt.Errorf("invalid SNAT source %q for %s", p.Source, dst)
+		}
+		normalized = append(normalized, models.SNATPool{Destination: dst.String(), Source: source})
+	}
+	return mode, normalized, nil
+}
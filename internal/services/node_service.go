@@ -2,34 +2,75 @@ package services
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"log"
+	"net/netip"
+	"strings"
 	"time"
 
 	"context"
 	"fmt"
 	"tridorian-ztna/internal/models"
 	pb "tridorian-ztna/internal/proto/gateway/v1"
+	"tridorian-ztna/pkg/pki"
 	"tridorian-ztna/pkg/utils"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// enrollmentTokenTTL is how long a node's enrollment token can be used.
+	enrollmentTokenTTL = 24 * time.Hour
+	// gatewayCertValidity is the lifetime of a gateway client certificate.
+	// Gateways renew theirs well before it ends.
+	gatewayCertValidity = 30 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidEnrollmentToken is returned for unknown or already used
+	// enrollment tokens.
+	ErrInvalidEnrollmentToken = errors.New("invalid enrollment token")
+	// ErrDeviceChanged is returned when an enrolled gateway connects from
+	// different hardware.
+	ErrDeviceChanged = errors.New("gateway already registered with different device: reset its enrollment to enroll it again")
+	// ErrDeviceApprovalPending is returned while a gateway's hardware change
+	// waits for an administrator.
+	ErrDeviceApprovalPending = errors.New("gateway hardware changed: waiting for administrator approval")
 )
 
 type NodeService struct {
 	db    *gorm.DB
 	cache *redis.Client
+	ca    *pki.CA
 }
 
+// NewNodeService loads the gateway CA from GATEWAY_CA_CERT and
+// GATEWAY_CA_KEY. Without the key nodes cannot enroll, and without the
+// certificate enrollment tokens come without the CA fingerprint.
 func NewNodeService(db *gorm.DB, cache *redis.Client) *NodeService {
-	return &NodeService{db: db, cache: cache}
+	s := &NodeService{db: db, cache: cache}
+	if certPEM := utils.GetEnv("GATEWAY_CA_CERT", ""); certPEM != "" {
+		ca, err := pki.LoadCA(certPEM, utils.GetEnv("GATEWAY_CA_KEY", ""))
+		if err != nil {
+			log.Printf("⚠️ Gateway CA not loaded: %v", err)
+		} else {
+			s.ca = ca
+		}
+	}
+	return s
 }
 
 func (s *NodeService) ListNodes(tenantID uuid.UUID) ([]models.Node, error) {
 	var nodes []models.Node
-	if err := s.db.Scopes(models.TenantScope(tenantID)).Preload("AccessPolicies").Preload("NodeSku").Find(&nodes).Error; err != nil {
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Preload("AccessPolicies").Preload("NodeSku").Preload("GatewayGroup").Find(&nodes).Error; err != nil {
 		return nil, err
 	}
 
@@ -43,6 +84,8 @@ func (s *NodeService) ListNodes(tenantID uuid.UUID) ([]models.Node, error) {
 			exists, _ := s.cache.Exists(context.Background(), key).Result()
 			if exists == 0 {
 				nodes[i].Status = "DISCONNECTED"
+			} else if s.IsDraining(nodes[i].ID) {
+				nodes[i].Status = "DRAINING"
 			} else {
 				nodes[i].Status = "CONNECTED"
 			}
@@ -58,27 +101,37 @@ func (s *NodeService) GetSessionIP(nodeID uuid.UUID, userID, email string) (stri
 	}
 
 	var node models.Node
-	if err := s.db.First(&node, "id = ?", nodeID).Error; err != nil {
+	if err := s.db.Preload("GatewayGroup").First(&node, "id = ?", nodeID).Error; err != nil {
 		return "", err
 	}
 
-	if node.ClientCIDR == "" {
+	pool := node.ClientPool()
+	if pool == "" {
 		return "", errors.New("node has no client CIDR configured")
 	}
+	prefix, err := netip.ParsePrefix(pool)
+	if err != nil {
+		return "", err
+	}
 
 	ctx := context.Background()
 	assignmentKey := fmt.Sprintf("ip:user:%s:%s", node.TenantID, userID)
 
-	// 1. Check for sticky assignment (1 hour TTL)
+	// 1. Check for sticky assignment (1 hour TTL). It survives a move to
+	// another member of a gateway group sharing one pool; with per-member
+	// pools the user gets an address from the new member's pool.
 	assignedIP, err := s.cache.Get(ctx, assignmentKey).Result()
 	if err == nil && assignedIP != "" {
-		// Refresh TTL
-		s.cache.Expire(ctx, assignmentKey, 1*time.Hour)
-		return assignedIP, nil
+		if addr, err := netip.ParseAddr(assignedIP); err == nil && prefix.Contains(addr) {
+			// Refresh TTL
+			s.cache.Expire(ctx, assignmentKey, 1*time.Hour)
+			s.cache.Expire(ctx, fmt.Sprintf("ip:allocated:%s:%s", node.TenantID, assignedIP), 1*time.Hour)
+			return assignedIP, nil
+		}
 	}
 
 	// 2. Allocate new IP
-	firstIP, lastIP, err := utils.GetIPRange(node.ClientCIDR)
+	firstIP, lastIP, err := utils.GetIPRange(pool)
 	if err != nil {
 		return "", err
 	}
@@ -135,6 +188,7 @@ func (s *NodeService) SyncSessions(nodeID uuid.UUID, sessions []*pb.SyncSessions
 			"user_email":   sess.UserEmail,
 			"ip_address":   sess.IpAddress,
 			"connected_at": sess.ConnectedAt,
+			"device_id":    sess.DeviceId,
 		}
 		jsonData, _ := json.Marshal(sessionData)
 		s.cache.HSet(ctx, sessionsKey, sess.UserId, jsonData)
@@ -200,6 +254,34 @@ func (s *NodeService) UpdateHeartbeat(nodeID uuid.UUID) error {
 	return s.db.Model(&models.Node{}).Where("id = ?", nodeID).Update("last_seen_at", time.Now()).Error
 }
 
+// drainingTTL bounds how long a node stays draining without heartbeats
+// saying so, in case it never comes back.
+const drainingTTL = 10 * time.Minute
+
+// UpdateDraining records whether a node's gateway is shutting down. A
+// draining node is offered to no new clients; it stops draining when its
+// gateway reports ONLINE again, e.g. after an upgrade.
+func (s *NodeService) UpdateDraining(nodeID uuid.UUID, draining bool) error {
+	if s.cache == nil {
+		return nil
+	}
+	ctx := context.Background()
+	key := fmt.Sprintf("node:draining:%s", nodeID.String())
+	if draining {
+		return s.cache.Set(ctx, key, "1", drainingTTL).Err()
+	}
+	return s.cache.Del(ctx, key).Err()
+}
+
+// IsDraining reports whether a node's gateway is shutting down.
+func (s *NodeService) IsDraining(nodeID uuid.UUID) bool {
+	if s.cache == nil {
+		return false
+	}
+	exists, _ := s.cache.Exists(context.Background(), fmt.Sprintf("node:draining:%s", nodeID.String())).Result()
+	return exists > 0
+}
+
 func (s *NodeService) ListNodeSkus() ([]models.NodeSku, error) {
 	var skus []models.NodeSku
 	if err := s.db.Find(&skus).Error; err != nil {
@@ -208,7 +290,9 @@ func (s *NodeService) ListNodeSkus() ([]models.NodeSku, error) {
 	return skus, nil
 }
 
-func (s *NodeService) CreateNode(tenantID uuid.UUID, name string, skuID uuid.UUID, clientCIDR string) (*models.Node, error) {
+// CreateNode creates a node waiting for enrollment and returns it with its
+// one-time enrollment token.
+func (s *NodeService) CreateNode(tenantID uuid.UUID, name string, skuID uuid.UUID, clientCIDR string, actor Actor) (*models.Node, string, error) {
 	node := models.Node{
 		BaseTenant: models.BaseTenant{TenantID: tenantID},
 		Name:       name,
@@ -216,87 +300,410 @@ func (s *NodeService) CreateNode(tenantID uuid.UUID, name string, skuID uuid.UUI
 		IsActive:   true,
 		NodeSkuID:  skuID,
 		ClientCIDR: clientCIDR,
-		AuthToken:  nil, // Token generated on registration
 	}
 
-	if err := s.db.Create(&node).Error; err != nil {
-		return nil, err
+	var token string
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Create(&node).Error; err != nil {
+			return nil, err
+		}
+		var err error
+		if token, err = setEnrollmentToken(tx, &node); err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "node.create", ResourceType: "node", ResourceID: node.ID.String(), After: node}, nil
+	})
+	if err != nil {
+		return nil, "", err
 	}
-	return &node, nil
+	return &node, token, nil
 }
 
-// RegisterGateway handles the gateway enrollment process
-func (s *NodeService) RegisterGateway(nodeID uuid.UUID, hostname string, deviceHash string, ipAddress string, version string) (string, error) {
+// IssueEnrollmentToken replaces the enrollment token of a node that has not
+// enrolled yet, for instance because the first one expired.
+func (s *NodeService) IssueEnrollmentToken(tenantID uuid.UUID, nodeID uuid.UUID, actor Actor) (*models.Node, string, error) {
 	var node models.Node
-	if err := s.db.First(&node, "id = ?", nodeID).Error; err != nil {
-		return "", errors.New("gateway node not found")
-	}
-
-	// 1. If already registered (AuthToken exists)
-	if node.AuthToken != nil && *node.AuthToken != "" {
-		if node.DeviceHash == deviceHash {
-			// Update version and last seen on re-registration/reconnect
-			s.db.Model(&node).Updates(map[string]interface{}{
-				"gateway_version": version,
-				"ip_address":      ipAddress,
-				"last_seen_at":    time.Now(),
-			})
-			_ = s.UpdateHeartbeat(node.ID)
-			return *node.AuthToken, nil
+	var token string
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&node, "id = ?", nodeID).Error; err != nil {
+			return nil, errors.New("node not found")
+		}
+		if node.EnrolledAt != nil {
+			return nil, errors.New("node is already enrolled: reset its enrollment to enroll it again")
+		}
+		before := node
+		var err error
+		if token, err = setEnrollmentToken(tx, &node); err != nil {
+			return nil, err
 		}
-		return "", errors.New("gateway already registered with different device")
+		return &AuditChange{Action: "node.enrollment_token", ResourceType: "node", ResourceID: nodeID.String(), Before: before, After: node}, nil
+	})
+	if err != nil {
+		return nil, "", err
 	}
+	return &node, token, nil
+}
 
-	// 2. Not registered yet - Generate Token
-	bytes := make([]byte, 32)
-	if _, err := rand.Read(bytes); err != nil {
-		return "", err
+// ResetEnrollment revokes a node's certificate, forgets its hardware and
+// issues a new enrollment token, for a rebuilt or replaced gateway or
+// credentials that may have leaked.
+func (s *NodeService) ResetEnrollment(tenantID uuid.UUID, nodeID uuid.UUID, actor Actor) (*models.Node, string, error) {
+	var node models.Node
+	var token string
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&node, "id = ?", nodeID).Error; err != nil {
+			return nil, errors.New("node not found")
+		}
+		before := node
+		node.EnrolledAt = nil
+		node.CertSerial = ""
+		node.CertExpiresAt = nil
+		node.DeviceHash = ""
+		node.PendingDeviceHash = ""
+		node.PendingDeviceIP = ""
+		node.PendingDeviceAt = nil
+		node.Status = "PENDING_REGISTRATION"
+		if err := tx.Model(&node).Updates(map[string]interface{}{
+			"enrolled_at":         nil,
+			"cert_serial":         "",
+			"cert_expires_at":     nil,
+			"device_hash":         "",
+			"pending_device_hash": "",
+			"pending_device_ip":   "",
+			"pending_device_at":   nil,
+			"status":              node.Status,
+		}).Error; err != nil {
+			return nil, err
+		}
+		var err error
+		if token, err = setEnrollmentToken(tx, &node); err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "node.enrollment_reset", ResourceType: "node", ResourceID: nodeID.String(), Before: before, After: node}, nil
+	})
+	if err != nil {
+		return nil, "", err
 	}
-	token := hex.EncodeToString(bytes)
+	return &node, token, nil
+}
 
-	node.AuthToken = &token
-	node.Hostname = hostname
-	node.IPAddress = ipAddress
-	node.DeviceHash = deviceHash
-	node.GatewayVersion = version
-	node.Status = "CONNECTED"
-	now := time.Now()
-	node.LastSeenAt = &now
+// setEnrollmentToken gives the node a new enrollment token and returns it.
+// The token is "<node id>.<secret>"; only a hash of the secret is stored.
+func setEnrollmentToken(tx *gorm.DB, node *models.Node) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(secret)
+	expiresAt := time.Now().Add(enrollmentTokenTTL)
+	node.EnrollmentTokenHash = hex.EncodeToString(hash[:])
+	node.EnrollmentExpiresAt = &expiresAt
+	if err := tx.Model(node).Updates(map[string]interface{}{
+		"enrollment_token_hash": node.EnrollmentTokenHash,
+		"enrollment_expires_at": expiresAt,
+	}).Error; err != nil {
+		return "", err
+	}
+	return node.ID.String() + "." + hex.EncodeToString(secret), nil
+}
 
-	updates := map[string]interface{}{
-		"auth_token":      token,
-		"hostname":        hostname,
-		"ip_address":      ipAddress,
-		"device_hash":     deviceHash,
-		"gateway_version": version,
-		"status":          "CONNECTED",
-		"last_seen_at":    now,
+// EnrollGateway exchanges a one-time enrollment token and a certificate
+// request for the node's client certificate, returned in PEM. The token
+// stops working once used.
+func (s *NodeService) EnrollGateway(token string, csrPEM []byte, hostname string, deviceHash string, ipAddress string, version string) (*models.Node, []byte, error) {
+	if err := s.requireCA(); err != nil {
+		return nil, nil, err
 	}
+	id, secret, ok := strings.Cut(token, ".")
+	nodeID, err := uuid.Parse(id)
+	if !ok || err != nil {
+		return nil, nil, ErrInvalidEnrollmentToken
+	}
+	secretBytes, err := hex.DecodeString(secret)
+	if err != nil {
+		return nil, nil, ErrInvalidEnrollmentToken
+	}
+	hash := sha256.Sum256(secretBytes)
 
-	if err := s.db.Model(&node).Updates(updates).Error; err != nil {
-		return "", err
+	var node models.Node
+	var certPEM []byte
+	actor := Actor{Type: models.AuditActorSystem, IP: ipAddress}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// Locked so that a token cannot be used twice concurrently
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&node, "id = ?", nodeID).Error; err != nil {
+			return ErrInvalidEnrollmentToken
+		}
+		if node.EnrollmentTokenHash == "" || subtle.ConstantTimeCompare([]byte(node.EnrollmentTokenHash), []byte(hex.EncodeToString(hash[:]))) != 1 {
+			return ErrInvalidEnrollmentToken
+		}
+		if node.EnrollmentExpiresAt == nil || time.Now().After(*node.EnrollmentExpiresAt) {
+			return errors.New("enrollment token has expired")
+		}
+
+		before := node
+		cert, pemBytes, err := s.ca.SignClientCSR(csrPEM, node.ID.String(), gatewayCertValidity)
+		if err != nil {
+			return err
+		}
+		certPEM = pemBytes
+		now := time.Now()
+		node.EnrollmentTokenHash = ""
+		node.EnrollmentExpiresAt = nil
+		node.EnrolledAt = &now
+		node.CertSerial = pki.SerialHex(cert)
+		node.CertExpiresAt = &cert.NotAfter
+		node.Hostname = hostname
+		node.IPAddress = ipAddress
+		node.DeviceHash = deviceHash
+		node.GatewayVersion = version
+		node.Status = "CONNECTED"
+		node.LastSeenAt = &now
+		if err := tx.Model(&node).Updates(map[string]interface{}{
+			"enrollment_token_hash": "",
+			"enrollment_expires_at": nil,
+			"enrolled_at":           now,
+			"cert_serial":           node.CertSerial,
+			"cert_expires_at":       cert.NotAfter,
+			"hostname":              hostname,
+			"ip_address":            ipAddress,
+			"device_hash":           deviceHash,
+			"gateway_version":       version,
+			"status":                "CONNECTED",
+			"last_seen_at":          now,
+		}).Error; err != nil {
+			return err
+		}
+		return recordAudit(tx, node.TenantID, actor, &AuditChange{Action: "node.enroll", ResourceType: "node", ResourceID: node.ID.String(), Before: before, After: node})
+	})
+	if err != nil {
+		return nil, nil, err
 	}
 
 	_ = s.UpdateHeartbeat(node.ID)
-
-	return token, nil
+	return &node, certPEM, nil
 }
 
-func (s *NodeService) DeleteNode(tenantID uuid.UUID, nodeID uuid.UUID) error {
-	result := s.db.Scopes(models.TenantScope(tenantID)).Delete(&models.Node{}, "id = ?", nodeID)
+// RenewCertificate issues a new client certificate to an enrolled node. The
+// previous certificate stops working.
+func (s *NodeService) RenewCertificate(node *models.Node, csrPEM []byte) ([]byte, error) {
+	if err := s.requireCA(); err != nil {
+		return nil, err
+	}
+	cert, certPEM, err := s.ca.SignClientCSR(csrPEM, node.ID.String(), gatewayCertValidity)
+	if err != nil {
+		return nil, err
+	}
+	serial := pki.SerialHex(cert)
+	// Conditional on the serial so that two renewals with the same
+	// certificate cannot both succeed
+	result := s.db.Model(&models.Node{}).Where("id = ? AND cert_serial = ?", node.ID, node.CertSerial).Updates(map[string]interface{}{
+		"cert_serial":     serial,
+		"cert_expires_at": cert.NotAfter,
+	})
 	if result.Error != nil {
-		return result.Error
+		return nil, result.Error
 	}
 	if result.RowsAffected == 0 {
-		return errors.New("node not found")
+		return nil, errors.New("certificate has already been renewed")
+	}
+	node.CertSerial = serial
+	node.CertExpiresAt = &cert.NotAfter
+	return certPEM, nil
+}
+
+// VerifyDevice checks that an enrolled gateway still runs on the hardware
+// it enrolled from. A changed device hash is refused with ErrDeviceChanged
+// or, when the tenant has turned on hardware change approval, recorded for
+// an administrator and refused with ErrDeviceApprovalPending until approved.
+func (s *NodeService) VerifyDevice(node *models.Node, deviceHash string, ipAddress string) error {
+	if node.DeviceHash == "" || deviceHash == node.DeviceHash {
+		return nil
+	}
+
+	var tenant models.Tenant
+	if err := s.db.Select("id", "gateway_hardware_approval").First(&tenant, "id = ?", node.TenantID).Error; err != nil {
+		return err
+	}
+	if !tenant.GatewayHardwareApproval {
+		return ErrDeviceChanged
+	}
+	if deviceHash == node.PendingDeviceHash {
+		return ErrDeviceApprovalPending
+	}
+
+	// Only the latest change waits; a request from other hardware replaces it
+	actor := Actor{Type: models.AuditActorSystem, IP: ipAddress}
+	err := audited(s.db, node.TenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		before := *node
+		now := time.Now()
+		node.PendingDeviceHash = deviceHash
+		node.PendingDeviceIP = ipAddress
+		node.PendingDeviceAt = &now
+		if err := tx.Model(node).Updates(map[string]interface{}{
+			"pending_device_hash": deviceHash,
+			"pending_device_ip":   ipAddress,
+			"pending_device_at":   now,
+		}).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "node.hardware_change.request", ResourceType: "node", ResourceID: node.ID.String(), Before: before, After: *node}, nil
+	})
+	if err != nil {
+		return err
+	}
+	return ErrDeviceApprovalPending
+}
+
+// ListHardwareChanges returns the nodes whose hardware change waits for
+// approval, oldest request first.
+func (s *NodeService) ListHardwareChanges(tenantID uuid.UUID) ([]models.Node, error) {
+	var nodes []models.Node
+	err := s.db.Scopes(models.TenantScope(tenantID)).
+		Where("pending_device_hash <> ''").
+		Order("pending_device_at").
+		Find(&nodes).Error
+	return nodes, err
+}
+
+// ApproveHardwareChange accepts the hardware a node's gateway now runs on.
+func (s *NodeService) ApproveHardwareChange(tenantID uuid.UUID, nodeID uuid.UUID, actor Actor) (*models.Node, error) {
+	return s.resolveHardwareChange(tenantID, nodeID, true, actor)
+}
+
+// RejectHardwareChange refuses a node's hardware change. The certificate
+// was presented from unknown hardware, so it is revoked too: the node must
+// be enrolled again.
+func (s *NodeService) RejectHardwareChange(tenantID uuid.UUID, nodeID uuid.UUID, actor Actor) (*models.Node, error) {
+	return s.resolveHardwareChange(tenantID, nodeID, false, actor)
+}
+
+func (s *NodeService) resolveHardwareChange(tenantID uuid.UUID, nodeID uuid.UUID, approve bool, actor Actor) (*models.Node, error) {
+	var node models.Node
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&node, "id = ?", nodeID).Error; err != nil {
+			return nil, errors.New("node not found")
+		}
+		if node.PendingDeviceHash == "" {
+			return nil, errors.New("node has no hardware change waiting for approval")
+		}
+		before := node
+		updates := map[string]interface{}{
+			"pending_device_hash": "",
+			"pending_device_ip":   "",
+			"pending_device_at":   nil,
+		}
+		action := "node.hardware_change.approve"
+		if approve {
+			node.DeviceHash = node.PendingDeviceHash
+			updates["device_hash"] = node.DeviceHash
+		} else {
+			action = "node.hardware_change.reject"
+			node.CertSerial = ""
+			node.CertExpiresAt = nil
+			node.EnrolledAt = nil
+			node.Status = "PENDING_REGISTRATION"
+			updates["cert_serial"] = ""
+			updates["cert_expires_at"] = nil
+			updates["enrolled_at"] = nil
+			updates["status"] = node.Status
+		}
+		node.PendingDeviceHash = ""
+		node.PendingDeviceIP = ""
+		node.PendingDeviceAt = nil
+		if err := tx.Model(&node).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: action, ResourceType: "node", ResourceID: nodeID.String(), Before: before, After: node}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// UpdateGatewayInfo records the address and version a gateway connects
+// from when they change.
+func (s *NodeService) UpdateGatewayInfo(node *models.Node, ipAddress string, version string) error {
+	updates := map[string]interface{}{}
+	if ipAddress != "" && ipAddress != node.IPAddress {
+		updates["ip_address"] = ipAddress
+	}
+	if version != "" && version != node.GatewayVersion {
+		updates["gateway_version"] = version
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return s.db.Model(&models.Node{}).Where("id = ?", node.ID).Updates(updates).Error
+}
+
+// CA returns the gateway certificate authority, or nil when GATEWAY_CA_CERT
+// is not set.
+func (s *NodeService) CA() *pki.CA {
+	return s.ca
+}
+
+func (s *NodeService) requireCA() error {
+	if s.ca == nil || s.ca.Key == nil {
+		return errors.New("the gateway CA is not configured")
 	}
 	return nil
 }
 
-func (s *NodeService) GetNodeByToken(token string) (*models.Node, error) {
+func (s *NodeService) DeleteNode(tenantID uuid.UUID, nodeID uuid.UUID, actor Actor) error {
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var node models.Node
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&node, "id = ?", nodeID).Error; err != nil {
+			return nil, errors.New("node not found")
+		}
+		if err := tx.Delete(&node).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "node.delete", ResourceType: "node", ResourceID: nodeID.String(), Before: node}, nil
+	})
+}
+
+// UpdateNode changes a node's SKU and client CIDR.
+func (s *NodeService) UpdateNode(tenantID uuid.UUID, nodeID uuid.UUID, skuID uuid.UUID, clientCIDR string, actor Actor) (*models.Node, error) {
 	var node models.Node
-	if err := s.db.Preload("NodeSku").First(&node, "auth_token = ?", token).Error; err != nil {
-		return nil, errors.New("invalid token")
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Scopes(models.TenantScope(tenantID)).First(&node, "id = ?", nodeID).Error; err != nil {
+			return nil, errors.New("node not found")
+		}
+		before := node
+		node.NodeSkuID = skuID
+		node.ClientCIDR = clientCIDR
+		if err := tx.Model(&node).Updates(map[string]interface{}{
+			"node_sku_id": skuID,
+			"client_cidr": clientCIDR,
+		}).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "node.update", ResourceType: "node", ResourceID: nodeID.String(), Before: before, After: node}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// GetNodeByCertificate returns the node a verified client certificate
+// belongs to. Only the node's current certificate is accepted, so renewing
+// or resetting the enrollment revokes the previous one.
+func (s *NodeService) GetNodeByCertificate(cert *x509.Certificate) (*models.Node, error) {
+	nodeID, err := uuid.Parse(cert.Subject.CommonName)
+	if err != nil {
+		return nil, errors.New("invalid certificate")
+	}
+	var node models.Node
+	if err := s.db.Preload("NodeSku").Preload("GatewayGroup").First(&node, "id = ?", nodeID).Error; err != nil {
+		return nil, errors.New("invalid certificate")
+	}
+	if node.CertSerial == "" || node.CertSerial != pki.SerialHex(cert) {
+		return nil, errors.New("certificate has been replaced or revoked")
+	}
+	if !node.IsActive {
+		return nil, errors.New("node is disabled")
 	}
 	return &node, nil
 }
@@ -3,9 +3,14 @@ package services
 import (
 	"crypto/sha256"
 	"fmt"
+	"slices"
+	"sort"
 	"strings"
 	"tridorian-ztna/internal/models"
 	pb "tridorian-ztna/internal/proto/gateway/v1"
+	"tridorian-ztna/pkg/fqdn"
+	"tridorian-ztna/pkg/portrange"
+	"tridorian-ztna/pkg/posture"
 )
 
 // GenerateGatewayPolicies converts internal AccessPolicy models into the Protobuf format expected by the Gateway.
@@ -17,61 +22,133 @@ func GenerateGatewayPolicies(policies []models.AccessPolicy) []*pb.GetConfigResp
 		// Flatten the tree logic regarding Source (Identity, Device, etc.)
 		sourceRules := flattenPolicyNode(p.RootNode)
 
+		// Time conditions restrict when the whole policy is active, so they are
+		// attached to every generated rule and enforced by the gateway.
+		timeConditions := collectTimeConditions(p.RootNode)
+
+		// Posture requirements are checked by the gateway against the
+		// signed report each client sends over the tunnel.
+		deviceConditions := collectDeviceConditions(p.RootNode)
+
 		// If no source rules are returned (e.g. empty tree or unsupported conditions),
 		// we might optionally create a "catch-all" or skip.
 		if len(sourceRules) == 0 {
 			continue
 		}
 
+		// Map Destination
+		var dests []gatewayDestination
+		switch p.DestinationType {
+		case "cidr":
+			dests = append(dests, gatewayDestination{tag: "CIDR", value: p.DestinationCIDR})
+		case "sni":
+			dests = append(dests, gatewayDestination{tag: "SNI", value: p.DestinationSNI})
+		case "fqdn":
+			// Resolved into address sets by the gateway
+			dests = append(dests, gatewayDestination{tag: "FQDN", value: strings.Join(fqdn.Split(p.DestinationFQDN), ",")})
+		case "app":
+			if p.DestinationApp != nil {
+				dests = applicationDestinations(p.DestinationApp)
+			}
+		case "app_tag":
+			for i := range p.TaggedApps {
+				dests = append(dests, applicationDestinations(&p.TaggedApps[i])...)
+			}
+		}
+
+		// Map Action
+		action := "ALLOW" // Default to ALLOW for Access Policies unless specified
+		if strings.EqualFold(p.Effect, "deny") {
+			action = "DENY"
+		}
+
 		for _, src := range sourceRules {
-			// Map Destination
-			destTag := ""
-			destVal := ""
-
-			switch p.DestinationType {
-			case "cidr":
-				destTag = "CIDR"
-				destVal = p.DestinationCIDR
-			case "sni":
-				destTag = "SNI"
-				destVal = p.DestinationSNI
-			case "app":
-				// Support for Applications (multiple CIDRs)
-				if p.DestinationApp != nil && len(p.DestinationApp.CIDRs) > 0 {
-					var cidrs []string
-					for _, c := range p.DestinationApp.CIDRs {
-						cidrs = append(cidrs, c.CIDR)
-					}
-					destTag = "CIDR"
-					// The Gateway Firewall Engine supports comma-separated CIDRs in a single rule
-					destVal = strings.Join(cidrs, ",")
+			for _, dest := range dests {
+				gp := &pb.GetConfigResponse_Policy{
+					Name:                  p.Name,
+					Action:                action,
+					Priority:              int32(p.Priority),
+					SourceTagType:         src.TagType,
+					SourceMatchValue:      src.Value,
+					DestinationTagType:    dest.tag,
+					DestinationMatchValue: dest.value,
+					TimeConditions:        timeConditions,
+					DeviceConditions:      deviceConditions,
+					Ports:                 dest.ports,
 				}
-			}
 
-			if destTag == "" {
-				continue
+				result = append(result, gp)
 			}
+		}
+	}
+	return result
+}
 
-			// Map Action
-			action := "ALLOW" // Default to ALLOW for Access Policies unless specified
-			if strings.EqualFold(p.Effect, "deny") {
-				action = "DENY"
-			}
+type gatewayDestination struct {
+	tag   string
+	value string
+	ports []*pb.GetConfigResponse_PortRange
+}
 
-			gp := &pb.GetConfigResponse_Policy{
-				Name:                  p.Name,
-				Action:                action,
-				Priority:              int32(p.Priority),
-				SourceTagType:         src.TagType,
-				SourceMatchValue:      src.Value,
-				DestinationTagType:    destTag,
-				DestinationMatchValue: destVal,
-			}
+// applicationDestinations maps an application to one CIDR rule for its networks
+// and one FQDN rule for its host names, both limited to the application's ports.
+// The gateway firewall engine supports comma-separated values in a single rule.
+func applicationDestinations(app *models.Application) []gatewayDestination {
+	var cidrs, names []string
+	for _, d := range app.Destinations {
+		switch d.Type {
+		case "cidr":
+			cidrs = append(cidrs, d.Value)
+		case "fqdn":
+			names = append(names, d.Value)
+		}
+	}
 
-			result = append(result, gp)
+	var ports []*pb.GetConfigResponse_PortRange
+	ranges, _ := portrange.Parse(app.Ports) // Validated when the application was saved
+	for _, r := range ranges {
+		ports = append(ports, &pb.GetConfigResponse_PortRange{
+			Protocol: r.Protocol,
+			From:     uint32(r.From),
+			To:       uint32(r.To),
+		})
+	}
+
+	var dests []gatewayDestination
+	if len(cidrs) > 0 {
+		dests = append(dests, gatewayDestination{tag: "CIDR", value: strings.Join(cidrs, ","), ports: ports})
+	}
+	if len(names) > 0 {
+		dests = append(dests, gatewayDestination{tag: "FQDN", value: strings.Join(names, ","), ports: ports})
+	}
+	return dests
+}
+
+// GenerateHealthChecks lists the health checks of applications referenced by the policies.
+func GenerateHealthChecks(policies []models.AccessPolicy) []*pb.GetConfigResponse_HealthCheck {
+	var checks []*pb.GetConfigResponse_HealthCheck
+	seen := make(map[string]bool)
+	add := func(app *models.Application) {
+		id := app.ID.String()
+		if app.HealthCheck == "" || seen[id] {
+			return
 		}
+		seen[id] = true
+		checks = append(checks, &pb.GetConfigResponse_HealthCheck{ApplicationId: id, Target: app.HealthCheck})
 	}
-	return result
+
+	for _, p := range policies {
+		if p.DestinationApp != nil {
+			add(p.DestinationApp)
+		}
+		for i := range p.TaggedApps {
+			add(&p.TaggedApps[i])
+		}
+	}
+	sort.Slice(checks, func(i, j int) bool {
+		return checks[i].ApplicationId < checks[j].ApplicationId
+	})
+	return checks
 }
 
 type SourceRule struct {
@@ -79,6 +156,26 @@ type SourceRule struct {
 	Value   string
 }
 
+// matchesAnySource applies the gateway's source matching to a user.
+func matchesAnySource(rules []SourceRule, email string, groups []string, os string) bool {
+	for _, r := range rules {
+		switch r.TagType {
+		case "Identity":
+			if r.Value == email {
+				return true
+			}
+			if group, ok := strings.CutPrefix(r.Value, "group:"); ok && slices.Contains(groups, group) {
+				return true
+			}
+		case "DeviceOS":
+			if strings.EqualFold(r.Value, os) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // flattenPolicyNode traverses the condition tree and returns a list of valid Source Rules (OR logic).
 func flattenPolicyNode(node models.PolicyNode) []SourceRule {
 	var rules []SourceRule
@@ -103,6 +200,50 @@ func flattenPolicyNode(node models.PolicyNode) []SourceRule {
 	return rules
 }
 
+// collectTimeConditions returns every "Time" condition found in the tree.
+// validatePolicyTree only accepts them under AND groups, so all must match.
+func collectTimeConditions(node models.PolicyNode) []*pb.GetConfigResponse_TimeCondition {
+	var conds []*pb.GetConfigResponse_TimeCondition
+
+	if node.Condition != nil {
+		if node.Condition.Type == "Time" {
+			conds = append(conds, &pb.GetConfigResponse_TimeCondition{
+				Field:    node.Condition.Field,
+				Op:       node.Condition.Op,
+				Value:    node.Condition.Value,
+				Timezone: node.Condition.Timezone,
+			})
+		}
+		return conds
+	}
+
+	for _, child := range node.Children {
+		conds = append(conds, collectTimeConditions(child)...)
+	}
+	return conds
+}
+
+// collectDeviceConditions returns every "Device" posture condition found in the tree.
+func collectDeviceConditions(node models.PolicyNode) []*pb.GetConfigResponse_DeviceCondition {
+	var conds []*pb.GetConfigResponse_DeviceCondition
+
+	if node.Condition != nil {
+		if node.Condition.Type == "Device" && posture.IsPostureField(node.Condition.Field) {
+			conds = append(conds, &pb.GetConfigResponse_DeviceCondition{
+				Field: strings.ToLower(node.Condition.Field),
+				Op:    node.Condition.Op,
+				Value: node.Condition.Value,
+			})
+		}
+		return conds
+	}
+
+	for _, child := range node.Children {
+		conds = append(conds, collectDeviceConditions(child)...)
+	}
+	return conds
+}
+
 func mapCondition(c models.PolicyCondition) (string, string) {
 	switch c.Type {
 	case "User":
@@ -125,8 +266,26 @@ func mapCondition(c models.PolicyCondition) (string, string) {
 	return "", ""
 }
 
-func CalculateConfigHash(policies []*pb.GetConfigResponse_Policy) string {
-	if len(policies) == 0 {
+// GenerateDNSConfig builds the split DNS section of the gateway config from the tenant settings.
+func GenerateDNSConfig(tenant *models.Tenant) *pb.GetConfigResponse_DNSConfig {
+	if tenant == nil || tenant.DNSDomains == "" {
+		return nil
+	}
+	var resolvers []string
+	for _, r := range strings.Split(tenant.DNSResolvers, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			resolvers = append(resolvers, r)
+		}
+	}
+	return &pb.GetConfigResponse_DNSConfig{
+		Domains:        fqdn.Split(tenant.DNSDomains),
+		Resolvers:      resolvers,
+		SearchSuffixes: fqdn.Split(tenant.DNSSearchSuffixes),
+	}
+}
+
+func CalculateConfigHash(policies []*pb.GetConfigResponse_Policy, blockedDeviceIDs []string, revokedUserEmails []string, revokedSessions map[string]int64, dns *pb.GetConfigResponse_DNSConfig, healthChecks []*pb.GetConfigResponse_HealthCheck, peers []*pb.GetConfigResponse_Peer, egress *pb.GetConfigResponse_Egress) string {
+	if len(policies) == 0 && len(blockedDeviceIDs) == 0 && len(revokedUserEmails) == 0 && len(revokedSessions) == 0 && dns == nil && len(healthChecks) == 0 && len(peers) == 0 && egress == nil {
 		return "empty"
 	}
 	// Simple string concatenation of all fields to generate a hash
@@ -139,6 +298,45 @@ func CalculateConfigHash(policies []*pb.GetConfigResponse_Policy) string {
 		builder.WriteString(p.SourceMatchValue)
 		builder.WriteString(p.DestinationTagType)
 		builder.WriteString(p.DestinationMatchValue)
+		for _, t := range p.TimeConditions {
+			builder.WriteString(t.Field + t.Op + t.Value + t.Timezone)
+		}
+		for _, d := range p.DeviceConditions {
+			builder.WriteString(d.Field + d.Op + d.Value)
+		}
+		for _, r := range p.Ports {
+			builder.WriteString(fmt.Sprintf("%s/%d-%d", r.Protocol, r.From, r.To))
+		}
+		builder.WriteString("|")
+	}
+	for _, id := range blockedDeviceIDs {
+		builder.WriteString("blocked:" + id + "|")
+	}
+	for _, email := range revokedUserEmails {
+		builder.WriteString("revoked:" + email + "|")
+	}
+	emails := make([]string, 0, len(revokedSessions))
+	for email := range revokedSessions {
+		emails = append(emails, email)
+	}
+	sort.Strings(emails)
+	for _, email := range emails {
+		builder.WriteString(fmt.Sprintf("session:%s=%d|", email, revokedSessions[email]))
+	}
+	for _, c := range healthChecks {
+		builder.WriteString("health:" + c.ApplicationId + "=" + c.Target + "|")
+	}
+	if dns != nil {
+		builder.WriteString("dns:" + strings.Join(dns.Domains, ",") + ";" + strings.Join(dns.Resolvers, ",") + ";" + strings.Join(dns.SearchSuffixes, ",") + "|")
+	}
+	for _, p := range peers {
+		builder.WriteString("peer:" + p.NodeId + "#" + p.CertSerial + "@" + p.Address + "=" + strings.Join(p.Routes, ",") + ";" + p.ClientPool + "|")
+	}
+	if egress != nil {
+		builder.WriteString("egress:" + egress.Mode)
+		for _, p := range egress.SnatPools {
+			builder.WriteString(";" + p.Destination + ">" + p.Source)
+		}
 		builder.WriteString("|")
 	}
 
@@ -2,8 +2,13 @@ package services
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"tridorian-ztna/internal/models"
+	"tridorian-ztna/pkg/fqdn"
+	"tridorian-ztna/pkg/posture"
+	"tridorian-ztna/pkg/schedule"
 
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
@@ -19,11 +24,45 @@ func NewPolicyService(db *gorm.DB, cache *redis.Client) *PolicyService {
 	return &PolicyService{db: db, cache: cache}
 }
 
+// withDB returns a copy of the service that works in tx.
+func (s *PolicyService) withDB(tx *gorm.DB) *PolicyService {
+	return &PolicyService{db: tx, cache: s.cache}
+}
+
+// loadAccessPolicy loads one policy with its rule tree and gateways.
+func (s *PolicyService) loadAccessPolicy(tenantID, policyID uuid.UUID) (*models.AccessPolicy, error) {
+	var policy models.AccessPolicy
+	nodeNames := func(db *gorm.DB) *gorm.DB { return db.Select("id", "name") }
+	if err := s.db.Scopes(models.TenantScope(tenantID)).Preload("Nodes", nodeNames).First(&policy, "id = ?", policyID).Error; err != nil {
+		return nil, err
+	}
+	if policy.RootNodeID != nil {
+		if node, err := s.LoadNodeRecursive(*policy.RootNodeID); err == nil {
+			policy.RootNode = *node
+		}
+	}
+	return &policy, nil
+}
+
+// loadSignInPolicy loads one sign-in policy with its rule tree.
+func (s *PolicyService) loadSignInPolicy(tenantID, policyID uuid.UUID) (*models.SignInPolicy, error) {
+	var policy models.SignInPolicy
+	if err := s.db.Scopes(models.TenantScope(tenantID)).First(&policy, "id = ?", policyID).Error; err != nil {
+		return nil, err
+	}
+	if policy.RootNodeID != uuid.Nil {
+		if node, err := s.LoadNodeRecursive(policy.RootNodeID); err == nil {
+			policy.RootNode = *node
+		}
+	}
+	return &policy, nil
+}
+
 func (s *PolicyService) ListAccessPolicies(tenantID uuid.UUID) ([]models.AccessPolicy, error) {
 	var policies []models.AccessPolicy
 	if err := s.db.Scopes(models.TenantScope(tenantID)).
 		Preload("DestinationApp").
-		Preload("DestinationApp.CIDRs").
+		Preload("DestinationApp.Destinations").
 		Preload("Nodes").
 		Order("priority asc").
 		Find(&policies).Error; err != nil {
@@ -38,15 +77,88 @@ func (s *PolicyService) ListAccessPolicies(tenantID uuid.UUID) ([]models.AccessP
 			}
 		}
 	}
+	if err := s.resolveTaggedApps(tenantID, policies); err != nil {
+		return nil, err
+	}
 	return policies, nil
 }
 
+// resolveTaggedApps loads the applications behind "app_tag" policies.
+func (s *PolicyService) resolveTaggedApps(tenantID uuid.UUID, policies []models.AccessPolicy) error {
+	byTag := make(map[string][]models.Application)
+	for i := range policies {
+		tag := policies[i].DestinationAppTag
+		if policies[i].DestinationType != "app_tag" || tag == "" {
+			continue
+		}
+		if _, ok := byTag[tag]; !ok {
+			apps, err := listApplicationsByTag(s.db, tenantID, tag)
+			if err != nil {
+				return err
+			}
+			byTag[tag] = apps
+		}
+		policies[i].TaggedApps = byTag[tag]
+	}
+	return nil
+}
+
+// ListPermittedApplications returns the applications a user may reach. Enabled
+// policies are evaluated in priority order like on the gateway: the first
+// policy matching the user and an application decides. Time and posture
+// conditions are not evaluated, so the list shows what the user can reach in principle.
+func (s *PolicyService) ListPermittedApplications(tenantID uuid.UUID, email string, groups []string, os string) ([]models.Application, error) {
+	policies, err := s.ListAccessPolicies(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	decided := make(map[uuid.UUID]bool)
+	var permitted []models.Application
+	for _, p := range policies {
+		if !p.Enabled || !matchesAnySource(flattenPolicyNode(p.RootNode), email, groups, os) {
+			continue
+		}
+
+		var apps []models.Application
+		switch p.DestinationType {
+		case "app":
+			if p.DestinationApp != nil {
+				apps = append(apps, *p.DestinationApp)
+			}
+		case "app_tag":
+			apps = p.TaggedApps
+		}
+
+		allow := !strings.EqualFold(p.Effect, "deny")
+		for _, app := range apps {
+			if decided[app.ID] {
+				continue
+			}
+			decided[app.ID] = true
+			if allow {
+				permitted = append(permitted, app)
+			}
+		}
+	}
+	return permitted, nil
+}
+
+// GetAccessPolicy returns one access policy with its rule tree and gateways.
+func (s *PolicyService) GetAccessPolicy(tenantID, policyID uuid.UUID) (*models.AccessPolicy, error) {
+	policy, err := s.loadAccessPolicy(tenantID, policyID)
+	if err != nil {
+		return nil, errors.New("policy not found")
+	}
+	return policy, nil
+}
+
 func (s *PolicyService) ListAccessPoliciesByNodeID(tenantID uuid.UUID, nodeID uuid.UUID) ([]models.AccessPolicy, error) {
 	var policies []models.AccessPolicy
 	// Find policies where the node is in the association
 	if err := s.db.Scopes(models.TenantScope(tenantID)).
 		Preload("DestinationApp").
-		Preload("DestinationApp.CIDRs").
+		Preload("DestinationApp.Destinations").
 		Preload("Nodes").
 		Joins("JOIN access_policy_nodes ON access_policy_nodes.access_policy_id = access_policies.id").
 		Where("access_policy_nodes.node_id = ? AND access_policies.enabled = ?", nodeID, true).
@@ -63,50 +175,93 @@ func (s *PolicyService) ListAccessPoliciesByNodeID(tenantID uuid.UUID, nodeID uu
 			}
 		}
 	}
+	if err := s.resolveTaggedApps(tenantID, policies); err != nil {
+		return nil, err
+	}
 	return policies, nil
 }
 
-func (s *PolicyService) CreateAccessPolicy(tenantID uuid.UUID, policy *models.AccessPolicy) (*models.AccessPolicy, error) {
+func (s *PolicyService) CreateAccessPolicy(tenantID uuid.UUID, policy *models.AccessPolicy, actor Actor) (*models.AccessPolicy, error) {
+	if err := validateDestination(policy); err != nil {
+		return nil, err
+	}
+	if err := validatePolicyTree(&policy.RootNode); err != nil {
+		return nil, err
+	}
+	if err := s.validateIdentities(tenantID, &policy.RootNode); err != nil {
+		return nil, err
+	}
 	policy.TenantID = tenantID
 	policy.Enabled = true
 
 	s.setTenantIDOnTree(tenantID, &policy.RootNode)
 
-	// Create policy first, omitting Nodes to prevent insertion of empty Node objects
-	if err := s.db.Omit("Nodes").Create(policy).Error; err != nil {
-		return nil, err
-	}
-
-	// Update the Many-to-Many association if provided
-	if len(policy.Nodes) > 0 {
-		if err := s.db.Model(policy).Association("Nodes").Replace(policy.Nodes); err != nil {
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		// Create policy first, omitting Nodes to prevent insertion of empty Node objects
+		if err := tx.Omit("Nodes").Create(policy).Error; err != nil {
 			return nil, err
 		}
-	}
 
+		// Update the Many-to-Many association if provided
+		if len(policy.Nodes) > 0 {
+			if err := tx.Model(policy).Association("Nodes").Replace(policy.Nodes); err != nil {
+				return nil, err
+			}
+		}
+		return &AuditChange{Action: "access_policy.create", ResourceType: "access_policy", ResourceID: policy.ID.String(), After: policy}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
 	return policy, nil
 }
 
-func (s *PolicyService) UpdateAccessPolicy(tenantID uuid.UUID, policy *models.AccessPolicy) (*models.AccessPolicy, error) {
+func (s *PolicyService) UpdateAccessPolicy(tenantID uuid.UUID, policy *models.AccessPolicy, actor Actor) (*models.AccessPolicy, error) {
+	if err := validateDestination(policy); err != nil {
+		return nil, err
+	}
+	if err := validatePolicyTree(&policy.RootNode); err != nil {
+		return nil, err
+	}
+	if err := s.validateIdentities(tenantID, &policy.RootNode); err != nil {
+		return nil, err
+	}
 	policy.TenantID = tenantID
 
-	// 1. Get the old policy to find the root node
-	var oldPolicy models.AccessPolicy
-	if err := s.db.First(&oldPolicy, "id = ?", policy.ID).Error; err == nil {
-		// 2. Delete the old tree recursively
-		if oldPolicy.RootNodeID != nil {
-			s.DeleteNodeRecursive(*oldPolicy.RootNodeID)
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		ts := s.withDB(tx)
+
+		// 1. Get the old policy to find the root node
+		oldPolicy, err := ts.loadAccessPolicy(tenantID, policy.ID)
+		if err != nil {
+			return nil, errors.New("policy not found")
+		}
+		if err := ts.replaceAccessPolicy(oldPolicy, policy); err != nil {
+			return nil, err
 		}
+		return &AuditChange{Action: "access_policy.update", ResourceType: "access_policy", ResourceID: policy.ID.String(), Before: oldPolicy, After: policy}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// replaceAccessPolicy saves policy over oldPolicy, recreating its rule tree.
+func (s *PolicyService) replaceAccessPolicy(oldPolicy, policy *models.AccessPolicy) error {
+	// 2. Delete the old tree recursively
+	if oldPolicy.RootNodeID != nil {
+		s.DeleteNodeRecursive(*oldPolicy.RootNodeID)
 	}
 
-	s.setTenantIDOnTree(tenantID, &policy.RootNode)
+	s.setTenantIDOnTree(policy.TenantID, &policy.RootNode)
 
 	// 3. Clear IDs in the new tree to force recreation
 	s.clearIDsRecursive(&policy.RootNode)
 
 	// Update the policy fields (except associations)
 	if err := s.db.Omit("Nodes").Save(policy).Error; err != nil {
-		return nil, err
+		return err
 	}
 
 	// Check existing associations to avoid redundant updates
@@ -116,7 +271,7 @@ func (s *PolicyService) UpdateAccessPolicy(tenantID uuid.UUID, policy *models.Ac
 	lookupPolicy.ID = policy.ID
 
 	if err := s.db.Model(lookupPolicy).Association("Nodes").Find(&currentNodes); err != nil {
-		return nil, err
+		return err
 	}
 
 	shouldUpdateNodes := false
@@ -139,22 +294,23 @@ func (s *PolicyService) UpdateAccessPolicy(tenantID uuid.UUID, policy *models.Ac
 	// Update the Many-to-Many association explicitly only if changed
 	if shouldUpdateNodes {
 		if err := s.db.Model(policy).Association("Nodes").Replace(policy.Nodes); err != nil {
-			return nil, err
+			return err
 		}
 	}
-
-	return policy, nil
+	return nil
 }
 
-func (s *PolicyService) DeleteAccessPolicy(tenantID uuid.UUID, policyID uuid.UUID) error {
-	result := s.db.Scopes(models.TenantScope(tenantID)).Delete(&models.AccessPolicy{}, "id = ?", policyID)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("policy not found")
-	}
-	return nil
+func (s *PolicyService) DeleteAccessPolicy(tenantID uuid.UUID, policyID uuid.UUID, actor Actor) error {
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		policy, err := s.withDB(tx).loadAccessPolicy(tenantID, policyID)
+		if err != nil {
+			return nil, errors.New("policy not found")
+		}
+		if err := tx.Delete(&models.AccessPolicy{}, "id = ?", policyID).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "access_policy.delete", ResourceType: "access_policy", ResourceID: policyID.String(), Before: policy}, nil
+	})
 }
 
 func (s *PolicyService) ListSignInPolicies(tenantID uuid.UUID) ([]models.SignInPolicy, error) {
@@ -191,34 +347,61 @@ func (s *PolicyService) LoadNodeRecursive(nodeID uuid.UUID) (*models.PolicyNode,
 	return &node, nil
 }
 
-func (s *PolicyService) CreateSignInPolicy(tenantID uuid.UUID, policy *models.SignInPolicy) (*models.SignInPolicy, error) {
+func (s *PolicyService) CreateSignInPolicy(tenantID uuid.UUID, policy *models.SignInPolicy, actor Actor) (*models.SignInPolicy, error) {
+	if err := validatePolicyTree(&policy.RootNode); err != nil {
+		return nil, err
+	}
+	if err := s.validateIdentities(tenantID, &policy.RootNode); err != nil {
+		return nil, err
+	}
 	policy.TenantID = tenantID
 	policy.Enabled = true
 
 	s.setTenantIDOnTree(tenantID, &policy.RootNode)
 
-	if err := s.db.Session(&gorm.Session{FullSaveAssociations: true}).Create(policy).Error; err != nil {
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Session(&gorm.Session{FullSaveAssociations: true}).Create(policy).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "sign_in_policy.create", ResourceType: "sign_in_policy", ResourceID: policy.ID.String(), After: policy}, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 	return policy, nil
 }
 
-func (s *PolicyService) UpdateSignInPolicy(tenantID uuid.UUID, policy *models.SignInPolicy) (*models.SignInPolicy, error) {
+func (s *PolicyService) UpdateSignInPolicy(tenantID uuid.UUID, policy *models.SignInPolicy, actor Actor) (*models.SignInPolicy, error) {
+	if err := validatePolicyTree(&policy.RootNode); err != nil {
+		return nil, err
+	}
+	if err := s.validateIdentities(tenantID, &policy.RootNode); err != nil {
+		return nil, err
+	}
 	policy.TenantID = tenantID
 
-	// 1. Get the old policy to find the root node
-	var oldPolicy models.SignInPolicy
-	if err := s.db.First(&oldPolicy, "id = ?", policy.ID).Error; err == nil {
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		ts := s.withDB(tx)
+
+		// 1. Get the old policy to find the root node
+		oldPolicy, err := ts.loadSignInPolicy(tenantID, policy.ID)
+		if err != nil {
+			return nil, errors.New("policy not found")
+		}
 		// 2. Delete the old tree recursively
-		s.DeleteNodeRecursive(oldPolicy.RootNodeID)
-	}
+		ts.DeleteNodeRecursive(oldPolicy.RootNodeID)
 
-	s.setTenantIDOnTree(tenantID, &policy.RootNode)
+		ts.setTenantIDOnTree(tenantID, &policy.RootNode)
 
-	// 3. Clear IDs in the new tree to force recreation (this is safer than trying to reconcile)
-	s.clearIDsRecursive(&policy.RootNode)
+		// 3. Clear IDs in the new tree to force recreation (this is safer than trying to reconcile)
+		ts.clearIDsRecursive(&policy.RootNode)
 
-	if err := s.db.Session(&gorm.Session{FullSaveAssociations: true}).Save(policy).Error; err != nil {
+		if err := tx.Session(&gorm.Session{FullSaveAssociations: true}).Save(policy).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "sign_in_policy.update", ResourceType: "sign_in_policy", ResourceID: policy.ID.String(), Before: oldPolicy, After: policy}, nil
+	})
+	if err != nil {
 		return nil, err
 	}
 	return policy, nil
@@ -259,6 +442,173 @@ func (s *PolicyService) DeleteNodeRecursive(nodeID uuid.UUID) error {
 	return s.db.Delete(&node).Error
 }
 
+// validateDestination checks destinations that need a specific format.
+func validateDestination(policy *models.AccessPolicy) error {
+	switch policy.DestinationType {
+	case "app":
+		if policy.DestinationAppID == nil {
+			return errors.New("destination_app_id is required")
+		}
+		return nil
+	case "app_tag":
+		policy.DestinationAppTag = strings.TrimSpace(policy.DestinationAppTag)
+		if policy.DestinationAppTag == "" {
+			return errors.New("destination_app_tag is required")
+		}
+		return nil
+	case "fqdn":
+		names := fqdn.Split(policy.DestinationFQDN)
+		if len(names) == 0 {
+			return errors.New("destination_fqdn is required")
+		}
+		for _, name := range names {
+			if err := fqdn.Validate(name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validatePolicyTree checks conditions that the gateways and auth-api must be able to evaluate.
+func validatePolicyTree(node *models.PolicyNode) error {
+	if err := validatePolicyConditions(node); err != nil {
+		return err
+	}
+	if node == nil || !hasTimeCondition(node) {
+		return nil
+	}
+	// Gateways apply time conditions to the whole policy, all of them at once
+	if !timeConditionsUnderAND(node) {
+		return errors.New("time conditions must apply to the whole policy: put them in the top-level AND group, not under OR")
+	}
+	if len(flattenPolicyNode(*node)) == 0 {
+		return errors.New("time conditions need a user, group or device OS condition to apply to")
+	}
+	return nil
+}
+
+func hasTimeCondition(node *models.PolicyNode) bool {
+	if node.Condition != nil {
+		return node.Condition.Type == "Time"
+	}
+	for i := range node.Children {
+		if hasTimeCondition(&node.Children[i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// timeConditionsUnderAND reports whether every time condition is reached
+// through AND groups (or OR groups with a single child) only.
+func timeConditionsUnderAND(node *models.PolicyNode) bool {
+	if node.Condition != nil {
+		return true
+	}
+	if node.Operator == "OR" && len(node.Children) > 1 {
+		for i := range node.Children {
+			if hasTimeCondition(&node.Children[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	for i := range node.Children {
+		if !timeConditionsUnderAND(&node.Children[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// validatePolicyConditions checks each condition of the tree.
+func validatePolicyConditions(node *models.PolicyNode) error {
+	if node == nil {
+		return nil
+	}
+	if c := node.Condition; c != nil && c.Type == "Time" {
+		cond := schedule.Condition{Field: c.Field, Op: c.Op, Value: c.Value, Timezone: c.Timezone}
+		if err := cond.Validate(); err != nil {
+			return fmt.Errorf("invalid time condition: %w", err)
+		}
+	}
+	if c := node.Condition; c != nil && c.Type == "Device" && posture.IsPostureField(c.Field) {
+		cond := posture.Condition{Field: c.Field, Op: c.Op, Value: c.Value}
+		if err := cond.Validate(); err != nil {
+			return fmt.Errorf("invalid device condition: %w", err)
+		}
+	}
+	for i := range node.Children {
+		if err := validatePolicyConditions(&node.Children[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateIdentities checks that users and groups named by the policy exist
+// in the tenant's directory. Tenants without a directory are not checked.
+func (s *PolicyService) validateIdentities(tenantID uuid.UUID, node *models.PolicyNode) error {
+	var emails, groups []string
+	collectIdentities(node, &emails, &groups)
+	if len(emails) == 0 && len(groups) == 0 {
+		return nil
+	}
+
+	directoryService := NewDirectoryService(s.db, s.cache)
+	hasDirectory, err := directoryService.HasDirectory(tenantID)
+	if err != nil || !hasDirectory {
+		return err
+	}
+	unknownEmails, unknownGroups, err := directoryService.UnknownIdentities(tenantID, emails, groups)
+	if err != nil {
+		return err
+	}
+	if len(unknownGroups) > 0 {
+		return fmt.Errorf("unknown group: %s", strings.Join(unknownGroups, ", "))
+	}
+	if len(unknownEmails) > 0 {
+		return fmt.Errorf("unknown user: %s", strings.Join(unknownEmails, ", "))
+	}
+	return nil
+}
+
+// collectIdentities gathers the exact emails and group names the tree matches.
+func collectIdentities(node *models.PolicyNode, emails, groups *[]string) {
+	if node == nil {
+		return
+	}
+	if c := node.Condition; c != nil && (c.Type == "User" || c.Type == "Group") {
+		var values []string
+		switch strings.ToLower(c.Op) {
+		case "equals", "is", "not_equals", "not":
+			values = []string{c.Value}
+		case "in", "not_in":
+			values = strings.Split(c.Value, ",")
+		}
+		field := strings.ToLower(c.Field)
+		if c.Type == "Group" {
+			field = "group"
+		}
+		for _, v := range values {
+			v = strings.Trim(strings.TrimSpace(v), "[]\"")
+			if v == "" {
+				continue
+			}
+			switch field {
+			case "email", "user_email":
+				*emails = append(*emails, v)
+			case "group", "user_group":
+				*groups = append(*groups, strings.TrimPrefix(v, "group:"))
+			}
+		}
+	}
+	for i := range node.Children {
+		collectIdentities(&node.Children[i], emails, groups)
+	}
+}
+
 func (s *PolicyService) setTenantIDOnTree(tenantID uuid.UUID, node *models.PolicyNode) {
 	if node == nil {
 		return
@@ -272,21 +622,20 @@ func (s *PolicyService) setTenantIDOnTree(tenantID uuid.UUID, node *models.Polic
 	}
 }
 
-func (s *PolicyService) DeleteSignInPolicy(tenantID uuid.UUID, policyID uuid.UUID) error {
-	var policy models.SignInPolicy
-	if err := s.db.Scopes(models.TenantScope(tenantID)).First(&policy, "id = ?", policyID).Error; err != nil {
-		return err
-	}
+func (s *PolicyService) DeleteSignInPolicy(tenantID uuid.UUID, policyID uuid.UUID, actor Actor) error {
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		ts := s.withDB(tx)
+		policy, err := ts.loadSignInPolicy(tenantID, policyID)
+		if err != nil {
+			return nil, errors.New("policy not found")
+		}
 
-	// Delete root node and tree
-	s.DeleteNodeRecursive(policy.RootNodeID)
+		// Delete root node and tree
+		ts.DeleteNodeRecursive(policy.RootNodeID)
 
-	result := s.db.Scopes(models.TenantScope(tenantID)).Delete(&models.SignInPolicy{}, "id = ?", policyID)
-	if result.Error != nil {
-		return result.Error
-	}
-	if result.RowsAffected == 0 {
-		return errors.New("policy not found")
-	}
-	return nil
+		if err := tx.Delete(&models.SignInPolicy{}, "id = ?", policyID).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "sign_in_policy.delete", ResourceType: "sign_in_policy", ResourceID: policyID.String(), Before: policy}, nil
+	})
 }
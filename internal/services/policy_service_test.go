@@ -0,0 +1,60 @@
+package services
+
+import (
+	"strings"
+	"testing"
+	"tridorian-ztna/internal/models"
+)
+
+func leaf(typ, field, op, value string) models.PolicyNode {
+	return models.PolicyNode{Condition: &models.PolicyCondition{Type: typ, Field: field, Op: op, Value: value}}
+}
+
+func group(op string, children ...models.PolicyNode) models.PolicyNode {
+	return models.PolicyNode{Operator: op, Children: children}
+}
+
+func TestValidatePolicyTree(t *testing.T) {
+	user := leaf("User", "email", "equals", "jane@acme.com")
+	admins := leaf("Group", "group", "equals", "admins")
+	hours := leaf("Time", "time_of_day", "between", "09:00-18:00")
+	weekdays := leaf("Time", "weekday", "in", "mon-fri")
+
+	tests := []struct {
+		name    string
+		tree    models.PolicyNode
+		wantErr string
+	}{
+		{name: "no time conditions", tree: group("OR", user, admins)},
+		{name: "time next to an identity", tree: group("AND", admins, hours)},
+		{name: "several time conditions", tree: group("AND", hours, weekdays, user)},
+		{name: "time beside an OR of identities", tree: group("AND", hours, group("OR", user, admins))},
+		{name: "nested AND groups", tree: group("AND", group("AND", user, hours), weekdays)},
+		{name: "OR with a single child", tree: group("OR", group("AND", user, hours))},
+
+		{name: "time as an alternative", tree: group("OR", user, hours), wantErr: "not under OR"},
+		{name: "time inside an OR branch", tree: group("AND", user, group("OR", group("AND", admins, hours), user)), wantErr: "not under OR"},
+		{name: "time alone", tree: group("AND", hours, weekdays), wantErr: "need a user, group or device OS condition"},
+		{name: "time with a network condition only", tree: group("AND", hours, leaf("Network", "ip", "cidr", "10.0.0.0/8")), wantErr: "need a user, group or device OS condition"},
+		{name: "invalid time value", tree: group("AND", user, leaf("Time", "time_of_day", "between", "9-5")), wantErr: "invalid time condition"},
+		{name: "unknown time field", tree: group("AND", user, leaf("Time", "month", "in", "3")), wantErr: "invalid time condition"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePolicyTree(&tt.tree)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validatePolicyTree: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validatePolicyTree error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if err := validatePolicyTree(nil); err != nil {
+		t.Fatalf("validatePolicyTree(nil): %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"tridorian-ztna/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// handoffTTL bounds the time between the browser callback and the
+	// client exchanging its code.
+	handoffTTL = 2 * time.Minute
+	// RefreshTokenLifetime is how long a desktop sign-in can be renewed
+	// before the user must go through the browser again.
+	RefreshTokenLifetime = 30 * 24 * time.Hour
+	// SessionRevocationWindow is how long gateways are told about a session
+	// revocation. It outlives any target token issued before it.
+	SessionRevocationWindow = 3 * time.Hour
+)
+
+var (
+	// ErrInvalidGrant is returned for unknown, expired or mismatched codes and refresh tokens.
+	ErrInvalidGrant = errors.New("invalid or expired grant")
+	// ErrRefreshTokenReused is returned when a rotated refresh token is presented
+	// again; the whole family is revoked.
+	ErrRefreshTokenReused = errors.New("refresh token was already used; sign in again")
+)
+
+// SessionService hands signed-in users over to the desktop client and
+// renews their target tokens.
+type SessionService struct {
+	db    *gorm.DB
+	cache *redis.Client
+}
+
+func NewSessionService(db *gorm.DB, cache *redis.Client) *SessionService {
+	return &SessionService{db: db, cache: cache}
+}
+
+// Handoff is a completed browser sign-in waiting for the desktop client to
+// exchange its one-time code.
+type Handoff struct {
+	Challenge string   `json:"challenge"` // S256 PKCE challenge sent by the client
+	Subject   string   `json:"subject"`
+	Email     string   `json:"email"`
+	Name      string   `json:"name"`
+	Groups    []string `json:"groups,omitempty"`
+	OS        string   `json:"os,omitempty"`
+	DeviceID  string   `json:"device_id,omitempty"`
+}
+
+// CreateHandoff stores a sign-in and returns the one-time code for the client.
+func (s *SessionService) CreateHandoff(tenantID uuid.UUID, h *Handoff) (string, error) {
+	if s.cache == nil {
+		return "", errors.New("cache not available")
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	key := fmt.Sprintf("auth:handoff:%s:%s", tenantID, code)
+	if err := s.cache.Set(context.Background(), key, data, handoffTTL).Err(); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// RedeemHandoff loads and deletes a sign-in, checking the client's PKCE verifier.
+func (s *SessionService) RedeemHandoff(tenantID uuid.UUID, code, verifier string) (*Handoff, error) {
+	if s.cache == nil {
+		return nil, errors.New("cache not available")
+	}
+	if code == "" || verifier == "" {
+		return nil, ErrInvalidGrant
+	}
+
+	key := fmt.Sprintf("auth:handoff:%s:%s", tenantID, code)
+	data, err := s.cache.GetDel(context.Background(), key).Result()
+	if err != nil {
+		return nil, ErrInvalidGrant
+	}
+
+	var h Handoff
+	if err := json.Unmarshal([]byte(data), &h); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(h.Challenge)) != 1 {
+		return nil, ErrInvalidGrant
+	}
+	return &h, nil
+}
+
+// IssueRefreshToken starts a refresh token family for a sign-in.
+func (s *SessionService) IssueRefreshToken(tenantID uuid.UUID, h *Handoff) (string, error) {
+	rt := &models.RefreshToken{
+		FamilyID:  uuid.New(),
+		Subject:   h.Subject,
+		Email:     h.Email,
+		Name:      h.Name,
+		Groups:    h.Groups,
+		OS:        h.OS,
+		DeviceID:  h.DeviceID,
+		ExpiresAt: time.Now().Add(RefreshTokenLifetime),
+	}
+	rt.TenantID = tenantID
+	return s.createRefreshToken(s.db, rt)
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same
+// family and returns the used token's record. Reusing a rotated token
+// revokes the family.
+func (s *SessionService) RotateRefreshToken(tenantID uuid.UUID, token string) (*models.RefreshToken, string, error) {
+	var used models.RefreshToken
+	var next string
+	reused := false
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(models.TenantScope(tenantID)).
+			Where("token_hash = ?", hashToken(token)).
+			First(&used).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidGrant
+			}
+			return err
+		}
+		if used.RevokedAt != nil || time.Now().After(used.ExpiresAt) {
+			return ErrInvalidGrant
+		}
+
+		now := time.Now()
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", used.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		rt := &models.RefreshToken{
+			FamilyID:  used.FamilyID,
+			Subject:   used.Subject,
+			Email:     used.Email,
+			Name:      used.Name,
+			Groups:    used.Groups,
+			OS:        used.OS,
+			DeviceID:  used.DeviceID,
+			ExpiresAt: used.ExpiresAt,
+		}
+		rt.TenantID = tenantID
+		var err error
+		next, err = s.createRefreshToken(tx, rt)
+		return err
+	})
+	if reused {
+		// Outside the rolled back transaction, so the revocation sticks
+		if err := s.RevokeFamily(tenantID, used.FamilyID); err != nil {
+			return nil, "", err
+		}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &used, next, nil
+}
+
+// RevokeRefreshToken revokes the family of a refresh token, used on sign-out.
+func (s *SessionService) RevokeRefreshToken(tenantID uuid.UUID, token string) error {
+	var rt models.RefreshToken
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Where("token_hash = ?", hashToken(token)).
+		First(&rt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return s.RevokeFamily(tenantID, rt.FamilyID)
+}
+
+// RevokeFamily revokes every token of a sign-in.
+func (s *SessionService) RevokeFamily(tenantID uuid.UUID, familyID uuid.UUID) error {
+	return s.db.Scopes(models.TenantScope(tenantID)).
+		Model(&models.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions ends a user's VPN sessions. Without a node it also
+// revokes the user's refresh tokens, so the client must sign in again; on a
+// single node the client may reconnect there with a freshly issued token.
+func (s *SessionService) RevokeUserSessions(tenantID uuid.UUID, email string, nodeID *uuid.UUID, actor Actor) (*models.SessionRevocation, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if email == "" {
+		return nil, errors.New("email is required")
+	}
+
+	revocation := &models.SessionRevocation{
+		BaseTenant: models.BaseTenant{TenantID: tenantID},
+		Email:      email,
+		NodeID:     nodeID,
+		RevokedAt:  time.Now(),
+	}
+	if actor.ID != nil {
+		revocation.RevokedBy = *actor.ID
+	}
+	err := audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if nodeID != nil {
+			var node models.Node
+			if err := tx.Scopes(models.TenantScope(tenantID)).Select("id").First(&node, "id = ?", *nodeID).Error; err != nil {
+				return nil, errors.New("node not found")
+			}
+		} else if err := tx.Scopes(models.TenantScope(tenantID)).
+			Model(&models.RefreshToken{}).
+			Where("LOWER(email) = ? AND revoked_at IS NULL", email).
+			Update("revoked_at", revocation.RevokedAt).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Create(revocation).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "session.revoke", ResourceType: "session_revocation", ResourceID: revocation.ID.String(), After: revocation}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revocation, nil
+}
+
+// ListSessionRevocations returns, for the recent revocations that apply to a
+// node, the latest revocation time of each user as Unix seconds.
+func (s *SessionService) ListSessionRevocations(tenantID uuid.UUID, nodeID uuid.UUID) (map[string]int64, error) {
+	var revocations []models.SessionRevocation
+	if err := s.db.Scopes(models.TenantScope(tenantID)).
+		Where("revoked_at > ? AND (node_id IS NULL OR node_id = ?)", time.Now().Add(-SessionRevocationWindow), nodeID).
+		Find(&revocations).Error; err != nil {
+		return nil, err
+	}
+
+	revoked := make(map[string]int64, len(revocations))
+	for _, r := range revocations {
+		if at := r.RevokedAt.Unix(); at > revoked[r.Email] {
+			revoked[r.Email] = at
+		}
+	}
+	return revoked, nil
+}
+
+func (s *SessionService) createRefreshToken(tx *gorm.DB, rt *models.RefreshToken) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+	rt.TokenHash = hashToken(token)
+	if err := tx.Create(rt).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// randomToken returns 32 random bytes, URL-safe encoded.
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,161 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"sort"
+
+	"tridorian-ztna/internal/models"
+	pb "tridorian-ztna/internal/proto/gateway/v1"
+)
+
+// UpdateSiteRouting records the subnets a gateway advertises, the address
+// of its peer tunnel and whether it is a connector when they change. Invalid
+// subnets are dropped, and so is a connector's address, which takes no
+// inbound connections.
+func (s *NodeService) UpdateSiteRouting(node *models.Node, routes []string, peerAddress string, connector bool) error {
+	routes = normalizeRoutes(routes)
+	if connector {
+		peerAddress = ""
+	}
+	if slices.Equal(routes, node.AdvertisedRoutes) && peerAddress == node.PeerAddress && connector == node.Connector {
+		return nil
+	}
+	node.AdvertisedRoutes = routes
+	node.PeerAddress = peerAddress
+	node.Connector = connector
+	// A struct update, so the routes go through their JSON serializer
+	return s.db.Model(&models.Node{}).Where("id = ?", node.ID).Select("advertised_routes", "peer_address", "connector").Updates(&models.Node{
+		AdvertisedRoutes: routes,
+		PeerAddress:      peerAddress,
+		Connector:        connector,
+	}).Error
+}
+
+// ListPeers returns the tenant's other gateways for a node's config, with
+// the subnets the node relays to each. A subnet the node reaches itself is
+// not relayed. A subnet several gateways advertise is served by one that is
+// connected, the first by name among those. A connector gets the gateways it
+// opens tunnels to, and relays nothing.
+func (s *NodeService) ListPeers(node *models.Node) ([]*pb.GetConfigResponse_Peer, error) {
+	query := s.db.Scopes(models.TenantScope(node.TenantID)).
+		Preload("GatewayGroup").
+		Where("id <> ? AND is_active = ?", node.ID, true)
+	if node.Connector {
+		query = query.Where("peer_address <> '' AND connector = ?", false)
+	} else {
+		query = query.Where("(peer_address <> '' OR connector = ?)", true)
+	}
+	var nodes []models.Node
+	if err := query.Order("name asc, id asc").Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+
+	var own []netip.Prefix
+	for _, r := range node.AdvertisedRoutes {
+		if prefix, err := netip.ParsePrefix(r); err == nil {
+			own = append(own, prefix)
+		}
+	}
+
+	type server struct {
+		index int
+		live  bool
+	}
+	servers := make(map[string]server)
+	for i := range nodes {
+		if node.Connector {
+			break
+		}
+		live := s.isLive(nodes[i].ID.String())
+		for _, r := range nodes[i].AdvertisedRoutes {
+			prefix, err := netip.ParsePrefix(r)
+			if err != nil || coveredBy(own, prefix) {
+				continue
+			}
+			if current, ok := servers[r]; ok && (current.live || !live) {
+				continue
+			}
+			servers[r] = server{index: i, live: live}
+		}
+	}
+
+	routes := make(map[int][]string)
+	for r, srv := range servers {
+		routes[srv.index] = append(routes[srv.index], r)
+	}
+
+	var peers []*pb.GetConfigResponse_Peer
+	for i, n := range nodes {
+		address := peerAddress(&n)
+		if address == "" && !n.Connector {
+			continue
+		}
+		sort.Strings(routes[i])
+		peers = append(peers, &pb.GetConfigResponse_Peer{
+			NodeId:     n.ID.String(),
+			Address:    address,
+			Routes:     routes[i],
+			ClientPool: n.ClientPool(),
+			CertSerial: n.CertSerial,
+		})
+	}
+	return peers, nil
+}
+
+// isLive reports whether a gateway has sent a heartbeat recently. Without
+// the cache every gateway counts as connected.
+func (s *NodeService) isLive(nodeID string) bool {
+	if s.cache == nil {
+		return true
+	}
+	exists, _ := s.cache.Exists(context.Background(), fmt.Sprintf("node:liveness:%s", nodeID)).Result()
+	return exists > 0
+}
+
+// peerAddress is where other gateways reach a node's peer tunnel. A
+// reported address without a host uses the node's public address.
+func peerAddress(node *models.Node) string {
+	if node.Connector {
+		return ""
+	}
+	host, port, err := net.SplitHostPort(node.PeerAddress)
+	if err != nil {
+		return ""
+	}
+	if host == "" {
+		host = node.IPAddress
+	}
+	if host == "" {
+		return ""
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// normalizeRoutes masks valid IPv4 subnets, drops duplicates and the
+// rest, and sorts them.
+func normalizeRoutes(routes []string) []string {
+	var normalized []string
+	for _, r := range routes {
+		prefix, err := netip.ParsePrefix(r)
+		if err != nil || !prefix.Addr().Is4() {
+			continue
+		}
+		normalized = append(normalized, prefix.Masked().String())
+	}
+	sort.Strings(normalized)
+	return slices.Compact(normalized)
+}
+
+// coveredBy reports whether one of the prefixes contains all of p.
+func coveredBy(prefixes []netip.Prefix, p netip.Prefix) bool {
+	for _, own := range prefixes {
+		if own.Bits() <= p.Bits() && own.Contains(p.Addr()) {
+			return true
+		}
+	}
+	return false
+}
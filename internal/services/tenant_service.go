@@ -5,10 +5,12 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/netip"
 	"strings"
 	"time"
 	"tridorian-ztna/internal/models"
 	"tridorian-ztna/pkg/encryption"
+	"tridorian-ztna/pkg/fqdn"
 	"tridorian-ztna/pkg/utils"
 
 	"github.com/google/uuid"
@@ -80,34 +82,42 @@ func (s *TenantService) ResolveTenantByHost(host string) (*models.Tenant, error)
 
 // ActivateDomain sets the primary domain for a tenant.
 // The domain must be either the free domain or a verified custom domain.
-func (s *TenantService) ActivateDomain(tenantID uuid.UUID, domain string) error {
+func (s *TenantService) ActivateDomain(tenantID uuid.UUID, domain string, actor Actor) error {
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		return s.activateDomain(tx, tenantID, domain)
+	})
+}
+
+func (s *TenantService) activateDomain(tx *gorm.DB, tenantID uuid.UUID, domain string) (*AuditChange, error) {
 	domain = strings.ToLower(strings.TrimSpace(domain))
 	var tenant models.Tenant
-	if err := s.db.First(&tenant, "id = ?", tenantID).Error; err != nil {
-		return err
+	if err := tx.First(&tenant, "id = ?", tenantID).Error; err != nil {
+		return nil, err
 	}
+	before := tenant
 
 	// Validate: Is it the free domain?
 	freeDomain := strings.ToLower(fmt.Sprintf("%s%s", tenant.Slug, s.freeDomainSuffix))
 	if domain == freeDomain {
-		tenant.PrimaryDomain = domain
 		log.Printf("🔹 Activating free domain: %s for tenant: %s", domain, tenant.Name)
-		return s.db.Save(&tenant).Error
-	}
-
-	// Validate: Is it a verified custom domain?
-	var customDomain models.CustomDomain
-	// Use case-sensitive match but input is lowercased.
-	// Domains should generally be stored lowercased.
-	err := s.db.Where("tenant_id = ? AND LOWER(domain) = ? AND is_verified = ?", tenantID, domain, true).First(&customDomain).Error
-	if err != nil {
-		log.Printf("❌ Domain activation failed: %s not found or not verified for tenant %s", domain, tenant.Name)
-		return errors.New("domain is not verified or does not belong to this tenant")
+	} else {
+		// Validate: Is it a verified custom domain?
+		var customDomain models.CustomDomain
+		// Use case-sensitive match but input is lowercased.
+		// Domains should generally be stored lowercased.
+		err := tx.Where("tenant_id = ? AND LOWER(domain) = ? AND is_verified = ?", tenantID, domain, true).First(&customDomain).Error
+		if err != nil {
+			log.Printf("❌ Domain activation failed: %s not found or not verified for tenant %s", domain, tenant.Name)
+			return nil, errors.New("domain is not verified or does not belong to this tenant")
+		}
+		log.Printf("✅ Activating custom domain: %s for tenant: %s", domain, tenant.Name)
 	}
 
 	tenant.PrimaryDomain = domain
-	log.Printf("✅ Activating custom domain: %s for tenant: %s", domain, tenant.Name)
-	return s.db.Save(&tenant).Error
+	if err := tx.Save(&tenant).Error; err != nil {
+		return nil, err
+	}
+	return &AuditChange{Action: "tenant.domain.activate", ResourceType: "tenant", ResourceID: tenantID.String(), Before: before, After: tenant}, nil
 }
 
 // GetTenantByID retrieves a tenant by its ID.
@@ -122,7 +132,7 @@ func (s *TenantService) GetTenantByID(id uuid.UUID) (*models.Tenant, error) {
 
 // CreateTenantWithAdmin creates a new tenant and its first local administrator.
 // Returns the tenant, administrator, and the plaintext password (for one-time display).
-func (s *TenantService) CreateTenantWithAdmin(name, adminEmail, adminPassword string) (*models.Tenant, *models.Administrator, string, error) {
+func (s *TenantService) CreateTenantWithAdmin(name, adminEmail, adminPassword string, actor Actor) (*models.Tenant, *models.Administrator, string, error) {
 	baseSlug := utils.GenerateSlug(name)
 
 	// Rule 1: If slug is empty (e.g. non-English name), generate random 12 chars
@@ -163,7 +173,9 @@ func (s *TenantService) CreateTenantWithAdmin(name, adminEmail, adminPassword st
 			adminEmail = "admin@" + slug + s.freeDomainSuffix
 		}
 		if adminPassword == "" {
-			adminPassword = utils.GenerateRandomPassword(12)
+			adminPassword = utils.DefaultPasswordPolicy.Generate()
+		} else if err := utils.DefaultPasswordPolicy.Validate(adminPassword, adminEmail); err != nil {
+			return err
 		}
 
 		if err := tx.Create(&tenant).Error; err != nil {
@@ -183,6 +195,7 @@ func (s *TenantService) CreateTenantWithAdmin(name, adminEmail, adminPassword st
 			Email:                  adminEmail,
 			Role:                   models.RoleSuperAdmin,
 			ChangePasswordRequired: true,
+			BreakGlass:             true, // Keeps a way in if single sign-on is set up later and breaks
 		}
 		if err := admin.SetPassword(adminPassword); err != nil {
 			return err
@@ -192,7 +205,10 @@ func (s *TenantService) CreateTenantWithAdmin(name, adminEmail, adminPassword st
 			return err
 		}
 
-		return nil
+		if err := recordAudit(tx, tenant.ID, actor, &AuditChange{Action: "tenant.create", ResourceType: "tenant", ResourceID: tenant.ID.String(), After: tenant}); err != nil {
+			return err
+		}
+		return recordAudit(tx, tenant.ID, actor, &AuditChange{Action: "administrator.create", ResourceType: "administrator", ResourceID: admin.ID.String(), After: admin})
 	})
 
 	if err != nil {
@@ -202,13 +218,30 @@ func (s *TenantService) CreateTenantWithAdmin(name, adminEmail, adminPassword st
 	return &tenant, &admin, adminPassword, nil
 }
 
+// updateTenant applies updates to the tenant and records them as action.
+func (s *TenantService) updateTenant(id uuid.UUID, action string, updates map[string]interface{}, actor Actor) error {
+	return audited(s.db, id, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var before, after models.Tenant
+		if err := tx.First(&before, "id = ?", id).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.Model(&models.Tenant{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+		if err := tx.First(&after, "id = ?", id).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: action, ResourceType: "tenant", ResourceID: id.String(), Before: before, After: after}, nil
+	})
+}
+
 // UpdateTenant updates tenant basic info.
-func (s *TenantService) UpdateTenant(id uuid.UUID, name string) error {
-	return s.db.Model(&models.Tenant{}).Where("id = ?", id).Update("name", name).Error
+func (s *TenantService) UpdateTenant(id uuid.UUID, name string, actor Actor) error {
+	return s.updateTenant(id, "tenant.update", map[string]interface{}{"name": name}, actor)
 }
 
 // UpdateGoogleIdentity updates and encrypts Google Identity configuration
-func (s *TenantService) UpdateGoogleIdentity(id uuid.UUID, clientID, clientSecret, saKey, adminEmail string) error {
+func (s *TenantService) UpdateGoogleIdentity(id uuid.UUID, clientID, clientSecret, saKey, adminEmail string, actor Actor) error {
 	secret, err := encryption.EncryptString(clientSecret, s.masterKey)
 	if err != nil {
 		return err
@@ -218,12 +251,92 @@ func (s *TenantService) UpdateGoogleIdentity(id uuid.UUID, clientID, clientSecre
 		return err
 	}
 
-	return s.db.Model(&models.Tenant{}).Where("id = ?", id).Updates(map[string]interface{}{
+	return s.updateTenant(id, "tenant.identity.update", map[string]interface{}{
 		"google_client_id":           clientID,
 		"google_client_secret":       secret,
 		"google_service_account_key": key,
 		"google_admin_email":         adminEmail,
-	}).Error
+	}, actor)
+}
+
+// UpdateDNSSettings validates and stores the tenant's split DNS configuration.
+// Gateways pick it up through their config hash on the next heartbeat.
+func (s *TenantService) UpdateDNSSettings(id uuid.UUID, domains, resolvers, searchSuffixes []string, actor Actor) error {
+	for _, d := range append(append([]string{}, domains...), searchSuffixes...) {
+		if err := fqdn.Validate(d); err != nil || fqdn.IsWildcard(fqdn.Normalize(d)) {
+			return fmt.Errorf("invalid domain %q", d)
+		}
+	}
+	if len(domains) > 0 && len(resolvers) == 0 {
+		return errors.New("at least one resolver is required for internal domains")
+	}
+	for _, r := range resolvers {
+		if _, err := netip.ParseAddr(r); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddrPort(r); err != nil {
+			return fmt.Errorf("invalid resolver %q: expected IP or IP:port", r)
+		}
+	}
+
+	return s.updateTenant(id, "tenant.dns.update", map[string]interface{}{
+		"dns_domains":         strings.Join(normalizeDomains(domains), ","),
+		"dns_resolvers":       strings.Join(resolvers, ","),
+		"dns_search_suffixes": strings.Join(normalizeDomains(searchSuffixes), ","),
+	}, actor)
+}
+
+func normalizeDomains(domains []string) []string {
+	var out []string
+	for _, d := range domains {
+		if d = fqdn.Normalize(d); d != "" {
+			out = append(out, d)
+		}
+	}
+	return out
+}
+
+// SecuritySettings is a partial update of a tenant's sign-in rules; nil
+// fields are left unchanged.
+type SecuritySettings struct {
+	RequireAdminMFA           *bool `json:"require_admin_mfa"`
+	PasswordMinLength         *int  `json:"password_min_length"`
+	PasswordRequireComplexity *bool `json:"password_require_complexity"`
+	GatewayHardwareApproval   *bool `json:"gateway_hardware_approval"`
+	RequireDevicePosture      *bool `json:"require_device_posture"`
+	DeviceApproval            *bool `json:"device_approval"`
+}
+
+// UpdateSecuritySettings sets whether administrators must use a second factor,
+// the policy their passwords must meet, whether gateway hardware changes
+// wait for approval and what VPN sign-ins need from the device.
+func (s *TenantService) UpdateSecuritySettings(id uuid.UUID, settings SecuritySettings, actor Actor) error {
+	updates := map[string]interface{}{}
+	if settings.RequireAdminMFA != nil {
+		updates["require_admin_mfa"] = *settings.RequireAdminMFA
+	}
+	if settings.PasswordMinLength != nil {
+		if *settings.PasswordMinLength < utils.MinPasswordLength || *settings.PasswordMinLength > 128 {
+			return fmt.Errorf("minimum password length must be between %d and 128", utils.MinPasswordLength)
+		}
+		updates["password_min_length"] = *settings.PasswordMinLength
+	}
+	if settings.PasswordRequireComplexity != nil {
+		updates["password_require_complexity"] = *settings.PasswordRequireComplexity
+	}
+	if settings.GatewayHardwareApproval != nil {
+		updates["gateway_hardware_approval"] = *settings.GatewayHardwareApproval
+	}
+	if settings.RequireDevicePosture != nil {
+		updates["require_device_posture"] = *settings.RequireDevicePosture
+	}
+	if settings.DeviceApproval != nil {
+		updates["device_approval"] = *settings.DeviceApproval
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return s.updateTenant(id, "tenant.security.update", updates, actor)
 }
 
 // DecryptTenantConfig decrypts sensitive fields of a tenant
@@ -244,7 +357,7 @@ func (s *TenantService) DecryptTenantConfig(tenant *models.Tenant) error {
 }
 
 // RegisterCustomDomain creates a record for a custom domain and generates a verification token.
-func (s *TenantService) RegisterCustomDomain(tenantID uuid.UUID, domain string) (*models.CustomDomain, error) {
+func (s *TenantService) RegisterCustomDomain(tenantID uuid.UUID, domain string, actor Actor) (*models.CustomDomain, error) {
 	tenant, err := s.GetTenantByID(tenantID)
 	if err != nil {
 		return nil, err
@@ -290,15 +403,20 @@ func (s *TenantService) RegisterCustomDomain(tenantID uuid.UUID, domain string)
 		IsVerified:        isVerified,
 	}
 
-	if err := s.db.Create(&customDomain).Error; err != nil {
+	err = audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		if err := tx.Create(&customDomain).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "custom_domain.create", ResourceType: "custom_domain", ResourceID: customDomain.ID.String(), After: customDomain}, nil
+	})
+	if err != nil {
 		return nil, err
 	}
-
 	return &customDomain, nil
 }
 
 // VerifyCustomDomain checks the DNS TXT records for the verification token.
-func (s *TenantService) VerifyCustomDomain(tenantID uuid.UUID, domainID uuid.UUID) error {
+func (s *TenantService) VerifyCustomDomain(tenantID uuid.UUID, domainID uuid.UUID, actor Actor) error {
 	var customDomain models.CustomDomain
 	if err := s.db.Where("id = ? AND tenant_id = ?", domainID, tenantID).First(&customDomain).Error; err != nil {
 		return errors.New("custom domain not found")
@@ -336,16 +454,52 @@ func (s *TenantService) VerifyCustomDomain(tenantID uuid.UUID, domainID uuid.UUI
 		return errors.New("verification token not found in DNS records")
 	}
 
+	before := customDomain
 	now := time.Now()
 	customDomain.IsVerified = true
 	customDomain.VerifiedAt = &now
 
-	if err := s.db.Save(&customDomain).Error; err != nil {
-		return err
-	}
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&customDomain).Error; err != nil {
+			return err
+		}
+		change := &AuditChange{Action: "custom_domain.verify", ResourceType: "custom_domain", ResourceID: domainID.String(), Before: before, After: customDomain}
+		if err := recordAudit(tx, tenantID, actor, change); err != nil {
+			return err
+		}
 
-	// NEW: Automatically make it the primary domain upon verification
-	return s.ActivateDomain(tenantID, customDomain.Domain)
+		// NEW: Automatically make it the primary domain upon verification
+		change, err := s.activateDomain(tx, tenantID, customDomain.Domain)
+		if err != nil {
+			return err
+		}
+		return recordAudit(tx, tenantID, actor, change)
+	})
+}
+
+// DeleteCustomDomain removes a custom domain. The primary domain cannot be
+// removed until another domain is activated.
+func (s *TenantService) DeleteCustomDomain(tenantID uuid.UUID, domain string, actor Actor) error {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	return audited(s.db, tenantID, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var tenant models.Tenant
+		if err := tx.First(&tenant, "id = ?", tenantID).Error; err != nil {
+			return nil, err
+		}
+		if strings.EqualFold(tenant.PrimaryDomain, domain) {
+			return nil, errors.New("cannot delete the primary domain: activate another domain first")
+		}
+
+		var customDomain models.CustomDomain
+		if err := tx.Where("tenant_id = ? AND LOWER(domain) = ?", tenantID, domain).First(&customDomain).Error; err != nil {
+			return nil, errors.New("custom domain not found")
+		}
+		// Deleted for good, so that the domain can be registered again
+		if err := tx.Unscoped().Delete(&customDomain).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "custom_domain.delete", ResourceType: "custom_domain", ResourceID: customDomain.ID.String(), Before: customDomain}, nil
+	})
 }
 
 // ListDomains returns a list of all verified domains (including free domain) for a tenant.
@@ -373,16 +527,25 @@ func (s *TenantService) ListDomains(tenantID uuid.UUID) ([]string, error) {
 	return domains, nil
 }
 
-func (s *TenantService) DeleteTenant(id uuid.UUID) error {
-	return s.db.Transaction(func(tx *gorm.DB) error {
+// DeleteTenant removes a tenant. Its audit log is kept.
+func (s *TenantService) DeleteTenant(id uuid.UUID, actor Actor) error {
+	return audited(s.db, id, actor, func(tx *gorm.DB) (*AuditChange, error) {
+		var tenant models.Tenant
+		if err := tx.First(&tenant, "id = ?", id).Error; err != nil {
+			return nil, err
+		}
+
 		// Delete related data first
 		if err := tx.Where("tenant_id = ?", id).Delete(&models.Administrator{}).Error; err != nil {
-			return err
+			return nil, err
 		}
 		if err := tx.Where("tenant_id = ?", id).Delete(&models.CustomDomain{}).Error; err != nil {
-			return err
+			return nil, err
 		}
 		// Finally delete tenant
-		return tx.Delete(&models.Tenant{}, "id = ?", id).Error
+		if err := tx.Delete(&tenant).Error; err != nil {
+			return nil, err
+		}
+		return &AuditChange{Action: "tenant.delete", ResourceType: "tenant", ResourceID: id.String(), Before: tenant}, nil
 	})
 }
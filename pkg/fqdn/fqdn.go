@@ -0,0 +1,77 @@
+package fqdn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Normalize lowercases a DNS name and strips the trailing root dot.
+func Normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(name)), ".")
+}
+
+// IsWildcard reports whether the pattern is of the form "*.example.com".
+func IsWildcard(pattern string) bool {
+	return strings.HasPrefix(pattern, "*.")
+}
+
+// Match reports whether name is covered by pattern. A wildcard pattern
+// "*.corp.internal" matches any name below corp.internal at any depth,
+// but not corp.internal itself. Other patterns must match exactly.
+func Match(pattern, name string) bool {
+	pattern = Normalize(pattern)
+	name = Normalize(name)
+	if pattern == "" || name == "" {
+		return false
+	}
+	if IsWildcard(pattern) {
+		return strings.HasSuffix(name, pattern[1:])
+	}
+	return pattern == name
+}
+
+// MatchAny reports whether name is covered by any of the patterns.
+func MatchAny(patterns []string, name string) bool {
+	for _, p := range patterns {
+		if Match(p, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Split parses a comma separated list of patterns into normalized entries.
+func Split(value string) []string {
+	var patterns []string
+	for _, p := range strings.Split(value, ",") {
+		if p = Normalize(p); p != "" {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// Validate checks that the pattern is a host name, optionally with a
+// single leading "*." label.
+func Validate(pattern string) error {
+	name := Normalize(pattern)
+	if IsWildcard(name) {
+		name = name[2:]
+	}
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("invalid domain %q", pattern)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("invalid domain %q", pattern)
+		}
+		for i, r := range label {
+			ok := r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' ||
+				r == '-' && i > 0 && i < len(label)-1
+			if !ok {
+				return fmt.Errorf("invalid domain %q", pattern)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package fqdn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"jira.example.com", "jira.example.com", true},
+		{"jira.example.com", "JIRA.Example.com.", true},
+		{"Jira.Example.Com.", " jira.example.com ", true},
+		{"jira.example.com", "wiki.example.com", false},
+		{"jira.example.com", "a.jira.example.com", false},
+		{"jira.example.com", "notjira.example.com", false},
+		{"*.corp.internal", "git.corp.internal", true},
+		{"*.corp.internal", "a.b.c.corp.internal", true},
+		{"*.corp.internal", "GIT.CORP.INTERNAL.", true},
+		{"*.corp.internal", "corp.internal", false},
+		{"*.corp.internal", "evilcorp.internal", false},
+		{"*.corp.internal", "corp.internal.evil.com", false},
+		{"", "jira.example.com", false},
+		{"jira.example.com", "", false},
+		{"*.", "example.com", false},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+
+	patterns := []string{"jira.example.com", "*.corp.internal"}
+	if !MatchAny(patterns, "git.corp.internal") || MatchAny(patterns, "example.com") || MatchAny(nil, "jira.example.com") {
+		t.Error("MatchAny does not match exactly the listed patterns")
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{" , ,", nil},
+		{"Jira.Example.com.", []string{"jira.example.com"}},
+		{"jira.example.com, *.Corp.Internal ,", []string{"jira.example.com", "*.corp.internal"}},
+	}
+	for _, tt := range tests {
+		if got := Split(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Split(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	label63 := strings.Repeat("a", 63)
+	tests := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"jira.example.com", true},
+		{"JIRA.example.com.", true},
+		{"*.corp.internal", true},
+		{"localhost", true},
+		{"_sip._tcp.example.com", true},
+		{"xn--bcher-kva.example", true},
+		{"a-b.example.com", true},
+		{label63 + ".example.com", true},
+		{strings.Repeat(label63+".", 3) + strings.Repeat("a", 61), true},
+
+		{"", false},
+		{".", false},
+		{"*.", false},
+		{"*", false},
+		{"*.*.example.com", false},
+		{"jira.*.example.com", false},
+		{"a*.example.com", false},
+		{"example..com", false},
+		{".example.com", false},
+		{"-a.example.com", false},
+		{"a-.example.com", false},
+		{"jira example.com", false},
+		{"jira.example.com/path", false},
+		{"10.0.0.1:443", false},
+		{"bücher.example", false},
+		{strings.Repeat("a", 64) + ".example.com", false},
+		{strings.Repeat(label63+".", 4), false},
+	}
+	for _, tt := range tests {
+		if err := Validate(tt.pattern); (err == nil) != tt.valid {
+			t.Errorf("Validate(%q) = %v, want valid %v", tt.pattern, err, tt.valid)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package idp implements the sign-in protocols used to authenticate VPN
+// users against a tenant's identity provider: Google, generic OpenID
+// Connect and SAML 2.0.
+package idp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Identity is the authenticated user as asserted by the identity provider.
+type Identity struct {
+	Subject string
+	Email   string
+	Name    string
+	Groups  []string
+}
+
+// Session holds the per-login values a provider needs back on the callback
+// (PKCE verifier, nonce, SAML request ID). The caller keeps it server-side
+// between Begin and Complete.
+type Session map[string]string
+
+// Provider is one sign-in protocol bound to a tenant's configuration.
+type Provider interface {
+	// Begin returns the URL the browser is redirected to. state is echoed
+	// back by the identity provider on the callback.
+	Begin(state string) (redirectURL string, session Session, err error)
+
+	// Complete validates the identity provider's response on the callback
+	// request and returns the authenticated user.
+	Complete(ctx context.Context, r *http.Request, session Session) (*Identity, error)
+}
+
+// randomID returns a random hex string of n bytes.
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SplitList splits a comma or space separated list, dropping empty entries.
+func SplitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\t'
+	})
+}
+
+// uniqueStrings drops empty and duplicate values, keeping the order.
+func uniqueStrings(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	var out []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,302 @@
+package idp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+)
+
+// discoveryTTL is how long a provider's discovery document is reused.
+const discoveryTTL = time.Hour
+
+// clockSkew is tolerated when checking token and assertion timestamps.
+const clockSkew = 2 * time.Minute
+
+// OIDCConfig configures sign-in with an OpenID Connect provider such as
+// Entra ID, Okta or Keycloak.
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // "openid" is always requested
+
+	// EmailClaim and GroupsClaim name the claims read from the id_token or
+	// userinfo. Nested claims use dots, e.g. "realm_access.roles".
+	// Defaults are "email" and "groups".
+	EmailClaim  string
+	GroupsClaim string
+
+	HTTPClient *http.Client
+}
+
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserInfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+
+	keys      *keySet
+	fetchedAt time.Time
+}
+
+var (
+	discoveryMu    sync.Mutex
+	discoveryCache = make(map[string]*oidcMetadata)
+)
+
+// OIDC signs users in with the authorization code flow, PKCE and a nonce,
+// and validates the id_token against the provider's published keys.
+type OIDC struct {
+	cfg   OIDCConfig
+	meta  *oidcMetadata
+	oauth *oauth2.Config
+}
+
+// NewOIDC loads the provider's discovery document (cached per issuer).
+func NewOIDC(ctx context.Context, cfg OIDCConfig) (*OIDC, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" {
+		return nil, errors.New("issuer URL and client ID are required")
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if cfg.EmailClaim == "" {
+		cfg.EmailClaim = "email"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+
+	meta, err := discover(ctx, cfg.HTTPClient, cfg.IssuerURL)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := []string{"openid"}
+	for _, s := range cfg.Scopes {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+	if len(cfg.Scopes) == 0 {
+		scopes = append(scopes, "email", "profile")
+	}
+
+	return &OIDC{
+		cfg:  cfg,
+		meta: meta,
+		oauth: &oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+			Endpoint: oauth2.Endpoint{
+				AuthURL:  meta.AuthorizationEndpoint,
+				TokenURL: meta.TokenEndpoint,
+			},
+		},
+	}, nil
+}
+
+func discover(ctx context.Context, client *http.Client, issuer string) (*oidcMetadata, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	discoveryMu.Lock()
+	defer discoveryMu.Unlock()
+	if meta, ok := discoveryCache[issuer]; ok && time.Since(meta.fetchedAt) < discoveryTTL {
+		return meta, nil
+	}
+
+	var meta oidcMetadata
+	if err := getJSON(ctx, client, issuer+"/.well-known/openid-configuration", &meta); err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("OIDC discovery returned issuer %q, expected %q", meta.Issuer, issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document is incomplete")
+	}
+
+	// Keep the cached keys if the key endpoint did not move
+	if old, ok := discoveryCache[issuer]; ok && old.JWKSURI == meta.JWKSURI {
+		meta.keys = old.keys
+	} else {
+		meta.keys = newKeySet(meta.JWKSURI, client)
+	}
+	meta.fetchedAt = time.Now()
+	discoveryCache[issuer] = &meta
+	return &meta, nil
+}
+
+func (o *OIDC) Begin(state string) (string, Session, error) {
+	verifier := oauth2.GenerateVerifier()
+	nonce := randomID(16)
+
+	url := o.oauth.AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	)
+	return url, Session{"code_verifier": verifier, "nonce": nonce}, nil
+}
+
+func (o *OIDC) Complete(ctx context.Context, r *http.Request, session Session) (*Identity, error) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		return nil, fmt.Errorf("identity provider returned %s: %s", e, query.Get("error_description"))
+	}
+	code := query.Get("code")
+	if code == "" {
+		return nil, errors.New("authorization code is missing")
+	}
+	if session["code_verifier"] == "" || session["nonce"] == "" {
+		return nil, errors.New("login session is incomplete")
+	}
+
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, o.cfg.HTTPClient)
+	tok, err := o.oauth.Exchange(ctx, code, oauth2.VerifierOption(session["code_verifier"]))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange token: %w", err)
+	}
+
+	rawIDToken, _ := tok.Extra("id_token").(string)
+	if rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	claims, err := o.verifyIDToken(ctx, rawIDToken, session["nonce"])
+	if err != nil {
+		return nil, err
+	}
+
+	// Some providers only release email or groups through userinfo
+	_, hasEmail := claimValue(claims, o.cfg.EmailClaim)
+	_, hasGroups := claimValue(claims, o.cfg.GroupsClaim)
+	if (!hasEmail || !hasGroups) && o.meta.UserInfoEndpoint != "" {
+		var info map[string]interface{}
+		client := o.oauth.Client(ctx, tok)
+		if err := getJSON(ctx, client, o.meta.UserInfoEndpoint, &info); err == nil && info["sub"] == claims["sub"] {
+			for k, v := range info {
+				if _, ok := claims[k]; !ok {
+					claims[k] = v
+				}
+			}
+		}
+	}
+
+	return o.identity(claims)
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce.
+func (o *OIDC) verifyIDToken(ctx context.Context, raw, nonce string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims,
+		func(t *jwt.Token) (interface{}, error) {
+			kid, _ := t.Header["kid"].(string)
+			return o.meta.keys.key(ctx, kid)
+		},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(o.meta.Issuer),
+		jwt.WithAudience(o.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(clockSkew),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if n, _ := claims["nonce"].(string); n != nonce {
+		return nil, errors.New("invalid id_token: nonce mismatch")
+	}
+	// With several audiences the token must have been issued to us
+	if aud, _ := claims.GetAudience(); len(aud) > 1 {
+		if azp, _ := claims["azp"].(string); azp != o.cfg.ClientID {
+			return nil, errors.New("invalid id_token: authorized party mismatch")
+		}
+	}
+	return claims, nil
+}
+
+func (o *OIDC) identity(claims jwt.MapClaims) (*Identity, error) {
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	if verified, ok := claims["email_verified"].(bool); ok && !verified {
+		return nil, errors.New("email address is not verified by the identity provider")
+	}
+
+	email := firstString(claimStrings(claims, o.cfg.EmailClaim))
+	if email == "" {
+		// Entra ID and Keycloak often carry the address as the user name
+		for _, c := range []string{"preferred_username", "upn"} {
+			if v := firstString(claimStrings(claims, c)); strings.Contains(v, "@") {
+				email = v
+				break
+			}
+		}
+	}
+	if email == "" {
+		return nil, fmt.Errorf("id_token has no %q claim", o.cfg.EmailClaim)
+	}
+
+	name, _ := claims["name"].(string)
+	return &Identity{
+		Subject: sub,
+		Email:   email,
+		Name:    name,
+		Groups:  uniqueStrings(claimStrings(claims, o.cfg.GroupsClaim)),
+	}, nil
+}
+
+// claimValue resolves a dotted claim path.
+func claimValue(claims map[string]interface{}, path string) (interface{}, bool) {
+	var cur interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// claimStrings returns a string or string array claim as a slice.
+func claimStrings(claims map[string]interface{}, path string) []string {
+	v, ok := claimValue(claims, path)
+	if !ok {
+		return nil
+	}
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func firstString(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,223 @@
+package idp
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testOIDCClient = "tridorian"
+
+// oidcIdP is a stand-in OpenID provider serving discovery, JWKS and a token
+// endpoint that hands out whatever id_token the test set last.
+type oidcIdP struct {
+	key    *rsa.PrivateKey
+	server *httptest.Server
+	issuer string // Issuer in the discovery document, the server URL unless set
+
+	mu      sync.Mutex
+	idToken string
+}
+
+func newOIDCIdP(t *testing.T, issuer string) *oidcIdP {
+	t.Helper()
+	p := &oidcIdP{key: testRSAKey(t)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.issuer,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "key1",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != "code" || r.PostFormValue("code_verifier") == "" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     p.idToken,
+		})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	p.issuer = p.server.URL
+	if issuer != "" {
+		p.issuer = issuer
+	}
+	return p
+}
+
+func (p *oidcIdP) setIDToken(t *testing.T, claims jwt.MapClaims, key *rsa.PrivateKey) {
+	t.Helper()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = "key1"
+	signed, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign id_token: %v", err)
+	}
+	p.mu.Lock()
+	p.idToken = signed
+	p.mu.Unlock()
+}
+
+func TestOIDCComplete(t *testing.T) {
+	idp := newOIDCIdP(t, "")
+	otherKey := testRSAKey(t)
+
+	tests := []struct {
+		name    string
+		modify  func(claims jwt.MapClaims)
+		key     *rsa.PrivateKey
+		wantErr string
+	}{
+		{name: "valid id_token"},
+		{name: "signed by another key", key: otherKey, wantErr: "invalid id_token"},
+		{name: "wrong nonce", modify: func(c jwt.MapClaims) { c["nonce"] = "replayed" }, wantErr: "nonce mismatch"},
+		{name: "no nonce", modify: func(c jwt.MapClaims) { delete(c, "nonce") }, wantErr: "nonce mismatch"},
+		{name: "wrong issuer", modify: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }, wantErr: "invalid id_token"},
+		{name: "wrong audience", modify: func(c jwt.MapClaims) { c["aud"] = "another-client" }, wantErr: "invalid id_token"},
+		{
+			name: "issued to another party",
+			modify: func(c jwt.MapClaims) {
+				c["aud"] = []string{testOIDCClient, "another-client"}
+				c["azp"] = "another-client"
+			},
+			wantErr: "authorized party mismatch",
+		},
+		{name: "expired", modify: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }, wantErr: "invalid id_token"},
+		{name: "no expiry", modify: func(c jwt.MapClaims) { delete(c, "exp") }, wantErr: "invalid id_token"},
+		{name: "unverified email", modify: func(c jwt.MapClaims) { c["email_verified"] = false }, wantErr: "not verified"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider, err := NewOIDC(context.Background(), OIDCConfig{
+				IssuerURL:    idp.server.URL,
+				ClientID:     testOIDCClient,
+				ClientSecret: "secret",
+				RedirectURL:  "https://auth.example.com/auth/callback",
+			})
+			if err != nil {
+				t.Fatalf("NewOIDC: %v", err)
+			}
+
+			authURL, session, err := provider.Begin("state")
+			if err != nil {
+				t.Fatalf("Begin: %v", err)
+			}
+			u, err := url.Parse(authURL)
+			if err != nil || !strings.HasPrefix(authURL, idp.server.URL+"/authorize") {
+				t.Fatalf("unexpected authorization URL %q", authURL)
+			}
+			if u.Query().Get("code_challenge") == "" {
+				t.Fatal("authorization URL has no PKCE challenge")
+			}
+
+			now := time.Now()
+			claims := jwt.MapClaims{
+				"iss":            idp.server.URL,
+				"aud":            testOIDCClient,
+				"sub":            "user-1",
+				"email":          "alice@example.com",
+				"email_verified": true,
+				"name":           "Alice",
+				"groups":         []string{"engineering", "engineering", "ops"},
+				"nonce":          u.Query().Get("nonce"),
+				"iat":            now.Unix(),
+				"exp":            now.Add(5 * time.Minute).Unix(),
+			}
+			if tt.modify != nil {
+				tt.modify(claims)
+			}
+			key := tt.key
+			if key == nil {
+				key = idp.key
+			}
+			idp.setIDToken(t, claims, key)
+
+			r := httptest.NewRequest(http.MethodGet, "/auth/callback?state=state&code=code", nil)
+			identity, err := provider.Complete(context.Background(), r, session)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got identity %+v, error %v; want error containing %q", identity, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if identity.Subject != "user-1" || identity.Email != "alice@example.com" || identity.Name != "Alice" ||
+				strings.Join(identity.Groups, ",") != "engineering,ops" {
+				t.Fatalf("unexpected identity %+v", identity)
+			}
+		})
+	}
+}
+
+func TestOIDCDiscovery(t *testing.T) {
+	tests := []struct {
+		name    string
+		issuer  string
+		wantErr string
+	}{
+		{name: "matching issuer"},
+		{name: "issuer mismatch", issuer: "https://evil.example.com", wantErr: "OIDC discovery returned issuer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newOIDCIdP(t, tt.issuer)
+			_, err := NewOIDC(context.Background(), OIDCConfig{IssuerURL: idp.server.URL + "/", ClientID: testOIDCClient})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("NewOIDC: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewOIDC error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Run("unreachable", func(t *testing.T) {
+		server := httptest.NewServer(http.NotFoundHandler())
+		server.Close()
+		if _, err := NewOIDC(context.Background(), OIDCConfig{IssuerURL: server.URL, ClientID: testOIDCClient}); err == nil {
+			t.Fatal("NewOIDC succeeded without a discovery document")
+		}
+	})
+}
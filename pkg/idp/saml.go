@@ -0,0 +1,323 @@
+package idp
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	nsSAMLProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	nsSAMLAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	nsSAMLMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+
+	samlBindingPOST   = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlStatusSuccess = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer        = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlEmailFormat   = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+)
+
+// Attribute names tried for the display name when the assertion carries one.
+var samlNameAttributes = []string{
+	"displayName",
+	"name",
+	"http://schemas.microsoft.com/identity/claims/displayname",
+	"http://schemas.xmlsoap.org/ws/2005/05/identity/claims/name",
+}
+
+// SAMLConfig configures Tridorian as a SAML 2.0 service provider.
+type SAMLConfig struct {
+	EntityID string // Our entity ID, the expected audience
+	ACSURL   string // Assertion consumer service URL (HTTP-POST binding)
+
+	IdPSSOURL      string // Single sign-on URL (HTTP-Redirect binding)
+	IdPEntityID    string // Expected assertion issuer. Optional.
+	IdPCertificate string // PEM signing certificate of the IdP
+
+	// EmailAttribute and GroupsAttribute name the assertion attributes to
+	// read. Without an email attribute the NameID is used.
+	EmailAttribute  string
+	GroupsAttribute string
+}
+
+// SAML signs users in with SP-initiated SSO: an AuthnRequest over the
+// HTTP-Redirect binding and a signed Response posted back to the ACS URL.
+// Encrypted assertions are not supported.
+type SAML struct {
+	cfg  SAMLConfig
+	cert *x509.Certificate
+}
+
+func NewSAML(cfg SAMLConfig) (*SAML, error) {
+	if cfg.EntityID == "" || cfg.ACSURL == "" || cfg.IdPSSOURL == "" {
+		return nil, errors.New("entity ID, ACS URL and IdP SSO URL are required")
+	}
+	cert, err := ParseCertificate(cfg.IdPCertificate)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.GroupsAttribute == "" {
+		cfg.GroupsAttribute = "groups"
+	}
+	return &SAML{cfg: cfg, cert: cert}, nil
+}
+
+// ParseCertificate parses a PEM certificate, or bare base64 DER as found in IdP metadata.
+func ParseCertificate(s string) (*x509.Certificate, error) {
+	s = strings.TrimSpace(s)
+	var der []byte
+	if block, _ := pem.Decode([]byte(s)); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		if der, err = decodeBase64(s); err != nil {
+			return nil, errors.New("invalid IdP certificate")
+		}
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IdP certificate: %w", err)
+	}
+	return cert, nil
+}
+
+type samlAuthnRequest struct {
+	XMLName                     xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:protocol AuthnRequest"`
+	ID                          string   `xml:"ID,attr"`
+	Version                     string   `xml:"Version,attr"`
+	IssueInstant                string   `xml:"IssueInstant,attr"`
+	Destination                 string   `xml:"Destination,attr"`
+	AssertionConsumerServiceURL string   `xml:"AssertionConsumerServiceURL,attr"`
+	ProtocolBinding             string   `xml:"ProtocolBinding,attr"`
+	Issuer                      struct {
+		XMLName xml.Name `xml:"urn:oasis:names:tc:SAML:2.0:assertion Issuer"`
+		Value   string   `xml:",chardata"`
+	}
+}
+
+func (s *SAML) Begin(state string) (string, Session, error) {
+	req := samlAuthnRequest{
+		ID:                          "_" + randomID(16),
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 s.cfg.IdPSSOURL,
+		AssertionConsumerServiceURL: s.cfg.ACSURL,
+		ProtocolBinding:             samlBindingPOST,
+	}
+	req.Issuer.Value = s.cfg.EntityID
+
+	data, err := xml.Marshal(req)
+	if err != nil {
+		return "", nil, err
+	}
+	var deflated bytes.Buffer
+	w, _ := flate.NewWriter(&deflated, flate.DefaultCompression)
+	w.Write(data)
+	w.Close()
+
+	query := url.Values{}
+	query.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	query.Set("RelayState", state)
+	sep := "?"
+	if strings.Contains(s.cfg.IdPSSOURL, "?") {
+		sep = "&"
+	}
+	return s.cfg.IdPSSOURL + sep + query.Encode(), Session{"request_id": req.ID}, nil
+}
+
+func (s *SAML) Complete(ctx context.Context, r *http.Request, session Session) (*Identity, error) {
+	encoded := r.PostFormValue("SAMLResponse")
+	if encoded == "" {
+		return nil, errors.New("SAML response is missing")
+	}
+	data, err := decodeBase64(encoded)
+	if err != nil {
+		return nil, errors.New("invalid SAML response encoding")
+	}
+	return s.parseResponse(data, session["request_id"], time.Now())
+}
+
+// parseResponse validates a SAML Response and extracts the user from its
+// assertion. Only the signed element and its descendants are trusted.
+func (s *SAML) parseResponse(data []byte, requestID string, now time.Time) (*Identity, error) {
+	if requestID == "" {
+		return nil, errors.New("login session is incomplete")
+	}
+	root, err := parseXML(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML response: %w", err)
+	}
+	if !root.is(nsSAMLProtocol, "Response") {
+		return nil, errors.New("invalid SAML response: not a Response")
+	}
+
+	// Duplicate IDs are how signature wrapping attacks smuggle in a second element
+	ids := map[string]bool{}
+	var duplicate bool
+	root.walk(func(n *xmlNode) {
+		if id := n.attr("ID"); id != "" {
+			duplicate = duplicate || ids[id]
+			ids[id] = true
+		}
+	})
+	if duplicate {
+		return nil, errors.New("invalid SAML response: duplicate IDs")
+	}
+
+	if status := root.child(nsSAMLProtocol, "Status"); status == nil {
+		return nil, errors.New("invalid SAML response: no status")
+	} else if code := status.child(nsSAMLProtocol, "StatusCode"); code == nil || code.attr("Value") != samlStatusSuccess {
+		return nil, errors.New("identity provider rejected the sign-in")
+	}
+	if d := root.attr("Destination"); d != "" && d != s.cfg.ACSURL {
+		return nil, fmt.Errorf("SAML response is addressed to %q", d)
+	}
+	if irt := root.attr("InResponseTo"); irt != "" && irt != requestID {
+		return nil, errors.New("SAML response does not answer this login")
+	}
+
+	if len(root.children(nsSAMLAssertion, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("encrypted SAML assertions are not supported")
+	}
+	assertions := root.children(nsSAMLAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("SAML response must contain exactly one assertion")
+	}
+	assertion := assertions[0]
+
+	// Either the assertion or the whole response must carry a valid signature
+	if len(assertion.children(nsDSig, "Signature")) > 0 {
+		err = verifySignature(assertion, s.cert)
+	} else {
+		err = verifySignature(root, s.cert)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid SAML signature: %w", err)
+	}
+
+	return s.parseAssertion(assertion, requestID, now)
+}
+
+func (s *SAML) parseAssertion(a *xmlNode, requestID string, now time.Time) (*Identity, error) {
+	if s.cfg.IdPEntityID != "" {
+		if issuer := a.child(nsSAMLAssertion, "Issuer"); issuer == nil || issuer.text() != s.cfg.IdPEntityID {
+			return nil, errors.New("SAML assertion is from an unexpected issuer")
+		}
+	}
+
+	subject := a.child(nsSAMLAssertion, "Subject")
+	if subject == nil {
+		return nil, errors.New("SAML assertion has no subject")
+	}
+	nameID := subject.child(nsSAMLAssertion, "NameID")
+	if nameID == nil || nameID.text() == "" {
+		return nil, errors.New("SAML assertion has no NameID")
+	}
+
+	// At least one bearer confirmation for this login and this ACS
+	confirmed := false
+	for _, sc := range subject.children(nsSAMLAssertion, "SubjectConfirmation") {
+		data := sc.child(nsSAMLAssertion, "SubjectConfirmationData")
+		if sc.attr("Method") != samlBearer || data == nil {
+			continue
+		}
+		if data.attr("Recipient") != s.cfg.ACSURL || data.attr("InResponseTo") != requestID {
+			continue
+		}
+		if !notExpired(data.attr("NotOnOrAfter"), now) {
+			continue
+		}
+		confirmed = true
+		break
+	}
+	if !confirmed {
+		return nil, errors.New("SAML assertion has no valid subject confirmation")
+	}
+
+	if cond := a.child(nsSAMLAssertion, "Conditions"); cond != nil {
+		if nb := cond.attr("NotBefore"); nb != "" {
+			t, err := time.Parse(time.RFC3339, nb)
+			if err != nil || now.Add(clockSkew).Before(t) {
+				return nil, errors.New("SAML assertion is not yet valid")
+			}
+		}
+		if na := cond.attr("NotOnOrAfter"); na != "" && !notExpired(na, now) {
+			return nil, errors.New("SAML assertion has expired")
+		}
+		for _, ar := range cond.children(nsSAMLAssertion, "AudienceRestriction") {
+			ok := false
+			for _, aud := range ar.children(nsSAMLAssertion, "Audience") {
+				ok = ok || aud.text() == s.cfg.EntityID
+			}
+			if !ok {
+				return nil, errors.New("SAML assertion is not intended for this service")
+			}
+		}
+	}
+
+	attrs := map[string][]string{}
+	for _, stmt := range a.children(nsSAMLAssertion, "AttributeStatement") {
+		for _, attr := range stmt.children(nsSAMLAssertion, "Attribute") {
+			name := attr.attr("Name")
+			for _, v := range attr.children(nsSAMLAssertion, "AttributeValue") {
+				attrs[name] = append(attrs[name], v.text())
+			}
+		}
+	}
+
+	identity := &Identity{
+		Subject: nameID.text(),
+		Groups:  uniqueStrings(attrs[s.cfg.GroupsAttribute]),
+	}
+	if s.cfg.EmailAttribute != "" {
+		identity.Email = firstString(attrs[s.cfg.EmailAttribute])
+	} else if nameID.attr("Format") == samlEmailFormat || strings.Contains(nameID.text(), "@") {
+		identity.Email = nameID.text()
+	}
+	if identity.Email == "" {
+		return nil, errors.New("SAML assertion has no email address")
+	}
+	for _, n := range samlNameAttributes {
+		if v := firstString(attrs[n]); v != "" {
+			identity.Name = v
+			break
+		}
+	}
+	return identity, nil
+}
+
+// notExpired reports whether a NotOnOrAfter timestamp is still in the future.
+func notExpired(notOnOrAfter string, now time.Time) bool {
+	if notOnOrAfter == "" {
+		return false
+	}
+	t, err := time.Parse(time.RFC3339, notOnOrAfter)
+	return err == nil && now.Add(-clockSkew).Before(t)
+}
+
+// Metadata returns the service provider metadata to register with the IdP.
+func (s *SAML) Metadata() []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	b.WriteString(`<md:EntityDescriptor xmlns:md="` + nsSAMLMetadata + `" entityID="`)
+	xml.EscapeText(&b, []byte(s.cfg.EntityID))
+	b.WriteString(`">` + "\n")
+	b.WriteString(`  <md:SPSSODescriptor AuthnRequestsSigned="false" WantAssertionsSigned="true" protocolSupportEnumeration="` + nsSAMLProtocol + `">` + "\n")
+	b.WriteString(`    <md:NameIDFormat>` + samlEmailFormat + `</md:NameIDFormat>` + "\n")
+	b.WriteString(`    <md:AssertionConsumerService Binding="` + samlBindingPOST + `" Location="`)
+	xml.EscapeText(&b, []byte(s.cfg.ACSURL))
+	b.WriteString(`" index="0" isDefault="true"/>` + "\n")
+	b.WriteString(`  </md:SPSSODescriptor>` + "\n")
+	b.WriteString(`</md:EntityDescriptor>` + "\n")
+	return b.Bytes()
+}
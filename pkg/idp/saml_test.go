@@ -0,0 +1,376 @@
+package idp
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testSAMLIssuer = "https://idp.example.com/metadata"
+	testSAMLEntity = "https://auth.example.com/saml/metadata"
+	testSAMLACS    = "https://auth.example.com/saml/acs"
+)
+
+// samlIdP is a stand-in identity provider. Its SSO endpoint decodes the
+// AuthnRequest and answers with whatever respond builds for that request,
+// base64 encoded as the browser would post it to the ACS.
+type samlIdP struct {
+	t       *testing.T
+	key     *rsa.PrivateKey
+	certPEM string
+	server  *httptest.Server
+	respond func(requestID string) string
+}
+
+func newSAMLIdP(t *testing.T) *samlIdP {
+	t.Helper()
+	p := &samlIdP{t: t, key: testRSAKey(t)}
+	p.certPEM = selfSignedPEM(t, p.key)
+
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		deflated, err := base64.StdEncoding.DecodeString(r.URL.Query().Get("SAMLRequest"))
+		if err != nil {
+			http.Error(w, "bad SAMLRequest encoding", http.StatusBadRequest)
+			return
+		}
+		data, err := io.ReadAll(flate.NewReader(bytes.NewReader(deflated)))
+		if err != nil {
+			http.Error(w, "bad SAMLRequest compression", http.StatusBadRequest)
+			return
+		}
+		var req samlAuthnRequest
+		if err := xml.Unmarshal(data, &req); err != nil || req.AssertionConsumerServiceURL != testSAMLACS {
+			http.Error(w, "bad AuthnRequest", http.StatusBadRequest)
+			return
+		}
+		if r.URL.Query().Get("RelayState") == "" {
+			http.Error(w, "RelayState is missing", http.StatusBadRequest)
+			return
+		}
+		io.WriteString(w, base64.StdEncoding.EncodeToString([]byte(p.respond(req.ID))))
+	}))
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+type assertionOptions struct {
+	ID           string
+	RequestID    string
+	Email        string
+	Audience     string
+	NotOnOrAfter time.Time
+}
+
+// assertion builds an unsigned assertion for alice unless the options say otherwise.
+func (p *samlIdP) assertion(o assertionOptions) string {
+	if o.ID == "" {
+		o.ID = "_assertion1"
+	}
+	if o.Email == "" {
+		o.Email = "alice@example.com"
+	}
+	if o.Audience == "" {
+		o.Audience = testSAMLEntity
+	}
+	if o.NotOnOrAfter.IsZero() {
+		o.NotOnOrAfter = time.Now().Add(5 * time.Minute)
+	}
+	now := time.Now().UTC()
+	return `<saml:Assertion xmlns:saml="` + nsSAMLAssertion + `" ID="` + o.ID + `" Version="2.0" IssueInstant="` + now.Format(time.RFC3339) + `">` +
+		`<saml:Issuer>` + testSAMLIssuer + `</saml:Issuer>` +
+		`<saml:Subject>` +
+		`<saml:NameID Format="` + samlEmailFormat + `">` + o.Email + `</saml:NameID>` +
+		`<saml:SubjectConfirmation Method="` + samlBearer + `">` +
+		`<saml:SubjectConfirmationData InResponseTo="` + o.RequestID + `" Recipient="` + testSAMLACS + `" NotOnOrAfter="` + now.Add(5*time.Minute).Format(time.RFC3339) + `"/>` +
+		`</saml:SubjectConfirmation>` +
+		`</saml:Subject>` +
+		`<saml:Conditions NotBefore="` + now.Add(-time.Minute).Format(time.RFC3339) + `" NotOnOrAfter="` + o.NotOnOrAfter.UTC().Format(time.RFC3339) + `">` +
+		`<saml:AudienceRestriction><saml:Audience>` + o.Audience + `</saml:Audience></saml:AudienceRestriction>` +
+		`</saml:Conditions>` +
+		`<saml:AttributeStatement>` +
+		`<saml:Attribute Name="displayName"><saml:AttributeValue>Alice</saml:AttributeValue></saml:Attribute>` +
+		`<saml:Attribute Name="groups"><saml:AttributeValue>engineering</saml:AttributeValue></saml:Attribute>` +
+		`</saml:AttributeStatement>` +
+		`</saml:Assertion>`
+}
+
+// sign adds an enveloped signature by key after the assertion's Issuer.
+func (p *samlIdP) sign(assertion string, key *rsa.PrivateKey) string {
+	p.t.Helper()
+	node, err := parseXML([]byte(assertion))
+	if err != nil {
+		p.t.Fatalf("parse assertion: %v", err)
+	}
+	digestValue := base64.StdEncoding.EncodeToString(digest(crypto.SHA256, canonicalize(node, nil, nil)))
+
+	signedInfo := `<ds:SignedInfo xmlns:ds="` + nsDSig + `">` +
+		`<ds:CanonicalizationMethod Algorithm="` + algExcC + `"/>` +
+		`<ds:SignatureMethod Algorithm="http://www.w3.org/2001/04/xmldsig-more#rsa-sha256"/>` +
+		`<ds:Reference URI="#` + node.attr("ID") + `">` +
+		`<ds:Transforms><ds:Transform Algorithm="` + algEnv + `"/><ds:Transform Algorithm="` + algExcC + `"/></ds:Transforms>` +
+		`<ds:DigestMethod Algorithm="http://www.w3.org/2001/04/xmlenc#sha256"/>` +
+		`<ds:DigestValue>` + digestValue + `</ds:DigestValue>` +
+		`</ds:Reference>` +
+		`</ds:SignedInfo>`
+	infoNode, err := parseXML([]byte(signedInfo))
+	if err != nil {
+		p.t.Fatalf("parse SignedInfo: %v", err)
+	}
+	value, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest(crypto.SHA256, canonicalize(infoNode, nil, nil)))
+	if err != nil {
+		p.t.Fatalf("sign: %v", err)
+	}
+
+	signature := `<ds:Signature xmlns:ds="` + nsDSig + `">` + signedInfo +
+		`<ds:SignatureValue>` + base64.StdEncoding.EncodeToString(value) + `</ds:SignatureValue>` +
+		`</ds:Signature>`
+	return strings.Replace(assertion, `</saml:Issuer>`, `</saml:Issuer>`+signature, 1)
+}
+
+// response wraps assertions (or any other content) in a successful Response.
+func (p *samlIdP) response(requestID string, content ...string) string {
+	return `<samlp:Response xmlns:samlp="` + nsSAMLProtocol + `" xmlns:saml="` + nsSAMLAssertion + `" ID="_response1" Version="2.0"` +
+		` InResponseTo="` + requestID + `" Destination="` + testSAMLACS + `">` +
+		`<saml:Issuer>` + testSAMLIssuer + `</saml:Issuer>` +
+		`<samlp:Status><samlp:StatusCode Value="` + samlStatusSuccess + `"/></samlp:Status>` +
+		strings.Join(content, "") +
+		`</samlp:Response>`
+}
+
+func TestSAMLComplete(t *testing.T) {
+	idp := newSAMLIdP(t)
+	otherKey := testRSAKey(t)
+
+	tests := []struct {
+		name    string
+		respond func(requestID string) string
+		wantErr string
+	}{
+		{
+			name: "valid signed assertion",
+			respond: func(id string) string {
+				return idp.response(id, idp.sign(idp.assertion(assertionOptions{RequestID: id}), idp.key))
+			},
+		},
+		{
+			name: "unsigned assertion",
+			respond: func(id string) string {
+				return idp.response(id, idp.assertion(assertionOptions{RequestID: id}))
+			},
+			wantErr: "element is not signed",
+		},
+		{
+			name: "signed by another key",
+			respond: func(id string) string {
+				return idp.response(id, idp.sign(idp.assertion(assertionOptions{RequestID: id}), otherKey))
+			},
+			wantErr: "signature verification failed",
+		},
+		{
+			name: "email changed after signing",
+			respond: func(id string) string {
+				signed := idp.sign(idp.assertion(assertionOptions{RequestID: id}), idp.key)
+				return idp.response(id, strings.ReplaceAll(signed, "alice@example.com", "mallory@example.com"))
+			},
+			wantErr: "digest mismatch",
+		},
+		{
+			name: "group added after signing",
+			respond: func(id string) string {
+				signed := idp.sign(idp.assertion(assertionOptions{RequestID: id}), idp.key)
+				return idp.response(id, strings.Replace(signed,
+					`<saml:AttributeValue>engineering</saml:AttributeValue>`,
+					`<saml:AttributeValue>engineering</saml:AttributeValue><saml:AttributeValue>admins</saml:AttributeValue>`, 1))
+			},
+			wantErr: "digest mismatch",
+		},
+		{
+			name: "wrapping: signed original hidden next to a forged assertion with the same ID",
+			respond: func(id string) string {
+				signed := idp.sign(idp.assertion(assertionOptions{RequestID: id}), idp.key)
+				forged := idp.assertion(assertionOptions{RequestID: id, Email: "mallory@example.com"})
+				return idp.response(id, `<samlp:Extensions>`+signed+`</samlp:Extensions>`, forged)
+			},
+			wantErr: "duplicate IDs",
+		},
+		{
+			name: "wrapping: signature moved onto a forged assertion",
+			respond: func(id string) string {
+				signed := idp.sign(idp.assertion(assertionOptions{RequestID: id}), idp.key)
+				signature := signed[strings.Index(signed, "<ds:Signature ") : strings.Index(signed, "</ds:Signature>")+len("</ds:Signature>")]
+				forged := idp.assertion(assertionOptions{ID: "_forged", RequestID: id, Email: "mallory@example.com"})
+				forged = strings.Replace(forged, `</saml:Issuer>`, `</saml:Issuer>`+signature, 1)
+				return idp.response(id, forged)
+			},
+			wantErr: "signature does not reference the signed element",
+		},
+		{
+			name: "wrapping: signed original hidden next to an unsigned forged assertion",
+			respond: func(id string) string {
+				signed := idp.sign(idp.assertion(assertionOptions{RequestID: id}), idp.key)
+				forged := idp.assertion(assertionOptions{ID: "_forged", RequestID: id, Email: "mallory@example.com"})
+				return idp.response(id, `<samlp:Extensions>`+signed+`</samlp:Extensions>`, forged)
+			},
+			wantErr: "element is not signed",
+		},
+		{
+			name: "two assertions",
+			respond: func(id string) string {
+				return idp.response(id,
+					idp.sign(idp.assertion(assertionOptions{RequestID: id}), idp.key),
+					idp.sign(idp.assertion(assertionOptions{ID: "_assertion2", RequestID: id, Email: "mallory@example.com"}), idp.key))
+			},
+			wantErr: "exactly one assertion",
+		},
+		{
+			name: "expired assertion",
+			respond: func(id string) string {
+				return idp.response(id, idp.sign(idp.assertion(assertionOptions{RequestID: id, NotOnOrAfter: time.Now().Add(-time.Hour)}), idp.key))
+			},
+			wantErr: "has expired",
+		},
+		{
+			name: "wrong audience",
+			respond: func(id string) string {
+				return idp.response(id, idp.sign(idp.assertion(assertionOptions{RequestID: id, Audience: "https://other.example.com"}), idp.key))
+			},
+			wantErr: "not intended for this service",
+		},
+		{
+			name: "answer to another login",
+			respond: func(id string) string {
+				return idp.response("_other", idp.sign(idp.assertion(assertionOptions{RequestID: "_other"}), idp.key))
+			},
+			wantErr: "does not answer this login",
+		},
+		{
+			name: "confirmation for another login",
+			respond: func(id string) string {
+				return idp.response(id, idp.sign(idp.assertion(assertionOptions{RequestID: "_other"}), idp.key))
+			},
+			wantErr: "no valid subject confirmation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp, err := NewSAML(SAMLConfig{
+				EntityID:       testSAMLEntity,
+				ACSURL:         testSAMLACS,
+				IdPSSOURL:      idp.server.URL + "/sso",
+				IdPEntityID:    testSAMLIssuer,
+				IdPCertificate: idp.certPEM,
+			})
+			if err != nil {
+				t.Fatalf("NewSAML: %v", err)
+			}
+			idp.respond = tt.respond
+
+			identity, err := samlSignIn(t, sp)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got identity %+v, error %v; want error containing %q", identity, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Complete: %v", err)
+			}
+			if identity.Email != "alice@example.com" || identity.Name != "Alice" ||
+				len(identity.Groups) != 1 || identity.Groups[0] != "engineering" {
+				t.Fatalf("unexpected identity %+v", identity)
+			}
+		})
+	}
+}
+
+// samlSignIn follows the redirect to the stand-in IdP and posts its answer back to sp.
+func samlSignIn(t *testing.T, sp *SAML) (*Identity, error) {
+	t.Helper()
+	redirect, session, err := sp.Begin("state")
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	resp, err := http.Get(redirect)
+	if err != nil {
+		t.Fatalf("IdP: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("IdP: %s: %s", resp.Status, body)
+	}
+
+	form := url.Values{"SAMLResponse": {string(body)}, "RelayState": {"state"}}
+	r := httptest.NewRequest(http.MethodPost, testSAMLACS, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return sp.Complete(context.Background(), r, session)
+}
+
+func testRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return key
+}
+
+func selfSignedPEM(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Test IdP"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+}
+
+func TestParseCertificate(t *testing.T) {
+	key := testRSAKey(t)
+	certPEM := selfSignedPEM(t, key)
+	block, _ := pem.Decode([]byte(certPEM))
+	bare := base64.StdEncoding.EncodeToString(block.Bytes)
+
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"PEM", certPEM, false},
+		{"bare base64 DER", bare, false},
+		{"wrapped base64 DER", bare[:64] + "\n" + bare[64:], false},
+		{"garbage", "not a certificate", true},
+		{"truncated DER", bare[:100], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCertificate(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCertificate error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,430 @@
+package idp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Enveloped XML signatures as used by SAML: exclusive canonicalization,
+// RSA-SHA256/512 and SHA-256/512 digests. Documents are parsed into a small
+// tree that keeps namespace prefixes so signed elements can be
+// re-serialized exactly as the signer canonicalized them.
+
+const (
+	nsXML   = "http://www.w3.org/XML/1998/namespace"
+	nsDSig  = "http://www.w3.org/2000/09/xmldsig#"
+	algExcC = "http://www.w3.org/2001/10/xml-exc-c14n#"
+	algEnv  = "http://www.w3.org/2000/09/xmldsig#enveloped-signature"
+)
+
+var signatureHashes = map[string]crypto.Hash{
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha256": crypto.SHA256,
+	"http://www.w3.org/2001/04/xmldsig-more#rsa-sha512": crypto.SHA512,
+}
+
+var digestHashes = map[string]crypto.Hash{
+	"http://www.w3.org/2001/04/xmlenc#sha256": crypto.SHA256,
+	"http://www.w3.org/2001/04/xmlenc#sha512": crypto.SHA512,
+}
+
+type xmlAttr struct {
+	Prefix, Local, Value string
+}
+
+type xmlNode struct {
+	Prefix, Local string
+	Attrs         []xmlAttr // Including namespace declarations
+	Children      []xmlContent
+	Parent        *xmlNode
+}
+
+// xmlContent is either a child element or character data.
+type xmlContent struct {
+	Elem *xmlNode
+	Text string
+}
+
+// parseXML builds the element tree. Comments and processing instructions
+// are dropped; DTDs are rejected.
+func parseXML(data []byte) (*xmlNode, error) {
+	dec := xml.NewDecoder(bytes.NewReader(data))
+	var root, cur *xmlNode
+	for {
+		tok, err := dec.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			n := &xmlNode{Prefix: t.Name.Space, Local: t.Name.Local, Parent: cur}
+			for _, a := range t.Attr {
+				n.Attrs = append(n.Attrs, xmlAttr{Prefix: a.Name.Space, Local: a.Name.Local, Value: a.Value})
+			}
+			if cur == nil {
+				if root != nil {
+					return nil, errors.New("multiple root elements")
+				}
+				root = n
+			} else {
+				cur.Children = append(cur.Children, xmlContent{Elem: n})
+			}
+			cur = n
+		case xml.EndElement:
+			if cur == nil || t.Name.Space != cur.Prefix || t.Name.Local != cur.Local {
+				return nil, errors.New("mismatched end element")
+			}
+			cur = cur.Parent
+		case xml.CharData:
+			if cur != nil {
+				cur.Children = append(cur.Children, xmlContent{Text: string(t)})
+			}
+		case xml.Directive:
+			return nil, errors.New("DTDs are not allowed")
+		}
+	}
+	if root == nil || cur != nil {
+		return nil, errors.New("incomplete XML document")
+	}
+	return root, nil
+}
+
+// lookupNS resolves a prefix ("" for the default namespace) in scope at n.
+func (n *xmlNode) lookupNS(prefix string) string {
+	if prefix == "xml" {
+		return nsXML
+	}
+	for e := n; e != nil; e = e.Parent {
+		for _, a := range e.Attrs {
+			if (prefix == "" && a.Prefix == "" && a.Local == "xmlns") || (a.Prefix == "xmlns" && a.Local == prefix) {
+				return a.Value
+			}
+		}
+	}
+	return ""
+}
+
+func (n *xmlNode) is(ns, local string) bool {
+	return n.Local == local && n.lookupNS(n.Prefix) == ns
+}
+
+func (n *xmlNode) attr(local string) string {
+	for _, a := range n.Attrs {
+		if a.Prefix == "" && a.Local == local {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// children returns the child elements with the namespace and local name.
+func (n *xmlNode) children(ns, local string) []*xmlNode {
+	var out []*xmlNode
+	for _, c := range n.Children {
+		if c.Elem != nil && c.Elem.is(ns, local) {
+			out = append(out, c.Elem)
+		}
+	}
+	return out
+}
+
+// child returns the single child element with the name, or nil.
+func (n *xmlNode) child(ns, local string) *xmlNode {
+	if c := n.children(ns, local); len(c) == 1 {
+		return c[0]
+	}
+	return nil
+}
+
+// text returns the concatenated character data of the element.
+func (n *xmlNode) text() string {
+	var b strings.Builder
+	for _, c := range n.Children {
+		if c.Elem == nil {
+			b.WriteString(c.Text)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// walk visits n and every descendant element.
+func (n *xmlNode) walk(fn func(*xmlNode)) {
+	fn(n)
+	for _, c := range n.Children {
+		if c.Elem != nil {
+			c.Elem.walk(fn)
+		}
+	}
+}
+
+// canonicalize serializes the subtree at n with Exclusive XML
+// Canonicalization (without comments), leaving out the skip element.
+// inclusive lists the InclusiveNamespaces prefixes ("#default" for the
+// default namespace).
+func canonicalize(n *xmlNode, skip *xmlNode, inclusive []string) []byte {
+	var buf bytes.Buffer
+	incl := make(map[string]bool, len(inclusive))
+	for _, p := range inclusive {
+		if p == "#default" {
+			p = ""
+		}
+		incl[p] = true
+	}
+	writeCanonical(&buf, n, skip, incl, map[string]string{})
+	return buf.Bytes()
+}
+
+func writeCanonical(buf *bytes.Buffer, n, skip *xmlNode, incl map[string]bool, rendered map[string]string) {
+	// Namespaces visibly used by the element and its attributes, plus the inclusive ones in scope
+	used := map[string]bool{n.Prefix: true}
+	var attrs []xmlAttr
+	for _, a := range n.Attrs {
+		if a.Prefix == "xmlns" || (a.Prefix == "" && a.Local == "xmlns") {
+			continue // Declarations are re-emitted only where used
+		}
+		if a.Prefix != "" {
+			used[a.Prefix] = true
+		}
+		attrs = append(attrs, a)
+	}
+	for p := range incl {
+		if n.lookupNS(p) != "" {
+			used[p] = true
+		}
+	}
+
+	var prefixes []string
+	scope, copied := rendered, false
+	for p := range used {
+		if p == "xml" {
+			continue
+		}
+		uri := n.lookupNS(p)
+		prev, seen := rendered[p]
+		if (!seen && uri == "") || (seen && prev == uri) {
+			continue
+		}
+		if !copied {
+			scope, copied = make(map[string]string, len(rendered)+1), true
+			for k, v := range rendered {
+				scope[k] = v
+			}
+		}
+		scope[p] = uri
+		prefixes = append(prefixes, p)
+	}
+	sort.Strings(prefixes)
+
+	sort.Slice(attrs, func(i, j int) bool {
+		ni, nj := n.lookupNS(attrs[i].Prefix), n.lookupNS(attrs[j].Prefix)
+		if attrs[i].Prefix == "" {
+			ni = ""
+		}
+		if attrs[j].Prefix == "" {
+			nj = ""
+		}
+		if ni != nj {
+			return ni < nj
+		}
+		return attrs[i].Local < attrs[j].Local
+	})
+
+	name := qualifiedName(n.Prefix, n.Local)
+	buf.WriteString("<" + name)
+	for _, p := range prefixes {
+		if p == "" {
+			buf.WriteString(` xmlns="`)
+		} else {
+			buf.WriteString(" xmlns:" + p + `="`)
+		}
+		escapeAttr(buf, scope[p])
+		buf.WriteString(`"`)
+	}
+	for _, a := range attrs {
+		buf.WriteString(" " + qualifiedName(a.Prefix, a.Local) + `="`)
+		escapeAttr(buf, a.Value)
+		buf.WriteString(`"`)
+	}
+	buf.WriteString(">")
+
+	for _, c := range n.Children {
+		if c.Elem == nil {
+			escapeText(buf, c.Text)
+		} else if c.Elem != skip {
+			writeCanonical(buf, c.Elem, skip, incl, scope)
+		}
+	}
+	buf.WriteString("</" + name + ">")
+}
+
+func qualifiedName(prefix, local string) string {
+	if prefix == "" {
+		return local
+	}
+	return prefix + ":" + local
+}
+
+func escapeText(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+func escapeAttr(buf *bytes.Buffer, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '"':
+			buf.WriteString("&quot;")
+		case '\t':
+			buf.WriteString("&#x9;")
+		case '\n':
+			buf.WriteString("&#xA;")
+		case '\r':
+			buf.WriteString("&#xD;")
+		default:
+			buf.WriteRune(r)
+		}
+	}
+}
+
+// verifySignature checks the enveloped signature that is a direct child of
+// n and covers n itself. Only n may be trusted afterwards: content outside
+// it is not protected by the signature.
+func verifySignature(n *xmlNode, cert *x509.Certificate) error {
+	sigs := n.children(nsDSig, "Signature")
+	if len(sigs) != 1 {
+		return errors.New("element is not signed")
+	}
+	sig := sigs[0]
+
+	signedInfo := sig.child(nsDSig, "SignedInfo")
+	if signedInfo == nil {
+		return errors.New("signature has no SignedInfo")
+	}
+	c14n := signedInfo.child(nsDSig, "CanonicalizationMethod")
+	if c14n == nil || c14n.attr("Algorithm") != algExcC {
+		return errors.New("unsupported canonicalization method")
+	}
+	method := signedInfo.child(nsDSig, "SignatureMethod")
+	if method == nil {
+		return errors.New("signature has no SignatureMethod")
+	}
+	hash, ok := signatureHashes[method.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported signature method %q", method.attr("Algorithm"))
+	}
+
+	// Exactly one reference, to the signed element
+	refs := signedInfo.children(nsDSig, "Reference")
+	if len(refs) != 1 {
+		return errors.New("signature must have exactly one reference")
+	}
+	ref := refs[0]
+	id := n.attr("ID")
+	if id == "" || ref.attr("URI") != "#"+id {
+		return errors.New("signature does not reference the signed element")
+	}
+
+	var inclusive []string
+	if transforms := ref.child(nsDSig, "Transforms"); transforms != nil {
+		for _, t := range transforms.children(nsDSig, "Transform") {
+			switch t.attr("Algorithm") {
+			case algEnv:
+			case algExcC:
+				inclusive = inclusivePrefixes(t)
+			default:
+				return fmt.Errorf("unsupported transform %q", t.attr("Algorithm"))
+			}
+		}
+	}
+
+	digestMethod := ref.child(nsDSig, "DigestMethod")
+	digestValue := ref.child(nsDSig, "DigestValue")
+	if digestMethod == nil || digestValue == nil {
+		return errors.New("reference has no digest")
+	}
+	digestHash, ok := digestHashes[digestMethod.attr("Algorithm")]
+	if !ok {
+		return fmt.Errorf("unsupported digest method %q", digestMethod.attr("Algorithm"))
+	}
+	expected, err := decodeBase64(digestValue.text())
+	if err != nil {
+		return errors.New("invalid digest value")
+	}
+	if subtle.ConstantTimeCompare(digest(digestHash, canonicalize(n, sig, inclusive)), expected) != 1 {
+		return errors.New("digest mismatch")
+	}
+
+	sigValue := sig.child(nsDSig, "SignatureValue")
+	if sigValue == nil {
+		return errors.New("signature has no SignatureValue")
+	}
+	value, err := decodeBase64(sigValue.text())
+	if err != nil {
+		return errors.New("invalid signature value")
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return errors.New("identity provider certificate must use an RSA key")
+	}
+	hashed := digest(hash, canonicalize(signedInfo, nil, inclusivePrefixes(c14n)))
+	if err := rsa.VerifyPKCS1v15(pub, hash, hashed, value); err != nil {
+		return errors.New("signature verification failed")
+	}
+	return nil
+}
+
+// inclusivePrefixes reads the InclusiveNamespaces PrefixList of a c14n method.
+func inclusivePrefixes(method *xmlNode) []string {
+	for _, c := range method.Children {
+		if c.Elem != nil && c.Elem.is(algExcC, "InclusiveNamespaces") {
+			return strings.Fields(c.Elem.attr("PrefixList"))
+		}
+	}
+	return nil
+}
+
+func digest(h crypto.Hash, data []byte) []byte {
+	switch h {
+	case crypto.SHA512:
+		sum := sha512.Sum512(data)
+		return sum[:]
+	default:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+}
+
+// decodeBase64 decodes base64 that may be wrapped over several lines.
+func decodeBase64(s string) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+}
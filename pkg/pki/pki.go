@@ -0,0 +1,228 @@
+// Package pki implements the gateway certificate authority: the control
+// plane signs a client certificate for each enrolled gateway node, and
+// gateways authenticate every call with it over mutual TLS.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"time"
+)
+
+// CA is the gateway certificate authority. Key is nil when only the
+// certificate was loaded, which is enough to verify but not to sign.
+type CA struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+	Key     crypto.Signer
+}
+
+// LoadCA parses the CA certificate and, when keyPEM is not empty, its
+// private key (PKCS#8, EC or PKCS#1).
+func LoadCA(certPEM, keyPEM string) (*CA, error) {
+	cert, err := ParseCertificatePEM([]byte(certPEM))
+	if err != nil {
+		return nil, fmt.Errorf("CA certificate: %w", err)
+	}
+	if !cert.IsCA {
+		return nil, errors.New("CA certificate is not a certificate authority")
+	}
+	ca := &CA{Cert: cert, CertPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})}
+	if keyPEM == "" {
+		return ca, nil
+	}
+	key, err := ParsePrivateKeyPEM([]byte(keyPEM))
+	if err != nil {
+		return nil, fmt.Errorf("CA key: %w", err)
+	}
+	if !publicKeysEqual(key.Public(), cert.PublicKey) {
+		return nil, errors.New("CA key does not match the CA certificate")
+	}
+	ca.Key = key
+	return ca, nil
+}
+
+// Pool returns a certificate pool holding only the CA.
+func (ca *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.Cert)
+	return pool
+}
+
+// Fingerprint returns the CA certificate's SHA-256 fingerprint.
+func (ca *CA) Fingerprint() string {
+	return Fingerprint(ca.Cert)
+}
+
+// SignClientCSR checks a PEM certificate request and issues a client
+// certificate for commonName, whatever subject the request asked for.
+func (ca *CA) SignClientCSR(csrPEM []byte, commonName string, validity time.Duration) (*x509.Certificate, []byte, error) {
+	block, _ := pem.Decode(csrPEM)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		return nil, nil, errors.New("invalid certificate request")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate request: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, nil, fmt.Errorf("invalid certificate request signature: %w", err)
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: commonName},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	return ca.issue(template, csr.PublicKey, validity)
+}
+
+// ServerCertificate issues a TLS server certificate for hosts (names or IP
+// addresses) with a new key. The chain includes the CA certificate, so a
+// gateway that pins the CA fingerprint can find it.
+func (ca *CA) ServerCertificate(hosts []string, validity time.Duration) (tls.Certificate, error) {
+	if len(hosts) == 0 {
+		return tls.Certificate{}, errors.New("no host names for the server certificate")
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template := &x509.Certificate{
+		Subject:     pkix.Name{CommonName: hosts[0]},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, h)
+		}
+	}
+	cert, _, err := ca.issue(template, key.Public(), validity)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{cert.Raw, ca.Cert.Raw}, PrivateKey: key, Leaf: cert}, nil
+}
+
+func (ca *CA) issue(template *x509.Certificate, pub crypto.PublicKey, validity time.Duration) (*x509.Certificate, []byte, error) {
+	if ca.Key == nil {
+		return nil, nil, errors.New("the CA key is not loaded")
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+	// Backdated a little for clocks that lag behind the control plane's
+	now := time.Now()
+	template.SerialNumber = serial
+	template.NotBefore = now.Add(-5 * time.Minute)
+	template.NotAfter = now.Add(validity)
+	if template.NotAfter.After(ca.Cert.NotAfter) {
+		template.NotAfter = ca.Cert.NotAfter
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, pub, ca.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), nil
+}
+
+// Fingerprint returns the hex SHA-256 of a certificate.
+func Fingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint lower-cases a fingerprint and drops the colons some
+// tools print between bytes.
+func NormalizeFingerprint(fp string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(fp), ":", ""))
+}
+
+// SerialHex formats a certificate serial number as stored on the node.
+func SerialHex(cert *x509.Certificate) string {
+	return cert.SerialNumber.Text(16)
+}
+
+// ParseCertificatePEM parses the first certificate in a PEM document.
+func ParseCertificatePEM(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// ParsePrivateKeyPEM parses a PEM private key.
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM private key found")
+	}
+	var key any
+	var err error
+	switch block.Type {
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key type")
+	}
+	return signer, nil
+}
+
+// NewKey generates a P-256 key and returns it with its PKCS#8 PEM encoding.
+func NewKey() (crypto.Signer, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// NewCSR returns a PEM certificate request for key.
+func NewCSR(key crypto.Signer, commonName string) ([]byte, error) {
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+func publicKeysEqual(a, b crypto.PublicKey) bool {
+	k, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(b)
+}
@@ -0,0 +1,339 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestCA creates a self-signed CA valid for validity, with its PEM key.
+func newTestCA(t *testing.T, isCA bool, validity time.Duration) (certPEM, keyPEM string) {
+	t.Helper()
+	key, pemKey, err := NewKey()
+	if err != nil {
+		t.Fatalf("NewKey: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Gateway CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(validity),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("create CA: %v", err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})), string(pemKey)
+}
+
+func loadTestCA(t *testing.T) *CA {
+	t.Helper()
+	certPEM, keyPEM := newTestCA(t, true, 24*time.Hour)
+	ca, err := LoadCA(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("LoadCA: %v", err)
+	}
+	return ca
+}
+
+func TestLoadCA(t *testing.T) {
+	certPEM, keyPEM := newTestCA(t, true, time.Hour)
+	_, otherKeyPEM := newTestCA(t, true, time.Hour)
+	leafPEM, leafKeyPEM := newTestCA(t, false, time.Hour)
+
+	ecKey, _ := ParsePrivateKeyPEM([]byte(keyPEM))
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey.(*ecdsa.PrivateKey))
+	ecPEM := string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}))
+
+	tests := []struct {
+		name    string
+		certPEM string
+		keyPEM  string
+		wantKey bool
+		wantErr string
+	}{
+		{name: "certificate and PKCS#8 key", certPEM: certPEM, keyPEM: keyPEM, wantKey: true},
+		{name: "certificate and EC key", certPEM: certPEM, keyPEM: ecPEM, wantKey: true},
+		{name: "certificate only", certPEM: certPEM},
+		{name: "key of another CA", certPEM: certPEM, keyPEM: otherKeyPEM, wantErr: "does not match"},
+		{name: "not a CA", certPEM: leafPEM, keyPEM: leafKeyPEM, wantErr: "not a certificate authority"},
+		{name: "no certificate", certPEM: keyPEM, wantErr: "no PEM certificate"},
+		{name: "garbage key", certPEM: certPEM, keyPEM: "not a key", wantErr: "no PEM private key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ca, err := LoadCA(tt.certPEM, tt.keyPEM)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("LoadCA error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LoadCA: %v", err)
+			}
+			if (ca.Key != nil) != tt.wantKey {
+				t.Fatalf("CA key loaded = %v, want %v", ca.Key != nil, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestSignClientCSR(t *testing.T) {
+	ca := loadTestCA(t)
+	key, _, _ := NewKey()
+	csr, err := NewCSR(key, "gateway-host")
+	if err != nil {
+		t.Fatalf("NewCSR: %v", err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate RSA key: %v", err)
+	}
+	rsaCSR, _ := NewCSR(rsaKey, "gateway-host")
+
+	// A request whose signature does not cover its content: the public key
+	// is swapped for another after signing.
+	otherKey, _, _ := NewKey()
+	tampered := tamperCSR(t, csr, otherKey.Public())
+
+	tests := []struct {
+		name    string
+		ca      *CA
+		csr     []byte
+		wantErr string
+	}{
+		{name: "P-256 request", ca: ca, csr: csr},
+		{name: "RSA request", ca: ca, csr: rsaCSR},
+		{name: "not PEM", ca: ca, csr: []byte("not a request"), wantErr: "invalid certificate request"},
+		{
+			name:    "certificate instead of a request",
+			ca:      ca,
+			csr:     ca.CertPEM,
+			wantErr: "invalid certificate request",
+		},
+		{
+			name:    "garbage DER",
+			ca:      ca,
+			csr:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: []byte{0x30, 0x03, 0x02, 0x01, 0x01}}),
+			wantErr: "invalid certificate request",
+		},
+		{name: "signature does not match", ca: ca, csr: tampered, wantErr: "invalid certificate request signature"},
+		{name: "CA without its key", ca: &CA{Cert: ca.Cert, CertPEM: ca.CertPEM}, csr: csr, wantErr: "CA key is not loaded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cert, certPEM, err := tt.ca.SignClientCSR(tt.csr, "8c1f7a52-1d4e-4a3b-9f0e-2b6c5d7e8f90", time.Hour)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("SignClientCSR error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("SignClientCSR: %v", err)
+			}
+
+			parsed, err := ParseCertificatePEM(certPEM)
+			if err != nil || !parsed.Equal(cert) {
+				t.Fatalf("PEM does not hold the issued certificate: %v", err)
+			}
+			// The node ID, not the subject the gateway asked for
+			if cert.Subject.CommonName != "8c1f7a52-1d4e-4a3b-9f0e-2b6c5d7e8f90" {
+				t.Errorf("CommonName = %q", cert.Subject.CommonName)
+			}
+			if cert.IsCA || len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+				t.Errorf("certificate is not a client certificate: IsCA %v, ExtKeyUsage %v", cert.IsCA, cert.ExtKeyUsage)
+			}
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: ca.Pool(), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+				t.Errorf("certificate does not verify as a client: %v", err)
+			}
+			if _, err := cert.Verify(x509.VerifyOptions{Roots: ca.Pool()}); err == nil {
+				t.Error("client certificate verifies as a server certificate")
+			}
+		})
+	}
+}
+
+// tamperCSR replaces the public key of a signed request, keeping its signature.
+func tamperCSR(t *testing.T, csrPEM []byte, pub crypto.PublicKey) []byte {
+	t.Helper()
+	block, _ := pem.Decode(csrPEM)
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		t.Fatalf("parse CSR: %v", err)
+	}
+	oldKey := csr.RawSubjectPublicKeyInfo
+	newKey, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	if len(oldKey) != len(newKey) {
+		t.Fatal("keys of different length")
+	}
+	der := []byte(strings.Replace(string(block.Bytes), string(oldKey), string(newKey), 1))
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestCertificateValidity(t *testing.T) {
+	ca := loadTestCA(t)
+	key, _, _ := NewKey()
+	csr, _ := NewCSR(key, "gw")
+
+	cert, _, err := ca.SignClientCSR(csr, "node", time.Hour)
+	if err != nil {
+		t.Fatalf("SignClientCSR: %v", err)
+	}
+	if d := time.Until(cert.NotAfter); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("NotAfter in %v, want an hour", d)
+	}
+	if !cert.NotBefore.Before(time.Now().Add(-4 * time.Minute)) {
+		t.Errorf("NotBefore %v is not backdated", cert.NotBefore)
+	}
+
+	// Never beyond the CA itself
+	cert, _, err = ca.SignClientCSR(csr, "node", 365*24*time.Hour)
+	if err != nil {
+		t.Fatalf("SignClientCSR: %v", err)
+	}
+	if !cert.NotAfter.Equal(ca.Cert.NotAfter) {
+		t.Errorf("NotAfter = %v, want the CA's %v", cert.NotAfter, ca.Cert.NotAfter)
+	}
+}
+
+func TestSerialHex(t *testing.T) {
+	ca := loadTestCA(t)
+	key, _, _ := NewKey()
+	csr, _ := NewCSR(key, "gw")
+
+	// Renewing with the same key must still give a new serial: the previous
+	// certificate keeps verifying against the CA, so the node's current
+	// serial is what revokes it.
+	seen := map[string]bool{}
+	for i := 0; i < 20; i++ {
+		cert, _, err := ca.SignClientCSR(csr, "node", time.Hour)
+		if err != nil {
+			t.Fatalf("SignClientCSR: %v", err)
+		}
+		serial := SerialHex(cert)
+		if seen[serial] {
+			t.Fatalf("serial %s issued twice", serial)
+		}
+		seen[serial] = true
+		if serial != strings.ToLower(serial) || strings.HasPrefix(serial, "0") || cert.SerialNumber.Sign() <= 0 {
+			t.Fatalf("serial %s is not in the stored form", serial)
+		}
+		parsed, _ := ParseCertificatePEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}))
+		if SerialHex(parsed) != serial {
+			t.Fatalf("serial changed after a round trip: %s != %s", SerialHex(parsed), serial)
+		}
+	}
+
+	tests := []struct {
+		serial *big.Int
+		want   string
+	}{
+		{big.NewInt(1), "1"},
+		{big.NewInt(0xabcdef), "abcdef"},
+		{new(big.Int).Lsh(big.NewInt(1), 127), "8" + strings.Repeat("0", 31)},
+	}
+	for _, tt := range tests {
+		if got := SerialHex(&x509.Certificate{SerialNumber: tt.serial}); got != tt.want {
+			t.Errorf("SerialHex(%v) = %s, want %s", tt.serial, got, tt.want)
+		}
+	}
+}
+
+func TestServerCertificate(t *testing.T) {
+	ca := loadTestCA(t)
+	if _, err := ca.ServerCertificate(nil, time.Hour); err == nil {
+		t.Fatal("ServerCertificate issued a certificate without host names")
+	}
+	cert, err := ca.ServerCertificate([]string{"control.example.com", "10.0.0.1"}, time.Hour)
+	if err != nil {
+		t.Fatalf("ServerCertificate: %v", err)
+	}
+	if len(cert.Certificate) != 2 || Fingerprint(ca.Cert) != Fingerprint(mustParse(t, cert.Certificate[1])) {
+		t.Fatal("chain does not end with the CA certificate")
+	}
+	for _, host := range []string{"control.example.com", "10.0.0.1"} {
+		if _, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: ca.Pool(), DNSName: host}); err != nil {
+			t.Errorf("certificate does not verify for %s: %v", host, err)
+		}
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{Roots: ca.Pool(), DNSName: "other.example.com"}); err == nil {
+		t.Error("certificate verifies for another host")
+	}
+}
+
+func mustParse(t *testing.T, der []byte) *x509.Certificate {
+	t.Helper()
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	return cert
+}
+
+func TestNormalizeFingerprint(t *testing.T) {
+	ca := loadTestCA(t)
+	fp := ca.Fingerprint()
+	if len(fp) != 64 {
+		t.Fatalf("fingerprint %q is not hex SHA-256", fp)
+	}
+	var colons []string
+	for i := 0; i < len(fp); i += 2 {
+		colons = append(colons, strings.ToUpper(fp[i:i+2]))
+	}
+	for _, in := range []string{fp, strings.ToUpper(fp), " " + strings.Join(colons, ":") + "\n"} {
+		if got := NormalizeFingerprint(in); got != fp {
+			t.Errorf("NormalizeFingerprint(%q) = %q, want %q", in, got, fp)
+		}
+	}
+}
+
+func TestParsePrivateKeyPEM(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecDER, _ := x509.MarshalECPrivateKey(ecKey)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(ecKey)
+
+	tests := []struct {
+		name    string
+		block   *pem.Block
+		wantErr bool
+	}{
+		{name: "EC", block: &pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}},
+		{name: "PKCS#1", block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}},
+		{name: "PKCS#8", block: &pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}},
+		{name: "EC labelled as RSA", block: &pem.Block{Type: "RSA PRIVATE KEY", Bytes: ecDER}, wantErr: true},
+		{name: "garbage", block: &pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1, 2, 3}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParsePrivateKeyPEM(pem.EncodeToMemory(tt.block))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("ParsePrivateKeyPEM accepted an invalid key")
+				}
+				return
+			}
+			if err != nil || key == nil {
+				t.Fatalf("ParsePrivateKeyPEM: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+package portrange
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// IP protocol numbers used when matching packets.
+const (
+	ProtoTCP = 6
+	ProtoUDP = 17
+)
+
+// Range is a protocol and an inclusive port range. An empty Protocol matches
+// both TCP and UDP.
+type Range struct {
+	Protocol string // "tcp", "udp" or ""
+	From     uint16
+	To       uint16
+}
+
+// Parse reads a comma separated list such as "tcp/443, udp/53, 8000-8100".
+func Parse(value string) ([]Range, error) {
+	var ranges []Range
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item == "" {
+			continue
+		}
+		r, err := parseRange(item)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, r)
+	}
+	return ranges, nil
+}
+
+func parseRange(item string) (Range, error) {
+	var r Range
+	ports := item
+	if proto, rest, ok := strings.Cut(item, "/"); ok {
+		if proto != "tcp" && proto != "udp" {
+			return r, fmt.Errorf("invalid protocol in %q: must be tcp or udp", item)
+		}
+		r.Protocol = proto
+		ports = rest
+	}
+
+	fromStr, toStr, isRange := strings.Cut(ports, "-")
+	from, err := parsePort(fromStr)
+	if err != nil {
+		return r, fmt.Errorf("invalid port in %q", item)
+	}
+	to := from
+	if isRange {
+		if to, err = parsePort(toStr); err != nil || to < from {
+			return r, fmt.Errorf("invalid port range in %q", item)
+		}
+	}
+	r.From, r.To = from, to
+	return r, nil
+}
+
+func parsePort(s string) (uint16, error) {
+	n, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid port %q", s)
+	}
+	return uint16(n), nil
+}
+
+// String formats the range the way Parse reads it.
+func (r Range) String() string {
+	ports := strconv.Itoa(int(r.From))
+	if r.To != r.From {
+		ports += "-" + strconv.Itoa(int(r.To))
+	}
+	if r.Protocol == "" {
+		return ports
+	}
+	return r.Protocol + "/" + ports
+}
+
+// Matches reports whether a packet with the given IP protocol number and
+// destination port falls in the range.
+func (r Range) Matches(proto uint8, port uint16) bool {
+	switch r.Protocol {
+	case "tcp":
+		if proto != ProtoTCP {
+			return false
+		}
+	case "udp":
+		if proto != ProtoUDP {
+			return false
+		}
+	default:
+		if proto != ProtoTCP && proto != ProtoUDP {
+			return false
+		}
+	}
+	return port >= r.From && port <= r.To
+}
+
+// MatchAny reports whether any of the ranges matches.
+func MatchAny(ranges []Range, proto uint8, port uint16) bool {
+	for _, r := range ranges {
+		if r.Matches(proto, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// Format joins ranges into the comma separated form accepted by Parse.
+func Format(ranges []Range) string {
+	parts := make([]string, len(ranges))
+	for i, r := range ranges {
+		parts[i] = r.String()
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,106 @@
+package portrange
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []Range
+		wantErr bool
+	}{
+		{value: "", want: nil},
+		{value: " , ", want: nil},
+		{value: "443", want: []Range{{From: 443, To: 443}}},
+		{value: "tcp/443", want: []Range{{Protocol: "tcp", From: 443, To: 443}}},
+		{value: "UDP/53", want: []Range{{Protocol: "udp", From: 53, To: 53}}},
+		{value: "8000-8100", want: []Range{{From: 8000, To: 8100}}},
+		{value: "tcp/ 1 - 65535 ", want: []Range{{Protocol: "tcp", From: 1, To: 65535}}},
+		{
+			value: "tcp/443, udp/53,8000-8100,",
+			want: []Range{
+				{Protocol: "tcp", From: 443, To: 443},
+				{Protocol: "udp", From: 53, To: 53},
+				{From: 8000, To: 8100},
+			},
+		},
+
+		{value: "icmp/0", wantErr: true},
+		{value: "/443", wantErr: true},
+		{value: "tcp/", wantErr: true},
+		{value: "0", wantErr: true},
+		{value: "65536", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "http", wantErr: true},
+		{value: "100-", wantErr: true},
+		{value: "100-90", wantErr: true},
+		{value: "1-2-3", wantErr: true},
+		{value: "443, tcp/x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := Parse(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Parse(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.value, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Parse(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for _, value := range []string{"443", "tcp/443", "udp/53,8000-8100", "tcp/1-65535,udp/1-65535"} {
+		ranges, err := Parse(value)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", value, err)
+		}
+		if got := Format(ranges); got != value {
+			t.Errorf("Format(Parse(%q)) = %q", value, got)
+		}
+	}
+	if got := Format(nil); got != "" {
+		t.Errorf("Format(nil) = %q, want empty", got)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	const icmp = 1
+	tests := []struct {
+		r     Range
+		proto uint8
+		port  uint16
+		want  bool
+	}{
+		{Range{Protocol: "tcp", From: 443, To: 443}, ProtoTCP, 443, true},
+		{Range{Protocol: "tcp", From: 443, To: 443}, ProtoUDP, 443, false},
+		{Range{Protocol: "tcp", From: 443, To: 443}, ProtoTCP, 444, false},
+		{Range{Protocol: "udp", From: 53, To: 53}, ProtoUDP, 53, true},
+		{Range{Protocol: "udp", From: 53, To: 53}, ProtoTCP, 53, false},
+		{Range{From: 8000, To: 8100}, ProtoTCP, 8000, true},
+		{Range{From: 8000, To: 8100}, ProtoUDP, 8100, true},
+		{Range{From: 8000, To: 8100}, ProtoTCP, 7999, false},
+		{Range{From: 8000, To: 8100}, ProtoTCP, 8101, false},
+		{Range{From: 1, To: 65535}, icmp, 0, false},
+		{Range{From: 1, To: 65535}, ProtoTCP, 0, false},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Matches(tt.proto, tt.port); got != tt.want {
+			t.Errorf("%v.Matches(%d, %d) = %v, want %v", tt.r, tt.proto, tt.port, got, tt.want)
+		}
+	}
+
+	ranges, _ := Parse("tcp/443,udp/53")
+	if !MatchAny(ranges, ProtoUDP, 53) || MatchAny(ranges, ProtoUDP, 443) || MatchAny(nil, ProtoTCP, 443) {
+		t.Error("MatchAny does not match exactly the listed ranges")
+	}
+}
@@ -0,0 +1,258 @@
+package posture
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxReportAge is how old a signed report may be when it is presented.
+const MaxReportAge = 5 * time.Minute
+
+// Report is the device state collected by the ztna-client.
+type Report struct {
+	Hostname          string `json:"hostname"`
+	OS                string `json:"os"` // "windows", "linux", "darwin"
+	OSVersion         string `json:"os_version"`
+	DiskEncrypted     bool   `json:"disk_encrypted"`
+	FirewallEnabled   bool   `json:"firewall_enabled"`
+	ScreenLockEnabled bool   `json:"screen_lock_enabled"`
+	ClientVersion     string `json:"client_version"`
+	Timestamp         int64  `json:"timestamp"` // Unix seconds
+}
+
+// Envelope carries a report signed by the device identity key.
+// The signature covers the raw payload bytes, so no canonical JSON is needed.
+type Envelope struct {
+	Payload   string `json:"payload"`    // base64(JSON Report)
+	PublicKey string `json:"public_key"` // base64(ed25519 public key)
+	Signature string `json:"signature"`  // base64(ed25519 signature over payload bytes)
+}
+
+// DeviceID derives the stable device identifier from its public key.
+func DeviceID(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign builds an envelope for the report. Used by clients and tooling.
+func Sign(report Report, privateKey ed25519.PrivateKey) (*Envelope, error) {
+	payload, err := json.Marshal(report)
+	if err != nil {
+		return nil, err
+	}
+	pub, ok := privateKey.Public().(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("invalid device key")
+	}
+	return &Envelope{
+		Payload:   base64.StdEncoding.EncodeToString(payload),
+		PublicKey: base64.StdEncoding.EncodeToString(pub),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(privateKey, payload)),
+	}, nil
+}
+
+// Verify checks the envelope signature and freshness and returns the report
+// together with the device ID derived from the signing key.
+func (e *Envelope) Verify(now time.Time) (*Report, string, error) {
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return nil, "", errors.New("invalid posture payload encoding")
+	}
+	pub, err := base64.StdEncoding.DecodeString(e.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return nil, "", errors.New("invalid device public key")
+	}
+	sig, err := base64.StdEncoding.DecodeString(e.Signature)
+	if err != nil {
+		return nil, "", errors.New("invalid posture signature encoding")
+	}
+	if !ed25519.Verify(pub, payload, sig) {
+		return nil, "", errors.New("posture signature verification failed")
+	}
+
+	var report Report
+	if err := json.Unmarshal(payload, &report); err != nil {
+		return nil, "", errors.New("invalid posture payload")
+	}
+
+	age := now.Sub(time.Unix(report.Timestamp, 0))
+	if age > MaxReportAge || age < -MaxReportAge {
+		return nil, "", errors.New("posture report is stale")
+	}
+
+	return &report, DeviceID(ed25519.PublicKey(pub)), nil
+}
+
+// Supported fields for "Device" policy conditions evaluated against a report.
+// "os" is handled separately as an identity-like source tag.
+const (
+	FieldOSVersion         = "os_version"
+	FieldDiskEncrypted     = "disk_encrypted"
+	FieldFirewallEnabled   = "firewall_enabled"
+	FieldScreenLockEnabled = "screen_lock_enabled"
+	FieldClientVersion     = "client_version"
+)
+
+// IsPostureField reports whether the field is evaluated against a posture report.
+func IsPostureField(field string) bool {
+	switch strings.ToLower(field) {
+	case FieldOSVersion, FieldDiskEncrypted, FieldFirewallEnabled, FieldScreenLockEnabled, FieldClientVersion:
+		return true
+	}
+	return false
+}
+
+// Condition is a single posture requirement, e.g. disk_encrypted equals true
+// or client_version gte 0.2.0.
+type Condition struct {
+	Field string `json:"field"`
+	Op    string `json:"op"`
+	Value string `json:"value"`
+}
+
+// Matches evaluates the condition. A missing report never matches.
+func (c Condition) Matches(report *Report) bool {
+	if report == nil {
+		return false
+	}
+
+	op := strings.ToLower(strings.TrimSpace(c.Op))
+	target := strings.TrimSpace(c.Value)
+
+	switch strings.ToLower(c.Field) {
+	case FieldDiskEncrypted:
+		return compareBool(report.DiskEncrypted, op, target)
+	case FieldFirewallEnabled:
+		return compareBool(report.FirewallEnabled, op, target)
+	case FieldScreenLockEnabled:
+		return compareBool(report.ScreenLockEnabled, op, target)
+	case FieldOSVersion:
+		return compareVersion(report.OSVersion, op, target)
+	case FieldClientVersion:
+		return compareVersion(report.ClientVersion, op, target)
+	}
+	return false
+}
+
+// Validate checks that the field and operator are supported and that
+// boolean fields compare against "true" or "false".
+func (c Condition) Validate() error {
+	op := strings.ToLower(strings.TrimSpace(c.Op))
+	switch strings.ToLower(c.Field) {
+	case FieldDiskEncrypted, FieldFirewallEnabled, FieldScreenLockEnabled:
+		if _, err := strconv.ParseBool(strings.TrimSpace(c.Value)); err != nil {
+			return fmt.Errorf("%s expects true or false, got %q", c.Field, c.Value)
+		}
+		switch op {
+		case "", "equals", "is", "not_equals", "not":
+			return nil
+		}
+	case FieldOSVersion, FieldClientVersion:
+		switch op {
+		case "equals", "is", "not_equals", "not", "contains", "starts_with", "gte", "gt", "lte", "lt":
+			return nil
+		}
+	default:
+		return fmt.Errorf("unsupported posture field %q", c.Field)
+	}
+	return fmt.Errorf("unsupported operator %q for %s", c.Op, c.Field)
+}
+
+// AllMatch reports whether the report satisfies every condition.
+func AllMatch(conds []Condition, report *Report) bool {
+	for _, c := range conds {
+		if !c.Matches(report) {
+			return false
+		}
+	}
+	return true
+}
+
+func compareBool(val bool, op, target string) bool {
+	want, err := strconv.ParseBool(target)
+	if err != nil {
+		return false
+	}
+	switch op {
+	case "", "equals", "is":
+		return val == want
+	case "not_equals", "not":
+		return val != want
+	}
+	return false
+}
+
+func compareVersion(val, op, target string) bool {
+	switch op {
+	case "equals", "is":
+		return strings.EqualFold(val, target)
+	case "not_equals", "not":
+		return !strings.EqualFold(val, target)
+	case "contains":
+		return strings.Contains(strings.ToLower(val), strings.ToLower(target))
+	case "starts_with":
+		return strings.HasPrefix(strings.ToLower(val), strings.ToLower(target))
+	case "gte":
+		return CompareVersions(val, target) >= 0
+	case "gt":
+		return CompareVersions(val, target) > 0
+	case "lte":
+		return CompareVersions(val, target) <= 0
+	case "lt":
+		return CompareVersions(val, target) < 0
+	}
+	return false
+}
+
+// CompareVersions compares dotted numeric versions ("10.0.22631", "0.2.1").
+// Non-numeric prefixes and suffixes of each component are ignored.
+func CompareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimSpace(strings.ToLower(v)), "v")
+	var parts []int
+	for _, p := range strings.Split(v, ".") {
+		digits := strings.TrimLeftFunc(p, func(r rune) bool { return r < '0' || r > '9' })
+		end := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' })
+		if end >= 0 {
+			digits = digits[:end]
+		}
+		n, _ := strconv.Atoi(digits)
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// String is used in logs.
+func (r *Report) String() string {
+	if r == nil {
+		return "<no posture>"
+	}
+	return fmt.Sprintf("%s %s (disk=%v fw=%v lock=%v client=%s)", r.OS, r.OSVersion, r.DiskEncrypted, r.FirewallEnabled, r.ScreenLockEnabled, r.ClientVersion)
+}
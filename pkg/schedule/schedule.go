@@ -0,0 +1,229 @@
+package schedule
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Supported fields for "Time" policy conditions.
+const (
+	FieldTimeOfDay = "time_of_day" // Value: "09:00-18:00" (may wrap past midnight, e.g. "22:00-06:00")
+	FieldWeekday   = "weekday"     // Value: "mon,tue,wed,thu,fri"
+	FieldDate      = "date"        // Value: "2026-01-01/2026-12-31", "2026-12-31" or RFC3339 timestamps
+)
+
+// Condition is a single time constraint. It mirrors the Field/Op/Value/Timezone
+// columns of a "Time" PolicyCondition so it can be evaluated both by the
+// auth-api at sign-in and by gateways on live sessions.
+type Condition struct {
+	Field    string `json:"field"`
+	Op       string `json:"op"`
+	Value    string `json:"value"`
+	Timezone string `json:"timezone,omitempty"` // IANA name, e.g. "Asia/Bangkok". Defaults to UTC.
+}
+
+// Matches reports whether the condition holds at the given instant.
+func (c Condition) Matches(now time.Time) (bool, error) {
+	loc, err := loadLocation(c.Timezone)
+	if err != nil {
+		return false, err
+	}
+	now = now.In(loc)
+
+	var matched bool
+	op := strings.ToLower(strings.TrimSpace(c.Op))
+
+	switch strings.ToLower(strings.TrimSpace(c.Field)) {
+	case FieldTimeOfDay:
+		start, end, err := parseClockRange(c.Value)
+		if err != nil {
+			return false, err
+		}
+		minute := now.Hour()*60 + now.Minute()
+		if start <= end {
+			matched = minute >= start && minute < end
+		} else {
+			// Window wraps past midnight
+			matched = minute >= start || minute < end
+		}
+		switch op {
+		case "", "between", "in":
+		case "not_between", "not_in":
+			matched = !matched
+		default:
+			return false, fmt.Errorf("unsupported operator %q for %s", c.Op, FieldTimeOfDay)
+		}
+
+	case FieldWeekday:
+		days, err := parseWeekdays(c.Value)
+		if err != nil {
+			return false, err
+		}
+		matched = days[now.Weekday()]
+		switch op {
+		case "", "in", "equals", "is":
+		case "not_in", "not_equals", "not":
+			matched = !matched
+		default:
+			return false, fmt.Errorf("unsupported operator %q for %s", c.Op, FieldWeekday)
+		}
+
+	case FieldDate:
+		switch op {
+		case "", "between":
+			parts := strings.SplitN(c.Value, "/", 2)
+			if len(parts) != 2 {
+				return false, fmt.Errorf("date range must be in the form start/end: %q", c.Value)
+			}
+			from, _, err := parseDate(parts[0], loc)
+			if err != nil {
+				return false, err
+			}
+			_, until, err := parseDate(parts[1], loc)
+			if err != nil {
+				return false, err
+			}
+			matched = !now.Before(from) && now.Before(until)
+		case "from", "after":
+			from, _, err := parseDate(c.Value, loc)
+			if err != nil {
+				return false, err
+			}
+			matched = !now.Before(from)
+		case "until", "before":
+			// Inclusive of the whole day when only a date is given,
+			// so "until 2026-12-31" still allows access on the 31st.
+			_, until, err := parseDate(c.Value, loc)
+			if err != nil {
+				return false, err
+			}
+			matched = now.Before(until)
+		default:
+			return false, fmt.Errorf("unsupported operator %q for %s", c.Op, FieldDate)
+		}
+
+	default:
+		return false, fmt.Errorf("unsupported time field %q", c.Field)
+	}
+
+	return matched, nil
+}
+
+// AllMatch reports whether every condition holds at the given instant.
+// Invalid conditions never match, so a broken schedule fails closed.
+func AllMatch(conds []Condition, now time.Time) bool {
+	for _, c := range conds {
+		if ok, err := c.Matches(now); err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks that the condition can be evaluated.
+func (c Condition) Validate() error {
+	_, err := c.Matches(time.Now())
+	return err
+}
+
+func loadLocation(name string) (*time.Location, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// parseClockRange parses "HH:MM-HH:MM" into minutes since midnight.
+func parseClockRange(value string) (int, int, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("time window must be in the form HH:MM-HH:MM: %q", value)
+	}
+	start, err := parseClock(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return start, end, nil
+}
+
+func parseClock(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if value == "24:00" {
+		return 24 * 60, nil
+	}
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q: expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// parseWeekdays parses a comma separated list of day names. Ranges like
+// "mon-fri" are also accepted.
+func parseWeekdays(value string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	for _, part := range strings.Split(value, ",") {
+		part = strings.ToLower(strings.Trim(strings.TrimSpace(part), "[]\""))
+		if part == "" {
+			continue
+		}
+		if from, to, ok := strings.Cut(part, "-"); ok {
+			start, ok1 := weekdayNames[strings.TrimSpace(from)]
+			end, ok2 := weekdayNames[strings.TrimSpace(to)]
+			if !ok1 || !ok2 {
+				return nil, fmt.Errorf("invalid weekday range %q", part)
+			}
+			for d := start; ; d = (d + 1) % 7 {
+				days[d] = true
+				if d == end {
+					break
+				}
+			}
+			continue
+		}
+		d, ok := weekdayNames[part]
+		if !ok {
+			return nil, fmt.Errorf("invalid weekday %q", part)
+		}
+		days[d] = true
+	}
+	if len(days) == 0 {
+		return nil, fmt.Errorf("no weekdays given")
+	}
+	return days, nil
+}
+
+// parseDate parses either a date ("2006-01-02") or an RFC3339 timestamp.
+// It returns the instant the value starts and the instant it ends: for a
+// plain date that is the whole day in loc, for a timestamp both are equal.
+func parseDate(value string, loc *time.Location) (time.Time, time.Time, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q: expected YYYY-MM-DD or RFC3339", value)
+	}
+	return t, t.AddDate(0, 0, 1), nil
+}
@@ -0,0 +1,136 @@
+package schedule
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata" // the tests must not depend on the host's zoneinfo
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestMatches(t *testing.T) {
+	// 2026-03-02 is a Monday
+	tests := []struct {
+		name string
+		cond Condition
+		now  string
+		want bool
+	}{
+		{"inside window", Condition{Field: FieldTimeOfDay, Value: "09:00-18:00"}, "2026-03-02T10:30:00Z", true},
+		{"window start is inclusive", Condition{Field: FieldTimeOfDay, Value: "09:00-18:00"}, "2026-03-02T09:00:00Z", true},
+		{"window end is exclusive", Condition{Field: FieldTimeOfDay, Value: "09:00-18:00"}, "2026-03-02T18:00:00Z", false},
+		{"before window", Condition{Field: FieldTimeOfDay, Value: "09:00-18:00"}, "2026-03-02T08:59:59Z", false},
+		{"whole day", Condition{Field: FieldTimeOfDay, Value: "00:00-24:00"}, "2026-03-02T23:59:00Z", true},
+		{"spaces and operator case", Condition{Field: " Time_Of_Day ", Op: "BETWEEN", Value: " 09:00 - 18:00 "}, "2026-03-02T10:30:00Z", true},
+		{"wrapping window late", Condition{Field: FieldTimeOfDay, Value: "22:00-06:00"}, "2026-03-02T23:00:00Z", true},
+		{"wrapping window early", Condition{Field: FieldTimeOfDay, Value: "22:00-06:00"}, "2026-03-02T05:59:00Z", true},
+		{"wrapping window end", Condition{Field: FieldTimeOfDay, Value: "22:00-06:00"}, "2026-03-02T06:00:00Z", false},
+		{"outside wrapping window", Condition{Field: FieldTimeOfDay, Value: "22:00-06:00"}, "2026-03-02T12:00:00Z", false},
+		{"not_between inside", Condition{Field: FieldTimeOfDay, Op: "not_between", Value: "09:00-18:00"}, "2026-03-02T10:30:00Z", false},
+		{"not_between outside", Condition{Field: FieldTimeOfDay, Op: "not_in", Value: "09:00-18:00"}, "2026-03-02T20:00:00Z", true},
+		{"window in the condition's time zone", Condition{Field: FieldTimeOfDay, Value: "09:00-17:00", Timezone: "Asia/Bangkok"}, "2026-03-02T10:30:00Z", false},
+		{"window in the condition's time zone matches", Condition{Field: FieldTimeOfDay, Value: "17:00-18:00", Timezone: "Asia/Bangkok"}, "2026-03-02T10:30:00Z", true},
+		{"window across a DST change", Condition{Field: FieldTimeOfDay, Value: "09:00-10:00", Timezone: "America/New_York"}, "2026-03-09T13:30:00Z", true},
+
+		{"weekday range", Condition{Field: FieldWeekday, Value: "mon-fri"}, "2026-03-02T10:00:00Z", true},
+		{"weekend outside range", Condition{Field: FieldWeekday, Value: "mon-fri"}, "2026-03-01T10:00:00Z", false},
+		{"wrapping weekday range", Condition{Field: FieldWeekday, Value: "fri-mon"}, "2026-03-01T10:00:00Z", true},
+		{"outside wrapping weekday range", Condition{Field: FieldWeekday, Value: "fri-mon"}, "2026-03-04T10:00:00Z", false},
+		{"weekday list with full names", Condition{Field: FieldWeekday, Op: "in", Value: "Monday, Wednesday"}, "2026-03-02T10:00:00Z", true},
+		{"weekday JSON-style list", Condition{Field: FieldWeekday, Value: `["tue","mon"]`}, "2026-03-02T10:00:00Z", true},
+		{"weekday not_in", Condition{Field: FieldWeekday, Op: "not_in", Value: "sat,sun"}, "2026-03-02T10:00:00Z", true},
+		{"weekday in the condition's time zone", Condition{Field: FieldWeekday, Value: "mon", Timezone: "Asia/Bangkok"}, "2026-03-01T20:00:00Z", true},
+		{"same instant in UTC", Condition{Field: FieldWeekday, Value: "mon"}, "2026-03-01T20:00:00Z", false},
+
+		{"date range includes its last day", Condition{Field: FieldDate, Value: "2026-03-01/2026-03-02"}, "2026-03-02T23:59:59Z", true},
+		{"date range ends after its last day", Condition{Field: FieldDate, Value: "2026-03-01/2026-03-02"}, "2026-03-03T00:00:00Z", false},
+		{"date range starts on its first day", Condition{Field: FieldDate, Op: "between", Value: "2026-03-01/2026-03-02"}, "2026-03-01T00:00:00Z", true},
+		{"timestamp range", Condition{Field: FieldDate, Value: "2026-03-02T09:00:00Z/2026-03-02T10:00:00Z"}, "2026-03-02T10:00:00Z", false},
+		{"from date", Condition{Field: FieldDate, Op: "from", Value: "2026-03-02"}, "2026-03-02T00:00:00Z", true},
+		{"before from date", Condition{Field: FieldDate, Op: "after", Value: "2026-03-02"}, "2026-03-01T23:59:59Z", false},
+		{"until includes the day", Condition{Field: FieldDate, Op: "until", Value: "2026-03-02"}, "2026-03-02T23:00:00Z", true},
+		{"until in the condition's time zone", Condition{Field: FieldDate, Op: "until", Value: "2026-03-02", Timezone: "Asia/Bangkok"}, "2026-03-02T17:30:00Z", false},
+		{"before timestamp", Condition{Field: FieldDate, Op: "before", Value: "2026-03-02T12:00:00+07:00"}, "2026-03-02T04:59:59Z", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.cond.Matches(at(tt.now))
+			if err != nil {
+				t.Fatalf("Matches: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("%+v at %s = %v, want %v", tt.cond, tt.now, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cond    Condition
+		wantErr string
+	}{
+		{"valid window", Condition{Field: FieldTimeOfDay, Value: "09:00-18:00", Timezone: "Europe/Berlin"}, ""},
+		{"unknown field", Condition{Field: "month", Value: "3"}, "unsupported time field"},
+		{"unknown time zone", Condition{Field: FieldTimeOfDay, Value: "09:00-18:00", Timezone: "Mars/Olympus"}, "invalid timezone"},
+		{"window operator", Condition{Field: FieldTimeOfDay, Op: "equals", Value: "09:00-18:00"}, "unsupported operator"},
+		{"window without end", Condition{Field: FieldTimeOfDay, Value: "09:00"}, "HH:MM-HH:MM"},
+		{"hours only", Condition{Field: FieldTimeOfDay, Value: "9-17"}, "expected HH:MM"},
+		{"hour out of range", Condition{Field: FieldTimeOfDay, Value: "09:00-25:00"}, "expected HH:MM"},
+		{"weekday operator", Condition{Field: FieldWeekday, Op: "between", Value: "mon"}, "unsupported operator"},
+		{"unknown weekday", Condition{Field: FieldWeekday, Value: "mon,funday"}, "invalid weekday"},
+		{"unknown weekday in range", Condition{Field: FieldWeekday, Value: "mon-someday"}, "invalid weekday range"},
+		{"no weekdays", Condition{Field: FieldWeekday, Value: " , "}, "no weekdays"},
+		{"date operator", Condition{Field: FieldDate, Op: "in", Value: "2026-03-01"}, "unsupported operator"},
+		{"date range without end", Condition{Field: FieldDate, Value: "2026-03-01"}, "start/end"},
+		{"invalid date", Condition{Field: FieldDate, Op: "from", Value: "01/03/2026"}, "invalid date"},
+		{"invalid range end", Condition{Field: FieldDate, Value: "2026-03-01/2026-02-30"}, "invalid date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.cond.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Validate error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAllMatch(t *testing.T) {
+	now := at("2026-03-02T10:30:00Z")
+	hours := Condition{Field: FieldTimeOfDay, Value: "09:00-18:00"}
+	weekdays := Condition{Field: FieldWeekday, Value: "mon-fri"}
+	weekend := Condition{Field: FieldWeekday, Value: "sat,sun"}
+	broken := Condition{Field: FieldTimeOfDay, Op: "not_between", Value: "9-17"}
+
+	tests := []struct {
+		name  string
+		conds []Condition
+		want  bool
+	}{
+		{"no conditions", nil, true},
+		{"all hold", []Condition{hours, weekdays}, true},
+		{"one does not hold", []Condition{hours, weekend}, false},
+		// A not_between condition that cannot be parsed must not turn into "always"
+		{"invalid condition fails closed", []Condition{hours, broken}, false},
+	}
+	for _, tt := range tests {
+		if got := AllMatch(tt.conds, now); got != tt.want {
+			t.Errorf("%s: AllMatch = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
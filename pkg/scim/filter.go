@@ -0,0 +1,349 @@
+// Package scim parses the filter and PATCH path expressions of SCIM 2.0
+// (RFC 7644 section 3.4.2.2 and 3.5.2).
+package scim
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a parsed filter expression: *Compare, *Logical, *Not or *ValuePath.
+type Expr interface {
+	expr()
+}
+
+// Compare is "attr op value", or "attr pr" with a nil Value. Attr is lower-cased
+// with core schema URNs removed, e.g. "username" or "emails.value". Value is
+// a string, float64, bool or nil.
+type Compare struct {
+	Attr  string
+	Op    string // eq, ne, co, sw, ew, gt, ge, lt, le, pr
+	Value interface{}
+}
+
+// Logical joins two expressions with "and" or "or".
+type Logical struct {
+	Op          string
+	Left, Right Expr
+}
+
+// Not negates an expression.
+type Not struct {
+	X Expr
+}
+
+// ValuePath filters the values of a multi-valued attribute, e.g.
+// members[value eq "id"]. Attributes inside Filter are relative to Attr.
+type ValuePath struct {
+	Attr   string
+	Filter Expr
+}
+
+func (*Compare) expr()   {}
+func (*Logical) expr()   {}
+func (*Not) expr()       {}
+func (*ValuePath) expr() {}
+
+// Path is the target of a PATCH operation: attr, attr.sub or attr[filter].sub.
+type Path struct {
+	Attr    string
+	Filter  Expr
+	SubAttr string
+}
+
+var operators = map[string]bool{
+	"eq": true, "ne": true, "co": true, "sw": true, "ew": true,
+	"gt": true, "ge": true, "lt": true, "le": true, "pr": true,
+}
+
+var corePrefixes = []string{
+	"urn:ietf:params:scim:schemas:core:2.0:user:",
+	"urn:ietf:params:scim:schemas:core:2.0:group:",
+}
+
+// AttrName lower-cases an attribute path and strips core schema URNs.
+func AttrName(s string) string {
+	s = strings.ToLower(s)
+	for _, prefix := range corePrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return strings.TrimPrefix(s, prefix)
+		}
+	}
+	return s
+}
+
+// ParseFilter parses a filter such as `userName eq "bjensen" and active eq true`.
+func ParseFilter(s string) (Expr, error) {
+	p, err := newParser(s)
+	if err != nil {
+		return nil, err
+	}
+	e, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, fmt.Errorf("unexpected %q in filter", p.peek().text)
+	}
+	return e, nil
+}
+
+// ParsePath parses a PATCH path such as `members[value eq "2819c223"]` or `name.givenName`.
+func ParsePath(s string) (*Path, error) {
+	p, err := newParser(s)
+	if err != nil {
+		return nil, err
+	}
+	t := p.next()
+	if t.kind != tokIdent {
+		return nil, fmt.Errorf("invalid path %q", s)
+	}
+	path := &Path{Attr: AttrName(t.text)}
+
+	if p.peek().kind == tokLBracket {
+		p.next()
+		if path.Filter, err = p.parseOr(); err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRBracket {
+			return nil, fmt.Errorf("missing ] in path %q", s)
+		}
+		if sub := p.peek(); sub.kind == tokIdent && strings.HasPrefix(sub.text, ".") {
+			p.next()
+			path.SubAttr = strings.ToLower(strings.TrimPrefix(sub.text, "."))
+		}
+	} else if i := strings.LastIndex(path.Attr, "."); i > 0 && !strings.Contains(path.Attr, ":") {
+		path.Attr, path.SubAttr = path.Attr[:i], path.Attr[i+1:]
+	}
+
+	if !p.done() {
+		return nil, fmt.Errorf("invalid path %q", s)
+	}
+	return path, nil
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokNumber
+	tokLParen
+	tokRParen
+	tokLBracket
+	tokRBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func newParser(s string) (*parser, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokLParen, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokRParen, ")"})
+			i++
+		case c == '[':
+			tokens = append(tokens, token{tokLBracket, "["})
+			i++
+		case c == ']':
+			tokens = append(tokens, token{tokRBracket, "]"})
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string in %q", s)
+			}
+			var v string
+			if err := json.Unmarshal([]byte(s[i:j+1]), &v); err != nil {
+				return nil, fmt.Errorf("invalid string in %q", s)
+			}
+			tokens = append(tokens, token{tokString, v})
+			i = j + 1
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && strings.IndexByte("0123456789.eE+-", s[j]) >= 0 {
+				j++
+			}
+			tokens = append(tokens, token{tokNumber, s[i:j]})
+			i = j
+		case isIdentChar(c):
+			j := i
+			for j < len(s) && isIdentChar(s[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, s[i:j]})
+			i = j
+		default:
+			return nil, fmt.Errorf("unexpected character %q in %q", c, s)
+		}
+	}
+	return &parser{tokens: tokens}, nil
+}
+
+func isIdentChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+		c == '.' || c == ':' || c == '_' || c == '-' || c == '$'
+}
+
+func (p *parser) peek() token {
+	if p.pos >= len(p.tokens) {
+		return token{kind: tokEOF}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.tokens)
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokIdent && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "or", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &Logical{Op: "and", Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	if p.keyword("not") {
+		if p.peek().kind != tokLParen {
+			return nil, fmt.Errorf("expected ( after not")
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &Not{X: x}, nil
+	}
+
+	t := p.next()
+	switch t.kind {
+	case tokLParen:
+		e, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokRParen {
+			return nil, fmt.Errorf("missing ) in filter")
+		}
+		return e, nil
+
+	case tokIdent:
+		attr := AttrName(t.text)
+		if p.peek().kind == tokLBracket {
+			p.next()
+			inner, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if p.next().kind != tokRBracket {
+				return nil, fmt.Errorf("missing ] in filter")
+			}
+			return &ValuePath{Attr: attr, Filter: inner}, nil
+		}
+
+		op := p.next()
+		opName := strings.ToLower(op.text)
+		if op.kind != tokIdent || !operators[opName] {
+			return nil, fmt.Errorf("invalid operator %q after %s", op.text, t.text)
+		}
+		if opName == "pr" {
+			return &Compare{Attr: attr, Op: opName}, nil
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return &Compare{Attr: attr, Op: opName, Value: value}, nil
+
+	default:
+		return nil, fmt.Errorf("unexpected %q in filter", t.text)
+	}
+}
+
+func (p *parser) parseValue() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return t.text, nil
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", t.text)
+		}
+		return f, nil
+	case tokIdent:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid value %q in filter", t.text)
+}
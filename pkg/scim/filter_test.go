@@ -0,0 +1,144 @@
+package scim
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// show renders an expression with explicit grouping, e.g. (and (eq username "a") (pr title)).
+func show(e Expr) string {
+	switch e := e.(type) {
+	case *Compare:
+		if e.Op == "pr" {
+			return fmt.Sprintf("(pr %s)", e.Attr)
+		}
+		if s, ok := e.Value.(string); ok {
+			return fmt.Sprintf("(%s %s %q)", e.Op, e.Attr, s)
+		}
+		return fmt.Sprintf("(%s %s %v)", e.Op, e.Attr, e.Value)
+	case *Logical:
+		return fmt.Sprintf("(%s %s %s)", e.Op, show(e.Left), show(e.Right))
+	case *Not:
+		return fmt.Sprintf("(not %s)", show(e.X))
+	case *ValuePath:
+		return fmt.Sprintf("%s[%s]", e.Attr, show(e.Filter))
+	}
+	return fmt.Sprintf("%#v", e)
+}
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		filter  string
+		want    string
+		wantErr string
+	}{
+		{filter: `userName eq "bjensen"`, want: `(eq username "bjensen")`},
+		{filter: `USERNAME EQ "BJensen"`, want: `(eq username "BJensen")`},
+		{filter: `urn:ietf:params:scim:schemas:core:2.0:User:userName sw "J"`, want: `(sw username "J")`},
+		{filter: `urn:ietf:params:scim:schemas:core:2.0:Group:displayName eq "Ops"`, want: `(eq displayname "Ops")`},
+		{filter: `name.familyName co "O'Malley"`, want: `(co name.familyname "O'Malley")`},
+		{filter: `title pr`, want: `(pr title)`},
+		{filter: `active eq true`, want: `(eq active true)`},
+		{filter: `active ne False`, want: `(ne active false)`},
+		{filter: `manager eq null`, want: `(eq manager <nil>)`},
+		{filter: `age ge 21`, want: `(ge age 21)`},
+		{filter: `score lt -1.5e2`, want: `(lt score -150)`},
+		{filter: `displayName eq "say \"hi\" \\ é"`, want: `(eq displayname "say \"hi\" \\ é")`},
+		{filter: `externalId eq ""`, want: `(eq externalid "")`},
+
+		// and binds tighter than or, both associate to the left
+		{filter: `a eq "1" or b eq "2" and c eq "3"`, want: `(or (eq a "1") (and (eq b "2") (eq c "3")))`},
+		{filter: `a eq "1" and b eq "2" or c eq "3"`, want: `(or (and (eq a "1") (eq b "2")) (eq c "3"))`},
+		{filter: `a pr and b pr and c pr`, want: `(and (and (pr a) (pr b)) (pr c))`},
+		{filter: `(a eq "1" or b eq "2") and c eq "3"`, want: `(and (or (eq a "1") (eq b "2")) (eq c "3"))`},
+		{filter: `not (a pr) and b pr`, want: `(and (not (pr a)) (pr b))`},
+		{filter: `a pr AND NOT (b pr OR c pr)`, want: `(and (pr a) (not (or (pr b) (pr c))))`},
+
+		{filter: `emails[type eq "work" and value co "@example.com"]`, want: `emails[(and (eq type "work") (co value "@example.com"))]`},
+		{filter: `userType eq "Employee" and emails[type eq "work"]`, want: `(and (eq usertype "Employee") emails[(eq type "work")])`},
+		{filter: `members[value eq "2819c223-7f76-453a-919d-413861904646"]`, want: `members[(eq value "2819c223-7f76-453a-919d-413861904646")]`},
+
+		{filter: ``, wantErr: `unexpected ""`},
+		{filter: `userName`, wantErr: "invalid operator"},
+		{filter: `userName like "b"`, wantErr: "invalid operator"},
+		{filter: `userName eq`, wantErr: "invalid value"},
+		{filter: `userName eq bjensen`, wantErr: "invalid value"},
+		{filter: `userName eq "bjensen`, wantErr: "unterminated string"},
+		{filter: `userName eq "bad \x escape"`, wantErr: "invalid string"},
+		{filter: `age gt 1.2.3`, wantErr: "invalid number"},
+		{filter: `userName eq "a" and`, wantErr: `unexpected ""`},
+		{filter: `userName eq "a" "b"`, wantErr: `unexpected "b"`},
+		{filter: `(userName eq "a"`, wantErr: "missing )"},
+		{filter: `userName eq "a")`, wantErr: `unexpected ")"`},
+		{filter: `emails[type eq "work"`, wantErr: "missing ]"},
+		{filter: `not userName pr`, wantErr: "expected ( after not"},
+		{filter: `userName eq 'a'`, wantErr: "unexpected character"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			e, err := ParseFilter(tt.filter)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseFilter(%q) = %v, %v; want error containing %q", tt.filter, e, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFilter(%q): %v", tt.filter, err)
+			}
+			if got := show(e); got != tt.want {
+				t.Fatalf("ParseFilter(%q) = %s, want %s", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path       string
+		wantAttr   string
+		wantFilter string
+		wantSub    string
+		wantErr    bool
+	}{
+		{path: "active", wantAttr: "active"},
+		{path: "displayName", wantAttr: "displayname"},
+		{path: "name.givenName", wantAttr: "name", wantSub: "givenname"},
+		{path: "urn:ietf:params:scim:schemas:core:2.0:User:name.familyName", wantAttr: "name", wantSub: "familyname"},
+		{path: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", wantAttr: "urn:ietf:params:scim:schemas:extension:enterprise:2.0:user:department"},
+		{path: "members", wantAttr: "members"},
+		{path: `members[value eq "2819c223"]`, wantAttr: "members", wantFilter: `(eq value "2819c223")`},
+		{path: `emails[type eq "work"].value`, wantAttr: "emails", wantFilter: `(eq type "work")`, wantSub: "value"},
+		{path: `emails[type eq "work" and primary eq true].Value`, wantAttr: "emails", wantFilter: `(and (eq type "work") (eq primary true))`, wantSub: "value"},
+
+		{path: "", wantErr: true},
+		{path: `"members"`, wantErr: true},
+		{path: "members[", wantErr: true},
+		{path: `members[value eq "1"`, wantErr: true},
+		{path: `members[value eq "1"] extra`, wantErr: true},
+		{path: "members extra", wantErr: true},
+		{path: `members[value]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			p, err := ParsePath(tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParsePath(%q) = %+v, want an error", tt.path, p)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParsePath(%q): %v", tt.path, err)
+			}
+			filter := ""
+			if p.Filter != nil {
+				filter = show(p.Filter)
+			}
+			if p.Attr != tt.wantAttr || filter != tt.wantFilter || p.SubAttr != tt.wantSub {
+				t.Fatalf("ParsePath(%q) = {%s %s %s}, want {%s %s %s}", tt.path, p.Attr, filter, p.SubAttr, tt.wantAttr, tt.wantFilter, tt.wantSub)
+			}
+		})
+	}
+}
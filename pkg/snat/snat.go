@@ -0,0 +1,46 @@
+package snat
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// Source is the inclusive range of IPv4 addresses an SNAT pool translates
+// to. A single address has First equal to Last.
+type Source struct {
+	First netip.Addr
+	Last  netip.Addr
+}
+
+// ParseSource reads an SNAT source: an IPv4 address, a CIDR, which covers
+// all its addresses, or a "first-last" range.
+func ParseSource(s string) (Source, error) {
+	s = strings.TrimSpace(s)
+	if first, last, ok := strings.Cut(s, "-"); ok {
+		a, err1 := netip.ParseAddr(strings.TrimSpace(first))
+		b, err2 := netip.ParseAddr(strings.TrimSpace(last))
+		if err1 != nil || err2 != nil || !a.Is4() || !b.Is4() || b.Less(a) {
+			return Source{}, fmt.Errorf("invalid range %q", s)
+		}
+		return Source{First: a, Last: b}, nil
+	}
+	if prefix, err := netip.ParsePrefix(s); err == nil && prefix.Addr().Is4() {
+		prefix = prefix.Masked()
+		last := prefix.Addr().As4()
+		for i := prefix.Bits(); i < 32; i++ {
+			last[i/8] |= 1 << (7 - i%8)
+		}
+		return Source{First: prefix.Addr(), Last: netip.AddrFrom4(last)}, nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil || !addr.Is4() {
+		return Source{}, fmt.Errorf("invalid source %q", s)
+	}
+	return Source{First: addr, Last: addr}, nil
+}
+
+// Single reports whether the source is one address.
+func (s Source) Single() bool {
+	return s.First == s.Last
+}
@@ -0,0 +1,52 @@
+package snat
+
+import "testing"
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		source  string
+		first   string
+		last    string
+		wantErr bool
+	}{
+		{source: "203.0.113.10", first: "203.0.113.10", last: "203.0.113.10"},
+		{source: " 203.0.113.10 ", first: "203.0.113.10", last: "203.0.113.10"},
+		{source: "203.0.113.10-203.0.113.20", first: "203.0.113.10", last: "203.0.113.20"},
+		{source: " 203.0.113.10 - 203.0.113.20 ", first: "203.0.113.10", last: "203.0.113.20"},
+		{source: "203.0.113.10-203.0.113.10", first: "203.0.113.10", last: "203.0.113.10"},
+		{source: "203.0.113.0/28", first: "203.0.113.0", last: "203.0.113.15"},
+		{source: "203.0.113.7/28", first: "203.0.113.0", last: "203.0.113.15"},
+		{source: "198.51.100.0/23", first: "198.51.100.0", last: "198.51.101.255"},
+		{source: "203.0.113.10/32", first: "203.0.113.10", last: "203.0.113.10"},
+		{source: "0.0.0.0/0", first: "0.0.0.0", last: "255.255.255.255"},
+
+		{source: "", wantErr: true},
+		{source: "gateway.example.com", wantErr: true},
+		{source: "203.0.113.20-203.0.113.10", wantErr: true},
+		{source: "203.0.113.10-", wantErr: true},
+		{source: "203.0.113.10-2001:db8::1", wantErr: true},
+		{source: "2001:db8::1", wantErr: true},
+		{source: "2001:db8::/64", wantErr: true},
+		{source: "203.0.113.0/33", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			got, err := ParseSource(tt.source)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSource(%q) = %v, want an error", tt.source, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSource(%q): %v", tt.source, err)
+			}
+			if got.First.String() != tt.first || got.Last.String() != tt.last {
+				t.Fatalf("ParseSource(%q) = %s-%s, want %s-%s", tt.source, got.First, got.Last, tt.first, tt.last)
+			}
+			if got.Single() != (tt.first == tt.last) {
+				t.Fatalf("ParseSource(%q).Single() = %v", tt.source, got.Single())
+			}
+		})
+	}
+}
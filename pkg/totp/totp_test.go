@@ -0,0 +1,136 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, "12345678901234567890".
+var rfcSecret = base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+func TestCode(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1, reduced to the last six digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code(%d): %v", tt.unix, err)
+		}
+		if got != tt.want {
+			t.Errorf("Code(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Error("Code accepted an invalid secret")
+	}
+	if got, _ := Code(" "+strings.ToLower(rfcSecret)+" ", Step(time.Unix(59, 0))); got != "287082" {
+		t.Errorf("Code with a lowercase, padded secret = %s, want 287082", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+	code := func(s int64) string {
+		c, err := Code(rfcSecret, s)
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name     string
+		code     string
+		lastStep int64
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "current step", code: code(step), wantStep: step, wantOK: true},
+		{name: "previous step within skew", code: code(step - 1), wantStep: step - 1, wantOK: true},
+		{name: "next step within skew", code: code(step + 1), wantStep: step + 1, wantOK: true},
+		{name: "two steps ago", code: code(step - 2)},
+		{name: "two steps ahead", code: code(step + 2)},
+		{name: "spaces are ignored", code: code(step)[:3] + " " + code(step)[3:], wantStep: step, wantOK: true},
+		{name: "too short", code: code(step)[:5]},
+		{name: "too long", code: code(step) + "0"},
+		{name: "empty", code: ""},
+
+		// last_step: a step that was accepted once never matches again
+		{name: "replay of the accepted code", code: code(step), lastStep: step},
+		{name: "earlier code after a later one", code: code(step - 1), lastStep: step},
+		{name: "code after a future step was used", code: code(step), lastStep: step + 1},
+		{name: "next code after the accepted one", code: code(step + 1), lastStep: step, wantStep: step + 1, wantOK: true},
+		{name: "current code after an earlier one", code: code(step), lastStep: step - 1, wantStep: step, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := Validate(rfcSecret, tt.code, now, tt.lastStep)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Fatalf("Validate(%q, lastStep %d) = %d, %v; want %d, %v", tt.code, tt.lastStep, gotStep, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+
+	if _, ok := Validate("not base32!", code(step), now, 0); ok {
+		t.Error("Validate accepted a code for an invalid secret")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	b, _ := GenerateSecret()
+	if a == b {
+		t.Fatal("GenerateSecret returned the same secret twice")
+	}
+	key, err := encoding.DecodeString(a)
+	if err != nil || len(key) != 20 {
+		t.Fatalf("secret %q decodes to %d bytes (%v), want 20", a, len(key), err)
+	}
+	if _, err := Code(a, 1); err != nil {
+		t.Fatalf("Code with a generated secret: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Tridorian ZTNA (Acme)", "jane@acme.com", rfcSecret)
+	u, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("parse %q: %v", uri, err)
+	}
+	if u.Scheme != "otpauth" || u.Host != "totp" {
+		t.Fatalf("unexpected URI %q", uri)
+	}
+	if label, _ := url.PathUnescape(strings.TrimPrefix(u.EscapedPath(), "/")); label != "Tridorian ZTNA (Acme):jane@acme.com" {
+		t.Errorf("label = %q", label)
+	}
+	q := u.Query()
+	for key, want := range map[string]string{
+		"secret":    rfcSecret,
+		"issuer":    "Tridorian ZTNA (Acme)",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	} {
+		if got := q.Get(key); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+}
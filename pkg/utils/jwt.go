@@ -16,6 +16,11 @@ const (
 	PurposeManagement TokenPurpose = "management"
 	PurposeBackoffice TokenPurpose = "backoffice"
 	PurposeTarget     TokenPurpose = "target"
+
+	// Issued after a correct password when the account must enroll a second
+	// factor first. They only allow enrolling one.
+	PurposeManagementMFA TokenPurpose = "management_mfa"
+	PurposeBackofficeMFA TokenPurpose = "backoffice_mfa"
 )
 
 type Claims struct {
@@ -25,13 +30,14 @@ type Claims struct {
 	Role     string       `json:"role,omitempty"`
 	Groups   []string     `json:"groups,omitempty"` // Google Workspace groups
 	OS       string       `json:"os,omitempty"`
+	DeviceID string       `json:"device_id,omitempty"` // Fingerprint of the client device key, if attested
 	Purpose  TokenPurpose `json:"purpose"`
 	jwt.RegisteredClaims
 }
 
 // GenerateToken generates a JWT token signed with EdDSA
 // privateKey should be an ed25519.PrivateKey
-func GenerateToken(privateKey interface{}, purpose TokenPurpose, userID, email, tenantID, role string, groups []string, os string, duration time.Duration) (string, error) {
+func GenerateToken(privateKey interface{}, purpose TokenPurpose, userID, email, tenantID, role string, groups []string, os, deviceID string, duration time.Duration) (string, error) {
 	claims := Claims{
 		UserID:   userID,
 		Email:    email,
@@ -39,6 +45,7 @@ func GenerateToken(privateKey interface{}, purpose TokenPurpose, userID, email,
 		Role:     role,
 		Groups:   groups,
 		OS:       os,
+		DeviceID: deviceID,
 		Purpose:  purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
 			Subject:   userID,
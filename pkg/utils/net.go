@@ -4,7 +4,9 @@ import (
 	"math/big"
 	"net"
 	"net/http"
+	"net/netip"
 	"strings"
+	"sync"
 )
 
 // GetClientIP extracts the client IP address from the request.
@@ -39,6 +41,78 @@ func GetClientIP(r *http.Request) string {
 	return r.RemoteAddr
 }
 
+var (
+	trustedProxiesOnce sync.Once
+	trustedProxies     []netip.Prefix
+)
+
+// loadTrustedProxies reads TRUSTED_PROXIES, comma-separated addresses or
+// CIDRs of the reverse proxies in front of the service.
+func loadTrustedProxies() []netip.Prefix {
+	trustedProxiesOnce.Do(func() {
+		for _, s := range strings.Split(GetEnv("TRUSTED_PROXIES", ""), ",") {
+			s = strings.TrimSpace(s)
+			if s == "" {
+				continue
+			}
+			if prefix, err := netip.ParsePrefix(s); err == nil {
+				trustedProxies = append(trustedProxies, prefix.Masked())
+			} else if addr, err := netip.ParseAddr(s); err == nil {
+				trustedProxies = append(trustedProxies, netip.PrefixFrom(addr, addr.BitLen()))
+			}
+		}
+	})
+	return trustedProxies
+}
+
+func isTrustedProxy(s string, proxies []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, p := range proxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedClientIP returns the client address for decisions a client must
+// not be able to influence, like sign-in throttling. It is the peer
+// address, unless the peer is one of TRUSTED_PROXIES: then it is the last
+// X-Forwarded-For address, or X-Real-IP, that is not a trusted proxy.
+func TrustedClientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	proxies := loadTrustedProxies()
+	if !isTrustedProxy(peer, proxies) {
+		return peer
+	}
+
+	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if _, err := netip.ParseAddr(hop); err != nil {
+				break
+			}
+			if !isTrustedProxy(hop, proxies) {
+				return hop
+			}
+		}
+	}
+	if xri := strings.TrimSpace(r.Header.Get("X-Real-IP")); xri != "" {
+		if _, err := netip.ParseAddr(xri); err == nil {
+			return xri
+		}
+	}
+	return peer
+}
+
 func IncrementIP(ip net.IP) net.IP {
 	nextIP := make(net.IP, len(ip))
 	copy(nextIP, ip)
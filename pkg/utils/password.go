@@ -5,8 +5,78 @@ import (
 	"encoding/base64"
 	"fmt"
 	"math/big"
+	"strings"
+	"unicode"
 )
 
+// PasswordPolicy is what a locally managed password must satisfy.
+type PasswordPolicy struct {
+	MinLength         int
+	RequireComplexity bool // At least three of: lowercase, uppercase, digit, symbol
+}
+
+// DefaultPasswordPolicy applies when a tenant has not configured one.
+var DefaultPasswordPolicy = PasswordPolicy{MinLength: 12, RequireComplexity: true}
+
+// MinPasswordLength is the floor for any configured policy.
+const MinPasswordLength = 8
+
+// PasswordPolicyError reports a password the policy refuses.
+type PasswordPolicyError struct {
+	Reason string
+}
+
+func (e *PasswordPolicyError) Error() string { return e.Reason }
+
+// Validate checks a password against the policy. The account's email is
+// passed so passwords containing its name can be refused.
+func (p PasswordPolicy) Validate(password, email string) error {
+	minLength := p.MinLength
+	if minLength < MinPasswordLength {
+		minLength = MinPasswordLength
+	}
+	if len([]rune(password)) < minLength {
+		return &PasswordPolicyError{fmt.Sprintf("password must be at least %d characters", minLength)}
+	}
+
+	if p.RequireComplexity {
+		var lower, upper, digit, symbol int
+		for _, r := range password {
+			switch {
+			case unicode.IsLower(r):
+				lower = 1
+			case unicode.IsUpper(r):
+				upper = 1
+			case unicode.IsDigit(r):
+				digit = 1
+			default:
+				symbol = 1
+			}
+		}
+		if lower+upper+digit+symbol < 3 {
+			return &PasswordPolicyError{"password must contain at least three of: lowercase letters, uppercase letters, digits, symbols"}
+		}
+	}
+
+	if name, _, _ := strings.Cut(strings.ToLower(email), "@"); len(name) >= 3 && strings.Contains(strings.ToLower(password), name) {
+		return &PasswordPolicyError{"password must not contain the email address"}
+	}
+	return nil
+}
+
+// Generate returns a random password that satisfies the policy.
+func (p PasswordPolicy) Generate() string {
+	length := p.MinLength
+	if length < 16 {
+		length = 16
+	}
+	password := GenerateRandomPassword(length)
+	for i := 0; i < 100 && p.Validate(password, "") != nil; i++ {
+		password = GenerateRandomPassword(length)
+	}
+	return password
+}
+
 func GenerateSecureToken() string {
 	b := make([]byte, 32)
 
@@ -0,0 +1,138 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// decodeCBOR decodes the first CBOR item of data and returns it with the
+// number of bytes it used. It covers what authenticators send: integers,
+// byte and text strings, arrays, maps, booleans and null. Maps decode to
+// map[interface{}]interface{} with int64 or string keys.
+func decodeCBOR(data []byte) (interface{}, int, error) {
+	return decodeItem(data, 0)
+}
+
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("cbor: truncated data")
+
+func decodeItem(data []byte, depth int) (interface{}, int, error) {
+	if depth > maxCBORDepth {
+		return nil, 0, errors.New("cbor: nested too deeply")
+	}
+	if len(data) == 0 {
+		return nil, 0, errCBORTruncated
+	}
+
+	major := data[0] >> 5
+	info := data[0] & 0x1f
+	arg, n, err := decodeArgument(data, info)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch major {
+	case 0: // Unsigned integer
+		if arg > 1<<63-1 {
+			return nil, 0, errors.New("cbor: integer overflow")
+		}
+		return int64(arg), n, nil
+
+	case 1: // Negative integer
+		if arg > 1<<63-1 {
+			return nil, 0, errors.New("cbor: integer overflow")
+		}
+		return -1 - int64(arg), n, nil
+
+	case 2, 3: // Byte string, text string
+		if arg > uint64(len(data)-n) {
+			return nil, 0, errCBORTruncated
+		}
+		end := n + int(arg)
+		if major == 2 {
+			return append([]byte(nil), data[n:end]...), end, nil
+		}
+		return string(data[n:end]), end, nil
+
+	case 4: // Array
+		if arg > uint64(len(data)) {
+			return nil, 0, errCBORTruncated
+		}
+		items := make([]interface{}, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, used, err := decodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			items = append(items, item)
+			n += used
+		}
+		return items, n, nil
+
+	case 5: // Map
+		if arg > uint64(len(data)) {
+			return nil, 0, errCBORTruncated
+		}
+		m := make(map[interface{}]interface{}, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, used, err := decodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, 0, errors.New("cbor: unsupported map key")
+			}
+			value, used, err := decodeItem(data[n:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			n += used
+			m[key] = value
+		}
+		return m, n, nil
+
+	case 7: // Simple values
+		switch info {
+		case 20:
+			return false, n, nil
+		case 21:
+			return true, n, nil
+		case 22, 23:
+			return nil, n, nil
+		}
+	}
+	return nil, 0, errors.New("cbor: unsupported item")
+}
+
+// decodeArgument reads the argument that follows an item's initial byte.
+func decodeArgument(data []byte, info byte) (uint64, int, error) {
+	switch {
+	case info < 24:
+		return uint64(info), 1, nil
+	case info == 24:
+		if len(data) < 2 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(data[1]), 2, nil
+	case info == 25:
+		if len(data) < 3 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint16(data[1:])), 3, nil
+	case info == 26:
+		if len(data) < 5 {
+			return 0, 0, errCBORTruncated
+		}
+		return uint64(binary.BigEndian.Uint32(data[1:])), 5, nil
+	case info == 27:
+		if len(data) < 9 {
+			return 0, 0, errCBORTruncated
+		}
+		return binary.BigEndian.Uint64(data[1:]), 9, nil
+	}
+	return 0, 0, errors.New("cbor: indefinite lengths are not supported")
+}
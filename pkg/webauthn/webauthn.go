@@ -0,0 +1,423 @@
+// Package webauthn implements the relying party side of WebAuthn (passkeys
+// and security keys) for administrator sign-in. Only "none" attestation is
+// requested, so attestation statements are not verified: the credential is
+// trusted because the signed-in administrator registered it.
+package webauthn
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Timeout is how long, in milliseconds, the browser waits for the user.
+const Timeout = 120000
+
+// COSE algorithm identifiers accepted for credentials.
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Authenticator data flags.
+const (
+	flagUserPresent = 0x01
+	flagAttested    = 0x40
+)
+
+// Config identifies the relying party.
+type Config struct {
+	RPID    string   // Domain the credentials are scoped to
+	RPName  string   // Shown by the browser during registration
+	Origins []string // Allowed origins, e.g. https://admin.example.com
+}
+
+// Credential is a registered public key.
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE encoded
+	SignCount uint32
+}
+
+// Descriptor references a credential in options sent to the browser.
+type Descriptor struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// CreationOptions are passed to navigator.credentials.create.
+type CreationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"rp"`
+	User struct {
+		ID          string `json:"id"`
+		Name        string `json:"name"`
+		DisplayName string `json:"displayName"`
+	} `json:"user"`
+	PubKeyCredParams []struct {
+		Type string `json:"type"`
+		Alg  int    `json:"alg"`
+	} `json:"pubKeyCredParams"`
+	Timeout                int          `json:"timeout"`
+	Attestation            string       `json:"attestation"`
+	ExcludeCredentials     []Descriptor `json:"excludeCredentials"`
+	AuthenticatorSelection struct {
+		ResidentKey      string `json:"residentKey"`
+		UserVerification string `json:"userVerification"`
+	} `json:"authenticatorSelection"`
+}
+
+// RequestOptions are passed to navigator.credentials.get.
+type RequestOptions struct {
+	Challenge        string       `json:"challenge"`
+	RPID             string       `json:"rpId"`
+	Timeout          int          `json:"timeout"`
+	AllowCredentials []Descriptor `json:"allowCredentials"`
+	UserVerification string       `json:"userVerification"`
+}
+
+// RegistrationResponse is the browser's PublicKeyCredential from
+// navigator.credentials.create, with binary fields base64url encoded.
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AttestationObject string `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the browser's PublicKeyCredential from
+// navigator.credentials.get, with binary fields base64url encoded.
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    string `json:"clientDataJSON"`
+		AuthenticatorData string `json:"authenticatorData"`
+		Signature         string `json:"signature"`
+		UserHandle        string `json:"userHandle,omitempty"`
+	} `json:"response"`
+}
+
+// NewChallenge returns a random challenge, base64url encoded.
+func NewChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// EncodeID encodes a credential or user ID the way the browser expects it.
+func EncodeID(id []byte) string {
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// DecodeID decodes a base64url value, padded or not.
+func DecodeID(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// CreationOptions builds registration options. exclude lists credentials the
+// user already has, so the same authenticator is not registered twice.
+func (c Config) CreationOptions(challenge string, userID []byte, name, displayName string, exclude [][]byte) *CreationOptions {
+	o := &CreationOptions{
+		Challenge:          challenge,
+		Timeout:            Timeout,
+		Attestation:        "none",
+		ExcludeCredentials: descriptors(exclude),
+	}
+	o.RP.ID = c.RPID
+	o.RP.Name = c.RPName
+	o.User.ID = EncodeID(userID)
+	o.User.Name = name
+	o.User.DisplayName = displayName
+	for _, alg := range []int{AlgES256, AlgEdDSA, AlgRS256} {
+		o.PubKeyCredParams = append(o.PubKeyCredParams, struct {
+			Type string `json:"type"`
+			Alg  int    `json:"alg"`
+		}{Type: "public-key", Alg: alg})
+	}
+	o.AuthenticatorSelection.ResidentKey = "preferred"
+	o.AuthenticatorSelection.UserVerification = "preferred"
+	return o
+}
+
+// RequestOptions builds sign-in options for the user's credentials.
+func (c Config) RequestOptions(challenge string, allow [][]byte) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		RPID:             c.RPID,
+		Timeout:          Timeout,
+		AllowCredentials: descriptors(allow),
+		UserVerification: "preferred",
+	}
+}
+
+func descriptors(ids [][]byte) []Descriptor {
+	list := make([]Descriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, Descriptor{Type: "public-key", ID: EncodeID(id)})
+	}
+	return list
+}
+
+// VerifyRegistration checks a registration against the challenge that was
+// issued and returns the new credential.
+func (c Config) VerifyRegistration(challenge string, r *RegistrationResponse) (*Credential, error) {
+	if r.Type != "public-key" {
+		return nil, errors.New("unexpected credential type")
+	}
+	if _, err := c.verifyClientData(r.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	raw, err := DecodeID(r.Response.AttestationObject)
+	if err != nil {
+		return nil, errors.New("invalid attestation object")
+	}
+	item, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid attestation object: %w", err)
+	}
+	attestation, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid attestation object")
+	}
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, errors.New("attestation object has no authenticator data")
+	}
+
+	data, err := c.parseAuthData(authData)
+	if err != nil {
+		return nil, err
+	}
+	if data.flags&flagAttested == 0 || len(data.credentialID) == 0 {
+		return nil, errors.New("authenticator data has no credential")
+	}
+	if _, err := parsePublicKey(data.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        data.credentialID,
+		PublicKey: data.publicKey,
+		SignCount: data.signCount,
+	}, nil
+}
+
+// VerifyAssertion checks a sign-in against the challenge that was issued and
+// the stored credential, and returns the authenticator's new signature count.
+func (c Config) VerifyAssertion(challenge string, cred *Credential, r *AssertionResponse) (uint32, error) {
+	if r.Type != "public-key" {
+		return 0, errors.New("unexpected credential type")
+	}
+	id, err := DecodeID(r.ID)
+	if err != nil || !bytes.Equal(id, cred.ID) {
+		return 0, errors.New("credential mismatch")
+	}
+
+	clientData, err := c.verifyClientData(r.Response.ClientDataJSON, "webauthn.get", challenge)
+	if err != nil {
+		return 0, err
+	}
+	authData, err := DecodeID(r.Response.AuthenticatorData)
+	if err != nil {
+		return 0, errors.New("invalid authenticator data")
+	}
+	data, err := c.parseAuthData(authData)
+	if err != nil {
+		return 0, err
+	}
+	signature, err := DecodeID(r.Response.Signature)
+	if err != nil {
+		return 0, errors.New("invalid signature encoding")
+	}
+
+	key, err := parsePublicKey(cred.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientHash := sha256.Sum256(clientData)
+	signed := append(append([]byte(nil), authData...), clientHash[:]...)
+	if err := key.verify(signed, signature); err != nil {
+		return 0, err
+	}
+
+	// A counter that does not move forward suggests a cloned authenticator.
+	// Authenticators that do not count always report zero.
+	if (data.signCount != 0 || cred.SignCount != 0) && data.signCount <= cred.SignCount {
+		return 0, errors.New("signature counter did not increase")
+	}
+	return data.signCount, nil
+}
+
+// verifyClientData checks the type, challenge and origin of clientDataJSON
+// and returns its raw bytes.
+func (c Config) verifyClientData(encoded, typ, challenge string) ([]byte, error) {
+	raw, err := DecodeID(encoded)
+	if err != nil {
+		return nil, errors.New("invalid client data")
+	}
+	var clientData struct {
+		Type      string `json:"type"`
+		Challenge string `json:"challenge"`
+		Origin    string `json:"origin"`
+	}
+	if err := json.Unmarshal(raw, &clientData); err != nil {
+		return nil, errors.New("invalid client data")
+	}
+
+	if clientData.Type != typ {
+		return nil, fmt.Errorf("unexpected client data type %q", clientData.Type)
+	}
+	if challenge == "" || subtle.ConstantTimeCompare([]byte(strings.TrimRight(clientData.Challenge, "=")), []byte(challenge)) != 1 {
+		return nil, errors.New("challenge mismatch")
+	}
+	for _, origin := range c.Origins {
+		if clientData.Origin == origin {
+			return raw, nil
+		}
+	}
+	return nil, fmt.Errorf("origin %q is not allowed", clientData.Origin)
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+// parseAuthData decodes authenticator data and checks it was produced for
+// this relying party with the user present.
+func (c Config) parseAuthData(raw []byte) (*authenticatorData, error) {
+	if len(raw) < 37 {
+		return nil, errors.New("authenticator data too short")
+	}
+	rpIDHash := sha256.Sum256([]byte(c.RPID))
+	if subtle.ConstantTimeCompare(raw[:32], rpIDHash[:]) != 1 {
+		return nil, errors.New("credential belongs to another relying party")
+	}
+
+	data := &authenticatorData{
+		flags:     raw[32],
+		signCount: binary.BigEndian.Uint32(raw[33:37]),
+	}
+	if data.flags&flagUserPresent == 0 {
+		return nil, errors.New("user presence was not confirmed")
+	}
+
+	if data.flags&flagAttested != 0 {
+		rest := raw[37:]
+		if len(rest) < 18 {
+			return nil, errors.New("attested credential data too short")
+		}
+		idLen := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLen {
+			return nil, errors.New("attested credential data too short")
+		}
+		data.credentialID = append([]byte(nil), rest[:idLen]...)
+		rest = rest[idLen:]
+
+		_, n, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("invalid credential public key: %w", err)
+		}
+		data.publicKey = append([]byte(nil), rest[:n]...)
+	}
+	return data, nil
+}
+
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE key for one of the accepted algorithms.
+func parsePublicKey(raw []byte) (*publicKey, error) {
+	item, _, err := decodeCBOR(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid credential public key: %w", err)
+	}
+	m, ok := item.(map[interface{}]interface{})
+	if !ok {
+		return nil, errors.New("invalid credential public key")
+	}
+	kty, _ := m[int64(1)].(int64)
+	alg, _ := m[int64(3)].(int64)
+
+	switch {
+	case kty == 2 && alg == AlgES256:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		y, _ := m[int64(-3)].([]byte)
+		if crv != 1 || len(x) != 32 || len(y) != 32 {
+			return nil, errors.New("invalid P-256 key")
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, errors.New("invalid P-256 key")
+		}
+		return &publicKey{alg: alg, key: pub}, nil
+
+	case kty == 1 && alg == AlgEdDSA:
+		crv, _ := m[int64(-1)].(int64)
+		x, _ := m[int64(-2)].([]byte)
+		if crv != 6 || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+
+	case kty == 3 && alg == AlgRS256:
+		n, _ := m[int64(-1)].([]byte)
+		e, _ := m[int64(-2)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA key")
+		}
+		exp := 0
+		for _, b := range e {
+			exp = exp<<8 | int(b)
+		}
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exp}}, nil
+	}
+	return nil, fmt.Errorf("unsupported credential algorithm %d", alg)
+}
+
+func (k *publicKey) verify(data, signature []byte) error {
+	ok := false
+	switch pub := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = ecdsa.VerifyASN1(pub, digest[:], signature)
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(pub, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		ok = rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature) == nil
+	}
+	if !ok {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// encodeCBOR is the test side of decodeCBOR, for the types authenticators use.
+func encodeCBOR(v interface{}) []byte {
+	head := func(major byte, n uint64) []byte {
+		switch {
+		case n < 24:
+			return []byte{major<<5 | byte(n)}
+		case n <= 0xff:
+			return []byte{major<<5 | 24, byte(n)}
+		case n <= 0xffff:
+			return binary.BigEndian.AppendUint16([]byte{major<<5 | 25}, uint16(n))
+		case n <= 0xffffffff:
+			return binary.BigEndian.AppendUint32([]byte{major<<5 | 26}, uint32(n))
+		}
+		return binary.BigEndian.AppendUint64([]byte{major<<5 | 27}, n)
+	}
+	switch v := v.(type) {
+	case int:
+		return encodeCBOR(int64(v))
+	case int64:
+		if v < 0 {
+			return head(1, uint64(-1-v))
+		}
+		return head(0, uint64(v))
+	case []byte:
+		return append(head(2, uint64(len(v))), v...)
+	case string:
+		return append(head(3, uint64(len(v))), v...)
+	case []interface{}:
+		out := head(4, uint64(len(v)))
+		for _, item := range v {
+			out = append(out, encodeCBOR(item)...)
+		}
+		return out
+	case map[interface{}]interface{}:
+		// canonical order, so equal maps encode to equal bytes
+		pairs := make([][]byte, 0, len(v))
+		for k, item := range v {
+			pairs = append(pairs, append(encodeCBOR(k), encodeCBOR(item)...))
+		}
+		sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i], pairs[j]) < 0 })
+		return append(head(5, uint64(len(v))), bytes.Join(pairs, nil)...)
+	case bool:
+		if v {
+			return []byte{0xf5}
+		}
+		return []byte{0xf4}
+	case nil:
+		return []byte{0xf6}
+	}
+	panic("encodeCBOR: unsupported type")
+}
+
+func TestDecodeCBOR(t *testing.T) {
+	deep := bytes.Repeat([]byte{0x81}, maxCBORDepth+1)
+	deep = append(deep, 0x00)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    interface{}
+		wantLen int
+		wantErr string
+	}{
+		{name: "small int", data: []byte{0x17}, want: int64(23), wantLen: 1},
+		{name: "one byte int", data: []byte{0x18, 0xff}, want: int64(255), wantLen: 2},
+		{name: "two byte int", data: []byte{0x19, 0x01, 0x00}, want: int64(256), wantLen: 3},
+		{name: "four byte int", data: []byte{0x1a, 0x00, 0x01, 0x00, 0x00}, want: int64(65536), wantLen: 5},
+		{name: "eight byte int", data: encodeCBOR(int64(1) << 40), want: int64(1) << 40, wantLen: 9},
+		{name: "negative int", data: []byte{0x20}, want: int64(-1), wantLen: 1},
+		{name: "COSE algorithm", data: []byte{0x39, 0x01, 0x00}, want: int64(-257), wantLen: 3},
+		{name: "byte string", data: []byte{0x43, 1, 2, 3}, want: []byte{1, 2, 3}, wantLen: 4},
+		{name: "text string", data: []byte{0x64, 'n', 'o', 'n', 'e'}, want: "none", wantLen: 5},
+		{name: "array", data: []byte{0x82, 0x01, 0x20}, want: []interface{}{int64(1), int64(-1)}, wantLen: 3},
+		{
+			name:    "map with int and text keys",
+			data:    []byte{0xa2, 0x01, 0x02, 0x63, 'f', 'm', 't', 0x64, 'n', 'o', 'n', 'e'},
+			want:    map[interface{}]interface{}{int64(1): int64(2), "fmt": "none"},
+			wantLen: 12,
+		},
+		{name: "true", data: []byte{0xf5}, want: true, wantLen: 1},
+		{name: "false", data: []byte{0xf4}, want: false, wantLen: 1},
+		{name: "null", data: []byte{0xf6}, want: nil, wantLen: 1},
+		{name: "trailing data is not consumed", data: []byte{0x01, 0x02}, want: int64(1), wantLen: 1},
+
+		{name: "empty", data: nil, wantErr: "truncated"},
+		{name: "truncated argument", data: []byte{0x19, 0x01}, wantErr: "truncated"},
+		{name: "truncated byte string", data: []byte{0x45, 1, 2}, wantErr: "truncated"},
+		{name: "huge byte string length", data: []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, wantErr: "truncated"},
+		{name: "huge array length", data: []byte{0x9a, 0xff, 0xff, 0xff, 0xff}, wantErr: "truncated"},
+		{name: "truncated array", data: []byte{0x82, 0x01}, wantErr: "truncated"},
+		{name: "truncated map value", data: []byte{0xa1, 0x01}, wantErr: "truncated"},
+		{name: "byte string map key", data: []byte{0xa1, 0x41, 0x00, 0x01}, wantErr: "unsupported map key"},
+		{name: "indefinite length", data: []byte{0x5f, 0x41, 0x00, 0xff}, wantErr: "indefinite"},
+		{name: "integer overflow", data: []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, wantErr: "overflow"},
+		{name: "float", data: []byte{0xf9, 0x3c, 0x00}, wantErr: "unsupported item"},
+		{name: "tag", data: []byte{0xc0, 0x00}, wantErr: "unsupported item"},
+		{name: "nested too deeply", data: deep, wantErr: "nested too deeply"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, n, err := decodeCBOR(tt.data)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("decodeCBOR error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeCBOR: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) || n != tt.wantLen {
+				t.Fatalf("decodeCBOR = %#v (%d bytes), want %#v (%d bytes)", got, n, tt.want, tt.wantLen)
+			}
+		})
+	}
+}
+
+const (
+	testRPID   = "acme.example.com"
+	testOrigin = "https://acme.example.com"
+)
+
+var testRP = Config{RPID: testRPID, RPName: "Test", Origins: []string{testOrigin}}
+
+// authenticator is a software P-256 authenticator.
+type authenticator struct {
+	key    *ecdsa.PrivateKey
+	credID []byte
+}
+
+func newAuthenticator(t *testing.T) *authenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return &authenticator{key: key, credID: []byte("credential-1")}
+}
+
+func (a *authenticator) coseKey() []byte {
+	var x, y [32]byte
+	a.key.PublicKey.X.FillBytes(x[:])
+	a.key.PublicKey.Y.FillBytes(y[:])
+	return encodeCBOR(map[interface{}]interface{}{
+		int64(1): int64(2), int64(3): int64(AlgES256), int64(-1): int64(1), int64(-2): x[:], int64(-3): y[:],
+	})
+}
+
+func authData(rpID string, flags byte, count uint32, attested []byte) []byte {
+	hash := sha256.Sum256([]byte(rpID))
+	out := append(hash[:], flags)
+	out = binary.BigEndian.AppendUint32(out, count)
+	return append(out, attested...)
+}
+
+func (a *authenticator) attestedData(coseKey []byte) []byte {
+	out := make([]byte, 16) // AAGUID
+	out = binary.BigEndian.AppendUint16(out, uint16(len(a.credID)))
+	out = append(out, a.credID...)
+	return append(out, coseKey...)
+}
+
+func clientDataJSON(typ, challenge, origin string) string {
+	data, _ := json.Marshal(map[string]string{"type": typ, "challenge": challenge, "origin": origin})
+	return EncodeID(data)
+}
+
+func TestVerifyRegistration(t *testing.T) {
+	auth := newAuthenticator(t)
+	challenge, _ := NewChallenge()
+
+	tests := []struct {
+		name    string
+		modify  func(r *RegistrationResponse, attestation map[interface{}]interface{})
+		wantErr string
+	}{
+		{name: "valid none attestation"},
+		{
+			name:    "wrong credential type",
+			modify:  func(r *RegistrationResponse, _ map[interface{}]interface{}) { r.Type = "password" },
+			wantErr: "unexpected credential type",
+		},
+		{
+			name: "other challenge",
+			modify: func(r *RegistrationResponse, _ map[interface{}]interface{}) {
+				r.Response.ClientDataJSON = clientDataJSON("webauthn.create", "other", testOrigin)
+			},
+			wantErr: "challenge mismatch",
+		},
+		{
+			name: "other origin",
+			modify: func(r *RegistrationResponse, _ map[interface{}]interface{}) {
+				r.Response.ClientDataJSON = clientDataJSON("webauthn.create", challenge, "https://evil.example.com")
+			},
+			wantErr: "is not allowed",
+		},
+		{
+			name: "sign-in client data",
+			modify: func(r *RegistrationResponse, _ map[interface{}]interface{}) {
+				r.Response.ClientDataJSON = clientDataJSON("webauthn.get", challenge, testOrigin)
+			},
+			wantErr: "unexpected client data type",
+		},
+		{
+			name: "other relying party",
+			modify: func(_ *RegistrationResponse, a map[interface{}]interface{}) {
+				a["authData"] = authData("evil.example.com", flagUserPresent|flagAttested, 0, auth.attestedData(auth.coseKey()))
+			},
+			wantErr: "another relying party",
+		},
+		{
+			name: "user not present",
+			modify: func(_ *RegistrationResponse, a map[interface{}]interface{}) {
+				a["authData"] = authData(testRPID, flagAttested, 0, auth.attestedData(auth.coseKey()))
+			},
+			wantErr: "user presence",
+		},
+		{
+			name: "no attested credential",
+			modify: func(_ *RegistrationResponse, a map[interface{}]interface{}) {
+				a["authData"] = authData(testRPID, flagUserPresent, 0, nil)
+			},
+			wantErr: "no credential",
+		},
+		{
+			name: "truncated credential data",
+			modify: func(_ *RegistrationResponse, a map[interface{}]interface{}) {
+				a["authData"] = authData(testRPID, flagUserPresent|flagAttested, 0, auth.attestedData(nil)[:10])
+			},
+			wantErr: "too short",
+		},
+		{
+			name: "unsupported algorithm",
+			modify: func(_ *RegistrationResponse, a map[interface{}]interface{}) {
+				key := encodeCBOR(map[interface{}]interface{}{int64(1): int64(2), int64(3): int64(-35)})
+				a["authData"] = authData(testRPID, flagUserPresent|flagAttested, 0, auth.attestedData(key))
+			},
+			wantErr: "unsupported credential algorithm",
+		},
+		{
+			name: "point not on the curve",
+			modify: func(_ *RegistrationResponse, a map[interface{}]interface{}) {
+				key := encodeCBOR(map[interface{}]interface{}{
+					int64(1): int64(2), int64(3): int64(AlgES256), int64(-1): int64(1),
+					int64(-2): bytes.Repeat([]byte{1}, 32), int64(-3): bytes.Repeat([]byte{2}, 32),
+				})
+				a["authData"] = authData(testRPID, flagUserPresent|flagAttested, 0, auth.attestedData(key))
+			},
+			wantErr: "invalid P-256 key",
+		},
+		{
+			name:    "no authenticator data",
+			modify:  func(_ *RegistrationResponse, a map[interface{}]interface{}) { delete(a, "authData") },
+			wantErr: "no authenticator data",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attestation := map[interface{}]interface{}{
+				"fmt":      "none",
+				"attStmt":  map[interface{}]interface{}{},
+				"authData": authData(testRPID, flagUserPresent|flagAttested, 0, auth.attestedData(auth.coseKey())),
+			}
+			r := &RegistrationResponse{ID: EncodeID(auth.credID), Type: "public-key"}
+			r.Response.ClientDataJSON = clientDataJSON("webauthn.create", challenge, testOrigin)
+			if tt.modify != nil {
+				tt.modify(r, attestation)
+			}
+			r.Response.AttestationObject = EncodeID(encodeCBOR(attestation))
+
+			cred, err := testRP.VerifyRegistration(challenge, r)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("VerifyRegistration error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyRegistration: %v", err)
+			}
+			if !bytes.Equal(cred.ID, auth.credID) || !bytes.Equal(cred.PublicKey, auth.coseKey()) {
+				t.Fatalf("unexpected credential %+v", cred)
+			}
+		})
+	}
+
+	t.Run("attestation object is not a map", func(t *testing.T) {
+		r := &RegistrationResponse{ID: EncodeID(auth.credID), Type: "public-key"}
+		r.Response.ClientDataJSON = clientDataJSON("webauthn.create", challenge, testOrigin)
+		r.Response.AttestationObject = EncodeID(encodeCBOR([]interface{}{int64(1)}))
+		if _, err := testRP.VerifyRegistration(challenge, r); err == nil {
+			t.Fatal("VerifyRegistration accepted an array")
+		}
+	})
+}
+
+func TestVerifyAssertion(t *testing.T) {
+	auth := newAuthenticator(t)
+	cred := &Credential{ID: auth.credID, PublicKey: auth.coseKey(), SignCount: 5}
+	challenge, _ := NewChallenge()
+
+	sign := func(data []byte, clientData string) string {
+		raw, _ := DecodeID(clientData)
+		hash := sha256.Sum256(raw)
+		digest := sha256.Sum256(append(append([]byte(nil), data...), hash[:]...))
+		sig, err := ecdsa.SignASN1(rand.Reader, auth.key, digest[:])
+		if err != nil {
+			t.Fatalf("sign: %v", err)
+		}
+		return EncodeID(sig)
+	}
+	assertion := func(count uint32, clientData string) *AssertionResponse {
+		r := &AssertionResponse{ID: EncodeID(auth.credID), Type: "public-key"}
+		data := authData(testRPID, flagUserPresent, count, nil)
+		r.Response.ClientDataJSON = clientData
+		r.Response.AuthenticatorData = EncodeID(data)
+		r.Response.Signature = sign(data, clientData)
+		return r
+	}
+	valid := clientDataJSON("webauthn.get", challenge, testOrigin)
+
+	tests := []struct {
+		name      string
+		cred      *Credential
+		response  *AssertionResponse
+		wantCount uint32
+		wantErr   string
+	}{
+		{name: "valid", response: assertion(6, valid), wantCount: 6},
+		{name: "counter did not increase", response: assertion(5, valid), wantErr: "did not increase"},
+		{name: "counter went back", response: assertion(4, valid), wantErr: "did not increase"},
+		{
+			name:     "authenticator without a counter",
+			cred:     &Credential{ID: auth.credID, PublicKey: auth.coseKey()},
+			response: assertion(0, valid),
+		},
+		{
+			name: "other credential",
+			response: func() *AssertionResponse {
+				r := assertion(6, valid)
+				r.ID = EncodeID([]byte("credential-2"))
+				return r
+			}(),
+			wantErr: "credential mismatch",
+		},
+		{name: "other challenge", response: assertion(6, clientDataJSON("webauthn.get", "other", testOrigin)), wantErr: "challenge mismatch"},
+		{name: "other origin", response: assertion(6, clientDataJSON("webauthn.get", challenge, "https://evil.example.com")), wantErr: "is not allowed"},
+		{
+			name: "signature over other data",
+			response: func() *AssertionResponse {
+				r := assertion(6, valid)
+				r.Response.AuthenticatorData = EncodeID(authData(testRPID, flagUserPresent, 7, nil))
+				return r
+			}(),
+			wantErr: "invalid signature",
+		},
+		{
+			name: "user not present",
+			response: func() *AssertionResponse {
+				r := assertion(6, valid)
+				data := authData(testRPID, 0, 6, nil)
+				r.Response.AuthenticatorData = EncodeID(data)
+				r.Response.Signature = sign(data, valid)
+				return r
+			}(),
+			wantErr: "user presence",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cred
+			if tt.cred != nil {
+				c = tt.cred
+			}
+			count, err := testRP.VerifyAssertion(challenge, c, tt.response)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("VerifyAssertion error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAssertion: %v", err)
+			}
+			if count != tt.wantCount {
+				t.Fatalf("count = %d, want %d", count, tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestVerifyAssertionEd25519(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	cred := &Credential{
+		ID:        []byte("ed25519"),
+		PublicKey: encodeCBOR(map[interface{}]interface{}{int64(1): int64(1), int64(3): int64(AlgEdDSA), int64(-1): int64(6), int64(-2): []byte(pub)}),
+	}
+	challenge, _ := NewChallenge()
+	clientData := clientDataJSON("webauthn.get", challenge, testOrigin)
+	raw, _ := DecodeID(clientData)
+	hash := sha256.Sum256(raw)
+	data := authData(testRPID, flagUserPresent, 0, nil)
+
+	r := &AssertionResponse{ID: EncodeID(cred.ID), Type: "public-key"}
+	r.Response.ClientDataJSON = clientData
+	r.Response.AuthenticatorData = EncodeID(data)
+	r.Response.Signature = EncodeID(ed25519.Sign(priv, append(append([]byte(nil), data...), hash[:]...)))
+	if _, err := testRP.VerifyAssertion(challenge, cred, r); err != nil {
+		t.Fatalf("VerifyAssertion: %v", err)
+	}
+}
@@ -1,13 +1,16 @@
 #!/bin/bash
 
 # Generate EdDSA (Ed25519) Key Pair for Tridorian ZTNA
-# This script generates new cryptographic keys for JWT signing
+# This script generates new cryptographic keys for JWT signing, and the
+# gateway CA that signs gateway node certificates for mutual TLS
 
 set -e
 
 KEYS_DIR="./keys"
 PRIVATE_KEY_FILE="$KEYS_DIR/private_key.pem"
 PUBLIC_KEY_FILE="$KEYS_DIR/public_key.pem"
+GATEWAY_CA_KEY_FILE="$KEYS_DIR/gateway_ca_key.pem"
+GATEWAY_CA_CERT_FILE="$KEYS_DIR/gateway_ca.pem"
 ENV_FILE=".env"
 
 echo "🔐 Generating EdDSA (Ed25519) Key Pair..."
@@ -23,9 +26,19 @@ openssl genpkey -algorithm ED25519 -out "$PRIVATE_KEY_FILE"
 echo "📝 Extracting public key..."
 openssl pkey -in "$PRIVATE_KEY_FILE" -pubout -out "$PUBLIC_KEY_FILE"
 
+# Generate the gateway CA
+echo "📝 Generating gateway CA..."
+openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:P-256 -out "$GATEWAY_CA_KEY_FILE"
+openssl req -x509 -new -key "$GATEWAY_CA_KEY_FILE" -out "$GATEWAY_CA_CERT_FILE" -days 3650 \
+    -subj "/CN=Tridorian ZTNA Gateway CA" \
+    -addext "basicConstraints=critical,CA:TRUE" \
+    -addext "keyUsage=critical,keyCertSign,cRLSign"
+
 # Set proper permissions
 chmod 600 "$PRIVATE_KEY_FILE"
 chmod 644 "$PUBLIC_KEY_FILE"
+chmod 600 "$GATEWAY_CA_KEY_FILE"
+chmod 644 "$GATEWAY_CA_CERT_FILE"
 
 echo ""
 echo "✅ Keys generated successfully!"
@@ -33,11 +46,15 @@ echo ""
 echo "📁 Files created:"
 echo "   - Private Key: $PRIVATE_KEY_FILE (600)"
 echo "   - Public Key:  $PUBLIC_KEY_FILE (644)"
+echo "   - Gateway CA Key:         $GATEWAY_CA_KEY_FILE (600)"
+echo "   - Gateway CA Certificate: $GATEWAY_CA_CERT_FILE (644)"
 echo ""
 
 # Read the keys
 PRIVATE_KEY=$(cat "$PRIVATE_KEY_FILE")
 PUBLIC_KEY=$(cat "$PUBLIC_KEY_FILE")
+GATEWAY_CA_KEY=$(cat "$GATEWAY_CA_KEY_FILE")
+GATEWAY_CA_CERT=$(cat "$GATEWAY_CA_CERT_FILE")
 
 # Update or create .env file
 echo "📝 Updating .env file..."
@@ -45,7 +62,7 @@ echo "📝 Updating .env file..."
 # Remove old key entries if they exist
 if [ -f "$ENV_FILE" ]; then
     grep -v "^ZTNA_PRIVATE_KEY=" "$ENV_FILE" > "$ENV_FILE.tmp" || true
-    grep -v "^ZTNA_PUBLIC_KEY=" "$ENV_FILE.tmp" > "$ENV_FILE" || true
+    grep -v "^ZTNA_PUBLIC_KEY=" "$ENV_FILE.tmp" | grep -v "^GATEWAY_CA_KEY=" | grep -v "^GATEWAY_CA_CERT=" > "$ENV_FILE" || true
     rm -f "$ENV_FILE.tmp"
 fi
 
@@ -56,13 +73,17 @@ cat >> "$ENV_FILE" << EOF
 # Generated: $(date -u +"%Y-%m-%dT%H:%M:%SZ")
 ZTNA_PRIVATE_KEY="$PRIVATE_KEY"
 ZTNA_PUBLIC_KEY="$PUBLIC_KEY"
+
+# Gateway CA for gateway node certificates (mutual TLS)
+GATEWAY_CA_KEY="$GATEWAY_CA_KEY"
+GATEWAY_CA_CERT="$GATEWAY_CA_CERT"
 EOF
 
 echo "✅ .env file updated!"
 echo ""
 echo "⚠️  IMPORTANT SECURITY NOTES:"
 echo "   1. Never commit .env file to git"
-echo "   2. Keep private_key.pem secure"
+echo "   2. Keep private_key.pem and gateway_ca_key.pem secure"
 echo "   3. Rotate keys regularly (every 90 days)"
 echo "   4. Use different keys for dev/staging/prod"
 echo ""